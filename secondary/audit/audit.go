@@ -0,0 +1,336 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// Package audit submits audit events of the index service to the audit
+// daemon of the local memcached.
+package audit
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/dcp/transport"
+	memcached "github.com/couchbase/indexing/secondary/dcp/transport/client"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/security"
+)
+
+//
+// Event ids of the index service.  The ids are in the range allocated to
+// the index service in the audit descriptors of the cluster.  The events and
+// their fields are described in audit_descriptor.json.
+//
+const (
+	CREATE_INDEX uint32 = 49152 + iota
+	DROP_INDEX
+	BUILD_INDEX
+	ALTER_INDEX
+	RESTORE_INDEX
+)
+
+var EVENT_QUEUE_SIZE = 1000
+var SETTINGS_REFRESH_INTERVAL = time.Minute
+
+const timestampFormat = "2006-01-02T15:04:05.000-07:00"
+
+type userId struct {
+	Domain string `json:"domain"`
+	User   string `json:"user"`
+}
+
+type endpoint struct {
+	Ip   string `json:"ip"`
+	Port int    `json:"port"`
+}
+
+type event struct {
+	id   uint32
+	user userId
+	body map[string]interface{}
+}
+
+// auditSettings is the cluster audit setting, as in /settings/audit.
+type auditSettings struct {
+	AuditdEnabled bool     `json:"auditdEnabled"`
+	Disabled      []uint32 `json:"disabled"`
+	DisabledUsers []struct {
+		Name   string `json:"name"`
+		Domain string `json:"domain"`
+	} `json:"disabledUsers"`
+}
+
+type auditor struct {
+	clusterAddr string
+	eventCh     chan *event
+
+	conn      *memcached.Client
+	settings  *auditSettings
+	refreshed time.Time
+}
+
+var gAuditor *auditor
+var gAuditorOnce sync.Once
+
+//
+// Init starts submitting audit events.  Events logged before Init are
+// dropped.
+//
+func Init(clusterAddr string) {
+
+	gAuditorOnce.Do(func() {
+		a := &auditor{
+			clusterAddr: clusterAddr,
+			eventCh:     make(chan *event, EVENT_QUEUE_SIZE),
+		}
+		go a.run()
+
+		gAuditor = a
+	})
+}
+
+//
+// Log an audit event for request r made by creds.  r and creds are nil for a
+// request which is not authenticated by the indexer.  fields are the event
+// specific fields, such as the index name and request parameters.  The
+// event is submitted in the background, and is dropped if audit is disabled
+// for the event or the user in the cluster audit setting.
+//
+func Log(id uint32, r *http.Request, creds cbauth.Creds, fields map[string]interface{}) {
+
+	a := gAuditor
+	if a == nil {
+		return
+	}
+
+	body := make(map[string]interface{})
+	for key, value := range fields {
+		body[key] = value
+	}
+
+	body["timestamp"] = time.Now().Format(timestampFormat)
+
+	var user userId
+	if creds != nil {
+		user = userId{Domain: creds.Domain(), User: creds.Name()}
+		body["real_userid"] = user
+	}
+
+	if r != nil {
+		if remote, ok := parseEndpoint(r.RemoteAddr); ok {
+			body["remote"] = remote
+		}
+
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+			if local, ok := parseEndpoint(addr.String()); ok {
+				body["local"] = local
+			}
+		}
+	}
+
+	select {
+	case a.eventCh <- &event{id: id, user: user, body: body}:
+	default:
+		logging.Warnf("audit::Log: event queue is full.  Drop event %v", id)
+	}
+}
+
+//
+// LogIndexRequest logs an audit event for an index DDL request.  params are
+// the request parameters, and err is the error of the request, if any.
+//
+func LogIndexRequest(id uint32, r *http.Request, creds cbauth.Creds,
+	bucket, scope, collection, index string, params map[string]interface{}, err error) {
+
+	fields := make(map[string]interface{})
+	for key, value := range map[string]string{
+		"bucket_name":     bucket,
+		"scope_name":      scope,
+		"collection_name": collection,
+		"index_name":      index,
+	} {
+		if len(value) != 0 {
+			fields[key] = value
+		}
+	}
+
+	if len(params) != 0 {
+		fields["parameters"] = params
+	}
+
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+
+	Log(id, r, creds, fields)
+}
+
+func parseEndpoint(addr string) (*endpoint, bool) {
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, false
+	}
+
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, false
+	}
+
+	return &endpoint{Ip: host, Port: p}, true
+}
+
+func (a *auditor) run() {
+
+	for ev := range a.eventCh {
+		if !a.isEnabled(ev) {
+			continue
+		}
+
+		if err := a.put(ev); err != nil {
+			logging.Errorf("audit::run: Fail to submit event %v.  Error = %v", ev.id, err)
+		}
+	}
+}
+
+//
+// isEnabled returns false if audit is disabled for the event in the cluster
+// audit setting.  If the setting is not available, the event is submitted,
+// and the audit daemon applies the setting.
+//
+func (a *auditor) isEnabled(ev *event) bool {
+
+	if time.Since(a.refreshed) > SETTINGS_REFRESH_INTERVAL {
+		if settings, err := a.getSettings(); err == nil {
+			a.settings = settings
+		} else {
+			logging.Warnf("audit::isEnabled: Fail to get audit settings.  Error = %v", err)
+		}
+		a.refreshed = time.Now()
+	}
+
+	settings := a.settings
+	if settings == nil {
+		return true
+	}
+
+	if !settings.AuditdEnabled {
+		return false
+	}
+
+	for _, id := range settings.Disabled {
+		if id == ev.id {
+			return false
+		}
+	}
+
+	for _, user := range settings.DisabledUsers {
+		if user.Name == ev.user.User && user.Domain == ev.user.Domain {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a *auditor) getSettings() (*auditSettings, error) {
+
+	url := common.ClusterUrl(a.clusterAddr) + "/settings/audit"
+	params := &security.RequestParams{Timeout: time.Duration(10) * time.Second}
+	resp, err := security.GetWithAuth(url, params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Fail to get %v.  Status %v", url, resp.Status)
+	}
+
+	settings := &auditSettings{}
+	if err := json.NewDecoder(resp.Body).Decode(settings); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (a *auditor) connect() error {
+
+	cinfo, err := common.FetchNewClusterInfoCache(a.clusterAddr, common.DEFAULT_POOL, "audit")
+	if err != nil {
+		return err
+	}
+
+	cinfo.RLock()
+	addr, err := cinfo.GetLocalServiceAddress(common.KV_SERVICE)
+	cinfo.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	conn, err := memcached.Connect("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	user, passwd, err := cbauth.GetMemcachedServiceAuth(addr)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if _, err := conn.Auth(user, passwd); err != nil {
+		conn.Close()
+		return err
+	}
+
+	a.conn = conn
+	return nil
+}
+
+func (a *auditor) put(ev *event) error {
+
+	if a.conn == nil {
+		if err := a.connect(); err != nil {
+			return err
+		}
+	}
+
+	body, err := json.Marshal(ev.body)
+	if err != nil {
+		return err
+	}
+
+	extras := make([]byte, 4)
+	binary.BigEndian.PutUint32(extras, ev.id)
+
+	req := &transport.MCRequest{
+		Opcode: transport.AUDIT_PUT,
+		Extras: extras,
+		Body:   body,
+	}
+
+	if _, err := a.conn.Send(req); err != nil {
+		if !a.conn.IsHealthy() {
+			a.conn.Close()
+			a.conn = nil
+		}
+		return err
+	}
+
+	return nil
+}
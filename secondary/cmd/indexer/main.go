@@ -36,6 +36,7 @@ func main() {
 	cluster := fset.String("cluster", indexer.DEFAULT_CLUSTER_ENDPOINT, "Couchbase cluster address")
 	adminPort := fset.String("adminPort", "9100", "Index ddl and status port")
 	scanPort := fset.String("scanPort", "9101", "Index scanner port")
+	grpcScanPort := fset.String("grpcScanPort", "", "Index scanner gRPC port, disabled if empty")
 	httpPort := fset.String("httpPort", "9102", "Index http mgmt port")
 	streamInitPort := fset.String("streamInitPort", "9103", "Index initial stream port")
 	streamCatchupPort := fset.String("streamCatchupPort", "9104", "Index catchup stream port")
@@ -83,6 +84,7 @@ func main() {
 	config.SetValue("indexer.enableManager", *enableManager)
 	config.SetValue("indexer.adminPort", *adminPort)
 	config.SetValue("indexer.scanPort", *scanPort)
+	config.SetValue("indexer.grpcScanPort", *grpcScanPort)
 	config.SetValue("indexer.httpPort", *httpPort)
 	config.SetValue("indexer.httpsPort", *httpsPort)
 	config.SetValue("indexer.certFile", *certFile)
@@ -53,6 +53,11 @@ type AggrFunc interface {
 	Value() interface{}
 	Distinct() bool
 	IsValid() bool
+
+	// Merge adds a partial aggregate of the same type, computed over a
+	// disjoint set of values, to this aggregate. Distinct aggregates
+	// cannot be merged.
+	Merge(other AggrFunc)
 }
 
 var (
@@ -207,6 +212,20 @@ func (a *AggrFuncSum) AddDeltaRaw(delta []byte) {
 	//not implemented
 }
 
+func (a *AggrFuncSum) Merge(other AggrFunc) {
+
+	o, ok := other.(*AggrFuncSum)
+	if !ok || !o.validVal {
+		return
+	}
+
+	if o.isInt64 {
+		a.AddDelta(o.ival)
+	} else {
+		a.AddDelta(o.fval)
+	}
+}
+
 func (a *AggrFuncSum) checkDistinctFloat(newVal float64) bool {
 
 	if a.fLastVal == newVal {
@@ -303,6 +322,13 @@ func (a *AggrFuncCount) AddDeltaRaw(delta []byte) {
 
 }
 
+func (a *AggrFuncCount) Merge(other AggrFunc) {
+
+	if o, ok := other.(*AggrFuncCount); ok {
+		a.val += o.val
+	}
+}
+
 func (a *AggrFuncCount) checkDistinct(newObj value.Value) bool {
 
 	if a.lastObj != nil && newObj.EquivalentTo(a.lastObj) {
@@ -407,6 +433,13 @@ func (a *AggrFuncCountN) AddDeltaRaw(delta []byte) {
 
 }
 
+func (a *AggrFuncCountN) Merge(other AggrFunc) {
+
+	if o, ok := other.(*AggrFuncCountN); ok {
+		a.val += o.val
+	}
+}
+
 func (a *AggrFuncCountN) checkDistinct(newObj value.Value) bool {
 
 	if a.lastObj != nil && newObj.EquivalentTo(a.lastObj) {
@@ -517,6 +550,20 @@ func (a *AggrFuncMin) AddDeltaRaw(delta []byte) {
 
 }
 
+func (a *AggrFuncMin) Merge(other AggrFunc) {
+
+	o, ok := other.(*AggrFuncMin)
+	if !ok || !o.validVal {
+		return
+	}
+
+	if o.n1qlValue {
+		a.AddDeltaObj(o.obj)
+	} else {
+		a.AddDeltaRaw(o.raw)
+	}
+}
+
 func (a AggrFuncMin) String() string {
 	if a.n1qlValue {
 		return fmt.Sprintf("Type %v Value %v", a.typ, a.obj)
@@ -600,6 +647,20 @@ func (a *AggrFuncMax) AddDeltaRaw(delta []byte) {
 
 }
 
+func (a *AggrFuncMax) Merge(other AggrFunc) {
+
+	o, ok := other.(*AggrFuncMax)
+	if !ok || !o.validVal {
+		return
+	}
+
+	if o.n1qlValue {
+		a.AddDeltaObj(o.obj)
+	} else {
+		a.AddDeltaRaw(o.raw)
+	}
+}
+
 func (a AggrFuncMax) String() string {
 	if a.n1qlValue {
 		return fmt.Sprintf("Type %v Value %v", a.typ, a.obj)
@@ -0,0 +1,64 @@
+package common
+
+import "testing"
+
+import "github.com/couchbase/query/value"
+
+func TestAggrFuncMerge(t *testing.T) {
+	partitions := [][]interface{}{
+		{int64(3), int64(7)},
+		{},
+		{int64(5), nil, 1.5},
+	}
+
+	tests := []struct {
+		typ      AggrFuncType
+		expected interface{}
+	}{
+		{AGG_SUM, 16.5},
+		{AGG_COUNT, int64(4)},
+		{AGG_COUNTN, int64(4)},
+		{AGG_MIN, value.NewValue(1.5)},
+		{AGG_MAX, value.NewValue(int64(7))},
+	}
+
+	for _, test := range tests {
+		var merged AggrFunc
+		for _, vals := range partitions {
+			partial := NewAggrFunc(test.typ, value.NULL_VALUE, false, true)
+			for _, v := range vals {
+				partial.AddDeltaObj(value.NewValue(v))
+			}
+			if merged == nil {
+				merged = partial
+			} else {
+				merged.Merge(partial)
+			}
+		}
+
+		actual := merged.Value()
+		if v, ok := test.expected.(value.Value); ok {
+			if !v.Equals(actual.(value.Value)).Truth() {
+				t.Fatalf("%v: expected %v, got %v", test.typ, v, actual)
+			}
+		} else if actual != test.expected {
+			t.Fatalf("%v: expected %v, got %v", test.typ, test.expected, actual)
+		}
+	}
+}
+
+func TestAggrFuncMergeEmpty(t *testing.T) {
+	for _, typ := range []AggrFuncType{AGG_SUM, AGG_MIN, AGG_MAX} {
+		a := NewAggrFunc(typ, value.NULL_VALUE, false, true)
+		a.Merge(NewAggrFunc(typ, value.NULL_VALUE, false, true))
+		if a.IsValid() {
+			t.Fatalf("%v: merge of empty aggregates should not be valid", typ)
+		}
+	}
+
+	sum := NewAggrFunc(AGG_SUM, value.NewValue(int64(2)), false, true)
+	sum.Merge(NewAggrFunc(AGG_SUM, value.NULL_VALUE, false, true))
+	if v := sum.Value(); v != int64(2) {
+		t.Fatalf("expected 2, got %v", v)
+	}
+}
@@ -538,6 +538,11 @@ func (c *ClusterInfoCache) GetScopeID(bucket, scope string) string {
 	return c.pool.GetScopeID(bucket, scope)
 }
 
+// See the comment for clusterInfoCache.GetCollectionID
+func (c *ClusterInfoCache) GetScopes(bucket string) []string {
+	return c.pool.GetScopes(bucket)
+}
+
 // See the comment for clusterInfoCache.GetCollectionID
 func (c *ClusterInfoCache) GetScopeAndCollectionID(bucket, scope, collection string) (string, string) {
 	return c.pool.GetScopeAndCollectionID(bucket, scope, collection)
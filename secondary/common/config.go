@@ -150,18 +150,53 @@ var SystemConfig = Config{
 	"projector.mutationChanSize": ConfigValue{
 		150,
 		"channel size of projector's vbucket workers, " +
-			"changing this value does not affect existing feeds.",
+			"changing this value will respawn workers of existing feeds.",
 		150,
 		false, // mutable
 		false, // case-insensitive
 	},
 	"projector.encodeBufSize": ConfigValue{
 		1024 * 1024,
-		"Collatejson encode buffer size",
+		"Collatejson encode buffer size, changing this value affects " +
+			"only newly spawned vbucket workers.",
 		1024 * 1024,
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.encodeBufMaxSize": ConfigValue{
+		16 * 1024 * 1024,
+		"maximum size, in bytes, a vbucket worker's encode buffer is " +
+			"allowed to retain after encoding a large document.",
+		16 * 1024 * 1024,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.encodeBufQuota": ConfigValue{
+		256 * 1024 * 1024,
+		"memory quota, in bytes, for encode buffers of all vbucket " +
+			"workers in the projector. Buffers grown beyond " +
+			"encodeBufSize are not retained once the quota is used up. " +
+			"0 disables the quota.",
+		256 * 1024 * 1024,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.encodeBufShrinkInterval": ConfigValue{
+		60 * 1000,
+		"interval, in milliseconds, at which encode buffers grown " +
+			"beyond encodeBufSize are shrunk back, 0 disables shrinking.",
+		60 * 1000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.encodeBufPoolSize": ConfigValue{
+		64,
+		"number of idle encode buffers pooled for re-use by new " +
+			"vbucket workers.",
+		64,
+		true,  // immutable
+		false, // case-insensitive
+	},
 	"projector.feedChanSize": ConfigValue{
 		100,
 		"channel size for feed's control path, " +
@@ -180,19 +215,117 @@ var SystemConfig = Config{
 	},
 	"projector.vbucketWorkers": ConfigValue{
 		64,
-		"number of workers handling the vbuckets",
+		"number of workers handling the vbuckets, changing this value " +
+			"will rebalance vbuckets of existing feeds across new workers.",
 		64,
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.throttle.topicBandwidth": ConfigValue{
+		"",
+		"per topic egress bandwidth limit, in bytes per second, specified " +
+			"as comma separated <topic-prefix>=<bytes> entries, for eg., " +
+			"INIT_STREAM_TOPIC=104857600. A topic is throttled by the " +
+			"entry with longest matching prefix, empty value disables " +
+			"throttling.",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"projector.throttle.keyspaceBandwidth": ConfigValue{
+		"",
+		"per keyspace egress bandwidth limit, in bytes per second, for each " +
+			"topic, specified as comma separated <keyspaceId>=<bytes> " +
+			"entries, where keyspaceId `*` applies to all keyspaces " +
+			"without an explicit entry, empty value disables throttling.",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"projector.memory.topicMutationQuota": ConfigValue{
+		"",
+		"per topic memory quota, in bytes, for mutations queued on vbucket " +
+			"workers, specified as comma separated <topic-prefix>=<bytes> " +
+			"entries, for eg., INIT_STREAM_TOPIC=268435456. A topic over its " +
+			"quota stops pulling mutations from KV until workers catch up, " +
+			"without affecting other topics. Empty value disables the quota.",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"projector.memory.topicEncodeBufQuota": ConfigValue{
+		"",
+		"per topic memory quota, in bytes, for encode buffers of vbucket " +
+			"workers, specified as comma separated <topic-prefix>=<bytes> " +
+			"entries. Buffers grown beyond encodeBufSize are not retained " +
+			"once the quota of their topic is used up. Empty value disables " +
+			"the quota.",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"projector.backpressure.maxPause": ConfigValue{
+		30 * 1000,
+		"timeout, in milliseconds, for which a vbucket worker will pause " +
+			"on a full endpoint queue, flow controlling the upstream DCP " +
+			"connection, before giving up on the endpoint. 0 disables " +
+			"pausing, the endpoint is given up as soon as its queue is full.",
+		30 * 1000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.updateSeqnoInterval": ConfigValue{
+		100,
+		"least interval, in milliseconds, between two UpdateSeqno " +
+			"messages of a vbucket, sent for the mutations of collections " +
+			"that are not indexed. Within the interval only the latest " +
+			"seqno is sent, 0 sends a message per mutation.",
+		100,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.syncTimeout": ConfigValue{
 		2000,
 		"timeout, in milliseconds, for sending periodic Sync messages, " +
-			"changing this value does not affect existing feeds.",
+			"also refer to projector.syncAdaptive.",
 		2000,
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.syncAdaptive": ConfigValue{
+		false,
+		"adapt the interval between sync messages, per keyspace, to its " +
+			"mutation rate, within projector.syncMinTimeout and " +
+			"projector.syncMaxTimeout. When disabled, sync messages are " +
+			"sent every projector.syncTimeout.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.syncMinTimeout": ConfigValue{
+		500,
+		"minimum interval, in milliseconds, between sync messages for " +
+			"busy keyspaces, when projector.syncAdaptive is true.",
+		500,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.syncMaxTimeout": ConfigValue{
+		10000,
+		"maximum interval, in milliseconds, between sync messages for " +
+			"idle keyspaces, when projector.syncAdaptive is true.",
+		10000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.syncBusyRate": ConfigValue{
+		10000,
+		"mutations per second, above which a keyspace is considered busy " +
+			"and its sync interval is tightened.",
+		10000,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.watchInterval": ConfigValue{
 		5 * 60 * 1000, // 5 minutes
 		"periodic tick, in milli-seconds to check for stale feeds, " +
@@ -263,6 +396,28 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.dcp.topicConnections": ConfigValue{
+		"",
+		"per topic number of concurrent DCP connections with each KV node, " +
+			"specified as comma separated <topic-prefix>=<connections> " +
+			"entries of 1 to 64 connections, for eg., MAINT_STREAM_TOPIC=8. " +
+			"A topic uses the entry with longest matching prefix, or " +
+			"projector.dcp.numConnections if none matches. Changing this value does not affect the " +
+			"connections of existing keyspaces.",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"projector.dcp.vbucketSharding": ConfigValue{
+		"least_loaded",
+		"how vbuckets are spread over the DCP connections with a KV node, " +
+			"least_loaded picks the connection with the fewest vbuckets, " +
+			"modulo picks connection vbno % connections. Changing this " +
+			"value does not affect the connections of existing keyspaces.",
+		"least_loaded",
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.dcp.latencyTick": ConfigValue{
 		1 * 60 * 1000, // 1 minute
 		"in milliseconds, periodically log cumulative stats of dcp latency",
@@ -277,6 +432,54 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.dcp.minBufferSize": ConfigValue{
+		10 * 1024 * 1024, // 10 MB
+		"min size in bytes of the flow control buffer of a DCP connection. " +
+			"The buffer starts at 20 MB within min and max size, and is " +
+			"halved when the mutations are not drained fast enough or " +
+			"under memory pressure, and doubled when KV waits for buffer " +
+			"acks. Same min and max size disable resizing. Changing this " +
+			"value does not affect existing feeds.",
+		10 * 1024 * 1024, // 10 MB
+		false,            // mutable
+		false,            // case-insensitive
+	},
+	"projector.dcp.maxBufferSize": ConfigValue{
+		20 * 1024 * 1024, // 20 MB
+		"max size in bytes of the flow control buffer of a DCP connection, " +
+			"changing this value does not affect existing feeds. Above " +
+			"20 MB, set projector.dcp.memoryThreshold to bound the memory " +
+			"of the buffers.",
+		20 * 1024 * 1024, // 20 MB
+		false,            // mutable
+		false,            // case-insensitive
+	},
+	"projector.dcp.bufferSizeTick": ConfigValue{
+		1000, // 1 second
+		"in milliseconds, periodically resize the flow control buffer " +
+			"of DCP connections, changing this value does not affect " +
+			"existing feeds.",
+		1000,  // 1 second
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.memoryThreshold": ConfigValue{
+		0,
+		"size in bytes of the projector heap above which the flow control " +
+			"buffer of DCP connections is shrunk, 0 disables it.",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.collectionFilter": ConfigValue{
+		false,
+		"for collection aware feeds, restrict keyspace wide DCP streams " +
+			"to collections that have indexes, using DCP collection " +
+			"filters. Changing this value does not affect active streams.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
 	// projector adminport parameters
 	"projector.adminport.name": ConfigValue{
 		"projector.adminport",
@@ -374,6 +577,36 @@ var SystemConfig = Config{
 		true,        // immutable
 		false,       // case-insensitive
 	},
+	"projector.dataport.compression": ConfigValue{
+		"none",
+		"comma separated list of compressions, in order of preference, " +
+			"to offer downstream for mutation payloads, valid compressions " +
+			"are none, snappy and lz4. Compression is negotiated per " +
+			"connection, refer to indexer.dataport.compression, " +
+			"does not affect existing feeds.",
+		"none",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dataport.tls.mutual": ConfigValue{
+		false,
+		"present node certificate to downstream when connection is " +
+			"encrypted, for mutual TLS, refer to indexer.dataport.tls.mutual. " +
+			"Enable this before enabling indexer.dataport.tls.mutual, " +
+			"does not affect existing feeds.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dataport.tls.cipherSuites": ConfigValue{
+		"",
+		"comma separated list of cipher suite names for encrypted " +
+			"connections to downstream, overrides the cluster TLS setting " +
+			"when not empty, does not affect existing feeds.",
+		"",
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.statsLogDumpInterval": ConfigValue{
 		60, // 1 minute
 		"in seconds, periodically log stats of all projector components",
@@ -460,6 +693,31 @@ var SystemConfig = Config{
 		true,        // immutable
 		false,       // case-insensitive
 	},
+	"indexer.dataport.compression": ConfigValue{
+		"snappy,lz4",
+		"comma separated list of compressions accepted for mutation " +
+			"payloads from router, refer to projector.dataport.compression.",
+		"snappy,lz4",
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"indexer.dataport.tls.mutual": ConfigValue{
+		false,
+		"require and verify certificate of router when connection is " +
+			"encrypted, for mutual TLS, refer to projector.dataport.tls.mutual.",
+		false,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"indexer.dataport.tls.cipherSuites": ConfigValue{
+		"",
+		"comma separated list of cipher suite names for encrypted " +
+			"connections from router, overrides the cluster TLS setting " +
+			"when not empty.",
+		"",
+		true,  // immutable
+		false, // case-insensitive
+	},
 	"indexer.dataport.tcpReadDeadline": ConfigValue{
 		300 * 1000,
 		"timeout, in milliseconds, while reading from socket, " +
@@ -556,6 +814,13 @@ var SystemConfig = Config{
 		true,  // immutable
 		false, // case-insensitive
 	},
+	"queryport.client.settings.logConnPoolStats": ConfigValue{
+		false,
+		"periodically log the connection pool metrics of each indexer",
+		false,
+		true,  // immutable
+		false, // case-insensitive
+	},
 	"queryport.client.settings.poolOverflow": ConfigValue{
 		30,
 		"maximum number of connections in a pool",
@@ -623,6 +888,15 @@ var SystemConfig = Config{
 		true,  // immutable
 		false, // case-insensitive
 	},
+	"queryport.client.load.serverLoadFactor": ConfigValue{
+		0.5,
+		"normalization factor on replica's scan load reported by indexer " +
+			"(pending scans and avg scan latency) to group them with least " +
+			"loaded replica. Set to 0 to ignore scan load reported by indexer.",
+		0.5,
+		true,  // immutable
+		false, // case-insensitive
+	},
 	"queryport.client.settings.backfillLimit": ConfigValue{
 		5 * 1024, // 5GB
 		"limit in mega-bytes to cap n1ql side backfilling, if ZERO backfill " +
@@ -675,6 +949,29 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"queryport.client.scan.hedge_threshold": ConfigValue{
+		0,
+		"When a scan served by a single indexer does not respond within this time, in milliseconds, " +
+			"send the scan to another replica as well and use the first response. Use 0 to disable.",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"queryport.client.scan.circuit_breaker_threshold": ConfigValue{
+		5,
+		"Number of consecutive scans failing with a network error or timeout after which an indexer node " +
+			"is considered unhealthy, and scans are sent to replicas on other nodes. Use 0 to disable.",
+		5,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"queryport.client.scan.circuit_breaker_cooldown": ConfigValue{
+		10000,
+		"Time, in milliseconds, an unhealthy indexer node is avoided before it is probed again.",
+		10000,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"queryport.client.allowCJsonScanFormat": ConfigValue{
 		true,
 		"Allow collatejson as data format between queryport client and indexer.",
@@ -749,6 +1046,13 @@ var SystemConfig = Config{
 		true,  // immutable
 		false, // case-insensitive
 	},
+	"indexer.grpcScanPort": ConfigValue{
+		"",
+		"port for index scan operations over gRPC, gRPC scans are disabled if empty",
+		"",
+		true,  // immutable
+		false, // case-insensitive
+	},
 	"indexer.httpPort": ConfigValue{
 		"9102",
 		"port for external stats amd settings",
@@ -777,6 +1081,14 @@ var SystemConfig = Config{
 		true, // immutable
 		true, // case-sensitive
 	},
+	"indexer.certWatchInterval": ConfigValue{
+		0,
+		"interval, in seconds, to check the ssl certificate and key files " +
+			"for changes and reload them. Use 0 to disable.",
+		0,
+		true,  // immutable
+		false, // case-insensitive
+	},
 	"indexer.isEnterprise": ConfigValue{
 		true,
 		"enterprise edition",
@@ -870,9 +1182,11 @@ var SystemConfig = Config{
 	},
 	"indexer.numSliceWriters": ConfigValue{
 		runtime.GOMAXPROCS(0),
-		"Number of Writer Threads for a Slice",
+		"Number of Writer Threads for a Slice.  A change takes effect " +
+			"at the next flush of plasma slices, and on restart for " +
+			"other storage modes.",
 		runtime.GOMAXPROCS(0),
-		true,  // immutable
+		false, // mutable
 		false, // case-insensitive
 	},
 
@@ -1046,6 +1360,13 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.hash.numShards": ConfigValue{
+		64,
+		"Number of shards of the hash table of a hash index slice",
+		64,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.useMutationSyncPool": ConfigValue{
 		false,
 		"Use sync pool for mutations",
@@ -1282,6 +1603,29 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.bloom_filter.fp_rate": ConfigValue{
+		0.01,
+		"Target false positive rate of the bloom filters of the indexes created with bloom_filter",
+		0.01,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.bloom_filter.memory_frac": ConfigValue{
+		0.05,
+		"Maximum fraction of memory_quota used by the bloom filters of the indexes.  The memory " +
+			"of the bloom filters is taken from the memory quota of plasma.  A bloom filter which " +
+			"does not fit is disabled",
+		0.05,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.bloom_filter.initial_capacity": ConfigValue{
+		uint64(64 * 1024),
+		"Number of keys of the first bloom filter of a slice.  The filter grows when it is full",
+		uint64(64 * 1024),
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.plasma.backIndex.maxNumPageDeltas": ConfigValue{
 		30,
 		"Maximum number of page deltas",
@@ -1705,6 +2049,14 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.evict_priority_mem_mark": ConfigValue{
+		0.9,
+		"Fraction of memory_quota above which memory of indexes " +
+			"with evict priority is limited",
+		0.9,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.high_mem_mark": ConfigValue{
 		0.95,
 		"Fraction of memory_quota above which Indexer moves " +
@@ -1785,6 +2137,202 @@ var SystemConfig = Config{
 		false,
 		false,
 	},
+	"indexer.settings.memory_controller.enable": ConfigValue{
+		false,
+		"Adjust the memory of the mutation queue, the plasma block cache and the " +
+			"scan buffers within memory_quota, based on the memory pressure of each.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.memory_controller.interval": ConfigValue{
+		60,
+		"Interval in seconds between two adjustments of the memory controller",
+		60,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.memory_controller.step": ConfigValue{
+		0.02,
+		"Fraction of memory_quota moved between two components in one adjustment",
+		0.02,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.memory_controller.high_pressure": ConfigValue{
+		0.9,
+		"Pressure above which a component is given more memory",
+		0.9,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.memory_controller.low_pressure": ConfigValue{
+		0.5,
+		"Pressure below which memory can be taken from a component",
+		0.5,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.memory_controller.max_scale": ConfigValue{
+		2.0,
+		"A component is given between 1/max_scale and max_scale times its default memory",
+		2.0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.memory_controller.scan_buffer_frac": ConfigValue{
+		0.05,
+		"Fraction of memory_quota of the scan buffers, when scan.queue_size is not scaled",
+		0.05,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.cold_tier.enable": ConfigValue{
+		false,
+		"Offload the disk snapshots of rarely scanned index partitions to object storage.  " +
+			"Only supported by memory optimized indexes",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.cold_tier.idle_period": ConfigValue{
+		uint64(7 * 24 * 3600),
+		"Seconds without scans after which an index partition is offloaded to the cold tier",
+		uint64(7 * 24 * 3600),
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.cold_tier.min_disk_size": ConfigValue{
+		uint64(256 * 1024 * 1024),
+		"Minimum disk size in bytes of an index partition to be offloaded to the cold tier",
+		uint64(256 * 1024 * 1024),
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.cold_tier.interval": ConfigValue{
+		uint64(600),
+		"Seconds between checks for index partitions to offload to or remove from the cold tier",
+		uint64(600),
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.cold_tier.refresh_period": ConfigValue{
+		uint64(24 * 3600),
+		"Seconds after which the snapshot of an offloaded index partition is written locally and " +
+			"offloaded again.  It must be shorter than the metadata purge interval of the buckets, " +
+			"so that the index is recovered from the cold tier without rollback to 0",
+		uint64(24 * 3600),
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.cold_tier.hydrate_timeout": ConfigValue{
+		uint64(300),
+		"Maximum seconds after the start of the indexer that warmup waits for the download of the " +
+			"offloaded index partitions.  Partitions which are not downloaded in time are rebuilt",
+		uint64(300),
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.cold_tier.endpoint": ConfigValue{
+		"",
+		"URL of the S3-compatible object storage of the cold tier",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"indexer.settings.cold_tier.bucket": ConfigValue{
+		"",
+		"Object storage bucket of the cold tier",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"indexer.settings.cold_tier.region": ConfigValue{
+		"us-east-1",
+		"Region of the object storage of the cold tier",
+		"us-east-1",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"indexer.settings.cold_tier.prefix": ConfigValue{
+		"indexing",
+		"Prefix of the object keys of the cold tier",
+		"indexing",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"indexer.cold_tier.access_key_id": ConfigValue{
+		"",
+		"Access key of the object storage of the cold tier.  AWS_ACCESS_KEY_ID is used if empty",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"indexer.cold_tier.secret_access_key": ConfigValue{
+		"",
+		"Secret key of the object storage of the cold tier.  AWS_SECRET_ACCESS_KEY is used if empty",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"indexer.cold_tier.request_timeout": ConfigValue{
+		uint64(300),
+		"Timeout in seconds of a request to the object storage of the cold tier",
+		uint64(300),
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.cold_tier.part_size": ConfigValue{
+		uint64(64 * 1024 * 1024),
+		"Size in bytes of the parts of the multipart upload of large files to the cold tier",
+		uint64(64 * 1024 * 1024),
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.maintenance.enable": ConfigValue{
+		false,
+		"Run compaction, scrubbing and snapshot cleanup through the maintenance scheduler, " +
+			"which defers them while the scan latency or the mutation queue is high",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.maintenance.max_concurrent": ConfigValue{
+		1,
+		"Maximum number of maintenance jobs running at the same time",
+		1,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.maintenance.interval": ConfigValue{
+		1,
+		"Interval in seconds between two measurements of the load by the maintenance scheduler",
+		1,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.maintenance.max_scan_latency": ConfigValue{
+		uint64(20),
+		"Average scan latency in milliseconds above which maintenance jobs are deferred",
+		uint64(20),
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.maintenance.max_queue_pressure": ConfigValue{
+		0.5,
+		"Memory used by the mutation queue, as a fraction of its max memory, " +
+			"above which maintenance jobs are deferred",
+		0.5,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.maintenance.max_defer": ConfigValue{
+		uint64(1800),
+		"Seconds after which a deferred maintenance job is run regardless of the load",
+		uint64(1800),
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.gc_percent": ConfigValue{
 		100,
 		"(GOGC) Ratio of current heap size over heap size from last GC." +
@@ -1840,6 +2388,39 @@ var SystemConfig = Config{
 		true,  // mutable
 		false, // case-insensitive
 	},
+	"indexer.timekeeper.repairBackoff.initial": ConfigValue{
+		1000,
+		"Wait time before the first attempt of a stream repair, to batch the " +
+			"vbuckets to repair (in millisecond). Each retry of the repair " +
+			"doubles the wait time.",
+		1000,
+		true,  // mutable
+		false, // case-insensitive
+	},
+	"indexer.timekeeper.repairBackoff.max": ConfigValue{
+		60000,
+		"Max wait time between the attempts of a stream repair (in millisecond).",
+		60000,
+		true,  // mutable
+		false, // case-insensitive
+	},
+	"indexer.timekeeper.repairBackoff.jitter": ConfigValue{
+		0.2,
+		"Fraction of the wait time between the attempts of a stream repair " +
+			"that is randomized, so that the repairs of many keyspaces do not " +
+			"retry at the same time.",
+		0.2,
+		true,  // mutable
+		false, // case-insensitive
+	},
+	"indexer.timekeeper.repairAlertThreshold": ConfigValue{
+		600,
+		"Time after which a stream still under repair raises an alert " +
+			"(in second). 0 disables the alert.",
+		600,
+		true,  // mutable
+		false, // case-insensitive
+	},
 	"indexer.http.readTimeout": ConfigValue{
 		30,
 		"timeout in seconds, is indexer http server's read timeout",
@@ -1934,6 +2515,35 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.compaction.schedule": ConfigValue{
+		"",
+		"Compaction allowed interval per keyspace or index, as a semicolon separated list of " +
+			"<bucket>[:<scope>:<collection>[:<index>]]=HH:MM,HH:MM",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
+	"indexer.settings.compaction.max_parallel": ConfigValue{
+		0,
+		"Maximum number of index partitions compacted concurrently (0 for no limit)",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.compaction.on_demand.max_concurrent": ConfigValue{
+		1,
+		"Maximum number of index partitions compacted concurrently by defragment requests",
+		1,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.compaction.throughput_cap": ConfigValue{
+		0,
+		"Disk throughput cap for compaction in MB per second (0 for no limit)",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.persisted_snapshot.interval": ConfigValue{
 		uint64(5000), // keep in sync with index_settings_manager.erl
 		"Persisted snapshotting interval in milliseconds",
@@ -1976,6 +2586,29 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.snapshot_retention.count": ConfigValue{
+		0,
+		"Number of disk snapshots retained per index partition for rollback.  " +
+			"0 retains max_rollbacks of the storage mode",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.snapshot_retention.max_age": ConfigValue{
+		uint64(0),
+		"Seconds after which a disk snapshot other than the latest is removed, " +
+			"even if it is needed for rollback.  0 disables time-based retention",
+		uint64(0),
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.snapshot_retention.interval": ConfigValue{
+		uint64(300),
+		"Seconds between two checks of the retention of the disk snapshots by the storage manager",
+		uint64(300),
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.memory_quota": ConfigValue{
 		uint64(256 * 1024 * 1024),
 		"Maximum memory used by the indexer buffercache",
@@ -2242,6 +2875,29 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.io_mode.plasma": ConfigValue{
+		"",
+		"I/O mode of plasma index files: buffered, direct or mmap. " +
+			"Empty to use indexer.plasma.useMmapReads and indexer.plasma.useDirectIO",
+		"",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.io_mode.forestdb": ConfigValue{
+		"",
+		"I/O mode of forestdb index files: buffered or direct. Empty for buffered",
+		"",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.io_mode.node_overrides": ConfigValue{
+		"",
+		"I/O modes of specific nodes, overriding indexer.settings.io_mode.<storage mode>, " +
+			"e.g. {\"<nodeuuid>\": {\"plasma\": \"direct\"}}",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
 	"indexer.settings.scan_getseqnos_retries": ConfigValue{
 		30,
 		"Max retries for DCP request",
@@ -2249,6 +2905,27 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.scan_admission.max_concurrent_scans": ConfigValue{
+		0,
+		"Max number of concurrent scans per bucket, 0 means unlimited",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scan_admission.max_rows_per_sec": ConfigValue{
+		0,
+		"Max number of rows returned per second by the scans of a bucket, 0 means unlimited",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scan_admission.queue_timeout": ConfigValue{
+		5000,
+		"Time (ms) a scan over the concurrent scan limit of its bucket waits before it is rejected",
+		5000,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.num_replica": ConfigValue{
 		0,
 		"Number of additional replica for each index.",
@@ -2256,6 +2933,24 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.stream_priority.maint_weight": ConfigValue{
+		3,
+		"Share of MAINT_STREAM in the mutations processed by projector and indexer " +
+			"while MAINT_STREAM is backlogged, relative to init_weight. 0 disables " +
+			"stream priority",
+		3,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.stream_priority.init_weight": ConfigValue{
+		1,
+		"Share of INIT_STREAM in the mutations processed by projector and indexer " +
+			"while MAINT_STREAM is backlogged, relative to maint_weight. 0 disables " +
+			"stream priority",
+		1,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.settings.log_level": ConfigValue{
 		"info",
 		"Projector logging level",
@@ -2263,6 +2958,24 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.settings.dcp.noop_interval": ConfigValue{
+		20,
+		"Interval at which KV sends noops on the DCP connections of the projector " +
+			"(in second). Changing this value affects the connections opened " +
+			"afterwards only.",
+		20,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.settings.dcp.idle_timeout": ConfigValue{
+		1800,
+		"Time after which a DCP connection of the projector which receives no " +
+			"message, not even a noop, is treated as dead and closed (in second). " +
+			"It must be more than twice noop_interval. 0 disables it.",
+		1800,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.diagnostics_dir": ConfigValue{
 		"./",
 		"Projector diagnostics information directory",
@@ -2343,6 +3056,13 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.storageMigration.checkInterval": ConfigValue{
+		30,
+		"interval(in seconds) at which indexes marked for storage migration are checked",
+		30,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.rebalance.drop_index.wait_time": ConfigValue{
 		1,
 		"wait time for rebalancer to start drop index after all indexes are built (sec)",
@@ -2357,6 +3077,136 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.rebalance.copy_snapshot": ConfigValue{
+		false,
+		"move memory optimized indexes by copying their latest disk snapshot from " +
+			"the source node, and catching up from it, instead of rebuilding them",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.rebalance.transfer_rate_limit": ConfigValue{
+		0,
+		"Maximum rate, in MB/s, at which a node receives the data of the indexes it builds " +
+			"during rebalance. Use 0 to disable.",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.replica_repair.enable": ConfigValue{
+		false,
+		"Rebuild the replicas lost by the indexes, e.g. after an indexer node is failed over.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.replica_repair.require_confirmation": ConfigValue{
+		false,
+		"Only report the lost replicas, and wait for the repair to be confirmed " +
+			"with /repairLostReplicas.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.replica_repair.interval": ConfigValue{
+		300,
+		"Interval, in seconds, to check for lost replicas.",
+		300,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.replica_repair.window": ConfigValue{
+		"",
+		"Comma separated list of daily maintenance windows, e.g. \"01:00-05:00,22:30-23:30\", " +
+			"in the local time of the indexer node.  The lost replicas are only rebuilt " +
+			"inside the windows.  Empty to rebuild them at any time.",
+		"",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.enable_token_auth": ConfigValue{
+		false,
+		"Accept bearer tokens issued by ns_server, in addition to basic " +
+			"auth, for authentication of REST requests.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.rbac_cache_ttl": ConfigValue{
+		10,
+		"Time in seconds to cache the RBAC decisions of index metadata " +
+			"and status requests.  A change of user roles takes effect " +
+			"after the cached decisions expire.  0 disables the cache.",
+		10,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.network_allowlist": ConfigValue{
+		"",
+		"Comma separated list of CIDRs of the networks allowed to call " +
+			"/dropIndex, /restoreIndexMetadata, /settings and the other " +
+			"admin endpoints that change index, build or rebalance state.  " +
+			"Requests from loopback are always allowed.  It should include " +
+			"the networks of the index nodes, which call these endpoints of " +
+			"each other.  Empty list allows all networks.",
+		"",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.idle_index.enable": ConfigValue{
+		false,
+		"Flag the indexes which have not been scanned for settings.idle_index.days. " +
+			"The idle indexes are listed by /idleIndexes.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.idle_index.days": ConfigValue{
+		30,
+		"Number of days without scan after which an index is idle. Use 0 to never " +
+			"flag an index as idle.",
+		30,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.idle_index.bucket_days": ConfigValue{
+		"",
+		"Comma separated list of bucket:days, e.g. \"travel-sample:7,beer-sample:0\", " +
+			"to override settings.idle_index.days for the indexes of a bucket.",
+		"",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.idle_index.auto_drop": ConfigValue{
+		false,
+		"Drop the idle indexes.  The definition of a dropped index is kept as a stopped " +
+			"schedule create token, and the index can be created again with /recreateIdleIndex.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.idle_index.interval": ConfigValue{
+		3600,
+		"Interval, in seconds, to check for idle indexes.",
+		3600,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.snapshot_transfer.timeout": ConfigValue{
+		3600,
+		"Timeout, in seconds, to copy the snapshot of an index partition from a peer indexer.",
+		3600,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.rebalance.max_concurrent_movers": ConfigValue{
+		0,
+		"Maximum number of indexes moved concurrently to a node during rebalance. " +
+			"Use 0 to move indexes in batches of rebalance.transferBatchSize.",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.rebalance.redistribute_indexes": ConfigValue{
 		true, // keep in sync with index_settings_manager.erl
 		"redistribute indexes for optimal placement during rebalance." +
@@ -2382,6 +3232,28 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.build.max_concurrent": ConfigValue{
+		0,
+		"Maximum number of collections with initial index build in progress on this node.  " +
+			"Build requests over the limit are queued.  Use 0 for no limit.",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scrubber.enable": ConfigValue{
+		false,
+		"Periodically walk index snapshots and verify entry encoding and key ordering",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scrubber.interval": ConfigValue{
+		86400,
+		"Interval in seconds between two runs of the index scrubber",
+		86400,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.enable_corrupt_index_backup": ConfigValue{
 		false,
 		"When corrupted index is found, backup the corrupted index data files.",
@@ -2396,6 +3268,15 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.config_profile": ConfigValue{
+		"default",
+		"Configuration profile of the indexer and projector.  Selecting a profile " +
+			"changes the settings of the profile.  Settings in the same request " +
+			"take precedence over the profile.  See /settings/profiles.",
+		"default",
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.build.background.disable": ConfigValue{
 		false,
 		"Disable background index build, except during upgrade",
@@ -2405,11 +3286,21 @@ var SystemConfig = Config{
 	},
 	"indexer.build.enableOSO": ConfigValue{
 		false,
-		"Use OSO mode for Initial Index Build",
+		"Use OSO mode for Initial Index Build. It can be overridden for " +
+			"an index with build_oso in the WITH clause",
 		false,
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.build.oso.minItems": ConfigValue{
+		uint64(100000),
+		"Minimum number of items of a collection for OSO mode to be used for its " +
+			"Initial Index Build, unless an index sets build_oso. 0 to use OSO mode " +
+			"for any collection",
+		uint64(100000),
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.scan.queue_size": ConfigValue{
 		20,
 		"When performing scan scattering in indexer, specify the queue size for the scatterer.",
@@ -2438,6 +3329,20 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.scan.enable_partition_aggr": ConfigValue{
+		false,
+		"compute aggregates of a partitioned index scan in each partition and merge the partial results",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.scan.vector_max_limit": ConfigValue{
+		10000,
+		"maximum number of nearest neighbors returned by a vector index scan",
+		10000,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.planner.timeout": ConfigValue{
 		300,
 		"timeout (sec) on planner",
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const configProfileSetting = "indexer.settings.config_profile"
+
+// ConfigProfiles are curated sets of indexer and projector settings.
+// Selecting a profile changes only the settings of the profile.  Settings
+// changed by a previously selected profile keep their values.  Projector
+// channel sizes are not in any profile, as they take effect only for new
+// feeds, or respawn the workers of existing feeds.
+var ConfigProfiles = map[string]map[string]interface{}{
+	"default": {},
+
+	// Smaller buffers and more frequent GC, for nodes with little memory.
+	"low-memory": {
+		"indexer.settings.gc_percent":           50,
+		"indexer.settings.sliceBufSize":         400,
+		"indexer.settings.build.batch_size":     1,
+		"indexer.settings.build.max_concurrent": 1,
+
+		"projector.gogc": 50,
+	},
+
+	// Bounded resource usage per node, for nodes shared by many tenants.
+	"serverless": {
+		"indexer.settings.gc_percent":                          75,
+		"indexer.settings.build.max_concurrent":                2,
+		"indexer.settings.scan_admission.max_concurrent_scans": 64,
+		"indexer.settings.rebalance.max_concurrent_movers":     2,
+		"indexer.settings.idle_index.enable":                   true,
+
+		"projector.gogc": 75,
+	},
+
+	// Larger batches and less frequent snapshots, at the cost of memory
+	// and recovery time.
+	"throughput-optimized": {
+		"indexer.settings.gc_percent":                      200,
+		"indexer.settings.build.batch_size":                -1,
+		"indexer.settings.persisted_snapshot.moi.interval": 1200000,
+		"indexer.settings.inmemory_snapshot.moi.interval":  20,
+
+		"projector.gogc": 200,
+	},
+}
+
+func ConfigProfileNames() []string {
+	names := make([]string, 0, len(ConfigProfiles))
+	for name := range ConfigProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func ValidateConfigProfile(name string) error {
+	if _, ok := ConfigProfiles[name]; !ok {
+		return NewSettingError(configProfileSetting, name, "unknown configuration profile",
+			strings.Join(ConfigProfileNames(), ", "))
+	}
+	return nil
+}
+
+// ApplyConfigProfile updates config with the settings of profile name,
+// and records the profile in config.
+func ApplyConfigProfile(config Config, name string) error {
+
+	name = strings.ToLower(name)
+	profile, ok := ConfigProfiles[name]
+	if !ok {
+		return ValidateConfigProfile(name)
+	}
+
+	for key, value := range profile {
+		cv, ok := SystemConfig[key]
+		if !ok {
+			return fmt.Errorf("Invalid setting %v in configuration profile %v", key, name)
+		}
+		if _, ok := config[key]; !ok {
+			config[key] = cv
+		}
+		if err := config.SetValue(key, value); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := config[configProfileSetting]; !ok {
+		config[configProfileSetting] = SystemConfig[configProfileSetting]
+	}
+	return config.SetValue(configProfileSetting, name)
+}
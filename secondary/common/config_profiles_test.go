@@ -0,0 +1,83 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigProfilesValid(t *testing.T) {
+
+	for name, profile := range ConfigProfiles {
+		if name != strings.ToLower(name) {
+			t.Fatalf("profile %v is not in lower case", name)
+		}
+
+		for key, value := range profile {
+			cv, ok := SystemConfig[key]
+			if !ok {
+				t.Fatalf("profile %v: unknown setting %v", name, key)
+			}
+			if cv.Immutable {
+				t.Fatalf("profile %v: immutable setting %v", name, key)
+			}
+
+			config := Config{key: cv}
+			if err := config.SetValue(key, value); err != nil {
+				t.Fatalf("profile %v: setting %v: %v", name, key, err)
+			}
+		}
+	}
+}
+
+func TestApplyConfigProfile(t *testing.T) {
+
+	config := SystemConfig.FilterConfig(".settings.")
+
+	if err := ApplyConfigProfile(config, "Low-Memory"); err != nil {
+		t.Fatal(err)
+	}
+	if profile := config[configProfileSetting].String(); profile != "low-memory" {
+		t.Fatalf("expected profile low-memory, got %v", profile)
+	}
+	if n := config["indexer.settings.build.batch_size"].Int(); n != 1 {
+		t.Fatalf("expected batch size 1, got %v", n)
+	}
+	if n := config["projector.gogc"].Int(); n != 50 {
+		t.Fatalf("expected projector gogc 50, got %v", n)
+	}
+
+	// a setting changed by the user is kept, unless it is in the profile
+	config.SetValue("indexer.settings.scan_timeout", 1000)
+
+	if err := ApplyConfigProfile(config, "serverless"); err != nil {
+		t.Fatal(err)
+	}
+	if n := config["indexer.settings.build.max_concurrent"].Int(); n != 2 {
+		t.Fatalf("expected max concurrent builds 2, got %v", n)
+	}
+	if n := config["indexer.settings.scan_timeout"].Int(); n != 1000 {
+		t.Fatalf("expected scan timeout 1000, got %v", n)
+	}
+
+	// settings which are not in the selected profile are not changed
+	if n := config["indexer.settings.build.batch_size"].Int(); n != 1 {
+		t.Fatalf("expected batch size 1, got %v", n)
+	}
+
+	before := config.Clone()
+	if err := ApplyConfigProfile(config, "default"); err != nil {
+		t.Fatal(err)
+	}
+	for key, cv := range before {
+		if key != configProfileSetting && config[key].Value != cv.Value {
+			t.Fatalf("default profile changed %v from %v to %v", key, cv.Value, config[key].Value)
+		}
+	}
+
+	if err := ApplyConfigProfile(config, "no-such-profile"); err == nil {
+		t.Fatal("expected error for unknown profile")
+	}
+	if profile := config[configProfileSetting].String(); profile != "default" {
+		t.Fatalf("expected profile default, got %v", profile)
+	}
+}
@@ -0,0 +1,139 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+//
+// ConfigCallback is called with the old and new value of a watched key.
+// The old value is zero if the key is new.
+//
+type ConfigCallback func(key string, oldValue, newValue ConfigValue)
+
+type configWatch struct {
+	keys     []string
+	callback ConfigCallback
+}
+
+//
+// ConfigWatcher calls the callbacks of the keys which change when a new
+// config is applied.  A key ending with "." watches all the keys with the
+// prefix.  Callbacks are called in the goroutine applying the config, and
+// must not block on it.  A component usually posts the new value to its
+// own command channel.
+//
+type ConfigWatcher struct {
+	mutex   sync.Mutex
+	config  Config
+	nextId  uint64
+	watches map[uint64]*configWatch
+}
+
+func NewConfigWatcher(config Config) *ConfigWatcher {
+
+	if config == nil {
+		config = make(Config)
+	}
+
+	return &ConfigWatcher{
+		config:  config.Clone(),
+		watches: make(map[uint64]*configWatch),
+	}
+}
+
+//
+// Watch registers callback for keys.  It returns a function to cancel the
+// watch.
+//
+func (w *ConfigWatcher) Watch(keys []string, callback ConfigCallback) func() {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	id := w.nextId
+	w.nextId++
+	w.watches[id] = &configWatch{keys: keys, callback: callback}
+
+	return func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+
+		delete(w.watches, id)
+	}
+}
+
+//
+// Update applies config, which can be a full-set or subset of the config,
+// and calls the callbacks of the changed keys.
+//
+func (w *ConfigWatcher) Update(config Config) {
+
+	type change struct {
+		key      string
+		old, new ConfigValue
+	}
+
+	w.mutex.Lock()
+	changes := make([]change, 0)
+	for key, cv := range config {
+		old, ok := w.config[key]
+		if ok && reflect.DeepEqual(old.Value, cv.Value) {
+			continue
+		}
+		changes = append(changes, change{key: key, old: old, new: cv})
+		w.config[key] = cv
+	}
+
+	watches := make([]*configWatch, 0, len(w.watches))
+	for _, watch := range w.watches {
+		watches = append(watches, watch)
+	}
+	w.mutex.Unlock()
+
+	for _, ch := range changes {
+		for _, watch := range watches {
+			if watch.matches(ch.key) {
+				watch.callback(ch.key, ch.old, ch.new)
+			}
+		}
+	}
+}
+
+func (w *ConfigWatcher) Config() Config {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.config.Clone()
+}
+
+func (watch *configWatch) matches(key string) bool {
+
+	for _, k := range watch.keys {
+		if k == key || (strings.HasSuffix(k, ".") && strings.HasPrefix(key, k)) {
+			return true
+		}
+	}
+	return false
+}
+
+// watcher of the system config of the process, with the full key names
+var gConfigWatcher = NewConfigWatcher(SystemConfig)
+
+//
+// WatchConfig registers callback for keys of the system config, such as
+// "projector.backpressure.maxPause".
+//
+func WatchConfig(keys []string, callback ConfigCallback) func() {
+	return gConfigWatcher.Watch(keys, callback)
+}
+
+//
+// NotifyConfigChange is called by the settings manager of the process when
+// the system config changes.
+//
+func NotifyConfigChange(config Config) {
+	gConfigWatcher.Update(config)
+}
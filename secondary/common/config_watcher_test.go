@@ -0,0 +1,125 @@
+package common
+
+import (
+	"sort"
+	"testing"
+)
+
+func newWatcherConfig() Config {
+	return Config{
+		"projector.backpressure.maxPause": ConfigValue{Value: 100, DefaultVal: 100},
+		"projector.backpressure.minPause": ConfigValue{Value: 10, DefaultVal: 10},
+		"projector.vbucketWorkers":        ConfigValue{Value: 64, DefaultVal: 64},
+	}
+}
+
+func TestConfigWatcherUpdate(t *testing.T) {
+
+	w := NewConfigWatcher(newWatcherConfig())
+
+	changed := make(map[string][2]interface{})
+	w.Watch([]string{"projector.vbucketWorkers"}, func(key string, oldValue, newValue ConfigValue) {
+		changed[key] = [2]interface{}{oldValue.Value, newValue.Value}
+	})
+
+	// unchanged values are not notified
+	w.Update(newWatcherConfig())
+	if len(changed) != 0 {
+		t.Fatalf("unexpected changes %v", changed)
+	}
+
+	// a subset of the config is applied
+	w.Update(Config{
+		"projector.vbucketWorkers":        ConfigValue{Value: 32},
+		"projector.backpressure.maxPause": ConfigValue{Value: 200},
+	})
+	if len(changed) != 1 {
+		t.Fatalf("expected 1 change, got %v", changed)
+	}
+	if ch := changed["projector.vbucketWorkers"]; ch[0] != 64 || ch[1] != 32 {
+		t.Fatalf("unexpected change %v", ch)
+	}
+
+	config := w.Config()
+	if config["projector.vbucketWorkers"].Value != 32 || config["projector.backpressure.maxPause"].Value != 200 {
+		t.Fatalf("unexpected config %v", config)
+	}
+	if config["projector.backpressure.minPause"].Value != 10 {
+		t.Fatalf("expected unchanged minPause, got %v", config["projector.backpressure.minPause"].Value)
+	}
+
+	// a new key has a zero old value
+	w.Watch([]string{"projector.newKey"}, func(key string, oldValue, newValue ConfigValue) {
+		changed[key] = [2]interface{}{oldValue.Value, newValue.Value}
+	})
+	w.Update(Config{"projector.newKey": ConfigValue{Value: true}})
+	if ch := changed["projector.newKey"]; ch[0] != nil || ch[1] != true {
+		t.Fatalf("unexpected change %v", ch)
+	}
+}
+
+func TestConfigWatcherPrefix(t *testing.T) {
+
+	w := NewConfigWatcher(newWatcherConfig())
+
+	keys := make([]string, 0)
+	w.Watch([]string{"projector.backpressure."}, func(key string, oldValue, newValue ConfigValue) {
+		keys = append(keys, key)
+	})
+
+	w.Update(Config{
+		"projector.backpressure.maxPause": ConfigValue{Value: 200},
+		"projector.backpressure.minPause": ConfigValue{Value: 20},
+		"projector.vbucketWorkers":        ConfigValue{Value: 32},
+	})
+
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "projector.backpressure.maxPause" || keys[1] != "projector.backpressure.minPause" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func TestConfigWatcherCancel(t *testing.T) {
+
+	w := NewConfigWatcher(nil)
+
+	calls := 0
+	cancel := w.Watch([]string{"projector.vbucketWorkers"}, func(key string, oldValue, newValue ConfigValue) {
+		calls++
+	})
+
+	w.Update(Config{"projector.vbucketWorkers": ConfigValue{Value: 32}})
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %v", calls)
+	}
+
+	cancel()
+	w.Update(Config{"projector.vbucketWorkers": ConfigValue{Value: 16}})
+	if calls != 1 {
+		t.Fatalf("expected no call after cancel, got %v", calls)
+	}
+
+	// the config is updated without watches
+	if v := w.Config()["projector.vbucketWorkers"].Value; v != 16 {
+		t.Fatalf("expected 16, got %v", v)
+	}
+}
+
+func TestConfigWatcherCallbackUpdate(t *testing.T) {
+
+	w := NewConfigWatcher(nil)
+
+	// callbacks are called without the lock of the watcher held
+	done := false
+	w.Watch([]string{"a"}, func(key string, oldValue, newValue ConfigValue) {
+		w.Watch([]string{"b"}, func(key string, oldValue, newValue ConfigValue) {
+			done = true
+		})
+		w.Update(Config{"b": ConfigValue{Value: 1}})
+	})
+
+	w.Update(Config{"a": ConfigValue{Value: 1}})
+	if !done {
+		t.Fatal("expected callback of b")
+	}
+}
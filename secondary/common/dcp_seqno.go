@@ -10,6 +10,8 @@ import (
 	"math"
 	"math/rand"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -1307,6 +1309,48 @@ func BucketFailoverLog(cluster, pooln, bucketn string, numVb int) (fl FailoverLo
 	return
 }
 
+//
+// CollectionItemCount returns the number of items of collection cid, the
+// sum of the collection items of the KV nodes.
+//
+func CollectionItemCount(cluster, pooln, bucketn, cid string) (count uint64, ret error) {
+
+	//panic safe
+	defer func() {
+		if r := recover(); r != nil {
+			ret = fmt.Errorf("%v", r)
+			logging.Warnf("CollectionItemCount failed : %v", ret)
+		}
+	}()
+
+	bucket, err := ConnectBucket(cluster, pooln, bucketn)
+	if err != nil {
+		return 0, err
+	}
+	defer bucket.Close()
+
+	// The stats of the collection are keyed 0x<scope id>:0x<collection id>:<stat>
+	stats, err := bucket.GetStats("collections-byid 0x" + cid)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, nodeStats := range stats {
+		for key, value := range nodeStats {
+			if !strings.HasSuffix(key, ":items") {
+				continue
+			}
+			items, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("Invalid collection stat %v = %v", key, value)
+			}
+			count += items
+		}
+	}
+
+	return count, nil
+}
+
 func listOfVbnos(maxVbno int) []uint16 {
 	// list of vbuckets
 	vbnos := make([]uint16, 0, maxVbno)
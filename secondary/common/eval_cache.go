@@ -0,0 +1,65 @@
+package common
+
+import qvalue "github.com/couchbase/query/value"
+
+// EvalCache memoizes results of index expressions evaluated on a single
+// document, so that expressions shared by indexes on the same collection
+// are evaluated only once per DcpEvent. Results are keyed by expression
+// text and are valid only for the document value the cache was created
+// for. Not thread safe, nil EvalCache disables caching.
+type EvalCache struct {
+	docval  qvalue.AnnotatedValue
+	results map[string]evalResult
+	hits    uint64
+	misses  uint64
+}
+
+type evalResult struct {
+	scalar qvalue.Value
+	vector qvalue.Values
+	err    error
+}
+
+// NewEvalCache creates a cache for expressions evaluated on `docval`.
+func NewEvalCache(docval qvalue.AnnotatedValue) *EvalCache {
+	return &EvalCache{docval: docval}
+}
+
+// Get result of expression `key` evaluated on `docval`.
+func (ec *EvalCache) Get(
+	docval qvalue.AnnotatedValue,
+	key string) (scalar qvalue.Value, vector qvalue.Values, err error, ok bool) {
+
+	if ec == nil || docval != ec.docval || key == "" {
+		return nil, nil, nil, false
+	}
+	res, ok := ec.results[key]
+	if !ok {
+		ec.misses++
+		return nil, nil, nil, false
+	}
+	ec.hits++
+	return res.scalar, res.vector, res.err, true
+}
+
+// Put result of expression `key` evaluated on `docval`.
+func (ec *EvalCache) Put(
+	docval qvalue.AnnotatedValue, key string,
+	scalar qvalue.Value, vector qvalue.Values, err error) {
+
+	if ec == nil || docval != ec.docval || key == "" {
+		return
+	}
+	if ec.results == nil {
+		ec.results = make(map[string]evalResult)
+	}
+	ec.results[key] = evalResult{scalar: scalar, vector: vector, err: err}
+}
+
+// Stats return the number of cache hits and misses.
+func (ec *EvalCache) Stats() (hits, misses uint64) {
+	if ec == nil {
+		return 0, 0
+	}
+	return ec.hits, ec.misses
+}
@@ -43,10 +43,11 @@ type Evaluator interface {
 
 	// TransformRoute will transform document consumable by
 	// downstream, returns data to be published to endpoints.
+	// `evalCache` can be shared by evaluators of the same document.
 	TransformRoute(
 		vbuuid uint64, m *mc.DcpEvent, data map[string]interface{}, encodeBuf []byte,
 		docval qvalue.AnnotatedValue, context qexpr.Context, numIndexes int,
-		opaque2 uint64) ([]byte, error)
+		opaque2 uint64, evalCache *EvalCache) ([]byte, error)
 
 	Stats() interface{}
 
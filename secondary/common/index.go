@@ -184,6 +184,12 @@ const (
 	// the user session has observed so far. Note that this consistency option
 	// internal to indexer and not used in clients
 	SessionConsistencyStrict
+
+	// BoundedStalenessConsistency indexer would return data that is
+	// not older than a bound given along with the request, either in
+	// milliseconds or in seqnos per vbucket. Indexer serves the scan
+	// from the newest snapshot within the bound, or waits for one.
+	BoundedStalenessConsistency
 )
 
 func (cons Consistency) String() string {
@@ -196,6 +202,8 @@ func (cons Consistency) String() string {
 		return "QUERY_CONSISTENCY"
 	case SessionConsistencyStrict:
 		return "SESSION_CONSISTENCY_STRICT"
+	case BoundedStalenessConsistency:
+		return "BOUNDED_STALENESS_CONSISTENCY"
 	default:
 		return "UNKNOWN_CONSISTENCY"
 	}
@@ -239,6 +247,32 @@ type IndexDefn struct {
 	ArrSize       uint64  `json:"arrSize,omitempty"`
 	ResidentRatio float64 `json:"residentRatio,omitempty"`
 
+	// Memory quota (in bytes) of each index instance, and whether the
+	// index is evicted ahead of other indexes under memory pressure.
+	MemQuota      uint64 `json:"memQuota,omitempty"`
+	EvictPriority int    `json:"evictPriority,omitempty"`
+
+	// Vector index (Using vector): dimension of the vectors of the
+	// leading key and the distance used by nearest neighbor scans.
+	VectorDimension  int    `json:"vectorDimension,omitempty"`
+	VectorSimilarity string `json:"vectorSimilarity,omitempty"`
+
+	// Build tuning: number of writers of the slices during the initial
+	// build, maximum number of indexes built in the same batch
+	// as the index, and whether OSO is used for the initial build (nil
+	// uses build.enableOSO).
+	BuildWriterThreads int   `json:"buildWriterThreads,omitempty"`
+	BuildBatchSize     int   `json:"buildBatchSize,omitempty"`
+	BuildOSO           *bool `json:"buildOSO,omitempty"`
+
+	// On-disk compression codec of the index (CompressionSnappy,
+	// CompressionZstd or CompressionNone).  Empty uses plasma.compression.
+	Compression string `json:"compression,omitempty"`
+
+	// Maintain a bloom filter of the leading key in each slice, to skip
+	// the equality lookups of keys which are not in the index.
+	BloomFilter bool `json:"bloomFilter,omitempty"`
+
 	// transient field (not part of index metadata)
 	// These fields are used for create index during DDL, rebalance, or restore
 	InstVersion   int           `json:"instanceVersion,omitempty"`
@@ -297,6 +331,24 @@ func (idx IndexDefn) String() string {
 	str += fmt.Sprintf("PartitionKeys: %v ", idx.PartitionKeys)
 	str += fmt.Sprintf("WhereExpr: %v ", logging.TagUD(idx.WhereExpr))
 	str += fmt.Sprintf("RetainDeletedXATTR: %v ", idx.RetainDeletedXATTR)
+	if idx.MemQuota != 0 || idx.EvictPriority != 0 {
+		str += fmt.Sprintf("MemQuota: %v EvictPriority: %v ", idx.MemQuota, idx.EvictPriority)
+	}
+	if idx.IsVectorIndex() {
+		str += fmt.Sprintf("VectorDimension: %v VectorSimilarity: %v ", idx.VectorDimension, idx.VectorSimilarity)
+	}
+	if idx.BuildWriterThreads != 0 || idx.BuildBatchSize != 0 {
+		str += fmt.Sprintf("BuildWriterThreads: %v BuildBatchSize: %v ", idx.BuildWriterThreads, idx.BuildBatchSize)
+	}
+	if idx.BuildOSO != nil {
+		str += fmt.Sprintf("BuildOSO: %v ", *idx.BuildOSO)
+	}
+	if len(idx.Compression) != 0 {
+		str += fmt.Sprintf("Compression: %v ", idx.Compression)
+	}
+	if idx.BloomFilter {
+		str += fmt.Sprintf("BloomFilter: %v ", idx.BloomFilter)
+	}
 	return str
 
 }
@@ -333,9 +385,26 @@ func (idx IndexDefn) Clone() *IndexDefn {
 		DocKeySize:         idx.DocKeySize,
 		ArrSize:            idx.ArrSize,
 		NumReplica2:        idx.NumReplica2,
+		MemQuota:           idx.MemQuota,
+		EvictPriority:      idx.EvictPriority,
+		VectorDimension:    idx.VectorDimension,
+		VectorSimilarity:   idx.VectorSimilarity,
+		BuildWriterThreads: idx.BuildWriterThreads,
+		BuildBatchSize:     idx.BuildBatchSize,
+		BuildOSO:           idx.BuildOSO,
+		Compression:        idx.Compression,
+		BloomFilter:        idx.BloomFilter,
 	}
 }
 
+func (idx *IndexDefn) IsVectorIndex() bool {
+	return strings.ToLower(string(idx.Using)) == VectorIndex
+}
+
+func (idx *IndexDefn) IsHashIndex() bool {
+	return strings.ToLower(string(idx.Using)) == HashIndex
+}
+
 func (idx *IndexDefn) HasDescending() bool {
 
 	if idx.Desc != nil {
@@ -686,11 +755,52 @@ const (
 	MemDB           = "memdb"
 	MemoryOptimized = "memory_optimized"
 	PlasmaDB        = "plasma"
+
+	// VectorIndex is a memory optimized index supporting nearest
+	// neighbor scans over the vectors of its leading key.
+	VectorIndex = "vector"
+
+	// HashIndex is a memory optimized index organized as a hash table
+	// of its leading key.  It only supports equality lookups.
+	HashIndex = "hash"
 )
 
 func IsValidIndexType(t string) bool {
 	switch strings.ToLower(t) {
-	case ForestDB, MemDB, MemoryOptimized, PlasmaDB:
+	case ForestDB, MemDB, MemoryOptimized, PlasmaDB, VectorIndex, HashIndex:
+		return true
+	}
+
+	_, ok := getRegisteredIndexType(t)
+	return ok
+}
+
+// Distances between vectors of a vector index
+const (
+	VectorL2     = "l2"     // squared euclidean distance
+	VectorCosine = "cosine" // 1 - cosine similarity
+	VectorDot    = "dot"    // negative dot product
+)
+
+// On-disk compression codecs of an index
+const (
+	CompressionSnappy = "snappy"
+	CompressionZstd   = "zstd"
+	CompressionNone   = "none"
+)
+
+func IsValidCompression(s string) bool {
+	switch s {
+	case CompressionSnappy, CompressionZstd, CompressionNone:
+		return true
+	}
+
+	return false
+}
+
+func IsValidVectorSimilarity(s string) bool {
+	switch s {
+	case VectorL2, VectorCosine, VectorDot:
 		return true
 	}
 
@@ -0,0 +1,227 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+//
+// KeyspaceSettings overrides the indexer settings for buckets, scopes and
+// collections.  It maps a keyspace, as bucket, bucket:scope or
+// bucket:scope:collection, to the overridden settings.  Setting names are
+// the indexer config names without the "indexer." prefix.  The most
+// specific keyspace takes precedence.
+//
+type KeyspaceSettings map[string]map[string]interface{}
+
+// Settings which can be overridden per keyspace.
+var KeyspaceSettingNames = map[string]bool{
+	"settings.persisted_snapshot.interval":                true,
+	"settings.persisted_snapshot.fdb.interval":            true,
+	"settings.persisted_snapshot.moi.interval":            true,
+	"settings.persisted_snapshot_init_build.fdb.interval": true,
+	"settings.persisted_snapshot_init_build.moi.interval": true,
+	"settings.inmemory_snapshot.fdb.interval":             true,
+	"settings.inmemory_snapshot.moi.interval":             true,
+	"settings.max_array_seckey_size":                      true,
+	"settings.build.batch_size":                           true,
+	"settings.snapshot_retention.count":                   true,
+	"settings.snapshot_retention.max_age":                 true,
+}
+
+var pKeyspaceSettings unsafe.Pointer = unsafe.Pointer(&KeyspaceSettings{})
+
+var keyspaceSettingsCallbacks []func()
+var keyspaceSettingsCallbacksLock sync.Mutex
+
+//
+// ParseKeyspaceSettings parses and validates keyspace settings in JSON.
+// Values are converted to the type of the setting.
+//
+func ParseKeyspaceSettings(data []byte) (KeyspaceSettings, error) {
+
+	ks := make(KeyspaceSettings)
+	if len(data) == 0 {
+		return ks, nil
+	}
+
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, err
+	}
+
+	if err := ks.Validate(); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+func (ks KeyspaceSettings) Validate() error {
+
+	for keyspace, settings := range ks {
+		if parts := strings.Split(keyspace, ":"); len(keyspace) == 0 || len(parts) > 3 {
+			return fmt.Errorf("Invalid keyspace %v", keyspace)
+		}
+
+		for name, value := range settings {
+			if !KeyspaceSettingNames[name] {
+				names := make([]string, 0, len(KeyspaceSettingNames))
+				for n := range KeyspaceSettingNames {
+					names = append(names, n)
+				}
+				sort.Strings(names)
+				return NewSettingError(name, value,
+					fmt.Sprintf("setting cannot be overridden for keyspace %v", keyspace), strings.Join(names, ", "))
+			}
+
+			if err := ValidateSetting("indexer."+name, value); err != nil {
+				if serr, ok := err.(*SettingError); ok {
+					return NewSettingError(name, value,
+						fmt.Sprintf("%v for keyspace %v", serr.Message, keyspace), serr.Allowed)
+				}
+				return err
+			}
+
+			config := Config{name: SystemConfig["indexer."+name]}
+			if err := config.SetValue(name, value); err != nil {
+				return NewSettingError(name, value, fmt.Sprintf("%v for keyspace %v", err, keyspace), "")
+			}
+			settings[name] = config[name].Value
+		}
+	}
+
+	return nil
+}
+
+//
+// Lookup returns the value of the setting overridden for the keyspace.
+//
+func (ks KeyspaceSettings) Lookup(name, bucket, scope, collection string) (interface{}, bool) {
+
+	keyspaces := []string{bucket}
+	if len(scope) != 0 {
+		keyspaces = append(keyspaces, bucket+":"+scope)
+		if len(collection) != 0 {
+			keyspaces = append(keyspaces, bucket+":"+scope+":"+collection)
+		}
+	}
+
+	for i := len(keyspaces) - 1; i >= 0; i-- {
+		if value, ok := ks[keyspaces[i]][name]; ok {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+//
+// ConfigValue returns config[name], overridden for the keyspace.
+//
+func (ks KeyspaceSettings) ConfigValue(config Config, name, bucket, scope, collection string) ConfigValue {
+
+	cv := config[name]
+	if value, ok := ks.Lookup(name, bucket, scope, collection); ok {
+		cv.Value = value
+	}
+	return cv
+}
+
+//
+// Override returns config with the settings overridden for the keyspace.
+// It returns config itself if there is no override for the keyspace.
+//
+func (ks KeyspaceSettings) Override(config Config, bucket, scope, collection string) Config {
+
+	var newConfig Config
+	for name := range KeyspaceSettingNames {
+		if _, ok := config[name]; !ok {
+			continue
+		}
+
+		if value, ok := ks.Lookup(name, bucket, scope, collection); ok {
+			if newConfig == nil {
+				newConfig = config.Clone()
+			}
+			cv := newConfig[name]
+			cv.Value = value
+			newConfig[name] = cv
+		}
+	}
+
+	if newConfig == nil {
+		return config
+	}
+	return newConfig
+}
+
+func GetKeyspaceSettings() KeyspaceSettings {
+	return *(*KeyspaceSettings)(atomic.LoadPointer(&pKeyspaceSettings))
+}
+
+//
+// SetKeyspaceSettings replaces the keyspace settings, and notifies the
+// registered callbacks.
+//
+func SetKeyspaceSettings(ks KeyspaceSettings) {
+
+	atomic.StorePointer(&pKeyspaceSettings, unsafe.Pointer(&ks))
+
+	keyspaceSettingsCallbacksLock.Lock()
+	callbacks := keyspaceSettingsCallbacks
+	keyspaceSettingsCallbacksLock.Unlock()
+
+	for _, cb := range callbacks {
+		cb()
+	}
+}
+
+func RegisterKeyspaceSettingsCallback(cb func()) {
+
+	keyspaceSettingsCallbacksLock.Lock()
+	defer keyspaceSettingsCallbacksLock.Unlock()
+
+	keyspaceSettingsCallbacks = append(keyspaceSettingsCallbacks, cb)
+}
+
+//
+// KeyspaceSettingsChanges returns the changes from prev to ks for the
+// settings history.  The key of a change is the keyspace.
+//
+func KeyspaceSettingsChanges(prev, ks KeyspaceSettings) []SettingsChange {
+
+	keyspaces := make(map[string]bool)
+	for keyspace := range prev {
+		keyspaces[keyspace] = true
+	}
+	for keyspace := range ks {
+		keyspaces[keyspace] = true
+	}
+
+	var changes []SettingsChange
+	for keyspace := range keyspaces {
+		old, ok1 := prev[keyspace]
+		cur, ok2 := ks[keyspace]
+		if ok1 && ok2 && reflect.DeepEqual(old, cur) {
+			continue
+		}
+
+		change := SettingsChange{Key: keyspace}
+		if ok1 {
+			change.Old = old
+		}
+		if ok2 {
+			change.New = cur
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestParseKeyspaceSettings(t *testing.T) {
+
+	ks, err := ParseKeyspaceSettings([]byte(`{"b1:s1:c1": {"settings.max_array_seckey_size": 20480}}`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if value, ok := ks.Lookup("settings.max_array_seckey_size", "b1", "s1", "c1"); !ok || value != 20480 {
+		t.Fatalf("expected max_array_seckey_size 20480, got %v %v", value, ok)
+	}
+	if _, ok := ks.Lookup("settings.max_array_seckey_size", "b1", "s1", "c2"); ok {
+		t.Fatal("unexpected override for another collection")
+	}
+
+	if _, err := ParseKeyspaceSettings([]byte(`{"b1": {"settings.max_array_seckey_size": 0}}`)); err == nil {
+		t.Fatal("expected error for max_array_seckey_size 0")
+	}
+	if _, err := ParseKeyspaceSettings([]byte(`{"b1": {"settings.storage_mode": "plasma"}}`)); err == nil {
+		t.Fatal("expected error for a setting which cannot be overridden")
+	}
+}
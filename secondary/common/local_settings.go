@@ -0,0 +1,34 @@
+package common
+
+import (
+	"sync"
+)
+
+//
+// Node-local settings are stored in the local metadata of the index
+// manager, such as the planner settings set by /settings/planner.  The
+// index manager registers a function to read them, so that they can be
+// inspected with the other settings.
+//
+var localSettingsFn func() map[string]string
+var localSettingsLock sync.RWMutex
+
+func RegisterLocalSettings(fn func() map[string]string) {
+
+	localSettingsLock.Lock()
+	defer localSettingsLock.Unlock()
+
+	localSettingsFn = fn
+}
+
+func GetLocalSettings() map[string]string {
+
+	localSettingsLock.RLock()
+	fn := localSettingsFn
+	localSettingsLock.RUnlock()
+
+	if fn == nil {
+		return nil
+	}
+	return fn()
+}
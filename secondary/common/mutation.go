@@ -284,6 +284,16 @@ func (kv *KeyVersions) Length() int {
 	return len(kv.Uuids)
 }
 
+// Size approximate number of bytes occupied by key-versions, used for
+// accounting purposes.
+func (kv *KeyVersions) Size() int {
+	size := 8 + len(kv.Docid) + (8 * len(kv.Uuids)) + len(kv.Commands)
+	for i := range kv.Keys {
+		size += len(kv.Keys[i]) + len(kv.Oldkeys[i]) + len(kv.Partnkeys[i])
+	}
+	return size
+}
+
 // AddUpsert add a new keyversion for same OpMutation.
 func (kv *KeyVersions) AddUpsert(uuid uint64, key, oldkey, pkey []byte) {
 	kv.addKey(uuid, Upsert, key, oldkey, pkey)
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"math/rand"
 	"time"
 )
 
@@ -44,3 +45,68 @@ func (r *RetryHelper) Run() error {
 
 	return err
 }
+
+// Backoff computes the intervals between the attempts of an operation
+// retried for an unbounded time.  The interval grows by factor after every
+// attempt up to max, and is spread by +/- jitter (a fraction of it), so
+// that many retrying clients do not hit a server at the same time.
+type Backoff struct {
+	initial  time.Duration
+	max      time.Duration
+	factor   int
+	jitter   float64
+	interval time.Duration
+	attempts int
+}
+
+func NewBackoff(initial time.Duration, max time.Duration,
+	factor int, jitter float64) *Backoff {
+
+	if max < initial {
+		max = initial
+	}
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+
+	return &Backoff{
+		initial:  initial,
+		max:      max,
+		factor:   factor,
+		jitter:   jitter,
+		interval: initial,
+	}
+}
+
+// Next returns the interval to wait before the next attempt.
+func (b *Backoff) Next() time.Duration {
+	interval := b.interval
+	if b.jitter > 0 {
+		interval += time.Duration((rand.Float64()*2 - 1) * b.jitter * float64(interval))
+	}
+	if interval > b.max {
+		interval = b.max
+	}
+
+	b.attempts++
+	if b.interval < b.max {
+		b.interval = b.interval * time.Duration(b.factor)
+		if b.interval > b.max || b.interval <= 0 {
+			b.interval = b.max
+		}
+	}
+
+	return interval
+}
+
+// Attempts returns the number of intervals returned by Next.
+func (b *Backoff) Attempts() int {
+	return b.attempts
+}
+
+func (b *Backoff) Reset() {
+	b.interval = b.initial
+	b.attempts = 0
+}
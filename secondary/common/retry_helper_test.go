@@ -0,0 +1,73 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+
+	b := NewBackoff(10*time.Millisecond, 80*time.Millisecond, 2, 0)
+	for i, expected := range []time.Duration{10, 20, 40, 80, 80} {
+		if wait := b.Next(); wait != expected*time.Millisecond {
+			t.Fatalf("attempt %v: expected %vms, got %v", i+1, expected, wait)
+		}
+	}
+	if n := b.Attempts(); n != 5 {
+		t.Fatalf("expected 5 attempts, got %v", n)
+	}
+
+	b.Reset()
+	if wait := b.Next(); wait != 10*time.Millisecond || b.Attempts() != 1 {
+		t.Fatalf("expected 10ms after reset, got %v attempt %v", wait, b.Attempts())
+	}
+
+	// max is at least initial
+	b = NewBackoff(time.Second, time.Millisecond, 2, 0)
+	if wait := b.Next(); wait != time.Second {
+		t.Fatalf("expected 1s, got %v", wait)
+	}
+
+	// the interval does not overflow
+	b = NewBackoff(time.Second, time.Hour, 1<<30, 0)
+	for i := 0; i < 4; i++ {
+		b.Next()
+	}
+	if wait := b.Next(); wait != time.Hour {
+		t.Fatalf("expected 1h, got %v", wait)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+
+	initial, max := 100*time.Millisecond, 400*time.Millisecond
+
+	spread := false
+	for n := 0; n < 100; n++ {
+		b := NewBackoff(initial, max, 2, 0.5)
+		interval := initial
+		for i := 0; i < 5; i++ {
+			wait := b.Next()
+			if wait < interval/2 || wait > interval*3/2 || wait > max {
+				t.Fatalf("attempt %v: wait %v out of range of %v", i+1, wait, interval)
+			}
+			if wait != interval && wait != max {
+				spread = true
+			}
+			if interval < max {
+				interval *= 2
+			}
+		}
+	}
+	if !spread {
+		t.Fatal("expected waits to be spread by jitter")
+	}
+
+	// jitter is at most the interval
+	b := NewBackoff(initial, max, 2, 5)
+	for i := 0; i < 100; i++ {
+		if wait := b.Next(); wait < 0 || wait > max {
+			t.Fatalf("wait %v out of range", wait)
+		}
+	}
+}
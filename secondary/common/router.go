@@ -59,6 +59,10 @@ type RouterEndpoint interface {
 	// Send will post data to endpoint client, asynchronous call.
 	Send(data interface{}) error
 
+	// Flush will push data buffered so far to endpoint client,
+	// synchronous call.
+	Flush() error
+
 	// GetStatistics to gather statistics information from endpoint,
 	// synchronous call.
 	GetStatistics() map[string]interface{}
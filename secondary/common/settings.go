@@ -26,6 +26,8 @@ const (
 	IndexingMetaDir          = "/indexing/"
 	IndexingSettingsMetaDir  = IndexingMetaDir + "settings/"
 	IndexingSettingsMetaPath = IndexingSettingsMetaDir + "config"
+
+	IndexingKeyspaceSettingsMetaPath = IndexingSettingsMetaDir + "keyspace"
 )
 
 func GetSettingsConfig(cfg Config) (Config, error) {
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/couchbase/cbauth"
+)
+
+//
+// SettingsChange is an entry of the settings history.  Key is the name of
+// the setting, or the keyspace for keyspace settings.
+//
+type SettingsChange struct {
+	Time   time.Time   `json:"time"`
+	User   string      `json:"user,omitempty"`
+	Domain string      `json:"domain,omitempty"`
+	Key    string      `json:"key"`
+	Old    interface{} `json:"old"`
+	New    interface{} `json:"new"`
+}
+
+//
+// The settings in metakv are applied by every indexer node, and each node
+// records the changes it applies in its own history.  The node serving a
+// settings request sets the author of the value it stores, so that the
+// changes are attributed to the user on that node.
+//
+type settingsAuthor struct {
+	value []byte
+	creds cbauth.Creds
+}
+
+var settingsAuthors = make(map[string]settingsAuthor)
+var settingsAuthorsLock sync.Mutex
+
+//
+// The values of the secret settings are not kept in the history, which is
+// persisted and served by /settings/history.
+//
+var secretSettings = map[string]bool{
+	"indexer.cold_tier.access_key_id":     true,
+	"indexer.cold_tier.secret_access_key": true,
+}
+
+const redactedSettingValue = "<redacted>"
+
+var settingsRecorderFn func([]SettingsChange)
+var settingsRecorderLock sync.RWMutex
+
+//
+// RegisterSettingsRecorder registers the function which persists the
+// settings history.  It is registered by the index manager.
+//
+func RegisterSettingsRecorder(fn func([]SettingsChange)) {
+
+	settingsRecorderLock.Lock()
+	defer settingsRecorderLock.Unlock()
+
+	settingsRecorderFn = fn
+}
+
+//
+// RecordSettingsChanges adds changes made by creds to the settings history.
+// Changes are dropped if there is no recorder.  The values of secret
+// settings are redacted.
+//
+func RecordSettingsChanges(creds cbauth.Creds, changes []SettingsChange) {
+
+	if len(changes) == 0 {
+		return
+	}
+
+	settingsRecorderLock.RLock()
+	fn := settingsRecorderFn
+	settingsRecorderLock.RUnlock()
+
+	if fn == nil {
+		return
+	}
+
+	now := time.Now()
+	for i := range changes {
+		changes[i].Time = now
+		if secretSettings[changes[i].Key] {
+			changes[i].Old = redactedSettingValue
+			changes[i].New = redactedSettingValue
+		}
+		if creds != nil {
+			changes[i].User = creds.Name()
+			changes[i].Domain = creds.Domain()
+		}
+	}
+
+	fn(changes)
+}
+
+//
+// SetSettingsAuthor sets creds as the author of value, which is about to be
+// stored in metakv at path.
+//
+func SetSettingsAuthor(path string, value []byte, creds cbauth.Creds) {
+
+	settingsAuthorsLock.Lock()
+	defer settingsAuthorsLock.Unlock()
+
+	settingsAuthors[path] = settingsAuthor{value: value, creds: creds}
+}
+
+//
+// TakeSettingsAuthor returns the author of value at path, if it is set on
+// this node, and clears it.
+//
+func TakeSettingsAuthor(path string, value []byte) cbauth.Creds {
+
+	settingsAuthorsLock.Lock()
+	defer settingsAuthorsLock.Unlock()
+
+	author, ok := settingsAuthors[path]
+	if !ok || !bytes.Equal(author.value, value) {
+		return nil
+	}
+
+	delete(settingsAuthors, path)
+	return author.creds
+}
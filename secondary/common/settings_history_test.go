@@ -0,0 +1,35 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestRecordSettingsChangesRedactsSecrets(t *testing.T) {
+
+	var recorded []SettingsChange
+	RegisterSettingsRecorder(func(changes []SettingsChange) {
+		recorded = append(recorded, changes...)
+	})
+	defer RegisterSettingsRecorder(nil)
+
+	RecordSettingsChanges(nil, []SettingsChange{
+		{Key: "indexer.cold_tier.secret_access_key", Old: "", New: "wJalrXUtnFEMI/K7MDENG"},
+		{Key: "indexer.cold_tier.access_key_id", Old: "AKIAOLD", New: "AKIANEW"},
+		{Key: "indexer.settings.cold_tier.bucket", Old: "", New: "Index-Tier"},
+	})
+
+	if len(recorded) != 3 {
+		t.Fatalf("expected 3 changes, got %v", recorded)
+	}
+	for _, change := range recorded[:2] {
+		if change.Old != redactedSettingValue || change.New != redactedSettingValue {
+			t.Fatalf("secret setting %v is not redacted: %v -> %v", change.Key, change.Old, change.New)
+		}
+	}
+	if recorded[2].New != "Index-Tier" {
+		t.Fatalf("setting %v is redacted: %v", recorded[2].Key, recorded[2].New)
+	}
+	if recorded[0].Time.IsZero() {
+		t.Fatalf("change time is not set")
+	}
+}
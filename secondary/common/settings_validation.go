@@ -0,0 +1,210 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+)
+
+//
+// SettingError is the error of an invalid setting.  It is returned to the
+// client of a settings endpoint in JSON, with the key which failed and the
+// allowed values.
+//
+type SettingError struct {
+	Key     string      `json:"key"`
+	Value   interface{} `json:"value"`
+	Message string      `json:"message"`
+	Allowed string      `json:"allowed,omitempty"`
+}
+
+func (e *SettingError) Error() string {
+	if len(e.Allowed) != 0 {
+		return fmt.Sprintf("Invalid value %v of setting %v: %v.  Allowed: %v", e.Value, e.Key, e.Message, e.Allowed)
+	}
+	return fmt.Sprintf("Invalid value %v of setting %v: %v", e.Value, e.Key, e.Message)
+}
+
+func NewSettingError(key string, value interface{}, message string, allowed string) *SettingError {
+	return &SettingError{Key: key, Value: value, Message: message, Allowed: allowed}
+}
+
+type settingRange struct {
+	min float64
+	max float64
+}
+
+// Range of numeric settings.  Settings which are not listed accept any value
+// of their type.
+var settingRanges = map[string]settingRange{
+	"indexer.settings.max_seckey_size":                            {1, math.MaxInt32},
+	"indexer.settings.max_array_seckey_size":                      {1, math.MaxInt32},
+	"indexer.statsPersistenceInterval":                            {0, math.MaxInt64},
+	"indexer.statsPersistenceChunkSize":                           {1, math.MaxInt32},
+	"indexer.settings.rebalance.transfer_rate_limit":              {0, math.MaxInt64},
+	"indexer.settings.rebalance.max_concurrent_movers":            {0, math.MaxInt32},
+	"indexer.settings.persisted_snapshot.interval":                {1, math.MaxInt64},
+	"indexer.settings.persisted_snapshot.fdb.interval":            {1, math.MaxInt64},
+	"indexer.settings.persisted_snapshot.moi.interval":            {1, math.MaxInt64},
+	"indexer.settings.persisted_snapshot_init_build.fdb.interval": {1, math.MaxInt64},
+	"indexer.settings.persisted_snapshot_init_build.moi.interval": {1, math.MaxInt64},
+	"indexer.settings.inmemory_snapshot.interval":                 {1, math.MaxInt64},
+	"indexer.settings.inmemory_snapshot.fdb.interval":             {1, math.MaxInt64},
+	"indexer.settings.inmemory_snapshot.moi.interval":             {1, math.MaxInt64},
+	"indexer.settings.build.batch_size":                           {-1, math.MaxInt32},
+	"indexer.settings.max_cpu_percent":                            {0, math.MaxInt32},
+	"indexer.settings.scan_timeout":                               {0, math.MaxInt64},
+	"indexer.settings.rbac_cache_ttl":                             {0, math.MaxInt32},
+	"indexer.settings.stream_priority.maint_weight":               {0, math.MaxInt32},
+	"indexer.settings.stream_priority.init_weight":                {0, math.MaxInt32},
+	"projector.dcp.numConnections":                                {1, MaxDcpConnections},
+	"projector.settings.dcp.noop_interval":                        {1, math.MaxInt32},
+	"projector.settings.dcp.idle_timeout":                         {0, math.MaxInt32},
+}
+
+//
+// ValidateSetting checks the type and range of value for setting key.  The
+// value is as decoded from JSON.  Unknown settings are not validated, as
+// they are skipped when the settings are applied.
+//
+func ValidateSetting(key string, value interface{}) error {
+
+	cv, ok := SystemConfig[key]
+	if !ok || cv.DefaultVal == nil {
+		return nil
+	}
+
+	if value == nil {
+		return NewSettingError(key, value, "value is null", typeName(cv.DefaultVal))
+	}
+
+	defType := reflect.TypeOf(cv.DefaultVal)
+	val := reflect.ValueOf(value)
+
+	switch defType.Kind() {
+	case reflect.Bool:
+		if val.Kind() != reflect.Bool {
+			return NewSettingError(key, value, "value is not a boolean", "true, false")
+		}
+
+	case reflect.String:
+		if val.Kind() != reflect.String {
+			return NewSettingError(key, value, "value is not a string", "string")
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+
+		f, ok := toFloat64(val)
+		if !ok {
+			return NewSettingError(key, value, "value is not a number", typeName(cv.DefaultVal))
+		}
+
+		isInteger := defType.Kind() != reflect.Float32 && defType.Kind() != reflect.Float64
+		if isInteger && f != math.Trunc(f) {
+			return NewSettingError(key, value, "value is not an integer", typeName(cv.DefaultVal))
+		}
+
+		r, ok := settingRanges[key]
+		if !ok {
+			r = settingRange{min: -math.MaxFloat64, max: math.MaxFloat64}
+		}
+
+		if defType.Kind() >= reflect.Uint && defType.Kind() <= reflect.Uint64 && r.min < 0 {
+			r.min = 0
+		}
+
+		if f < r.min || f > r.max {
+			return NewSettingError(key, value, "value is out of range", rangeString(r))
+		}
+	}
+
+	return nil
+}
+
+var settingsValidatorFn func(value []byte, current Config) error
+var settingsValidatorLock sync.RWMutex
+
+//
+// RegisterSettingsValidator registers the function which validates a
+// change of the settings, as the settings endpoint of the indexer does.
+// It is registered by the settings manager of the indexer.
+//
+func RegisterSettingsValidator(fn func(value []byte, current Config) error) {
+
+	settingsValidatorLock.Lock()
+	defer settingsValidatorLock.Unlock()
+
+	settingsValidatorFn = fn
+}
+
+//
+// ValidateSettings validates the change of the current settings to values.
+// Without a registered validator, each setting is checked by ValidateSetting.
+//
+func ValidateSettings(values map[string]interface{}, current Config) error {
+
+	settingsValidatorLock.RLock()
+	fn := settingsValidatorFn
+	settingsValidatorLock.RUnlock()
+
+	if fn == nil {
+		for key, value := range values {
+			if err := ValidateSetting(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	value, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return fn(value, current)
+}
+
+func toFloat64(val reflect.Value) (float64, bool) {
+
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), true
+	}
+
+	return 0, false
+}
+
+func typeName(defaultVal interface{}) string {
+
+	switch reflect.TypeOf(defaultVal).Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "non-negative integer"
+	}
+
+	return "integer"
+}
+
+func rangeString(r settingRange) string {
+
+	if r.max == math.MaxFloat64 || r.max >= math.MaxInt32 {
+		if r.min == -math.MaxFloat64 {
+			return "number"
+		}
+		return fmt.Sprintf("%v or greater", r.min)
+	}
+
+	return fmt.Sprintf("%v to %v", r.min, r.max)
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestValidateSetting(t *testing.T) {
+
+	tests := []struct {
+		key   string
+		value interface{}
+		ok    bool
+	}{
+		// unknown settings are not validated
+		{"indexer.settings.no_such_setting", "abc", true},
+
+		{"indexer.settings.enable_corrupt_index_backup", true, true},
+		{"indexer.settings.enable_corrupt_index_backup", "true", false},
+		{"indexer.settings.enable_corrupt_index_backup", nil, false},
+
+		{"indexer.settings.storage_mode", "plasma", true},
+		{"indexer.settings.storage_mode", float64(1), false},
+
+		// numbers are decoded from JSON as float64
+		{"indexer.settings.scan_timeout", float64(0), true},
+		{"indexer.settings.scan_timeout", float64(1000), true},
+		{"indexer.settings.scan_timeout", float64(-1), false},
+		{"indexer.settings.scan_timeout", float64(1.5), false},
+		{"indexer.settings.scan_timeout", "1000", false},
+
+		{"indexer.settings.build.batch_size", float64(-1), true},
+		{"indexer.settings.build.batch_size", float64(-2), false},
+
+		// unsigned settings are not negative
+		{"indexer.settings.persisted_snapshot.moi.interval", float64(1), true},
+		{"indexer.settings.persisted_snapshot.moi.interval", float64(0), false},
+		{"indexer.settings.sliceBufSize", float64(0), true},
+		{"indexer.settings.sliceBufSize", float64(-1), false},
+
+		{"indexer.settings.max_seckey_size", float64(math.MaxInt32), true},
+		{"indexer.settings.max_seckey_size", float64(math.MaxInt32) + 1, false},
+	}
+
+	for _, test := range tests {
+		err := ValidateSetting(test.key, test.value)
+		if (err == nil) != test.ok {
+			t.Fatalf("%v %v: expected ok %v, got %v", test.key, test.value, test.ok, err)
+		}
+
+		if err != nil {
+			serr, ok := err.(*SettingError)
+			if !ok || serr.Key != test.key || !reflect.DeepEqual(serr.Value, test.value) {
+				t.Fatalf("%v %v: unexpected error %#v", test.key, test.value, err)
+			}
+		}
+	}
+}
+
+func TestSettingRanges(t *testing.T) {
+
+	for key, r := range settingRanges {
+		cv, ok := SystemConfig[key]
+		if !ok {
+			t.Fatalf("range of unknown setting %v", key)
+		}
+
+		if _, ok := toFloat64(reflect.ValueOf(cv.DefaultVal)); !ok {
+			t.Fatalf("range of non-numeric setting %v", key)
+		}
+
+		if r.min > r.max {
+			t.Fatalf("empty range of setting %v", key)
+		}
+
+		// the default value is valid
+		if err := ValidateSetting(key, cv.DefaultVal); err != nil {
+			t.Fatalf("default of setting %v: %v", key, err)
+		}
+	}
+}
@@ -51,6 +51,29 @@ var smStrMap = map[string]StorageMode{
 	PlasmaDB:        PLASMA,
 }
 
+//Index types of the storage engines registered with RegisterIndexType
+var gIndexTypes = make(map[string]StorageMode)
+
+//
+// RegisterIndexType adds index type t, to be used in IndexDefn.Using,
+// with the storage mode of its engine.  It must be called during
+// initialization.
+//
+func RegisterIndexType(t IndexType, mode StorageMode) {
+
+	smLock.Lock()
+	defer smLock.Unlock()
+	gIndexTypes[strings.ToLower(string(t))] = mode
+}
+
+func getRegisteredIndexType(t string) (StorageMode, bool) {
+
+	smLock.RLock()
+	defer smLock.RUnlock()
+	mode, ok := gIndexTypes[strings.ToLower(t)]
+	return mode, ok
+}
+
 //Storage Mode
 var gStorageMode StorageMode
 var gClusterStorageMode StorageMode
@@ -126,13 +149,16 @@ func SetClusterStorageModeStr(mode string) bool {
 func IndexTypeToStorageMode(t IndexType) StorageMode {
 
 	switch strings.ToLower(string(t)) {
-	case MemDB, MemoryOptimized:
+	case MemDB, MemoryOptimized, VectorIndex, HashIndex:
 		return MOI
 	case ForestDB:
 		return FORESTDB
 	case PlasmaDB:
 		return PLASMA
 	default:
+		if mode, ok := getRegisteredIndexType(string(t)); ok {
+			return mode
+		}
 		return NOT_SET
 	}
 }
@@ -0,0 +1,164 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package common
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Interval over which the bytes of each stream are compared
+	streamPriorityWindow = time.Second
+	// Time for which MAINT_STREAM is considered backlogged once reported
+	streamPriorityBacklogHold = time.Second
+	// Longest wait of INIT_STREAM for a batch of mutations, so that builds
+	// keep progressing even if MAINT_STREAM stays backlogged
+	streamPriorityMaxWait      = 100 * time.Millisecond
+	streamPriorityPollInterval = time.Millisecond
+)
+
+//
+// StreamPriority shares the mutation throughput of a process between
+// MAINT_STREAM and INIT_STREAM, so that large index builds do not make the
+// existing indexes stale.  It only applies while MAINT_STREAM is backlogged,
+// i.e. the process does not keep up with it.  Then INIT_STREAM gets at most
+// initWeight bytes for every maintWeight bytes of MAINT_STREAM, over a window
+// of a second.  A weight of 0 disables it.
+//
+type StreamPriority struct {
+	mu           sync.Mutex
+	maintWeight  int64
+	initWeight   int64
+	maintBytes   int64
+	initBytes    int64
+	windowStart  time.Time
+	backlogUntil time.Time
+
+	waitCount int64
+	waitTime  int64 // nanoseconds
+}
+
+func NewStreamPriority() *StreamPriority {
+	return &StreamPriority{windowStart: time.Now()}
+}
+
+//
+// SetWeights sets the weights of settings.stream_priority.
+//
+func (p *StreamPriority) SetWeights(maintWeight int, initWeight int) {
+
+	p.mu.Lock()
+	p.maintWeight, p.initWeight = int64(maintWeight), int64(initWeight)
+	p.mu.Unlock()
+}
+
+func (p *StreamPriority) enabledNoLock() bool {
+	return p.maintWeight > 0 && p.initWeight > 0
+}
+
+func (p *StreamPriority) rotateNoLock(now time.Time) {
+	if now.Sub(p.windowStart) >= streamPriorityWindow {
+		p.maintBytes, p.initBytes, p.windowStart = 0, 0, now
+	}
+}
+
+//
+// MaintBacklog records that MAINT_STREAM has mutations waiting.
+//
+func (p *StreamPriority) MaintBacklog() {
+
+	p.mu.Lock()
+	p.backlogUntil = time.Now().Add(streamPriorityBacklogHold)
+	p.mu.Unlock()
+}
+
+//
+// AddMaint accounts bytes of MAINT_STREAM mutations.
+//
+func (p *StreamPriority) AddMaint(bytes int) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.enabledNoLock() {
+		return
+	}
+	p.rotateNoLock(time.Now())
+	p.maintBytes += int64(bytes)
+}
+
+//
+// WaitInit accounts bytes of INIT_STREAM mutations, and waits as long as
+// INIT_STREAM is over its share while MAINT_STREAM is backlogged, or until
+// finch is closed.  It returns the time spent waiting.
+//
+func (p *StreamPriority) WaitInit(bytes int, finch <-chan bool) time.Duration {
+
+	start := time.Now()
+
+	p.mu.Lock()
+	if !p.enabledNoLock() {
+		p.mu.Unlock()
+		return 0
+	}
+	p.rotateNoLock(start)
+	p.initBytes += int64(bytes)
+	p.mu.Unlock()
+
+	var waited bool
+loop:
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		p.rotateNoLock(now)
+		over := p.enabledNoLock() && now.Before(p.backlogUntil) &&
+			p.initBytes*p.maintWeight > p.maintBytes*p.initWeight
+		p.mu.Unlock()
+
+		if !over || now.Sub(start) >= streamPriorityMaxWait {
+			break
+		}
+
+		waited = true
+		select {
+		case <-time.After(streamPriorityPollInterval):
+		case <-finch:
+			break loop
+		}
+	}
+
+	if !waited {
+		return 0
+	}
+
+	wait := time.Since(start)
+	atomic.AddInt64(&p.waitCount, 1)
+	atomic.AddInt64(&p.waitTime, int64(wait))
+	return wait
+}
+
+//
+// Map returns the weights and the waiting statistics of INIT_STREAM.
+//
+func (p *StreamPriority) Map() map[string]interface{} {
+
+	p.mu.Lock()
+	maintWeight, initWeight := p.maintWeight, p.initWeight
+	p.mu.Unlock()
+
+	return map[string]interface{}{
+		"maintWeight": float64(maintWeight),
+		"initWeight":  float64(initWeight),
+		"waitCount":   float64(atomic.LoadInt64(&p.waitCount)),
+		"waitTime":    float64(atomic.LoadInt64(&p.waitTime)),
+	}
+}
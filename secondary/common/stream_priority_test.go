@@ -0,0 +1,100 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamPriorityDisabled(t *testing.T) {
+
+	p := NewStreamPriority()
+	p.MaintBacklog()
+
+	// weights are 0 until set
+	if wait := p.WaitInit(1000, nil); wait != 0 {
+		t.Fatalf("expected no wait, got %v", wait)
+	}
+
+	p.SetWeights(3, 0)
+	p.AddMaint(1000)
+	if wait := p.WaitInit(1000, nil); wait != 0 {
+		t.Fatalf("expected no wait, got %v", wait)
+	}
+	if p.maintBytes != 0 || p.initBytes != 0 {
+		t.Fatalf("unexpected bytes accounted %v %v", p.maintBytes, p.initBytes)
+	}
+}
+
+func TestStreamPriorityWeights(t *testing.T) {
+
+	p := NewStreamPriority()
+	p.SetWeights(3, 1)
+
+	// INIT_STREAM does not wait while MAINT_STREAM is not backlogged
+	if wait := p.WaitInit(1000, nil); wait != 0 {
+		t.Fatalf("expected no wait without backlog, got %v", wait)
+	}
+
+	p = NewStreamPriority()
+	p.SetWeights(3, 1)
+	p.MaintBacklog()
+
+	// INIT_STREAM gets 1 byte for every 3 bytes of MAINT_STREAM
+	p.AddMaint(300)
+	if wait := p.WaitInit(100, nil); wait != 0 {
+		t.Fatalf("expected no wait within share, got %v", wait)
+	}
+
+	// over its share, INIT_STREAM waits for MAINT_STREAM to catch up
+	donech := make(chan time.Duration)
+	go func() {
+		donech <- p.WaitInit(100, nil)
+	}()
+
+	select {
+	case wait := <-donech:
+		t.Fatalf("expected wait over share, returned after %v", wait)
+	case <-time.After(streamPriorityMaxWait / 4):
+	}
+
+	p.AddMaint(300)
+	wait := <-donech
+	if wait < streamPriorityMaxWait/4 || wait >= streamPriorityMaxWait {
+		t.Fatalf("expected wait until MAINT_STREAM caught up, got %v", wait)
+	}
+
+	if stats := p.Map(); stats["maintWeight"] != float64(3) || stats["initWeight"] != float64(1) ||
+		stats["waitCount"] != float64(1) || stats["waitTime"] != float64(wait) {
+		t.Fatalf("unexpected stats %v", stats)
+	}
+}
+
+func TestStreamPriorityMaxWait(t *testing.T) {
+
+	p := NewStreamPriority()
+	p.SetWeights(3, 1)
+	p.MaintBacklog()
+
+	// builds progress even if MAINT_STREAM stays backlogged
+	wait := p.WaitInit(1000, nil)
+	if wait < streamPriorityMaxWait || wait > 10*streamPriorityMaxWait {
+		t.Fatalf("expected wait of about %v, got %v", streamPriorityMaxWait, wait)
+	}
+
+	// a wait ends when the stream is closed
+	finch := make(chan bool)
+	close(finch)
+	if wait := p.WaitInit(1000, finch); wait >= streamPriorityMaxWait {
+		t.Fatalf("expected wait to end on close, got %v", wait)
+	}
+
+	// the bytes of each stream are compared over a window
+	p.mu.Lock()
+	p.windowStart = time.Now().Add(-streamPriorityWindow)
+	p.mu.Unlock()
+
+	p.AddMaint(3000)
+	if wait := p.WaitInit(1000, nil); wait != 0 {
+		t.Fatalf("expected no wait in new window, got %v", wait)
+	}
+}
@@ -0,0 +1,214 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/security"
+)
+
+//
+// Bearer token authentication.  Tokens are issued by ns_server, and are
+// validated by calling ns_server on behalf of the token.  Validated tokens,
+// and the permissions checked for them, are cached for TOKEN_CACHE_EXPIRY.
+//
+
+// A token, or a permission of a token, revoked in ns_server is honoured
+// until its cache entry expires.  Keep the expiry short, so that revocation
+// takes effect quickly, while most requests of a client are served from
+// the cache.
+var TOKEN_CACHE_EXPIRY = 30 * time.Second
+var TOKEN_REQUEST_TIMEOUT = 10 * time.Second
+
+type tokenAuth struct {
+	clusterAddr string
+}
+
+var gTokenAuth unsafe.Pointer // *tokenAuth, nil if disabled
+
+var gTokenCacheLock sync.Mutex
+var gTokenCache = make(map[string]*tokenCreds)
+
+// tokenCreds implements cbauth.Creds for a bearer token.
+type tokenCreds struct {
+	clusterAddr string
+	token       string
+	name        string
+	domain      string
+	expiry      time.Time
+
+	lock        sync.Mutex
+	permissions map[string]bool
+}
+
+// SetTokenAuth enables or disables bearer token authentication, with
+// tokens validated by ns_server at clusterAddr.
+func SetTokenAuth(enable bool, clusterAddr string) {
+
+	var auth *tokenAuth
+	if enable {
+		auth = &tokenAuth{clusterAddr: clusterAddr}
+	}
+	atomic.StorePointer(&gTokenAuth, unsafe.Pointer(auth))
+
+	gTokenCacheLock.Lock()
+	gTokenCache = make(map[string]*tokenCreds)
+	gTokenCacheLock.Unlock()
+}
+
+func getBearerToken(r *http.Request) (string, bool) {
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(auth[7:])
+	return token, len(token) != 0
+}
+
+//
+// authToken validates token with ns_server.  It returns false if the token
+// is rejected by ns_server.
+//
+func authToken(auth *tokenAuth, token string) (cbauth.Creds, bool, error) {
+
+	now := time.Now()
+
+	gTokenCacheLock.Lock()
+	creds, ok := gTokenCache[token]
+	gTokenCacheLock.Unlock()
+
+	if ok && now.Before(creds.expiry) {
+		return creds, true, nil
+	}
+
+	resp, err := tokenRequest(auth.clusterAddr, token, "GET", "/whoami", nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("Fail to validate token.  Status %v", resp.Status)
+	}
+
+	var user struct {
+		Id     string `json:"id"`
+		Domain string `json:"domain"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, false, err
+	}
+
+	creds = &tokenCreds{
+		clusterAddr: auth.clusterAddr,
+		token:       token,
+		name:        user.Id,
+		domain:      user.Domain,
+		expiry:      now.Add(TOKEN_CACHE_EXPIRY),
+		permissions: make(map[string]bool),
+	}
+
+	gTokenCacheLock.Lock()
+	for key, cached := range gTokenCache {
+		if now.After(cached.expiry) {
+			delete(gTokenCache, key)
+		}
+	}
+	gTokenCache[token] = creds
+	gTokenCacheLock.Unlock()
+
+	return creds, true, nil
+}
+
+func tokenRequest(clusterAddr, token, method, path string, body io.Reader) (*http.Response, error) {
+
+	url, err := security.GetURL(ClusterUrl(clusterAddr) + path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, url.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+
+	client, err := security.MakeClient(url.String())
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = TOKEN_REQUEST_TIMEOUT
+
+	return client.Do(req)
+}
+
+func (c *tokenCreds) Name() string {
+	return c.name
+}
+
+func (c *tokenCreds) Domain() string {
+	return c.domain
+}
+
+func (c *tokenCreds) User() (string, string) {
+	return c.name, c.domain
+}
+
+//
+// IsAllowed checks permission of the token with ns_server.
+//
+func (c *tokenCreds) IsAllowed(permission string) (bool, error) {
+
+	c.lock.Lock()
+	allowed, ok := c.permissions[permission]
+	c.lock.Unlock()
+
+	if ok {
+		return allowed, nil
+	}
+
+	resp, err := tokenRequest(c.clusterAddr, c.token, "POST",
+		"/pools/default/checkPermissions", strings.NewReader(permission))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		logging.Warnf("tokenCreds::IsAllowed: token of %v is rejected", logging.TagUD(c.name))
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("Fail to check permission %v.  Status %v", permission, resp.Status)
+	}
+
+	result := make(map[string]bool)
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+
+	allowed = result[permission]
+
+	c.lock.Lock()
+	c.permissions[permission] = allowed
+	c.lock.Unlock()
+
+	return allowed, nil
+}
@@ -0,0 +1,170 @@
+package common
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetBearerToken(t *testing.T) {
+
+	tests := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{"", "", false},
+		{"Basic dXNlcjpwYXNz", "", false},
+		{"Bearer", "", false},
+		{"Bearer ", "", false},
+		{"Bearer    ", "", false},
+		{"Bearer abc", "abc", true},
+		{"bearer abc", "abc", true},
+		{"BEARER  abc ", "abc", true},
+		{"Bearerabc", "", false},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+
+		token, ok := getBearerToken(r)
+		if token != test.token || ok != test.ok {
+			t.Fatalf("header %q: expected %q %v, got %q %v", test.header, test.token, test.ok, token, ok)
+		}
+	}
+}
+
+// newTokenServer returns a fake ns_server that accepts token "good",
+// and allows it the permissions in allowed.
+func newTokenServer(allowed map[string]bool, whoami, checks *int32) *httptest.Server {
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/whoami":
+			atomic.AddInt32(whoami, 1)
+			w.Write([]byte(`{"id":"alice","domain":"local"}`))
+
+		case "/pools/default/checkPermissions":
+			atomic.AddInt32(checks, 1)
+			body, _ := ioutil.ReadAll(r.Body)
+			permission := string(body)
+			if allowed[permission] {
+				w.Write([]byte(`{"` + permission + `":true}`))
+			} else {
+				w.Write([]byte(`{"` + permission + `":false}`))
+			}
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestAuthTokenCache(t *testing.T) {
+
+	var whoami, checks int32
+	server := newTokenServer(nil, &whoami, &checks)
+	defer server.Close()
+
+	clusterAddr := strings.TrimPrefix(server.URL, "http://")
+	SetTokenAuth(true, clusterAddr)
+	defer SetTokenAuth(false, "")
+
+	auth := &tokenAuth{clusterAddr: clusterAddr}
+
+	creds, ok, err := authToken(auth, "good")
+	if err != nil || !ok {
+		t.Fatalf("expected token to be valid, got %v %v", ok, err)
+	}
+	if name, domain := creds.User(); name != "alice" || domain != "local" {
+		t.Fatalf("unexpected user %v %v", name, domain)
+	}
+
+	// cached token is not validated again
+	if _, ok, err := authToken(auth, "good"); err != nil || !ok {
+		t.Fatalf("expected cached token to be valid, got %v %v", ok, err)
+	}
+	if n := atomic.LoadInt32(&whoami); n != 1 {
+		t.Fatalf("expected 1 validation, got %v", n)
+	}
+
+	// expired token is validated again
+	gTokenCacheLock.Lock()
+	gTokenCache["good"].expiry = time.Now().Add(-time.Second)
+	gTokenCacheLock.Unlock()
+
+	if _, ok, err := authToken(auth, "good"); err != nil || !ok {
+		t.Fatalf("expected token to be valid, got %v %v", ok, err)
+	}
+	if n := atomic.LoadInt32(&whoami); n != 2 {
+		t.Fatalf("expected 2 validations, got %v", n)
+	}
+
+	// rejected token is neither valid nor cached
+	if _, ok, err := authToken(auth, "bad"); err != nil || ok {
+		t.Fatalf("expected token to be rejected, got %v %v", ok, err)
+	}
+
+	gTokenCacheLock.Lock()
+	_, cached := gTokenCache["bad"]
+	gTokenCacheLock.Unlock()
+	if cached {
+		t.Fatal("unexpected rejected token in cache")
+	}
+}
+
+func TestTokenCredsIsAllowed(t *testing.T) {
+
+	var whoami, checks int32
+	allowed := map[string]bool{"cluster.settings!read": true}
+	server := newTokenServer(allowed, &whoami, &checks)
+	defer server.Close()
+
+	clusterAddr := strings.TrimPrefix(server.URL, "http://")
+	newCreds := func(token string) *tokenCreds {
+		return &tokenCreds{
+			clusterAddr: clusterAddr,
+			token:       token,
+			name:        "alice",
+			permissions: make(map[string]bool),
+		}
+	}
+
+	creds := newCreds("good")
+	for i := 0; i < 2; i++ {
+		if ok, err := creds.IsAllowed("cluster.settings!read"); err != nil || !ok {
+			t.Fatalf("expected permission to be allowed, got %v %v", ok, err)
+		}
+		if ok, err := creds.IsAllowed("cluster.settings!write"); err != nil || ok {
+			t.Fatalf("expected permission to be denied, got %v %v", ok, err)
+		}
+	}
+
+	// both results are cached
+	if n := atomic.LoadInt32(&checks); n != 2 {
+		t.Fatalf("expected 2 permission checks, got %v", n)
+	}
+
+	// token rejected by ns_server is not allowed
+	if ok, err := newCreds("bad").IsAllowed("cluster.settings!read"); err != nil || ok {
+		t.Fatalf("expected rejected token to be denied, got %v %v", ok, err)
+	}
+
+	// unreachable ns_server is an error
+	server.Close()
+	if _, err := newCreds("good").IsAllowed("cluster.settings!read"); err == nil {
+		t.Fatal("expected error")
+	}
+}
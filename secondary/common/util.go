@@ -20,6 +20,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -635,6 +636,12 @@ func BucketTs(bucket *couchbase.Bucket, maxvb int) (seqnos, vbuuids []uint64, er
 
 func IsAuthValid(r *http.Request) (cbauth.Creds, bool, error) {
 
+	if auth := (*tokenAuth)(atomic.LoadPointer(&gTokenAuth)); auth != nil {
+		if token, ok := getBearerToken(r); ok {
+			return authToken(auth, token)
+		}
+	}
+
 	creds, err := cbauth.AuthWebCreds(r)
 	if err != nil {
 		if strings.Contains(err.Error(), cbauthimpl.ErrNoAuth.Error()) {
@@ -1139,6 +1146,118 @@ func IsAllAllowed(creds cbauth.Creds, permissions []string, w http.ResponseWrite
 	return true
 }
 
+var gNetworkAllowlist unsafe.Pointer = unsafe.Pointer(new([]*net.IPNet))
+
+// ParseNetworkAllowlist parses a comma separated list of CIDRs.
+func ParseNetworkAllowlist(cidrs string) ([]*net.IPNet, error) {
+
+	var nets []*net.IPNet
+	for _, cidr := range strings.Split(cidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if len(cidr) == 0 {
+			continue
+		}
+
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+
+	return nets, nil
+}
+
+// SetNetworkAllowlist sets the networks, given as a comma separated list
+// of CIDRs, that can call the destructive admin endpoints.  An empty list
+// allows all networks.
+func SetNetworkAllowlist(cidrs string) error {
+
+	nets, err := ParseNetworkAllowlist(cidrs)
+	if err != nil {
+		return err
+	}
+
+	atomic.StorePointer(&gNetworkAllowlist, unsafe.Pointer(&nets))
+	return nil
+}
+
+// MaxDcpConnections is the most DCP connections a feed of the projector
+// opens with each KV node.
+const MaxDcpConnections = 64
+
+// ParseTopicConnections parses projector.dcp.topicConnections, comma
+// separated <topic-prefix>=<connections> entries.  The number of
+// connections is from 1 to MaxDcpConnections.
+func ParseTopicConnections(spec string) (map[string]int, error) {
+
+	conns := make(map[string]int)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid DCP connections entry %q", entry)
+		}
+
+		prefix := strings.TrimSpace(entry[:i])
+		n, err := strconv.Atoi(strings.TrimSpace(entry[i+1:]))
+		if err != nil || n < 1 || n > MaxDcpConnections {
+			return nil, fmt.Errorf("invalid number of DCP connections for %q: %q, "+
+				"must be 1 to %v", prefix, entry[i+1:], MaxDcpConnections)
+		}
+		conns[prefix] = n
+	}
+
+	return conns, nil
+}
+
+// IsNetworkAllowed returns true if the request is from a network in the
+// allowlist, or from loopback.  Otherwise, it sends 403 Forbidden.
+func IsNetworkAllowed(r *http.Request, w http.ResponseWriter) bool {
+
+	nets := *(*[]*net.IPNet)(atomic.LoadPointer(&gNetworkAllowlist))
+	if len(nets) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsLoopback() {
+			return true
+		}
+
+		for _, ipnet := range nets {
+			if ipnet.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	logging.Warnf("Request %v from %v is rejected by network allowlist", r.URL.Path, r.RemoteAddr)
+
+	w.WriteHeader(http.StatusForbidden)
+	w.Write([]byte(http.StatusText(http.StatusForbidden)))
+	return false
+}
+
+// NetworkAllowed wraps handler to check the network allowlist, before
+// the handler authenticates the request.
+func NetworkAllowed(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if IsNetworkAllowed(r, w) {
+			handler(w, r)
+		}
+	}
+}
+
 func ComputePercent(a, b int64) int64 {
 	if a+b > 0 {
 		return a * 100 / (a + b)
@@ -282,6 +282,40 @@ func TestCopyDir(t *testing.T) {
 	}
 }
 
+func TestParseTopicConnections(t *testing.T) {
+
+	conns, err := ParseTopicConnections("")
+	if err != nil || len(conns) != 0 {
+		t.Fatalf("expected no entries, got %v %v", conns, err)
+	}
+
+	conns, err = ParseTopicConnections(" MAINT_STREAM_TOPIC = 8, INIT_STREAM_TOPIC=1,, ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{"MAINT_STREAM_TOPIC": 8, "INIT_STREAM_TOPIC": 1}
+	if !reflect.DeepEqual(conns, expected) {
+		t.Fatalf("expected %v, got %v", expected, conns)
+	}
+
+	conns, err = ParseTopicConnections(fmt.Sprintf("MAINT=%v", MaxDcpConnections))
+	if err != nil || conns["MAINT"] != MaxDcpConnections {
+		t.Fatalf("expected %v connections, got %v %v", MaxDcpConnections, conns, err)
+	}
+
+	for _, spec := range []string{"MAINT", "=8", "MAINT=", "MAINT=x", "MAINT=0", "MAINT=-1",
+		"MAINT=1.5", fmt.Sprintf("MAINT=%v", MaxDcpConnections+1), "MAINT=10000"} {
+
+		_, err := ParseTopicConnections(spec)
+		if err == nil {
+			t.Fatalf("%q: expected error", spec)
+		}
+		if !strings.Contains(err.Error(), "DCP connections") {
+			t.Fatalf("%q: unexpected error %v", spec, err)
+		}
+	}
+}
+
 func BenchmarkExcludeStrings(b *testing.B) {
 	x := []string{"1", "2", "3", "4"}
 	y := []string{"2", "4"}
@@ -31,6 +31,9 @@ import "github.com/couchbase/indexing/secondary/logging"
 import "github.com/couchbase/indexing/secondary/security"
 import "github.com/couchbase/indexing/secondary/stats"
 
+// timeout for compression handshake with downstream.
+const negotiateTimeout = 10 * time.Second
+
 // RouterEndpoint structure, per topic, to gather key-versions / mutations
 // from one or more vbuckets and push them downstream to a
 // specific node.
@@ -53,8 +56,9 @@ type RouterEndpoint struct {
 	finch chan bool
 	done  uint32
 	// downstream
-	pkt  *transport.TransportPacket
-	conn net.Conn
+	pkt         *transport.TransportPacket
+	conn        net.Conn
+	compression byte // negotiated with downstream, immutable
 	// statistics
 	stats *EndpointStats
 }
@@ -85,6 +89,11 @@ type EndpointStats struct {
 	osoSnapshotStart  stats.Uint64Val
 	osoSnapshotEnd    stats.Uint64Val
 
+	// Compression specific
+	compression stats.Uint64Val
+	rawBytes    stats.Uint64Val // bytes sent, before compression
+	wireBytes   stats.Uint64Val // bytes sent on the wire
+
 	cmdStats map[byte]*stats.Uint64Val
 }
 
@@ -111,6 +120,19 @@ func (stats *EndpointStats) Init() {
 	stats.seqnoAdvanced.Init()
 	stats.osoSnapshotStart.Init()
 	stats.osoSnapshotEnd.Init()
+
+	stats.compression.Init()
+	stats.rawBytes.Init()
+	stats.wireBytes.Init()
+}
+
+// CompressionRatio of bytes sent so far, 1.0 when nothing was sent.
+func (stats *EndpointStats) CompressionRatio() float64 {
+	raw, wire := stats.rawBytes.Value(), stats.wireBytes.Value()
+	if wire == 0 {
+		return 1.0
+	}
+	return float64(raw) / float64(wire)
 }
 
 func (stats *EndpointStats) IsClosed() bool {
@@ -118,7 +140,7 @@ func (stats *EndpointStats) IsClosed() bool {
 }
 
 func (stats *EndpointStats) String() string {
-	var stitems [24]string
+	var stitems [28]string
 	stitems[0] = `"mutCount":` + strconv.FormatUint(stats.mutCount.Value(), 10)
 	stitems[1] = `"upsertCount":` + strconv.FormatUint(stats.upsertCount.Value(), 10)
 	stitems[2] = `"deleteCount":` + strconv.FormatUint(stats.deleteCount.Value(), 10)
@@ -145,6 +167,12 @@ func (stats *EndpointStats) String() string {
 	stitems[21] = `"latency.avg":` + strconv.FormatInt(stats.prjLatency.Mean(), 10)
 	stitems[22] = `"latency.movingAvg":` + strconv.FormatInt(stats.prjLatency.MovingAvg(), 10)
 	stitems[23] = `"endpChLen":` + strconv.FormatUint((uint64)(len(stats.endpCh)), 10)
+
+	compression := transport.CompressionName(byte(stats.compression.Value()))
+	stitems[24] = `"compression":` + strconv.Quote(compression)
+	stitems[25] = `"compression.rawBytes":` + strconv.FormatUint(stats.rawBytes.Value(), 10)
+	stitems[26] = `"compression.wireBytes":` + strconv.FormatUint(stats.wireBytes.Value(), 10)
+	stitems[27] = `"compression.ratio":` + strconv.FormatFloat(stats.CompressionRatio(), 'f', 2, 64)
 	statjson := strings.Join(stitems[:], ",")
 	return fmt.Sprintf("{%v}", statjson)
 }
@@ -155,10 +183,22 @@ func NewRouterEndpoint(
 	cluster, topic, raddr string, maxvbs int,
 	config c.Config) (*RouterEndpoint, error) {
 
-	conn, err := security.MakeConn(raddr)
+	mtls, err := getMutualTLSConfig(config)
 	if err != nil {
 		return nil, err
 	}
+	conn, err := security.MakeMutualConn(raddr, mtls)
+	if err != nil {
+		return nil, err
+	}
+	compression := transport.CompressionNone
+	if cv, ok := config["compression"]; ok {
+		codecs := transport.ParseCompression(cv.String())
+		conn, compression, err = negotiateCompression(raddr, conn, codecs, mtls)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	endpoint := &RouterEndpoint{
 		topic:      topic,
@@ -172,14 +212,17 @@ func NewRouterEndpoint(
 		bufferTm:   time.Duration(config["bufferTimeout"].Int()),
 		harakiriTm: time.Duration(config["harakiriTimeout"].Int()),
 		stats:      &EndpointStats{},
+
+		compression: compression,
 	}
 	endpoint.ch = make(chan []interface{}, endpoint.keyChSize)
 	endpoint.conn = conn
 
 	endpoint.stats.Init()
 	endpoint.stats.endpCh = endpoint.ch
-	// TODO: add configuration params for transport flags.
+	endpoint.stats.compression.Set(uint64(compression))
 	flags := transport.TransportFlag(0).SetProtobuf()
+	flags = flags.SetCompression(compression)
 	maxPayload := config["maxPayload"].Int()
 	endpoint.pkt = transport.NewTransportPacket(maxPayload, flags)
 	endpoint.pkt.SetEncoder(transport.EncodingProtobuf, protobufEncode)
@@ -197,12 +240,57 @@ func NewRouterEndpoint(
 	return endpoint, nil
 }
 
+// negotiateCompression offers `codecs` to downstream on a freshly dialed
+// connection. Downstream nodes that do not support the handshake drop
+// the connection, in which case it is redialed without compression.
+func negotiateCompression(
+	raddr string, conn net.Conn, codecs []byte,
+	mtls *security.MutualTLSConfig) (net.Conn, byte, error) {
+
+	if len(codecs) == 0 {
+		return conn, transport.CompressionNone, nil
+	}
+	compression, err := transport.NegotiateCompression(
+		conn, codecs, negotiateTimeout)
+	if err == nil {
+		return conn, compression, nil
+	}
+
+	fmsg := "ENDP[<-(%v)] compression negotiation failed: %v, " +
+		"falling back to no compression\n"
+	logging.Warnf(fmsg, raddr, err)
+	conn.Close()
+	conn, err = security.MakeMutualConn(raddr, mtls)
+	if err != nil {
+		return nil, transport.CompressionNone, err
+	}
+	return conn, transport.CompressionNone, nil
+}
+
+// getMutualTLSConfig returns the mutual TLS setting, for connections
+// between router and downstream, from dataport `config`.
+func getMutualTLSConfig(config c.Config) (*security.MutualTLSConfig, error) {
+	mtls := &security.MutualTLSConfig{}
+	if cv, ok := config["tls.mutual"]; ok {
+		mtls.Enabled = cv.Bool()
+	}
+	if cv, ok := config["tls.cipherSuites"]; ok {
+		suites, err := security.ParseCipherSuites(cv.String())
+		if err != nil {
+			return nil, err
+		}
+		mtls.CipherSuites = suites
+	}
+	return mtls, nil
+}
+
 // commands
 const (
 	endpCmdPing byte = iota + 1
 	endpCmdSend
 	endpCmdResetConfig
 	endpCmdGetStatistics
+	endpCmdFlush
 	endpCmdClose
 )
 
@@ -230,6 +318,14 @@ func (endpoint *RouterEndpoint) Send(data interface{}) error {
 	return c.FailsafeOpNoblock(endpoint.ch, cmd, endpoint.finch)
 }
 
+// Flush data buffered so far to the other end, synchronous call.
+func (endpoint *RouterEndpoint) Flush() error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{endpCmdFlush, respch}
+	resp, err := c.FailsafeOp(endpoint.ch, respch, cmd, endpoint.finch)
+	return c.OpError(err, resp, 0)
+}
+
 // GetStatistics for this endpoint, synchronous call.
 func (endpoint *RouterEndpoint) GetStatistics() map[string]interface{} {
 	respch := make(chan []interface{}, 1)
@@ -382,6 +478,14 @@ loop:
 				stats := endpoint.newStats()
 				respch <- []interface{}{map[string]interface{}(stats)}
 
+			case endpCmdFlush:
+				respch := msg[1].(chan []interface{})
+				err := flushBuffers()
+				respch <- []interface{}{err}
+				if err != nil {
+					break loop
+				}
+
 			case endpCmdClose:
 				respch := msg[1].(chan []interface{})
 				flushBuffers()
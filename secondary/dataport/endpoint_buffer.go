@@ -108,5 +108,8 @@ func (b *endpointBuffers) flushBuffers(
 	if err := pkt.Send(conn, vbs); err != nil {
 		return err
 	}
+	raw, wire := pkt.LastPacketSize()
+	endpoint.stats.rawBytes.Add(uint64(raw))
+	endpoint.stats.wireBytes.Add(uint64(wire))
 	return nil
 }
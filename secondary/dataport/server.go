@@ -49,6 +49,10 @@
 //    g. bucket delete
 //    h. bucket flush
 //    i. DCP feed error
+//
+// 4. routers can offer a list of compressions right after connecting,
+//    the first one that is also configured in `compression` is picked
+//    for the connection, CompressionNone otherwise.
 
 package dataport
 
@@ -66,6 +70,7 @@ import (
 	"github.com/couchbase/indexing/secondary/logging"
 	protobuf "github.com/couchbase/indexing/secondary/protobuf/data"
 	"github.com/couchbase/indexing/secondary/security"
+	"github.com/couchbase/indexing/secondary/stats"
 	"github.com/couchbase/indexing/secondary/transport"
 )
 
@@ -126,6 +131,19 @@ type netConn struct {
 	worker chan interface{}
 	active bool
 	tpkt   *transport.TransportPacket
+
+	compression byte
+	rawBytes    stats.Uint64Val // bytes received, after de-compression
+	wireBytes   stats.Uint64Val // bytes received on the wire
+}
+
+// compressionRatio of the connection so far, 1.0 when nothing was received.
+func (nc *netConn) compressionRatio() float64 {
+	raw, wire := nc.rawBytes.Value(), nc.wireBytes.Value()
+	if wire == 0 {
+		return 1.0
+	}
+	return float64(raw) / float64(wire)
 }
 
 // Server handles an active dataport server of mutation for all vbuckets.
@@ -145,6 +163,8 @@ type Server struct {
 	genChSize    int           // channel size for genServer routine
 	maxPayload   int           // maximum payload length from router
 	readDeadline time.Duration // timeout, in millisecond, reading from socket
+	compressions []byte        // accepted compressions
+	mtls         *security.MutualTLSConfig
 	logPrefix    string
 
 	mu sync.Mutex
@@ -174,9 +194,16 @@ func NewServer(
 		maxPayload:   config["maxPayload"].Int(),
 		readDeadline: time.Duration(config["tcpReadDeadline"].Int()),
 	}
+	if cv, ok := config["compression"]; ok {
+		s.compressions = transport.ParseCompression(cv.String())
+	}
 	s.logPrefix = fmt.Sprintf("DATP[->dataport %q]", laddr)
 
-	if s.lis, err = security.MakeListener(laddr); err != nil {
+	if s.mtls, err = getMutualTLSConfig(config); err != nil {
+		logging.Errorf("%v failed starting! %v\n", s.logPrefix, err)
+		return nil, err
+	}
+	if s.lis, err = security.MakeMutualListener(laddr, s.mtls); err != nil {
 		logging.Errorf("%v failed starting! %v\n", s.logPrefix, err)
 		return nil, err
 	}
@@ -317,10 +344,13 @@ func (s *Server) genServer(reqch, datach chan []interface{}) {
 
 			} else { // connection accepted
 				worker := make(chan interface{}, s.maxVbuckets)
-				s.conns[raddr] = &netConn{
+				nc := &netConn{
 					conn: conn, worker: worker,
 					tpkt: newTransportPkt(s.maxPayload),
 				}
+				nc.rawBytes.Init()
+				nc.wireBytes.Init()
+				s.conns[raddr] = nc
 				n := len(s.conns)
 				fmsg := "%v new connection %q +%d\n"
 				logging.Infof(fmsg, s.logPrefix, raddr, n)
@@ -443,7 +473,7 @@ func (s *Server) handleResetConnections() error {
 		s.mu.Lock()
 		defer s.mu.Unlock()
 
-		if s.lis, err = security.MakeListener(s.laddr); err != nil {
+		if s.lis, err = security.MakeMutualListener(s.laddr, s.mtls); err != nil {
 			logging.Errorf("%v failed starting listener %v! %v\n", s.logPrefix, s.laddr, err)
 			return err
 		}
@@ -468,7 +498,9 @@ func (s *Server) startWorker(raddr string) {
 		return
 	}
 	logging.Tracef("%v starting worker for connection %q\n", s.logPrefix, raddr)
-	go doReceive(s.logPrefix, nc, s.maxPayload, s.readDeadline, s.datach)
+	go doReceive(
+		s.logPrefix, nc, s.maxPayload, s.readDeadline, s.compressions,
+		s.datach)
 	nc.active = true
 }
 
@@ -560,7 +592,10 @@ func closeConnection(prefix, raddr string, nc *netConn) {
 	}()
 	close(nc.worker)
 	nc.conn.Close()
-	logging.Infof("%v connection %q closed !\n", prefix, raddr)
+	fmsg := "%v connection %q closed ! compression %v ratio %.2f\n"
+	logging.Infof(
+		fmsg, prefix, raddr, transport.CompressionName(nc.compression),
+		nc.compressionRatio())
 }
 
 // get all remote connections for `host`
@@ -592,7 +627,7 @@ func (s *Server) listener() {
 
 		if s.lis != nil && lis == s.lis { // if s.lis == nil, then Server.Close() was called
 			s.lis.Close()
-			if s.lis, err = security.MakeListener(s.laddr); err != nil {
+			if s.lis, err = security.MakeMutualListener(s.laddr, s.mtls); err != nil {
 				logging.Errorf("%v failed starting %v !!\n", s.logPrefix, err)
 				panic(err)
 			}
@@ -634,7 +669,7 @@ func (s *Server) listener() {
 func doReceive(
 	prefix string,
 	nc *netConn,
-	maxPayload int, readDeadline time.Duration,
+	maxPayload int, readDeadline time.Duration, compressions []byte,
 	datach chan<- []interface{}) {
 
 	conn, worker := nc.conn, nc.worker
@@ -657,11 +692,29 @@ loop:
 		timeoutMs := readDeadline * time.Millisecond
 		conn.SetReadDeadline(time.Now().Add(timeoutMs))
 		msg.cmd, msg.err, msg.args = 0, nil, nil
-		if payload, err := pkt.Receive(conn); err != nil {
+		payload, err := pkt.Receive(conn)
+		if err != nil {
 			msg.cmd, msg.err = serverCmdError, err
 			datach <- []interface{}{msg}
 			logging.Errorf("%v worker %q exit: %v\n", prefix, msg.raddr, err)
 			break loop
+		}
+		raw, wire := pkt.LastPacketSize()
+		nc.rawBytes.Add(uint64(raw))
+		nc.wireBytes.Add(uint64(wire))
+
+		if offer, ok := payload.(transport.CompressionOffer); ok {
+			nc.compression = offer.Pick(compressions)
+			if err := transport.AcceptCompression(conn, nc.compression); err != nil {
+				msg.cmd, msg.err = serverCmdError, err
+				datach <- []interface{}{msg}
+				logging.Errorf("%v worker %q exit: %v\n", prefix, msg.raddr, err)
+				break loop
+			}
+			fmsg := "%v connection %q negotiated compression %v\n"
+			logging.Infof(
+				fmsg, prefix, msg.raddr,
+				transport.CompressionName(nc.compression))
 
 		} else if vbmap, ok := payload.(*protobuf.VbConnectionMap); ok {
 			msg.cmd, msg.args = serverCmdVbmap, []interface{}{vbmap}
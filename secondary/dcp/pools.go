@@ -782,6 +782,16 @@ func (p *Pool) GetScopeID(bucket, scope string) string {
 	return collections.SCOPE_ID_NIL
 }
 
+func (p *Pool) GetScopes(bucket string) []string {
+	var scopes []string
+	if manifest, ok := p.Manifest[bucket]; ok {
+		for _, scope := range manifest.Scopes {
+			scopes = append(scopes, scope.Name)
+		}
+	}
+	return scopes
+}
+
 func (p *Pool) GetScopeAndCollectionID(bucket, scope, collection string) (string, string) {
 	if manifest, ok := p.Manifest[bucket]; ok {
 		return manifest.GetScopeAndCollectionID(scope, collection)
@@ -0,0 +1,143 @@
+package memcached
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/dcp/transport"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// Size of the heap, in bytes, above which the flow control buffer of
+// DCP connections is shrunk. 0 disables it.
+var DcpMemoryThreshold uint64 = 0
+
+// Heap size is sampled at most once per dcpHeapSampleInterval, as
+// runtime.ReadMemStats stops the world.
+const dcpHeapSampleInterval = time.Second
+
+var dcpHeapSample struct {
+	sync.Mutex
+	when  time.Time
+	bytes uint64
+}
+
+func GetDcpMemoryThreshold() uint64 {
+	return atomic.LoadUint64(&DcpMemoryThreshold)
+}
+
+func SetDcpMemoryThreshold(val uint64) {
+	atomic.StoreUint64(&DcpMemoryThreshold, val)
+}
+
+// dcpMemoryPressure returns true if the heap is larger than
+// DcpMemoryThreshold.
+func dcpMemoryPressure() bool {
+	threshold := GetDcpMemoryThreshold()
+	if threshold == 0 {
+		return false
+	}
+
+	dcpHeapSample.Lock()
+	defer dcpHeapSample.Unlock()
+
+	if time.Since(dcpHeapSample.when) >= dcpHeapSampleInterval {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		dcpHeapSample.when, dcpHeapSample.bytes = time.Now(), ms.HeapAlloc
+	}
+	return dcpHeapSample.bytes > threshold
+}
+
+// clampBufferSize returns bufsize within the configured min and max size
+// of the flow control buffer.
+func (feed *DcpFeed) clampBufferSize(bufsize uint32) uint32 {
+	if feed.minBufferSize > 0 && bufsize < feed.minBufferSize {
+		bufsize = feed.minBufferSize
+	}
+	if feed.maxBufferSize > 0 && bufsize > feed.maxBufferSize {
+		bufsize = feed.maxBufferSize
+	}
+	return bufsize
+}
+
+// adaptiveBuffer returns true if the flow control buffer is resized
+// while the feed is running.
+func (feed *DcpFeed) adaptiveBuffer() bool {
+	return feed.minBufferSize > 0 && feed.minBufferSize < feed.maxBufferSize
+}
+
+// adjustBufferSize resizes the flow control buffer of the connection,
+// periodically called by genServer. The buffer is halved when the
+// application does not keep up with the feed, or under memory pressure,
+// and doubled when the application keeps up and more than a buffer worth
+// of bytes was received since the last call, i.e. the producer is likely
+// waiting for buffer acks.
+func (feed *DcpFeed) adjustBufferSize() {
+	if feed.bufferSize == 0 || len(feed.vbstreams) == 0 {
+		// flow control is not enabled on this connection,
+		// or there is no stream to receive the response
+		return
+	}
+
+	totalBytes := feed.stats.TotalBytes.Value()
+	received := totalBytes - feed.lastTickBytes
+	feed.lastTickBytes = totalBytes
+
+	backlog, capacity := len(feed.outch), cap(feed.outch)
+
+	size := feed.bufferSize
+	if dcpMemoryPressure() || (capacity > 0 && backlog >= capacity/2) {
+		size = feed.clampBufferSize(size / 2)
+	} else if backlog <= capacity/10 && received >= uint64(size) {
+		size = feed.clampBufferSize(size * 2)
+	}
+	if size == feed.bufferSize {
+		return
+	}
+
+	if err := feed.sendBufferSize(size); err != nil {
+		fmsg := "%v ##%x resizing buffer from %v to %v: %v\n"
+		logging.Errorf(fmsg, feed.logPrefix, feed.opaque, feed.bufferSize, size, err)
+		return
+	}
+
+	fmsg := "%v ##%x buffer resized from %v to %v, backlog %v/%v, received %v\n"
+	logging.Infof(fmsg, feed.logPrefix, feed.opaque, feed.bufferSize, size,
+		backlog, capacity, received)
+
+	feed.bufferSize = size
+	feed.maxAckBytes = uint32(bufferAckThreshold * float32(size))
+	feed.stats.BufferSize.Set(uint64(size))
+	feed.stats.TotalBufferResize.Add(1)
+}
+
+// sendBufferSize sets the flow control buffer of the open connection.
+// The response is handled by handlePacket, so the request uses the opaque
+// of one of the streams of the connection.
+func (feed *DcpFeed) sendBufferSize(size uint32) error {
+	var opaque uint32
+	for vb, stream := range feed.vbstreams {
+		opaque = composeOpaque(vb, stream.AppOpaque)
+		break
+	}
+
+	rq := &transport.MCRequest{
+		Opcode: transport.DCP_CONTROL,
+		Key:    []byte("connection_buffer_size"),
+		Body:   []byte(strconv.Itoa(int(size))),
+		Opaque: opaque,
+	}
+
+	feed.conn.SetMcdConnectionWriteDeadline()
+	defer feed.conn.ResetMcdConnectionWriteDeadline()
+
+	if err := feed.conn.Transmit(rq); err != nil {
+		return err
+	}
+	feed.stats.LastMsgSend.Set(time.Now().UnixNano())
+	return nil
+}
@@ -0,0 +1,165 @@
+package memcached
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/dcp/transport"
+)
+
+func newBufferTestFeed(conn net.Conn, bufsize, min, max uint32, outch chan<- *DcpEvent) *DcpFeed {
+	feed := &DcpFeed{
+		outch:         outch,
+		vbstreams:     map[uint16]*DcpStream{1: &DcpStream{AppOpaque: 7}},
+		bufferSize:    bufsize,
+		minBufferSize: min,
+		maxBufferSize: max,
+		stats:         &DcpStats{},
+	}
+	feed.stats.Init()
+	feed.conn, _ = Wrap(conn)
+	return feed
+}
+
+// receiveBufferSize returns the size sent by a DCP_CONTROL request.
+func receiveBufferSize(conn net.Conn) chan int {
+	sizech := make(chan int, 1)
+	go func() {
+		req := &transport.MCRequest{}
+		if _, err := req.Receive(conn, nil); err != nil {
+			sizech <- -1
+			return
+		}
+		if req.Opcode != transport.DCP_CONTROL || string(req.Key) != "connection_buffer_size" ||
+			req.Opaque != composeOpaque(1, 7) {
+			sizech <- -1
+			return
+		}
+		size, _ := strconv.Atoi(string(req.Body))
+		sizech <- size
+	}()
+	return sizech
+}
+
+func TestClampBufferSize(t *testing.T) {
+
+	feed := &DcpFeed{minBufferSize: 10, maxBufferSize: 40}
+	for size, expected := range map[uint32]uint32{1: 10, 10: 10, 20: 20, 40: 40, 80: 40} {
+		if clamped := feed.clampBufferSize(size); clamped != expected {
+			t.Fatalf("size %v: expected %v, got %v", size, expected, clamped)
+		}
+	}
+	if !feed.adaptiveBuffer() {
+		t.Fatal("expected adaptive buffer")
+	}
+
+	// no min or max
+	feed = &DcpFeed{}
+	if clamped := feed.clampBufferSize(80); clamped != 80 || feed.adaptiveBuffer() {
+		t.Fatalf("unexpected size %v or adaptive buffer", clamped)
+	}
+
+	feed = &DcpFeed{minBufferSize: 20, maxBufferSize: 20}
+	if feed.adaptiveBuffer() {
+		t.Fatal("expected fixed buffer with same min and max")
+	}
+}
+
+func TestAdjustBufferSize(t *testing.T) {
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	outch := make(chan *DcpEvent, 10)
+	feed := newBufferTestFeed(client, 20, 10, 40, outch)
+
+	// the buffer is doubled when more than its size was received
+	feed.stats.TotalBytes.Add(20)
+	sizech := receiveBufferSize(server)
+	feed.adjustBufferSize()
+	if size := <-sizech; size != 40 || feed.bufferSize != 40 || feed.maxAckBytes != 8 {
+		t.Fatalf("expected size 40, got %v %v ack %v", size, feed.bufferSize, feed.maxAckBytes)
+	}
+	if n := feed.stats.TotalBufferResize.Value(); n != 1 {
+		t.Fatalf("expected 1 resize, got %v", n)
+	}
+
+	// but not above max
+	feed.stats.TotalBytes.Add(40)
+	feed.adjustBufferSize()
+	if feed.bufferSize != 40 {
+		t.Fatalf("expected size 40, got %v", feed.bufferSize)
+	}
+
+	// nor when less than its size was received
+	feed.bufferSize = 20
+	feed.stats.TotalBytes.Add(10)
+	feed.adjustBufferSize()
+	if feed.bufferSize != 20 {
+		t.Fatalf("expected size 20, got %v", feed.bufferSize)
+	}
+
+	// the buffer is halved when the events are not drained
+	for i := 0; i < 5; i++ {
+		outch <- &DcpEvent{}
+	}
+	sizech = receiveBufferSize(server)
+	feed.adjustBufferSize()
+	if size := <-sizech; size != 10 || feed.bufferSize != 10 {
+		t.Fatalf("expected size 10, got %v %v", size, feed.bufferSize)
+	}
+
+	// but not below min
+	feed.adjustBufferSize()
+	if feed.bufferSize != 10 || feed.stats.TotalBufferResize.Value() != 2 {
+		t.Fatalf("expected size 10, got %v", feed.bufferSize)
+	}
+
+	// the buffer is halved under memory pressure
+	for len(outch) > 0 {
+		<-outch
+	}
+	defer SetDcpMemoryThreshold(GetDcpMemoryThreshold())
+	SetDcpMemoryThreshold(1)
+
+	feed.bufferSize = 40
+	feed.stats.TotalBytes.Add(100)
+	sizech = receiveBufferSize(server)
+	feed.adjustBufferSize()
+	if size := <-sizech; size != 20 || feed.bufferSize != 20 {
+		t.Fatalf("expected size 20, got %v %v", size, feed.bufferSize)
+	}
+
+	// no flow control or no stream
+	feed = newBufferTestFeed(client, 0, 10, 40, outch)
+	feed.stats.TotalBytes.Add(100)
+	feed.adjustBufferSize()
+	if feed.bufferSize != 0 {
+		t.Fatalf("unexpected size %v", feed.bufferSize)
+	}
+}
+
+func TestDcpMemoryPressure(t *testing.T) {
+
+	defer SetDcpMemoryThreshold(GetDcpMemoryThreshold())
+
+	SetDcpMemoryThreshold(0)
+	if dcpMemoryPressure() {
+		t.Fatal("expected no memory pressure when disabled")
+	}
+
+	SetDcpMemoryThreshold(1)
+	if !dcpMemoryPressure() {
+		t.Fatal("expected memory pressure above threshold")
+	}
+
+	SetDcpMemoryThreshold(1 << 62)
+	dcpHeapSample.Lock()
+	dcpHeapSample.when = dcpHeapSample.when.Add(-dcpHeapSampleInterval)
+	dcpHeapSample.Unlock()
+	if dcpMemoryPressure() {
+		t.Fatal("expected no memory pressure below threshold")
+	}
+}
@@ -70,6 +70,10 @@ type DcpFeed struct {
 	// stats
 	toAckBytes         uint32    // bytes client has read
 	maxAckBytes        uint32    // Max buffer control ack bytes
+	bufferSize         uint32    // size of flow control buffer
+	minBufferSize      uint32    // min size of adaptive flow control buffer
+	maxBufferSize      uint32    // max size of adaptive flow control buffer
+	lastTickBytes      uint64    // bytes received at last buffer resize tick
 	lastAckTime        time.Time // last time when BufferAck was sent
 	stats              *DcpStats // Stats for dcp client
 	done               uint32
@@ -114,6 +118,13 @@ func NewDcpFeed(
 		feed.osoSnapshot = config["osoSnapshot"].(bool)
 	}
 
+	if val, ok := config["minBufferSize"]; ok && val != nil {
+		feed.minBufferSize = uint32(val.(int))
+	}
+	if val, ok := config["maxBufferSize"]; ok && val != nil {
+		feed.maxBufferSize = uint32(val.(int))
+	}
+
 	go feed.genServer(opaque, feed.reqch, feed.finch, rcvch, config)
 	go feed.doReceive(rcvch, feed.finch, mc)
 	logging.Infof("%v ##%x feed started ...", feed.logPrefix, opaque)
@@ -245,6 +256,18 @@ func (feed *DcpFeed) genServer(
 		latencyTm.Stop()
 	}()
 
+	// adaptive flow control buffer
+	var bufferTick <-chan time.Time
+	if feed.adaptiveBuffer() {
+		bufferTickMs := 1000 // in milli-seconds
+		if val, ok := config["bufferSizeTick"]; ok && val != nil {
+			bufferTickMs = val.(int)
+		}
+		bufferTm := time.NewTicker(time.Duration(bufferTickMs) * time.Millisecond)
+		defer bufferTm.Stop()
+		bufferTick = bufferTm.C
+	}
+
 loop:
 	for {
 		select {
@@ -254,6 +277,9 @@ loop:
 				logging.Fatalf(fmsg, feed.logPrefix)
 			}
 
+		case <-bufferTick:
+			feed.adjustBufferSize()
+
 		case msg := <-reqch:
 			cmd := msg[0].(byte)
 			switch cmd {
@@ -759,6 +785,7 @@ func (feed *DcpFeed) doDcpOpen(
 	// send a DCP control message to set the window size for
 	// this connection
 	if bufsize > 0 {
+		bufsize = feed.clampBufferSize(bufsize)
 		rq := &transport.MCRequest{
 			Opcode: transport.DCP_CONTROL,
 			Key:    []byte("connection_buffer_size"),
@@ -796,6 +823,8 @@ func (feed *DcpFeed) doDcpOpen(
 			return ErrorConnection
 		}
 		feed.maxAckBytes = uint32(bufferAckThreshold * float32(bufsize))
+		feed.bufferSize = bufsize
+		feed.stats.BufferSize.Set(uint64(bufsize))
 	}
 
 	// send a DCP control message to enable_noop
@@ -834,10 +863,11 @@ func (feed *DcpFeed) doDcpOpen(
 
 	// send a DCP control message to set_noop_interval
 	if true /*set_noop_interval*/ {
+		noopInterval := GetDcpNoopInterval()
 		rq := &transport.MCRequest{
 			Opcode: transport.DCP_CONTROL,
 			Key:    []byte("set_noop_interval"),
-			Body:   []byte("20"),
+			Body:   []byte(strconv.Itoa(int(noopInterval))),
 		}
 		if err := feed.conn.Transmit(rq); err != nil {
 			fmsg := "%v ##%x doDcpOpen.Transmit(set_noop_interval): %v"
@@ -845,7 +875,7 @@ func (feed *DcpFeed) doDcpOpen(
 			return err
 		}
 		feed.stats.LastMsgSend.Set(time.Now().UnixNano())
-		logging.Infof("%v ##%x sending set_noop_interval", prefix, opaque)
+		logging.Infof("%v ##%x sending set_noop_interval %v", prefix, opaque, noopInterval)
 		msg, ok := <-rcvch
 		if !ok {
 			fmsg := "%v ##%x doDcpOpen.rcvch (set_noop_interval) closed"
@@ -1352,6 +1382,8 @@ type DcpStats struct {
 	TotalStreamEnd     stats.Uint64Val
 	TotalSpurious      stats.Uint64Val
 	ToAckBytes         stats.Uint64Val
+	BufferSize         stats.Uint64Val
+	TotalBufferResize  stats.Uint64Val
 
 	// Last memcached communication times
 	LastAckTime  stats.Int64Val
@@ -1388,6 +1420,8 @@ func (dcpStats *DcpStats) Init() {
 	dcpStats.TotalStreamEnd.Init()
 	dcpStats.TotalSpurious.Init()
 	dcpStats.ToAckBytes.Init()
+	dcpStats.BufferSize.Init()
+	dcpStats.TotalBufferResize.Init()
 	dcpStats.LastAckTime.Init()
 	dcpStats.LastNoopSend.Init()
 	dcpStats.LastNoopRecv.Init()
@@ -1421,7 +1455,7 @@ func (stats *DcpStats) String() (string, string) {
 		return now.Sub(time.Unix(0, t))
 	}
 
-	var stitems [24]string
+	var stitems [26]string
 	stitems[0] = `"bytes":` + strconv.FormatUint(stats.TotalBytes.Value(), 10)
 	stitems[1] = `"bufferacks":` + strconv.FormatUint(stats.TotalBufferAckSent.Value(), 10)
 	stitems[2] = `"toAckBytes":` + strconv.FormatUint(stats.ToAckBytes.Value(), 10)
@@ -1448,6 +1482,8 @@ func (stats *DcpStats) String() (string, string) {
 	stitems[21] = `"lastMsgRecv":` + getTimeDur(stats.LastMsgRecv.Value()).String()
 	stitems[22] = `"rcvchLen":` + strconv.FormatUint((uint64)(len(stats.rcvch)), 10)
 	stitems[23] = `"incomingMsg":` + strconv.FormatUint(stats.IncomingMsg.Value(), 10)
+	stitems[24] = `"bufferSize":` + strconv.FormatUint(stats.BufferSize.Value(), 10)
+	stitems[25] = `"bufferResizes":` + strconv.FormatUint(stats.TotalBufferResize.Value(), 10)
 	statjson := strings.Join(stitems[:], ",")
 
 	statsStr := fmt.Sprintf("{%v}", statjson)
@@ -36,8 +36,14 @@ var dialFun = net.Dial
 // is actively waiting. In Seconds.
 var DcpMemcachedTimeout uint32 = 120
 
-// 30 minutes
-const DcpMutationReadTimeout uint32 = 1800
+// Timeout for DCP connections which receive no message, not even a
+// noop, after which the connection is treated as dead. In Seconds,
+// 0 disables it. 30 minutes by default.
+var DcpMutationReadTimeout uint32 = 1800
+
+// Interval at which the DCP producer sends noops on the connections
+// opened from now on. In Seconds.
+var DcpNoopInterval uint32 = 20
 
 func GetDcpMemcachedTimeout() uint32 {
 	return atomic.LoadUint32(&DcpMemcachedTimeout)
@@ -47,6 +53,22 @@ func SetDcpMemcachedTimeout(val uint32) {
 	atomic.StoreUint32(&DcpMemcachedTimeout, val)
 }
 
+func GetDcpMutationReadTimeout() uint32 {
+	return atomic.LoadUint32(&DcpMutationReadTimeout)
+}
+
+func SetDcpMutationReadTimeout(val uint32) {
+	atomic.StoreUint32(&DcpMutationReadTimeout, val)
+}
+
+func GetDcpNoopInterval() uint32 {
+	return atomic.LoadUint32(&DcpNoopInterval)
+}
+
+func SetDcpNoopInterval(val uint32) {
+	atomic.StoreUint32(&DcpNoopInterval, val)
+}
+
 // Connect to a memcached server.
 func Connect(prot, dest string) (rv *Client, err error) {
 	conn, err := security.MakeConn(dest)
@@ -132,8 +154,12 @@ func (c *Client) ResetMcdConnectionWriteDeadline() {
 
 // Set Memcached Connection ReadDeadline.
 func (c *Client) SetMcdMutationReadDeadline() {
-	timeout := time.Duration(DcpMutationReadTimeout) * time.Second
-	err := c.SetReadDeadline(time.Now().Add(timeout))
+	timeout := time.Duration(GetDcpMutationReadTimeout()) * time.Second
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	err := c.SetReadDeadline(deadline)
 	if err != nil {
 		logging.Debugf("Error in SetMcdConnectionReadDeadline: %v", err)
 	}
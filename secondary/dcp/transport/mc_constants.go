@@ -60,6 +60,8 @@ const (
 	SASL_AUTH       = CommandCode(0x21)
 	SASL_STEP       = CommandCode(0x22)
 
+	AUDIT_PUT = CommandCode(0x27) // Submit an event to audit daemon
+
 	TAP_CONNECT          = CommandCode(0x40) // Client-sent request to initiate Tap feed
 	TAP_MUTATION         = CommandCode(0x41) // Notification of a SET/ADD/REPLACE/etc. on the server
 	TAP_DELETE           = CommandCode(0x42) // Notification of a DELETE on the server
@@ -194,6 +196,8 @@ func init() {
 	CommandNames[SASL_AUTH] = "SASL_AUTH"
 	CommandNames[SASL_STEP] = "SASL_STEP"
 
+	CommandNames[AUDIT_PUT] = "AUDIT_PUT"
+
 	CommandNames[TAP_CONNECT] = "TAP_CONNECT"
 	CommandNames[TAP_MUTATION] = "TAP_MUTATION"
 	CommandNames[TAP_DELETE] = "TAP_DELETE"
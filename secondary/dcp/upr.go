@@ -121,10 +121,19 @@ type DcpFeed struct {
 	logPrefix string
 	config    map[string]interface{}
 	// config
-	numConnections int
-	activeVbOnly   bool
+	numConnections  int
+	activeVbOnly    bool
+	vbucketSharding string
 }
 
+// Sharding of vbuckets across the DCP connections of a node.
+const (
+	// vbucket goes to the connection with the least vbuckets.
+	ShardLeastLoaded = "least_loaded"
+	// vbucket goes to connection vbno % numConnections.
+	ShardModulo = "modulo"
+)
+
 // StartDcpFeed creates and starts a new Dcp feed.
 // No data will be sent on the channel unless vbuckets streams
 // are requested.
@@ -146,6 +155,8 @@ func (b *Bucket) StartDcpFeed(
 //      "genChanSize", buffer channel size for control path.
 //      "dataChanSize", buffer channel size for data path.
 //      "numConnections", number of connections with DCP for local vbuckets.
+//      "vbucketSharding", optional, ShardLeastLoaded (default) or
+//          ShardModulo, how vbuckets are spread over the connections.
 func (b *Bucket) StartDcpFeedOver(
 	name DcpFeedName,
 	sequence, flags uint32,
@@ -171,6 +182,21 @@ func (b *Bucket) StartDcpFeedOver(
 	}
 	feed.numConnections = config["numConnections"].(int)
 	feed.activeVbOnly = config["activeVbOnly"].(bool)
+	feed.vbucketSharding = ShardLeastLoaded
+	if sharding, ok := config["vbucketSharding"].(string); ok {
+		switch sharding {
+		case ShardLeastLoaded, ShardModulo:
+			feed.vbucketSharding = sharding
+		default:
+			fmsg := "%v ##%x invalid vbucketSharding %q, using %v\n"
+			logging.Errorf(fmsg, feed.logPrefix, opaque, sharding, ShardLeastLoaded)
+		}
+	}
+	if feed.numConnections < 1 {
+		fmsg := "%v ##%x invalid numConnections %v, using 1\n"
+		logging.Errorf(fmsg, feed.logPrefix, opaque, feed.numConnections)
+		feed.numConnections = 1
+	}
 
 	feed.C = feed.output
 	if err := feed.connectToNodes(kvaddrs, opaque, flags, config); err != nil {
@@ -470,7 +496,13 @@ func (feed *DcpFeed) dcpRequestStream(
 	var err error
 
 	for i := 0; i < len(feed.nodeFeeds[master]); i++ {
-		singleFeed, ok := addtofeed(feed.nodeFeeds[master])
+		var singleFeed *FeedInfo
+		var ok bool
+		if feed.vbucketSharding == ShardModulo {
+			singleFeed, ok = modulofeed(feed.nodeFeeds[master], vb)
+		} else {
+			singleFeed, ok = addtofeed(feed.nodeFeeds[master])
+		}
 		if !ok {
 			fmsg := "%v ##%x notFound DcpFeed host: %q vb:%d\n"
 			logging.Errorf(fmsg, prefix, opaque, master, vb)
@@ -594,6 +626,18 @@ func addtofeed(nodeFeeds []*FeedInfo) (*FeedInfo, bool) {
 	return feedinfo, true
 }
 
+// modulofeed picks connection vb % len(nodeFeeds), or the next one if it
+// was purged.
+func modulofeed(nodeFeeds []*FeedInfo, vb uint16) (*FeedInfo, bool) {
+	n := len(nodeFeeds)
+	for i := 0; i < n; i++ {
+		if fi := nodeFeeds[(int(vb)+i)%n]; fi != nil {
+			return fi, true
+		}
+	}
+	return nil, false
+}
+
 func removefromfeed(nodeFeeds []*FeedInfo, forvb uint16) (*FeedInfo, bool) {
 	if len(nodeFeeds) == 0 {
 		return nil, false
@@ -0,0 +1,42 @@
+package couchbase
+
+import (
+	"testing"
+)
+
+func TestModulofeed(t *testing.T) {
+
+	if _, ok := modulofeed(nil, 0); ok {
+		t.Fatal("expected no connection")
+	}
+
+	nodeFeeds := make([]*FeedInfo, 4)
+	for i := range nodeFeeds {
+		nodeFeeds[i] = &FeedInfo{}
+	}
+
+	// vbuckets are sharded by vbno % connections
+	for vb := uint16(0); vb < 16; vb++ {
+		fi, ok := modulofeed(nodeFeeds, vb)
+		if !ok || fi != nodeFeeds[vb%4] {
+			t.Fatalf("vb %v: expected connection %v", vb, vb%4)
+		}
+	}
+
+	// the vbuckets of a purged connection go to the next one
+	nodeFeeds[1] = nil
+	nodeFeeds[2] = nil
+	for vb, i := range map[uint16]int{0: 0, 1: 3, 2: 3, 3: 3, 5: 3, 4: 0} {
+		fi, ok := modulofeed(nodeFeeds, vb)
+		if !ok || fi != nodeFeeds[i] {
+			t.Fatalf("vb %v: expected connection %v", vb, i)
+		}
+	}
+
+	for i := range nodeFeeds {
+		nodeFeeds[i] = nil
+	}
+	if _, ok := modulofeed(nodeFeeds, 1); ok {
+		t.Fatal("expected no connection")
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/couchbase/indexing/secondary/audit"
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/manager/client"
+)
+
+//
+// handleAlterIndex changes the replica count of an existing index.  The
+// request body is a json object with the bucket, scope, collection and
+// index name of the index, and num_replica.  The nodes of all the replicas
+// can be given in nodes, as in alter index.  The new replicas are built in
+// the background, and their progress is reported by /getIndexStatus.  The
+// excess replicas are dropped.
+//
+func (m *DDLServiceMgr) handleAlterIndex(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := m.validateAuthCreds(w, r)
+	if !ok {
+		logging.Errorf("DDLServiceMgr::handleAlterIndex Validation Failure for Request %v", logging.TagUD(r))
+		return
+	}
+
+	if r.Method != "POST" {
+		send(http.StatusBadRequest, w, "Unsupported Method")
+		return
+	}
+
+	bytes, _ := ioutil.ReadAll(r.Body)
+	in := make(map[string]interface{})
+	if err := json.Unmarshal(bytes, &in); err != nil {
+		send(http.StatusBadRequest, w, err.Error())
+		return
+	}
+
+	bucket, scope, collection, index, ok := getIndexNameParams(w, in)
+	if !ok {
+		return
+	}
+
+	if _, ok = in["num_replica"]; !ok {
+		send(http.StatusBadRequest, w, "Bad Request - num_replica Missing")
+		return
+	}
+
+	if common.GetBuildMode() != common.ENTERPRISE {
+		send(http.StatusBadRequest, w, "Alter index is only supported in Enterprise Edition")
+		return
+	}
+
+	permission := fmt.Sprintf("cluster.collection[%s:%s:%s].n1ql.index!alter", bucket, scope, collection)
+	if !common.IsAllowed(creds, []string{permission}, w) {
+		return
+	}
+
+	if !m.canProcessDDL() {
+		send(http.StatusServiceUnavailable, w, "Cannot alter index during rebalancing")
+		return
+	}
+
+	provider, _, err := newMetadataProvider(m.clusterAddr, nil, m.settings, "DDLServiceMgr")
+	if err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+	defer provider.Close()
+
+	meta := findIndexByName(provider, bucket, scope, collection, index)
+	if meta == nil {
+		send(http.StatusNotFound, w, fmt.Sprintf("Index %v does not exist", index))
+		return
+	}
+
+	plan := map[string]interface{}{"num_replica": in["num_replica"]}
+	if nodes, ok := in["nodes"]; ok {
+		plan["nodes"] = nodes
+	}
+
+	logging.Infof("DDLServiceMgr::handleAlterIndex Alter replica count of index (%v, %v, %v, %v) to %v",
+		bucket, scope, collection, index, in["num_replica"])
+
+	err = provider.AlterReplicaCount("replica_count", meta.Definition.DefnId, plan)
+	audit.LogIndexRequest(audit.ALTER_INDEX, r, creds, bucket, scope, collection, index, plan, err)
+	if err != nil {
+		logging.Errorf("DDLServiceMgr::handleAlterIndex Failed to alter index (%v, %v, %v, %v).  Error = %v",
+			bucket, scope, collection, index, err)
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+
+	send(http.StatusOK, w, "OK")
+}
+
+//
+// handleDropReplicaInstance drops the replica given by replicaId of an
+// existing index, without changing the replica count of the index.  It is
+// used to shed load from the node hosting the replica.  The request body is a
+// json object with the bucket, scope, collection and index name of the
+// index, and replicaId.  Since the replica count does not change, the dropped
+// replica is rebuilt by replica repair, or by the next rebalance.  Use
+// /alterIndex to lower the replica count instead.
+//
+func (m *DDLServiceMgr) handleDropReplicaInstance(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := m.validateAuthCreds(w, r)
+	if !ok {
+		logging.Errorf("DDLServiceMgr::handleDropReplicaInstance Validation Failure for Request %v", logging.TagUD(r))
+		return
+	}
+
+	if r.Method != "POST" {
+		send(http.StatusBadRequest, w, "Unsupported Method")
+		return
+	}
+
+	bytes, _ := ioutil.ReadAll(r.Body)
+	in := make(map[string]interface{})
+	if err := json.Unmarshal(bytes, &in); err != nil {
+		send(http.StatusBadRequest, w, err.Error())
+		return
+	}
+
+	bucket, scope, collection, index, ok := getIndexNameParams(w, in)
+	if !ok {
+		return
+	}
+
+	if _, ok = in["replicaId"]; !ok {
+		send(http.StatusBadRequest, w, "Bad Request - replicaId Missing")
+		return
+	}
+
+	if common.GetBuildMode() != common.ENTERPRISE {
+		send(http.StatusBadRequest, w, "Index replica is only supported in Enterprise Edition")
+		return
+	}
+
+	permission := fmt.Sprintf("cluster.collection[%s:%s:%s].n1ql.index!alter", bucket, scope, collection)
+	if !common.IsAllowed(creds, []string{permission}, w) {
+		return
+	}
+
+	if !m.canProcessDDL() {
+		send(http.StatusServiceUnavailable, w, "Cannot drop replica during rebalancing")
+		return
+	}
+
+	provider, _, err := newMetadataProvider(m.clusterAddr, nil, m.settings, "DDLServiceMgr")
+	if err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+	defer provider.Close()
+
+	meta := findIndexByName(provider, bucket, scope, collection, index)
+	if meta == nil {
+		send(http.StatusNotFound, w, fmt.Sprintf("Index %v does not exist", index))
+		return
+	}
+
+	logging.Infof("DDLServiceMgr::handleDropReplicaInstance Drop replica %v of index (%v, %v, %v, %v)",
+		in["replicaId"], bucket, scope, collection, index)
+
+	plan := map[string]interface{}{"replicaId": in["replicaId"]}
+	err = provider.AlterReplicaCount("drop_replica_instance", meta.Definition.DefnId, plan)
+
+	params := map[string]interface{}{"action": "drop_replica_instance", "replicaId": in["replicaId"]}
+	audit.LogIndexRequest(audit.ALTER_INDEX, r, creds, bucket, scope, collection, index, params, err)
+	if err != nil {
+		logging.Errorf("DDLServiceMgr::handleDropReplicaInstance Failed to drop replica of index (%v, %v, %v, %v).  Error = %v",
+			bucket, scope, collection, index, err)
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+
+	send(http.StatusOK, w, "OK")
+}
+
+// getIndexNameParams returns the bucket, scope, collection and index name
+// in the request.  It sends a bad request response if any is missing.
+func getIndexNameParams(w http.ResponseWriter, in map[string]interface{}) (string, string, string, string, bool) {
+
+	bucket, ok := in["bucket"].(string)
+	if !ok {
+		send(http.StatusBadRequest, w, "Bad Request - Bucket Information Missing")
+		return "", "", "", "", false
+	}
+
+	scope, ok := in["scope"].(string)
+	if !ok {
+		scope = common.DEFAULT_SCOPE
+	}
+
+	collection, ok := in["collection"].(string)
+	if !ok {
+		collection = common.DEFAULT_COLLECTION
+	}
+
+	index, ok := in["index"].(string)
+	if !ok {
+		send(http.StatusBadRequest, w, "Bad Request - Index Information Missing")
+		return "", "", "", "", false
+	}
+
+	return bucket, scope, collection, index, true
+}
+
+func findIndexByName(provider *client.MetadataProvider, bucket, scope, collection, name string) *client.IndexMetadata {
+
+	indexes, _ := provider.ListIndex()
+	for _, meta := range indexes {
+		if meta.Definition == nil {
+			continue
+		}
+
+		defn := meta.Definition
+		if defn.Bucket == bucket && defn.Scope == scope && defn.Collection == collection && defn.Name == name {
+			return meta
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,324 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+var errBloomFilterNoKey = errors.New("Key has no leading key")
+var errBloomFilterMemory = errors.New("Bloom filters exceed bloom_filter.memory_frac of the memory quota")
+
+//
+// gBloomFilterMemory is the memory used by the bloom filters of all the
+// slices.  It is taken from the memory quota of plasma, and limited to
+// gBloomFilterMaxMemory.  A filter which cannot grow within the limit is
+// disabled.
+//
+var gBloomFilterMemory int64
+var gBloomFilterMaxMemory int64
+
+func setBloomFilterMaxMemory(config common.Config) {
+	memQuota := float64(config["settings.memory_quota"].Uint64())
+	atomic.StoreInt64(&gBloomFilterMaxMemory, int64(memQuota*config["bloom_filter.memory_frac"].Float64()))
+}
+
+func getBloomFilterMemory() int64 {
+	return atomic.LoadInt64(&gBloomFilterMemory)
+}
+
+func reserveBloomFilterMemory(size int64) bool {
+
+	for {
+		used := atomic.LoadInt64(&gBloomFilterMemory)
+		if used+size > atomic.LoadInt64(&gBloomFilterMaxMemory) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&gBloomFilterMemory, used, used+size) {
+			return true
+		}
+	}
+}
+
+//
+// bloomFilterLayer is a bloom filter sized for capacity keys.  Bits are
+// set atomically, so that keys can be added by several writers.
+//
+type bloomFilterLayer struct {
+	bits     []uint64
+	numBits  uint64
+	numHash  uint64
+	capacity int64
+	count    int64
+}
+
+//
+// newBloomFilterLayer returns nil if the layer does not fit in the memory
+// of the bloom filters.
+//
+func newBloomFilterLayer(capacity uint64, fpRate float64) *bloomFilterLayer {
+
+	if capacity == 0 {
+		capacity = 1
+	}
+
+	// m = -n ln(p) / ln(2)^2 and k = m/n ln(2)
+	numBits := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	numBits = (numBits + 63) / 64 * 64
+	numHash := uint64(math.Ceil(float64(numBits) / float64(capacity) * math.Ln2))
+	if numHash == 0 {
+		numHash = 1
+	}
+
+	if !reserveBloomFilterMemory(int64(numBits / 8)) {
+		return nil
+	}
+
+	return &bloomFilterLayer{
+		bits:     make([]uint64, numBits/64),
+		numBits:  numBits,
+		numHash:  numHash,
+		capacity: int64(capacity),
+	}
+}
+
+func (l *bloomFilterLayer) add(h1, h2 uint64) {
+
+	for i := uint64(0); i < l.numHash; i++ {
+		pos := (h1 + i*h2) % l.numBits
+		addr := &l.bits[pos/64]
+		mask := uint64(1) << (pos % 64)
+		for {
+			old := atomic.LoadUint64(addr)
+			if old&mask != 0 || atomic.CompareAndSwapUint64(addr, old, old|mask) {
+				break
+			}
+		}
+	}
+}
+
+func (l *bloomFilterLayer) test(h1, h2 uint64) bool {
+
+	for i := uint64(0); i < l.numHash; i++ {
+		pos := (h1 + i*h2) % l.numBits
+		if atomic.LoadUint64(&l.bits[pos/64])&(uint64(1)<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// bloomFilter is a scalable bloom filter.  When the last layer is full, a
+// layer of twice its capacity and half its false positive rate is added,
+// so that the false positive rate stays below fpRate however many keys
+// are added.  Keys cannot be removed.  Until the filter is ready (i.e.
+// all the keys of the slice have been added), MayContain returns true.
+// The filter is stopped, and not ready, when it cannot grow.
+//
+type bloomFilter struct {
+	mutex  sync.RWMutex
+	layers []*bloomFilterLayer
+	fpRate float64
+
+	ready   int32
+	stopped int32
+}
+
+func newBloomFilter(capacity uint64, fpRate float64) (*bloomFilter, error) {
+
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+
+	layer := newBloomFilterLayer(capacity, fpRate/2)
+	if layer == nil {
+		return nil, errBloomFilterMemory
+	}
+
+	return &bloomFilter{
+		layers: []*bloomFilterLayer{layer},
+		fpRate: fpRate,
+	}, nil
+}
+
+//
+// bloomFilterHash returns the two hashes of key (FNV-1a) from which the
+// positions of its bits are derived.
+//
+func bloomFilterHash(key []byte) (uint64, uint64) {
+
+	h1 := uint64(14695981039346656037)
+	for _, c := range key {
+		h1 ^= uint64(c)
+		h1 *= 1099511628211
+	}
+	h2 := (h1>>32 | h1<<32) | 1
+
+	return h1, h2
+}
+
+func (f *bloomFilter) Add(key []byte) {
+
+	h1, h2 := bloomFilterHash(key)
+
+	f.mutex.RLock()
+	if len(f.layers) == 0 {
+		f.mutex.RUnlock()
+		return
+	}
+	last := f.layers[len(f.layers)-1]
+	last.add(h1, h2)
+	full := atomic.AddInt64(&last.count, 1) == last.capacity
+	f.mutex.RUnlock()
+
+	if full {
+		f.grow(last)
+	}
+}
+
+func (f *bloomFilter) grow(last *bloomFilterLayer) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.layers) == 0 || f.layers[len(f.layers)-1] != last {
+		return
+	}
+
+	fpRate := f.fpRate / math.Pow(2, float64(len(f.layers)+1))
+	layer := newBloomFilterLayer(uint64(last.capacity)*2, fpRate)
+	if layer == nil {
+		// keys added from now on would be missing from the filter
+		atomic.StoreInt32(&f.ready, 0)
+		f.Stop()
+		return
+	}
+	f.layers = append(f.layers, layer)
+}
+
+func (f *bloomFilter) MayContain(key []byte) bool {
+
+	if !f.IsReady() {
+		return true
+	}
+
+	h1, h2 := bloomFilterHash(key)
+
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	for _, l := range f.layers {
+		if l.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *bloomFilter) SetReady() {
+	atomic.StoreInt32(&f.ready, 1)
+}
+
+func (f *bloomFilter) IsReady() bool {
+	return atomic.LoadInt32(&f.ready) == 1
+}
+
+//
+// Stop aborts the initial load of the filter.
+//
+func (f *bloomFilter) Stop() {
+	atomic.StoreInt32(&f.stopped, 1)
+}
+
+func (f *bloomFilter) IsStopped() bool {
+	return atomic.LoadInt32(&f.stopped) == 1
+}
+
+//
+// Free stops the filter and releases its memory.
+//
+func (f *bloomFilter) Free() {
+
+	atomic.StoreInt32(&f.ready, 0)
+	f.Stop()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, l := range f.layers {
+		atomic.AddInt64(&gBloomFilterMemory, -int64(len(l.bits)*8))
+	}
+	f.layers = nil
+}
+
+//
+// Size returns the memory used by the filter in bytes.
+//
+func (f *bloomFilter) Size() int64 {
+
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	var size int64
+	for _, l := range f.layers {
+		size += int64(len(l.bits) * 8)
+	}
+	return size
+}
+
+//
+// bloomFilterKeyBuf is the buffer to explode a key into its leading key.
+// The buffers are pooled, so that adding a mutation to the bloom filter
+// does not allocate.
+//
+type bloomFilterKeyBuf struct {
+	buf   []byte
+	cktmp [][]byte
+}
+
+var bloomFilterKeyPool = sync.Pool{
+	New: func() interface{} {
+		return &bloomFilterKeyBuf{cktmp: make([][]byte, 1)}
+	},
+}
+
+var bloomFilterExplodePos = []bool{true}
+
+//
+// bloomFilterKey returns the encoded leading key of the secondary key of
+// an index entry or of a lookup key, which is the key of the bloom filter.
+// An equality lookup matches the entries whose leading key is equal to
+// the leading key of the lookup key.  The leading key is a slice of key.
+//
+func bloomFilterKey(key []byte, b *bloomFilterKeyBuf) ([]byte, error) {
+
+	if cap(b.buf) < len(key)*3 {
+		b.buf = make([]byte, 0, len(key)*3)
+	}
+
+	b.cktmp[0] = nil
+	_, _, err := jsonEncoder.ExplodeArray3(key, b.buf[:0], b.cktmp, nil, bloomFilterExplodePos, nil, 0)
+	leadingKey := b.cktmp[0]
+	b.cktmp[0] = nil
+
+	if err != nil {
+		return nil, err
+	}
+	if leadingKey == nil {
+		return nil, errBloomFilterNoKey
+	}
+	return leadingKey, nil
+}
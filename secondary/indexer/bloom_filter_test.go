@@ -0,0 +1,148 @@
+package indexer
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// setTestBloomFilterMemory allows max more bytes of bloom filters, and
+// returns the function restoring the limit.
+func setTestBloomFilterMemory(max int64) func() {
+
+	used := atomic.LoadInt64(&gBloomFilterMemory)
+	oldMax := atomic.LoadInt64(&gBloomFilterMaxMemory)
+	atomic.StoreInt64(&gBloomFilterMaxMemory, used+max)
+
+	return func() {
+		atomic.StoreInt64(&gBloomFilterMaxMemory, oldMax)
+	}
+}
+
+func TestBloomFilterNoFalseNegatives(t *testing.T) {
+
+	defer setTestBloomFilterMemory(64 * 1024 * 1024)()
+
+	filter, err := newBloomFilter(1000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filter.Free()
+
+	// keys are added by several writers while the filter grows
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 25000; i++ {
+				filter.Add([]byte(fmt.Sprintf("key-%v-%v", w, i)))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if len(filter.layers) < 2 {
+		t.Fatalf("expected the filter to grow, got %v layers", len(filter.layers))
+	}
+
+	// the filter matches everything until it is ready
+	if !filter.MayContain([]byte("missing")) {
+		t.Fatal("expected a filter which is not ready to match")
+	}
+	filter.SetReady()
+
+	for w := 0; w < 4; w++ {
+		for i := 0; i < 25000; i++ {
+			if key := fmt.Sprintf("key-%v-%v", w, i); !filter.MayContain([]byte(key)) {
+				t.Fatalf("false negative for %v", key)
+			}
+		}
+	}
+
+	var falsePositives int
+	for i := 0; i < 100000; i++ {
+		if filter.MayContain([]byte(fmt.Sprintf("missing-%v", i))) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 100000; rate > 0.02 {
+		t.Fatalf("false positive rate %v above 0.01", rate)
+	}
+}
+
+func TestBloomFilterLayerSize(t *testing.T) {
+
+	defer setTestBloomFilterMemory(64 * 1024 * 1024)()
+
+	for _, test := range []struct {
+		capacity uint64
+		fpRate   float64
+	}{
+		{1, 0.01},
+		{1000, 0.01},
+		{100000, 0.001},
+	} {
+		l := newBloomFilterLayer(test.capacity, test.fpRate)
+
+		// m = -n ln(p) / ln(2)^2, rounded up to 64 bits
+		bits := -float64(test.capacity) * math.Log(test.fpRate) / (math.Ln2 * math.Ln2)
+		if float64(l.numBits) < bits || float64(l.numBits) >= bits+64 {
+			t.Fatalf("capacity %v fp rate %v: expected %v bits, got %v", test.capacity, test.fpRate,
+				bits, l.numBits)
+		}
+		if uint64(len(l.bits))*64 != l.numBits {
+			t.Fatalf("expected %v words, got %v", l.numBits/64, len(l.bits))
+		}
+
+		// k = m/n ln(2)
+		k := math.Ceil(float64(l.numBits) / float64(test.capacity) * math.Ln2)
+		if float64(l.numHash) != k {
+			t.Fatalf("capacity %v fp rate %v: expected %v hashes, got %v", test.capacity, test.fpRate,
+				k, l.numHash)
+		}
+
+		atomic.AddInt64(&gBloomFilterMemory, -int64(len(l.bits)*8))
+	}
+}
+
+func TestBloomFilterMemory(t *testing.T) {
+
+	used := atomic.LoadInt64(&gBloomFilterMemory)
+
+	// first layer of 1000 keys at 0.5% is 11072 bits
+	defer setTestBloomFilterMemory(11072/8 + 100)()
+
+	filter, err := newBloomFilter(1000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mem := atomic.LoadInt64(&gBloomFilterMemory) - used; mem != filter.Size() || mem != 11072/8 {
+		t.Fatalf("expected %v bytes of bloom filters, got %v", filter.Size(), mem)
+	}
+
+	if _, err := newBloomFilter(1000, 0.01); err != errBloomFilterMemory {
+		t.Fatalf("expected %v, got %v", errBloomFilterMemory, err)
+	}
+
+	// the filter cannot grow, and matches everything from then on
+	filter.SetReady()
+	for i := 0; i < 1000; i++ {
+		filter.Add([]byte(fmt.Sprintf("key-%v", i)))
+	}
+	if !filter.IsStopped() || filter.IsReady() {
+		t.Fatal("expected the filter to be stopped")
+	}
+	if !filter.MayContain([]byte("missing")) {
+		t.Fatal("expected a stopped filter to match")
+	}
+
+	filter.Free()
+	filter.Free()
+	if mem := atomic.LoadInt64(&gBloomFilterMemory); mem != used {
+		t.Fatalf("expected %v bytes of bloom filters after free, got %v", used, mem)
+	}
+	filter.Add([]byte("key"))
+}
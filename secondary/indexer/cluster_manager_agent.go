@@ -461,6 +461,13 @@ func (c *clustMgrAgent) handleGetGlobalTopology(cmd Message) {
 				RealInstId:     common.IndexInstId(inst.RealInstId),
 			}
 
+			// index instance can have a different storage mode than the index
+			// definition, during and after storage migration of the index.
+			if mode := common.IndexTypeToStorageMode(common.IndexType(inst.StorageMode)); mode != common.NOT_SET &&
+				mode != common.IndexTypeToStorageMode(idxInst.Defn.Using) {
+				idxInst.Defn.Using = common.StorageModeToIndexType(mode)
+			}
+
 			if idxInst.State != common.INDEX_STATE_DELETED {
 				exist1, err := mc.DeleteCommandTokenExist(idxDefn.DefnId)
 				if err != nil {
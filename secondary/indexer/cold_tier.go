@@ -0,0 +1,657 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+const coldTierManifestFile = "cold_tier.json"
+const coldTierTmpDir = ".cold_tier"
+const coldTierDownloadConcurrency = 4
+
+//
+// coldTierPartition is an index partition whose disk snapshots are in the
+// cold tier.  Resumed is set once the partition writes disk snapshots
+// locally again, and Hydrated once it has a local disk snapshot; its
+// objects are removed then.
+//
+type coldTierPartition struct {
+	InstId    common.IndexInstId `json:"instId"`
+	PartnId   common.PartitionId `json:"partnId"`
+	Key       string             `json:"key"`
+	Files     []string           `json:"files"`
+	Size      int64              `json:"size"`
+	Offloaded int64              `json:"offloaded"`
+	Resumed   bool               `json:"resumed,omitempty"`
+	Hydrated  bool               `json:"hydrated,omitempty"`
+}
+
+//
+// coldTierDownload is the download of the objects of an offloaded
+// partition, started when the indexer starts so that warmup does not wait
+// for the whole download.
+//
+type coldTierDownload struct {
+	dir  string
+	done chan bool
+	err  error
+}
+
+//
+// coldTier moves the disk snapshots of rarely scanned index partitions to
+// S3-compatible object storage, to reduce the local disk usage.  A
+// partition is offloaded when it has not been scanned for
+// settings.cold_tier.idle_period and its disk size is at least
+// settings.cold_tier.min_disk_size.  Local snapshots are resumed when the
+// index is scanned again, and every settings.cold_tier.refresh_period, so
+// that the snapshot in the cold tier is offloaded again before it is too
+// old to recover the index without rollback to 0.
+//
+// The snapshots are hydrated on demand: on warmup to recover the index,
+// and before a rollback of the index.  The objects are downloaded in the
+// background from the start of the indexer, and warmup waits for them at
+// most settings.cold_tier.hydrate_timeout.  Only the slices implementing
+// ColdTierSlice can be offloaded.  That is memory optimized indexes only:
+// plasma keeps its log structured store on local disk, and the cold tier
+// cannot be enabled with any other storage mode.
+//
+// The offloaded partitions are recorded in cold_tier.json in storage_dir.
+//
+type coldTier struct {
+	lock       sync.Mutex
+	config     common.Config
+	storageDir string
+	started    int64
+	partitions map[string]*coldTierPartition
+	downloads  map[string]*coldTierDownload
+
+	running    int32
+	offloads   int64
+	hydrations int64
+	failures   int64
+}
+
+func newColdTier(config common.Config) *coldTier {
+
+	t := &coldTier{
+		config:     config.Clone(),
+		storageDir: config["storage_dir"].String(),
+		started:    time.Now().UnixNano(),
+		partitions: make(map[string]*coldTierPartition),
+		downloads:  make(map[string]*coldTierDownload),
+	}
+
+	if err := t.load(); err != nil {
+		logging.Errorf("ColdTier: Fail to read %v.  Error = %v", coldTierManifestFile, err)
+	}
+	t.startDownloads()
+
+	common.WatchConfig([]string{"indexer.settings.cold_tier.", "indexer.cold_tier."}, t.onConfigChange)
+	return t
+}
+
+func (t *coldTier) onConfigChange(key string, oldValue, newValue common.ConfigValue) {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	config := t.config.Clone()
+	config[strings.TrimPrefix(key, "indexer.")] = newValue
+	t.config = config
+}
+
+func (t *coldTier) getConfig() common.Config {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.config
+}
+
+func (t *coldTier) interval() time.Duration {
+
+	interval := t.getConfig()["settings.cold_tier.interval"].Uint64()
+	if interval == 0 {
+		interval = 1
+	}
+	return time.Duration(interval) * time.Second
+}
+
+func (t *coldTier) objectStore(config common.Config) (*objectStore, error) {
+	return newObjectStore(config["settings.cold_tier.endpoint"].String(),
+		config["settings.cold_tier.bucket"].String(),
+		config["settings.cold_tier.region"].String(),
+		config["cold_tier.access_key_id"].String(),
+		config["cold_tier.secret_access_key"].String(),
+		int64(config["cold_tier.part_size"].Uint64()),
+		time.Duration(config["cold_tier.request_timeout"].Uint64())*time.Second)
+}
+
+func coldTierPartitionKey(instId common.IndexInstId, partnId common.PartitionId) string {
+	return fmt.Sprintf("%v/%v", instId, partnId)
+}
+
+func (t *coldTier) load() error {
+
+	bs, err := ioutil.ReadFile(filepath.Join(t.storageDir, coldTierManifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return json.Unmarshal(bs, &t.partitions)
+}
+
+// save must be called with t.lock held
+func (t *coldTier) save() error {
+
+	bs, err := json.MarshalIndent(t.partitions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(t.storageDir, coldTierManifestFile)
+	if err := ioutil.WriteFile(path+".tmp", bs, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (t *coldTier) getPartition(instId common.IndexInstId, partnId common.PartitionId) (coldTierPartition, bool) {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if p, ok := t.partitions[coldTierPartitionKey(instId, partnId)]; ok {
+		return *p, true
+	}
+	return coldTierPartition{}, false
+}
+
+func (t *coldTier) setPartition(p *coldTierPartition) {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.partitions[coldTierPartitionKey(p.InstId, p.PartnId)] = p
+	if err := t.save(); err != nil {
+		logging.Errorf("ColdTier: Fail to write %v.  Error = %v", coldTierManifestFile, err)
+	}
+}
+
+func (t *coldTier) deletePartition(p *coldTierPartition) {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.partitions, coldTierPartitionKey(p.InstId, p.PartnId))
+	if err := t.save(); err != nil {
+		logging.Errorf("ColdTier: Fail to write %v.  Error = %v", coldTierManifestFile, err)
+	}
+}
+
+func (t *coldTier) getPartitions() []coldTierPartition {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	result := make([]coldTierPartition, 0, len(t.partitions))
+	for _, p := range t.partitions {
+		result = append(result, *p)
+	}
+	return result
+}
+
+//
+// run offloads the cold partitions, resumes local snapshots of offloaded
+// partitions which are scanned, and removes the objects which are no
+// longer needed.  The maps are copies owned by run.
+//
+func (t *coldTier) run(indexInstMap common.IndexInstMap, indexPartnMap IndexPartnMap, stats *IndexerStats) {
+
+	if !atomic.CompareAndSwapInt32(&t.running, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&t.running, 0)
+
+	config := t.getConfig()
+
+	store, err := t.objectStore(config)
+	if err != nil {
+		logging.Errorf("ColdTier::run Invalid object storage.  Error = %v", err)
+		return
+	}
+
+	idlePeriod := int64(config["settings.cold_tier.idle_period"].Uint64()) * int64(time.Second)
+	refreshPeriod := int64(config["settings.cold_tier.refresh_period"].Uint64()) * int64(time.Second)
+	minDiskSize := int64(config["settings.cold_tier.min_disk_size"].Uint64())
+	now := time.Now().UnixNano()
+
+	for _, p := range t.getPartitions() {
+		p := p
+		inst, ok := indexInstMap[p.InstId]
+		partnInst, ok2 := indexPartnMap[p.InstId][p.PartnId]
+		if !ok || !ok2 || inst.State == common.INDEX_STATE_DELETED {
+			t.remove(store, &p)
+			continue
+		}
+
+		if !p.Resumed {
+			ps := stats.GetPartitionStats(p.InstId, p.PartnId)
+			scanned := ps != nil && ps.lastScanTime.Value() > p.Offloaded
+			if !scanned && now-p.Offloaded < refreshPeriod {
+				continue
+			}
+
+			if scanned {
+				logging.Infof("ColdTier::run Index %v partition %v is scanned.  Resume local disk snapshots.",
+					p.InstId, p.PartnId)
+				atomic.AddInt64(&t.hydrations, 1)
+			} else {
+				logging.Infof("ColdTier::run Index %v partition %v is offloaded since %v.  Resume local "+
+					"disk snapshots to refresh it.", p.InstId, p.PartnId, time.Unix(0, p.Offloaded))
+			}
+
+			for _, slice := range partnInst.Sc.GetAllSlices() {
+				if cs, ok := slice.(ColdTierSlice); ok {
+					cs.SetOffloaded(false)
+				}
+			}
+			p.Resumed = true
+			t.setPartition(&p)
+		}
+
+		// The objects are kept until there is a local snapshot to recover
+		// the index from.  An idle partition is offloaded again with it.
+		if hasLocalSnapshot(partnInst) {
+			t.remove(store, &p)
+		}
+	}
+
+	for instId, partnMap := range indexPartnMap {
+		inst, ok := indexInstMap[instId]
+		if !ok || inst.State != common.INDEX_STATE_ACTIVE || inst.RState != common.REBAL_ACTIVE {
+			continue
+		}
+
+		for partnId, partnInst := range partnMap {
+			if _, ok := t.getPartition(instId, partnId); ok {
+				continue
+			}
+
+			ps := stats.GetPartitionStats(instId, partnId)
+			if ps == nil || ps.diskSize.Value() < minDiskSize {
+				continue
+			}
+
+			lastScan := ps.lastScanTime.Value()
+			if lastScan < t.started {
+				lastScan = t.started
+			}
+			if now-lastScan < idlePeriod {
+				continue
+			}
+
+			if err := t.offload(store, config, &inst, partnInst); err != nil {
+				logging.Errorf("ColdTier::run Fail to offload index %v partition %v.  Error = %v",
+					instId, partnId, err)
+				atomic.AddInt64(&t.failures, 1)
+			}
+		}
+	}
+
+	t.updateStats(stats)
+}
+
+func hasLocalSnapshot(partnInst PartitionInst) bool {
+
+	for _, slice := range partnInst.Sc.GetAllSlices() {
+		infos, err := slice.GetSnapshots()
+		if err != nil || len(infos) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// offload copies the latest disk snapshot of each slice of the partition
+// to the object storage, and then removes the local disk snapshots.
+//
+func (t *coldTier) offload(store *objectStore, config common.Config, inst *common.IndexInst, partnInst PartitionInst) error {
+
+	partnId := partnInst.Defn.GetPartitionId()
+
+	var slices []ColdTierSlice
+	for _, slice := range partnInst.Sc.GetAllSlices() {
+		cs, ok := slice.(ColdTierSlice)
+		if !ok {
+			return nil
+		}
+		slices = append(slices, cs)
+	}
+
+	tmpdir := filepath.Join(t.storageDir, coldTierTmpDir, fmt.Sprintf("%v_%v", inst.InstId, partnId))
+	os.RemoveAll(tmpdir)
+	defer os.RemoveAll(tmpdir)
+
+	for _, slice := range partnInst.Sc.GetAllSlices() {
+		sliceDir := filepath.Join(tmpdir, fmt.Sprintf("slice_%v", slice.Id()))
+		if _, err := slice.(ColdTierSlice).ExportSnapshot(sliceDir); err != nil {
+			return err
+		}
+	}
+
+	p := &coldTierPartition{
+		InstId:    inst.InstId,
+		PartnId:   partnId,
+		Key:       fmt.Sprintf("%v/%v/%v", config["settings.cold_tier.prefix"].String(), inst.InstId, partnId),
+		Offloaded: time.Now().UnixNano(),
+	}
+
+	err := filepath.Walk(tmpdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(tmpdir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if err := store.Put(p.Key+"/"+rel, path); err != nil {
+			return err
+		}
+		p.Files = append(p.Files, rel)
+		p.Size += info.Size()
+		return nil
+	})
+	if err != nil {
+		t.deleteObjects(store, p)
+		return err
+	}
+
+	// record the partition before removing the local snapshots, so that
+	// it is hydrated on warmup
+	t.setPartition(p)
+
+	for _, slice := range slices {
+		if err := slice.SetOffloaded(true); err != nil {
+			for _, slice := range slices {
+				slice.SetOffloaded(false)
+			}
+			t.deletePartition(p)
+			t.deleteObjects(store, p)
+			return err
+		}
+	}
+
+	atomic.AddInt64(&t.offloads, 1)
+
+	logging.Infof("ColdTier::offload Offloaded index %v (%v) partition %v: %v bytes in %v files to %v",
+		inst.InstId, inst.Defn.Name, partnId, p.Size, len(p.Files), p.Key)
+
+	return nil
+}
+
+//
+// startDownloads starts the download of the objects of the partitions
+// which are offloaded, to hydrate them on warmup.
+//
+func (t *coldTier) startDownloads() {
+
+	var partitions []coldTierPartition
+	for _, p := range t.getPartitions() {
+		if !p.Hydrated {
+			partitions = append(partitions, p)
+		}
+	}
+	if len(partitions) == 0 {
+		return
+	}
+
+	store, err := t.objectStore(t.getConfig())
+	if err != nil {
+		logging.Errorf("ColdTier::startDownloads Invalid object storage.  Error = %v", err)
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	sem := make(chan bool, coldTierDownloadConcurrency)
+	for _, p := range partitions {
+		p := p
+		d := &coldTierDownload{
+			dir:  t.downloadDir(p.InstId, p.PartnId),
+			done: make(chan bool),
+		}
+		t.downloads[coldTierPartitionKey(p.InstId, p.PartnId)] = d
+
+		go func() {
+			sem <- true
+			defer func() { <-sem }()
+			defer close(d.done)
+
+			d.err = t.download(store, &p, d.dir)
+		}()
+	}
+}
+
+func (t *coldTier) downloadDir(instId common.IndexInstId, partnId common.PartitionId) string {
+	return filepath.Join(t.storageDir, coldTierTmpDir, fmt.Sprintf("%v_%v.download", instId, partnId))
+}
+
+func (t *coldTier) takeDownload(instId common.IndexInstId, partnId common.PartitionId) *coldTierDownload {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := coldTierPartitionKey(instId, partnId)
+	d := t.downloads[key]
+	delete(t.downloads, key)
+	return d
+}
+
+//
+// hydrate adds the disk snapshots of the offloaded partitions of inst to
+// the slices, which are recovered from them.  It is called on warmup,
+// before the index is recovered, and waits for the download of the
+// objects until settings.cold_tier.hydrate_timeout after the start of the
+// indexer.  A partition which is not hydrated is rebuilt.
+//
+func (t *coldTier) hydrate(inst common.IndexInst, partnInstMap PartitionInstMap) {
+
+	timeout := time.Duration(t.getConfig()["settings.cold_tier.hydrate_timeout"].Uint64()) * time.Second
+	deadline := time.Unix(0, t.started).Add(timeout)
+
+	for partnId, partnInst := range partnInstMap {
+		p, ok := t.getPartition(inst.InstId, partnId)
+		if !ok || p.Hydrated {
+			continue
+		}
+
+		// local snapshots were resumed before the restart
+		if p.Resumed && hasLocalSnapshot(partnInst) {
+			if d := t.takeDownload(inst.InstId, partnId); d != nil {
+				go func() {
+					<-d.done
+					os.RemoveAll(d.dir)
+				}()
+			}
+			p.Hydrated = true
+			t.setPartition(&p)
+			continue
+		}
+
+		var err error
+		d := t.takeDownload(inst.InstId, partnId)
+		if d == nil {
+			err = fmt.Errorf("Objects are not downloaded")
+		} else {
+			select {
+			case <-d.done:
+				err = d.err
+				if err == nil {
+					err = t.restore(d.dir, partnInst)
+				}
+				os.RemoveAll(d.dir)
+
+			case <-time.After(time.Until(deadline)):
+				err = fmt.Errorf("Download is not done after %v", timeout)
+				go func() {
+					<-d.done
+					os.RemoveAll(d.dir)
+				}()
+			}
+		}
+
+		if err != nil {
+			logging.Errorf("ColdTier::hydrate Fail to hydrate index %v partition %v.  Index will be rebuilt."+
+				"  Error = %v", inst.InstId, partnId, err)
+			atomic.AddInt64(&t.failures, 1)
+		} else {
+			logging.Infof("ColdTier::hydrate Hydrated index %v partition %v: %v bytes in %v files from %v",
+				inst.InstId, partnId, p.Size, len(p.Files), p.Key)
+			atomic.AddInt64(&t.hydrations, 1)
+		}
+
+		// The slice writes disk snapshots locally from now on.  The objects
+		// are removed once there is a local snapshot.
+		p.Resumed = true
+		p.Hydrated = true
+		t.setPartition(&p)
+	}
+}
+
+//
+// hydrateOnDemand adds the disk snapshot of an offloaded partition to its
+// slices, so that the index can be rolled back to it.
+//
+func (t *coldTier) hydrateOnDemand(instId common.IndexInstId, partnId common.PartitionId,
+	partnInst PartitionInst) {
+
+	p, ok := t.getPartition(instId, partnId)
+	if !ok || p.Hydrated || (p.Resumed && hasLocalSnapshot(partnInst)) {
+		return
+	}
+
+	store, err := t.objectStore(t.getConfig())
+	if err == nil {
+		dir := t.downloadDir(instId, partnId) + ".ondemand"
+		err = t.download(store, &p, dir)
+		if err == nil {
+			err = t.restore(dir, partnInst)
+		}
+		os.RemoveAll(dir)
+	}
+
+	if err != nil {
+		logging.Errorf("ColdTier::hydrateOnDemand Fail to hydrate index %v partition %v.  Error = %v",
+			instId, partnId, err)
+		atomic.AddInt64(&t.failures, 1)
+		return
+	}
+
+	logging.Infof("ColdTier::hydrateOnDemand Hydrated index %v partition %v: %v bytes in %v files from %v",
+		instId, partnId, p.Size, len(p.Files), p.Key)
+	atomic.AddInt64(&t.hydrations, 1)
+
+	p.Resumed = true
+	p.Hydrated = true
+	t.setPartition(&p)
+}
+
+func (t *coldTier) download(store *objectStore, p *coldTierPartition, dir string) error {
+
+	os.RemoveAll(dir)
+
+	for _, file := range p.Files {
+		if err := store.Get(p.Key+"/"+file, filepath.Join(dir, filepath.FromSlash(file))); err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *coldTier) restore(dir string, partnInst PartitionInst) error {
+
+	for _, slice := range partnInst.Sc.GetAllSlices() {
+		cs, ok := slice.(ColdTierSlice)
+		if !ok {
+			return fmt.Errorf("Cold tier is not supported by slice %v", slice.Id())
+		}
+
+		sliceDir := filepath.Join(dir, fmt.Sprintf("slice_%v", slice.Id()))
+		if err := cs.RestoreSnapshot(sliceDir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *coldTier) remove(store *objectStore, p *coldTierPartition) {
+
+	if err := t.deleteObjects(store, p); err != nil {
+		logging.Errorf("ColdTier::remove Fail to remove objects of index %v partition %v.  Error = %v",
+			p.InstId, p.PartnId, err)
+		return
+	}
+	t.deletePartition(p)
+
+	logging.Infof("ColdTier::remove Removed index %v partition %v from %v", p.InstId, p.PartnId, p.Key)
+}
+
+func (t *coldTier) deleteObjects(store *objectStore, p *coldTierPartition) error {
+
+	for _, file := range p.Files {
+		if err := store.Delete(p.Key + "/" + file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *coldTier) updateStats(stats *IndexerStats) {
+
+	var partitions, bytes int64
+	for _, p := range t.getPartitions() {
+		if !p.Hydrated {
+			partitions++
+			bytes += p.Size
+		}
+	}
+
+	stats.coldTierOffloadedPartitions.Set(partitions)
+	stats.coldTierOffloadedBytes.Set(bytes)
+	stats.coldTierOffloads.Set(atomic.LoadInt64(&t.offloads))
+	stats.coldTierHydrations.Set(atomic.LoadInt64(&t.hydrations))
+	stats.coldTierFailures.Set(atomic.LoadInt64(&t.failures))
+}
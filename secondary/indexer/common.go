@@ -123,6 +123,93 @@ func (m MutationSnapshot) CanProcess() bool {
 	return false
 }
 
+// Represents a disk or in-memory snapshot of an index partition
+type SnapshotListEntry struct {
+	Type      string   `json:"type"`
+	Committed bool     `json:"committed"`
+	SnapType  string   `json:"snapType"`
+	Seqnos    []uint64 `json:"seqnos"`
+	Vbuuids   []uint64 `json:"vbuuids"`
+	Size      int64    `json:"size,omitempty"`
+	Items     uint64   `json:"items,omitempty"`
+}
+
+// Represents the snapshots available for a partition of an index instance
+type PartitionSnapshotList struct {
+	InstId     common.IndexInstId  `json:"instId"`
+	PartnId    common.PartitionId  `json:"partitionId"`
+	Name       string              `json:"name"`
+	Bucket     string              `json:"bucket"`
+	Scope      string              `json:"scope"`
+	Collection string              `json:"collection"`
+	Snapshots  []SnapshotListEntry `json:"snapshots"`
+}
+
+// Disk usage of a slice, or aggregated over the slices of a partition, an
+// index or a node.  CompactionDebt is the disk space which compaction can
+// reclaim (the disk space not used by data).
+type DiskUsage struct {
+	DiskSize       int64   `json:"diskSize"`
+	DataSize       int64   `json:"dataSize"`
+	Fragmentation  float64 `json:"fragmentation"`
+	CompactionDebt int64   `json:"compactionDebt"`
+}
+
+func (u *DiskUsage) add(o DiskUsage) {
+	u.DiskSize += o.DiskSize
+	u.DataSize += o.DataSize
+	u.CompactionDebt += o.CompactionDebt
+	u.computeFragmentation()
+}
+
+func (u *DiskUsage) computeFragmentation() {
+	u.Fragmentation = 0
+	if u.DiskSize > 0 {
+		u.Fragmentation = float64(u.CompactionDebt) * 100 / float64(u.DiskSize)
+	}
+}
+
+type SliceDiskUsage struct {
+	DiskUsage
+	SliceId SliceId          `json:"sliceId"`
+	Path    string           `json:"path"`
+	Files   map[string]int64 `json:"files"`
+}
+
+type PartitionDiskUsage struct {
+	DiskUsage
+	PartnId common.PartitionId `json:"partitionId"`
+	Slices  []SliceDiskUsage   `json:"slices"`
+}
+
+type IndexDiskUsage struct {
+	DiskUsage
+	InstId     common.IndexInstId   `json:"instId"`
+	Name       string               `json:"name"`
+	Bucket     string               `json:"bucket"`
+	Scope      string               `json:"scope"`
+	Collection string               `json:"collection"`
+	Partitions []PartitionDiskUsage `json:"partitions"`
+}
+
+type NodeDiskUsage struct {
+	DiskUsage
+	Indexes []IndexDiskUsage `json:"indexes"`
+}
+
+// Describes a disk snapshot of an index partition exported to a directory
+type snapshotExportManifest struct {
+	InstId      common.IndexInstId `json:"instId"`
+	PartnId     common.PartitionId `json:"partitionId"`
+	Bucket      string             `json:"bucket"`
+	Scope       string             `json:"scope"`
+	Collection  string             `json:"collection"`
+	Name        string             `json:"name"`
+	StorageMode string             `json:"storageMode"`
+	Seqnos      []uint64           `json:"seqnos"`
+	Vbuuids     []uint64           `json:"vbuuids"`
+}
+
 // Represents storage stats for an index instance
 type IndexStorageStats struct {
 	InstId     common.IndexInstId
@@ -10,6 +10,7 @@
 package indexer
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"sort"
@@ -49,6 +50,10 @@ type compactionDaemon struct {
 	clusterAddr  string
 	lastCheckDay int32
 	mutex        sync.Mutex
+
+	// disk throughput budget (in bytes) for starting new compactions
+	budget     int64
+	lastRefill time.Time
 }
 
 type indexCompaction struct {
@@ -124,11 +129,12 @@ loop:
 		case _, ok := <-cd.timer.C:
 
 			if stats := cd.stats.Get(); stats != nil && stats.indexerState.Value() != int64(common.INDEXER_BOOTSTRAP) {
-				if common.GetStorageMode() == common.FORESTDB {
+				if cd.hasStorageMode(common.FORESTDB) {
 					if ok {
 						hasStartedToday = cd.compactFDB(hasStartedToday)
 					}
-				} else if common.GetStorageMode() == common.PLASMA {
+				}
+				if cd.hasStorageMode(common.PLASMA) {
 					if ok {
 						cd.compactPlasma()
 					}
@@ -306,9 +312,32 @@ func (cd *compactionDaemon) compactFDB(hasStartedToday bool) bool {
 	}
 
 	for _, is := range stats {
+		if !cd.isStorageMode(is.InstId, common.FORESTDB) {
+			continue
+		}
+
 		conf = cd.config.Load() // refresh to get up-to-date settings
 		needUpgrade := is.Stats.NeedUpgrade
 		if needUpgrade || cd.needsCompaction(is, conf, checkTime, abortTime) {
+
+			// compaction for upgrade is also subject to the parallelism and
+			// throughput limits, so it does not collide with scans.
+			cd.mutex.Lock()
+			ok := !cd.isIndexCompactingNoLock(is.InstId, is.PartnId) &&
+				cd.canScheduleNoLock(is.InstId, is.PartnId, is.Stats.DiskSize, cd.numRunningNoLock()) &&
+				cd.addIndexCompactionNoLock(is.InstId, is.PartnId, nil)
+			cd.mutex.Unlock()
+			if !ok {
+				continue
+			}
+
+			name := indexCompactionName(is.InstId, is.PartnId)
+			if !gCompactionLocks.tryLock(name) {
+				logging.Infof("CompactionDaemon: Skip index instance:%v. It is being compacted on demand", is.InstId)
+				cd.removeIndexCompaction(is.InstId, is.PartnId)
+				continue
+			}
+
 			hasStartedToday = true
 
 			errch := make(chan error)
@@ -322,8 +351,13 @@ func (cd *compactionDaemon) compactFDB(hasStartedToday bool) bool {
 			if needUpgrade {
 				common.Console(cd.clusterAddr, "Compacting index %v.%v for upgrade", is.Bucket, is.Name)
 			}
-			cd.msgch <- compactReq
-			err := <-errch
+			var err error
+			gMaintenance.run(MAINT_COMPACTION, name, func() {
+				cd.msgch <- compactReq
+				err = <-errch
+			})
+			gCompactionLocks.unlock(name)
+			cd.removeIndexCompaction(is.InstId, is.PartnId)
 			if err == nil {
 				logging.Infof("CompactionDaemon: Finished compacting index instance:%v", is.InstId)
 				if needUpgrade {
@@ -402,6 +436,10 @@ func (cd *compactionDaemon) addMandatory() []*MsgIndexCompact {
 	stats := cd.stats.Get()
 
 	for _, inst := range cd.indexInstMap {
+		if common.IndexTypeToStorageMode(inst.Defn.Using) != common.PLASMA {
+			continue
+		}
+
 		for _, partn := range inst.Pc.GetAllPartitions() {
 			partnStats := stats.GetPartitionStats(inst.InstId, partn.GetPartitionId())
 
@@ -411,6 +449,11 @@ func (cd *compactionDaemon) addMandatory() []*MsgIndexCompact {
 				partnStats.fragPercent.Value() > int64(threshold) &&
 				partnStats.diskSize.Value() > PLASMA_CLEANER_MIN_SIZE {
 
+				if cd.isIndexCompactingNoLock(inst.InstId, partn.GetPartitionId()) ||
+					!cd.canScheduleNoLock(inst.InstId, partn.GetPartitionId(), partnStats.diskSize.Value(), cd.numRunningNoLock()) {
+					continue
+				}
+
 				// if index is not running compaction, add it now.
 				if cd.addIndexCompactionNoLock(inst.InstId, partn.GetPartitionId(), partnStats) {
 					logging.Infof("CompactionDaemon: mandatory compaction: inst %v partition %v fragmentation %v over threshod %v.",
@@ -479,6 +522,11 @@ func (cd *compactionDaemon) addOptional() []*MsgIndexCompact {
 	sorted := make(compactionHistory, 0, len(cd.history))
 
 	for _, hist := range cd.history {
+		if inst, ok := cd.indexInstMap[hist.instId]; !ok ||
+			common.IndexTypeToStorageMode(inst.Defn.Using) != common.PLASMA {
+			continue
+		}
+
 		partnStats := stats.GetPartitionStats(hist.instId, hist.partitionId)
 
 		if partnStats != nil &&
@@ -507,6 +555,10 @@ func (cd *compactionDaemon) addOptional() []*MsgIndexCompact {
 	//
 	for _, hist := range sorted {
 		partnStats := stats.GetPartitionStats(hist.instId, hist.partitionId)
+		if !cd.canScheduleNoLock(hist.instId, hist.partitionId, partnStats.diskSize.Value(), cd.numRunningNoLock()) {
+			continue
+		}
+
 		if cd.addIndexCompactionNoLock(hist.instId, hist.partitionId, partnStats) {
 
 			// The target fragmentation is lower of
@@ -527,6 +579,146 @@ func (cd *compactionDaemon) addOptional() []*MsgIndexCompact {
 	return compactMsgs
 }
 
+//
+// canScheduleNoLock checks if compaction of the index partition can start now, based on
+// 1) the compaction schedule of the index or its keyspace
+// 2) the number of compactions already running (running)
+// 3) the disk throughput cap.   Compaction is allowed to start as long as there is
+//    budget left, and the size of the partition is then charged against the budget.
+//
+// Compaction that cannot start is deferred to the next check, and is counted in
+// the stats of the index partition.
+//
+func (cd *compactionDaemon) canScheduleNoLock(instId common.IndexInstId, partnId common.PartitionId,
+	size int64, running int) bool {
+
+	config := cd.config.Load()
+
+	deferred := func(reason string) bool {
+		logging.Verbosef("CompactionDaemon: compaction deferred for inst %v partition %v: %v", instId, partnId, reason)
+		if stats := cd.stats.Get(); stats != nil {
+			if partnStats := stats.GetPartitionStats(instId, partnId); partnStats != nil {
+				partnStats.numCompactionsDeferred.Add(1)
+			}
+		}
+		return false
+	}
+
+	if inst, ok := cd.indexInstMap[instId]; ok {
+		schedule := parseCompactionSchedule(config["schedule"].String())
+		if window, ok := findCompactionWindow(schedule, &inst.Defn); ok && !window.contains(time.Now()) {
+			return deferred(fmt.Sprintf("outside of compaction schedule %v", window))
+		}
+	}
+
+	if maxParallel := config["max_parallel"].Int(); maxParallel > 0 && running >= maxParallel {
+		return deferred(fmt.Sprintf("%v compactions running", running))
+	}
+
+	if limit := int64(config["throughput_cap"].Int()) * 1024 * 1024; limit > 0 {
+		now := time.Now()
+		if !cd.lastRefill.IsZero() {
+			burst := limit * int64(config["check_period"].Int())
+			cd.budget += int64(now.Sub(cd.lastRefill).Seconds() * float64(limit))
+			if cd.budget > burst {
+				cd.budget = burst
+			}
+		}
+		cd.lastRefill = now
+
+		if cd.budget < 0 {
+			return deferred("disk throughput cap reached")
+		}
+		cd.budget -= size
+	}
+
+	return true
+}
+
+type compactionWindow struct {
+	start int // minutes since midnight
+	end   int // minutes since midnight
+}
+
+func (w compactionWindow) contains(t time.Time) bool {
+
+	hr, min, _ := t.Clock()
+	now := hr*60 + min
+
+	if w.start == w.end {
+		return true
+	}
+	if w.start < w.end {
+		return now >= w.start && now < w.end
+	}
+	// window spans midnight
+	return now >= w.start || now < w.end
+}
+
+func (w compactionWindow) String() string {
+	return fmt.Sprintf("%02d:%02d,%02d:%02d", w.start/60, w.start%60, w.end/60, w.end%60)
+}
+
+//
+// parseCompactionSchedule parses the compaction schedule setting of the form
+// <bucket>[:<scope>:<collection>[:<index>]]=HH:MM,HH:MM;...
+// Invalid entries are logged and ignored.
+//
+func parseCompactionSchedule(schedule string) map[string]compactionWindow {
+
+	result := make(map[string]compactionWindow)
+
+	for _, entry := range strings.Split(schedule, ";") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			logging.Errorf("CompactionDaemon: Invalid compaction schedule %v", entry)
+			continue
+		}
+
+		var start_hr, start_min, end_hr, end_min int
+		n, err := fmt.Sscanf(strings.TrimSpace(kv[1]), "%d:%d,%d:%d", &start_hr, &start_min, &end_hr, &end_min)
+		if n != 4 || err != nil ||
+			start_hr < 0 || start_hr > 23 || end_hr < 0 || end_hr > 23 ||
+			start_min < 0 || start_min > 59 || end_min < 0 || end_min > 59 {
+			logging.Errorf("CompactionDaemon: Invalid compaction schedule %v", entry)
+			continue
+		}
+
+		result[strings.TrimSpace(kv[0])] = compactionWindow{
+			start: start_hr*60 + start_min,
+			end:   end_hr*60 + end_min,
+		}
+	}
+
+	return result
+}
+
+//
+// findCompactionWindow returns the most specific compaction window that applies
+// to the index: index, then collection, then bucket.
+//
+func findCompactionWindow(schedule map[string]compactionWindow, defn *common.IndexDefn) (compactionWindow, bool) {
+
+	keys := []string{
+		strings.Join([]string{defn.Bucket, defn.Scope, defn.Collection, defn.Name}, ":"),
+		strings.Join([]string{defn.Bucket, defn.Scope, defn.Collection}, ":"),
+		defn.Bucket,
+	}
+
+	for _, key := range keys {
+		if window, ok := schedule[key]; ok {
+			return window, true
+		}
+	}
+
+	return compactionWindow{}, false
+}
+
 func (cd *compactionDaemon) runCompaction(compactReq *MsgIndexCompact) {
 
 	logging.Infof("CompactionDaemon: run compaction for inst %v partition %v.",
@@ -534,8 +726,17 @@ func (cd *compactionDaemon) runCompaction(compactReq *MsgIndexCompact) {
 
 	cd.updateCompactionStartTime(compactReq.GetInstId(), compactReq.GetPartitionId(), time.Now().UnixNano())
 
-	cd.msgch <- compactReq
-	err := <-compactReq.GetErrorChannel()
+	var err error
+	key := indexCompactionName(compactReq.GetInstId(), compactReq.GetPartitionId())
+	if gCompactionLocks.tryLock(key) {
+		gMaintenance.run(MAINT_COMPACTION, key, func() {
+			cd.msgch <- compactReq
+			err = <-compactReq.GetErrorChannel()
+		})
+		gCompactionLocks.unlock(key)
+	} else {
+		err = errors.New("Partition is being compacted on demand")
+	}
 
 	if err != nil {
 		logging.Errorf("CompactionDaemon: Fail to run compaction for inst %v partition %v. Error=%v",
@@ -586,6 +787,37 @@ func (cd *compactionDaemon) updateIndexInstMap(indexInstMap common.IndexInstMap)
 	cd.history = history
 }
 
+//
+// hasStorageMode returns true if the storage mode of the indexer, or of
+// any index, is mode.  An index migrated to its own storage mode is
+// compacted as per its storage mode.
+//
+func (cd *compactionDaemon) hasStorageMode(mode common.StorageMode) bool {
+	if common.GetStorageMode() == mode {
+		return true
+	}
+
+	cd.mutex.Lock()
+	defer cd.mutex.Unlock()
+
+	for _, inst := range cd.indexInstMap {
+		if common.IndexTypeToStorageMode(inst.Defn.Using) == mode {
+			return true
+		}
+	}
+	return false
+}
+
+func (cd *compactionDaemon) isStorageMode(instId common.IndexInstId, mode common.StorageMode) bool {
+	cd.mutex.Lock()
+	defer cd.mutex.Unlock()
+
+	if inst, ok := cd.indexInstMap[instId]; ok {
+		return common.IndexTypeToStorageMode(inst.Defn.Using) == mode
+	}
+	return common.GetStorageMode() == mode
+}
+
 func (cd *compactionDaemon) numInstancesNoLock() int {
 
 	count := 0
@@ -627,6 +859,14 @@ func (cd *compactionDaemon) numCompactionsNoLock() int {
 	return len(cd.compactions)
 }
 
+//
+// numRunningNoLock returns the number of compactions running, including the
+// ones requested on demand, for compaction.max_parallel.
+//
+func (cd *compactionDaemon) numRunningNoLock() int {
+	return cd.numCompactionsNoLock() + gOnDemandCompactor.numActive()
+}
+
 func (cd *compactionDaemon) updateCompactionStartTime(instId common.IndexInstId, partitionId common.PartitionId, startTime int64) {
 	cd.mutex.Lock()
 	defer cd.mutex.Unlock()
@@ -716,14 +956,15 @@ loop:
 					cd.ResetConfig(cfg)
 					cm.supvCmdCh <- &MsgSuccess{}
 				} else if cmd.GetMsgType() == UPDATE_INDEX_INSTANCE_MAP {
-					// Disable compaction manager processing for MOI storage
-					if common.GetStorageMode() == common.MOI {
+					// Disable compaction manager processing for MOI storage,
+					// unless an index is migrated to a different storage mode
+					indexInstMap := cmd.(*MsgUpdateInstMap).GetIndexInstMap()
+					if common.GetStorageMode() == common.MOI && !hasNonMOIIndex(indexInstMap) {
 						cm.supvCmdCh <- &MsgSuccess{}
 						continue
 					}
 
 					stats := cmd.(*MsgUpdateInstMap).GetStatsObject()
-					indexInstMap := cmd.(*MsgUpdateInstMap).GetIndexInstMap()
 					clone := common.CopyIndexInstMap(indexInstMap)
 					cm.supvCmdCh <- &MsgSuccess{}
 
@@ -740,6 +981,15 @@ loop:
 	cd.Stop()
 }
 
+func hasNonMOIIndex(indexInstMap common.IndexInstMap) bool {
+	for _, inst := range indexInstMap {
+		if mode := common.IndexTypeToStorageMode(inst.Defn.Using); mode != common.MOI && mode != common.NOT_SET {
+			return true
+		}
+	}
+	return false
+}
+
 func (cm *compactionManager) newCompactionDaemon() *compactionDaemon {
 	cfg := cm.config.SectionConfig("settings.compaction.", true)
 	clusterAddr := cm.config["clusterAddr"].String()
@@ -763,3 +1013,156 @@ func (cm *compactionManager) handleIndexMap(stats *IndexerStats, indexInstMap co
 		cd.updateIndexInstMap(indexInstMap)
 	}
 }
+
+//
+// compactionLocks serialises the compactions of a partition, which the
+// slices do not guard against.  A partition is compacted by the compaction
+// daemon, or on demand.  The daemon skips the partitions being compacted
+// on demand, while on demand compactions wait for the daemon.
+//
+type compactionLocks struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	locked map[string]bool
+}
+
+var gCompactionLocks = newCompactionLocks()
+
+func newCompactionLocks() *compactionLocks {
+	l := &compactionLocks{locked: make(map[string]bool)}
+	l.cond = sync.NewCond(&l.mutex)
+	return l
+}
+
+func (l *compactionLocks) lock(name string) {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for l.locked[name] {
+		l.cond.Wait()
+	}
+	l.locked[name] = true
+}
+
+func (l *compactionLocks) tryLock(name string) bool {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.locked[name] {
+		return false
+	}
+	l.locked[name] = true
+	return true
+}
+
+func (l *compactionLocks) unlock(name string) {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.locked, name)
+	l.cond.Broadcast()
+}
+
+//
+// onDemandCompactor runs the compactions requested with the defragment
+// endpoint, at most compaction.on_demand.max_concurrent at a time.  They
+// do not wait for the fragmentation thresholds or the compaction interval.
+// A request for a partition which is being compacted on demand is
+// rejected.
+//
+type onDemandCompactor struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	running map[string]bool
+	active  int
+}
+
+var gOnDemandCompactor = newOnDemandCompactor()
+
+func newOnDemandCompactor() *onDemandCompactor {
+	c := &onDemandCompactor{running: make(map[string]bool)}
+	c.cond = sync.NewCond(&c.mutex)
+	return c
+}
+
+//
+// reserve marks the partitions as being compacted.  It fails if one of
+// them is already being compacted.
+//
+func (c *onDemandCompactor) reserve(instId common.IndexInstId, partnIds []common.PartitionId) error {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, partnId := range partnIds {
+		if c.running[indexCompactionName(instId, partnId)] {
+			return fmt.Errorf("Compaction of index instance %v partition %v already in progress", instId, partnId)
+		}
+	}
+
+	for _, partnId := range partnIds {
+		c.running[indexCompactionName(instId, partnId)] = true
+	}
+	return nil
+}
+
+func (c *onDemandCompactor) numActive() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.active
+}
+
+//
+// compact compacts a partition reserved earlier, once there are less than
+// maxConcurrent compactions running, and the compaction daemon is not
+// compacting it.
+//
+func (c *onDemandCompactor) compact(supvMsgch MsgChannel, instId common.IndexInstId, partnId common.PartitionId,
+	minFrag int, maxConcurrent int) error {
+
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+
+	name := indexCompactionName(instId, partnId)
+	gCompactionLocks.lock(name)
+	defer gCompactionLocks.unlock(name)
+
+	c.mutex.Lock()
+	for c.active >= maxConcurrent {
+		c.cond.Wait()
+	}
+	c.active++
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		c.active--
+		delete(c.running, name)
+		c.cond.Broadcast()
+		c.mutex.Unlock()
+	}()
+
+	logging.Infof("OnDemandCompaction: Compacting index instance %v partition %v min_frag %v",
+		instId, partnId, minFrag)
+
+	// On demand compaction is not limited to the compaction interval
+	compactReq := newMsgIndexCompact(instId, partnId, minFrag)
+	compactReq.abortTime = time.Now().Add(time.Duration(math.MaxInt64))
+
+	t0 := time.Now()
+	supvMsgch <- compactReq
+	err := <-compactReq.GetErrorChannel()
+
+	if err == nil {
+		logging.Infof("OnDemandCompaction: Finished compacting index instance %v partition %v. Took %v",
+			instId, partnId, time.Since(t0))
+	} else {
+		logging.Errorf("OnDemandCompaction: Index instance %v partition %v compaction failed with reason - %v",
+			instId, partnId, err)
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+package indexer
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestCompactionLocks(t *testing.T) {
+
+	l := newCompactionLocks()
+
+	if !l.tryLock("a") {
+		t.Fatal("expected lock of a")
+	}
+	if l.tryLock("a") {
+		t.Fatal("unexpected second lock of a")
+	}
+	if !l.tryLock("b") {
+		t.Fatal("expected lock of b")
+	}
+
+	locked := make(chan bool)
+	go func() {
+		l.lock("a")
+		locked <- true
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("expected lock to wait for unlock")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	l.unlock("a")
+	<-locked
+	l.unlock("a")
+	l.unlock("b")
+}
+
+// fakeCompactionSupervisor compacts the partitions sent to supvMsgch,
+// and records the maximum number of concurrent compactions.
+func fakeCompactionSupervisor(supvMsgch MsgChannel, delay time.Duration, active, maxActive *int32) {
+
+	for msg := range supvMsgch {
+		req := msg.(*MsgIndexCompact)
+		go func() {
+			n := atomic.AddInt32(active, 1)
+			for {
+				max := atomic.LoadInt32(maxActive)
+				if n <= max || atomic.CompareAndSwapInt32(maxActive, max, n) {
+					break
+				}
+			}
+
+			time.Sleep(delay)
+			atomic.AddInt32(active, -1)
+			req.GetErrorChannel() <- nil
+		}()
+	}
+}
+
+func TestOnDemandCompactor(t *testing.T) {
+
+	c := newOnDemandCompactor()
+	instId := common.IndexInstId(1)
+	partnIds := []common.PartitionId{1, 2, 3, 4}
+
+	supvMsgch := make(MsgChannel)
+	defer close(supvMsgch)
+
+	var active, maxActive int32
+	go fakeCompactionSupervisor(supvMsgch, 50*time.Millisecond, &active, &maxActive)
+
+	if err := c.reserve(instId, partnIds); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.reserve(instId, partnIds[:1]); err == nil {
+		t.Fatal("expected partition to be reserved")
+	}
+
+	// the compaction daemon is compacting partition 1
+	name := indexCompactionName(instId, 1)
+	if !gCompactionLocks.tryLock(name) {
+		t.Fatal("expected lock of partition 1")
+	}
+
+	var wg sync.WaitGroup
+	done := make([]int32, len(partnIds))
+	for i, partnId := range partnIds {
+		wg.Add(1)
+		go func(i int, partnId common.PartitionId) {
+			defer wg.Done()
+			if err := c.compact(supvMsgch, instId, partnId, 0, 2); err != nil {
+				t.Error(err)
+			}
+			atomic.StoreInt32(&done[i], 1)
+		}(i, partnId)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if atomic.LoadInt32(&done[0]) != 0 {
+		t.Fatal("expected compaction of partition 1 to wait for the compaction daemon")
+	}
+	for i := 1; i < len(partnIds); i++ {
+		if atomic.LoadInt32(&done[i]) == 0 {
+			t.Fatalf("expected compaction of partition %v to be done", partnIds[i])
+		}
+	}
+
+	gCompactionLocks.unlock(name)
+	wg.Wait()
+
+	if max := atomic.LoadInt32(&maxActive); max != 2 {
+		t.Fatalf("expected 2 concurrent compactions, got %v", max)
+	}
+	if n := c.numActive(); n != 0 {
+		t.Fatalf("expected no active compactions, got %v", n)
+	}
+
+	// the partitions can be compacted again
+	if err := c.reserve(instId, partnIds); err != nil {
+		t.Fatal(err)
+	}
+
+	// the compaction daemon skips a partition compacted on demand
+	gCompactionLocks.lock(name)
+	if gCompactionLocks.tryLock(name) {
+		t.Fatal("unexpected lock of partition compacted on demand")
+	}
+	gCompactionLocks.unlock(name)
+}
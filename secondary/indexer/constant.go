@@ -65,6 +65,8 @@ const INDEXER_STATE_KEY = "IndexerState"
 
 const INDEXER_NODE_UUID = "IndexerNodeUUID"
 
+const INDEXER_BUILD_PAUSED_KEY = "IndexerBuildPaused"
+
 const MAX_KVWARMUP_RETRIES = 120
 
 const MAX_METAKV_RETRIES = 100
@@ -78,6 +80,7 @@ const MAX_PROJ_RETRY = 20
 // Constants for stats persistence in snapshot meta
 const SNAPSHOT_META_VERSION_MOI_1 = 1
 const SNAPSHOT_META_VERSION_PLASMA_1 = 1
+const SNAPSHOT_META_VERSION_HASH_1 = 1
 const SNAP_STATS_KEY_SIZES = "key_size_dist"
 const SNAP_STATS_ARRKEY_SIZES = "arrkey_size_dist"
 const SNAP_STATS_KEY_SIZES_SINCE = "key_size_stats_since"
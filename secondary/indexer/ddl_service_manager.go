@@ -16,6 +16,7 @@
 package indexer
 
 import (
+	"github.com/couchbase/cbauth"
 	"github.com/couchbase/cbauth/metakv"
 	"github.com/couchbase/cbauth/service"
 	"github.com/couchbase/indexing/secondary/common"
@@ -128,6 +129,14 @@ func NewDDLServiceMgr(indexerId common.IndexerId, supvCmdch MsgChannel, supvMsgc
 	mux.HandleFunc("/listScheduleCreateTokens", mgr.handleListScheduleCreateTokens)
 	mux.HandleFunc("/listStopScheduleCreateTokens", mgr.handleListStopScheduleCreateTokens)
 	mux.HandleFunc("/transferScheduleCreateTokens", mgr.handleTransferScheduleCreateTokens)
+	mux.HandleFunc("/listLostReplicas", mgr.handleListLostReplicas)
+	mux.HandleFunc("/repairLostReplicas", common.NetworkAllowed(mgr.handleRepairLostReplicas))
+	mux.HandleFunc("/replicaRepairQueue", mgr.handleReplicaRepairQueue)
+	mux.HandleFunc("/replicaHealth", mgr.handleReplicaHealth)
+	mux.HandleFunc("/alterIndex", common.NetworkAllowed(mgr.handleAlterIndex))
+	mux.HandleFunc("/dropReplicaInstance", common.NetworkAllowed(mgr.handleDropReplicaInstance))
+	mux.HandleFunc("/idleIndexes", mgr.handleIdleIndexes)
+	mux.HandleFunc("/recreateIdleIndex", common.NetworkAllowed(mgr.handleRecreateIdleIndex))
 
 	go mgr.run()
 
@@ -158,6 +167,8 @@ func getDDLServiceMgr() *DDLServiceMgr {
 func (m *DDLServiceMgr) run() {
 
 	go m.processCreateCommand()
+	go m.processReplicaRepair()
+	go m.processIdleIndexes()
 
 loop:
 	for {
@@ -1512,7 +1523,12 @@ func (m *DDLServiceMgr) transferScheduleCreateTokens(tokens []mc.ScheduleCreateT
 }
 
 func (m *DDLServiceMgr) validateAuth(w http.ResponseWriter, r *http.Request) bool {
-	_, valid, err := common.IsAuthValid(r)
+	_, valid := m.validateAuthCreds(w, r)
+	return valid
+}
+
+func (m *DDLServiceMgr) validateAuthCreds(w http.ResponseWriter, r *http.Request) (cbauth.Creds, bool) {
+	creds, valid, err := common.IsAuthValid(r)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error() + "\n"))
@@ -1520,7 +1536,7 @@ func (m *DDLServiceMgr) validateAuth(w http.ResponseWriter, r *http.Request) boo
 		w.WriteHeader(401)
 		w.Write([]byte("401 Unauthorized\n"))
 	}
-	return valid
+	return creds, valid
 }
 
 //////////////////////////////////////////////////////////////
@@ -0,0 +1,207 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+//gFeedHealth tracks the repairs of the streams of this indexer
+var gFeedHealth = newFeedHealth()
+
+//
+// feedRepair is the repair of a keyspace of a stream, from the first error
+// of its feed until there is nothing left to repair.
+//
+type feedRepair struct {
+	StreamId   string    `json:"streamId"`
+	KeyspaceId string    `json:"keyspaceId"`
+	Since      time.Time `json:"since"`
+	Duration   string    `json:"duration"`
+	Attempts   int       `json:"attempts"`
+	NextRetry  time.Time `json:"nextRetry"`
+	LastError  string    `json:"lastError,omitempty"`
+	Alerted    bool      `json:"alerted"`
+
+	backoff *common.Backoff
+}
+
+type feedHealth struct {
+	mutex   sync.Mutex
+	repairs map[common.StreamId]map[string]*feedRepair
+
+	initial        time.Duration
+	max            time.Duration
+	jitter         float64
+	alertThreshold time.Duration
+	clusterAddr    string
+
+	// console raises the alerts in the UI
+	console func(clusterAddr string, format string, v ...interface{}) error
+}
+
+func newFeedHealth() *feedHealth {
+	return &feedHealth{
+		repairs: make(map[common.StreamId]map[string]*feedRepair),
+		initial: REPAIR_BATCH_TIMEOUT * time.Millisecond,
+		max:     REPAIR_BATCH_TIMEOUT * time.Millisecond,
+		console: common.Console,
+	}
+}
+
+func (f *feedHealth) updateConfig(config common.Config) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.initial = time.Duration(config["timekeeper.repairBackoff.initial"].Int()) * time.Millisecond
+	f.max = time.Duration(config["timekeeper.repairBackoff.max"].Int()) * time.Millisecond
+	f.jitter = config["timekeeper.repairBackoff.jitter"].Float64()
+	f.alertThreshold = time.Duration(config["timekeeper.repairAlertThreshold"].Int()) * time.Second
+	f.clusterAddr = config["clusterAddr"].String()
+}
+
+//
+// nextAttempt records an attempt to repair the keyspace of the stream, and
+// returns the time to wait before it.  The first attempt waits for the
+// initial backoff, to batch the vbuckets to repair, and each retry waits
+// longer up to the max backoff.  If the keyspace has been under repair for
+// longer than the alert threshold, an alert is raised once.
+//
+func (f *feedHealth) nextAttempt(streamId common.StreamId, keyspaceId string) time.Duration {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	now := time.Now()
+
+	if _, ok := f.repairs[streamId]; !ok {
+		f.repairs[streamId] = make(map[string]*feedRepair)
+	}
+	r, ok := f.repairs[streamId][keyspaceId]
+	if !ok {
+		r = &feedRepair{
+			StreamId:   streamId.String(),
+			KeyspaceId: keyspaceId,
+			Since:      now,
+			backoff:    common.NewBackoff(f.initial, f.max, 2, f.jitter),
+		}
+		f.repairs[streamId][keyspaceId] = r
+	}
+
+	wait := r.backoff.Next()
+	r.Attempts = r.backoff.Attempts()
+	r.NextRetry = now.Add(wait)
+
+	if r.Attempts > 1 {
+		logging.Infof("FeedHealth::nextAttempt Stream %v KeyspaceId %v Retrying "+
+			"Repair In %v. Attempt %v, Under Repair Since %v.", streamId, keyspaceId,
+			wait, r.Attempts, r.Since)
+	}
+
+	if f.alertThreshold > 0 && !r.Alerted && now.Sub(r.Since) > f.alertThreshold {
+		r.Alerted = true
+
+		logMsg := "Stream %v of %v is under repair since %v. %v repair attempts failed. Last error: %v."
+		logging.Errorf("FeedHealth::nextAttempt "+logMsg, streamId, keyspaceId,
+			r.Since.Format(time.RFC3339), r.Attempts-1, r.LastError)
+		f.console(f.clusterAddr, logMsg, streamId, keyspaceId,
+			r.Since.Format(time.RFC3339), r.Attempts-1, r.LastError)
+	}
+
+	return wait
+}
+
+//
+// repairFailed records the error of an attempt to repair the keyspace of
+// the stream.
+//
+func (f *feedHealth) repairFailed(streamId common.StreamId, keyspaceId string, err string) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if r, ok := f.repairs[streamId][keyspaceId]; ok {
+		r.LastError = err
+	}
+}
+
+//
+// repairDone ends the repair of the keyspace of the stream, either because
+// there is nothing left to repair, or because the repair has been handed
+// over to recovery or to the closing of the stream.
+//
+func (f *feedHealth) repairDone(streamId common.StreamId, keyspaceId string, reason string) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	r, ok := f.repairs[streamId][keyspaceId]
+	if !ok {
+		return
+	}
+
+	delete(f.repairs[streamId], keyspaceId)
+
+	if r.Attempts > 1 || r.Alerted {
+		logging.Infof("FeedHealth::repairDone Stream %v KeyspaceId %v Repair Done (%v) "+
+			"After %v Attempts In %v.", streamId, keyspaceId, reason, r.Attempts,
+			time.Since(r.Since))
+	}
+	if r.Alerted {
+		f.console(f.clusterAddr, "Stream %v of %v is no longer under repair (%v).",
+			streamId, keyspaceId, reason)
+	}
+}
+
+//numUnrecovered returns the number of repairs for which an alert is raised
+func (f *feedHealth) numUnrecovered() int64 {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var n int64
+	for _, repairs := range f.repairs {
+		for _, r := range repairs {
+			if r.Alerted {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+//getRepairs returns the ongoing repairs, the longest first
+func (f *feedHealth) getRepairs() []feedRepair {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	now := time.Now()
+	repairs := make([]feedRepair, 0)
+	for _, keyspaceRepairs := range f.repairs {
+		for _, r := range keyspaceRepairs {
+			rc := *r
+			rc.Duration = now.Sub(r.Since).String()
+			rc.backoff = nil
+			repairs = append(repairs, rc)
+		}
+	}
+
+	sort.Slice(repairs, func(i, j int) bool {
+		return repairs[i].Since.Before(repairs[j].Since)
+	})
+	return repairs
+}
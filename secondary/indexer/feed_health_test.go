@@ -0,0 +1,104 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestFeedHealthBackoff(t *testing.T) {
+
+	f := newFeedHealth()
+	f.initial = 10 * time.Millisecond
+	f.max = 40 * time.Millisecond
+
+	streamId := common.MAINT_STREAM
+	for i, expected := range []time.Duration{10, 20, 40, 40} {
+		wait := f.nextAttempt(streamId, "b1")
+		if wait != expected*time.Millisecond {
+			t.Fatalf("attempt %v: expected wait %vms, got %v", i+1, expected, wait)
+		}
+	}
+
+	repairs := f.getRepairs()
+	if len(repairs) != 1 || repairs[0].Attempts != 4 || repairs[0].backoff != nil {
+		t.Fatalf("unexpected repairs %+v", repairs)
+	}
+
+	// a repair starts again from the initial backoff
+	f.repairDone(streamId, "b1", "done")
+	if repairs := f.getRepairs(); len(repairs) != 0 {
+		t.Fatalf("unexpected repairs %+v", repairs)
+	}
+	if wait := f.nextAttempt(streamId, "b1"); wait != f.initial {
+		t.Fatalf("expected wait %v, got %v", f.initial, wait)
+	}
+
+	// the repairs of each keyspace of each stream are independent
+	f.nextAttempt(common.INIT_STREAM, "b1")
+	f.nextAttempt(streamId, "b2")
+	if repairs := f.getRepairs(); len(repairs) != 3 {
+		t.Fatalf("expected 3 repairs, got %+v", repairs)
+	}
+}
+
+func TestFeedHealthAlert(t *testing.T) {
+
+	var alerts []string
+	f := newFeedHealth()
+	f.clusterAddr = "127.0.0.1:8091"
+	f.alertThreshold = time.Hour
+	f.console = func(clusterAddr string, format string, v ...interface{}) error {
+		if clusterAddr != f.clusterAddr {
+			t.Fatalf("unexpected cluster address %v", clusterAddr)
+		}
+		alerts = append(alerts, fmt.Sprintf(format, v...))
+		return nil
+	}
+
+	streamId := common.MAINT_STREAM
+	f.nextAttempt(streamId, "b1")
+	f.repairFailed(streamId, "b1", "connection refused")
+	f.nextAttempt(streamId, "b1")
+	if len(alerts) != 0 || f.numUnrecovered() != 0 {
+		t.Fatalf("unexpected alerts %v", alerts)
+	}
+
+	// an alert is raised once, when the repair exceeds the threshold
+	f.repairs[streamId]["b1"].Since = time.Now().Add(-2 * time.Hour)
+	f.nextAttempt(streamId, "b1")
+	f.nextAttempt(streamId, "b1")
+	if len(alerts) != 1 || !strings.Contains(alerts[0], "connection refused") ||
+		!strings.Contains(alerts[0], "2 repair attempts failed") {
+		t.Fatalf("unexpected alerts %v", alerts)
+	}
+	if n := f.numUnrecovered(); n != 1 {
+		t.Fatalf("expected 1 unrecovered repair, got %v", n)
+	}
+	if repairs := f.getRepairs(); len(repairs) != 1 || !repairs[0].Alerted ||
+		repairs[0].LastError != "connection refused" {
+		t.Fatalf("unexpected repairs %+v", repairs)
+	}
+
+	// the end of an alerted repair is reported
+	f.repairDone(streamId, "b1", "recovery")
+	if len(alerts) != 2 || !strings.Contains(alerts[1], "no longer under repair (recovery)") {
+		t.Fatalf("unexpected alerts %v", alerts)
+	}
+	if n := f.numUnrecovered(); n != 0 {
+		t.Fatalf("expected no unrecovered repair, got %v", n)
+	}
+
+	// no alert without a threshold
+	f.alertThreshold = 0
+	f.nextAttempt(streamId, "b2")
+	f.repairs[streamId]["b2"].Since = time.Now().Add(-2 * time.Hour)
+	f.nextAttempt(streamId, "b2")
+	f.repairDone(streamId, "b2", "done")
+	if len(alerts) != 2 {
+		t.Fatalf("unexpected alerts %v", alerts)
+	}
+}
@@ -62,6 +62,10 @@ func NewForestDBSlice(path string, sliceId SliceId, idxDefn common.IndexDefn,
 
 	config := forestdb.DefaultConfig()
 	config.SetDurabilityOpt(forestdb.DRB_ASYNC)
+	if getIOMode(sysconf, common.ForestDB) == IOModeDirect {
+		config.SetDurabilityOpt(forestdb.DRB_ODIRECT_ASYNC)
+		logging.Verbosef("NewForestDBSlice(): direct io mode")
+	}
 
 	memQuota := sysconf["settings.memory_quota"].Uint64()
 	logging.Debugf("NewForestDBSlice(): buffer cache size %d", memQuota)
@@ -0,0 +1,1199 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	statsMgmt "github.com/couchbase/indexing/secondary/stats"
+)
+
+const hashSnapshotDataFile = "data"
+
+//
+// hashSlice is the slice of a hash index.  Entries are kept in a hash
+// table of their leading key (of their docid for a primary index), so
+// that an equality lookup reads a single bucket.  There is no ordering
+// of the entries, and range scans are not supported, except for a scan
+// of the whole index which has to sort all the entries.
+//
+// Mutations are applied as they are received.  Disk snapshots are
+// written like the snapshots of memdb slices, with the entries of the
+// snapshot in a single data file.
+//
+type hashSlice struct {
+	committedCount uint64
+
+	path string
+	id   SliceId
+
+	refCount int
+	lock     sync.RWMutex
+
+	store *hashStore
+
+	idxDefn    common.IndexDefn
+	idxDefnId  common.IndexDefnId
+	idxInstId  common.IndexInstId
+	idxPartnId common.PartitionId
+
+	status        SliceStatus
+	isActive      bool
+	isDirty       bool
+	isPrimary     bool
+	isSoftDeleted bool
+	isSoftClosed  bool
+
+	clusterAddr string
+
+	numVbuckets    int
+	numShards      int
+	maxRollbacks   int
+	maxDiskSnaps   int
+	maxSnapshotAge time.Duration
+	hasPersistence bool
+
+	idxStats  *IndexStats
+	sysconf   common.Config
+	confLock  sync.RWMutex
+	keySzConf keySizeConfig
+
+	isPersistorActive int32
+
+	lastRollbackTs *common.TsVbuuid
+}
+
+func NewHashSlice(path string, sliceId SliceId, idxDefn common.IndexDefn,
+	idxInstId common.IndexInstId, partitionId common.PartitionId,
+	isPrimary bool, hasPersistance bool,
+	sysconf common.Config, idxStats *IndexStats) (*hashSlice, error) {
+
+	if idxDefn.IsArrayIndex {
+		return nil, errors.New("Hash index cannot be an array index")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || err == nil && info.IsDir() {
+		os.Mkdir(path, 0777)
+	}
+
+	slice := &hashSlice{}
+	slice.idxStats = idxStats
+	slice.idxStats.residentPercent.Set(100)
+	slice.idxStats.cacheHitPercent.Set(100)
+
+	slice.sysconf = sysconf
+	slice.path = path
+	slice.idxInstId = idxInstId
+	slice.idxDefnId = idxDefn.DefnId
+	slice.idxDefn = idxDefn
+	slice.idxPartnId = partitionId
+	slice.id = sliceId
+	slice.isPrimary = isPrimary
+	slice.hasPersistence = hasPersistance
+
+	slice.maxRollbacks, slice.maxDiskSnaps, slice.maxSnapshotAge =
+		getSnapshotRetention(sysconf, "settings.moi.recovery.max_rollbacks")
+	slice.numVbuckets = sysconf["numVbuckets"].Int()
+	slice.numShards = sysconf["hash.numShards"].Int()
+	slice.clusterAddr = sysconf["clusterAddr"].String()
+	slice.keySzConf = getKeySizeConfig(sysconf)
+
+	slice.store = newHashStore(slice.numShards, isPrimary)
+
+	logging.Infof("HashSlice:NewHashSlice Created New Slice Id %v IndexInstId %v PartitionId %v "+
+		"Shards %v Persistence %v", sliceId, idxInstId, partitionId, slice.numShards, slice.hasPersistence)
+
+	return slice, nil
+}
+
+func (slice *hashSlice) IncrRef() {
+	slice.lock.Lock()
+	defer slice.lock.Unlock()
+
+	slice.refCount++
+}
+
+func (slice *hashSlice) DecrRef() {
+	slice.lock.Lock()
+	defer slice.lock.Unlock()
+
+	slice.refCount--
+	if slice.refCount == 0 {
+		if slice.isSoftDeleted {
+			tryDeleteHashSlice(slice)
+		}
+	}
+}
+
+//
+// hashKey returns the key of the bucket of an index entry.
+//
+func (slice *hashSlice) hashKey(entry []byte) ([]byte, error) {
+
+	if slice.isPrimary {
+		return entry, nil
+	}
+
+	e := secondaryIndexEntry(entry)
+	key := entry[:e.lenKey()]
+
+	b := bloomFilterKeyPool.Get().(*bloomFilterKeyBuf)
+	defer bloomFilterKeyPool.Put(b)
+
+	return bloomFilterKey(key, b)
+}
+
+func (slice *hashSlice) Insert(key []byte, docid []byte, meta *MutationMeta) error {
+
+	slice.idxStats.numDocsFlushQueued.Add(1)
+
+	if slice.isPrimary {
+		slice.insertPrimaryIndex(docid)
+	} else if len(key) == 0 {
+		slice.deleteSecIndex(docid)
+	} else {
+		slice.insertSecIndex(key, docid, meta)
+	}
+
+	slice.idxStats.numItemsFlushed.Add(1)
+	slice.idxStats.numDocsIndexed.Add(1)
+	slice.isDirty = true
+	return nil
+}
+
+func (slice *hashSlice) Delete(docid []byte, meta *MutationMeta) error {
+
+	slice.idxStats.numDocsFlushQueued.Add(1)
+
+	if slice.isPrimary {
+		slice.deletePrimaryIndex(docid)
+	} else {
+		slice.deleteSecIndex(docid)
+	}
+
+	slice.idxStats.numItemsFlushed.Add(1)
+	slice.idxStats.numDocsIndexed.Add(1)
+	slice.isDirty = true
+	return nil
+}
+
+func (slice *hashSlice) insertPrimaryIndex(docid []byte) {
+
+	entry, err := NewPrimaryIndexEntry(docid)
+	common.CrashOnError(err)
+
+	t0 := time.Now()
+	slice.store.Put(entry, entry, docid)
+	slice.idxStats.Timings.stKVSet.Put(time.Since(t0))
+}
+
+func (slice *hashSlice) insertSecIndex(key []byte, docid []byte, meta *MutationMeta) {
+
+	slice.confLock.RLock()
+	szConf := slice.keySzConf
+	slice.confLock.RUnlock()
+
+	entry, err := NewSecondaryIndexEntry(key, docid, false, 1, nil, nil, meta, szConf)
+	if err == nil {
+		var hkey []byte
+		if hkey, err = slice.hashKey(entry); err == nil {
+			t0 := time.Now()
+			added, old := slice.store.Put(hkey, entry, docid)
+			slice.idxStats.Timings.stKVSet.Put(time.Since(t0))
+
+			if added {
+				addKeySizeStat(slice.idxStats, len(entry))
+			}
+			if old != nil {
+				subtractKeySizeStat(slice.idxStats, len(old))
+			}
+			return
+		}
+	}
+
+	logging.Errorf("HashSlice::insertSecIndex Slice Id %v IndexInstId %v PartitionId %v "+
+		"Skipping docid:%s (%v)", slice.id, slice.idxInstId, slice.idxPartnId, logging.TagStrUD(docid), err)
+	slice.deleteSecIndex(docid)
+}
+
+func (slice *hashSlice) deletePrimaryIndex(docid []byte) {
+
+	if docid == nil {
+		common.CrashOnError(errors.New("Nil Primary Key"))
+		return
+	}
+
+	entry, err := NewPrimaryIndexEntry(docid)
+	common.CrashOnError(err)
+
+	t0 := time.Now()
+	if old := slice.store.Delete(entry, docid); old != nil {
+		slice.idxStats.Timings.stKVDelete.Put(time.Since(t0))
+	}
+}
+
+func (slice *hashSlice) deleteSecIndex(docid []byte) {
+
+	t0 := time.Now()
+	if old := slice.store.Delete(nil, docid); old != nil {
+		slice.idxStats.Timings.stKVDelete.Put(time.Since(t0))
+		subtractKeySizeStat(slice.idxStats, len(old))
+	}
+}
+
+type hashSnapshotInfo struct {
+	Ts        *common.TsVbuuid
+	Committed bool `json:"-"`
+
+	snap     *hashStoreSnapshot
+	dataPath string
+
+	IndexStats map[string]interface{}
+	Version    int
+	InstId     common.IndexInstId
+	PartnId    common.PartitionId
+}
+
+type hashSnapshot struct {
+	slice      *hashSlice
+	idxDefnId  common.IndexDefnId
+	idxInstId  common.IndexInstId
+	idxPartnId common.PartitionId
+	ts         *common.TsVbuuid
+	info       *hashSnapshotInfo
+	committed  bool
+
+	refCount int32
+}
+
+// Creates an open snapshot handle from snapshot info
+// Snapshot info is obtained from NewSnapshot() or GetSnapshots() API
+// Returns error if snapshot handle cannot be created.
+func (slice *hashSlice) OpenSnapshot(info SnapshotInfo) (Snapshot, error) {
+	var err error
+	snapInfo := info.(*hashSnapshotInfo)
+
+	s := &hashSnapshot{slice: slice,
+		idxDefnId:  slice.idxDefnId,
+		idxInstId:  slice.idxInstId,
+		idxPartnId: slice.idxPartnId,
+		info:       snapInfo,
+		ts:         snapInfo.Timestamp(),
+		committed:  info.IsCommitted(),
+	}
+
+	s.Open()
+	s.slice.IncrRef()
+	s.slice.idxStats.numOpenSnapshots.Add(1)
+
+	if s.committed && slice.hasPersistence && s.info.snap != nil {
+		s.info.snap.Open()
+		go slice.doPersistSnapshot(s)
+	}
+
+	if s.info.snap == nil {
+		err = slice.loadSnapshot(s.info)
+		if err != nil {
+			s.Close()
+		}
+	}
+
+	if info.IsCommitted() {
+		logging.Infof("HashSlice::OpenSnapshot SliceId %v IndexInstId %v PartitionId %v Creating New "+
+			"Snapshot %v", slice.id, slice.idxInstId, slice.idxPartnId, snapInfo)
+	}
+
+	return s, err
+}
+
+func (slice *hashSlice) doPersistSnapshot(s *hashSnapshot) {
+
+	defer s.info.snap.Close()
+
+	if !atomic.CompareAndSwapInt32(&slice.isPersistorActive, 0, 1) {
+		logging.Infof("HashSlice Slice Id %v, IndexInstId %v, PartitionId %v Skipping ondisk"+
+			" snapshot. A snapshot writer is in progress.", slice.id, slice.idxInstId, slice.idxPartnId)
+		return
+	}
+	defer atomic.StoreInt32(&slice.isPersistorActive, 0)
+
+	t0 := time.Now()
+	dir := newSnapshotPath(slice.path)
+	tmpdir := filepath.Join(slice.path, tmpDirName)
+	os.RemoveAll(tmpdir)
+
+	err := slice.writeSnapshot(s, tmpdir)
+	if err == nil {
+		err = os.Rename(tmpdir, dir)
+	}
+
+	if err == nil {
+		slice.cleanupOldSnapshotFiles(slice.maxRollbacks)
+
+		dur := time.Since(t0)
+		logging.Infof("HashSlice Slice Id %v, IndexInstId %v, PartitionId %v created ondisk"+
+			" snapshot %v. Took %v", slice.id, slice.idxInstId, slice.idxPartnId, dir, dur)
+		slice.idxStats.diskSnapStoreDuration.Set(int64(dur / time.Millisecond))
+	} else {
+		logging.Errorf("HashSlice Slice Id %v, IndexInstId %v, PartitionId %v failed to"+
+			" create ondisk snapshot %v (error=%v)", slice.id, slice.idxInstId, slice.idxPartnId, dir, err)
+		os.RemoveAll(tmpdir)
+		os.RemoveAll(dir)
+	}
+}
+
+//
+// writeSnapshot writes the entries of the snapshot to the data file of
+// dir, each prefixed by its length, and then the manifest.
+//
+func (slice *hashSlice) writeSnapshot(s *hashSnapshot, dir string) error {
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	fd, err := os.OpenFile(filepath.Join(dir, hashSnapshotDataFile), os.O_WRONLY|os.O_CREATE, 0755)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(fd)
+	var lenBuf [4]byte
+	err = s.info.snap.ForEach(func(entry []byte) error {
+		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(entry)))
+		if _, err := w.Write(lenBuf[:]); err != nil {
+			return err
+		}
+		_, err := w.Write(entry)
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = fd.Sync()
+	}
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	// Add details to snapshot info and persist it
+	snapshotStats := make(map[string]interface{})
+	snapshotStats[SNAP_STATS_KEY_SIZES] = getKeySizesStats(slice.idxStats)
+	snapshotStats[SNAP_STATS_KEY_SIZES_SINCE] = slice.idxStats.keySizeStatsSince.Value()
+	snapshotStats[SNAP_STATS_RAW_DATA_SIZE] = slice.idxStats.rawDataSize.Value()
+	s.info.IndexStats = snapshotStats
+	s.info.Version = SNAPSHOT_META_VERSION_HASH_1
+	s.info.InstId = slice.idxInstId
+	s.info.PartnId = slice.idxPartnId
+
+	bs, err := json.Marshal(s.info)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "manifest.json"), bs, 0755)
+}
+
+func (slice *hashSlice) loadSnapshot(snapInfo *hashSnapshotInfo) (err error) {
+
+	logging.Infof("HashSlice::loadSnapshot Slice Id %v, IndexInstId %v, PartitionId %v reading %v",
+		slice.id, slice.idxInstId, slice.idxPartnId, snapInfo.dataPath)
+
+	t0 := time.Now()
+	err = slice.readSnapshot(snapInfo.dataPath)
+
+	dur := time.Since(t0)
+	if err != nil {
+		logging.Errorf("HashSlice::loadSnapshot Slice Id %v, IndexInstId %v, PartitionId %v failed to load snapshot %v error(%v).",
+			slice.id, slice.idxInstId, slice.idxPartnId, snapInfo.dataPath, err)
+		os.RemoveAll(snapInfo.dataPath)
+		slice.resetStores()
+		return err
+	}
+
+	snapInfo.snap = slice.store.NewSnapshot()
+	slice.setCommittedCount()
+	logging.Infof("HashSlice::loadSnapshot Slice Id %v, IndexInstId %v, PartitionId %v finished reading %v. Took %v",
+		slice.id, slice.idxInstId, slice.idxPartnId, snapInfo.dataPath, dur)
+
+	slice.updateStatsFromSnapshotMeta(snapInfo)
+	slice.idxStats.diskSnapLoadDuration.Set(int64(dur / time.Millisecond))
+	slice.idxStats.numItemsRestored.Set(slice.store.ItemsCount())
+	return nil
+}
+
+func (slice *hashSlice) readSnapshot(dir string) error {
+
+	fd, err := os.Open(filepath.Join(dir, hashSnapshotDataFile))
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	r := bufio.NewReader(fd)
+	var lenBuf [4]byte
+	var entry []byte
+	for {
+		if _, err := io.ReadFull(r, lenBuf[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		l := int(binary.BigEndian.Uint32(lenBuf[:]))
+		if cap(entry) < l {
+			entry = make([]byte, l)
+		}
+		entry = entry[:l]
+		if _, err := io.ReadFull(r, entry); err != nil {
+			return err
+		}
+
+		hkey, err := slice.hashKey(entry)
+		if err != nil {
+			return err
+		}
+
+		docid := entry
+		if !slice.isPrimary {
+			docid = docIdFromEntryBytes(entry)
+		}
+		slice.store.Put(hkey, entry, docid)
+		addKeySizeStat(slice.idxStats, len(entry))
+	}
+}
+
+func (slice *hashSlice) updateStatsFromSnapshotMeta(o SnapshotInfo) {
+
+	stats := o.Stats()
+	if stats != nil {
+		slice.idxStats.rawDataSize.Set(safeGetInt64(stats[SNAP_STATS_RAW_DATA_SIZE]))
+		slice.idxStats.keySizeStatsSince.Set(safeGetInt64(stats[SNAP_STATS_KEY_SIZES_SINCE]))
+	} else {
+		slice.idxStats.keySizeStatsSince.Set(time.Now().UnixNano())
+	}
+}
+
+func (slice *hashSlice) cleanupOldSnapshotFiles(keepn int) {
+
+	seqTs := NewTimestamp(slice.numVbuckets)
+
+	for i := 0; i < MAX_GETSEQS_RETRIES; i++ {
+
+		seqnos, err := common.BucketMinSeqnos(slice.clusterAddr, "default", slice.idxDefn.Bucket)
+		if err != nil {
+			logging.Errorf("HashSlice Slice Id %v, IndexInstId %v, PartitionId %v "+
+				"Error collecting cluster seqnos %v",
+				slice.id, slice.idxInstId, slice.idxPartnId, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for i := 0; i < slice.numVbuckets; i++ {
+			seqTs[i] = seqnos[i]
+		}
+		break
+
+	}
+
+	infos, manifests, _ := slice.getSnapshots()
+
+	if len(manifests) > keepn {
+
+		for i := 0; i < len(manifests)-keepn; i++ {
+
+			file := manifests[len(manifests)-i-1]
+			snapInfo := infos[len(infos)-i-1]
+			snapTs := getSeqTsFromTsVbuuid(snapInfo.Timestamp())
+			if (seqTs.GreaterThanEqual(snapTs) && //min cluster seqno is greater than snap ts
+				slice.lastRollbackTs == nil) || //last rollback was successful
+				len(manifests)-i > slice.maxDiskSnaps { //num snapshots is more than max disk snapshots
+				dir := filepath.Dir(file)
+				logging.Infof("HashSlice Slice Id %v, IndexInstId %v, PartitionId %v "+
+					"Removing disk snapshot %v. Num snapshots %v.", slice.id, slice.idxInstId,
+					slice.idxPartnId, dir, len(manifests)-i)
+				os.RemoveAll(dir)
+			} else {
+				logging.Infof("HashSlice Slice Id %v, IndexInstId %v, PartitionId %v "+
+					"Skipped disk snapshot cleanup %v. Num snapshots %v. ",
+					slice.id, slice.idxInstId, slice.idxPartnId, file, len(manifests)-i)
+				break
+			}
+		}
+	}
+
+	slice.cleanupExpiredSnapshotFiles()
+}
+
+//
+// cleanupExpiredSnapshotFiles removes the disk snapshots older than
+// snapshot_retention.max_age, except the latest one.
+//
+func (slice *hashSlice) cleanupExpiredSnapshotFiles() {
+
+	maxAge := slice.maxSnapshotAge
+	if maxAge <= 0 {
+		return
+	}
+
+	// manifests are sorted from the latest
+	_, manifests, _ := slice.getSnapshots()
+	for i := 1; i < len(manifests); i++ {
+		fi, err := os.Stat(manifests[i])
+		if err != nil || time.Since(fi.ModTime()) <= maxAge {
+			continue
+		}
+
+		dir := filepath.Dir(manifests[i])
+		logging.Infof("HashSlice Slice Id %v, IndexInstId %v, PartitionId %v "+
+			"Removing disk snapshot %v older than %v.", slice.id, slice.idxInstId,
+			slice.idxPartnId, dir, maxAge)
+		os.RemoveAll(dir)
+	}
+}
+
+func (slice *hashSlice) EnforceSnapshotRetention() {
+
+	if !atomic.CompareAndSwapInt32(&slice.isPersistorActive, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&slice.isPersistorActive, 0)
+
+	_, manifests, _ := slice.getSnapshots()
+	if len(manifests) > slice.maxRollbacks {
+		slice.cleanupOldSnapshotFiles(slice.maxRollbacks)
+	} else {
+		slice.cleanupExpiredSnapshotFiles()
+	}
+}
+
+func (slice *hashSlice) cleanupAllOldSnapshotFiles() {
+	_, manifests, _ := slice.getSnapshots()
+	for _, m := range manifests {
+		dir := filepath.Dir(m)
+		logging.Infof("HashSlice Removing disk snapshot %v", dir)
+		os.RemoveAll(dir)
+	}
+}
+
+func (slice *hashSlice) diskSize() int64 {
+	var sz int64
+	snapdirs, _ := filepath.Glob(filepath.Join(slice.path, "snapshot.*"))
+	for _, dir := range snapdirs {
+		s, _ := common.DiskUsage(dir)
+		sz += s
+	}
+
+	return sz
+}
+
+func (slice *hashSlice) GetSnapshots() ([]SnapshotInfo, error) {
+	infos, _, err := slice.getSnapshots()
+	return infos, err
+}
+
+// Returns snapshot info list in reverse sorted order
+func (slice *hashSlice) getSnapshots() ([]SnapshotInfo, []string, error) {
+	var infos []SnapshotInfo
+	var outfiles []string
+
+	files := getSnapshotManifests(slice.path)
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		info := &hashSnapshotInfo{dataPath: filepath.Dir(f)}
+		bs, err := ioutil.ReadFile(f)
+		if err == nil {
+			err = json.Unmarshal(bs, info)
+			if err == nil {
+				infos = append(infos, info)
+				outfiles = append(outfiles, f)
+			}
+		}
+	}
+	return infos, outfiles, nil
+}
+
+func (slice *hashSlice) setCommittedCount() {
+	atomic.StoreUint64(&slice.committedCount, uint64(slice.store.ItemsCount()))
+}
+
+func (slice *hashSlice) GetCommittedCount() uint64 {
+	return atomic.LoadUint64(&slice.committedCount)
+}
+
+func (slice *hashSlice) resetStores() {
+
+	slice.store.Free()
+	slice.store = newHashStore(slice.numShards, slice.isPrimary)
+	atomic.StoreUint64(&slice.committedCount, 0)
+
+	slice.idxStats.itemsCount.Set(0)
+	resetKeySizeStats(slice.idxStats)
+	slice.idxStats.rawDataSize.Set(0)
+
+	slice.idxStats.lastDiskBytes.Set(0)
+	slice.idxStats.lastNumItemsFlushed.Set(0)
+	slice.idxStats.lastNumDocsIndexed.Set(0)
+	slice.idxStats.lastNumFlushQueued.Set(0)
+	slice.idxStats.lastMutateGatherTime.Set(0)
+}
+
+//Rollback slice to given snapshot. Return error if
+//not possible
+func (slice *hashSlice) Rollback(info SnapshotInfo) error {
+
+	target := info.(*hashSnapshotInfo)
+
+	// Remove all the disk snapshots which were created after rollback snapshot
+	snapInfos, err := slice.GetSnapshots()
+	if err != nil {
+		return err
+	}
+
+	for _, snapInfo := range snapInfos {
+		si := snapInfo.(*hashSnapshotInfo)
+		if si.dataPath == target.dataPath {
+			break
+		}
+
+		if err := os.RemoveAll(si.dataPath); err != nil {
+			return err
+		}
+	}
+
+	// The entries are loaded when the snapshot is opened
+	slice.resetStores()
+
+	return nil
+}
+
+//RollbackToZero rollbacks the slice to initial state. Return error if
+//not possible
+func (slice *hashSlice) RollbackToZero() error {
+
+	slice.resetStores()
+	slice.cleanupAllOldSnapshotFiles()
+
+	slice.lastRollbackTs = nil
+
+	return nil
+}
+
+func (slice *hashSlice) LastRollbackTs() *common.TsVbuuid {
+	return slice.lastRollbackTs
+}
+
+func (slice *hashSlice) SetLastRollbackTs(ts *common.TsVbuuid) {
+	slice.lastRollbackTs = ts
+}
+
+//
+// NewSnapshot takes a snapshot of the store.  Mutations are applied as
+// they are received, so there is nothing to wait for.
+//
+func (slice *hashSlice) NewSnapshot(ts *common.TsVbuuid, commit bool) (SnapshotInfo, error) {
+
+	slice.isDirty = false
+
+	newSnapshotInfo := &hashSnapshotInfo{
+		Ts:        ts,
+		Committed: commit,
+		snap:      slice.store.NewSnapshot(),
+	}
+	slice.setCommittedCount()
+
+	if slice.store.NeedsGC() {
+		go slice.store.GC()
+	}
+
+	return newSnapshotInfo, nil
+}
+
+func (slice *hashSlice) FlushDone() {
+	// no-op
+}
+
+func (slice *hashSlice) Close() {
+
+	logging.Infof("HashSlice::Close Closing Slice Id %v, IndexInstId %v, PartitionId %v, "+
+		"IndexDefnId %v", slice.id, slice.idxInstId, slice.idxPartnId, slice.idxDefnId)
+
+	slice.store.Free()
+}
+
+//Destroy removes the database file from disk.
+//Slice is not recoverable after this.
+func (slice *hashSlice) Destroy() {
+	slice.lock.Lock()
+	defer slice.lock.Unlock()
+
+	if slice.refCount > 0 {
+		logging.Infof("HashSlice::Destroy Softdeleted Slice Id %v, IndexInstId %v, PartitionId %v, "+
+			"IndexDefnId %v", slice.id, slice.idxInstId, slice.idxPartnId, slice.idxDefnId)
+		slice.isSoftDeleted = true
+	} else {
+		tryDeleteHashSlice(slice)
+	}
+}
+
+func tryDeleteHashSlice(slice *hashSlice) {
+
+	slice.store.Free()
+
+	//cleanup the disk directory
+	if err := os.RemoveAll(slice.path); err != nil {
+		logging.Errorf("HashSlice::Destroy Error Cleaning Up Slice Id %v, IndexInstId %v, PartitionId %v, "+
+			"IndexDefnId %v. Error %v", slice.id, slice.idxInstId, slice.idxPartnId, slice.idxDefnId, err)
+	}
+}
+
+//Id returns the Id for this Slice
+func (slice *hashSlice) Id() SliceId {
+	return slice.id
+}
+
+// FilePath returns the filepath for this Slice
+func (slice *hashSlice) Path() string {
+	return slice.path
+}
+
+//IsActive returns if the slice is active
+func (slice *hashSlice) IsActive() bool {
+	return slice.isActive
+}
+
+//SetActive sets the active state of this slice
+func (slice *hashSlice) SetActive(isActive bool) {
+	slice.isActive = isActive
+}
+
+//Status returns the status for this slice
+func (slice *hashSlice) Status() SliceStatus {
+	return slice.status
+}
+
+//SetStatus set new status for this slice
+func (slice *hashSlice) SetStatus(status SliceStatus) {
+	slice.status = status
+}
+
+//IndexInstId returns the Index InstanceId this
+//slice is associated with
+func (slice *hashSlice) IndexInstId() common.IndexInstId {
+	return slice.idxInstId
+}
+
+//IndexDefnId returns the Index DefnId this slice
+//is associated with
+func (slice *hashSlice) IndexDefnId() common.IndexDefnId {
+	return slice.idxDefnId
+}
+
+// IsDirty returns true if there has been any change in
+// in the slice storage after last in-mem/persistent snapshot
+func (slice *hashSlice) IsDirty() bool {
+	return slice.isDirty
+}
+
+func (slice *hashSlice) Compact(abortTime time.Time, minFrag int) error {
+	return nil
+}
+
+func (slice *hashSlice) PrepareStats() {
+}
+
+func (slice *hashSlice) Statistics(consumerFilter uint64) (StorageStatistics, error) {
+
+	if consumerFilter == statsMgmt.N1QLStorageStatsFilter {
+		return slice.handleN1QLStorageStatistics()
+	}
+
+	var sts StorageStatistics
+
+	itemsCount := slice.store.ItemsCount()
+	memUsed := slice.store.MemoryInUse()
+
+	internalData := fmt.Sprintf("{\n"+
+		"\"items_count\": %v,\n"+
+		"\"data_size\": %v,\n"+
+		"\"garbage\": %v,\n"+
+		"\"shards\": %v\n}",
+		itemsCount, memUsed, atomic.LoadInt64(&slice.store.garbage), len(slice.store.shards))
+
+	sts.InternalData = []string{internalData}
+	sts.DataSize = memUsed
+	sts.MemUsed = memUsed
+	sts.DiskSize = slice.diskSize()
+
+	slice.idxStats.docidCount.Set(itemsCount)
+	slice.idxStats.numRecsInMem.Set(itemsCount)
+	slice.idxStats.rawDataSize.Set(memUsed)
+
+	return sts, nil
+}
+
+func (slice *hashSlice) handleN1QLStorageStatistics() (StorageStatistics, error) {
+	var sts StorageStatistics
+	internalData := fmt.Sprintf("{\n"+
+		"\"items_count\":%v,\n"+
+		"\"data_size\":%v\n}",
+		slice.store.ItemsCount(),
+		slice.store.MemoryInUse())
+	sts.InternalData = []string{internalData}
+	return sts, nil
+}
+
+func (slice *hashSlice) UpdateConfig(cfg common.Config) {
+	slice.confLock.Lock()
+	defer slice.confLock.Unlock()
+
+	slice.sysconf = cfg
+	slice.maxRollbacks, slice.maxDiskSnaps, slice.maxSnapshotAge =
+		getSnapshotRetention(cfg, "settings.moi.recovery.max_rollbacks")
+	slice.keySzConf = getKeySizeConfig(cfg)
+}
+
+func (slice *hashSlice) GetReaderContext() IndexReaderContext {
+	return &cursorCtx{}
+}
+
+func (slice *hashSlice) RecoveryDone() {
+	// nothing to do
+}
+
+func (slice *hashSlice) String() string {
+
+	str := fmt.Sprintf("SliceId: %v ", slice.id)
+	str += fmt.Sprintf("File: %v ", slice.path)
+	str += fmt.Sprintf("Index: %v ", slice.idxInstId)
+	str += fmt.Sprintf("Partition: %v ", slice.idxPartnId)
+
+	return str
+}
+
+func (info *hashSnapshotInfo) Timestamp() *common.TsVbuuid {
+	return info.Ts
+}
+
+func (info *hashSnapshotInfo) IsCommitted() bool {
+	return info.Committed
+}
+
+func (info *hashSnapshotInfo) Stats() map[string]interface{} {
+	return info.IndexStats
+}
+
+func (info *hashSnapshotInfo) IsOSOSnap() bool {
+	if info.Ts != nil && info.Ts.GetSnapType() == common.DISK_SNAP_OSO {
+		return true
+	}
+	return false
+}
+
+func (info *hashSnapshotInfo) String() string {
+	if info.snap == nil {
+		return fmt.Sprintf("SnapInfo: file: %s", info.dataPath)
+	}
+	return fmt.Sprintf("SnapshotInfo: count:%v committed:%v", info.snap.Count(), info.Committed)
+}
+
+func (s *hashSnapshot) Open() error {
+	atomic.AddInt32(&s.refCount, int32(1))
+
+	return nil
+}
+
+func (s *hashSnapshot) IsOpen() bool {
+
+	count := atomic.LoadInt32(&s.refCount)
+	return count > 0
+}
+
+func (s *hashSnapshot) Id() SliceId {
+	return s.slice.Id()
+}
+
+func (s *hashSnapshot) IndexInstId() common.IndexInstId {
+	return s.idxInstId
+}
+
+func (s *hashSnapshot) IndexDefnId() common.IndexDefnId {
+	return s.idxDefnId
+}
+
+func (s *hashSnapshot) Timestamp() *common.TsVbuuid {
+	return s.ts
+}
+
+//Close the snapshot
+func (s *hashSnapshot) Close() error {
+
+	count := atomic.AddInt32(&s.refCount, int32(-1))
+
+	if count < 0 {
+		logging.Errorf("HashSnapshot::Close Close operation requested " +
+			"on already closed snapshot")
+		return errors.New("Snapshot Already Closed")
+
+	} else if count == 0 {
+		go s.Destroy()
+	}
+
+	return nil
+}
+
+func (s *hashSnapshot) Destroy() {
+	if s.info != nil && s.info.snap != nil {
+		s.info.snap.Close()
+	}
+
+	s.slice.idxStats.numOpenSnapshots.Add(-1)
+	defer s.slice.DecrRef()
+}
+
+func (s *hashSnapshot) String() string {
+
+	str := fmt.Sprintf("Index: %v ", s.idxInstId)
+	str += fmt.Sprintf("Partition: %v ", s.idxPartnId)
+	str += fmt.Sprintf("SliceId: %v ", s.slice.Id())
+	str += fmt.Sprintf("TS: %v ", s.ts)
+	return str
+}
+
+func (s *hashSnapshot) Info() SnapshotInfo {
+	return s.info
+}
+
+// ==============================
+// Snapshot reader implementation
+// ==============================
+
+// Approximate items count
+func (s *hashSnapshot) StatCountTotal() (uint64, error) {
+	return s.slice.GetCommittedCount(), nil
+}
+
+func (s *hashSnapshot) CountTotal(ctx IndexReaderContext, stopch StopChannel) (uint64, error) {
+	return uint64(s.info.snap.Count()), nil
+}
+
+func (s *hashSnapshot) CountRange(ctx IndexReaderContext, low, high IndexKey, inclusion Inclusion,
+	stopch StopChannel) (uint64, error) {
+
+	var count uint64
+	callb := func([]byte) error {
+		select {
+		case <-stopch:
+			return common.ErrClientCancel
+		default:
+			count++
+		}
+
+		return nil
+	}
+
+	err := s.Range(ctx, low, high, inclusion, callb)
+	return count, err
+}
+
+func (s *hashSnapshot) MultiScanCount(ctx IndexReaderContext, low, high IndexKey, inclusion Inclusion,
+	scan Scan, distinct bool,
+	stopch StopChannel) (uint64, error) {
+
+	var err error
+	var scancount uint64
+	checkDistinct := distinct && !s.isPrimary()
+	isIndexComposite := len(s.slice.idxDefn.SecExprs) > 1
+
+	buf := secKeyBufPool.Get()
+	defer secKeyBufPool.Put(buf)
+
+	previousRow := ctx.GetCursorKey()
+
+	callb := func(entry []byte) error {
+		select {
+		case <-stopch:
+			return common.ErrClientCancel
+		default:
+
+			skipRow := false
+			var ck [][]byte
+
+			if scan.ScanType == FilterRangeReq {
+				if len(entry) > cap(*buf) {
+					*buf = make([]byte, 0, len(entry)+RESIZE_PAD)
+				}
+
+				skipRow, ck, err = filterScanRow(entry, scan, (*buf)[:0])
+				if err != nil {
+					return err
+				}
+			}
+			if skipRow {
+				return nil
+			}
+
+			if checkDistinct {
+				if isIndexComposite {
+					// For Count Distinct, only leading key needs to be considered for
+					// distinct comparison as N1QL supports distinct on only single key
+					entry, err = projectLeadingKey(ck, entry, buf)
+					if err != nil {
+						return err
+					}
+				}
+				if len(*previousRow) != 0 && distinctCompare(entry, *previousRow) {
+					return nil // Ignore the entry as it is same as previous entry
+				}
+				*previousRow = append((*previousRow)[:0], entry...)
+			}
+
+			scancount++
+		}
+		return nil
+	}
+
+	e := s.Range(ctx, low, high, inclusion, callb)
+	return scancount, e
+}
+
+func (s *hashSnapshot) CountLookup(ctx IndexReaderContext, keys []IndexKey, stopch StopChannel) (uint64, error) {
+	var err error
+	var count uint64
+
+	callb := func([]byte) error {
+		select {
+		case <-stopch:
+			return common.ErrClientCancel
+		default:
+			count++
+		}
+
+		return nil
+	}
+
+	for _, k := range keys {
+		if err = s.Lookup(ctx, k, callb); err != nil {
+			break
+		}
+	}
+
+	return count, err
+}
+
+func (s *hashSnapshot) Exists(ctx IndexReaderContext, key IndexKey, stopch StopChannel) (bool, error) {
+	var count uint64
+	callb := func([]byte) error {
+		select {
+		case <-stopch:
+			return common.ErrClientCancel
+		default:
+			count++
+		}
+
+		return nil
+	}
+
+	err := s.Lookup(ctx, key, callb)
+	return count != 0, err
+}
+
+func (s *hashSnapshot) Lookup(ctx IndexReaderContext, key IndexKey, callb EntryCallback) error {
+	return s.lookup(key, compareExact, callb)
+}
+
+//
+// Range only supports equality lookups (low equal to high, both included).
+// The hash table has no order, so other ranges would have to collect and
+// sort the entries of the whole index.
+//
+func (s *hashSnapshot) Range(ctx IndexReaderContext, low, high IndexKey, inclusion Inclusion,
+	callb EntryCallback) error {
+
+	if inclusion != Both || low.Bytes() == nil || !bytes.Equal(low.Bytes(), high.Bytes()) {
+		return ErrHashIndexRangeScan
+	}
+
+	var cmpFn CmpEntry
+	if s.isPrimary() {
+		cmpFn = compareExact
+	} else {
+		cmpFn = comparePrefix
+	}
+
+	return s.lookup(low, cmpFn, callb)
+}
+
+func (s *hashSnapshot) All(ctx IndexReaderContext, callb EntryCallback) error {
+	return ErrHashIndexRangeScan
+}
+
+func (s *hashSnapshot) lookup(key IndexKey, cmpFn CmpEntry, callb EntryCallback) error {
+
+	hkey := key.Bytes()
+	if !s.isPrimary() {
+		b := bloomFilterKeyPool.Get().(*bloomFilterKeyBuf)
+		defer bloomFilterKeyPool.Put(b)
+
+		var err error
+		hkey, err = bloomFilterKey(hkey, b)
+		if err == errBloomFilterNoKey {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	var entry IndexEntry
+	entries := s.info.snap.Lookup(hkey, func(b []byte) bool {
+		s.newIndexEntry(b, &entry)
+		return cmpFn(key, entry) == 0
+	})
+
+	for _, b := range entries {
+		if err := callb(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *hashSnapshot) isPrimary() bool {
+	return s.slice.isPrimary
+}
+
+func (s *hashSnapshot) newIndexEntry(b []byte, entry *IndexEntry) {
+	var err error
+
+	if s.slice.isPrimary {
+		*entry, err = BytesToPrimaryIndexEntry(b)
+	} else {
+		*entry, err = BytesToSecondaryIndexEntry(b)
+	}
+	common.CrashOnError(err)
+}
@@ -0,0 +1,181 @@
+package indexer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func newTestHashSlice(t *testing.T) (*hashSlice, func()) {
+
+	dir, err := ioutil.TempDir("", "hashslice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := &IndexStats{}
+	stats.Init()
+	cfg := common.SystemConfig.SectionConfig("indexer.", true)
+	idxDefn := common.IndexDefn{DefnId: common.IndexDefnId(1), Using: common.HashIndex}
+
+	slice, err := NewHashSlice(dir, SliceId(0), idxDefn, common.IndexInstId(1), common.PartitionId(0),
+		false, false, cfg, stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return slice, func() {
+		slice.Destroy()
+		os.RemoveAll(dir)
+	}
+}
+
+func hashSliceInsert(t *testing.T, slice *hashSlice, key string, docid string) {
+
+	code, err := jsonEncoder.Encode([]byte(key), make([]byte, 0, 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := slice.Insert(code, []byte(docid), NewMutationMeta()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hashSliceKey(t *testing.T, key string) IndexKey {
+
+	k, err := NewSecondaryKey([]byte(key), make([]byte, 0, 1024), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func hashSnapshotRange(t *testing.T, snap Snapshot, low, high IndexKey, inclusion Inclusion) []string {
+
+	var docids []string
+	err := snap.Range(nil, low, high, inclusion, func(entry []byte) error {
+		docid, err := secondaryIndexEntry(entry).ReadDocId(nil)
+		if err != nil {
+			return err
+		}
+		docids = append(docids, string(docid))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return docids
+}
+
+func TestHashSliceScan(t *testing.T) {
+
+	slice, cleanup := newTestHashSlice(t)
+	defer cleanup()
+
+	hashSliceInsert(t, slice, `["c",1]`, "doc1")
+	hashSliceInsert(t, slice, `["a",2]`, "doc2")
+	hashSliceInsert(t, slice, `["b",3]`, "doc3")
+	hashSliceInsert(t, slice, `["a",1]`, "doc4")
+	hashSliceInsert(t, slice, `["d",1]`, "doc5")
+
+	info, err := slice.NewSnapshot(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := slice.OpenSnapshot(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	// later mutations are not in the snapshot
+	hashSliceInsert(t, slice, `["a",3]`, "doc6")
+
+	a, b, d := hashSliceKey(t, `["a"]`), hashSliceKey(t, `["b"]`), hashSliceKey(t, `["d"]`)
+
+	// equality lookups of the leading key
+	tests := []struct {
+		key    IndexKey
+		docids string
+	}{
+		{a, "[doc4 doc2]"},
+		{hashSliceKey(t, `["a",2]`), "[doc2]"},
+		{hashSliceKey(t, `["e"]`), "[]"},
+	}
+
+	for i, test := range tests {
+		if docids := hashSnapshotRange(t, snap, test.key, test.key, Both); fmt.Sprint(docids) != test.docids {
+			t.Fatalf("test %v: expected %v, got %v", i, test.docids, docids)
+		}
+	}
+
+	// other ranges and full scans are rejected
+	ranges := []struct {
+		low, high IndexKey
+		inclusion Inclusion
+	}{
+		{MinIndexKey, MaxIndexKey, Both},
+		{a, d, Both},
+		{b, MaxIndexKey, Low},
+		{a, a, Neither},
+	}
+
+	callb := func([]byte) error { return nil }
+	for i, test := range ranges {
+		if err := snap.Range(nil, test.low, test.high, test.inclusion, callb); err != ErrHashIndexRangeScan {
+			t.Fatalf("range %v: expected %v, got %v", i, ErrHashIndexRangeScan, err)
+		}
+	}
+	if err := snap.All(nil, callb); err != ErrHashIndexRangeScan {
+		t.Fatalf("expected %v for full scan, got %v", ErrHashIndexRangeScan, err)
+	}
+	if _, err := snap.CountRange(nil, a, d, Both, nil); err != ErrHashIndexRangeScan {
+		t.Fatalf("expected %v for range count, got %v", ErrHashIndexRangeScan, err)
+	}
+	if n, err := snap.CountTotal(nil, nil); err != nil || n != 5 {
+		t.Fatalf("expected 5 entries, got %v %v", n, err)
+	}
+
+	// lookups match whole keys
+	keys := []IndexKey{a, hashSliceKey(t, `["a",1]`), hashSliceKey(t, `["b",3]`)}
+	if n, err := snap.CountLookup(nil, keys, nil); err != nil || n != 2 {
+		t.Fatalf("expected 2 entries, got %v %v", n, err)
+	}
+}
+
+func TestHashSliceUpdate(t *testing.T) {
+
+	slice, cleanup := newTestHashSlice(t)
+	defer cleanup()
+
+	hashSliceInsert(t, slice, `["a"]`, "doc1")
+	hashSliceInsert(t, slice, `["b"]`, "doc1")
+	hashSliceInsert(t, slice, `["b"]`, "doc2")
+	if err := slice.Delete([]byte("doc2"), NewMutationMeta()); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := slice.NewSnapshot(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := slice.OpenSnapshot(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	a, b := hashSliceKey(t, `["a"]`), hashSliceKey(t, `["b"]`)
+	if docids := hashSnapshotRange(t, snap, a, a, Both); len(docids) != 0 {
+		t.Fatalf("unexpected entries of a %v", docids)
+	}
+	if docids := hashSnapshotRange(t, snap, b, b, Both); fmt.Sprint(docids) != "[doc1]" {
+		t.Fatalf("unexpected entries of b %v", docids)
+	}
+	if n := slice.GetCommittedCount(); n != 1 {
+		t.Fatalf("expected 1 item, got %v", n)
+	}
+}
@@ -0,0 +1,440 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"hash/crc32"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Approximate memory used by an item, a bucket or a docid besides its bytes
+const hashItemOverhead = 48
+
+// Memory used by the hash stores of all the slices.  It is part of the
+// memory used by the storage of the indexer.
+var gHashStoreMemory int64
+
+func hashStoreMemoryInUse() int64 {
+	return atomic.LoadInt64(&gHashStoreMemory)
+}
+
+// Garbage collection of the whole store is triggered once there is more
+// garbage than this, and more than a quarter of the items
+const hashMinGarbage = 10000
+
+// hashItem is an index entry of a hash store.  An item is visible to the
+// snapshots taken after it is added (born) and before it is removed (dead).
+type hashItem struct {
+	entry []byte
+	born  uint64
+	dead  uint64
+}
+
+func (itm *hashItem) visible(sn uint64) bool {
+	dead := atomic.LoadUint64(&itm.dead)
+	return itm.born <= sn && (dead == 0 || dead > sn)
+}
+
+// collectible returns true if no snapshot from gcSn on can see the item.
+// An item removed before the first snapshot which could see it is never
+// visible.
+func (itm *hashItem) collectible(gcSn uint64) bool {
+	dead := atomic.LoadUint64(&itm.dead)
+	return dead != 0 && (dead <= gcSn || dead <= itm.born)
+}
+
+type hashShard struct {
+	mutex   sync.RWMutex
+	buckets map[string][]*hashItem
+}
+
+// hashRef is the item of a docid, and the key of its bucket
+type hashRef struct {
+	item *hashItem
+	key  string
+}
+
+type hashDocShard struct {
+	mutex sync.Mutex
+	docs  map[string]hashRef
+}
+
+// hashStore is a hash table of index entries, with snapshot isolation.
+// Entries are grouped in buckets by key, and the buckets are spread over
+// shards, each with its own lock.  For secondary indexes, the store also
+// keeps the item of each docid (the back index), in shards of docids.
+//
+// Writes happen in the interval currSn.  A snapshot sees the items added
+// up to its interval, and not removed by then.  Removed items are freed
+// once no open snapshot can see them, when their bucket is written or
+// when the store is garbage collected.
+type hashStore struct {
+	shards    []*hashShard
+	docShards []*hashDocShard
+	isPrimary bool
+
+	currSn   uint64
+	gcSn     uint64
+	count    int64
+	garbage  int64
+	memUsed  int64
+	gcActive int32
+	freed    int32
+
+	snapLock sync.Mutex
+	snaps    map[uint64]int
+}
+
+func newHashStore(numShards int, isPrimary bool) *hashStore {
+
+	if numShards <= 0 {
+		numShards = 1
+	}
+
+	h := &hashStore{
+		shards:    make([]*hashShard, numShards),
+		isPrimary: isPrimary,
+		currSn:    1,
+		gcSn:      1,
+		snaps:     make(map[uint64]int),
+	}
+
+	for i := range h.shards {
+		h.shards[i] = &hashShard{buckets: make(map[string][]*hashItem)}
+	}
+
+	if !isPrimary {
+		h.docShards = make([]*hashDocShard, numShards)
+		for i := range h.docShards {
+			h.docShards[i] = &hashDocShard{docs: make(map[string]hashRef)}
+		}
+	}
+
+	return h
+}
+
+func (h *hashStore) shard(key []byte) *hashShard {
+	return h.shards[crc32.ChecksumIEEE(key)%uint32(len(h.shards))]
+}
+
+func (h *hashStore) docShard(docid []byte) *hashDocShard {
+	return h.docShards[crc32.ChecksumIEEE(docid)%uint32(len(h.docShards))]
+}
+
+// Put adds entry to bucket key.  For secondary indexes, the previous entry
+// of docid is removed.  It returns false if the entry already exists, and
+// the removed entry if any.
+func (h *hashStore) Put(key []byte, entry []byte, docid []byte) (bool, []byte) {
+
+	if h.isPrimary {
+		shard := h.shard(key)
+		shard.mutex.Lock()
+		defer shard.mutex.Unlock()
+
+		for _, itm := range shard.buckets[string(key)] {
+			if atomic.LoadUint64(&itm.dead) == 0 && bytes.Equal(itm.entry, entry) {
+				return false, nil
+			}
+		}
+
+		h.addNoLock(shard, string(key), entry)
+		return true, nil
+	}
+
+	ds := h.docShard(docid)
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	var old []byte
+	ref, ok := ds.docs[string(docid)]
+	if ok {
+		if bytes.Equal(ref.item.entry, entry) {
+			return false, nil
+		}
+		old = h.remove(ref)
+	} else {
+		h.addMemUsed(int64(len(docid) + hashItemOverhead))
+	}
+
+	k := string(key)
+	shard := h.shard(key)
+	shard.mutex.Lock()
+	itm := h.addNoLock(shard, k, entry)
+	shard.mutex.Unlock()
+
+	ds.docs[string(docid)] = hashRef{item: itm, key: k}
+	return true, old
+}
+
+// Delete removes the entry of docid, or for primary indexes entry key.  It
+// returns the removed entry if any.
+func (h *hashStore) Delete(key []byte, docid []byte) []byte {
+
+	if h.isPrimary {
+		shard := h.shard(key)
+		shard.mutex.Lock()
+		defer shard.mutex.Unlock()
+
+		for _, itm := range shard.buckets[string(key)] {
+			if atomic.LoadUint64(&itm.dead) == 0 && bytes.Equal(itm.entry, key) {
+				h.killNoLock(shard, string(key), itm)
+				return itm.entry
+			}
+		}
+		return nil
+	}
+
+	ds := h.docShard(docid)
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	ref, ok := ds.docs[string(docid)]
+	if !ok {
+		return nil
+	}
+
+	delete(ds.docs, string(docid))
+	h.addMemUsed(-int64(len(docid) + hashItemOverhead))
+	return h.remove(ref)
+}
+
+func (h *hashStore) addNoLock(shard *hashShard, key string, entry []byte) *hashItem {
+
+	itm := &hashItem{
+		entry: append([]byte(nil), entry...),
+		born:  atomic.LoadUint64(&h.currSn),
+	}
+
+	bucket, ok := shard.buckets[key]
+	if !ok {
+		h.addMemUsed(int64(len(key) + hashItemOverhead))
+	}
+	shard.buckets[key] = append(bucket, itm)
+
+	atomic.AddInt64(&h.count, 1)
+	h.addMemUsed(int64(len(entry) + hashItemOverhead))
+	return itm
+}
+
+func (h *hashStore) remove(ref hashRef) []byte {
+
+	shard := h.shard([]byte(ref.key))
+	shard.mutex.Lock()
+	h.killNoLock(shard, ref.key, ref.item)
+	shard.mutex.Unlock()
+
+	return ref.item.entry
+}
+
+func (h *hashStore) killNoLock(shard *hashShard, key string, itm *hashItem) {
+
+	atomic.StoreUint64(&itm.dead, atomic.LoadUint64(&h.currSn))
+	atomic.AddInt64(&h.count, -1)
+	atomic.AddInt64(&h.garbage, 1)
+
+	h.pruneNoLock(shard, key)
+}
+
+// pruneNoLock frees the collectible items of bucket key.
+func (h *hashStore) pruneNoLock(shard *hashShard, key string) {
+
+	gcSn := atomic.LoadUint64(&h.gcSn)
+	bucket := shard.buckets[key]
+
+	n := 0
+	for _, itm := range bucket {
+		if itm.collectible(gcSn) {
+			atomic.AddInt64(&h.garbage, -1)
+			h.addMemUsed(-int64(len(itm.entry) + hashItemOverhead))
+			continue
+		}
+		bucket[n] = itm
+		n++
+	}
+
+	if n == len(bucket) {
+		return
+	}
+
+	for i := n; i < len(bucket); i++ {
+		bucket[i] = nil
+	}
+
+	if n == 0 {
+		delete(shard.buckets, key)
+		h.addMemUsed(-int64(len(key) + hashItemOverhead))
+	} else {
+		shard.buckets[key] = bucket[:n]
+	}
+}
+
+// NeedsGC returns true if enough removed items are waiting to be freed.
+func (h *hashStore) NeedsGC() bool {
+	garbage := atomic.LoadInt64(&h.garbage)
+	return garbage > hashMinGarbage && garbage > atomic.LoadInt64(&h.count)/4
+}
+
+// GC frees the collectible items of all the buckets.
+func (h *hashStore) GC() {
+
+	if !atomic.CompareAndSwapInt32(&h.gcActive, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&h.gcActive, 0)
+
+	for _, shard := range h.shards {
+		shard.mutex.Lock()
+		for key := range shard.buckets {
+			h.pruneNoLock(shard, key)
+		}
+		shard.mutex.Unlock()
+	}
+}
+
+func (h *hashStore) ItemsCount() int64 {
+	return atomic.LoadInt64(&h.count)
+}
+
+func (h *hashStore) MemoryInUse() int64 {
+	return atomic.LoadInt64(&h.memUsed)
+}
+
+func (h *hashStore) addMemUsed(delta int64) {
+	atomic.AddInt64(&h.memUsed, delta)
+	if atomic.LoadInt32(&h.freed) == 0 {
+		atomic.AddInt64(&gHashStoreMemory, delta)
+	}
+}
+
+// Free removes the memory of the store from the memory used by the hash
+// stores, when the store is dropped.
+func (h *hashStore) Free() {
+	if atomic.CompareAndSwapInt32(&h.freed, 0, 1) {
+		atomic.AddInt64(&gHashStoreMemory, -atomic.LoadInt64(&h.memUsed))
+	}
+}
+
+// NewSnapshot ends the current write interval.  The snapshot sees all the
+// writes so far.  It must be closed once done.
+func (h *hashStore) NewSnapshot() *hashStoreSnapshot {
+
+	h.snapLock.Lock()
+	defer h.snapLock.Unlock()
+
+	sn := atomic.AddUint64(&h.currSn, 1) - 1
+	h.snaps[sn]++
+	h.updateGcSnNoLock()
+
+	return &hashStoreSnapshot{
+		store:    h,
+		sn:       sn,
+		count:    atomic.LoadInt64(&h.count),
+		refCount: 1,
+	}
+}
+
+func (h *hashStore) release(sn uint64) {
+
+	h.snapLock.Lock()
+	defer h.snapLock.Unlock()
+
+	h.snaps[sn]--
+	if h.snaps[sn] == 0 {
+		delete(h.snaps, sn)
+	}
+	h.updateGcSnNoLock()
+}
+
+func (h *hashStore) updateGcSnNoLock() {
+
+	gcSn := atomic.LoadUint64(&h.currSn)
+	for sn := range h.snaps {
+		if sn < gcSn {
+			gcSn = sn
+		}
+	}
+	atomic.StoreUint64(&h.gcSn, gcSn)
+}
+
+type hashStoreSnapshot struct {
+	store    *hashStore
+	sn       uint64
+	count    int64
+	refCount int32
+}
+
+func (s *hashStoreSnapshot) Open() {
+	atomic.AddInt32(&s.refCount, 1)
+}
+
+func (s *hashStoreSnapshot) Close() {
+	if atomic.AddInt32(&s.refCount, -1) == 0 {
+		s.store.release(s.sn)
+	}
+}
+
+func (s *hashStoreSnapshot) Count() int64 {
+	return s.count
+}
+
+// Lookup returns the sorted entries of bucket key which match.
+func (s *hashStoreSnapshot) Lookup(key []byte, match func([]byte) bool) [][]byte {
+
+	var entries [][]byte
+
+	shard := s.store.shard(key)
+	shard.mutex.RLock()
+	for _, itm := range shard.buckets[string(key)] {
+		if itm.visible(s.sn) && (match == nil || match(itm.entry)) {
+			entries = append(entries, itm.entry)
+		}
+	}
+	shard.mutex.RUnlock()
+
+	sortHashEntries(entries)
+	return entries
+}
+
+// ForEach calls fn with all the entries, in no particular order.  The
+// lock of a shard is not held while fn is called.
+func (s *hashStoreSnapshot) ForEach(fn func([]byte) error) error {
+
+	var entries [][]byte
+	for _, shard := range s.store.shards {
+		entries = entries[:0]
+
+		shard.mutex.RLock()
+		for _, bucket := range shard.buckets {
+			for _, itm := range bucket {
+				if itm.visible(s.sn) {
+					entries = append(entries, itm.entry)
+				}
+			}
+		}
+		shard.mutex.RUnlock()
+
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func sortHashEntries(entries [][]byte) {
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i], entries[j]) < 0
+	})
+}
@@ -0,0 +1,124 @@
+package indexer
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"testing"
+)
+
+func hashStoreEntries(snap *hashStoreSnapshot) []string {
+
+	var entries []string
+	snap.ForEach(func(entry []byte) error {
+		entries = append(entries, string(entry))
+		return nil
+	})
+	sort.Strings(entries)
+	return entries
+}
+
+func TestHashStoreSnapshot(t *testing.T) {
+
+	h := newHashStore(4, false)
+	defer h.Free()
+
+	h.Put([]byte("a"), []byte("a/doc1"), []byte("doc1"))
+	h.Put([]byte("b"), []byte("b/doc2"), []byte("doc2"))
+	snap1 := h.NewSnapshot()
+
+	// an update of doc1 removes its previous entry
+	if added, old := h.Put([]byte("b"), []byte("b/doc1"), []byte("doc1")); !added || string(old) != "a/doc1" {
+		t.Fatalf("expected a/doc1 to be replaced, got %v %s", added, old)
+	}
+	if added, _ := h.Put([]byte("b"), []byte("b/doc1"), []byte("doc1")); added {
+		t.Fatal("unexpected duplicate entry")
+	}
+	h.Delete(nil, []byte("doc2"))
+	snap2 := h.NewSnapshot()
+
+	// snapshots do not see later writes
+	if entries := hashStoreEntries(snap1); fmt.Sprint(entries) != "[a/doc1 b/doc2]" {
+		t.Fatalf("unexpected entries of first snapshot %v", entries)
+	}
+	if entries := hashStoreEntries(snap2); fmt.Sprint(entries) != "[b/doc1]" {
+		t.Fatalf("unexpected entries of second snapshot %v", entries)
+	}
+	if n := snap1.Count(); n != 2 {
+		t.Fatalf("expected 2 items in first snapshot, got %v", n)
+	}
+
+	if entries := snap1.Lookup([]byte("b"), nil); len(entries) != 1 || string(entries[0]) != "b/doc2" {
+		t.Fatalf("unexpected lookup of b in first snapshot %q", entries)
+	}
+	if entries := snap2.Lookup([]byte("a"), nil); len(entries) != 0 {
+		t.Fatalf("unexpected lookup of a in second snapshot %q", entries)
+	}
+
+	// removed items are freed once no snapshot can see them
+	snap1.Close()
+	h.NewSnapshot().Close()
+	h.GC()
+	if garbage := atomic.LoadInt64(&h.garbage); garbage != 0 {
+		t.Fatalf("expected no garbage, got %v", garbage)
+	}
+	if entries := hashStoreEntries(snap2); fmt.Sprint(entries) != "[b/doc1]" {
+		t.Fatalf("unexpected entries of second snapshot after gc %v", entries)
+	}
+	snap2.Close()
+}
+
+func TestHashStorePrimary(t *testing.T) {
+
+	h := newHashStore(4, true)
+	defer h.Free()
+
+	if added, _ := h.Put([]byte("doc1"), []byte("doc1"), []byte("doc1")); !added {
+		t.Fatal("expected doc1 to be added")
+	}
+	if added, _ := h.Put([]byte("doc1"), []byte("doc1"), []byte("doc1")); added {
+		t.Fatal("unexpected duplicate doc1")
+	}
+	if old := h.Delete([]byte("doc1"), []byte("doc1")); string(old) != "doc1" {
+		t.Fatalf("expected doc1 to be deleted, got %s", old)
+	}
+	if old := h.Delete([]byte("doc1"), []byte("doc1")); old != nil {
+		t.Fatalf("unexpected delete of %s", old)
+	}
+	if n := h.ItemsCount(); n != 0 {
+		t.Fatalf("expected no items, got %v", n)
+	}
+}
+
+func TestHashStoreMemory(t *testing.T) {
+
+	before := hashStoreMemoryInUse()
+
+	h := newHashStore(4, false)
+	for i := 0; i < 100; i++ {
+		docid := []byte(fmt.Sprintf("doc%v", i))
+		h.Put([]byte(fmt.Sprintf("key%v", i%10)), append([]byte("entry/"), docid...), docid)
+	}
+
+	used := h.MemoryInUse()
+	if used <= 0 || hashStoreMemoryInUse()-before != used {
+		t.Fatalf("expected %v bytes of hash stores, got %v", used, hashStoreMemoryInUse()-before)
+	}
+
+	// the memory of deleted items is released once they are freed
+	for i := 0; i < 100; i++ {
+		h.Delete(nil, []byte(fmt.Sprintf("doc%v", i)))
+	}
+	h.NewSnapshot().Close()
+	h.GC()
+	if used := h.MemoryInUse(); used != 0 {
+		t.Fatalf("expected no memory used, got %v", used)
+	}
+
+	h.Put([]byte("key"), []byte("entry/doc"), []byte("doc"))
+	h.Free()
+	h.Free()
+	if mem := hashStoreMemoryInUse(); mem != before {
+		t.Fatalf("expected %v bytes of hash stores after free, got %v", before, mem)
+	}
+}
@@ -0,0 +1,429 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/manager"
+	"github.com/couchbase/indexing/secondary/manager/client"
+	mc "github.com/couchbase/indexing/secondary/manager/common"
+)
+
+var IDLE_INDEX_CHECK_INTERVAL = 60 // Seconds
+
+// the time an index is first found without any scan, for the indexes which
+// have never been scanned.  It is only kept on the maintenance node.
+var gIdleSince = make(map[common.IndexDefnId]time.Time)
+var gIdleSinceLck sync.Mutex
+
+//
+// IdleIndex is an index which has not been scanned for the number of days
+// given by settings.idle_index.days, or by settings.idle_index.bucket_days
+// for its bucket.  LastScanTime is not set if the index has never been
+// scanned.
+//
+type IdleIndex struct {
+	DefnId       common.IndexDefnId `json:"defnId"`
+	Bucket       string             `json:"bucket"`
+	Scope        string             `json:"scope"`
+	Collection   string             `json:"collection"`
+	Name         string             `json:"name"`
+	LastScanTime *time.Time         `json:"lastScanTime,omitempty"`
+	IdleDays     int                `json:"idleDays"`
+	Dropped      bool               `json:"dropped,omitempty"`
+	Error        string             `json:"error,omitempty"`
+}
+
+//
+// IdleIndexes is the response of /idleIndexes
+//
+type IdleIndexes struct {
+	Enabled    bool         `json:"enabled"`
+	AutoDrop   bool         `json:"autoDrop"`
+	Candidates []*IdleIndex `json:"candidates"`
+}
+
+//
+// processIdleIndexes periodically looks for the indexes which have not been
+// scanned for settings.idle_index.days.  The idle indexes are only flagged,
+// unless settings.idle_index.auto_drop is set.  A dropped index leaves a
+// stopped schedule create token with its definition, so it can be created
+// again with /recreateIdleIndex.  It is run by the maintenance node, as
+// replica repair.
+//
+func (m *DDLServiceMgr) processIdleIndexes() {
+
+	ticker := time.NewTicker(time.Duration(IDLE_INDEX_CHECK_INTERVAL) * time.Second)
+	defer ticker.Stop()
+
+	var lastCheck time.Time
+	flagged := make(map[common.IndexDefnId]bool)
+
+	for {
+		select {
+		case <-ticker.C:
+			config := m.config.Load()
+			if !config["settings.idle_index.enable"].Bool() {
+				continue
+			}
+
+			interval := time.Duration(config["settings.idle_index.interval"].Int()) * time.Second
+			if time.Since(lastCheck) < interval {
+				continue
+			}
+			lastCheck = time.Now()
+
+			if !m.canProcessDDL() {
+				logging.Debugf("DDLServiceMgr: cannot check idle index during rebalancing")
+				continue
+			}
+
+			if !m.isMaintenanceNode() {
+				continue
+			}
+
+			candidates, err := m.findIdleIndexes(config)
+			if err != nil {
+				logging.Errorf("DDLServiceMgr: Failed to find idle indexes.  Error = %v", err)
+				continue
+			}
+
+			if config["settings.idle_index.auto_drop"].Bool() {
+				m.dropIdleIndexes(candidates)
+				continue
+			}
+
+			idle := make(map[common.IndexDefnId]bool)
+			for _, index := range candidates {
+				if !flagged[index.DefnId] {
+					logging.Warnf("DDLServiceMgr: Index (%v, %v, %v, %v) has not been scanned for %v days.",
+						index.Bucket, index.Scope, index.Collection, index.Name, index.IdleDays)
+				}
+				idle[index.DefnId] = true
+			}
+			flagged = idle
+
+		case <-m.killch:
+			logging.Infof("DDLServiceMgr: Stop idle index check")
+			return
+		}
+	}
+}
+
+//
+// parseIdleIndexDays parses a comma separated list of bucket:days, e.g.
+// "travel-sample:7,beer-sample:0".
+//
+func parseIdleIndexDays(spec string) (map[string]int, error) {
+
+	result := make(map[string]int)
+	for _, str := range strings.Split(spec, ",") {
+		if strings.TrimSpace(str) == "" {
+			continue
+		}
+
+		i := strings.LastIndex(str, ":")
+		if i == -1 {
+			return nil, fmt.Errorf("Invalid idle index days %q", str)
+		}
+
+		bucket := strings.TrimSpace(str[:i])
+		days, err := strconv.Atoi(strings.TrimSpace(str[i+1:]))
+		if bucket == "" || err != nil || days < 0 {
+			return nil, fmt.Errorf("Invalid idle index days %q", str)
+		}
+
+		result[bucket] = days
+	}
+
+	return result, nil
+}
+
+//
+// findIdleIndexes returns the indexes which are ready on all their
+// replicas, and have not been scanned on any replica for the idle days of
+// their bucket.
+//
+func (m *DDLServiceMgr) findIdleIndexes(config common.Config) ([]*IdleIndex, error) {
+
+	bucketDays, err := parseIdleIndexDays(config["settings.idle_index.bucket_days"].String())
+	if err != nil {
+		return nil, err
+	}
+	defaultDays := config["settings.idle_index.days"].Int()
+
+	resp, err := getWithAuth(m.localAddr + "/getIndexStatus?getAll=true")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	statusResp := new(manager.IndexStatusResponse)
+	bytes, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(bytes, &statusResp); err != nil {
+		return nil, err
+	}
+
+	if len(statusResp.FailedNodes) != 0 {
+		return nil, fmt.Errorf("Unable to get index status from nodes %v", statusResp.FailedNodes)
+	}
+
+	ready := make(map[common.IndexDefnId]bool)
+	indexes := make(map[common.IndexDefnId]*IdleIndex)
+	for _, status := range statusResp.Status {
+
+		if _, ok := ready[status.DefnId]; !ok {
+			ready[status.DefnId] = true
+		}
+		ready[status.DefnId] = ready[status.DefnId] && status.Status == "Ready"
+
+		index, ok := indexes[status.DefnId]
+		if !ok {
+			index = &IdleIndex{
+				DefnId:     status.DefnId,
+				Bucket:     status.Bucket,
+				Scope:      status.Scope,
+				Collection: status.Collection,
+				Name:       status.IndexName,
+			}
+			indexes[status.DefnId] = index
+		}
+
+		if scanTime, err := time.Parse(time.UnixDate, status.LastScanTime); err == nil {
+			if index.LastScanTime == nil || scanTime.After(*index.LastScanTime) {
+				index.LastScanTime = &scanTime
+			}
+		}
+	}
+
+	gIdleSinceLck.Lock()
+	defer gIdleSinceLck.Unlock()
+
+	now := time.Now()
+	idleSince := make(map[common.IndexDefnId]time.Time)
+
+	result := make([]*IdleIndex, 0)
+	for defnId, index := range indexes {
+		if !ready[defnId] {
+			continue
+		}
+
+		since := now
+		if index.LastScanTime != nil {
+			since = *index.LastScanTime
+		} else {
+			if first, ok := gIdleSince[defnId]; ok {
+				since = first
+			}
+			idleSince[defnId] = since
+		}
+
+		days, ok := bucketDays[index.Bucket]
+		if !ok {
+			days = defaultDays
+		}
+
+		index.IdleDays = int(now.Sub(since) / (24 * time.Hour))
+		if days > 0 && index.IdleDays >= days {
+			result = append(result, index)
+		}
+	}
+
+	gIdleSince = idleSince
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DefnId < result[j].DefnId
+	})
+
+	return result, nil
+}
+
+func (m *DDLServiceMgr) dropIdleIndexes(candidates []*IdleIndex) {
+
+	if len(candidates) == 0 {
+		return
+	}
+
+	provider, _, err := newMetadataProvider(m.clusterAddr, nil, m.settings, "DDLServiceMgr")
+	if err != nil {
+		logging.Errorf("DDLServiceMgr: Failed to start metadata provider for idle index.  Internal Error = %v", err)
+		return
+	}
+	defer provider.Close()
+
+	for _, index := range candidates {
+		if err := m.dropIdleIndex(provider, index); err != nil {
+			logging.Errorf("DDLServiceMgr: Failed to drop idle index (%v, %v, %v, %v).  Error = %v",
+				index.Bucket, index.Scope, index.Collection, index.Name, err)
+			index.Error = err.Error()
+		}
+	}
+}
+
+//
+// dropIdleIndex drops the index, after saving its definition in a schedule
+// create token.  A stop schedule create token is posted first, so that the
+// index is not created again until /recreateIdleIndex.
+//
+func (m *DDLServiceMgr) dropIdleIndex(provider *client.MetadataProvider, index *IdleIndex) error {
+
+	meta := provider.FindIndexIgnoreStatus(index.DefnId)
+	if meta == nil || meta.Definition == nil {
+		return fmt.Errorf("Index %v does not exist", index.DefnId)
+	}
+
+	bucketUUID, err := common.GetBucketUUID(m.clusterAddr, index.Bucket)
+	if err != nil {
+		return err
+	}
+
+	scopeId, collectionId, err := common.GetScopeAndCollectionID(m.clusterAddr, index.Bucket, index.Scope, index.Collection)
+	if err != nil {
+		return err
+	}
+
+	defnId, err := common.NewIndexDefnId()
+	if err != nil {
+		return err
+	}
+
+	defn := *meta.Definition
+	defn.DefnId = defnId
+	defn.InstId = 0
+	defn.RealInstId = 0
+	defn.ReplicaId = 0
+	defn.InstVersion = 0
+	defn.Partitions = nil
+	defn.Versions = nil
+	defn.Nodes = nil
+
+	reason := fmt.Sprintf("Index %v was dropped after %v days without scan.  Use /recreateIdleIndex?defnId=%v to create it again.",
+		index.Name, index.IdleDays, defnId)
+
+	if err := mc.PostStopScheduleCreateToken(defnId, reason, time.Now().UnixNano()); err != nil {
+		return err
+	}
+
+	if err := mc.PostScheduleCreateToken(defn, map[string]interface{}{}, bucketUUID, scopeId, collectionId,
+		m.indexerId, time.Now().UnixNano()); err != nil {
+		return err
+	}
+
+	logging.Infof("DDLServiceMgr: Drop index (%v, %v, %v, %v) after %v days without scan.  Saved as schedule create token %v.",
+		index.Bucket, index.Scope, index.Collection, index.Name, index.IdleDays, defnId)
+
+	if err := provider.DropIndex(index.DefnId); err != nil {
+		return err
+	}
+
+	index.Dropped = true
+	return nil
+}
+
+//
+// handleIdleIndexes lists the indexes which have not been scanned for the
+// idle days of their bucket.
+//
+func (m *DDLServiceMgr) handleIdleIndexes(w http.ResponseWriter, r *http.Request) {
+
+	if !m.validateAuth(w, r) {
+		logging.Errorf("DDLServiceMgr::handleIdleIndexes Validation Failure for Request %v", logging.TagUD(r))
+		return
+	}
+
+	if r.Method != "GET" {
+		send(http.StatusBadRequest, w, "Unsupported Method")
+		return
+	}
+
+	config := m.config.Load()
+	candidates, err := m.findIdleIndexes(config)
+	if err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+
+	send(http.StatusOK, w, &IdleIndexes{
+		Enabled:    config["settings.idle_index.enable"].Bool(),
+		AutoDrop:   config["settings.idle_index.auto_drop"].Bool(),
+		Candidates: candidates,
+	})
+}
+
+//
+// handleRecreateIdleIndex creates an index dropped by the idle index policy
+// again.  The defnId parameter is the definition id of its schedule create
+// token.  The index is created in the background by the scheduled index
+// creator, and its status is reported by /getIndexStatus.
+//
+func (m *DDLServiceMgr) handleRecreateIdleIndex(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := m.validateAuthCreds(w, r)
+	if !ok {
+		logging.Errorf("DDLServiceMgr::handleRecreateIdleIndex Validation Failure for Request %v", logging.TagUD(r))
+		return
+	}
+
+	if r.Method != "POST" {
+		send(http.StatusBadRequest, w, "Unsupported Method")
+		return
+	}
+
+	id, err := strconv.ParseUint(r.FormValue("defnId"), 10, 64)
+	if err != nil {
+		send(http.StatusBadRequest, w, fmt.Sprintf("Invalid defnId %q", r.FormValue("defnId")))
+		return
+	}
+	defnId := common.IndexDefnId(id)
+
+	token, err := mc.GetScheduleCreateToken(defnId)
+	if err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+	if token == nil {
+		send(http.StatusNotFound, w, fmt.Sprintf("Schedule create token %v does not exist", defnId))
+		return
+	}
+
+	defn := token.Definition
+	permission := fmt.Sprintf("cluster.collection[%s:%s:%s].n1ql.index!create", defn.Bucket, defn.Scope, defn.Collection)
+	if !common.IsAllowed(creds, []string{permission}, w) {
+		return
+	}
+
+	if err := mc.DeleteStopScheduleCreateToken(defnId); err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+
+	// Post the token again, so that the scheduled index creator picks it up
+	if err := mc.PostScheduleCreateToken(defn, token.Plan, token.BucketUUID, token.ScopeId, token.CollectionId,
+		token.IndexerId, time.Now().UnixNano()); err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+
+	logging.Infof("DDLServiceMgr::handleRecreateIdleIndex Recreate index (%v, %v, %v, %v) from schedule create token %v",
+		defn.Bucket, defn.Scope, defn.Collection, defn.Name, defnId)
+
+	send(http.StatusOK, w, "OK")
+}
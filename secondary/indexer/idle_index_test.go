@@ -0,0 +1,31 @@
+package indexer
+
+import (
+	"testing"
+)
+
+func TestParseIdleIndexDays(t *testing.T) {
+
+	days, err := parseIdleIndexDays(" travel-sample:7, beer-sample : 0,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 2 || days["travel-sample"] != 7 || days["beer-sample"] != 0 {
+		t.Fatalf("unexpected days %v", days)
+	}
+
+	if days, err := parseIdleIndexDays(""); err != nil || len(days) != 0 {
+		t.Fatalf("empty: unexpected days %v err %v", days, err)
+	}
+
+	// the last colon separates the days
+	if days, err := parseIdleIndexDays("a:b:3"); err != nil || days["a:b"] != 3 {
+		t.Fatalf("unexpected days %v err %v", days, err)
+	}
+
+	for _, bad := range []string{"travel-sample", "travel-sample:", "travel-sample:x", "travel-sample:-1", ":7"} {
+		if days, err := parseIdleIndexDays(bad); err == nil {
+			t.Fatalf("%q: expected error, got %v", bad, days)
+		}
+	}
+}
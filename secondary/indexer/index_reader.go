@@ -58,6 +58,12 @@ type Ranger interface {
 	Range(IndexReaderContext, IndexKey, IndexKey, Inclusion, EntryCallback) error
 }
 
+// ReverseRanger is a class of algorithms that can extract a range of keys
+// from the index in descending order.
+type ReverseRanger interface {
+	ReverseRange(IndexReaderContext, IndexKey, IndexKey, Inclusion, EntryCallback) error
+}
+
 // RangeCounter is a class of algorithms that can count a range efficiently
 type RangeCounter interface {
 	CountRange(ctx IndexReaderContext, low, high IndexKey, inclusion Inclusion, stopch StopChannel) (
@@ -0,0 +1,209 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// Maximum number of findings logged for a single partition in one run
+const SCRUB_MAX_LOGGED_ERRORS = 10
+
+//
+// runScrubber periodically walks the latest snapshot of every index and
+// verifies that each entry decodes and that entries are returned in key
+// order.  Errors reported by the storage while reading (e.g. checksum
+// errors) are counted as findings as well.  The number of findings of the
+// last run is recorded in the num_scrub_errors stat of each partition, and
+// an index found corrupt is quarantined (see handleQuarantineIndex).
+// Scrubbing is disabled by default (settings.scrubber.enable).
+//
+func (s *scanCoordinator) runScrubber() {
+
+	for {
+		cfg := s.config.Load()
+		interval := cfg["settings.scrubber.interval"].Int()
+		if interval <= 0 {
+			interval = 86400
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+
+		cfg = s.config.Load()
+		if !cfg["settings.scrubber.enable"].Bool() {
+			continue
+		}
+
+		if s.getIndexerState() != common.INDEXER_ACTIVE {
+			continue
+		}
+
+		s.scrubIndexes()
+	}
+}
+
+func (s *scanCoordinator) scrubIndexes() {
+
+	stats := s.stats.Get()
+	if stats == nil {
+		return
+	}
+
+	logging.Infof("%v: Scrubber started", s.logPrefix)
+	start := time.Now()
+
+	for instId, idxStats := range stats.indexes {
+
+		instId, idxStats := instId, idxStats
+		gMaintenance.run(MAINT_SCRUB, fmt.Sprint(instId), func() {
+			s.scrubIndex(instId, idxStats)
+		})
+	}
+
+	logging.Infof("%v: Scrubber finished in %v", s.logPrefix, time.Since(start))
+}
+
+func (s *scanCoordinator) scrubIndex(instId common.IndexInstId, idxStats *IndexStats) {
+
+	is, err := s.getLatestSnapshot(instId)
+	if err != nil {
+		logging.Errorf("%v: Scrubber unable to get snapshot for %v/%v (%v)", s.logPrefix,
+			idxStats.bucket, idxStats.name, err)
+		return
+	}
+	if is == nil {
+		return
+	}
+
+	for pid, ps := range is.Partitions() {
+
+		numErrors := 0
+		for _, ss := range ps.Slices() {
+			numErrors += s.scrubSlice(instId, pid, ss)
+		}
+
+		idxStats.updatePartitionStats(pid, func(ps *IndexStats) {
+			ps.numScrubErrors.Set(int64(numErrors))
+		})
+
+		if numErrors != 0 {
+			logging.Errorf("%v: Scrubber found %v corrupt entries in index %v:%v:%v:%v partition %v",
+				s.logPrefix, numErrors, idxStats.bucket, idxStats.scope, idxStats.collection,
+				idxStats.name, pid)
+
+			s.supvMsgch <- &MsgQuarantineIndex{
+				instId:  instId,
+				partnId: pid,
+				reason:  fmt.Sprintf("scrubber found %v corrupt entries", numErrors),
+			}
+		}
+	}
+
+	DestroyIndexSnapshot(is)
+}
+
+func (s *scanCoordinator) getLatestSnapshot(instId common.IndexInstId) (IndexSnapshot, error) {
+
+	snapResch := make(chan interface{}, 1)
+	s.supvMsgch <- &MsgIndexSnapRequest{
+		cons:      common.AnyConsistency,
+		respch:    snapResch,
+		idxInstId: instId,
+	}
+
+	switch msg := (<-snapResch).(type) {
+	case IndexSnapshot:
+		return msg, nil
+	case error:
+		return nil, msg
+	}
+
+	return nil, nil
+}
+
+//
+// scrubSlice walks all entries of a slice snapshot and returns the number of
+// entries found corrupt.
+//
+func (s *scanCoordinator) scrubSlice(instId common.IndexInstId, pid common.PartitionId,
+	ss SliceSnapshot) (numErrors int) {
+
+	s.mu.RLock()
+	partition, ok := s.indexPartnMap[instId][pid]
+	s.mu.RUnlock()
+	if !ok {
+		return 0
+	}
+
+	slice := partition.Sc.GetSliceById(ss.SliceId())
+	if slice == nil {
+		return 0
+	}
+
+	// hash indexes cannot be scanned in order
+	if _, ok := slice.(*hashSlice); ok {
+		return 0
+	}
+
+	ctx := slice.GetReaderContext()
+	if !ctx.Init(make(chan bool)) {
+		return 0
+	}
+	defer ctx.Done()
+
+	report := func(format string, args ...interface{}) {
+		numErrors++
+		if numErrors <= SCRUB_MAX_LOGGED_ERRORS {
+			logging.Errorf("%v: Scrubber Inst %v Partition %v Slice %v: %v", s.logPrefix,
+				instId, pid, ss.SliceId(), fmt.Sprintf(format, args...))
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			report("panic while reading snapshot %v", r)
+		}
+	}()
+
+	var prev, buf []byte
+	var count int64
+
+	callb := func(entry []byte) error {
+		count++
+
+		e := secondaryIndexEntry(entry)
+		if len(entry) < 2 || e.lenDocId() > len(entry) {
+			report("malformed entry at position %v", count)
+			return nil
+		}
+
+		var err error
+		if buf, err = e.ReadSecKey(buf[:0]); err != nil {
+			report("entry at position %v: %v", count, err)
+		}
+
+		if prev != nil && bytes.Compare(prev, entry) > 0 {
+			report("entry at position %v out of order", count)
+		}
+		prev = append(prev[:0], entry...)
+
+		return nil
+	}
+
+	if err := ss.Snapshot().All(ctx, callb); err != nil {
+		report("error reading snapshot after %v entries: %v", count, err)
+	}
+
+	return numErrors
+}
@@ -25,10 +25,12 @@ import (
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/couchbase/indexing/secondary/audit"
 	"github.com/couchbase/indexing/secondary/common"
 	forestdb "github.com/couchbase/indexing/secondary/fdb"
 	"github.com/couchbase/indexing/secondary/logging"
@@ -77,6 +79,7 @@ var (
 	ErrIndexerNotActive         = errors.New("Indexer Not Active")
 	ErrInvalidMetadata          = errors.New("Invalid Metadata")
 	ErrBucketEphemeral          = errors.New("Ephemeral Buckets Must Use MOI Storage")
+	ErrUnknownStorageEngine     = errors.New("Unknown Storage Engine")
 )
 
 // Backup corrupt index data files
@@ -84,6 +87,9 @@ const (
 	CORRUPT_DATA_SUBDIR = ".corruptData"
 )
 
+// Error of an index instance quarantined due to storage corruption
+const QUARANTINE_ERR_PREFIX = "Quarantined due to storage corruption"
+
 type indexer struct {
 	id    string
 	state common.IndexerState
@@ -110,6 +116,10 @@ type indexer struct {
 
 	keyspaceIdRollbackTimes map[string]int64
 
+	//INIT_STREAM keyspaces with a paused build. Once the stream has been
+	//stopped, the value holds the recovery message used to resume it.
+	keyspaceIdBuildPaused map[string]*MsgRecovery
+
 	keyspaceIdBuildTs map[string]Timestamp
 	buildTsLock       map[common.StreamId]map[string]*sync.Mutex
 
@@ -268,6 +278,7 @@ func NewIndexer(config common.Config) (Indexer, Message) {
 		keyspaceIdBuildTs:                make(map[string]Timestamp),
 		buildTsLock:                      make(map[common.StreamId]map[string]*sync.Mutex),
 		keyspaceIdRollbackTimes:          make(map[string]int64),
+		keyspaceIdBuildPaused:            make(map[string]*MsgRecovery),
 		keyspaceIdCreateClientChMap:      make(map[string]MsgChannel),
 
 		activeKVNodes: make(map[string]bool),
@@ -305,6 +316,8 @@ func NewIndexer(config common.Config) (Indexer, Message) {
 		return nil, &MsgError{err: idxErr}
 	}
 
+	audit.Init(config["clusterAddr"].String())
+
 	idx.stats = NewIndexerStats()
 	idx.initFromConfig()
 
@@ -438,6 +451,13 @@ func (idx *indexer) initSecurityContext(encryptLocalHost bool) error {
 	}
 
 	fn := func(refreshCert bool, refreshEncrypt bool) error {
+		// Listeners pick up the new certificate and TLS config on new
+		// connections.  They only need to restart on encryption change.
+		if !refreshEncrypt {
+			logging.Infof("Receive certificate refresh.  No restart required")
+			return nil
+		}
+
 		select {
 		case <-idx.enableSecurityChange:
 		default:
@@ -460,6 +480,10 @@ func (idx *indexer) initSecurityContext(encryptLocalHost bool) error {
 		return err
 	}
 
+	if interval := idx.config["certWatchInterval"].Int(); interval > 0 {
+		go security.WatchCertificate(time.Duration(interval)*time.Second, nil)
+	}
+
 	return nil
 }
 
@@ -564,9 +588,11 @@ func (idx *indexer) initFromConfig() {
 	// Read memquota setting
 	memQuota := int64(idx.config["settings.memory_quota"].Uint64())
 	idx.stats.memoryQuota.Set(memQuota)
-	plasma.SetMemoryQuota(int64(float64(memQuota) * PLASMA_MEMQUOTA_FRAC))
+	setBloomFilterMaxMemory(idx.config)
+	plasma.SetMemoryQuota(getPlasmaMemQuota(uint64(memQuota)))
 	memdb.Debug(idx.config["settings.moi.debug"].Bool())
 	updateMOIWriters(idx.config["settings.moi.persistence_threads"].Int())
+	updateStreamPriority(idx.config)
 	reclaimBlockSize := int64(idx.config["plasma.LSSReclaimBlockSize"].Int())
 	plasma.SetLogReclaimBlockSize(reclaimBlockSize)
 
@@ -1082,6 +1108,10 @@ func (idx *indexer) handleWorkerMsgs(msg Message) {
 
 	case STORAGE_INDEX_SNAP_REQUEST,
 		STORAGE_INDEX_STORAGE_STATS,
+		STORAGE_INDEX_LIST_SNAPSHOTS,
+		STORAGE_INDEX_DISK_USAGE,
+		STORAGE_INDEX_EXPORT_SNAPSHOT,
+		STORAGE_INDEX_IMPORT_SNAPSHOT,
 		STORAGE_INDEX_COMPACT:
 		idx.storageMgrCmdCh <- msg
 		<-idx.storageMgrCmdCh
@@ -1221,6 +1251,15 @@ func (idx *indexer) handleWorkerMsgs(msg Message) {
 	case RESET_STREAM:
 		idx.handleResetStream(msg)
 
+	case INDEXER_PAUSE_BUILD:
+		idx.handlePauseBuild(msg)
+
+	case INDEXER_RESUME_BUILD:
+		idx.handleResumeBuild(msg)
+
+	case INDEXER_QUARANTINE_INDEX:
+		idx.handleQuarantineIndex(msg)
+
 	default:
 		logging.Fatalf("Indexer::handleWorkerMsgs Unknown Message %+v", msg)
 		common.CrashOnError(errors.New("Unknown Msg On Worker Channel"))
@@ -1277,13 +1316,14 @@ func (idx *indexer) handleConfigUpdate(msg Message) {
 	newConfig := cfgUpdate.GetConfig()
 
 	idx.updateStorageMode(newConfig)
+	setBloomFilterMaxMemory(newConfig)
 
 	if newConfig["settings.memory_quota"].Uint64() !=
 		idx.config["settings.memory_quota"].Uint64() {
 
 		memQuota := int64(newConfig["settings.memory_quota"].Uint64())
 		idx.stats.memoryQuota.Set(memQuota)
-		plasma.SetMemoryQuota(int64(float64(memQuota) * PLASMA_MEMQUOTA_FRAC))
+		plasma.SetMemoryQuota(getPlasmaMemQuota(uint64(memQuota)))
 
 		if common.GetStorageMode() == common.FORESTDB ||
 			common.GetStorageMode() == common.NOT_SET {
@@ -1305,6 +1345,8 @@ func (idx *indexer) handleConfigUpdate(msg Message) {
 		}
 	}
 
+	updateStreamPriority(newConfig)
+
 	if newConfig["settings.compaction.plasma.manual"].Bool() !=
 		idx.config["settings.compaction.plasma.manual"].Bool() {
 		logging.Infof("Indexer::handleConfigUpdate restart indexer due to compaction.plasma.manual")
@@ -1451,7 +1493,7 @@ func (idx *indexer) handleCreateIndex(msg Message) {
 		}
 		return
 	}
-	if ephemeral && common.GetStorageMode() != common.MOI {
+	if ephemeral && common.IndexTypeToStorageMode(indexInst.Defn.Using) != common.MOI {
 		logging.Errorf("Indexer::handleCreateIndex \n\t Bucket %v is Ephemeral but GSI storage is not MOI")
 		if clientCh != nil {
 			clientCh <- &MsgError{
@@ -1504,7 +1546,7 @@ func (idx *indexer) handleCreateIndex(msg Message) {
 		}
 		return
 	} else {
-		if common.IndexTypeToStorageMode(indexInst.Defn.Using) != common.GetStorageMode() {
+		if !idx.isStorageModeAllowed(indexInst) {
 
 			errStr := fmt.Sprintf("Cannot Create Index with Using %v. Indexer "+
 				"Storage Mode %v", indexInst.Defn.Using, common.GetStorageMode())
@@ -2692,9 +2734,12 @@ func (idx *indexer) handleBuildIndex(msg Message) {
 			common.CrashOnError(err)
 		}
 
+		//a rebalance build catches up from the snapshots copied from the source
+		restartTs := idx.makeBuildRestartTs(instIdList, msg.(*MsgBuildIndex).GetRequestCtx())
+
 		//send Stream Update to workers
 		idx.sendStreamUpdateForBuildIndex(instIdList, buildStream, keyspaceId,
-			reqcid, clusterVer, buildTs, clientCh)
+			reqcid, clusterVer, buildTs, restartTs, clientCh)
 
 		idx.setStreamKeyspaceIdState(buildStream, keyspaceId, STREAM_ACTIVE)
 
@@ -3065,9 +3110,23 @@ func (idx *indexer) handleInitRecovery(msg Message) {
 			keyspaceId: keyspaceId}
 		<-idx.tkCmdCh
 		idx.cleanupStreamKeyspaceIdState(streamId, keyspaceId)
+		if streamId == common.INIT_STREAM {
+			idx.clearBuildPaused(keyspaceId)
+		}
 		return
 	}
 
+	//if the build has been paused, hold on to the recovery request
+	//till the build gets resumed. The stream stays stopped.
+	if streamId == common.INIT_STREAM {
+		if rmsg, ok := idx.keyspaceIdBuildPaused[keyspaceId]; ok && rmsg == nil {
+			logging.Infof("Indexer::handleInitRecovery StreamId %v KeyspaceId %v "+
+				"Build Paused. RestartTs %v", streamId, keyspaceId, restartTs)
+			idx.keyspaceIdBuildPaused[keyspaceId] = msg.(*MsgRecovery)
+			return
+		}
+	}
+
 	idx.setStreamKeyspaceIdState(streamId, keyspaceId, STREAM_RECOVERY)
 
 	logging.Infof("Indexer::handleInitRecovery StreamId %v KeyspaceId %v %v",
@@ -3139,10 +3198,17 @@ func (idx *indexer) handleStorageRollbackDone(msg Message) {
 	//if index in MAINT_STREAM rollback to 0, reset state to created and
 	//schedule the build again
 	if restartTs == nil && streamId == common.MAINT_STREAM {
+		gRollbackEvents.resolve(streamId, keyspaceId, ROLLBACK_ACTION_REBUILD, nil)
 		idx.resetIndexesOnRollback(streamId, keyspaceId, sessionId)
 		return
 	}
 
+	if restartTs == nil {
+		gRollbackEvents.resolve(streamId, keyspaceId, ROLLBACK_ACTION_ZERO, nil)
+	} else {
+		gRollbackEvents.resolve(streamId, keyspaceId, ROLLBACK_ACTION_SNAPSHOT, restartTs)
+	}
+
 	idx.startKeyspaceIdStream(streamId, keyspaceId, restartTs, nil, nil, false, false, sessionId)
 	go idx.collectProgressStats(true)
 
@@ -4049,9 +4115,79 @@ func (idx *indexer) Shutdown() Message {
 	return nil
 }
 
+//
+// buildOSOPreference returns whether OSO is used for the initial build of
+// indexList.  An index can override build.enableOSO with build_oso in the
+// WITH clause.  OSO is not used if any index of the build disables it.
+//
+func buildOSOPreference(indexList []common.IndexInst, enableOSO bool) bool {
+
+	for _, inst := range indexList {
+		if inst.Defn.BuildOSO != nil {
+			if !*inst.Defn.BuildOSO {
+				return false
+			}
+			enableOSO = true
+		}
+	}
+
+	return enableOSO
+}
+
+//
+// useOSOForBuild returns whether OSO is used for the stream of the initial
+// build of indexList.  OSO snapshots are requested only for a collection
+// stream, i.e. INIT_STREAM once the cluster is on 7.0 or later, and only if
+// the stream starts from zero (allowOSO).  OSO is only faster to build from
+// for large collections, so it is not used for a collection with less than
+// minItems items, unless an index of the build sets build_oso.
+//
+func useOSOForBuild(indexList []common.IndexInst, enableOSO bool,
+	streamId common.StreamId, clusterVer uint64, allowOSO bool,
+	minItems uint64, itemCount func() (uint64, error)) bool {
+
+	if !buildOSOPreference(indexList, enableOSO) ||
+		!allowOSO ||
+		clusterVer < common.INDEXER_70_VERSION ||
+		streamId != common.INIT_STREAM {
+		return false
+	}
+
+	if minItems == 0 {
+		return true
+	}
+
+	for _, inst := range indexList {
+		if inst.Defn.BuildOSO != nil {
+			return true
+		}
+	}
+
+	count, err := itemCount()
+	if err != nil {
+		logging.Warnf("Indexer::useOSOForBuild Unable to get the item count of the collection. "+
+			"Using OSO. Error %v", err)
+		return true
+	}
+
+	return count >= minItems
+}
+
+//
+// collectionItemCount returns a func which reads the number of items of
+// collection cid of keyspaceId from KV.
+//
+func (idx *indexer) collectionItemCount(keyspaceId string, cid string) func() (uint64, error) {
+
+	return func() (uint64, error) {
+		bucket := GetBucketFromKeyspaceId(keyspaceId)
+		return common.CollectionItemCount(idx.config["clusterAddr"].String(), DEFAULT_POOL, bucket, cid)
+	}
+}
+
 func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstId,
 	buildStream common.StreamId, keyspaceId string, cid string,
-	clusterVer uint64, buildTs Timestamp, clientCh MsgChannel) bool {
+	clusterVer uint64, buildTs Timestamp, restartTs *common.TsVbuuid, clientCh MsgChannel) bool {
 
 	var cmd Message
 	var indexList []common.IndexInst
@@ -4067,15 +4203,9 @@ func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstI
 	clustAddr := idx.config["clusterAddr"].String()
 	numVb := idx.config["numVbuckets"].Int()
 	enableAsync := idx.config["enableAsyncOpenStream"].Bool()
-	enableOSO := idx.config["build.enableOSO"].Bool()
-
-	if enableOSO &&
-		clusterVer >= common.INDEXER_70_VERSION &&
-		buildStream == common.INIT_STREAM {
-		enableOSO = true
-	} else {
-		enableOSO = false
-	}
+	enableOSO := useOSOForBuild(indexList, idx.config["build.enableOSO"].Bool(),
+		buildStream, clusterVer, restartTs == nil, idx.config["build.oso.minItems"].Uint64(),
+		idx.collectionItemCount(keyspaceId, cid))
 
 	idx.prepareStreamKeyspaceIdForFreshStart(buildStream, keyspaceId)
 
@@ -4096,7 +4226,7 @@ func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstI
 		indexList:          indexList,
 		buildTs:            buildTs,
 		respCh:             respCh,
-		restartTs:          nil,
+		restartTs:          restartTs,
 		allowMarkFirstSnap: true,
 		rollbackTime:       idx.keyspaceIdRollbackTimes[keyspaceId],
 		async:              async,
@@ -4181,6 +4311,20 @@ func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstI
 					break retryloop
 
 				case INDEXER_ROLLBACK:
+					if restartTs != nil {
+						//the copied snapshots are rolled back in recovery
+						logging.Infof("Indexer::sendStreamUpdateForBuildIndex Rollback from "+
+							"Projector For Stream %v KeyspaceId %v SessionId %v", buildStream,
+							keyspaceId, sessionId)
+						idx.internalRecvCh <- &MsgRecovery{mType: INDEXER_INIT_PREP_RECOVERY,
+							streamId:   buildStream,
+							keyspaceId: keyspaceId,
+							restartTs:  resp.(*MsgRollback).GetRollbackTs(),
+							requestCh:  stopCh,
+							sessionId:  sessionId}
+						break retryloop
+					}
+
 					//an initial build request should never receive rollback message
 					logging.Errorf("Indexer::sendStreamUpdateForBuildIndex Unexpected Rollback from "+
 						"Projector during Initial Stream Request %v", resp)
@@ -4454,7 +4598,7 @@ func (idx *indexer) initPartnInstance(indexInst common.IndexInst,
 		//TODO: Ignore partitions which do not belong to this
 		//indexer node(based on the endpoints)
 		partnInst := PartitionInst{Defn: partnDefn,
-			Sc: NewHashedSliceContainer()}
+			Sc: NewSliceContainer(indexInst.Defn.Using)}
 
 		logging.Infof("Indexer::initPartnInstance Initialized Partition: \n\t Index: %v Partition: %v",
 			indexInst.InstId, partnInst)
@@ -4634,6 +4778,15 @@ func (idx *indexer) checkDuplicateIndex(indexInst common.IndexInst,
 	if !common.IsPartitioned(indexInst.Defn.PartitionScheme) {
 		for _, index := range idx.indexInstMap {
 
+			//an index being migrated to a different storage mode
+			//has an instance in each storage mode, and a quarantined
+			//index has an instance in error until it is replaced
+			if index.Defn.DefnId == indexInst.Defn.DefnId &&
+				(index.Defn.Using != indexInst.Defn.Using ||
+					index.State == common.INDEX_STATE_ERROR) {
+				continue
+			}
+
 			if index.Defn.Name == indexInst.Defn.Name &&
 				index.Defn.Bucket == indexInst.Defn.Bucket &&
 				index.Defn.Scope == indexInst.Defn.Scope &&
@@ -4705,6 +4858,257 @@ func (idx *indexer) handleCheckDDLInProgress(msg Message) {
 	return
 }
 
+//handlePauseBuild pauses the initial build of the requested indexes. The
+//INIT_STREAM of their keyspace is flushed and stopped using the recovery
+//path, and is restarted from the flushed timestamp on resume.  As this
+//stops the build of every index of the stream, the request must cover all
+//the indexes being built in the keyspace, so that no other index gets
+//paused behind the back of the caller.  Pausing a subset of them is
+//rejected.  The paused keyspaces are persisted in the local metadata, so
+//that the build stays paused across indexer restart.
+func (idx *indexer) handlePauseBuild(msg Message) {
+
+	instIds := msg.(*MsgBuildControl).GetInstIds()
+	respCh := msg.(*MsgBuildControl).GetRespCh()
+
+	keyspaceId, err := idx.validateBuildControl(instIds)
+	if err != nil {
+		logging.Errorf("Indexer::handlePauseBuild %v", err.cause)
+		respCh <- &MsgError{err: *err}
+		return
+	}
+
+	if _, ok := idx.keyspaceIdBuildPaused[keyspaceId]; ok {
+		logging.Infof("Indexer::handlePauseBuild Insts %v KeyspaceId %v "+
+			"Build Already Paused", instIds, keyspaceId)
+		respCh <- &MsgSuccess{}
+		return
+	}
+
+	if err := idx.checkBuildControlScope(keyspaceId, instIds); err != nil {
+		logging.Errorf("Indexer::handlePauseBuild %v", err.cause)
+		respCh <- &MsgError{err: *err}
+		return
+	}
+
+	streamId := common.INIT_STREAM
+	if idx.getStreamKeyspaceIdState(streamId, keyspaceId) != STREAM_ACTIVE ||
+		idx.checkStreamRequestPending(streamId, keyspaceId) {
+
+		errStr := fmt.Sprintf("Cannot Pause Build For Indexes %v While Stream "+
+			"Request Or Recovery In Progress. Retry Later.", instIds)
+		logging.Errorf("Indexer::handlePauseBuild %v", errStr)
+		respCh <- &MsgError{
+			err: Error{code: ERROR_INDEXER_IN_RECOVERY,
+				severity: NORMAL,
+				cause:    errors.New(errStr),
+				category: INDEXER}}
+		return
+	}
+
+	idx.keyspaceIdBuildPaused[keyspaceId] = nil
+	if err := idx.persistBuildPaused(); err != nil {
+		delete(idx.keyspaceIdBuildPaused, keyspaceId)
+		errStr := fmt.Sprintf("Cannot Pause Build For Indexes %v. Error Persisting "+
+			"Build State %v", instIds, err)
+		logging.Errorf("Indexer::handlePauseBuild %v", errStr)
+		respCh <- &MsgError{
+			err: Error{code: ERROR_INDEXER_INTERNAL_ERROR,
+				severity: NORMAL,
+				cause:    errors.New(errStr),
+				category: INDEXER}}
+		return
+	}
+
+	logging.Infof("Indexer::handlePauseBuild Insts %v StreamId %v KeyspaceId %v "+
+		"Pausing Build", instIds, streamId, keyspaceId)
+
+	sessionId := idx.getCurrentSessionId(streamId, keyspaceId)
+	idx.handleInitPrepRecovery(&MsgRecovery{mType: INDEXER_INIT_PREP_RECOVERY,
+		streamId:   streamId,
+		keyspaceId: keyspaceId,
+		sessionId:  sessionId})
+
+	respCh <- &MsgSuccess{}
+}
+
+//handleResumeBuild resumes a build paused by handlePauseBuild. Resuming
+//a build which is not paused is a no-op.
+func (idx *indexer) handleResumeBuild(msg Message) {
+
+	instIds := msg.(*MsgBuildControl).GetInstIds()
+	respCh := msg.(*MsgBuildControl).GetRespCh()
+
+	keyspaceId, err := idx.validateBuildControl(instIds)
+	if err != nil {
+		logging.Errorf("Indexer::handleResumeBuild %v", err.cause)
+		respCh <- &MsgError{err: *err}
+		return
+	}
+
+	rmsg, ok := idx.keyspaceIdBuildPaused[keyspaceId]
+	if !ok {
+		logging.Infof("Indexer::handleResumeBuild Insts %v KeyspaceId %v "+
+			"Build Not Paused", instIds, keyspaceId)
+		respCh <- &MsgSuccess{}
+		return
+	}
+
+	if err := idx.checkBuildControlScope(keyspaceId, instIds); err != nil {
+		logging.Errorf("Indexer::handleResumeBuild %v", err.cause)
+		respCh <- &MsgError{err: *err}
+		return
+	}
+	delete(idx.keyspaceIdBuildPaused, keyspaceId)
+	if err := idx.persistBuildPaused(); err != nil {
+		idx.keyspaceIdBuildPaused[keyspaceId] = rmsg
+		errStr := fmt.Sprintf("Cannot Resume Build For Indexes %v. Error Persisting "+
+			"Build State %v", instIds, err)
+		logging.Errorf("Indexer::handleResumeBuild %v", errStr)
+		respCh <- &MsgError{
+			err: Error{code: ERROR_INDEXER_INTERNAL_ERROR,
+				severity: NORMAL,
+				cause:    errors.New(errStr),
+				category: INDEXER}}
+		return
+	}
+
+	logging.Infof("Indexer::handleResumeBuild Insts %v KeyspaceId %v "+
+		"Resuming Build", instIds, keyspaceId)
+
+	//if the stream has not been stopped yet, recovery carries on as usual
+	if rmsg != nil {
+		idx.handleInitRecovery(rmsg)
+	}
+
+	respCh <- &MsgSuccess{}
+}
+
+//handleQuarantineIndex moves an index instance with corrupted storage to
+//error state, so that it is no longer scanned. The instance is replaced by
+//a new instance built in the background (see storageMigrator).
+func (idx *indexer) handleQuarantineIndex(msg Message) {
+
+	instId := msg.(*MsgQuarantineIndex).GetInstId()
+	partnId := msg.(*MsgQuarantineIndex).GetPartitionId()
+	reason := msg.(*MsgQuarantineIndex).GetReason()
+
+	inst, ok := idx.indexInstMap[instId]
+	if !ok || inst.State == common.INDEX_STATE_DELETED ||
+		inst.State == common.INDEX_STATE_ERROR {
+		logging.Infof("Indexer::handleQuarantineIndex Inst %v Partition %v "+
+			"Not Found Or Already In Error. Skipped.", instId, partnId)
+		return
+	}
+
+	logging.Errorf("Indexer::handleQuarantineIndex Inst %v Partition %v "+
+		"Quarantined. Reason: %v", instId, partnId, reason)
+
+	inst.State = common.INDEX_STATE_ERROR
+	inst.Error = fmt.Sprintf("%v (partition %v): %v", QUARANTINE_ERR_PREFIX, partnId, reason)
+	idx.indexInstMap[instId] = inst
+
+	msgUpdateIndexInstMap := idx.newIndexInstMsg(idx.indexInstMap)
+	msgUpdateIndexInstMap.AppendUpdatedInsts(common.IndexInstList{inst})
+
+	if err := idx.distributeIndexMapsToWorkers(msgUpdateIndexInstMap, nil); err != nil {
+		common.CrashOnError(err)
+	}
+
+	if err := idx.updateMetaInfoForIndexList([]common.IndexInstId{instId},
+		true, false, true, false, false, false, false, false, nil); err != nil {
+		logging.Errorf("Indexer::handleQuarantineIndex Inst %v Error updating metadata %v",
+			instId, err)
+	}
+
+	common.Console(idx.config["clusterAddr"].String(), "Index %v:%v:%v:%v quarantined due to "+
+		"storage corruption in partition %v. Index will be rebuilt.", inst.Defn.Bucket,
+		inst.Defn.Scope, inst.Defn.Collection, inst.Defn.Name, partnId)
+}
+
+//validateBuildControl checks that the indexes are in initial build in the
+//same INIT_STREAM keyspace, and returns the keyspaceId.
+func (idx *indexer) validateBuildControl(instIds []common.IndexInstId) (string, *Error) {
+
+	if is := idx.getIndexerState(); is != common.INDEXER_ACTIVE {
+		return "", &Error{code: ERROR_INDEXER_NOT_ACTIVE,
+			severity: NORMAL,
+			cause:    fmt.Errorf("Indexer Cannot Process Build Control In %v State", is),
+			category: INDEXER}
+	}
+
+	if idx.rebalanceRunning || idx.rebalanceToken != nil {
+		return "", &Error{code: ERROR_INDEXER_REBALANCE_IN_PROGRESS,
+			severity: NORMAL,
+			cause:    errors.New("Indexer Cannot Process Build Control - Rebalance In Progress"),
+			category: INDEXER}
+	}
+
+	var keyspaceId string
+	for _, instId := range instIds {
+		inst, ok := idx.indexInstMap[instId]
+		if !ok || inst.State == common.INDEX_STATE_DELETED {
+			return "", &Error{code: ERROR_INDEXER_UNKNOWN_INDEX,
+				severity: NORMAL,
+				cause:    fmt.Errorf("Unknown Index Instance %v", instId),
+				category: INDEXER}
+		}
+
+		if inst.State != common.INDEX_STATE_INITIAL || inst.Stream != common.INIT_STREAM {
+			return "", &Error{code: ERROR_INDEX_BUILD_IN_PROGRESS,
+				severity: NORMAL,
+				cause: fmt.Errorf("Index %v Not In Initial Build. State %v Stream %v",
+					instId, inst.State, inst.Stream),
+				category: INDEXER}
+		}
+
+		instKeyspaceId := inst.Defn.KeyspaceId(common.INIT_STREAM)
+		if keyspaceId != "" && keyspaceId != instKeyspaceId {
+			return "", &Error{code: ERROR_INDEX_BUILD_IN_PROGRESS,
+				severity: NORMAL,
+				cause: fmt.Errorf("Indexes %v Are Built In Different Keyspaces %v and %v",
+					instIds, keyspaceId, instKeyspaceId),
+				category: INDEXER}
+		}
+		keyspaceId = instKeyspaceId
+	}
+
+	return keyspaceId, nil
+}
+
+//checkBuildControlScope returns an error if an index being built in the
+//INIT_STREAM of keyspaceId is not one of instIds. The build of a single
+//index cannot be paused, as all the indexes of a keyspace are built by
+//the same stream.
+func (idx *indexer) checkBuildControlScope(keyspaceId string,
+	instIds []common.IndexInstId) *Error {
+
+	requested := make(map[common.IndexInstId]bool)
+	for _, instId := range instIds {
+		requested[instId] = true
+	}
+
+	var others []common.IndexInstId
+	for instId, inst := range idx.indexInstMap {
+		if inst.Stream != common.INIT_STREAM || requested[instId] ||
+			inst.State == common.INDEX_STATE_DELETED ||
+			inst.Defn.KeyspaceId(common.INIT_STREAM) != keyspaceId {
+			continue
+		}
+		others = append(others, instId)
+	}
+
+	if len(others) != 0 {
+		return &Error{code: ERROR_INDEX_BUILD_IN_PROGRESS,
+			severity: NORMAL,
+			cause: fmt.Errorf("Build Of Individual Indexes Cannot Be Paused Or Resumed. "+
+				"Indexes %v Are Built Along With %v In KeyspaceId %v. "+
+				"Include Them In The Request.", others, instIds, keyspaceId),
+			category: INDEXER}
+	}
+	return nil
+}
+
 func (idx *indexer) checkDDLInProgress() (bool, []string) {
 
 	ddlInProgress := false
@@ -5639,16 +6043,6 @@ func (idx *indexer) startKeyspaceIdStream(streamId common.StreamId, keyspaceId s
 		allowOSO = true
 	}
 
-	enableOSO := idx.config["build.enableOSO"].Bool()
-	if enableOSO &&
-		allowOSO &&
-		clusterVer >= common.INDEXER_70_VERSION &&
-		streamId == common.INIT_STREAM {
-		enableOSO = true
-	} else {
-		enableOSO = false
-	}
-
 	var cid string
 	var ok bool
 	if cid, ok = idx.streamKeyspaceIdCollectionId[streamId][keyspaceId]; !ok {
@@ -5659,6 +6053,10 @@ func (idx *indexer) startKeyspaceIdStream(streamId common.StreamId, keyspaceId s
 		idx.streamKeyspaceIdCollectionId[streamId][keyspaceId] = cid
 	}
 
+	enableOSO := useOSOForBuild(indexList, idx.config["build.enableOSO"].Bool(),
+		streamId, clusterVer, allowOSO, idx.config["build.oso.minItems"].Uint64(),
+		idx.collectionItemCount(keyspaceId, cid))
+
 	var collectionAware bool
 	if clusterVer >= common.INDEXER_70_VERSION {
 		collectionAware = true
@@ -6067,11 +6465,20 @@ func (idx *indexer) createRealInstIdMap() common.IndexInstMap {
 func (idx *indexer) cleanupOrphanIndexes() {
 	storageDir := idx.config["storage_dir"].String()
 
-	mode := common.GetStorageMode()
-	flist, err := ListSlices(mode, storageDir)
-	if err != nil {
-		logging.Warnf("Error %v during cleaning up the orphan indexes.", err)
-		return
+	// indexes migrated to their own storage mode have their slices listed
+	// by the storage engine of that mode.
+	modes := make(map[string]common.StorageMode)
+	for mode := range idx.indexStorageModes() {
+		flist, err := ListSlices(mode, storageDir)
+		if err != nil {
+			logging.Warnf("Error %v during cleaning up the orphan indexes.", err)
+			return
+		}
+		for _, f := range flist {
+			if _, ok := modes[f]; !ok {
+				modes[f] = mode
+			}
+		}
 	}
 
 	instExists := func(instId common.IndexInstId,
@@ -6092,8 +6499,8 @@ func (idx *indexer) cleanupOrphanIndexes() {
 	realInstIdMap := idx.createRealInstIdMap()
 
 	stDirPathLen := len(storageDir) + len(string(os.PathSeparator))
-	orphanIndexList := make([]string, 0, len(flist))
-	for _, f := range flist {
+	orphanIndexList := make([]string, 0, len(modes))
+	for f := range modes {
 		instId, partnId, err := GetInstIdPartnIdFromPath(f[stDirPathLen:])
 		if err != nil {
 			logging.Warnf("Error %v during GetInstIdPartnIdFromPath for %v.", err, f)
@@ -6116,7 +6523,7 @@ func (idx *indexer) cleanupOrphanIndexes() {
 
 	go func() {
 		for _, f := range orphanIndexList {
-			if err := DestroySlice(mode, storageDir, f); err != nil {
+			if err := DestroySlice(modes[f], storageDir, f); err != nil {
 				logging.Warnf("Error %v while removing orphan index data for %v.", err, f)
 			} else {
 				logging.Infof("Cleaned up the orphan index slice %v.", f)
@@ -6194,6 +6601,8 @@ func (idx *indexer) handleStorageWarmupDone(msg Message) {
 	NewRestServer(idx.config["clusterAddr"].String(), idx.statsMgr)
 
 	go idx.monitorMemUsage()
+	go idx.runMemoryController()
+	go idx.runMaintenanceScheduler()
 	go idx.logMemstats()
 	go idx.collectProgressStats(true)
 
@@ -6477,6 +6886,11 @@ func (idx *indexer) initFromPersistedState() error {
 			return err
 		}
 
+		// Hydrate the disk snapshots offloaded to the cold tier, to recover the index
+		if s, ok := idx.storageMgr.(*storageMgr); ok {
+			s.coldTier.hydrate(inst, partnInstMap)
+		}
+
 		// Cleanup all partition instances for which, initPartnInstance has failed due to storage corruption
 		for failedPartnId, failedPartnInstance := range failedPartnInstances {
 			logMsg := "Detected storage corruption for index %v, partition id %v. Starting cleanup."
@@ -6770,13 +7184,19 @@ func (idx *indexer) upgradeStorage() bool {
 
 	disable := idx.config["settings.storage_mode.disable_upgrade"].Bool()
 	override := idx.getStorageModeOverride(idx.config)
-	logging.Infof("indexer.upgradeStorage: check index for storage upgrade.   disable %v overrride %v", disable, override)
+	pinned := idx.getIndexStorageModes(idx.config)
+	logging.Infof("indexer.upgradeStorage: check index for storage upgrade.   disable %v overrride %v pinned %v", disable, override, pinned)
 
 	//
-	// First try to upgrade/downgrade storage mode of each index, based on index's current storage mode
+	// First try to upgrade/downgrade storage mode of each index, based on index's current storage mode.
+	// Index with its own storage mode is migrated online by the storage migrator, and is left as is.
 	//
 	for instId, index := range idx.indexInstMap {
 
+		if _, ok := pinned[index.Defn.DefnId]; ok {
+			continue
+		}
+
 		if index.State != common.INDEX_STATE_DELETED || index.State != common.INDEX_STATE_ERROR {
 
 			indexStorageMode := common.IndexTypeToStorageMode(index.Defn.Using)
@@ -6799,10 +7219,14 @@ func (idx *indexer) upgradeStorage() bool {
 	//
 	// The following logic is to detect if indexes are in mixed storage mode, it will try to force them to converge to a single storage mode.
 	//
-	if idx.getIndexStorageMode() == common.MIXED {
+	if idx.getIndexStorageModeInternal(pinned) == common.MIXED {
 
 		for instId, index := range idx.indexInstMap {
 
+			if _, ok := pinned[index.Defn.DefnId]; ok {
+				continue
+			}
+
 			if index.State != common.INDEX_STATE_DELETED || index.State != common.INDEX_STATE_ERROR {
 
 				indexStorageMode := common.IndexTypeToStorageMode(index.Defn.Using)
@@ -6828,7 +7252,7 @@ func (idx *indexer) upgradeStorage() bool {
 	}
 
 	// If storage mode is different from bootstrap, then have to restart indexer.
-	s := idx.getIndexStorageMode()
+	s := idx.getIndexStorageModeInternal(pinned)
 
 	if s == common.MIXED {
 		logging.Errorf("Indexer is mixed storage mode after storage upgrade")
@@ -7162,17 +7586,118 @@ func (idx *indexer) startStreams() bool {
 
 	idx.initStreamKeyspaceIdState(common.INIT_STREAM)
 
+	paused := idx.recoverBuildPaused()
+
 	for keyspaceId, ts := range restartTs {
 		sessionId := idx.genNextSessionId(common.INIT_STREAM, keyspaceId)
+
+		//a paused build stays stopped till it gets resumed, like a build
+		//paused while the indexer is running
+		if paused[keyspaceId] {
+			logging.Infof("Indexer::startStreams StreamId %v KeyspaceId %v "+
+				"Build Paused. RestartTs %v", common.INIT_STREAM, keyspaceId, ts)
+			idx.setStreamKeyspaceIdState(common.INIT_STREAM, keyspaceId, STREAM_PREPARE_RECOVERY)
+			idx.keyspaceIdBuildPaused[keyspaceId] = &MsgRecovery{mType: INDEXER_INITIATE_RECOVERY,
+				streamId:   common.INIT_STREAM,
+				keyspaceId: keyspaceId,
+				restartTs:  ts,
+				sessionId:  sessionId}
+			continue
+		}
+
 		idx.startKeyspaceIdStream(common.INIT_STREAM, keyspaceId, ts, nil, allNilSnaps,
 			false, false, sessionId)
 		idx.setStreamKeyspaceIdState(common.INIT_STREAM, keyspaceId, STREAM_ACTIVE)
 	}
 
+	//forget the builds which are no longer in progress
+	if len(paused) != len(idx.keyspaceIdBuildPaused) {
+		if err := idx.persistBuildPaused(); err != nil {
+			logging.Errorf("Indexer::startStreams Error Persisting Build Paused "+
+				"KeyspaceIds %v", err)
+		}
+	}
+
 	return true
 
 }
 
+//persistBuildPaused stores the keyspaces with paused build in the local
+//metadata.
+func (idx *indexer) persistBuildPaused() error {
+
+	keyspaceIds := make([]string, 0, len(idx.keyspaceIdBuildPaused))
+	for keyspaceId := range idx.keyspaceIdBuildPaused {
+		keyspaceIds = append(keyspaceIds, keyspaceId)
+	}
+	sort.Strings(keyspaceIds)
+
+	value, err := json.Marshal(keyspaceIds)
+	if err != nil {
+		return err
+	}
+
+	idx.clustMgrAgentCmdCh <- &MsgClustMgrLocal{
+		mType: CLUST_MGR_SET_LOCAL,
+		key:   INDEXER_BUILD_PAUSED_KEY,
+		value: string(value),
+	}
+
+	respMsg := <-idx.clustMgrAgentCmdCh
+	return respMsg.(*MsgClustMgrLocal).GetError()
+}
+
+//recoverBuildPaused returns the keyspaces with paused build stored in the
+//local metadata.
+func (idx *indexer) recoverBuildPaused() map[string]bool {
+
+	idx.clustMgrAgentCmdCh <- &MsgClustMgrLocal{
+		mType: CLUST_MGR_GET_LOCAL,
+		key:   INDEXER_BUILD_PAUSED_KEY,
+	}
+
+	respMsg := <-idx.clustMgrAgentCmdCh
+	resp := respMsg.(*MsgClustMgrLocal)
+
+	if err := resp.GetError(); err != nil {
+		if !strings.Contains(err.Error(), forestdb.FDB_RESULT_KEY_NOT_FOUND.Error()) {
+			logging.Errorf("Indexer::recoverBuildPaused Error Fetching Build Paused "+
+				"KeyspaceIds From Local Meta Storage. Err %v", err)
+		}
+		return nil
+	}
+
+	var keyspaceIds []string
+	if err := json.Unmarshal([]byte(resp.GetValue()), &keyspaceIds); err != nil {
+		logging.Errorf("Indexer::recoverBuildPaused Error Unmarshalling Build Paused "+
+			"KeyspaceIds %v", err)
+		return nil
+	}
+
+	paused := make(map[string]bool)
+	for _, keyspaceId := range keyspaceIds {
+		paused[keyspaceId] = true
+	}
+
+	logging.Infof("Indexer::recoverBuildPaused Build Paused KeyspaceIds %v", keyspaceIds)
+	return paused
+}
+
+//clearBuildPaused forgets the paused build of a keyspace whose INIT_STREAM
+//is cleaned up.
+func (idx *indexer) clearBuildPaused(keyspaceId string) {
+
+	if _, ok := idx.keyspaceIdBuildPaused[keyspaceId]; !ok {
+		return
+	}
+
+	delete(idx.keyspaceIdBuildPaused, keyspaceId)
+	if err := idx.persistBuildPaused(); err != nil {
+		logging.Errorf("Indexer::clearBuildPaused KeyspaceId %v Error Persisting "+
+			"Build Paused KeyspaceIds %v", keyspaceId, err)
+	}
+}
+
 func (idx *indexer) makeRestartTs(streamId common.StreamId) (map[string]*common.TsVbuuid, map[string]bool) {
 
 	restartTs := make(map[string]*common.TsVbuuid)
@@ -7236,6 +7761,72 @@ func (idx *indexer) makeRestartTs(streamId common.StreamId) (map[string]*common.
 	return restartTs, allNilSnaps
 }
 
+//
+// makeBuildRestartTs returns the timestamp a rebalance build of the indexes
+// in instIdList restarts the stream from, if every partition of them has
+// been loaded with a snapshot copied from the source node.  Otherwise, any
+// loaded snapshot is discarded, and the indexes are built from scratch.
+//
+func (idx *indexer) makeBuildRestartTs(instIdList []common.IndexInstId,
+	reqCtx *common.MetadataRequestContext) *common.TsVbuuid {
+
+	if reqCtx == nil || reqCtx.ReqSource != common.DDLRequestSourceRebalance {
+		return nil
+	}
+
+	var restartTs *common.TsVbuuid
+	var loaded []Slice
+	missing := false
+
+	for _, instId := range instIdList {
+		for _, partnInst := range idx.indexPartnMap[instId] {
+			for _, slice := range partnInst.Sc.GetAllSlices() {
+
+				infos, err := slice.GetSnapshots()
+				if err != nil {
+					logging.Errorf("Indexer::makeBuildRestartTs Error reading snapshots of "+
+						"Inst %v Partn %v: %v", instId, partnInst.Defn.GetPartitionId(), err)
+					missing = true
+					continue
+				}
+
+				latest := NewSnapshotInfoContainer(infos).GetLatest()
+				if latest == nil || latest.Timestamp() == nil {
+					missing = true
+					continue
+				}
+				loaded = append(loaded, slice)
+
+				ts := latest.Timestamp()
+				if restartTs == nil || !ts.AsRecentTs(restartTs) {
+					restartTs = ts
+				}
+			}
+		}
+	}
+
+	if len(loaded) == 0 {
+		return nil
+	}
+
+	if missing {
+		for _, slice := range loaded {
+			logging.Infof("Indexer::makeBuildRestartTs Discard snapshot of Inst %v at %v. "+
+				"Not all the indexes in the build have a snapshot.", slice.IndexInstId(), slice.Path())
+			if err := slice.RollbackToZero(); err != nil {
+				common.CrashOnError(err)
+			}
+		}
+		return nil
+	}
+
+	restartTs = restartTs.Copy()
+	restartTs.SetEpochManifestUIDIfEmpty()
+
+	logging.Infof("Indexer::makeBuildRestartTs Build of %v restarts from the copied snapshots", instIdList)
+	return restartTs
+}
+
 func (idx *indexer) closeAllStreams() {
 
 	respCh := make(MsgChannel)
@@ -7719,6 +8310,7 @@ func (idx *indexer) handleStats(cmd Message) {
 	idx.stats.memoryUsed.Set(int64(used))
 	idx.stats.memoryTotalStorage.Set(int64(storage))
 	idx.stats.memoryUsedStorage.Set(idx.memoryUsedStorage())
+	updatePlasmaMemQuota(idx.config)
 
 	idx.updateStatsFromMemStats()
 
@@ -7735,6 +8327,7 @@ func (idx *indexer) handleResetStats() {
 
 func (idx *indexer) memoryUsedStorage() int64 {
 	mem_used := int64(forestdb.BufferCacheUsed()) + int64(memdb.MemoryInUse()) + int64(plasma.MemoryInUse()) + int64(nodetable.MemoryInUse())
+	mem_used += getBloomFilterMemory() + hashStoreMemoryInUse()
 	return mem_used
 }
 
@@ -7748,6 +8341,9 @@ func NewSlice(id SliceId, indInst *common.IndexInst, partnInst *PartitionInst,
 	}
 	path := filepath.Join(storage_dir, IndexPath(indInst, partnInst.Defn.GetPartitionId(), id))
 
+	defn := &indInst.Defn
+	conf = common.GetKeyspaceSettings().Override(conf, defn.Bucket, defn.Scope, defn.Collection)
+
 	ephemeral, err := cic.IsEphemeral(indInst.Defn.Bucket)
 	if err != nil {
 		logging.Errorf("Indexer::initPartnInstance Failed to check bucket type ephemeral: %v\n", err)
@@ -7760,28 +8356,41 @@ func NewSlice(id SliceId, indInst *common.IndexInst, partnInst *PartitionInst,
 
 	log_dir := conf["log_dir"].String()
 
-	switch indInst.Defn.Using {
-	case common.MemDB, common.MemoryOptimized:
-		slice, err = NewMemDBSlice(path, id, indInst.Defn, instId, partitionId, indInst.Defn.IsPrimary, !ephemeral, numPartitions, conf,
-			stats.GetPartitionStats(indInst.InstId, partitionId))
-	case common.ForestDB:
-		slice, err = NewForestDBSlice(path, id, indInst.Defn, instId, partitionId, indInst.Defn.IsPrimary, numPartitions, conf,
-			stats.GetPartitionStats(indInst.InstId, partitionId))
-	case common.PlasmaDB:
-		slice, err = NewPlasmaSlice(storage_dir, log_dir, path, id, indInst.Defn, instId, partitionId, indInst.Defn.IsPrimary, numPartitions, conf,
-			stats.GetPartitionStats(indInst.InstId, partitionId), stats, isNew)
+	engine, ok := GetStorageEngine(indInst.Defn.Using)
+	if !ok {
+		logging.Errorf("Indexer::NewSlice No storage engine for index type %v", indInst.Defn.Using)
+		return nil, ErrUnknownStorageEngine
 	}
 
-	return
+	return engine.NewSlice(&SliceConfig{
+		StorageDir:    storage_dir,
+		LogDir:        log_dir,
+		Path:          path,
+		SliceId:       id,
+		Defn:          indInst.Defn,
+		InstId:        instId,
+		PartitionId:   partitionId,
+		NumPartitions: numPartitions,
+		Ephemeral:     ephemeral,
+		IsNew:         isNew,
+		Config:        conf,
+		IdxStats:      stats.GetPartitionStats(indInst.InstId, partitionId),
+		IndexerStats:  stats,
+	})
+}
+
+func NewSliceContainer(using common.IndexType) SliceContainer {
+
+	if engine, ok := GetStorageEngine(using); ok {
+		return engine.NewSliceContainer()
+	}
+	return NewHashedSliceContainer()
 }
 
 func DestroySlice(mode common.StorageMode, storageDir string, path string) error {
 
-	switch mode {
-	case common.MOI, common.FORESTDB, common.NOT_SET:
-		return os.RemoveAll(path)
-	case common.PLASMA:
-		return DestroyPlasmaSlice(storageDir, path)
+	if engine, ok := GetStorageEngineForMode(mode); ok {
+		return engine.DestroySlice(storageDir, path)
 	}
 
 	return fmt.Errorf("unable to delete instance %v : unrecognized storage type %v", path, mode)
@@ -7789,16 +8398,8 @@ func DestroySlice(mode common.StorageMode, storageDir string, path string) error
 
 func ListSlices(mode common.StorageMode, storageDir string) ([]string, error) {
 
-	listFiles := func() ([]string, error) {
-		pattern := GetIndexPathPattern()
-		return filepath.Glob(filepath.Join(storageDir, pattern))
-	}
-
-	switch mode {
-	case common.MOI, common.FORESTDB, common.NOT_SET:
-		return listFiles()
-	case common.PLASMA:
-		return listFiles()
+	if engine, ok := GetStorageEngineForMode(mode); ok {
+		return engine.ListSlices(storageDir)
 	}
 	return nil, fmt.Errorf("unable to list instance : unrecognized storage type %v", mode)
 }
@@ -7841,13 +8442,8 @@ func MoveSlice(mode common.StorageMode, indexInst *common.IndexInst, partnId com
 		deleteOldBackups(targetDir, sourceDir, srcPath)
 	}
 
-	switch mode {
-	case common.MOI, common.FORESTDB, common.NOT_SET:
-		return moveIndexFile(indexInst, partnId, sliceId, sourceDir, targetDir)
-	case common.PLASMA:
-		indexPath := IndexPath(indexInst, partnId, sliceId)
-		srcPath := filepath.Join(sourceDir, indexPath)
-		return BackupCorruptedPlasmaSlice(storageDir, srcPath, rename, clean)
+	if engine, ok := GetStorageEngineForMode(mode); ok {
+		return engine.BackupSlice(indexInst, partnId, sliceId, storageDir, sourceDir, targetDir, rename, clean)
 	}
 	return fmt.Errorf("unable to move instance : unrecognized storage type %v", mode)
 }
@@ -8126,8 +8722,16 @@ kvtsloop:
 
 func (idx *indexer) updateSliceWithConfig(config common.Config) {
 
+	ks := common.GetKeyspaceSettings()
+
 	//for every index managed by this indexer
-	for _, partnMap := range idx.indexPartnMap {
+	for instId, partnMap := range idx.indexPartnMap {
+
+		//apply the settings overridden for the keyspace of the index
+		sliceConfig := config
+		if inst, ok := idx.indexInstMap[instId]; ok {
+			sliceConfig = ks.Override(config, inst.Defn.Bucket, inst.Defn.Scope, inst.Defn.Collection)
+		}
 
 		//for all partitions managed by this indexer
 		for _, partnInst := range partnMap {
@@ -8136,7 +8740,7 @@ func (idx *indexer) updateSliceWithConfig(config common.Config) {
 
 			//update config for all the slices
 			for _, slice := range sc.GetAllSlices() {
-				slice.UpdateConfig(config)
+				slice.UpdateConfig(sliceConfig)
 			}
 		}
 	}
@@ -8607,10 +9211,21 @@ func (idx *indexer) getLocalStorageMode(config common.Config) common.StorageMode
 // This function returns the storage mode based on indexes on local node.
 //
 func (idx *indexer) getIndexStorageMode() common.StorageMode {
+	return idx.getIndexStorageModeInternal(nil)
+}
+
+//
+// Same as getIndexStorageMode, but skips the indexes in `skip`.
+//
+func (idx *indexer) getIndexStorageModeInternal(skip map[common.IndexDefnId]common.StorageMode) common.StorageMode {
 
 	storageMode := common.StorageMode(common.NOT_SET)
 	for _, inst := range idx.indexInstMap {
 
+		if _, ok := skip[inst.Defn.DefnId]; ok {
+			continue
+		}
+
 		if inst.State != common.INDEX_STATE_DELETED || inst.State != common.INDEX_STATE_ERROR {
 
 			indexStorageMode := common.IndexTypeToStorageMode(inst.Defn.Using)
@@ -8692,6 +9307,65 @@ func (idx *indexer) getStorageModeOverride(config common.Config) common.StorageM
 	return common.NOT_SET
 }
 
+//
+// isStorageModeAllowed returns true if the index instance can be created in
+// the storage mode of its definition.  Besides the indexer storage mode, an
+// index can use the storage mode it is set to (see storageMigrator), or the
+// storage mode of its existing instances, when a quarantined instance of a
+// migrated index is replaced.
+//
+func (idx *indexer) isStorageModeAllowed(indexInst common.IndexInst) bool {
+
+	mode := common.IndexTypeToStorageMode(indexInst.Defn.Using)
+	if mode == common.GetStorageMode() {
+		return true
+	}
+
+	for _, inst := range idx.indexInstMap {
+		if inst.Defn.DefnId == indexInst.Defn.DefnId &&
+			inst.State != common.INDEX_STATE_DELETED &&
+			common.IndexTypeToStorageMode(inst.Defn.Using) == mode {
+			return true
+		}
+	}
+
+	pinned, ok := idx.getIndexStorageModes(idx.config)[indexInst.Defn.DefnId]
+	return ok && pinned == mode
+}
+
+//
+// indexStorageModes returns the storage modes of the local indexes, which
+// include the indexer storage mode.
+//
+func (idx *indexer) indexStorageModes() map[common.StorageMode]bool {
+
+	modes := make(map[common.StorageMode]bool)
+	if mode := common.GetStorageMode(); mode != common.NOT_SET {
+		modes[mode] = true
+	}
+	for _, inst := range idx.indexInstMap {
+		if mode := common.IndexTypeToStorageMode(inst.Defn.Using); mode != common.NOT_SET {
+			modes[mode] = true
+		}
+	}
+	return modes
+}
+
+//
+// Returns the storage mode of indexes that are set to their own storage mode.
+//
+func (idx *indexer) getIndexStorageModes(config common.Config) map[common.IndexDefnId]common.StorageMode {
+
+	nodeUUID := config["nodeuuid"].String()
+	modes, err := mc.GetIndexStorageModes(nodeUUID)
+	if err != nil {
+		logging.Errorf("Error when fetching index storage mode.  Error=%s", err)
+		return nil
+	}
+
+	return modes
+}
+
 func (idx *indexer) getBootstrapStorageMode(config common.Config) common.StorageMode {
 
 	nodeUUID := config["nodeuuid"].String()
@@ -8916,6 +9590,9 @@ func (idx *indexer) cleanupAllStreamKeyspaceIdState(
 	delete(idx.streamKeyspaceIdPendStart[streamId], keyspaceId)
 	delete(idx.streamKeyspaceIdCollectionId[streamId], keyspaceId)
 	delete(idx.streamKeyspaceIdOSOException[streamId], keyspaceId)
+	if streamId == common.INIT_STREAM {
+		idx.clearBuildPaused(keyspaceId)
+	}
 }
 
 func (idx *indexer) prepareStreamKeyspaceIdForFreshStart(
@@ -0,0 +1,130 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+//
+// I/O modes of the index files.  With the default mode, the storage engine
+// uses its own default, or for plasma the useMmapReads and useDirectIO
+// settings.
+//
+const (
+	IOModeDefault  = ""
+	IOModeBuffered = "buffered"
+	IOModeDirect   = "direct"
+	IOModeMmap     = "mmap"
+)
+
+const ioModeNodeOverridesSetting = "indexer.settings.io_mode.node_overrides"
+
+// I/O modes supported by each storage mode
+var ioModes = map[string][]string{
+	common.PlasmaDB: []string{IOModeBuffered, IOModeDirect, IOModeMmap},
+	common.ForestDB: []string{IOModeBuffered, IOModeDirect},
+}
+
+func ioModeSetting(storageMode string) string {
+	return "indexer.settings.io_mode." + storageMode
+}
+
+func isValidIOMode(storageMode string, mode string) bool {
+	if mode == IOModeDefault {
+		return true
+	}
+	for _, m := range ioModes[storageMode] {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// parseIOModeNodeOverrides parses the I/O modes of specific nodes, a JSON
+// object with the I/O mode of each storage mode by node UUID, e.g.
+// {"<nodeuuid>": {"plasma": "direct"}}.
+//
+func parseIOModeNodeOverrides(value string) (map[string]map[string]string, error) {
+
+	overrides := make(map[string]map[string]string)
+	if len(value) == 0 {
+		return overrides, nil
+	}
+
+	if err := json.Unmarshal([]byte(value), &overrides); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+//
+// validateIOModeSettings returns *common.SettingError if an I/O mode
+// setting has a mode not supported by its storage mode.
+//
+func validateIOModeSettings(config common.Config) error {
+
+	for storageMode, modes := range ioModes {
+		key := ioModeSetting(storageMode)
+		if val, ok := config[key]; ok {
+			if !isValidIOMode(storageMode, strings.ToLower(val.String())) {
+				return common.NewSettingError(key, val.Value, "Unsupported I/O mode",
+					strings.Join(modes, ", "))
+			}
+		}
+	}
+
+	val, ok := config[ioModeNodeOverridesSetting]
+	if !ok {
+		return nil
+	}
+
+	overrides, err := parseIOModeNodeOverrides(val.String())
+	if err != nil {
+		return common.NewSettingError(ioModeNodeOverridesSetting, val.Value, err.Error(),
+			`{"<nodeuuid>": {"<storage mode>": "<io mode>"}}`)
+	}
+
+	for node, nodeModes := range overrides {
+		for storageMode, mode := range nodeModes {
+			if _, ok := ioModes[storageMode]; !ok || !isValidIOMode(storageMode, strings.ToLower(mode)) {
+				return common.NewSettingError(ioModeNodeOverridesSetting, val.Value,
+					"Unsupported I/O mode "+mode+" of storage mode "+storageMode+" for node "+node, "")
+			}
+		}
+	}
+	return nil
+}
+
+//
+// getIOMode returns the I/O mode of a storage mode on this node, which is
+// the mode set for this node if any, or else the mode set for all nodes.
+// sysconf is the indexer config without the "indexer." prefix.
+//
+func getIOMode(sysconf common.Config, storageMode string) string {
+
+	if val, ok := sysconf["settings.io_mode.node_overrides"]; ok {
+		if overrides, err := parseIOModeNodeOverrides(val.String()); err == nil {
+			if mode, ok := overrides[sysconf["nodeuuid"].String()][storageMode]; ok {
+				return strings.ToLower(mode)
+			}
+		}
+	}
+
+	if val, ok := sysconf["settings.io_mode."+storageMode]; ok {
+		return strings.ToLower(val.String())
+	}
+	return IOModeDefault
+}
@@ -0,0 +1,116 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestParseIOModeNodeOverrides(t *testing.T) {
+
+	overrides, err := parseIOModeNodeOverrides("")
+	if err != nil || len(overrides) != 0 {
+		t.Fatalf("expected no overrides, got %v %v", overrides, err)
+	}
+
+	overrides, err = parseIOModeNodeOverrides(`{"n1": {"plasma": "direct", "forestdb": "buffered"}, "n2": {}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overrides) != 2 || overrides["n1"][common.PlasmaDB] != IOModeDirect ||
+		overrides["n1"][common.ForestDB] != IOModeBuffered || len(overrides["n2"]) != 0 {
+		t.Fatalf("unexpected overrides %v", overrides)
+	}
+
+	for _, value := range []string{`{`, `[]`, `{"n1": "direct"}`, `{"n1": {"plasma": 1}}`} {
+		if _, err := parseIOModeNodeOverrides(value); err == nil {
+			t.Fatalf("%v: expected error", value)
+		}
+	}
+}
+
+func TestValidateIOModeSettings(t *testing.T) {
+
+	tests := []struct {
+		key   string
+		value string
+		ok    bool
+	}{
+		{"indexer.settings.io_mode.plasma", "", true},
+		{"indexer.settings.io_mode.plasma", "mmap", true},
+		{"indexer.settings.io_mode.plasma", "Direct", true},
+		{"indexer.settings.io_mode.plasma", "async", false},
+		{"indexer.settings.io_mode.forestdb", "buffered", true},
+		{"indexer.settings.io_mode.forestdb", "mmap", false},
+
+		{ioModeNodeOverridesSetting, "", true},
+		{ioModeNodeOverridesSetting, `{"n1": {"plasma": "MMAP"}}`, true},
+		{ioModeNodeOverridesSetting, `{"n1": {"plasma": ""}, "n2": {"forestdb": "direct"}}`, true},
+		{ioModeNodeOverridesSetting, `{"n1": {"forestdb": "mmap"}}`, false},
+		{ioModeNodeOverridesSetting, `{"n1": {"memdb": "direct"}}`, false},
+		{ioModeNodeOverridesSetting, `{"n1": "direct"}`, false},
+		{ioModeNodeOverridesSetting, `not json`, false},
+	}
+
+	for _, test := range tests {
+		config := common.Config{test.key: common.ConfigValue{Value: test.value}}
+		err := validateIOModeSettings(config)
+		if (err == nil) != test.ok {
+			t.Fatalf("%v %v: expected ok %v, got %v", test.key, test.value, test.ok, err)
+		}
+
+		if err != nil {
+			if serr, ok := err.(*common.SettingError); !ok || serr.Key != test.key {
+				t.Fatalf("%v %v: unexpected error %#v", test.key, test.value, err)
+			}
+		}
+	}
+
+	if err := validateIOModeSettings(common.Config{}); err != nil {
+		t.Fatalf("expected no error without I/O mode settings, got %v", err)
+	}
+}
+
+func TestGetIOMode(t *testing.T) {
+
+	sysconf := common.Config{
+		"nodeuuid":                        common.ConfigValue{Value: "n1"},
+		"settings.io_mode.plasma":         common.ConfigValue{Value: "Buffered"},
+		"settings.io_mode.forestdb":       common.ConfigValue{Value: ""},
+		"settings.io_mode.node_overrides": common.ConfigValue{Value: ""},
+	}
+
+	if mode := getIOMode(sysconf, common.PlasmaDB); mode != IOModeBuffered {
+		t.Fatalf("expected mode %v, got %v", IOModeBuffered, mode)
+	}
+	if mode := getIOMode(sysconf, common.ForestDB); mode != IOModeDefault {
+		t.Fatalf("expected default mode, got %v", mode)
+	}
+	if mode := getIOMode(common.Config{}, common.PlasmaDB); mode != IOModeDefault {
+		t.Fatalf("expected default mode without settings, got %v", mode)
+	}
+
+	// the mode of this node overrides the mode of all nodes
+	sysconf["settings.io_mode.node_overrides"] = common.ConfigValue{
+		Value: `{"n1": {"plasma": "MMAP", "forestdb": "direct"}, "n2": {"plasma": "direct"}}`,
+	}
+	if mode := getIOMode(sysconf, common.PlasmaDB); mode != IOModeMmap {
+		t.Fatalf("expected mode %v, got %v", IOModeMmap, mode)
+	}
+	if mode := getIOMode(sysconf, common.ForestDB); mode != IOModeDirect {
+		t.Fatalf("expected mode %v, got %v", IOModeDirect, mode)
+	}
+
+	// the overrides of other nodes are ignored
+	sysconf["nodeuuid"] = common.ConfigValue{Value: "n3"}
+	if mode := getIOMode(sysconf, common.PlasmaDB); mode != IOModeBuffered {
+		t.Fatalf("expected mode %v, got %v", IOModeBuffered, mode)
+	}
+
+	// invalid overrides are ignored
+	sysconf["nodeuuid"] = common.ConfigValue{Value: "n1"}
+	sysconf["settings.io_mode.node_overrides"] = common.ConfigValue{Value: `{"n1": `}
+	if mode := getIOMode(sysconf, common.PlasmaDB); mode != IOModeBuffered {
+		t.Fatalf("expected mode %v, got %v", IOModeBuffered, mode)
+	}
+}
@@ -389,6 +389,8 @@ func (k *kvSender) openMutationStream(streamId c.StreamId, keyspaceId string,
 	err = rh.Run()
 
 	if rollbackTs != nil {
+		gRollbackEvents.record(streamId, keyspaceId, restartTsList, rollbackTs)
+
 		//convert from protobuf to native format
 		var nativeTs *c.TsVbuuid
 		if restartTsList != nil {
@@ -538,6 +540,8 @@ func (k *kvSender) restartVbuckets(streamId c.StreamId, keyspaceId string,
 	} else if rollback {
 		//if any of the requested vb is in rollback ts, send rollback
 		//msg to caller
+		gRollbackEvents.record(streamId, keyspaceId, protoRestartTs, rollbackTs)
+
 		//convert from protobuf to native format
 		nativeTs := rollbackTs.ToTsVbuuid(numVbuckets)
 
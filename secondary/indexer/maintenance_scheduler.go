@@ -0,0 +1,310 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+//
+// maintenanceKind is the kind of a maintenance job.  Pending jobs are run
+// in the order of their kind, then in the order they are submitted.
+//
+type maintenanceKind int
+
+const (
+	MAINT_SNAPSHOT_CLEANUP maintenanceKind = iota
+	MAINT_COMPACTION
+	MAINT_SCRUB
+)
+
+func (k maintenanceKind) String() string {
+	switch k {
+	case MAINT_SNAPSHOT_CLEANUP:
+		return "snapshot cleanup"
+	case MAINT_COMPACTION:
+		return "compaction"
+	case MAINT_SCRUB:
+		return "scrub"
+	default:
+		return "unknown"
+	}
+}
+
+type maintenanceKey struct {
+	kind maintenanceKind
+	key  string
+}
+
+type maintenanceJob struct {
+	kind   maintenanceKind
+	key    string
+	queued time.Time
+	fn     func()
+	donech chan bool
+}
+
+//
+// maintenanceScheduler runs the background work of the indexer (compaction,
+// scrubbing and cleanup of old snapshots), at most max_concurrent jobs at a
+// time.  While the indexer is overloaded, pending jobs are deferred, unless
+// they have been pending for more than max_defer.  A job submitted with
+// the kind and key of a pending or running job is dropped, so that the
+// timers of the components do not pile up jobs.  When the scheduler is
+// disabled, jobs are run immediately by the caller.
+//
+type maintenanceScheduler struct {
+	mutex         sync.Mutex
+	enabled       bool
+	overloaded    bool
+	maxConcurrent int
+	maxDefer      time.Duration
+	pending       []*maintenanceJob
+	keys          map[maintenanceKey]bool
+	running       int
+
+	completed int64
+	coalesced int64
+	deferrals int64
+	forced    int64
+}
+
+var gMaintenance = newMaintenanceScheduler()
+
+func newMaintenanceScheduler() *maintenanceScheduler {
+	return &maintenanceScheduler{
+		maxConcurrent: 1,
+		keys:          make(map[maintenanceKey]bool),
+	}
+}
+
+//
+// run runs fn as a maintenance job and waits for it to finish.  It returns
+// false if the job is dropped.
+//
+func (m *maintenanceScheduler) run(kind maintenanceKind, key string, fn func()) bool {
+
+	donech := m.submit(kind, key, fn)
+	if donech == nil {
+		return false
+	}
+
+	<-donech
+	return true
+}
+
+//
+// submit queues fn as a maintenance job.  It returns a channel closed when
+// the job is done, or nil if the job is dropped.
+//
+func (m *maintenanceScheduler) submit(kind maintenanceKind, key string, fn func()) chan bool {
+
+	donech := make(chan bool)
+
+	m.mutex.Lock()
+	if !m.enabled {
+		m.mutex.Unlock()
+		fn()
+		close(donech)
+		return donech
+	}
+
+	if m.keys[maintenanceKey{kind, key}] {
+		m.mutex.Unlock()
+		atomic.AddInt64(&m.coalesced, 1)
+		logging.Debugf("MaintenanceScheduler: Drop %v job %v.  Job already pending.", kind, key)
+		return nil
+	}
+
+	m.keys[maintenanceKey{kind, key}] = true
+	m.pending = append(m.pending, &maintenanceJob{
+		kind:   kind,
+		key:    key,
+		queued: time.Now(),
+		fn:     fn,
+		donech: donech,
+	})
+	sort.SliceStable(m.pending, func(i, j int) bool {
+		return m.pending[i].kind < m.pending[j].kind
+	})
+
+	m.dispatchNoLock()
+	m.mutex.Unlock()
+
+	return donech
+}
+
+//
+// update applies the settings and the load measured by the indexer, and
+// starts the jobs which can run.
+//
+func (m *maintenanceScheduler) update(enabled bool, maxConcurrent int, maxDefer time.Duration, overloaded bool) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if enabled != m.enabled {
+		logging.Infof("MaintenanceScheduler: enabled %v", enabled)
+	}
+
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+
+	m.enabled = enabled
+	m.maxConcurrent = maxConcurrent
+	m.maxDefer = maxDefer
+	m.overloaded = overloaded
+
+	m.dispatchNoLock()
+}
+
+func (m *maintenanceScheduler) dispatchNoLock() {
+
+	for len(m.pending) != 0 && (m.running < m.maxConcurrent || !m.enabled) {
+
+		pos := 0
+		if m.enabled && m.overloaded {
+			// only run the jobs deferred for more than max_defer
+			pos = -1
+			for i, job := range m.pending {
+				if time.Since(job.queued) > m.maxDefer {
+					pos = i
+					break
+				}
+			}
+
+			if pos == -1 {
+				atomic.AddInt64(&m.deferrals, 1)
+				return
+			}
+
+			atomic.AddInt64(&m.forced, 1)
+			logging.Infof("MaintenanceScheduler: Run %v job %v deferred for %v", m.pending[pos].kind,
+				m.pending[pos].key, time.Since(m.pending[pos].queued))
+		}
+
+		job := m.pending[pos]
+		m.pending = append(m.pending[:pos], m.pending[pos+1:]...)
+		m.running++
+
+		go m.execute(job)
+	}
+}
+
+func (m *maintenanceScheduler) execute(job *maintenanceJob) {
+
+	job.fn()
+
+	m.mutex.Lock()
+	delete(m.keys, maintenanceKey{job.kind, job.key})
+	m.running--
+	atomic.AddInt64(&m.completed, 1)
+	m.dispatchNoLock()
+	m.mutex.Unlock()
+
+	close(job.donech)
+}
+
+func (m *maintenanceScheduler) updateStats(stats *IndexerStats) {
+
+	m.mutex.Lock()
+	stats.maintenancePending.Set(int64(len(m.pending)))
+	stats.maintenanceRunning.Set(int64(m.running))
+	m.mutex.Unlock()
+
+	stats.maintenanceCompleted.Set(atomic.LoadInt64(&m.completed))
+	stats.maintenanceCoalesced.Set(atomic.LoadInt64(&m.coalesced))
+	stats.maintenanceDeferrals.Set(atomic.LoadInt64(&m.deferrals))
+	stats.maintenanceForced.Set(atomic.LoadInt64(&m.forced))
+}
+
+//
+// maintenanceLoad measures the load of the indexer for the maintenance
+// scheduler.  The indexer is overloaded if the average scan latency since
+// the last measurement is above maintenance.max_scan_latency, or if the
+// memory used by the mutation queue is above maintenance.max_queue_pressure
+// of its max memory.
+//
+type maintenanceLoad struct {
+	scanDuration int64
+	numRequests  int64
+	overloaded   bool
+}
+
+func (idx *indexer) runMaintenanceScheduler() {
+
+	logging.Infof("MaintenanceScheduler: started...")
+
+	l := &maintenanceLoad{}
+
+	for {
+		config := idx.config
+
+		enabled := config["settings.maintenance.enable"].Bool()
+		overloaded := false
+		if enabled {
+			overloaded = l.measure(idx, config["maintenance.max_scan_latency"].Uint64(),
+				config["maintenance.max_queue_pressure"].Float64())
+		}
+
+		maxDefer := time.Duration(config["maintenance.max_defer"].Uint64()) * time.Second
+		gMaintenance.update(enabled, config["settings.maintenance.max_concurrent"].Int(), maxDefer, overloaded)
+		gMaintenance.updateStats(idx.stats)
+
+		interval := config["maintenance.interval"].Int()
+		if interval <= 0 {
+			interval = 1
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+	}
+}
+
+func (l *maintenanceLoad) measure(idx *indexer, maxScanLatency uint64, maxQueuePressure float64) bool {
+
+	var scanDuration, numRequests int64
+	if stats := idx.statsMgr.stats.Get(); stats != nil {
+		for _, is := range stats.indexes {
+			scanDuration += is.int64Stats(func(ss *IndexStats) int64 { return ss.scanDuration.Value() })
+			numRequests += is.numRequests.Value()
+		}
+	}
+
+	var scanLatency time.Duration
+	// counters are reset when indexes are dropped
+	if numRequests > l.numRequests && scanDuration >= l.scanDuration {
+		scanLatency = time.Duration((scanDuration - l.scanDuration) / (numRequests - l.numRequests))
+	}
+	l.scanDuration = scanDuration
+	l.numRequests = numRequests
+
+	var queuePressure float64
+	if m, ok := idx.mutMgr.(*mutationMgr); ok {
+		if maxMem := atomic.LoadInt64(&m.maxMemory); maxMem > 0 {
+			queuePressure = float64(atomic.LoadInt64(&m.memUsed)) / float64(maxMem)
+		}
+	}
+
+	overloaded := scanLatency > time.Duration(maxScanLatency)*time.Millisecond ||
+		queuePressure > maxQueuePressure
+
+	if overloaded != l.overloaded {
+		logging.Infof("MaintenanceScheduler: overloaded %v.  Scan latency %v, mutation queue pressure %.2f",
+			overloaded, scanLatency, queuePressure)
+		l.overloaded = overloaded
+	}
+
+	return overloaded
+}
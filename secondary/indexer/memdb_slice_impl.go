@@ -150,8 +150,14 @@ type memdbSlice struct {
 	numWriters     int
 	maxRollbacks   int
 	maxDiskSnaps   int
+	maxSnapshotAge time.Duration
 	hasPersistence bool
 
+	// Limits the writers processing mutations at the same time to
+	// build_writer_threads of the index, until the initial build is done
+	buildWriters chan bool
+	buildDone    int32
+
 	totalFlushTime  time.Duration
 	totalCommitTime time.Duration
 
@@ -161,6 +167,13 @@ type memdbSlice struct {
 
 	isPersistorActive int32
 
+	// Disk snapshots are offloaded to the cold tier
+	offloaded int32
+
+	// A disk snapshot has been imported, which is loaded on the next warmup.
+	// No disk snapshot is written or removed until then.
+	imported int32
+
 	lastRollbackTs *common.TsVbuuid
 
 	// Array processing
@@ -214,8 +227,11 @@ func NewMemDBSlice(path string, sliceId SliceId, idxDefn common.IndexDefn,
 	slice.idxPartnId = partitionId
 	slice.id = sliceId
 	slice.numWriters = sysconf["numSliceWriters"].Int()
-	slice.maxRollbacks = sysconf["settings.moi.recovery.max_rollbacks"].Int()
-	slice.maxDiskSnaps = sysconf["recovery.max_disksnaps"].Int()
+	if idxDefn.BuildWriterThreads > 0 && idxDefn.BuildWriterThreads < slice.numWriters {
+		slice.buildWriters = make(chan bool, idxDefn.BuildWriterThreads)
+	}
+	slice.maxRollbacks, slice.maxDiskSnaps, slice.maxSnapshotAge =
+		getSnapshotRetention(sysconf, "settings.moi.recovery.max_rollbacks")
 	slice.numVbuckets = sysconf["numVbuckets"].Int()
 	slice.clusterAddr = sysconf["clusterAddr"].String()
 	slice.exposeItemCopy = sysconf["moi.exposeItemCopy"].Bool()
@@ -410,6 +426,8 @@ loop:
 		var nmut int
 		select {
 		case icmd = <-mdb.cmdCh[workerId]:
+			limited := mdb.acquireBuildWriter()
+
 			switch icmd.op {
 			case opUpdate:
 				start = time.Now()
@@ -428,6 +446,10 @@ loop:
 					"Unknown Command %v", mdb.id, mdb.idxInstId, mdb.idxPartnId, logging.TagUD(icmd))
 			}
 
+			if limited {
+				<-mdb.buildWriters
+			}
+
 			mdb.idxStats.numItemsFlushed.Add(int64(nmut))
 			mdb.idxStats.numDocsIndexed.Add(1)
 			atomic.AddInt64(&mdb.qCount, -1)
@@ -443,6 +465,33 @@ loop:
 	}
 }
 
+//
+// acquireBuildWriter waits until fewer than build_writer_threads writers
+// are processing a mutation, during the initial build.  It returns false
+// if the writers are not limited.
+//
+func (mdb *memdbSlice) acquireBuildWriter() bool {
+
+	if mdb.buildWriters == nil || atomic.LoadInt32(&mdb.buildDone) == 1 {
+		return false
+	}
+
+	mdb.buildWriters <- true
+	return true
+}
+
+//
+// InitialBuildDone lifts the limit of build_writer_threads, so that all
+// the writers of the slice process mutations.
+//
+func (mdb *memdbSlice) InitialBuildDone() {
+
+	if mdb.buildWriters != nil && atomic.CompareAndSwapInt32(&mdb.buildDone, 0, 1) {
+		logging.Infof("MemDBSlice::InitialBuildDone SliceId %v IndexInstId %v PartitionId %v "+
+			"WriterThreads %v", mdb.id, mdb.idxInstId, mdb.idxPartnId, mdb.numWriters)
+	}
+}
+
 func (mdb *memdbSlice) updateSliceBuffers(workerId int) keySizeConfig {
 
 	if atomic.LoadInt32(&mdb.keySzConfChanged[workerId]) >= 1 {
@@ -932,6 +981,20 @@ func (mdb *memdbSlice) OpenSnapshot(info SnapshotInfo) (Snapshot, error) {
 func (mdb *memdbSlice) doPersistSnapshot(s *memdbSnapshot) {
 	var concurrency int = 1
 
+	if atomic.LoadInt32(&mdb.imported) == 1 {
+		logging.Debugf("MemDBSlice Slice Id %v, IndexInstId %v, PartitionId %v skip"+
+			" ondisk snapshot.  A snapshot is imported", mdb.id, mdb.idxInstId, mdb.idxPartnId)
+		s.info.MainSnap.Close()
+		return
+	}
+
+	if atomic.LoadInt32(&mdb.offloaded) == 1 {
+		logging.Debugf("MemDBSlice Slice Id %v, IndexInstId %v, PartitionId %v skip"+
+			" ondisk snapshot.  Snapshots are offloaded to the cold tier", mdb.id, mdb.idxInstId, mdb.idxPartnId)
+		s.info.MainSnap.Close()
+		return
+	}
+
 	if atomic.CompareAndSwapInt32(&mdb.isPersistorActive, 0, 1) {
 		defer atomic.StoreInt32(&mdb.isPersistorActive, 0)
 
@@ -1068,6 +1131,230 @@ func (mdb *memdbSlice) cleanupOldSnapshotFiles(keepn int) {
 			}
 		}
 	}
+
+	mdb.cleanupExpiredSnapshotFiles()
+}
+
+//
+// cleanupExpiredSnapshotFiles removes the disk snapshots older than
+// snapshot_retention.max_age, except the latest one.  The age of a disk
+// snapshot is the age of its manifest.
+//
+func (mdb *memdbSlice) cleanupExpiredSnapshotFiles() {
+
+	maxAge := mdb.maxSnapshotAge
+	if maxAge <= 0 {
+		return
+	}
+
+	// manifests are sorted from the latest
+	_, manifests, _ := mdb.getSnapshots()
+	for i := 1; i < len(manifests); i++ {
+		fi, err := os.Stat(manifests[i])
+		if err != nil || time.Since(fi.ModTime()) <= maxAge {
+			continue
+		}
+
+		dir := filepath.Dir(manifests[i])
+		logging.Infof("MemDBSlice Slice Id %v, IndexInstId %v, PartitionId %v "+
+			"Removing disk snapshot %v older than %v.", mdb.id, mdb.idxInstId,
+			mdb.idxPartnId, dir, maxAge)
+		os.RemoveAll(dir)
+	}
+}
+
+//
+// EnforceSnapshotRetention is skipped while a snapshot is written, as the
+// persistor removes the old snapshots once done.
+//
+func (mdb *memdbSlice) EnforceSnapshotRetention() {
+
+	if atomic.LoadInt32(&mdb.imported) == 1 {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&mdb.isPersistorActive, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&mdb.isPersistorActive, 0)
+
+	if len(mdb.getSnapshotManifests()) > mdb.maxRollbacks {
+		mdb.cleanupOldSnapshotFiles(mdb.maxRollbacks)
+	} else {
+		mdb.cleanupExpiredSnapshotFiles()
+	}
+}
+
+//
+// ExportSnapshot copies the latest disk snapshot to dir.  Disk snapshots are
+// not modified once written, and the persistor (which is also responsible for
+// removing old snapshots) is held off during the copy.
+//
+func (mdb *memdbSlice) ExportSnapshot(dir string) (SnapshotInfo, error) {
+
+	if !atomic.CompareAndSwapInt32(&mdb.isPersistorActive, 0, 1) {
+		return nil, errors.New("A snapshot writer is in progress.  Please retry later.")
+	}
+	defer atomic.StoreInt32(&mdb.isPersistorActive, 0)
+
+	infos, manifests, err := mdb.getSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	if len(manifests) == 0 {
+		return nil, errors.New("No disk snapshot available")
+	}
+
+	src := filepath.Dir(manifests[0])
+	if err := common.CopyDir(dir, src); err != nil {
+		return nil, err
+	}
+
+	logging.Infof("MemDBSlice Slice Id %v, IndexInstId %v, PartitionId %v exported"+
+		" ondisk snapshot %v to %v", mdb.id, mdb.idxInstId, mdb.idxPartnId, src, dir)
+
+	return infos[0], nil
+}
+
+//
+// ImportSnapshot adds the disk snapshot exported to dir as the latest disk
+// snapshot of the slice.  Index is recovered from it on the next warmup,
+// and until then the persistor does not write disk snapshots, which would
+// supersede the imported one.
+//
+func (mdb *memdbSlice) ImportSnapshot(dir string) error {
+
+	if !atomic.CompareAndSwapInt32(&mdb.isPersistorActive, 0, 1) {
+		return errors.New("A snapshot writer is in progress.  Please retry later.")
+	}
+	defer atomic.StoreInt32(&mdb.isPersistorActive, 0)
+
+	dest, err := mdb.copySnapshot(dir)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&mdb.imported, 1)
+
+	logging.Infof("MemDBSlice Slice Id %v, IndexInstId %v, PartitionId %v imported"+
+		" ondisk snapshot %v from %v", mdb.id, mdb.idxInstId, mdb.idxPartnId, dest, dir)
+
+	return nil
+}
+
+//
+// RestoreSnapshot adds the disk snapshot hydrated from the cold tier to dir
+// as the latest disk snapshot of the slice, and writes disk snapshots
+// again.  Index is recovered from it on warmup or rollback.
+//
+func (mdb *memdbSlice) RestoreSnapshot(dir string) error {
+
+	if !atomic.CompareAndSwapInt32(&mdb.isPersistorActive, 0, 1) {
+		return errors.New("A snapshot writer is in progress.  Please retry later.")
+	}
+	defer atomic.StoreInt32(&mdb.isPersistorActive, 0)
+
+	dest, err := mdb.copySnapshot(dir)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&mdb.offloaded, 0)
+
+	logging.Infof("MemDBSlice Slice Id %v, IndexInstId %v, PartitionId %v restored"+
+		" ondisk snapshot %v from %v", mdb.id, mdb.idxInstId, mdb.idxPartnId, dest, dir)
+
+	return nil
+}
+
+// copySnapshot copies the disk snapshot in dir to a new snapshot of the
+// slice, and returns its path.  The caller must be the persistor.
+func (mdb *memdbSlice) copySnapshot(dir string) (string, error) {
+
+	if !common.IsPathExist(filepath.Join(dir, "manifest.json")) {
+		return "", fmt.Errorf("Missing snapshot manifest in %v", dir)
+	}
+
+	tmpdir := filepath.Join(mdb.path, tmpDirName)
+	os.RemoveAll(tmpdir)
+
+	if err := common.CopyDir(tmpdir, dir); err != nil {
+		os.RemoveAll(tmpdir)
+		return "", err
+	}
+
+	dest := newSnapshotPath(mdb.path)
+	if err := os.Rename(tmpdir, dest); err != nil {
+		os.RemoveAll(tmpdir)
+		return "", err
+	}
+
+	return dest, nil
+}
+
+//
+// LoadSnapshot loads the latest disk snapshot, usually the one added by
+// ImportSnapshot, into the slice.  The slice must not have any data yet,
+// i.e. the index is not built.  Disk snapshots are written again once it
+// is loaded.
+//
+func (mdb *memdbSlice) LoadSnapshot() (SnapshotInfo, error) {
+
+	if !atomic.CompareAndSwapInt32(&mdb.isPersistorActive, 0, 1) {
+		return nil, errors.New("A snapshot writer is in progress.  Please retry later.")
+	}
+	defer atomic.StoreInt32(&mdb.isPersistorActive, 0)
+
+	infos, _, err := mdb.getSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, errors.New("No disk snapshot available")
+	}
+
+	if atomic.LoadUint64(&mdb.committedCount) != 0 || atomic.LoadInt64(&mdb.qCount) != 0 {
+		return nil, errors.New("Cannot load snapshot into a slice with data")
+	}
+
+	// a failed load removes the snapshot
+	defer atomic.StoreInt32(&mdb.imported, 0)
+
+	info := infos[0].(*memdbSnapshotInfo)
+	if err := mdb.loadSnapshot(info); err != nil {
+		return nil, err
+	}
+	info.MainSnap.Close()
+	info.MainSnap = nil
+
+	logging.Infof("MemDBSlice Slice Id %v, IndexInstId %v, PartitionId %v loaded"+
+		" ondisk snapshot %v", mdb.id, mdb.idxInstId, mdb.idxPartnId, info.dataPath)
+
+	return info, nil
+}
+
+//
+// SetOffloaded stops writing disk snapshots and removes the existing ones,
+// after they have been copied to the cold tier.  Disk snapshots are written
+// again after SetOffloaded(false).
+//
+func (mdb *memdbSlice) SetOffloaded(offloaded bool) error {
+
+	if !offloaded {
+		atomic.StoreInt32(&mdb.offloaded, 0)
+		return nil
+	}
+
+	if !atomic.CompareAndSwapInt32(&mdb.isPersistorActive, 0, 1) {
+		return errors.New("A snapshot writer is in progress.  Please retry later.")
+	}
+	defer atomic.StoreInt32(&mdb.isPersistorActive, 0)
+
+	atomic.StoreInt32(&mdb.offloaded, 1)
+	mdb.cleanupAllOldSnapshotFiles()
+
+	logging.Infof("MemDBSlice Slice Id %v, IndexInstId %v, PartitionId %v ondisk"+
+		" snapshots are offloaded to the cold tier", mdb.id, mdb.idxInstId, mdb.idxPartnId)
+
+	return nil
 }
 
 func (mdb *memdbSlice) cleanupAllOldSnapshotFiles() {
@@ -1091,9 +1378,17 @@ func (mdb *memdbSlice) diskSize() int64 {
 }
 
 func (mdb *memdbSlice) getSnapshotManifests() []string {
+	return getSnapshotManifests(mdb.path)
+}
+
+//
+// getSnapshotManifests returns the sorted manifests of the disk snapshots
+// of the slice at path.
+//
+func getSnapshotManifests(path string) []string {
 	var files []string
 	pattern := "*/manifest.json"
-	all, _ := filepath.Glob(filepath.Join(mdb.path, pattern))
+	all, _ := filepath.Glob(filepath.Join(path, pattern))
 	for _, f := range all {
 		if !strings.Contains(f, tmpDirName) {
 			files = append(files, f)
@@ -1363,6 +1658,7 @@ func (mdb *memdbSlice) RollbackToZero() error {
 
 	mdb.resetStores()
 	mdb.cleanupAllOldSnapshotFiles()
+	atomic.StoreInt32(&mdb.imported, 0)
 
 	mdb.lastRollbackTs = nil
 
@@ -1615,8 +1911,8 @@ func (mdb *memdbSlice) UpdateConfig(cfg common.Config) {
 
 	oldCfg := mdb.sysconf
 	mdb.sysconf = cfg
-	mdb.maxRollbacks = cfg["settings.moi.recovery.max_rollbacks"].Int()
-	mdb.maxDiskSnaps = cfg["recovery.max_disksnaps"].Int()
+	mdb.maxRollbacks, mdb.maxDiskSnaps, mdb.maxSnapshotAge =
+		getSnapshotRetention(cfg, "settings.moi.recovery.max_rollbacks")
 
 	mdb.exposeItemCopy = cfg["moi.exposeItemCopy"].Bool()
 	mdb.mainstore.SetExposeItemCopy(mdb.exposeItemCopy)
@@ -2009,6 +2305,79 @@ loop:
 	return nil
 }
 
+func (s *memdbSnapshot) ReverseRange(ctx IndexReaderContext, low, high IndexKey, inclusion Inclusion,
+	callb EntryCallback) error {
+
+	var cmpFn CmpEntry
+	if s.isPrimary() {
+		cmpFn = compareExact
+	} else {
+		cmpFn = comparePrefix
+	}
+
+	return s.IterateReverse(ctx, low, high, inclusion, cmpFn, callb)
+}
+
+//
+// IterateReverse returns the entries from high down to low.  The iterator
+// is positioned at the last entry equal to high, as the entries equal to a
+// prefix key sort after the key itself.
+//
+func (s *memdbSnapshot) IterateReverse(ctx IndexReaderContext, low, high IndexKey, inclusion Inclusion,
+	cmpFn CmpEntry, callback EntryCallback) error {
+	var entry IndexEntry
+	var err error
+	t0 := time.Now()
+	it := s.info.MainSnap.NewIterator()
+	defer it.Close()
+
+	if high.Bytes() == nil {
+		it.SeekLast()
+	} else {
+		it.Seek(high.Bytes())
+		if err = s.iterEqualKeys(high, it, cmpFn, nil); err != nil {
+			return err
+		}
+
+		if it.Valid() {
+			it.Prev()
+		} else {
+			it.SeekLast()
+		}
+	}
+	s.slice.idxStats.Timings.stNewIterator.Put(time.Since(t0))
+
+	// Discard equal keys if high inclusion is not requested
+	for ; it.Valid(); it.Prev() {
+		s.newIndexEntry(it.Get(), &entry)
+		cmp := cmpFn(high, entry)
+		if cmp > 0 || (cmp == 0 && (inclusion == Both || inclusion == High)) {
+			break
+		}
+	}
+
+loop:
+	for it.Valid() {
+		itm := it.Get()
+		s.newIndexEntry(itm, &entry)
+
+		// Iterator has reached past the low key, no need to scan further
+		cmp := cmpFn(low, entry)
+		if cmp > 0 || (cmp == 0 && (inclusion == Neither || inclusion == High)) {
+			break loop
+		}
+
+		err = callback(entry.Bytes())
+		if err != nil {
+			return err
+		}
+
+		it.Prev()
+	}
+
+	return nil
+}
+
 func (s *memdbSnapshot) isPrimary() bool {
 	return s.slice.isPrimary
 }
@@ -174,3 +174,43 @@ func TestMemDBInsertionPerf(t *testing.T) {
 		}
 	}
 }
+
+func TestMemDBBuildWriters(t *testing.T) {
+
+	// writers are not limited without build_writer_threads
+	mdb := &memdbSlice{}
+	if mdb.acquireBuildWriter() {
+		t.Fatal("unexpected limited writer")
+	}
+
+	mdb = &memdbSlice{numWriters: 4, buildWriters: make(chan bool, 2)}
+	for i := 0; i < 2; i++ {
+		if !mdb.acquireBuildWriter() {
+			t.Fatal("expected limited writer")
+		}
+	}
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- mdb.acquireBuildWriter()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected writer to wait for build_writer_threads")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	<-mdb.buildWriters
+	if !<-acquired {
+		t.Fatal("expected limited writer")
+	}
+
+	// all the writers run once the initial build is done
+	mdb.InitialBuildDone()
+	for i := 0; i < 4; i++ {
+		if mdb.acquireBuildWriter() {
+			t.Fatal("unexpected limited writer after initial build")
+		}
+	}
+}
@@ -0,0 +1,350 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/plasma"
+)
+
+//
+// Memory allocated by the memory controller, as fractions of memory_quota,
+// stored as float64 bits.  0 means the default allocation.
+//
+var gMutationQueueMemFrac uint64
+var gPlasmaMemQuotaFrac uint64
+var gScanQueueScale uint64
+
+// Usage of the scan queues, to measure the pressure of the scan buffers
+var gScanQueueEnqueues int64
+var gScanQueueFullWaits int64
+
+func loadFloat64(addr *uint64) float64 {
+	return math.Float64frombits(atomic.LoadUint64(addr))
+}
+
+func storeFloat64(addr *uint64, value float64) {
+	atomic.StoreUint64(addr, math.Float64bits(value))
+}
+
+func getPlasmaMemQuotaFrac() float64 {
+	if frac := loadFloat64(&gPlasmaMemQuotaFrac); frac != 0 {
+		return frac
+	}
+	return PLASMA_MEMQUOTA_FRAC
+}
+
+// Memory of the bloom filters when the plasma quota was last set
+var gPlasmaQuotaBloomFilterMemory int64
+
+//
+// getPlasmaMemQuota returns the memory quota of plasma, less the memory
+// used by the bloom filters.
+//
+func getPlasmaMemQuota(memQuota uint64) int64 {
+	atomic.StoreInt64(&gPlasmaQuotaBloomFilterMemory, getBloomFilterMemory())
+	return int64(float64(memQuota)*getPlasmaMemQuotaFrac()) - getBloomFilterMemory()
+}
+
+//
+// updatePlasmaMemQuota sets the memory quota of plasma again when the
+// memory of the bloom filters has changed.
+//
+func updatePlasmaMemQuota(config common.Config) {
+
+	if common.GetStorageMode() != common.PLASMA {
+		return
+	}
+
+	if getBloomFilterMemory() != atomic.LoadInt64(&gPlasmaQuotaBloomFilterMemory) {
+		plasma.SetMemoryQuota(getPlasmaMemQuota(config["settings.memory_quota"].Uint64()))
+	}
+}
+
+func getScanQueueScale() float64 {
+	if scale := loadFloat64(&gScanQueueScale); scale != 0 {
+		return scale
+	}
+	return 1
+}
+
+func recordScanQueueUsage(enqueues, fullWaits int64) {
+	atomic.AddInt64(&gScanQueueEnqueues, enqueues)
+	atomic.AddInt64(&gScanQueueFullWaits, fullWaits)
+}
+
+//
+// memComponent is a component of the indexer which is given a part of
+// memory_quota.  Its pressure is between 0 and 1.
+//
+type memComponent struct {
+	name     string
+	initial  float64
+	frac     float64
+	min      float64
+	max      float64
+	pressure float64
+	enabled  bool
+}
+
+//
+// memoryController moves memory between the mutation queue, the plasma
+// block cache and the scan buffers.  At each interval, a component with
+// pressure above memory_controller.high_pressure is given
+// memory_controller.step of memory_quota from the component with the
+// lowest pressure, if it is below memory_controller.low_pressure.  The
+// pressure is:
+//   mutation queue: memory used over the max memory of the queue.
+//   block cache: fraction of lookups missing the plasma cache.
+//   scan buffers: fraction of rows found the scan queue full.
+// The scan buffers are adjusted by scaling scan.queue_size.  Their share
+// of memory_quota is notional, as the scan queues are not allocated from
+// memory_quota, so they only give back memory that was moved to them.
+//
+type memoryController struct {
+	mutationQueue *memComponent
+	blockCache    *memComponent
+	scanBuffers   *memComponent
+
+	enabled     bool
+	enqueues    int64
+	fullWaits   int64
+	cacheHits   int64
+	cacheMisses int64
+}
+
+func (idx *indexer) runMemoryController() {
+
+	logging.Infof("MemoryController: started...")
+
+	c := &memoryController{}
+
+	for {
+		config := idx.config
+
+		if config["settings.memory_controller.enable"].Bool() {
+			if !c.enabled {
+				c.init(config)
+			}
+			c.adjust(idx, config)
+		} else if c.enabled {
+			c.reset(idx, config)
+		}
+
+		interval := config["settings.memory_controller.interval"].Int()
+		if interval <= 0 {
+			interval = 1
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+	}
+}
+
+func (c *memoryController) components() []*memComponent {
+	return []*memComponent{c.mutationQueue, c.blockCache, c.scanBuffers}
+}
+
+func (c *memoryController) init(config common.Config) {
+
+	memQuota := float64(config["settings.memory_quota"].Uint64())
+	maxScale := config["memory_controller.max_scale"].Float64()
+	if maxScale < 1 {
+		maxScale = 1
+	}
+
+	newComponent := func(name string, initial float64, enabled bool) *memComponent {
+		return &memComponent{
+			name:    name,
+			initial: initial,
+			frac:    initial,
+			min:     initial / maxScale,
+			max:     math.Min(initial*maxScale, 1),
+			enabled: enabled,
+		}
+	}
+
+	c.mutationQueue = newComponent("mutation queue", configMutationQueueMemFrac(config), true)
+	if memQuota > 0 {
+		maxQueueMem := float64(config["mutation_manager.maxQueueMem"].Uint64()) / memQuota
+		c.mutationQueue.max = math.Max(math.Min(c.mutationQueue.max, maxQueueMem), c.mutationQueue.frac)
+	}
+
+	c.blockCache = newComponent("block cache", PLASMA_MEMQUOTA_FRAC, common.GetStorageMode() == common.PLASMA)
+	c.scanBuffers = newComponent("scan buffers", config["memory_controller.scan_buffer_frac"].Float64(), true)
+	c.scanBuffers.min = c.scanBuffers.initial
+
+	c.enqueues = atomic.LoadInt64(&gScanQueueEnqueues)
+	c.fullWaits = atomic.LoadInt64(&gScanQueueFullWaits)
+	c.cacheHits, c.cacheMisses = 0, 0
+	c.enabled = true
+
+	logging.Infof("MemoryController: enabled.  Mutation queue %.3f, block cache %.3f, scan buffers %.3f of memory quota",
+		c.mutationQueue.frac, c.blockCache.frac, c.scanBuffers.frac)
+}
+
+func (c *memoryController) measure(idx *indexer, config common.Config) {
+
+	c.mutationQueue.pressure = 0
+	if m, ok := idx.mutMgr.(*mutationMgr); ok {
+		if maxMem := atomic.LoadInt64(&m.maxMemory); maxMem > 0 {
+			c.mutationQueue.pressure = float64(atomic.LoadInt64(&m.memUsed)) / float64(maxMem)
+		}
+	}
+
+	c.blockCache.pressure = 0
+	if c.blockCache.enabled {
+		var hits, misses int64
+		if stats := idx.statsMgr.stats.Get(); stats != nil {
+			for _, is := range stats.indexes {
+				hits += is.partnInt64Stats(func(ss *IndexStats) int64 { return ss.cacheHits.Value() })
+				misses += is.partnInt64Stats(func(ss *IndexStats) int64 { return ss.cacheMisses.Value() })
+			}
+		}
+
+		// counters are reset when indexes are dropped
+		if hits >= c.cacheHits && misses >= c.cacheMisses && hits+misses > c.cacheHits+c.cacheMisses {
+			c.blockCache.pressure = float64(misses-c.cacheMisses) / float64(hits+misses-c.cacheHits-c.cacheMisses)
+		}
+		c.cacheHits = hits
+		c.cacheMisses = misses
+	}
+
+	enqueues := atomic.LoadInt64(&gScanQueueEnqueues)
+	fullWaits := atomic.LoadInt64(&gScanQueueFullWaits)
+	c.scanBuffers.pressure = 0
+	if enqueues > c.enqueues {
+		c.scanBuffers.pressure = float64(fullWaits-c.fullWaits) / float64(enqueues-c.enqueues)
+	}
+	c.enqueues = enqueues
+	c.fullWaits = fullWaits
+
+	for _, comp := range c.components() {
+		comp.pressure = math.Min(comp.pressure, 1)
+	}
+}
+
+func (c *memoryController) adjust(idx *indexer, config common.Config) {
+
+	c.measure(idx, config)
+
+	if c.rebalance(config) {
+		c.apply(idx, config)
+		idx.stats.memoryControllerAdjustments.Add(1)
+	}
+
+	c.updateStats(idx, config)
+}
+
+//
+// rebalance moves memory from the donor to the receiver, based on the
+// measured pressures.  It returns true if memory was moved.
+//
+func (c *memoryController) rebalance(config common.Config) bool {
+
+	high := config["memory_controller.high_pressure"].Float64()
+	low := config["memory_controller.low_pressure"].Float64()
+	step := config["memory_controller.step"].Float64()
+
+	var receiver, donor *memComponent
+	for _, comp := range c.components() {
+		if !comp.enabled {
+			continue
+		}
+		if comp.pressure > high && comp.frac < comp.max &&
+			(receiver == nil || comp.pressure > receiver.pressure) {
+			receiver = comp
+		}
+	}
+
+	for _, comp := range c.components() {
+		if !comp.enabled || comp == receiver {
+			continue
+		}
+		if comp.pressure < low && comp.frac > comp.min &&
+			(donor == nil || comp.pressure < donor.pressure) {
+			donor = comp
+		}
+	}
+
+	if receiver == nil || donor == nil {
+		return false
+	}
+
+	amount := math.Min(step, math.Min(donor.frac-donor.min, receiver.max-receiver.frac))
+	if amount <= 0 {
+		return false
+	}
+
+	donor.frac -= amount
+	receiver.frac += amount
+
+	memQuota := config["settings.memory_quota"].Uint64()
+	logging.Infof("MemoryController: Move %.1f%% of memory quota (%v bytes) from %v (pressure %.2f) "+
+		"to %v (pressure %.2f)", amount*100, uint64(amount*float64(memQuota)),
+		donor.name, donor.pressure, receiver.name, receiver.pressure)
+
+	return true
+}
+
+func (c *memoryController) apply(idx *indexer, config common.Config) {
+
+	storeFloat64(&gMutationQueueMemFrac, c.mutationQueue.frac)
+	storeFloat64(&gScanQueueScale, c.scanBuffers.frac/c.scanBuffers.initial)
+	if c.blockCache.enabled {
+		storeFloat64(&gPlasmaMemQuotaFrac, c.blockCache.frac)
+	}
+
+	c.applyQuota(idx, config)
+}
+
+//
+// reset restores the default memory allocation.
+//
+func (c *memoryController) reset(idx *indexer, config common.Config) {
+
+	logging.Infof("MemoryController: disabled.  Restore default memory allocation.")
+
+	storeFloat64(&gMutationQueueMemFrac, 0)
+	storeFloat64(&gPlasmaMemQuotaFrac, 0)
+	storeFloat64(&gScanQueueScale, 0)
+
+	c.applyQuota(idx, config)
+	c.enabled = false
+
+	idx.stats.memoryAllocMutationQueue.Set(0)
+	idx.stats.memoryAllocBlockCache.Set(0)
+	idx.stats.memoryAllocScanBuffers.Set(0)
+}
+
+func (c *memoryController) applyQuota(idx *indexer, config common.Config) {
+
+	if m, ok := idx.mutMgr.(*mutationMgr); ok {
+		atomic.StoreInt64(&m.maxMemory, getMaxQueueMemory(config))
+	}
+
+	if common.GetStorageMode() == common.PLASMA {
+		plasma.SetMemoryQuota(getPlasmaMemQuota(config["settings.memory_quota"].Uint64()))
+	}
+}
+
+func (c *memoryController) updateStats(idx *indexer, config common.Config) {
+
+	memQuota := float64(config["settings.memory_quota"].Uint64())
+
+	idx.stats.memoryAllocMutationQueue.Set(int64(c.mutationQueue.frac * memQuota))
+	idx.stats.memoryAllocScanBuffers.Set(int64(c.scanBuffers.frac * memQuota))
+	if c.blockCache.enabled {
+		idx.stats.memoryAllocBlockCache.Set(int64(c.blockCache.frac * memQuota))
+	}
+}
@@ -0,0 +1,132 @@
+package indexer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func newTestMemoryController() (*memoryController, common.Config) {
+
+	config := common.SystemConfig.SectionConfig("indexer.", true)
+	config.SetValue("settings.memory_quota", uint64(1000*1024*1024))
+	config.SetValue("mutation_manager.maxQueueMem", uint64(1000*1024*1024))
+	config.SetValue("memory_controller.step", 0.02)
+	config.SetValue("memory_controller.max_scale", 2.0)
+
+	c := &memoryController{}
+	c.init(config)
+	c.blockCache.enabled = true
+	return c, config
+}
+
+func checkTotal(t *testing.T, c *memoryController, total float64) {
+
+	var sum float64
+	for _, comp := range c.components() {
+		sum += comp.frac
+	}
+	if math.Abs(sum-total) > 1e-9 {
+		t.Fatalf("expected total %v, got %v", total, sum)
+	}
+}
+
+func TestMemoryControllerRebalance(t *testing.T) {
+
+	c, config := newTestMemoryController()
+	total := c.mutationQueue.frac + c.blockCache.frac + c.scanBuffers.frac
+
+	// no pressure, no move
+	if c.rebalance(config) {
+		t.Fatal("unexpected move without pressure")
+	}
+
+	// memory moves from the component with the lowest pressure
+	c.mutationQueue.pressure = 0.95
+	c.blockCache.pressure = 0.1
+	c.scanBuffers.pressure = 0.3
+	initial := c.blockCache.frac
+	if !c.rebalance(config) {
+		t.Fatal("expected move to the mutation queue")
+	}
+	if math.Abs(initial-c.blockCache.frac-0.02) > 1e-9 {
+		t.Fatalf("expected block cache to give 0.02, got %v", initial-c.blockCache.frac)
+	}
+	checkTotal(t, c, total)
+
+	// no donor below low pressure
+	c.blockCache.pressure = 0.6
+	c.scanBuffers.pressure = 0.6
+	if c.rebalance(config) {
+		t.Fatal("unexpected move without donor")
+	}
+
+	// receiver is bounded by its max
+	c.mutationQueue.pressure = 0.1
+	c.blockCache.pressure = 0.95
+	for c.rebalance(config) {
+		checkTotal(t, c, total)
+	}
+	if c.mutationQueue.frac < c.mutationQueue.min-1e-9 {
+		t.Fatalf("mutation queue %v below min %v", c.mutationQueue.frac, c.mutationQueue.min)
+	}
+	if c.blockCache.frac > c.blockCache.max+1e-9 {
+		t.Fatalf("block cache %v above max %v", c.blockCache.frac, c.blockCache.max)
+	}
+}
+
+func TestMemoryControllerScanBuffers(t *testing.T) {
+
+	c, config := newTestMemoryController()
+	total := c.mutationQueue.frac + c.blockCache.frac + c.scanBuffers.frac
+
+	// the scan buffers do not give memory they were not given
+	c.mutationQueue.pressure = 0.95
+	c.blockCache.pressure = 0.6
+	c.scanBuffers.pressure = 0
+	if c.rebalance(config) {
+		t.Fatal("unexpected move from the scan buffers")
+	}
+
+	// the scan buffers give back memory they were given
+	c.mutationQueue.pressure = 0.6
+	c.blockCache.pressure = 0.1
+	c.scanBuffers.pressure = 0.95
+	if !c.rebalance(config) {
+		t.Fatal("expected move to the scan buffers")
+	}
+	checkTotal(t, c, total)
+
+	c.mutationQueue.pressure = 0.6
+	c.blockCache.pressure = 0.95
+	c.scanBuffers.pressure = 0
+	if !c.rebalance(config) {
+		t.Fatal("expected move from the scan buffers")
+	}
+	if c.scanBuffers.frac != c.scanBuffers.initial {
+		t.Fatalf("expected scan buffers %v, got %v", c.scanBuffers.initial, c.scanBuffers.frac)
+	}
+	if c.rebalance(config) {
+		t.Fatal("unexpected move from the scan buffers")
+	}
+	checkTotal(t, c, total)
+}
+
+func TestQueueSizeScale(t *testing.T) {
+
+	config := common.SystemConfig.SectionConfig("indexer.", true)
+	config.SetValue("scan.queue_size", 20)
+	config.SetValue("scan.notify_count", 50)
+	defer storeFloat64(&gScanQueueScale, 0)
+
+	// without the memory controller, scan.queue_size is used
+	if size, _ := queueSize(1, false, config); size != 20 {
+		t.Fatalf("expected queue size 20, got %v", size)
+	}
+
+	storeFloat64(&gScanQueueScale, 2)
+	if size, _ := queueSize(1, false, config); size != 40 {
+		t.Fatalf("expected queue size 40, got %v", size)
+	}
+}
@@ -74,6 +74,10 @@ const (
 	STORAGE_INDEX_MERGE_SNAPSHOT
 	STORAGE_INDEX_PRUNE_SNAPSHOT
 	STORAGE_UPDATE_SNAP_MAP
+	STORAGE_INDEX_LIST_SNAPSHOTS
+	STORAGE_INDEX_EXPORT_SNAPSHOT
+	STORAGE_INDEX_IMPORT_SNAPSHOT
+	STORAGE_INDEX_DISK_USAGE
 
 	//KVSender
 	KV_SENDER_SHUTDOWN
@@ -142,6 +146,9 @@ const (
 	INDEXER_SECURITY_CHANGE
 	INDEXER_RESET_INDEX_DONE
 	INDEXER_ACTIVE
+	INDEXER_PAUSE_BUILD
+	INDEXER_RESUME_BUILD
+	INDEXER_QUARANTINE_INDEX
 
 	//SCAN COORDINATOR
 	SCAN_COORD_SHUTDOWN
@@ -1776,6 +1783,87 @@ func (m *MsgIndexStorageStats) GetStatsSpec() *statsSpec {
 	return m.spec
 }
 
+//STORAGE_INDEX_LIST_SNAPSHOTS
+//instId of 0 lists the snapshots of all index instances.
+type MsgIndexListSnapshots struct {
+	respch chan []PartitionSnapshotList
+	instId common.IndexInstId
+}
+
+func (m *MsgIndexListSnapshots) GetMsgType() MsgType {
+	return STORAGE_INDEX_LIST_SNAPSHOTS
+}
+
+func (m *MsgIndexListSnapshots) GetReplyChannel() chan []PartitionSnapshotList {
+	return m.respch
+}
+
+func (m *MsgIndexListSnapshots) GetInstId() common.IndexInstId {
+	return m.instId
+}
+
+//STORAGE_INDEX_DISK_USAGE
+//instId of 0 reports the disk usage of all index instances.
+type MsgIndexDiskUsage struct {
+	respch chan *NodeDiskUsage
+	instId common.IndexInstId
+}
+
+func (m *MsgIndexDiskUsage) GetMsgType() MsgType {
+	return STORAGE_INDEX_DISK_USAGE
+}
+
+func (m *MsgIndexDiskUsage) GetReplyChannel() chan *NodeDiskUsage {
+	return m.respch
+}
+
+func (m *MsgIndexDiskUsage) GetInstId() common.IndexInstId {
+	return m.instId
+}
+
+//STORAGE_INDEX_EXPORT_SNAPSHOT
+//STORAGE_INDEX_IMPORT_SNAPSHOT
+type MsgIndexSnapshotTransfer struct {
+	mType     MsgType
+	instId    common.IndexInstId
+	partnId   common.PartitionId
+	srcInstId common.IndexInstId // instance an imported snapshot is exported from
+	dir       string
+	load      bool // load an imported snapshot into the index now
+	respch    chan error
+}
+
+func (m *MsgIndexSnapshotTransfer) GetMsgType() MsgType {
+	return m.mType
+}
+
+func (m *MsgIndexSnapshotTransfer) GetInstId() common.IndexInstId {
+	return m.instId
+}
+
+func (m *MsgIndexSnapshotTransfer) GetPartitionId() common.PartitionId {
+	return m.partnId
+}
+
+func (m *MsgIndexSnapshotTransfer) GetSourceInstId() common.IndexInstId {
+	if m.srcInstId == 0 {
+		return m.instId
+	}
+	return m.srcInstId
+}
+
+func (m *MsgIndexSnapshotTransfer) GetDir() string {
+	return m.dir
+}
+
+func (m *MsgIndexSnapshotTransfer) GetLoad() bool {
+	return m.load
+}
+
+func (m *MsgIndexSnapshotTransfer) GetResponseChannel() chan error {
+	return m.respch
+}
+
 type MsgStatsRequest struct {
 	mType    MsgType
 	respch   chan bool
@@ -2110,6 +2198,64 @@ func (m *MsgCheckDDLInProgress) GetRespCh() MsgChannel {
 	return m.respCh
 }
 
+//INDEXER_PAUSE_BUILD
+//INDEXER_RESUME_BUILD
+type MsgBuildControl struct {
+	mType   MsgType
+	instIds []common.IndexInstId
+	respCh  MsgChannel
+}
+
+func (m *MsgBuildControl) GetMsgType() MsgType {
+	return m.mType
+}
+
+func (m *MsgBuildControl) GetInstIds() []common.IndexInstId {
+	return m.instIds
+}
+
+func (m *MsgBuildControl) GetRespCh() MsgChannel {
+	return m.respCh
+}
+
+func (m *MsgBuildControl) String() string {
+	str := "\n\tMessage: MsgBuildControl"
+	str += fmt.Sprintf("\n\tType: %v", m.mType)
+	str += fmt.Sprintf("\n\tInstIds: %v", m.instIds)
+	return str
+}
+
+//INDEXER_QUARANTINE_INDEX
+type MsgQuarantineIndex struct {
+	instId  common.IndexInstId
+	partnId common.PartitionId
+	reason  string
+}
+
+func (m *MsgQuarantineIndex) GetMsgType() MsgType {
+	return INDEXER_QUARANTINE_INDEX
+}
+
+func (m *MsgQuarantineIndex) GetInstId() common.IndexInstId {
+	return m.instId
+}
+
+func (m *MsgQuarantineIndex) GetPartitionId() common.PartitionId {
+	return m.partnId
+}
+
+func (m *MsgQuarantineIndex) GetReason() string {
+	return m.reason
+}
+
+func (m *MsgQuarantineIndex) String() string {
+	str := "\n\tMessage: MsgQuarantineIndex"
+	str += fmt.Sprintf("\n\tInstId: %v", m.instId)
+	str += fmt.Sprintf("\n\tPartitionId: %v", m.partnId)
+	str += fmt.Sprintf("\n\tReason: %v", m.reason)
+	return str
+}
+
 type MsgDDLInProgressResponse struct {
 	ddlInProgress        bool
 	inProgressIndexNames []string
@@ -2311,6 +2457,12 @@ func (m MsgType) String() string {
 		return "INDEXER_CANCEL_MERGE_PARTITION"
 	case INDEXER_STORAGE_WARMUP_DONE:
 		return "INDEXER_STORAGE_WARMUP_DONE"
+	case INDEXER_PAUSE_BUILD:
+		return "INDEXER_PAUSE_BUILD"
+	case INDEXER_RESUME_BUILD:
+		return "INDEXER_RESUME_BUILD"
+	case INDEXER_QUARANTINE_INDEX:
+		return "INDEXER_QUARANTINE_INDEX"
 
 	case SCAN_COORD_SHUTDOWN:
 		return "SCAN_COORD_SHUTDOWN"
@@ -2402,6 +2554,14 @@ func (m MsgType) String() string {
 		return "STORAGE_INDEX_PRUNE_SNAPSHOT"
 	case STORAGE_UPDATE_SNAP_MAP:
 		return "STORAGE_UPDATE_SNAP_MAP"
+	case STORAGE_INDEX_LIST_SNAPSHOTS:
+		return "STORAGE_INDEX_LIST_SNAPSHOTS"
+	case STORAGE_INDEX_EXPORT_SNAPSHOT:
+		return "STORAGE_INDEX_EXPORT_SNAPSHOT"
+	case STORAGE_INDEX_IMPORT_SNAPSHOT:
+		return "STORAGE_INDEX_IMPORT_SNAPSHOT"
+	case STORAGE_INDEX_DISK_USAGE:
+		return "STORAGE_INDEX_DISK_USAGE"
 
 	case CONFIG_SETTINGS_UPDATE:
 		return "CONFIG_SETTINGS_UPDATE"
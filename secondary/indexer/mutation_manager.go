@@ -1324,18 +1324,25 @@ func (m *mutationMgr) handleConfigUpdate(cmd Message) {
 //Calculate mutation queue length from memory quota
 func (m *mutationMgr) setMaxMemoryFromQuota() {
 
-	memQuota := m.config["settings.memory_quota"].Uint64()
-	fracQueueMem := getMutationQueueMemFrac(m.config)
+	maxMem := getMaxQueueMemory(m.config)
+
+	atomic.StoreInt64(&m.maxMemory, maxMem)
+	logging.Infof("MutationMgr::MaxQueueMemoryQuota %v", maxMem)
+
+}
+
+func getMaxQueueMemory(config common.Config) int64 {
+
+	memQuota := config["settings.memory_quota"].Uint64()
+	fracQueueMem := getMutationQueueMemFrac(config)
 
 	maxMem := int64(fracQueueMem * float64(memQuota))
-	maxMemHard := int64(m.config["mutation_manager.maxQueueMem"].Uint64())
+	maxMemHard := int64(config["mutation_manager.maxQueueMem"].Uint64())
 	if maxMem > maxMemHard {
 		maxMem = maxMemHard
 	}
 
-	atomic.StoreInt64(&m.maxMemory, maxMem)
-	logging.Infof("MutationMgr::MaxQueueMemoryQuota %v", maxMem)
-
+	return maxMem
 }
 
 func (m *mutationMgr) handleIndexerPause(cmd Message) {
@@ -1410,8 +1417,18 @@ func CopyKeyspaceIdQueueMap(inMap KeyspaceIdQueueMap) KeyspaceIdQueueMap {
 	return outMap
 }
 
+//Fraction of memory quota of the mutation queue, as adjusted by the
+//memory controller
 func getMutationQueueMemFrac(config common.Config) float64 {
 
+	if frac := loadFloat64(&gMutationQueueMemFrac); frac != 0 {
+		return frac
+	}
+	return configMutationQueueMemFrac(config)
+}
+
+func configMutationQueueMemFrac(config common.Config) float64 {
+
 	if common.GetStorageMode() == common.FORESTDB {
 		return config["mutation_manager.fdb.fracMutationQueueMem"].Float64()
 	} else {
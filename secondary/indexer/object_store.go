@@ -0,0 +1,452 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const objectStoreUnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// Limits of the multipart upload of S3
+const objectStoreMinPartSize = 5 * 1024 * 1024
+const objectStoreMaxPartSize = 5 * 1024 * 1024 * 1024
+const objectStoreMaxParts = 10000
+
+//
+// objectStore is a client of an S3-compatible object storage.  Requests
+// use path-style URLs (endpoint/bucket/key) and are signed with AWS
+// signature version 4.  Each request, i.e. each part of a multipart
+// upload, must complete within the timeout of the client.
+//
+type objectStore struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	partSize  int64
+	client    *http.Client
+}
+
+func newObjectStore(endpoint, bucket, region, accessKey, secretKey string,
+	partSize int64, timeout time.Duration) (*objectStore, error) {
+
+	if len(endpoint) == 0 || len(bucket) == 0 {
+		return nil, fmt.Errorf("Object storage endpoint and bucket are required")
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Invalid object storage endpoint %v", endpoint)
+	}
+
+	if len(accessKey) == 0 {
+		accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if len(secretKey) == 0 {
+		secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+
+	if partSize < objectStoreMinPartSize {
+		partSize = objectStoreMinPartSize
+	} else if partSize > objectStoreMaxPartSize {
+		partSize = objectStoreMaxPartSize
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &objectStore{
+		endpoint:  u,
+		bucket:    bucket,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		partSize:  partSize,
+		client:    &http.Client{Transport: transport, Timeout: timeout},
+	}, nil
+}
+
+//
+// Put uploads the file at path as object key.  Files larger than the part
+// size are uploaded in parts.
+//
+func (o *objectStore) Put(key string, path string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if fi.Size() > o.partSize {
+		return o.putMultipart(key, f, fi.Size())
+	}
+
+	resp, err := o.do("PUT", key, nil, f, fi.Size())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkObjectStoreResponse(resp, "PUT", key)
+}
+
+type objectStorePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type objectStoreCompleteUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []objectStorePart `xml:"Part"`
+}
+
+//
+// putMultipart uploads f in parts of partSize, or larger if the file has
+// more than the max number of parts.  The upload is aborted on error, so
+// that the object storage does not keep the parts.
+//
+func (o *objectStore) putMultipart(key string, f *os.File, size int64) error {
+
+	partSize := o.partSize
+	if n := (size + partSize - 1) / partSize; n > objectStoreMaxParts {
+		partSize = (size + objectStoreMaxParts - 1) / objectStoreMaxParts
+	}
+
+	uploadId, err := o.createMultipartUpload(key)
+	if err != nil {
+		return err
+	}
+
+	var parts []objectStorePart
+	for offset := int64(0); offset < size; offset += partSize {
+		n := partSize
+		if offset+n > size {
+			n = size - offset
+		}
+
+		part := objectStorePart{PartNumber: len(parts) + 1}
+		query := url.Values{"partNumber": {fmt.Sprintf("%v", part.PartNumber)}, "uploadId": {uploadId}}
+
+		resp, err := o.do("PUT", key, query, io.NewSectionReader(f, offset, n), n)
+		if err == nil {
+			err = checkObjectStoreResponse(resp, "PUT", key)
+			part.ETag = resp.Header.Get("ETag")
+			resp.Body.Close()
+		}
+		if err != nil {
+			o.abortMultipartUpload(key, uploadId)
+			return err
+		}
+
+		parts = append(parts, part)
+	}
+
+	body, err := xml.Marshal(&objectStoreCompleteUpload{Parts: parts})
+	if err == nil {
+		var resp *http.Response
+		resp, err = o.do("POST", key, url.Values{"uploadId": {uploadId}}, bytes.NewReader(body), int64(len(body)))
+		if err == nil {
+			err = checkObjectStoreResponse(resp, "POST", key)
+			if err == nil {
+				// the upload can fail after the response status is sent
+				err = checkObjectStoreError(resp, "POST", key)
+			}
+			resp.Body.Close()
+		}
+	}
+	if err != nil {
+		o.abortMultipartUpload(key, uploadId)
+	}
+	return err
+}
+
+func (o *objectStore) createMultipartUpload(key string) (string, error) {
+
+	resp, err := o.do("POST", key, url.Values{"uploads": {""}}, nil, 0)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkObjectStoreResponse(resp, "POST", key); err != nil {
+		return "", err
+	}
+
+	var result struct {
+		UploadId string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if len(result.UploadId) == 0 {
+		return "", fmt.Errorf("Object storage POST %v failed.  Missing upload id", key)
+	}
+	return result.UploadId, nil
+}
+
+func (o *objectStore) abortMultipartUpload(key string, uploadId string) {
+
+	resp, err := o.do("DELETE", key, url.Values{"uploadId": {uploadId}}, nil, 0)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+//
+// Get downloads object key to the file at path.
+//
+func (o *objectStore) Get(key string, path string) error {
+
+	resp, err := o.do("GET", key, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkObjectStoreResponse(resp, "GET", key); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+//
+// Delete removes object key.  Removing an object which does not exist
+// is not an error.
+//
+func (o *objectStore) Delete(key string) error {
+
+	resp, err := o.do("DELETE", key, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return checkObjectStoreResponse(resp, "DELETE", key)
+}
+
+func (o *objectStore) do(method string, key string, query url.Values, body io.Reader,
+	size int64) (*http.Response, error) {
+
+	u := *o.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + o.bucket + "/" + strings.TrimPrefix(key, "/")
+	u.RawPath = ""
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	o.sign(req, time.Now().UTC(), objectStoreUnsignedPayload)
+	return o.client.Do(req)
+}
+
+//
+// sign adds the AWS signature version 4 of req, with the hash of the
+// payload.  The payload is usually not signed (UNSIGNED-PAYLOAD), so that
+// files can be streamed.  The host and the headers which are set (range,
+// content-type, content-md5 and x-amz-*) are signed.
+//
+func (o *objectStore) sign(req *http.Request, now time.Time, payloadHash string) {
+
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	if len(o.accessKey) == 0 {
+		return
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" ||
+			name == "content-type" || name == "content-md5" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		objectStoreEscapePath(req.URL.Path),
+		objectStoreCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + o.region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := objectStoreHmac([]byte("AWS4"+o.secretKey), date)
+	key = objectStoreHmac(key, o.region)
+	key = objectStoreHmac(key, "s3")
+	key = objectStoreHmac(key, "aws4_request")
+	signature := hex.EncodeToString(objectStoreHmac(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		o.accessKey, scope, signedHeaders, signature))
+}
+
+func objectStoreHmac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+//
+// objectStoreEscapePath encodes each segment of path for the canonical
+// request of the signature.
+//
+func objectStoreEscapePath(path string) string {
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = objectStoreEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+//
+// objectStoreCanonicalQuery encodes the query parameters sorted by name,
+// with an empty value for parameters without value.
+//
+func objectStoreCanonicalQuery(query url.Values) string {
+
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, objectStoreEscape(name)+"="+objectStoreEscape(value))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+//
+// objectStoreEscape encodes all the characters of s except the unreserved
+// characters of RFC 3986, as required by the signature.
+//
+func objectStoreEscape(s string) string {
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func checkObjectStoreResponse(resp *http.Response, method string, key string) error {
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("Object storage %v %v failed.  Status %v %v", method, key, resp.Status, string(msg))
+}
+
+//
+// checkObjectStoreError returns the error in the body of a response with a
+// successful status, as sent by CompleteMultipartUpload.
+//
+func checkObjectStoreError(resp *http.Response, method string, key string) error {
+
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(body, &result); err == nil && result.XMLName.Local == "Error" {
+		return fmt.Errorf("Object storage %v %v failed.  Error %v %v", method, key, result.Code, result.Message)
+	}
+	return nil
+}
@@ -87,10 +87,14 @@ type plasmaSlice struct {
 
 	numWriters    int
 	maxNumWriters int
+	resizeWriters bool  // numSliceWriters changed, resize at next flush
+	buildDone     int32 // initial build done, writers not limited
 	maxRollbacks  int
 	maxDiskSnaps  int
 	numVbuckets   int
 
+	maxSnapshotAge time.Duration
+
 	totalFlushTime  time.Duration
 	totalCommitTime time.Duration
 
@@ -98,10 +102,17 @@ type plasmaSlice struct {
 	sysconf  common.Config
 	confLock sync.RWMutex
 
+	// set when the index instance is over its memory quota
+	residentLimited bool
+
 	isPersistorActive int32
 
 	lastRollbackTs *common.TsVbuuid
 
+	// bloom filter of the leading keys (IndexDefn.BloomFilter)
+	bloom     *bloomFilter
+	bloomLock sync.RWMutex
+
 	// Array processing
 	arrayExprPosition int
 	isArrayDistinct   bool
@@ -196,8 +207,8 @@ func newPlasmaSlice(storage_dir string, log_dir string, path string, sliceId Sli
 	slice.clusterAddr = sysconf["clusterAddr"].String()
 	slice.numVbuckets = sysconf["numVbuckets"].Int()
 
-	slice.maxRollbacks = sysconf["settings.plasma.recovery.max_rollbacks"].Int()
-	slice.maxDiskSnaps = sysconf["recovery.max_disksnaps"].Int()
+	slice.maxRollbacks, slice.maxDiskSnaps, slice.maxSnapshotAge =
+		getSnapshotRetention(sysconf, "settings.plasma.recovery.max_rollbacks")
 
 	updatePlasmaConfig(sysconf)
 	if sysconf["plasma.UseQuotaTuner"].Bool() {
@@ -242,6 +253,8 @@ func newPlasmaSlice(storage_dir string, log_dir string, path string, sliceId Sli
 	// intiialize and start the writers
 	slice.setupWriters()
 
+	slice.resetBloomFilter(!slice.newBorn)
+
 	logging.Infof("plasmaSlice:NewplasmaSlice Created New Slice Id %v IndexInstId %v partitionId %v "+
 		"WriterThreads %v cleaner %v", sliceId, idxInstId, partitionId, slice.numWriters, slice.mainstore.LSSCleanerConcurrency)
 
@@ -282,13 +295,32 @@ func backupCorruptedPlasmaSlice(storageDir string, prefix string, rename func(st
 	return plasma.BackupCorruptedInstance(storageDir, prefix, rename, clean)
 }
 
+//
+// compressionConfig returns whether the pages of the slice are compressed
+// and the codec.  The compression of the index overrides
+// plasma.useCompression and plasma.compression.
+//
+func (slice *plasmaSlice) compressionConfig() (bool, string) {
+
+	useCompression := slice.sysconf["plasma.useCompression"].Bool()
+	codec := slice.sysconf["plasma.compression"].String()
+
+	if compression := slice.idxDefn.Compression; len(compression) != 0 {
+		useCompression = compression != common.CompressionNone
+		if useCompression {
+			codec = compression
+		}
+	}
+	return useCompression, codec
+}
+
 func (slice *plasmaSlice) initStores() error {
 	var err error
 	cfg := plasma.DefaultConfig()
 	cfg.UseMemoryMgmt = slice.sysconf["plasma.useMemMgmt"].Bool()
 	cfg.FlushBufferSize = int(slice.sysconf["plasma.flushBufferSize"].Int())
 	cfg.LSSLogSegmentSize = int64(slice.sysconf["plasma.LSSSegmentFileSize"].Int())
-	cfg.UseCompression = slice.sysconf["plasma.useCompression"].Bool()
+	cfg.UseCompression, cfg.Compression = slice.compressionConfig()
 	cfg.AutoSwapper = true
 	cfg.NumEvictorThreads = int(float32(runtime.GOMAXPROCS(0))*
 		float32(slice.sysconf["plasma.evictionCPUPercent"].Int())/(100) + 0.5)
@@ -304,7 +336,6 @@ func (slice *plasmaSlice) initStores() error {
 	cfg.CheckpointInterval = time.Second * time.Duration(slice.sysconf["plasma.checkpointInterval"].Int())
 	cfg.LSSCleanerConcurrency = slice.sysconf["plasma.LSSCleanerConcurrency"].Int()
 	cfg.AutoTuneLSSCleaning = slice.sysconf["plasma.AutoTuneLSSCleaner"].Bool()
-	cfg.Compression = slice.sysconf["plasma.compression"].String()
 	cfg.MaxPageSize = slice.sysconf["plasma.MaxPageSize"].Int()
 	cfg.AutoLSSCleaning = !slice.sysconf["settings.compaction.plasma.manual"].Bool()
 	cfg.EnforceKeyRange = slice.sysconf["plasma.enforceKeyRange"].Bool()
@@ -330,10 +361,18 @@ func (slice *plasmaSlice) initStores() error {
 
 	var mode plasma.IOMode
 
-	if slice.sysconf["plasma.useMmapReads"].Bool() {
+	switch getIOMode(slice.sysconf, common.PlasmaDB) {
+	case IOModeMmap:
 		mode = plasma.MMapIO
-	} else if slice.sysconf["plasma.useDirectIO"].Bool() {
+	case IOModeDirect:
 		mode = plasma.DirectIO
+	case IOModeBuffered:
+	default:
+		if slice.sysconf["plasma.useMmapReads"].Bool() {
+			mode = plasma.MMapIO
+		} else if slice.sysconf["plasma.useDirectIO"].Bool() {
+			mode = plasma.DirectIO
+		}
 	}
 
 	cfg.IOMode = mode
@@ -784,6 +823,7 @@ func (mdb *plasmaSlice) insertSecIndex(key []byte, docid []byte, workerId int, i
 		defer mdb.back[workerId].End()
 
 		mdb.main[workerId].InsertKV(entry, nil)
+		mdb.bloomFilterAdd(entry)
 		// entry2BackEntry overwrites the buffer to remove docid
 		backEntry := entry2BackEntry(entry)
 		mdb.back[workerId].InsertKV(docid, backEntry)
@@ -914,6 +954,7 @@ func (mdb *plasmaSlice) insertSecArrayIndex(key []byte, docid []byte, workerId i
 				common.CrashOnError(err)
 				// Add back
 				mdb.main[workerId].InsertKV(entry, nil)
+				mdb.bloomFilterAdd(entry)
 				mdb.idxStats.rawDataSize.Add(int64(len(entry)))
 				addKeySizeStat(mdb.idxStats, len(entry))
 			}
@@ -983,6 +1024,7 @@ func (mdb *plasmaSlice) insertSecArrayIndex(key []byte, docid []byte, workerId i
 
 			t0 := time.Now()
 			mdb.main[workerId].InsertKV(keyToBeAdded, nil)
+			mdb.bloomFilterAdd(keyToBeAdded)
 			mdb.idxStats.Timings.stKVSet.Put(time.Now().Sub(t0))
 
 			mdb.idxStats.rawDataSize.Add(int64(len(keyToBeAdded)))
@@ -1540,6 +1582,231 @@ func (mdb *plasmaSlice) cleanupOldRecoveryPoints() {
 			}
 		}
 	}
+
+	mdb.cleanupExpiredRecoveryPoints()
+}
+
+//
+// cleanupExpiredRecoveryPoints removes the recovery points older than
+// snapshot_retention.max_age, except the latest one.  The creation time
+// of a recovery point is the header of its meta.
+//
+func (mdb *plasmaSlice) cleanupExpiredRecoveryPoints() {
+
+	maxAge := mdb.maxSnapshotAge
+	if maxAge <= 0 {
+		return
+	}
+
+	cleanup := func(store *plasma.Plasma, name string) {
+		// recovery points are sorted from the oldest
+		rps := store.GetRecoveryPoints()
+		for i := 0; i < len(rps)-1; i++ {
+			meta := rps[i].Meta()
+			if len(meta) < 8 {
+				continue
+			}
+
+			created := time.Unix(0, int64(binary.BigEndian.Uint64(meta[:8])))
+			if time.Since(created) <= maxAge {
+				break
+			}
+
+			logging.Infof("PlasmaSlice Slice Id %v, IndexInstId %v, PartitionId %v "+
+				"Cleanup %v recovery point created at %v older than %v.", mdb.id, mdb.idxInstId,
+				mdb.idxPartnId, name, created, maxAge)
+			store.RemoveRecoveryPoint(rps[i])
+		}
+	}
+
+	cleanup(mdb.mainstore, "mainstore")
+	if !mdb.isPrimary {
+		cleanup(mdb.backstore, "backstore")
+	}
+}
+
+//
+// EnforceSnapshotRetention is skipped while a recovery point is created,
+// as the persistor removes the old recovery points once done.
+//
+func (mdb *plasmaSlice) EnforceSnapshotRetention() {
+
+	if !atomic.CompareAndSwapInt32(&mdb.isPersistorActive, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&mdb.isPersistorActive, 0)
+
+	if len(mdb.mainstore.GetRecoveryPoints()) > mdb.maxRollbacks ||
+		(!mdb.isPrimary && len(mdb.backstore.GetRecoveryPoints()) > mdb.maxRollbacks) {
+		mdb.cleanupOldRecoveryPoints()
+	} else {
+		mdb.cleanupExpiredRecoveryPoints()
+	}
+}
+
+//
+// resetBloomFilter replaces the bloom filter of the slice with an empty
+// filter.  If load is true, the keys of the slice are added to the filter
+// in the background, and the filter is not used until they are all added.
+// The filter is reset after a rollback, as the keys restored by the
+// rollback may have been removed from the filter.
+//
+func (mdb *plasmaSlice) resetBloomFilter(load bool) {
+
+	if !mdb.idxDefn.BloomFilter || mdb.isPrimary || (len(mdb.idxDefn.Desc) != 0 && mdb.idxDefn.Desc[0]) {
+		return
+	}
+
+	capacity := mdb.sysconf["bloom_filter.initial_capacity"].Uint64()
+	if count := uint64(mdb.mainstore.ItemsCount()); load && count > capacity {
+		capacity = count
+	}
+	filter, err := newBloomFilter(capacity, mdb.sysconf["bloom_filter.fp_rate"].Float64())
+
+	mdb.bloomLock.Lock()
+	if mdb.bloom != nil {
+		mdb.bloom.Free()
+	}
+	mdb.bloom = filter
+	mdb.bloomLock.Unlock()
+
+	if err != nil {
+		logging.Errorf("PlasmaSlice Slice Id %v, IndexInstId %v, PartitionId %v "+
+			"Disable bloom filter.  Error = %v", mdb.id, mdb.idxInstId, mdb.idxPartnId, err)
+		return
+	}
+
+	if !load {
+		filter.SetReady()
+		return
+	}
+
+	mdb.IncrRef()
+	go mdb.loadBloomFilter(filter)
+}
+
+func (mdb *plasmaSlice) getBloomFilter() *bloomFilter {
+
+	mdb.bloomLock.RLock()
+	defer mdb.bloomLock.RUnlock()
+
+	return mdb.bloom
+}
+
+//
+// disableBloomFilter removes filter from the slice, when a key cannot be
+// added to it.
+//
+func (mdb *plasmaSlice) disableBloomFilter(filter *bloomFilter, err error) {
+
+	mdb.bloomLock.Lock()
+	defer mdb.bloomLock.Unlock()
+
+	if mdb.bloom == filter {
+		logging.Errorf("PlasmaSlice Slice Id %v, IndexInstId %v, PartitionId %v "+
+			"Disable bloom filter.  Error = %v", mdb.id, mdb.idxInstId, mdb.idxPartnId, err)
+		mdb.bloom = nil
+	}
+	filter.Free()
+}
+
+func (mdb *plasmaSlice) loadBloomFilter(filter *bloomFilter) {
+
+	defer mdb.DecrRef()
+
+	t0 := time.Now()
+
+	snap := mdb.mainstore.NewSnapshot()
+	defer snap.Close()
+
+	it, err := mdb.mainstore.NewReader().NewSnapshotIterator(snap)
+	if err != nil {
+		mdb.disableBloomFilter(filter, err)
+		return
+	}
+	defer it.Close()
+
+	var count int64
+	for it.SeekFirst(); it.Valid(); it.Next() {
+		if filter.IsStopped() {
+			mdb.disableBloomFilter(filter, errBloomFilterMemory)
+			return
+		}
+
+		if !mdb.addToBloomFilter(filter, it.Key()) {
+			return
+		}
+		count++
+	}
+
+	filter.SetReady()
+
+	logging.Infof("PlasmaSlice Slice Id %v, IndexInstId %v, PartitionId %v "+
+		"Loaded bloom filter with %v keys (took %v)", mdb.id, mdb.idxInstId, mdb.idxPartnId,
+		count, time.Since(t0))
+}
+
+func (mdb *plasmaSlice) bloomFilterAdd(entry []byte) {
+
+	if filter := mdb.getBloomFilter(); filter != nil {
+		if filter.IsStopped() {
+			mdb.disableBloomFilter(filter, errBloomFilterMemory)
+			return
+		}
+		mdb.addToBloomFilter(filter, entry)
+	}
+}
+
+func (mdb *plasmaSlice) addToBloomFilter(filter *bloomFilter, entry []byte) bool {
+
+	e := secondaryIndexEntry(entry)
+	key := entry[:e.lenKey()]
+
+	b := bloomFilterKeyPool.Get().(*bloomFilterKeyBuf)
+	defer bloomFilterKeyPool.Put(b)
+
+	leadingKey, err := bloomFilterKey(key, b)
+	if err != nil {
+		mdb.disableBloomFilter(filter, err)
+		return false
+	}
+
+	filter.Add(leadingKey)
+	return true
+}
+
+//
+// bloomFilterSkip checks the bloom filter of the slice for an equality
+// lookup (low equal to high).  It returns true if the leading key of the
+// lookup is not in the filter, and whether the filter has been checked.
+//
+func (mdb *plasmaSlice) bloomFilterSkip(low, high IndexKey) (bool, bool) {
+
+	filter := mdb.getBloomFilter()
+	if filter == nil || !filter.IsReady() {
+		return false, false
+	}
+
+	key := low.Bytes()
+	if len(key) == 0 || !bytes.Equal(key, high.Bytes()) {
+		return false, false
+	}
+
+	b := bloomFilterKeyPool.Get().(*bloomFilterKeyBuf)
+	defer bloomFilterKeyPool.Put(b)
+
+	leadingKey, err := bloomFilterKey(key, b)
+	if err != nil {
+		return false, false
+	}
+
+	if filter.MayContain(leadingKey) {
+		mdb.idxStats.bloomFilterHits.Add(1)
+		return false, true
+	}
+
+	mdb.idxStats.bloomFilterMisses.Add(1)
+	return true, true
 }
 
 func (mdb *plasmaSlice) GetSnapshots() ([]SnapshotInfo, error) {
@@ -1714,6 +1981,7 @@ func (mdb *plasmaSlice) Rollback(o SnapshotInfo) error {
 	}
 
 	err := mdb.restore(o)
+	mdb.resetBloomFilter(true)
 	for i := 0; i < cap(mdb.readers); i++ {
 		mdb.readers <- readers[i]
 	}
@@ -1808,6 +2076,7 @@ func (mdb *plasmaSlice) RollbackToZero() error {
 	if err := mdb.resetStores(); err != nil {
 		return err
 	}
+	mdb.resetBloomFilter(false)
 
 	mdb.lastRollbackTs = nil
 
@@ -1872,7 +2141,7 @@ func (mdb *plasmaSlice) NewSnapshot(ts *common.TsVbuuid, commit bool) (SnapshotI
 
 func (mdb *plasmaSlice) FlushDone() {
 
-	if !mdb.enableWriterTuning {
+	if !mdb.enableWriterTuning && !mdb.needResizeWriters() {
 		return
 	}
 
@@ -1917,6 +2186,10 @@ func (mdb *plasmaSlice) Close() {
 	//signal shutdown for command handler routines
 	mdb.cleanupWritersOnClose()
 
+	if filter := mdb.getBloomFilter(); filter != nil {
+		filter.Free()
+	}
+
 	if mdb.refCount > 0 {
 		mdb.isSoftClosed = true
 	} else {
@@ -2093,6 +2366,12 @@ func (mdb *plasmaSlice) Statistics(consumerFilter uint64) (StorageStatistics, er
 	var msCompressionRatio, bsCompressionRatio float64
 	pStats := mdb.mainstore.GetPreparedStats()
 
+	if filter := mdb.getBloomFilter(); filter != nil {
+		mdb.idxStats.bloomFilterSize.Set(filter.Size())
+	} else {
+		mdb.idxStats.bloomFilterSize.Set(0)
+	}
+
 	docidCount = pStats.ItemsCount
 	numRecsMem += pStats.NumRecordAllocs - pStats.NumRecordFrees
 	numRecsDisk += pStats.NumRecordSwapOut - pStats.NumRecordSwapIn
@@ -2203,6 +2482,35 @@ func updatePlasmaConfig(cfg common.Config) {
 	plasma.MTunerMinQuota = int64(cfg["plasma.memtuner.minQuota"].Int())
 }
 
+//
+// SetResidentLimited stops caching of index pages read from disk and
+// enables periodic eviction, so that memory used by the index shrinks
+// back under its memory quota.
+//
+func (mdb *plasmaSlice) SetResidentLimited(limited bool) {
+	mdb.confLock.Lock()
+	defer mdb.confLock.Unlock()
+
+	if mdb.residentLimited == limited {
+		return
+	}
+
+	logging.Infof("plasmaSlice:SetResidentLimited SliceId %v IndexInstId %v PartitionId %v limited %v",
+		mdb.id, mdb.idxInstId, mdb.idxPartnId, limited)
+
+	mdb.residentLimited = limited
+
+	mdb.mainstore.DisableReadCaching = mdb.sysconf["plasma.disableReadCaching"].Bool() || limited
+	mdb.mainstore.EnablePeriodicEvict = mdb.sysconf["plasma.mainIndex.enablePeriodicEvict"].Bool() || limited
+	mdb.mainstore.UpdateConfig()
+
+	if !mdb.isPrimary {
+		mdb.backstore.DisableReadCaching = mdb.sysconf["plasma.disableReadCaching"].Bool() || limited
+		mdb.backstore.EnablePeriodicEvict = mdb.sysconf["plasma.backIndex.enablePeriodicEvict"].Bool() || limited
+		mdb.backstore.UpdateConfig()
+	}
+}
+
 func (mdb *plasmaSlice) UpdateConfig(cfg common.Config) {
 	mdb.confLock.Lock()
 	defer mdb.confLock.Unlock()
@@ -2210,6 +2518,17 @@ func (mdb *plasmaSlice) UpdateConfig(cfg common.Config) {
 	oldCfg := mdb.sysconf
 	mdb.sysconf = cfg
 
+	mdb.writerLock.Lock()
+	mdb.snapInterval = cfg["settings.inmemory_snapshot.moi.interval"].Uint64() * uint64(time.Millisecond)
+	if numWriters := cfg["numSliceWriters"].Int(); numWriters > 0 && numWriters != mdb.maxNumWriters {
+		logging.Infof("plasmaSlice %v:%v change max writers from %v to %v",
+			mdb.idxInstId, mdb.idxPartnId, mdb.maxNumWriters, numWriters)
+		mdb.maxNumWriters = numWriters
+		mdb.resizeWriters = true
+		resizeFreeWriters(mdb.idxInstId, numWriters)
+	}
+	mdb.writerLock.Unlock()
+
 	updatePlasmaConfig(cfg)
 	mdb.mainstore.AutoTuneLSSCleaning = cfg["plasma.AutoTuneLSSCleaner"].Bool()
 	mdb.mainstore.MaxPageSize = cfg["plasma.MaxPageSize"].Int()
@@ -2219,8 +2538,8 @@ func (mdb *plasmaSlice) UpdateConfig(cfg common.Config) {
 	mdb.mainstore.MaxPageLSSSegments = mdb.sysconf["plasma.mainIndex.maxLSSPageSegments"].Int()
 	mdb.mainstore.LSSCleanerThreshold = mdb.sysconf["plasma.mainIndex.LSSFragmentation"].Int()
 	mdb.mainstore.LSSCleanerMaxThreshold = mdb.sysconf["plasma.mainIndex.maxLSSFragmentation"].Int()
-	mdb.mainstore.DisableReadCaching = mdb.sysconf["plasma.disableReadCaching"].Bool()
-	mdb.mainstore.EnablePeriodicEvict = mdb.sysconf["plasma.mainIndex.enablePeriodicEvict"].Bool()
+	mdb.mainstore.DisableReadCaching = mdb.sysconf["plasma.disableReadCaching"].Bool() || mdb.residentLimited
+	mdb.mainstore.EnablePeriodicEvict = mdb.sysconf["plasma.mainIndex.enablePeriodicEvict"].Bool() || mdb.residentLimited
 	mdb.mainstore.EvictMinThreshold = mdb.sysconf["plasma.mainIndex.evictMinThreshold"].Float64()
 	mdb.mainstore.EvictMaxThreshold = mdb.sysconf["plasma.mainIndex.evictMaxThreshold"].Float64()
 	mdb.mainstore.EvictDirtyOnPersistRatio = mdb.sysconf["plasma.mainIndex.evictDirtyOnPersistRatio"].Float64()
@@ -2262,8 +2581,8 @@ func (mdb *plasmaSlice) UpdateConfig(cfg common.Config) {
 		mdb.backstore.MaxPageLSSSegments = mdb.sysconf["plasma.backIndex.maxLSSPageSegments"].Int()
 		mdb.backstore.LSSCleanerThreshold = mdb.sysconf["plasma.backIndex.LSSFragmentation"].Int()
 		mdb.backstore.LSSCleanerMaxThreshold = mdb.sysconf["plasma.backIndex.maxLSSFragmentation"].Int()
-		mdb.backstore.DisableReadCaching = mdb.sysconf["plasma.disableReadCaching"].Bool()
-		mdb.backstore.EnablePeriodicEvict = mdb.sysconf["plasma.backIndex.enablePeriodicEvict"].Bool()
+		mdb.backstore.DisableReadCaching = mdb.sysconf["plasma.disableReadCaching"].Bool() || mdb.residentLimited
+		mdb.backstore.EnablePeriodicEvict = mdb.sysconf["plasma.backIndex.enablePeriodicEvict"].Bool() || mdb.residentLimited
 		mdb.backstore.EvictMinThreshold = mdb.sysconf["plasma.backIndex.evictMinThreshold"].Float64()
 		mdb.backstore.EvictMaxThreshold = mdb.sysconf["plasma.backIndex.evictMaxThreshold"].Float64()
 		mdb.backstore.EvictDirtyOnPersistRatio = mdb.sysconf["plasma.backIndex.evictDirtyOnPersistRatio"].Float64()
@@ -2297,8 +2616,8 @@ func (mdb *plasmaSlice) UpdateConfig(cfg common.Config) {
 
 		mdb.backstore.UpdateConfig()
 	}
-	mdb.maxRollbacks = cfg["settings.plasma.recovery.max_rollbacks"].Int()
-	mdb.maxDiskSnaps = cfg["recovery.max_disksnaps"].Int()
+	mdb.maxRollbacks, mdb.maxDiskSnaps, mdb.maxSnapshotAge =
+		getSnapshotRetention(cfg, "settings.plasma.recovery.max_rollbacks")
 
 	if keySizeConfigUpdated(cfg, oldCfg) {
 		for i := 0; i < len(mdb.keySzConfChanged); i++ {
@@ -2640,6 +2959,27 @@ func (s *plasmaSnapshot) Iterate(ctx IndexReaderContext, low, high IndexKey, inc
 	var err error
 	t0 := time.Now()
 
+	if !s.isPrimary() && inclusion == Both {
+		skip, checked := s.slice.bloomFilterSkip(low, high)
+		if skip {
+			return nil
+		}
+
+		if checked {
+			found := false
+			cb := callback
+			callback = func(entry []byte) error {
+				found = true
+				return cb(entry)
+			}
+			defer func() {
+				if !found && err == nil {
+					s.slice.idxStats.bloomFilterFalsePositives.Add(1)
+				}
+			}()
+		}
+	}
+
 	reader := ctx.(*plasmaReaderCtx)
 
 	it, err := reader.r.NewSnapshotIterator(s.MainSnap)
@@ -2789,6 +3129,21 @@ func (slice *plasmaSlice) numWritersPerPartition() int {
 	return int(math.Ceil(float64(slice.maxNumWriters) / float64(slice.numPartitions)))
 }
 
+//
+// Number of writers to start the slice with.  It is build_writer_threads
+// of the index if specified, for the initial build.  Writer tuning can
+// adjust it afterwards, or it is reset when the initial build is done.
+//
+func (slice *plasmaSlice) numInitialWriters() int {
+	if numWriters := slice.idxDefn.BuildWriterThreads; numWriters > 0 && atomic.LoadInt32(&slice.buildDone) == 0 {
+		if numWriters > slice.maxNumWriters {
+			numWriters = slice.maxNumWriters
+		}
+		return numWriters
+	}
+	return slice.numWritersPerPartition()
+}
+
 //
 // Get command handler queue size
 //
@@ -2829,7 +3184,7 @@ func (slice *plasmaSlice) setupWriters() {
 	slice.token = registerFreeWriters(slice.idxInstId, slice.maxNumWriters)
 
 	// start writers
-	numWriter := slice.numWritersPerPartition()
+	numWriter := slice.numInitialWriters()
 	slice.token.decrement(numWriter, true)
 	slice.startWriters(numWriter)
 	// start stats sampler
@@ -3145,6 +3500,12 @@ func (slice *plasmaSlice) adjustWriters() {
 	slice.writerLock.Lock()
 	defer slice.writerLock.Unlock()
 
+	if slice.resizeWriters {
+		slice.resizeWriters = false
+		slice.resetNumWriters()
+		return
+	}
+
 	// Is it the time to adjust the number of writers?
 	if slice.shouldAdjustWriter() {
 		slice.meetMinimumDrainRate()
@@ -3160,6 +3521,59 @@ func (slice *plasmaSlice) adjustWriters() {
 	}
 }
 
+//
+// InitialBuildDone resets the writers of the slice at the next flush, if
+// they were limited to build_writer_threads and writer tuning does not
+// adjust them.
+//
+func (slice *plasmaSlice) InitialBuildDone() {
+
+	if slice.idxDefn.BuildWriterThreads <= 0 || !atomic.CompareAndSwapInt32(&slice.buildDone, 0, 1) {
+		return
+	}
+
+	slice.writerLock.Lock()
+	defer slice.writerLock.Unlock()
+
+	if !slice.enableWriterTuning && slice.numWriters != slice.numWritersPerPartition() {
+		logging.Infof("plasmaSlice %v:%v initial build done, reset writers from %v",
+			slice.idxInstId, slice.idxPartnId, slice.numWriters)
+		slice.resizeWriters = true
+	}
+}
+
+func (slice *plasmaSlice) needResizeWriters() bool {
+
+	slice.writerLock.Lock()
+	defer slice.writerLock.Unlock()
+
+	return slice.resizeWriters
+}
+
+//
+// Reset the number of writers to the default, after numSliceWriters is
+// changed.  There must be no pending mutation.
+//
+func (slice *plasmaSlice) resetNumWriters() {
+
+	lastNumWriters := slice.numWriters
+	numWriters := slice.numWritersPerPartition()
+
+	if numWriters > slice.numWriters {
+		slice.token.decrement(numWriters-slice.numWriters, true)
+		slice.startWriters(numWriters)
+	} else if numWriters < slice.numWriters {
+		slice.stopWriters(numWriters)
+		slice.token.increment(lastNumWriters - numWriters)
+	}
+
+	if lastNumWriters != slice.numWriters {
+		slice.minimumDrainRate = slice.computeMinimumDrainRate(lastNumWriters)
+		logging.Infof("plasmaSlice %v:%v reset writers from %v to %v token %v",
+			slice.idxInstId, slice.idxPartnId, lastNumWriters, slice.numWriters, slice.token.num())
+	}
+}
+
 //
 // Expand the writer when
 // 1) enableWriterTuning is enabled
@@ -3427,6 +3841,7 @@ func init() {
 
 type token struct {
 	value int64
+	max   int // total writers, protected by freeWriters.mutex
 }
 
 func (t *token) num() int64 {
@@ -3472,11 +3887,26 @@ func registerFreeWriters(instId common.IndexInstId, count int) *token {
 	defer freeWriters.mutex.Unlock()
 
 	if _, ok := freeWriters.tokens[instId]; !ok {
-		freeWriters.tokens[instId] = &token{value: int64(count)}
+		freeWriters.tokens[instId] = &token{value: int64(count), max: count}
 	}
 	return freeWriters.tokens[instId]
 }
 
+//
+// Change the total writers of an index instance.  The partitions of the
+// instance share the token, so it is changed once for all partitions.
+//
+func resizeFreeWriters(instId common.IndexInstId, count int) {
+
+	freeWriters.mutex.Lock()
+	defer freeWriters.mutex.Unlock()
+
+	if t, ok := freeWriters.tokens[instId]; ok && t.max != count {
+		t.increment(count - t.max)
+		t.max = count
+	}
+}
+
 func deleteFreeWriters(instId common.IndexInstId) {
 	freeWriters.mutex.Lock()
 	defer freeWriters.mutex.Unlock()
@@ -0,0 +1,81 @@
+// +build !community
+
+package indexer
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestPlasmaInitialWriters(t *testing.T) {
+
+	slice := &plasmaSlice{maxNumWriters: 8, numPartitions: 1}
+	if n := slice.numInitialWriters(); n != 8 {
+		t.Fatalf("expected 8 writers, got %v", n)
+	}
+
+	slice.idxDefn = common.IndexDefn{BuildWriterThreads: 2}
+	if n := slice.numInitialWriters(); n != 2 {
+		t.Fatalf("expected 2 writers, got %v", n)
+	}
+
+	slice.idxDefn.BuildWriterThreads = 16
+	if n := slice.numInitialWriters(); n != 8 {
+		t.Fatalf("expected 8 writers, got %v", n)
+	}
+
+	// the writers are reset at the next flush once the initial build is done
+	slice.idxDefn.BuildWriterThreads = 2
+	slice.numWriters = 2
+	slice.InitialBuildDone()
+	if !slice.needResizeWriters() {
+		t.Fatal("expected writers to be resized")
+	}
+	if n := slice.numInitialWriters(); n != 8 {
+		t.Fatalf("expected 8 writers, got %v", n)
+	}
+
+	// writer tuning adjusts the writers
+	slice = &plasmaSlice{maxNumWriters: 8, numPartitions: 1, numWriters: 2, enableWriterTuning: true}
+	slice.idxDefn = common.IndexDefn{BuildWriterThreads: 2}
+	slice.InitialBuildDone()
+	if slice.needResizeWriters() {
+		t.Fatal("unexpected resize with writer tuning")
+	}
+}
+
+func TestPlasmaCompressionConfig(t *testing.T) {
+
+	sysconf := common.Config{
+		"plasma.useCompression": common.ConfigValue{Value: true},
+		"plasma.compression":    common.ConfigValue{Value: common.CompressionSnappy},
+	}
+
+	tests := []struct {
+		compression    string
+		useCompression bool
+		codec          string
+	}{
+		{"", true, common.CompressionSnappy},
+		{common.CompressionZstd, true, common.CompressionZstd},
+		{common.CompressionSnappy, true, common.CompressionSnappy},
+		{common.CompressionNone, false, common.CompressionSnappy},
+	}
+
+	for _, test := range tests {
+		slice := &plasmaSlice{sysconf: sysconf, idxDefn: common.IndexDefn{Compression: test.compression}}
+		useCompression, codec := slice.compressionConfig()
+		if useCompression != test.useCompression || codec != test.codec {
+			t.Fatalf("compression %q: expected %v %v, got %v %v", test.compression,
+				test.useCompression, test.codec, useCompression, codec)
+		}
+	}
+
+	// the index compression is used even if compression is off for the node
+	sysconf["plasma.useCompression"] = common.ConfigValue{Value: false}
+	slice := &plasmaSlice{sysconf: sysconf, idxDefn: common.IndexDefn{Compression: common.CompressionZstd}}
+	if useCompression, codec := slice.compressionConfig(); !useCompression || codec != common.CompressionZstd {
+		t.Fatalf("expected zstd compression, got %v %v", useCompression, codec)
+	}
+}
@@ -53,8 +53,9 @@ type Queue struct {
 	deqch    chan bool
 	donech   chan bool
 
-	enqCount int64
-	deqCount int64
+	enqCount  int64
+	deqCount  int64
+	fullCount int64
 
 	mem *allocator
 }
@@ -136,6 +137,8 @@ func (b *Queue) Enqueue(key *Row) {
 			return
 		}
 
+		atomic.AddInt64(&b.fullCount, 1)
+
 		select {
 		case <-b.deqch:
 		case <-b.donech:
@@ -232,6 +235,12 @@ func (b *Queue) Free() {
 	}
 }
 
+// Number of times Enqueue finds the buffer full
+func (b *Queue) FullCount() int64 {
+
+	return atomic.LoadInt64(&b.fullCount)
+}
+
 func (b *Queue) GetBytesBuf() *common.BytesBufPool {
 	return b.mem.bufPool
 }
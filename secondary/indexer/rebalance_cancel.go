@@ -0,0 +1,356 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	l "github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/manager"
+)
+
+var ErrRebalanceCancelled = errors.New("Rebalance cancelled")
+
+const (
+	TokenCleanupRemove   = "remove"   // transfer token is deleted
+	TokenCleanupCommit   = "commit"   // source index is dropped to complete the movement
+	TokenCleanupRollback = "rollback" // destination index is dropped
+	TokenCleanupKeep     = "keep"     // transfer token is left for the other nodes
+
+	tokenCleanupReady = "ready" // merged partitions make the token ready
+)
+
+//
+// RebalanceCancel is persisted in metakv at RebalanceCancelPath when a
+// rebalance is cancelled with /cancelRebalance.  While it is there, the
+// transfer tokens of the rebalance are cleaned up by dropping the index
+// built on the destination node, even if it is ready, so that the indexes
+// stay on their source nodes.  It is removed once all the transfer tokens
+// are cleaned up.
+//
+type RebalanceCancel struct {
+	RebalId string `json:"rebalId"`
+}
+
+//
+// RebalanceCleanup is the result of the last cleanup of transfer tokens
+// on this node, reported by /rebalanceStatus.
+//
+type RebalanceCleanup struct {
+	Time      time.Time       `json:"time"`
+	Cancelled bool            `json:"cancelled"`
+	Tokens    []*TokenCleanup `json:"tokens"`
+}
+
+type TokenCleanup struct {
+	TransferTokenId string        `json:"transferTokenId"`
+	RebalanceId     string        `json:"rebalanceId"`
+	Bucket          string        `json:"bucket"`
+	Scope           string        `json:"scope"`
+	Collection      string        `json:"collection"`
+	Index           string        `json:"index"`
+	InstId          c.IndexInstId `json:"instId"`
+	SourceId        string        `json:"sourceId"`
+	DestId          string        `json:"destId"`
+	Role            string        `json:"role"`
+	State           string        `json:"state"`
+	Action          string        `json:"action"`
+	Error           string        `json:"error,omitempty"`
+}
+
+func newTokenCleanup(ttid string, tt *c.TransferToken, role string) *TokenCleanup {
+
+	return &TokenCleanup{
+		TransferTokenId: ttid,
+		RebalanceId:     tt.RebalId,
+		Bucket:          tt.IndexInst.Defn.Bucket,
+		Scope:           tt.IndexInst.Defn.Scope,
+		Collection:      tt.IndexInst.Defn.Collection,
+		Index:           tt.IndexInst.Defn.Name,
+		InstId:          tt.InstId,
+		SourceId:        tt.SourceId,
+		DestId:          tt.DestId,
+		Role:            role,
+		State:           tt.State.String(),
+	}
+}
+
+//
+// handleCancelRebalance cancels the running rebalance.  The request is
+// forwarded to the master of the rebalance if it is another node.  The
+// index movements which are not committed are rolled back, and the
+// transfer tokens are cleaned up on all the nodes.  It returns the result
+// of the cleanup on the master.  The cleanup on the other nodes is
+// reported by /rebalanceStatus on those nodes.
+//
+func (m *ServiceMgr) handleCancelRebalance(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := m.validateAuth(w, r)
+	if !ok {
+		l.Errorf("ServiceMgr::handleCancelRebalance Validation Failure for Request %v", l.TagUD(r))
+		return
+	}
+
+	if !c.IsAllowed(creds, []string{"cluster.settings!write"}, w) {
+		return
+	}
+
+	if r.Method != "POST" {
+		m.writeError(w, errors.New("Unsupported method"))
+		return
+	}
+
+	m.mu.Lock()
+
+	if m.rebalancer == nil || m.rebalanceCtx == nil {
+		rtoken := m.rebalanceToken
+		m.mu.Unlock()
+
+		if rtoken != nil && rtoken.MasterId != string(m.nodeInfo.NodeID) {
+			m.forwardCancelRebalance(w, rtoken.MasterId)
+			return
+		}
+		m.writeError(w, ErrRebalanceNotMaster)
+		return
+	}
+
+	change := m.rebalanceCtx.change
+	l.Infof("ServiceMgr::handleCancelRebalance Cancel Rebalance %v", change.ID)
+
+	cancel := &RebalanceCancel{RebalId: change.ID}
+	if m.rebalancer.rebalToken != nil {
+		cancel.RebalId = m.rebalancer.rebalToken.RebalId
+	}
+
+	if err := MetakvSet(RebalanceCancelPath, cancel); err != nil {
+		m.mu.Unlock()
+		l.Errorf("ServiceMgr::handleCancelRebalance Error %v", err)
+		m.writeError(w, err)
+		return
+	}
+
+	m.rebalancer.Cancel()
+	m.onRebalanceDoneLOCKED(ErrRebalanceCancelled)
+	cleanup := m.rebalanceCleanup
+
+	m.mu.Unlock()
+
+	go notifyRebalanceDone(&change, true)
+
+	out, err := json.Marshal(cleanup)
+	if err != nil {
+		l.Errorf("ServiceMgr::handleCancelRebalance Error %v", err)
+		m.writeError(w, err)
+		return
+	}
+	m.writeJson(w, out)
+}
+
+// forwardCancelRebalance sends /cancelRebalance to the rebalance master
+func (m *ServiceMgr) forwardCancelRebalance(w http.ResponseWriter, masterId string) {
+
+	l.Infof("ServiceMgr::forwardCancelRebalance Forward Cancel Rebalance to Master %v", masterId)
+
+	cfg := m.config.Load()
+	addr, err := resolvePeerIndexer(cfg["clusterAddr"].String(), masterId)
+	if err != nil {
+		l.Errorf("ServiceMgr::forwardCancelRebalance Error %v", err)
+		m.writeError(w, err)
+		return
+	}
+
+	resp, err := postWithAuth(addr+"/cancelRebalance", "application/json", nil)
+	if err != nil {
+		l.Errorf("ServiceMgr::forwardCancelRebalance Error %v", err)
+		m.writeError(w, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		l.Errorf("ServiceMgr::forwardCancelRebalance Error %v", err)
+		m.writeError(w, err)
+		return
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(body)
+}
+
+// getRebalanceCancel returns the rebalance cancelled by /cancelRebalance
+func getRebalanceCancel() *RebalanceCancel {
+
+	var cancel RebalanceCancel
+	found, err := MetakvGet(RebalanceCancelPath, &cancel)
+	if err != nil {
+		l.Errorf("ServiceMgr::getRebalanceCancel Error Fetching Rebalance Cancel From Metakv %v", err)
+		return nil
+	}
+
+	if !found {
+		return nil
+	}
+	return &cancel
+}
+
+func (m *ServiceMgr) cleanupRebalanceCancel() error {
+
+	cancel := getRebalanceCancel()
+	if cancel == nil {
+		return nil
+	}
+
+	l.Infof("ServiceMgr::cleanupRebalanceCancel Delete Rebalance Cancel for %v", cancel.RebalId)
+
+	err := MetakvDel(RebalanceCancelPath)
+	if err != nil {
+		l.Errorf("ServiceMgr::cleanupRebalanceCancel Unable to delete Rebalance Cancel from "+
+			"Meta Storage. Err %v", err)
+		return err
+	}
+	return nil
+}
+
+// masterTokenCleanup returns the cleanup of a transfer token on the master
+func masterTokenCleanup(tt *c.TransferToken) string {
+
+	switch tt.State {
+	case c.TransferTokenCommit, c.TransferTokenDeleted:
+		return TokenCleanupRemove
+	}
+	return TokenCleanupKeep
+}
+
+//
+// sourceTokenCleanup returns the cleanup of a transfer token on its source
+// node.  A ready index movement is completed by dropping the source index,
+// unless the rebalance is cancelled, in which case the destination decides
+// whether the movement is rolled back.
+//
+func sourceTokenCleanup(tt *c.TransferToken, rollback bool) string {
+
+	if tt.State == c.TransferTokenReady && !rollback {
+		return TokenCleanupCommit
+	}
+	return TokenCleanupKeep
+}
+
+//
+// destTokenCleanup returns the cleanup of a transfer token on its
+// destination node.  rebalState is the state of the index instance after
+// the merge of partitions is cancelled, and found is false if the instance
+// is gone.  A ready index movement of a cancelled rebalance is rolled back
+// only if sourceCopy confirms that the index is still on the source node.
+// Otherwise the source index is already dropped, and the movement is
+// committed.
+//
+func destTokenCleanup(tt *c.TransferToken, rebalState c.RebalanceState, found bool,
+	rollback bool, sourceCopy func() (bool, error)) (string, error) {
+
+	ready := func() (string, error) {
+		if !rollback {
+			return TokenCleanupKeep, nil
+		}
+
+		present, err := sourceCopy()
+		if err != nil {
+			return TokenCleanupKeep, err
+		}
+		if present {
+			return TokenCleanupRollback, nil
+		}
+		return TokenCleanupCommit, nil
+	}
+
+	switch tt.State {
+
+	case c.TransferTokenCreated, c.TransferTokenAccepted, c.TransferTokenRefused,
+		c.TransferTokenInitate, c.TransferTokenInProgress:
+		return TokenCleanupRollback, nil
+
+	case c.TransferTokenReady:
+		return ready()
+
+	case c.TransferTokenMerge:
+		if !found {
+			return TokenCleanupRemove, nil
+		}
+
+		// proxy instance: REBAL_PENDING -> REBAL_MERGED
+		// real instance: REBAL_PENDING -> REBAL_ACTIVE
+		if rebalState == c.REBAL_MERGED || rebalState == c.REBAL_ACTIVE {
+			if rollback {
+				return ready()
+			}
+			return tokenCleanupReady, nil
+		}
+		return TokenCleanupRollback, nil
+	}
+
+	return TokenCleanupKeep, nil
+}
+
+//
+// hasIndexPartitions returns true if the index instance of the transfer
+// token, with all the partitions it moves, is active in localMeta.  The
+// partitions of a partitioned index are in the real instance once merged.
+//
+func hasIndexPartitions(tt *c.TransferToken, localMeta *manager.LocalIndexMetadata) bool {
+
+	defn := &tt.IndexInst.Defn
+	topology := findTopologyByCollection(localMeta.IndexTopologies, defn.Bucket, defn.Scope, defn.Collection)
+	if topology == nil {
+		return false
+	}
+
+	defnDist := topology.FindIndexDefinitionById(defn.DefnId)
+	if defnDist == nil {
+		return false
+	}
+
+	for _, inst := range defnDist.Instances {
+		if inst.InstId != uint64(tt.InstId) && (tt.RealInstId == 0 || inst.InstId != uint64(tt.RealInstId)) {
+			continue
+		}
+		if c.IndexState(inst.State) != c.INDEX_STATE_ACTIVE {
+			continue
+		}
+		if !c.IsPartitioned(defn.PartitionScheme) {
+			return true
+		}
+
+		found := make(map[uint64]bool)
+		for _, partn := range inst.Partitions {
+			found[partn.PartId] = true
+		}
+
+		present := true
+		for _, partnId := range defn.Partitions {
+			if !found[uint64(partnId)] {
+				present = false
+				break
+			}
+		}
+		if present {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,152 @@
+package indexer
+
+import (
+	"errors"
+	"testing"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/manager"
+)
+
+var allTokenStates = []c.TokenState{
+	c.TransferTokenCreated,
+	c.TransferTokenAccepted,
+	c.TransferTokenRefused,
+	c.TransferTokenInitate,
+	c.TransferTokenInProgress,
+	c.TransferTokenReady,
+	c.TransferTokenCommit,
+	c.TransferTokenDeleted,
+	c.TransferTokenError,
+	c.TransferTokenMerge,
+}
+
+func TestMasterTokenCleanup(t *testing.T) {
+
+	for _, state := range allTokenStates {
+		expected := TokenCleanupKeep
+		if state == c.TransferTokenCommit || state == c.TransferTokenDeleted {
+			expected = TokenCleanupRemove
+		}
+
+		tt := &c.TransferToken{State: state}
+		if action := masterTokenCleanup(tt); action != expected {
+			t.Fatalf("state %v: expected %v, got %v", state, expected, action)
+		}
+	}
+}
+
+func TestSourceTokenCleanup(t *testing.T) {
+
+	for _, state := range allTokenStates {
+		for _, rollback := range []bool{false, true} {
+			expected := TokenCleanupKeep
+			if state == c.TransferTokenReady && !rollback {
+				expected = TokenCleanupCommit
+			}
+
+			tt := &c.TransferToken{State: state}
+			if action := sourceTokenCleanup(tt, rollback); action != expected {
+				t.Fatalf("state %v rollback %v: expected %v, got %v", state, rollback, expected, action)
+			}
+		}
+	}
+}
+
+func TestDestTokenCleanup(t *testing.T) {
+
+	errSource := errors.New("source unreachable")
+
+	present := func() (bool, error) { return true, nil }
+	dropped := func() (bool, error) { return false, nil }
+	unreachable := func() (bool, error) { return false, errSource }
+
+	tests := []struct {
+		state      c.TokenState
+		rebalState c.RebalanceState
+		found      bool
+		rollback   bool
+		sourceCopy func() (bool, error)
+		expected   string
+		err        error
+	}{
+		{c.TransferTokenCreated, c.REBAL_NIL, true, false, present, TokenCleanupRollback, nil},
+		{c.TransferTokenAccepted, c.REBAL_NIL, true, false, present, TokenCleanupRollback, nil},
+		{c.TransferTokenRefused, c.REBAL_NIL, true, false, present, TokenCleanupRollback, nil},
+		{c.TransferTokenInitate, c.REBAL_NIL, true, false, present, TokenCleanupRollback, nil},
+		{c.TransferTokenInProgress, c.REBAL_NIL, true, true, dropped, TokenCleanupRollback, nil},
+
+		// ready movement is rolled back only if the source index is there
+		{c.TransferTokenReady, c.REBAL_NIL, true, false, present, TokenCleanupKeep, nil},
+		{c.TransferTokenReady, c.REBAL_NIL, true, true, present, TokenCleanupRollback, nil},
+		{c.TransferTokenReady, c.REBAL_NIL, true, true, dropped, TokenCleanupCommit, nil},
+		{c.TransferTokenReady, c.REBAL_NIL, true, true, unreachable, TokenCleanupKeep, errSource},
+
+		{c.TransferTokenCommit, c.REBAL_NIL, true, true, present, TokenCleanupKeep, nil},
+		{c.TransferTokenDeleted, c.REBAL_NIL, true, true, present, TokenCleanupKeep, nil},
+		{c.TransferTokenError, c.REBAL_NIL, true, true, present, TokenCleanupKeep, nil},
+
+		// partitions merged, or proxy instance gone
+		{c.TransferTokenMerge, c.REBAL_NIL, false, true, present, TokenCleanupRemove, nil},
+		{c.TransferTokenMerge, c.REBAL_PENDING, true, false, present, TokenCleanupRollback, nil},
+		{c.TransferTokenMerge, c.REBAL_MERGED, true, false, present, tokenCleanupReady, nil},
+		{c.TransferTokenMerge, c.REBAL_ACTIVE, true, false, present, tokenCleanupReady, nil},
+		{c.TransferTokenMerge, c.REBAL_MERGED, true, true, present, TokenCleanupRollback, nil},
+		{c.TransferTokenMerge, c.REBAL_ACTIVE, true, true, dropped, TokenCleanupCommit, nil},
+	}
+
+	for i, test := range tests {
+		tt := &c.TransferToken{State: test.state, RealInstId: 2}
+		action, err := destTokenCleanup(tt, test.rebalState, test.found, test.rollback, test.sourceCopy)
+		if action != test.expected || err != test.err {
+			t.Fatalf("test %v state %v: expected %v %v, got %v %v", i, test.state, test.expected, test.err, action, err)
+		}
+	}
+}
+
+func TestHasIndexPartitions(t *testing.T) {
+
+	newMeta := func(instId uint64, state c.IndexState, partns ...uint64) *manager.LocalIndexMetadata {
+		inst := manager.IndexInstDistribution{InstId: instId, State: uint32(state)}
+		for _, partnId := range partns {
+			inst.Partitions = append(inst.Partitions, manager.IndexPartDistribution{PartId: partnId})
+		}
+
+		return &manager.LocalIndexMetadata{
+			IndexTopologies: []manager.IndexTopology{{
+				Bucket:     "b",
+				Scope:      "s",
+				Collection: "c",
+				Definitions: []manager.IndexDefnDistribution{{
+					DefnId:    10,
+					Instances: []manager.IndexInstDistribution{inst},
+				}},
+			}},
+		}
+	}
+
+	tt := &c.TransferToken{InstId: 1}
+	tt.IndexInst.Defn = c.IndexDefn{DefnId: 10, Bucket: "b", Scope: "s", Collection: "c"}
+
+	if !hasIndexPartitions(tt, newMeta(1, c.INDEX_STATE_ACTIVE, 0)) {
+		t.Fatal("expected index on source")
+	}
+	if hasIndexPartitions(tt, newMeta(1, c.INDEX_STATE_DELETED, 0)) {
+		t.Fatal("unexpected deleted index on source")
+	}
+	if hasIndexPartitions(tt, newMeta(3, c.INDEX_STATE_ACTIVE, 0)) {
+		t.Fatal("unexpected index instance on source")
+	}
+
+	// partitions of a partitioned index are in the real instance
+	tt.RealInstId = 2
+	tt.IndexInst.Defn.PartitionScheme = c.KEY
+	tt.IndexInst.Defn.Partitions = []c.PartitionId{1, 3}
+
+	if !hasIndexPartitions(tt, newMeta(2, c.INDEX_STATE_ACTIVE, 1, 2, 3)) {
+		t.Fatal("expected partitions on source")
+	}
+	if hasIndexPartitions(tt, newMeta(2, c.INDEX_STATE_ACTIVE, 1, 2)) {
+		t.Fatal("unexpected partitions on source")
+	}
+}
@@ -25,10 +25,14 @@ const RebalanceRunning = "RebalanceRunning"
 const RebalanceTokenTag = "RebalanceToken"
 const MoveIndexTokenTag = "MoveIndexToken"
 const TransferTokenTag = "TransferToken"
+const RebalancePauseTag = "RebalancePause"
+const RebalanceCancelTag = "RebalanceCancel"
 
 const RebalanceMetakvDir = c.IndexingMetaDir + "rebalance/"
 const RebalanceTokenPath = RebalanceMetakvDir + RebalanceTokenTag
 const MoveIndexTokenPath = RebalanceMetakvDir + MoveIndexTokenTag
+const RebalancePausePath = RebalanceMetakvDir + RebalancePauseTag
+const RebalanceCancelPath = RebalanceMetakvDir + RebalanceCancelTag
 
 type RebalSource byte
 
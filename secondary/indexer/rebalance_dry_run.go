@@ -0,0 +1,111 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/couchbase/cbauth/service"
+	c "github.com/couchbase/indexing/secondary/common"
+	l "github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/planner"
+)
+
+//
+// RebalanceDryRun is the movement plan of a rebalance which is not run.
+//
+type RebalanceDryRun struct {
+	EjectNodes []string                 `json:"ejectNodes"`
+	Movements  []*planner.IndexMovement `json:"movements"`
+	DataSize   uint64                   `json:"dataSize"`
+	DiskSize   uint64                   `json:"diskSize"`
+}
+
+//
+// handleRebalanceDryRun runs the rebalance planner with the same settings
+// as rebalance, and returns the index movements it plans without running
+// them.  The node uuids of the indexer nodes to be removed from the cluster
+// can be given as a comma separated list in the ejectNodes parameter.
+//
+func (m *ServiceMgr) handleRebalanceDryRun(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := m.validateAuth(w, r)
+	if !ok {
+		l.Errorf("ServiceMgr::handleRebalanceDryRun Validation Failure for Request %v", l.TagUD(r))
+		return
+	}
+
+	if !c.IsAllowed(creds, []string{"cluster.settings!read"}, w) {
+		return
+	}
+
+	if r.Method != "GET" {
+		m.writeError(w, errors.New("Unsupported method"))
+		return
+	}
+
+	ustr, _ := c.NewUUID()
+	change := service.TopologyChange{
+		ID:         fmt.Sprintf("RebalanceDryRun%s", ustr.Str()),
+		EjectNodes: make([]service.NodeInfo, 0),
+	}
+
+	dryRun := &RebalanceDryRun{EjectNodes: make([]string, 0)}
+	for _, node := range strings.Split(r.FormValue("ejectNodes"), ",") {
+		if node = strings.TrimSpace(node); node != "" {
+			change.EjectNodes = append(change.EjectNodes, service.NodeInfo{NodeID: service.NodeID(node)})
+			dryRun.EjectNodes = append(dryRun.EjectNodes, node)
+		}
+	}
+
+	cfg := m.config.Load()
+	if allWarmedup, _ := checkAllIndexersWarmedup(cfg["clusterAddr"].String()); !allWarmedup {
+		m.writeError(w, errors.New("All indexers are not active"))
+		return
+	}
+
+	//same as rebalance, user setting redistribute_indexes decides if the
+	//indexes are moved only from the ejected nodes.
+	onEjectOnly := !cfg["settings.rebalance.redistribute_indexes"].Bool()
+	disableReplicaRepair := cfg["rebalance.disable_replica_repair"].Bool()
+	timeout := cfg["planner.timeout"].Int()
+	threshold := cfg["planner.variationThreshold"].Float64()
+	cpuProfile := cfg["planner.cpuProfile"].Bool()
+
+	start := time.Now()
+	movements, err := planner.ExecuteRebalanceDryRun(cfg["clusterAddr"].String(), change,
+		onEjectOnly, disableReplicaRepair, threshold, timeout, cpuProfile)
+	if err != nil {
+		l.Errorf("ServiceMgr::handleRebalanceDryRun Planner Error %v", err)
+		m.writeError(w, err)
+		return
+	}
+	l.Infof("ServiceMgr::handleRebalanceDryRun %v index movements planned for eject nodes %v. Time Taken %v",
+		len(movements), dryRun.EjectNodes, time.Since(start))
+
+	dryRun.Movements = movements
+	for _, movement := range movements {
+		dryRun.DataSize += movement.DataSize
+		dryRun.DiskSize += movement.DiskSize
+	}
+
+	out, err := json.Marshal(dryRun)
+	if err != nil {
+		l.Errorf("ServiceMgr::handleRebalanceDryRun Error %v", err)
+		m.writeError(w, err)
+		return
+	}
+	m.writeJson(w, out)
+}
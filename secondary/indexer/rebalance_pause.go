@@ -0,0 +1,160 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	l "github.com/couchbase/indexing/secondary/logging"
+)
+
+var ErrRebalanceNotMaster = errors.New("Rebalance is not running with this node as master")
+var ErrRebalanceDone = errors.New("Rebalance is done")
+var ErrRebalancePauseNotFound = errors.New("Rebalance pause not found")
+
+//
+// RebalancePause is the movement plan of a paused rebalance, persisted in
+// metakv at RebalancePausePath.  Pending has the transfer tokens which are
+// not published yet.
+//
+type RebalancePause struct {
+	RebalId string                      `json:"rebalId"`
+	Pending map[string]*c.TransferToken `json:"pending"`
+}
+
+//
+// Pause stops the master from publishing more transfer tokens.  The index
+// movements already in progress are carried on until they are done, and
+// the others are held until Resume.
+//
+func (r *Rebalancer) Pause() error {
+
+	if !r.master {
+		return ErrRebalanceNotMaster
+	}
+
+	if r.isFinish() {
+		return ErrRebalanceDone
+	}
+
+	if !atomic.CompareAndSwapInt32(&r.paused, 0, 1) {
+		return nil
+	}
+
+	r.mu.RLock()
+	plan := &RebalancePause{
+		RebalId: r.rebalToken.RebalId,
+		Pending: make(map[string]*c.TransferToken),
+	}
+	for _, batch := range r.transferTokenBatches {
+		for _, ttid := range batch {
+			plan.Pending[ttid] = r.transferTokens[ttid]
+		}
+	}
+	r.mu.RUnlock()
+
+	l.Infof("Rebalancer::Pause Rebalance %v paused with %v pending transfer tokens",
+		plan.RebalId, len(plan.Pending))
+
+	if err := MetakvSet(RebalancePausePath, plan); err != nil {
+		atomic.StoreInt32(&r.paused, 0)
+		return err
+	}
+
+	return nil
+}
+
+//
+// Resume publishes the transfer tokens held since Pause.  The movement plan
+// persisted by Pause is read back, and only the tokens pending in it are
+// published.
+//
+func (r *Rebalancer) Resume() error {
+
+	if !r.master {
+		return ErrRebalanceNotMaster
+	}
+
+	if r.isFinish() {
+		return ErrRebalanceDone
+	}
+
+	if !r.isPaused() {
+		return nil
+	}
+
+	var plan RebalancePause
+	found, err := MetakvGet(RebalancePausePath, &plan)
+	if err != nil {
+		l.Errorf("Rebalancer::Resume Error Fetching Rebalance Pause From Metakv %v", err)
+		return err
+	}
+
+	if !found {
+		return ErrRebalancePauseNotFound
+	}
+
+	if plan.RebalId != r.rebalToken.RebalId {
+		return fmt.Errorf("Rebalance pause is for rebalance %v, not %v", plan.RebalId, r.rebalToken.RebalId)
+	}
+
+	if !atomic.CompareAndSwapInt32(&r.paused, 1, 0) {
+		return nil
+	}
+
+	r.mu.Lock()
+	r.transferTokenBatches = restorePendingBatches(r.transferTokenBatches, r.transferTokens, plan.Pending)
+	r.mu.Unlock()
+
+	l.Infof("Rebalancer::Resume Rebalance %v resumed with %v pending transfer tokens",
+		plan.RebalId, len(plan.Pending))
+
+	if err := MetakvDel(RebalancePausePath); err != nil {
+		return err
+	}
+
+	r.publishTransferTokenBatch()
+	return nil
+}
+
+//
+// restorePendingBatches returns the batches of transfer tokens to publish
+// on resume, keeping only the tokens pending in the plan persisted on pause.
+// The tokens are taken from pending, and the others are dropped.
+//
+func restorePendingBatches(batches [][]string, tokens map[string]*c.TransferToken,
+	pending map[string]*c.TransferToken) [][]string {
+
+	restored := make([][]string, 0, len(batches))
+	for _, batch := range batches {
+		var keep []string
+		for _, ttid := range batch {
+			if tt, ok := pending[ttid]; ok {
+				tokens[ttid] = tt
+				keep = append(keep, ttid)
+			} else {
+				l.Warnf("Rebalancer::Resume Transfer token %v is not pending in the rebalance pause. "+
+					"Skipping it.", ttid)
+				delete(tokens, ttid)
+			}
+		}
+		if len(keep) != 0 {
+			restored = append(restored, keep)
+		}
+	}
+	return restored
+}
+
+func (r *Rebalancer) isPaused() bool {
+	return atomic.LoadInt32(&r.paused) == 1
+}
@@ -0,0 +1,38 @@
+package indexer
+
+import (
+	"reflect"
+	"testing"
+
+	c "github.com/couchbase/indexing/secondary/common"
+)
+
+func TestRestorePendingBatches(t *testing.T) {
+	tokens := map[string]*c.TransferToken{
+		"tt1": &c.TransferToken{InstId: 1},
+		"tt2": &c.TransferToken{InstId: 2},
+		"tt3": &c.TransferToken{InstId: 3},
+		"tt4": &c.TransferToken{InstId: 4},
+	}
+	batches := [][]string{{"tt1", "tt2"}, {"tt3"}, {"tt4"}}
+
+	pending := map[string]*c.TransferToken{
+		"tt1": &c.TransferToken{InstId: 1, RebalId: "r1"},
+		"tt2": &c.TransferToken{InstId: 2, RebalId: "r1"},
+		"tt4": &c.TransferToken{InstId: 4, RebalId: "r1"},
+	}
+
+	restored := restorePendingBatches(batches, tokens, pending)
+	if expected := [][]string{{"tt1", "tt2"}, {"tt4"}}; !reflect.DeepEqual(restored, expected) {
+		t.Fatalf("expected batches %v, got %v", expected, restored)
+	}
+
+	if _, ok := tokens["tt3"]; ok {
+		t.Fatal("token not pending in the plan is kept")
+	}
+	for ttid, tt := range pending {
+		if tokens[ttid] != tt {
+			t.Fatalf("token %v not restored from the plan", ttid)
+		}
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"errors"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"encoding/json"
@@ -39,6 +40,7 @@ import (
 	l "github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/manager"
 	"github.com/couchbase/indexing/secondary/manager/client"
+	"github.com/couchbase/indexing/secondary/planner"
 	"github.com/couchbase/indexing/secondary/security"
 )
 
@@ -78,6 +80,8 @@ type ServiceMgr struct {
 	cleanupPending bool
 	indexerReady   bool
 
+	rebalanceCleanup *RebalanceCleanup
+
 	p runParams
 }
 
@@ -143,6 +147,7 @@ func NewRebalanceMgr(supvCmdch MsgChannel, supvMsgch MsgChannel, config c.Config
 	}
 
 	mgr.config.Store(config)
+	gRebalanceThrottle.updateConfig(config)
 
 	var cinfo *c.ClusterInfoCache
 	url, err := c.ClusterAuthUrl(config["clusterAddr"].String())
@@ -176,6 +181,7 @@ func NewRebalanceMgr(supvCmdch MsgChannel, supvMsgch MsgChannel, config c.Config
 
 	go mgr.run()
 	go mgr.initService(mgr.cleanupPending)
+	go newStorageMigrator(mgr).run()
 
 	return mgr, &MsgSuccess{}
 }
@@ -199,6 +205,11 @@ func (m *ServiceMgr) initService(cleanupPending bool) {
 	mux.HandleFunc("/moveIndex", m.handleMoveIndex)
 	mux.HandleFunc("/moveIndexInternal", m.handleMoveIndexInternal)
 	mux.HandleFunc("/nodeuuid", m.handleNodeuuid)
+	mux.HandleFunc("/rebalanceStatus", m.handleRebalanceStatus)
+	mux.HandleFunc("/pauseRebalance", c.NetworkAllowed(m.handlePauseRebalance))
+	mux.HandleFunc("/resumeRebalance", c.NetworkAllowed(m.handleResumeRebalance))
+	mux.HandleFunc("/rebalanceDryRun", m.handleRebalanceDryRun)
+	mux.HandleFunc("/cancelRebalance", c.NetworkAllowed(m.handleCancelRebalance))
 }
 
 //update node list after restart
@@ -273,6 +284,7 @@ func (m *ServiceMgr) handleSupervisorCommands(cmd Message) {
 func (m *ServiceMgr) handleConfigUpdate(cmd Message) {
 	cfgUpdate := cmd.(*MsgConfigUpdate)
 	m.config.Store(cfgUpdate.GetConfig())
+	gRebalanceThrottle.updateConfig(cfgUpdate.GetConfig())
 	m.supvCmdch <- &MsgSuccess{}
 }
 
@@ -777,6 +789,7 @@ func (m *ServiceMgr) initPreparePhaseRebalance() error {
 	}
 
 	m.rebalanceRunning = true
+	gRebalanceThrottle.setActive(true)
 	m.monitorStopCh = make(StopChannel)
 
 	go m.monitorStartPhaseInit(m.monitorStopCh)
@@ -809,6 +822,11 @@ func (m *ServiceMgr) runCleanupPhaseLOCKED(path string, isMaster bool) error {
 		if err != nil {
 			return err
 		}
+
+		err = m.cleanupRebalancePause()
+		if err != nil {
+			return err
+		}
 	}
 
 	if m.indexerReady {
@@ -860,6 +878,28 @@ func (m *ServiceMgr) cleanupGlobalRToken(path string) error {
 	return nil
 }
 
+func (m *ServiceMgr) cleanupRebalancePause() error {
+
+	var plan RebalancePause
+	found, err := MetakvGet(RebalancePausePath, &plan)
+	if err != nil {
+		l.Errorf("ServiceMgr::cleanupRebalancePause Error Fetching Rebalance Pause From Metakv %v", err)
+		return err
+	}
+
+	if found {
+		l.Infof("ServiceMgr::cleanupRebalancePause Delete Rebalance Pause for %v", plan.RebalId)
+
+		err := MetakvDel(RebalancePausePath)
+		if err != nil {
+			l.Errorf("ServiceMgr::cleanupRebalancePause Unable to delete Rebalance Pause from "+
+				"Meta Storage. Err %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *ServiceMgr) cleanupOrphanTokens(change service.TopologyChange) error {
 
 	rtokens, err := m.getCurrRebalTokens()
@@ -962,123 +1002,181 @@ func (m *ServiceMgr) cleanupTransferTokens(tts map[string]*c.TransferToken) erro
 	}
 	<-respch
 
+	// a ready index movement of a cancelled rebalance is rolled back
+	// instead of being completed, as long as the index is still on the
+	// source node.
+	cancel := getRebalanceCancel()
+	rollback := func(tt *c.TransferToken) bool {
+		return cancel != nil && cancel.RebalId == tt.RebalId
+	}
+
+	result := &RebalanceCleanup{
+		Time:      time.Now(),
+		Cancelled: cancel != nil,
+		Tokens:    make([]*TokenCleanup, 0),
+	}
+
+	record := func(ttid string, tt *c.TransferToken, role string, action string, err error) {
+		tc := newTokenCleanup(ttid, tt, role)
+		tc.Action = action
+		if err != nil {
+			tc.Error = err.Error()
+		}
+		result.Tokens = append(result.Tokens, tc)
+	}
+
 	// cleanup transfer token
 	for ttid, tt := range tts {
 
 		l.Infof("ServiceMgr::cleanupTransferTokens Cleaning Up %v %v", ttid, tt)
 
 		if tt.MasterId == string(m.nodeInfo.NodeID) {
-			m.cleanupTransferTokensForMaster(ttid, tt)
+			action, err := m.cleanupTransferTokensForMaster(ttid, tt)
+			record(ttid, tt, "master", action, err)
 		}
 		if tt.SourceId == string(m.nodeInfo.NodeID) {
-			m.cleanupTransferTokensForSource(ttid, tt)
+			action, err := m.cleanupTransferTokensForSource(ttid, tt, rollback(tt))
+			record(ttid, tt, "source", action, err)
 		}
 		if tt.DestId == string(m.nodeInfo.NodeID) {
-			m.cleanupTransferTokensForDest(ttid, tt, indexStateMap)
+			action, err := m.cleanupTransferTokensForDest(ttid, tt, indexStateMap, rollback(tt))
+			record(ttid, tt, "dest", action, err)
 		}
 
 	}
 
+	m.rebalanceCleanup = result
+
 	return nil
 }
 
-func (m *ServiceMgr) cleanupTransferTokensForMaster(ttid string, tt *c.TransferToken) error {
-
-	switch tt.State {
-
-	case c.TransferTokenCommit, c.TransferTokenDeleted:
-		l.Infof("ServiceMgr::cleanupTransferTokensForMaster Cleanup Token %v %v", ttid, tt)
-		err := MetakvDel(RebalanceMetakvDir + ttid)
-		if err != nil {
-			l.Errorf("ServiceMgr::cleanupTransferTokensForMaster Unable to delete TransferToken In "+
-				"Meta Storage. %v. Err %v", tt, err)
-			return err
-		}
+func (m *ServiceMgr) cleanupTransferTokensForMaster(ttid string, tt *c.TransferToken) (string, error) {
 
+	if masterTokenCleanup(tt) != TokenCleanupRemove {
+		return TokenCleanupKeep, nil
 	}
 
-	return nil
+	l.Infof("ServiceMgr::cleanupTransferTokensForMaster Cleanup Token %v %v", ttid, tt)
+	err := MetakvDel(RebalanceMetakvDir + ttid)
+	if err != nil {
+		l.Errorf("ServiceMgr::cleanupTransferTokensForMaster Unable to delete TransferToken In "+
+			"Meta Storage. %v. Err %v", tt, err)
+		return TokenCleanupKeep, err
+	}
+	return TokenCleanupRemove, nil
 
 }
 
-func (m *ServiceMgr) cleanupTransferTokensForSource(ttid string, tt *c.TransferToken) error {
+func (m *ServiceMgr) cleanupTransferTokensForSource(ttid string, tt *c.TransferToken, rollback bool) (string, error) {
 
-	switch tt.State {
+	switch sourceTokenCleanup(tt, rollback) {
 
-	case c.TransferTokenReady:
+	case TokenCleanupCommit:
 		var err error
 		l.Infof("ServiceMgr::cleanupTransferTokensForSource Cleanup Token %v %v", ttid, tt)
 		defn := tt.IndexInst.Defn
 		defn.InstId = tt.InstId
 		defn.RealInstId = tt.RealInstId
 		err = m.cleanupIndex(defn)
-		if err == nil {
-			err = MetakvDel(RebalanceMetakvDir + ttid)
-			if err != nil {
-				l.Errorf("ServiceMgr::cleanupTransferTokensForSource Unable to delete TransferToken In "+
-					"Meta Storage. %v. Err %v", tt, err)
-				return err
-			}
+		if err != nil {
+			return TokenCleanupKeep, err
+		}
+
+		err = MetakvDel(RebalanceMetakvDir + ttid)
+		if err != nil {
+			l.Errorf("ServiceMgr::cleanupTransferTokensForSource Unable to delete TransferToken In "+
+				"Meta Storage. %v. Err %v", tt, err)
+			return TokenCleanupCommit, err
+		}
+		return TokenCleanupCommit, nil
+
+	case TokenCleanupKeep:
+		if rollback && tt.State == c.TransferTokenReady {
+			// the destination drops its index, and deletes the token
+			l.Infof("ServiceMgr::cleanupTransferTokensForSource Keep Source Index for Cancelled Rebalance %v %v", ttid, tt)
 		}
 	}
 
-	return nil
+	return TokenCleanupKeep, nil
 
 }
 
-func (m *ServiceMgr) cleanupTransferTokensForDest(ttid string, tt *c.TransferToken, indexStateMap map[c.IndexInstId]c.RebalanceState) error {
+func (m *ServiceMgr) cleanupTransferTokensForDest(ttid string, tt *c.TransferToken,
+	indexStateMap map[c.IndexInstId]c.RebalanceState, rollback bool) (string, error) {
 
-	cleanup := func() error {
-		var err error
+	// the proxy instance could have been deleted after it has gone to MERGED state
+	rebalState, found := indexStateMap[tt.InstId]
+	if !found {
+		rebalState, found = indexStateMap[tt.RealInstId]
+	}
+
+	sourceCopy := func() (bool, error) {
+		return m.hasSourceCopy(tt)
+	}
+
+	action, err := destTokenCleanup(tt, rebalState, found, rollback, sourceCopy)
+	if err != nil {
+		l.Errorf("ServiceMgr::cleanupTransferTokensForDest Unable to find Source Index %v %v. Err %v", ttid, tt, err)
+		return action, err
+	}
+
+	switch action {
+
+	case TokenCleanupRollback:
 		l.Infof("ServiceMgr::cleanupTransferTokensForDest Cleanup Token %v %v", ttid, tt)
 		defn := tt.IndexInst.Defn
 		defn.InstId = tt.InstId
 		defn.RealInstId = tt.RealInstId
-		err = m.cleanupIndex(defn)
-		if err == nil {
-			err = MetakvDel(RebalanceMetakvDir + ttid)
-			if err != nil {
-				l.Errorf("ServiceMgr::cleanupTransferTokensForDest Unable to delete TransferToken In "+
-					"Meta Storage. %v. Err %v", tt, err)
-				return err
-			}
+		if err := m.cleanupIndex(defn); err != nil {
+			return TokenCleanupKeep, err
 		}
 
-		return nil
-	}
+	case TokenCleanupCommit:
+		l.Infof("ServiceMgr::cleanupTransferTokensForDest Source Index Dropped. Commit Token %v %v", ttid, tt)
 
-	switch tt.State {
+	case TokenCleanupRemove:
 
-	case c.TransferTokenCreated, c.TransferTokenAccepted, c.TransferTokenRefused,
-		c.TransferTokenInitate, c.TransferTokenInProgress:
-		return cleanup()
+	case tokenCleanupReady:
+		// proxy instance: REBAL_PENDING -> REBAL_MERGED
+		// real instance: REBAL_PENDING -> REBAL_ACTIVE
+		tt.State = c.TransferTokenReady
+		setTransferTokenInMetakv(ttid, tt)
+		return TokenCleanupKeep, nil
 
-	case c.TransferTokenMerge:
-		// the proxy instance could have been deleted after it has gone to MERGED state
-		rebalState, ok := indexStateMap[tt.InstId]
-		if !ok {
-			rebalState, ok = indexStateMap[tt.RealInstId]
+	default:
+		return TokenCleanupKeep, nil
+	}
+
+	if err := MetakvDel(RebalanceMetakvDir + ttid); err != nil {
+		l.Errorf("ServiceMgr::cleanupTransferTokensForDest Unable to delete TransferToken In "+
+			"Meta Storage. %v. Err %v", tt, err)
+		if action == TokenCleanupRemove {
+			return TokenCleanupKeep, err
 		}
+		return action, err
+	}
+	return action, nil
+}
 
-		if !ok {
-			if err := MetakvDel(RebalanceMetakvDir + ttid); err != nil {
-				l.Errorf("ServiceMgr::cleanupTransferTokensForDest Unable to delete TransferToken In "+
-					"Meta Storage. %v. Err %v", tt, err)
-				return err
-			}
+//
+// hasSourceCopy returns true if the index moved by the transfer token is
+// still on its source node.  An error is returned if the source node cannot
+// be reached, in which case the token is left for a later cleanup.
+//
+func (m *ServiceMgr) hasSourceCopy(tt *c.TransferToken) (bool, error) {
 
-			// proxy instance: REBAL_PENDING -> REBAL_MERGED
-			// real instance: REBAL_PENDING -> REBAL_ACTIVE
-		} else if rebalState == c.REBAL_MERGED || rebalState == c.REBAL_ACTIVE {
-			tt.State = c.TransferTokenReady
-			setTransferTokenInMetakv(ttid, tt)
+	cfg := m.config.Load()
+	addr, err := resolvePeerIndexer(cfg["clusterAddr"].String(), tt.SourceId)
+	if err != nil {
+		return false, err
+	}
 
-		} else {
-			return cleanup()
-		}
+	localMeta, err := getLocalMeta(addr)
+	if err != nil {
+		return false, err
 	}
 
-	return nil
+	return hasIndexPartitions(tt, localMeta), nil
 }
 
 func (m *ServiceMgr) cleanupIndex(indexDefn c.IndexDefn) error {
@@ -1143,6 +1241,7 @@ func (m *ServiceMgr) cleanupRebalanceRunning() error {
 	}
 
 	m.rebalanceRunning = false
+	gRebalanceThrottle.setActive(false)
 
 	// notify DDLServiceManager and SchedIndexCreator
 	resumeDDLProcessing()
@@ -1239,6 +1338,9 @@ func (m *ServiceMgr) rebalanceJanitor() {
 				if err != nil {
 					l.Errorf("ServiceMgr::rebalanceJanitor Error Cleaning Transfer Tokens %v", err)
 				}
+			} else if rtokens != nil {
+				// all the transfer tokens of a cancelled rebalance are cleaned up
+				m.cleanupRebalanceCancel()
 			}
 		}
 		m.mu.Unlock()
@@ -2018,6 +2120,103 @@ func (m *ServiceMgr) handleNodeuuid(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (m *ServiceMgr) handleRebalanceStatus(w http.ResponseWriter, r *http.Request) {
+
+	_, ok := m.validateAuth(w, r)
+	if !ok {
+		l.Errorf("ServiceMgr::handleRebalanceStatus Validation Failure for Request %v", l.TagUD(r))
+		return
+	}
+
+	if r.Method == "GET" {
+
+		m.mu.RLock()
+		rebalancer := m.rebalancer
+		if rebalancer == nil {
+			rebalancer = m.rebalancerF
+		}
+		cleanup := m.rebalanceCleanup
+		m.mu.RUnlock()
+
+		status := &RebalanceStatus{
+			ByState:   make(map[string]int),
+			Movements: make([]*IndexMoveStatus, 0),
+		}
+		if rebalancer != nil {
+			status = rebalancer.getRebalanceStatus()
+		}
+		status.Cleanup = cleanup
+
+		out, err := json.Marshal(status)
+		if err != nil {
+			l.Errorf("ServiceMgr::handleRebalanceStatus Error %v", err)
+			m.writeError(w, err)
+		} else {
+			m.writeJson(w, out)
+		}
+	} else {
+		m.writeError(w, errors.New("Unsupported method"))
+		return
+	}
+}
+
+func (m *ServiceMgr) handlePauseRebalance(w http.ResponseWriter, r *http.Request) {
+	m.handlePauseResumeRebalance(w, r, true)
+}
+
+func (m *ServiceMgr) handleResumeRebalance(w http.ResponseWriter, r *http.Request) {
+	m.handlePauseResumeRebalance(w, r, false)
+}
+
+//
+// handlePauseResumeRebalance pauses or resumes the rebalance running with
+// this node as master.  While rebalance is paused, the index movements in
+// progress are carried on, and no other movement is started.
+//
+func (m *ServiceMgr) handlePauseResumeRebalance(w http.ResponseWriter, r *http.Request, pause bool) {
+
+	creds, ok := m.validateAuth(w, r)
+	if !ok {
+		l.Errorf("ServiceMgr::handlePauseResumeRebalance Validation Failure for Request %v", l.TagUD(r))
+		return
+	}
+
+	if !c.IsAllowed(creds, []string{"cluster.settings!write"}, w) {
+		return
+	}
+
+	if r.Method != "POST" {
+		m.writeError(w, errors.New("Unsupported method"))
+		return
+	}
+
+	m.mu.RLock()
+	rebalancer := m.rebalancer
+	rtoken := m.rebalanceToken
+	m.mu.RUnlock()
+
+	if rebalancer == nil {
+		m.writeError(w, ErrRebalanceNotMaster)
+		return
+	}
+
+	var err error
+	if pause {
+		l.Infof("ServiceMgr::handlePauseResumeRebalance Pause Rebalance %v", rtoken)
+		err = rebalancer.Pause()
+	} else {
+		l.Infof("ServiceMgr::handlePauseResumeRebalance Resume Rebalance %v", rtoken)
+		err = rebalancer.Resume()
+	}
+
+	if err != nil {
+		l.Errorf("ServiceMgr::handlePauseResumeRebalance Error %v", err)
+		m.writeError(w, err)
+		return
+	}
+	m.writeOk(w)
+}
+
 func (m *ServiceMgr) getCurrRebalTokens() (*RebalTokens, error) {
 
 	metainfo, err := metakv.ListAllChildren(RebalanceMetakvDir)
@@ -2050,6 +2249,9 @@ func (m *ServiceMgr) getCurrRebalTokens() (*RebalTokens, error) {
 			var tt c.TransferToken
 			json.Unmarshal(kv.Value, &tt)
 			rinfo.TT[ttid] = &tt
+
+		} else if strings.Contains(kv.Path, RebalancePauseTag) || strings.Contains(kv.Path, RebalanceCancelTag) {
+			// not a token
 		} else {
 			l.Errorf("ServiceMgr::getCurrRebalTokens Unknown Token %v. Ignored.", kv)
 		}
@@ -2333,6 +2535,11 @@ func (m *ServiceMgr) handleMoveIndex(w http.ResponseWriter, r *http.Request) {
 		plan := make(map[string]interface{})
 		plan["nodes"] = nodes
 
+		// move a single replica of the index
+		if replicaId, ok := in["replicaId"]; ok {
+			plan["replicaId"] = replicaId
+		}
+
 		req = manager.IndexRequest{IndexIds: idList, Plan: plan}
 
 		code, errStr := m.doHandleMoveIndex(&req)
@@ -2406,6 +2613,18 @@ func (m *ServiceMgr) doHandleMoveIndex(req *manager.IndexRequest) (int, string)
 		return http.StatusBadRequest, err.Error()
 	}
 
+	replicaId, err := getMoveIndexReplicaId(req)
+	if err != nil {
+		l.Errorf("ServiceMgr::doHandleMoveIndex %v", err)
+		return http.StatusBadRequest, err.Error()
+	}
+
+	if replicaId != -1 && len(nodes) != 1 {
+		err := errors.New("Target node list must specify exactly one destination for the replica")
+		l.Errorf("ServiceMgr::doHandleMoveIndex %v", err)
+		return http.StatusBadRequest, err.Error()
+	}
+
 	err, noop := m.initMoveIndex(req, nodes)
 	if err != nil {
 		l.Errorf("ServiceMgr::doHandleMoveIndex %v %v", err, m.rebalanceToken)
@@ -2582,6 +2801,44 @@ func (m *ServiceMgr) generateTransferTokenForMoveIndex(req *manager.IndexRequest
 
 	l.Infof("ServiceMgr::handleMoveIndex nodes %v uuid %v", reqNodes, reqNodeUUID)
 
+	defnId := c.IndexDefnId(req.IndexIds.DefnIds[0])
+	replicaId, err := getMoveIndexReplicaId(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var transferTokens map[string]*c.TransferToken
+	if replicaId != -1 {
+		transferTokens, err = m.generateTransferTokenForMoveReplica(topology, defnId, replicaId, reqNodeUUID[0])
+	} else {
+		transferTokens, err = m.generateTransferTokenForMoveAllReplicas(topology, defnId, reqNodes, reqNodeUUID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(transferTokens) == 0 {
+		return transferTokens, nil
+	}
+
+	// validate the placement of the replicas after the move with the planner
+	moves := make(map[int]string)
+	for _, tt := range transferTokens {
+		moves[tt.IndexInst.ReplicaId] = tt.DestId
+	}
+
+	cfg := m.config.Load()
+	if err := planner.ValidateMoveIndex(cfg["clusterAddr"].String(), defnId, moves); err != nil {
+		l.Errorf("ServiceMgr::generateTransferTokenForMoveIndex Planner Error %v", err)
+		return nil, fmt.Errorf("Invalid destination for index: %v", err)
+	}
+
+	return transferTokens, nil
+}
+
+func (m *ServiceMgr) generateTransferTokenForMoveAllReplicas(topology *manager.ClusterIndexMetadata,
+	defnId c.IndexDefnId, reqNodes []string, reqNodeUUID []string) (map[string]*c.TransferToken, error) {
+
 	var currNodeUUID []string
 	var currInst [][]*c.IndexInst
 	var numCurrInst int
@@ -2590,7 +2847,7 @@ func (m *ServiceMgr) generateTransferTokenForMoveIndex(req *manager.IndexRequest
 	outerloop:
 		for _, index := range localMeta.IndexDefinitions {
 
-			if c.IndexDefnId(req.IndexIds.DefnIds[0]) == index.DefnId {
+			if defnId == index.DefnId {
 
 				numCurrInst++
 				for i, uuid := range reqNodeUUID {
@@ -2615,29 +2872,9 @@ func (m *ServiceMgr) generateTransferTokenForMoveIndex(req *manager.IndexRequest
 					return nil, err
 				}
 
-				cfg := m.config.Load()
-				numVbuckets := cfg["numVbuckets"].Int()
-
 				var instList []*c.IndexInst
 				for _, inst := range insts {
-
-					pc := c.NewKeyPartitionContainer(numVbuckets, int(inst.NumPartitions), index.PartitionScheme, index.HashScheme)
-					for _, partition := range inst.Partitions {
-						partnDefn := c.KeyPartitionDefn{Id: c.PartitionId(partition.PartId), Version: int(partition.Version)}
-						pc.AddPartition(c.PartitionId(partition.PartId), partnDefn)
-					}
-
-					localInst := &c.IndexInst{
-						InstId:    c.IndexInstId(inst.InstId),
-						Defn:      index,
-						State:     c.IndexState(inst.State),
-						Stream:    c.StreamId(inst.StreamId),
-						Error:     inst.Error,
-						Version:   int(inst.Version),
-						ReplicaId: int(inst.ReplicaId),
-						Pc:        pc,
-					}
-					instList = append(instList, localInst)
+					instList = append(instList, m.localIndexInst(index, inst))
 				}
 
 				currInst = append(currInst, instList)
@@ -2684,6 +2921,87 @@ func (m *ServiceMgr) generateTransferTokenForMoveIndex(req *manager.IndexRequest
 
 }
 
+func (m *ServiceMgr) generateTransferTokenForMoveReplica(topology *manager.ClusterIndexMetadata,
+	defnId c.IndexDefnId, replicaId int, destId string) (map[string]*c.TransferToken, error) {
+
+	var source string
+	var insts []*c.IndexInst
+
+	for _, localMeta := range topology.Metadata {
+		for _, index := range localMeta.IndexDefinitions {
+
+			if defnId != index.DefnId {
+				continue
+			}
+
+			topology := findTopologyByCollection(localMeta.IndexTopologies, index.Bucket, index.Scope, index.Collection)
+			if topology == nil {
+				err := errors.New(fmt.Sprintf("Fail to find index topology for bucket %v for node %v.", index.Bucket, localMeta.NodeUUID))
+				l.Errorf("ServiceMgr::generateTransferTokenForMoveReplica %v", err)
+				return nil, err
+			}
+
+			for _, inst := range topology.GetIndexInstancesByDefn(index.DefnId) {
+				if int(inst.ReplicaId) == replicaId {
+					source = localMeta.NodeUUID
+					insts = append(insts, m.localIndexInst(index, inst))
+				} else if localMeta.NodeUUID == destId {
+					err := errors.New(fmt.Sprintf("Replica %v of the index already exist on the destination node.", inst.ReplicaId))
+					l.Errorf("ServiceMgr::generateTransferTokenForMoveReplica %v", err)
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if len(insts) == 0 {
+		err := errors.New(fmt.Sprintf("Fail to find replica %v of index %v.", replicaId, defnId))
+		l.Errorf("ServiceMgr::generateTransferTokenForMoveReplica %v", err)
+		return nil, err
+	}
+
+	transferTokens := make(map[string]*c.TransferToken)
+	for _, inst := range insts {
+		ttid, tt, err := m.genTransferToken(inst, source, destId)
+		if err != nil {
+			return nil, err
+		}
+
+		if tt.SourceId == tt.DestId {
+			l.Infof("ServiceMgr::generateTransferTokenForMoveReplica Skip No-op TransferToken %v", tt)
+			continue
+		}
+
+		l.Infof("ServiceMgr::generateTransferTokenForMoveReplica Generated TransferToken %v %v", ttid, tt)
+		transferTokens[ttid] = tt
+	}
+
+	return transferTokens, nil
+}
+
+func (m *ServiceMgr) localIndexInst(index c.IndexDefn, inst manager.IndexInstDistribution) *c.IndexInst {
+
+	cfg := m.config.Load()
+	numVbuckets := cfg["numVbuckets"].Int()
+
+	pc := c.NewKeyPartitionContainer(numVbuckets, int(inst.NumPartitions), index.PartitionScheme, index.HashScheme)
+	for _, partition := range inst.Partitions {
+		partnDefn := c.KeyPartitionDefn{Id: c.PartitionId(partition.PartId), Version: int(partition.Version)}
+		pc.AddPartition(c.PartitionId(partition.PartId), partnDefn)
+	}
+
+	return &c.IndexInst{
+		InstId:    c.IndexInstId(inst.InstId),
+		Defn:      index,
+		State:     c.IndexState(inst.State),
+		Stream:    c.StreamId(inst.StreamId),
+		Error:     inst.Error,
+		Version:   int(inst.Version),
+		ReplicaId: int(inst.ReplicaId),
+		Pc:        pc,
+	}
+}
+
 func (m *ServiceMgr) getNodeIdFromDest(dest string) (string, error) {
 
 	m.cinfo.Lock()
@@ -2843,6 +3161,35 @@ func validateMoveIndexReq(req *manager.IndexRequest) ([]string, error) {
 
 }
 
+// getMoveIndexReplicaId returns the replica to be moved, or -1 to move all the replicas
+func getMoveIndexReplicaId(req *manager.IndexRequest) (int, error) {
+
+	value, ok := req.Plan["replicaId"]
+	if !ok {
+		return -1, nil
+	}
+
+	var replicaId int
+	switch v := value.(type) {
+	case float64:
+		replicaId = int(v)
+	case string:
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return -1, errors.New(fmt.Sprintf("ReplicaId '%v' is not valid", value))
+		}
+		replicaId = id
+	default:
+		return -1, errors.New(fmt.Sprintf("ReplicaId '%v' is not valid", value))
+	}
+
+	if replicaId < 0 {
+		return -1, errors.New(fmt.Sprintf("ReplicaId '%v' is not valid", value))
+	}
+
+	return replicaId, nil
+}
+
 /////////////////////////////////////////////////////////////////////////
 //
 //  local helper methods
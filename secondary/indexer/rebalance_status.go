@@ -0,0 +1,145 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"sort"
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+)
+
+type progressSample struct {
+	at       time.Time
+	progress float64
+}
+
+//
+// RebalanceStatus is the response of /rebalanceStatus.  On the rebalance
+// master, it has the state of all the index movements of the rebalance.
+// On other nodes, it has the movements from or to the node.  Cleanup is
+// the result of the last cleanup of transfer tokens on the node.
+//
+type RebalanceStatus struct {
+	Running     bool               `json:"running"`
+	RebalanceId string             `json:"rebalanceId,omitempty"`
+	Master      bool               `json:"master"`
+	Paused      bool               `json:"paused"`
+	Progress    float64            `json:"progress"`
+	Movements   []*IndexMoveStatus `json:"movements"`
+	ByState     map[string]int     `json:"byState"`
+	Cleanup     *RebalanceCleanup  `json:"cleanup,omitempty"`
+}
+
+//
+// IndexMoveStatus is the state of the movement of one index instance, or
+// of some partitions of it, described by a transfer token.  The index is
+// rebuilt on the destination node, so Progress is the progress of the
+// build, in percent.  ETA is estimated from the rate of the build since it
+// is first seen, and is 0 if unknown.
+//
+type IndexMoveStatus struct {
+	TransferTokenId string          `json:"transferTokenId"`
+	Bucket          string          `json:"bucket"`
+	Scope           string          `json:"scope"`
+	Collection      string          `json:"collection"`
+	Index           string          `json:"index"`
+	DefnId          c.IndexDefnId   `json:"defnId"`
+	InstId          c.IndexInstId   `json:"instId"`
+	RealInstId      c.IndexInstId   `json:"realInstId,omitempty"`
+	Partitions      []c.PartitionId `json:"partitions,omitempty"`
+	SourceId        string          `json:"sourceId"`
+	DestId          string          `json:"destId"`
+	Phase           string          `json:"phase"`
+	Progress        float64         `json:"progress"`
+	Elapsed         time.Duration   `json:"elapsed"`
+	ETA             time.Duration   `json:"eta"`
+	Error           string          `json:"error,omitempty"`
+}
+
+func (r *Rebalancer) getRebalanceStatus() *RebalanceStatus {
+
+	status := &RebalanceStatus{
+		Running:   !r.isFinish(),
+		Master:    r.master,
+		Paused:    r.isPaused(),
+		ByState:   make(map[string]int),
+		Movements: make([]*IndexMoveStatus, 0),
+	}
+	if r.rebalToken != nil {
+		status.RebalanceId = r.rebalToken.RebalId
+	}
+
+	r.mu.RLock()
+	tokens := make(map[string]c.TransferToken)
+	if r.master {
+		for ttid, tt := range r.transferTokens {
+			tokens[ttid] = *tt
+		}
+	} else {
+		for ttid, tt := range r.sourceTokens {
+			tokens[ttid] = *tt
+		}
+		for ttid, tt := range r.acceptedTokens {
+			tokens[ttid] = *tt
+		}
+	}
+	r.mu.RUnlock()
+
+	r.progressMu.Lock()
+	defer r.progressMu.Unlock()
+
+	now := time.Now()
+	var totalProgress float64
+	for ttid, tt := range tokens {
+		defn := tt.IndexInst.Defn
+		move := &IndexMoveStatus{
+			TransferTokenId: ttid,
+			Bucket:          defn.Bucket,
+			Scope:           defn.Scope,
+			Collection:      defn.Collection,
+			Index:           defn.Name,
+			DefnId:          defn.DefnId,
+			InstId:          tt.InstId,
+			RealInstId:      tt.RealInstId,
+			Partitions:      defn.Partitions,
+			SourceId:        tt.SourceId,
+			DestId:          tt.DestId,
+			Phase:           tt.State.String(),
+			Error:           tt.Error,
+		}
+
+		if tt.State == c.TransferTokenCommit || tt.State == c.TransferTokenDeleted {
+			move.Progress = 100.0
+		} else if progress, ok := r.lastKnownProgress[tt.InstId]; ok {
+			move.Progress = progress
+			if start, ok := r.progressStart[tt.InstId]; ok {
+				move.Elapsed = now.Sub(start.at)
+				if done := progress - start.progress; done > 0 && progress < 100.0 {
+					move.ETA = time.Duration(float64(move.Elapsed) * (100.0 - progress) / done)
+				}
+			}
+		}
+
+		totalProgress += move.Progress
+		status.ByState[move.Phase]++
+		status.Movements = append(status.Movements, move)
+	}
+
+	if len(status.Movements) != 0 {
+		status.Progress = totalProgress / float64(len(status.Movements))
+	}
+
+	sort.Slice(status.Movements, func(i, j int) bool {
+		return status.Movements[i].TransferTokenId < status.Movements[j].TransferTokenId
+	})
+
+	return status
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// Bytes received by a stream worker between two rebalance throttling checks
+const REBALANCE_THROTTLE_BATCHSIZE = 64 * 1024
+
+//
+// rebalanceThrottle limits the rate at which a node receives the data of
+// the indexes it builds during rebalance, so that rebalance does not
+// degrade scan latency.  Indexes are rebuilt from INIT_STREAM on the
+// destination node, so the throttle applies to the keys of INIT_STREAM
+// for the index instances built by rebalance.  Builds started before
+// rebalance share INIT_STREAM, but are not throttled.  Stream workers
+// sleep once the node is over its rate, which holds back the projectors.
+// The rate is read from settings.rebalance.transfer_rate_limit (MB/s) and
+// 0 means unlimited.
+//
+type rebalanceThrottle struct {
+	active int32
+	rate   int64 // bytes/sec
+
+	// instances built by rebalance, map[c.IndexInstId]bool
+	insts atomic.Value
+
+	mu sync.Mutex
+	// time until which the budget of the node is used up
+	until time.Time
+}
+
+var gRebalanceThrottle = &rebalanceThrottle{}
+
+func (t *rebalanceThrottle) setActive(active bool) {
+
+	if active {
+		atomic.StoreInt32(&t.active, 1)
+	} else {
+		atomic.StoreInt32(&t.active, 0)
+		t.insts.Store(make(map[c.IndexInstId]bool))
+	}
+}
+
+func (t *rebalanceThrottle) isActive() bool {
+
+	return atomic.LoadInt32(&t.active) == 1 && len(t.getInsts()) != 0
+}
+
+//
+// addInsts adds the index instances whose build is owned by rebalance.
+// Instances are removed once rebalance is done.
+//
+func (t *rebalanceThrottle) addInsts(instIds []c.IndexInstId) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	insts := make(map[c.IndexInstId]bool)
+	for instId := range t.getInsts() {
+		insts[instId] = true
+	}
+	for _, instId := range instIds {
+		insts[instId] = true
+	}
+	t.insts.Store(insts)
+}
+
+func (t *rebalanceThrottle) getInsts() map[c.IndexInstId]bool {
+
+	insts, _ := t.insts.Load().(map[c.IndexInstId]bool)
+	return insts
+}
+
+//
+// isThrottled returns true if the index instance is built by rebalance.
+//
+func (t *rebalanceThrottle) isThrottled(instId c.IndexInstId) bool {
+
+	return t.getInsts()[instId]
+}
+
+func (t *rebalanceThrottle) updateConfig(config c.Config) {
+
+	rate := int64(config["settings.rebalance.transfer_rate_limit"].Int()) * 1024 * 1024
+	if rate < 0 {
+		logging.Errorf("rebalanceThrottle: invalid setting value for transfer_rate_limit=%v", rate)
+		rate = 0
+	}
+
+	if old := atomic.SwapInt64(&t.rate, rate); old != rate {
+		logging.Infof("rebalanceThrottle: transfer rate limit %v bytes/sec", rate)
+	}
+}
+
+//
+// throttle accounts bytes received for rebalance, and sleeps as long as
+// the node is over its rate.  Unused budget is kept for at most a second,
+// to allow for short bursts.  It returns the time spent sleeping.
+//
+func (t *rebalanceThrottle) throttle(bytes int) time.Duration {
+
+	rate := atomic.LoadInt64(&t.rate)
+	if rate <= 0 || bytes <= 0 {
+		return 0
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	if t.until.Before(now.Add(-time.Second)) {
+		t.until = now.Add(-time.Second)
+	}
+	t.until = t.until.Add(time.Duration(int64(bytes) * int64(time.Second) / rate))
+	wait := t.until.Sub(now)
+	t.mu.Unlock()
+
+	if wait <= 0 {
+		return 0
+	}
+
+	time.Sleep(wait)
+	return wait
+}
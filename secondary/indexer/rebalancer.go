@@ -18,8 +18,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -84,12 +86,15 @@ type Rebalancer struct {
 	config c.ConfigHolder
 
 	lastKnownProgress map[c.IndexInstId]float64
+	progressStart     map[c.IndexInstId]progressSample // build progress when first seen
+	progressMu        sync.Mutex
 
 	change     *service.TopologyChange
 	runPlanner bool
 
 	transferTokenBatches [][]string
 	currBatchTokens      []string
+	paused               int32
 
 	runParam *runParams
 }
@@ -125,6 +130,7 @@ func NewRebalancer(transferTokens map[string]*c.TransferToken, rebalToken *Rebal
 
 		waitForTokenPublish: make(chan struct{}),
 		lastKnownProgress:   make(map[c.IndexInstId]float64),
+		progressStart:       make(map[c.IndexInstId]progressSample),
 
 		change:     change,
 		runPlanner: runPlanner,
@@ -211,6 +217,7 @@ func (r *Rebalancer) initRebalAsync() {
 					if len(r.transferTokens) == 0 {
 						r.transferTokens = nil
 					}
+					setTokenBuildSource(r.transferTokens, cfg["rebalance.copy_snapshot"].Bool())
 					elapsed := time.Since(start)
 					l.Infof("Rebalancer::initRebalAsync Planner Time Taken %v", elapsed)
 					break loop
@@ -224,6 +231,24 @@ func (r *Rebalancer) initRebalAsync() {
 	go r.doRebalance()
 }
 
+//
+// setTokenBuildSource marks the tokens of the memory optimized indexes which
+// are moved to be built from a snapshot copied from the source node.
+//
+func setTokenBuildSource(tokens map[string]*c.TransferToken, copySnapshot bool) {
+
+	if !copySnapshot {
+		return
+	}
+
+	for _, tt := range tokens {
+		if tt.SourceId != "" && tt.TransferMode == c.TokenTransferModeMove &&
+			c.IndexTypeToStorageMode(tt.IndexInst.Defn.Using) == c.MOI {
+			tt.BuildSource = c.TokenBuildSourcePeer
+		}
+	}
+}
+
 func (r *Rebalancer) Cancel() {
 	l.Infof("Rebalancer::Cancel Exiting")
 
@@ -333,6 +358,9 @@ func (r *Rebalancer) createTransferBatches() {
 	cfg := r.config.Load()
 	batchSize := cfg["rebalance.transferBatchSize"].Int()
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	var batch []string
 	for ttid, _ := range r.transferTokens {
 		if batch == nil {
@@ -353,11 +381,32 @@ func (r *Rebalancer) createTransferBatches() {
 	l.Infof("Rebalancer::createTransferBatches Transfer Batches %v", r.transferTokenBatches)
 }
 
+func (r *Rebalancer) maxConcurrentMovers() int {
+
+	cfg := r.config.Load()
+	return cfg["settings.rebalance.max_concurrent_movers"].Int()
+}
+
 func (r *Rebalancer) publishTransferTokenBatch() {
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.isPaused() {
+		l.Infof("Rebalancer::publishTransferTokenBatch Rebalance is paused. Holding %v batches.",
+			len(r.transferTokenBatches))
+		return
+	}
+
+	if movers := r.maxConcurrentMovers(); movers > 0 {
+		r.publishTransferTokensLOCKED(movers)
+		return
+	}
+
+	if len(r.transferTokenBatches) == 0 || !r.checkCurrBatchDoneLOCKED() {
+		return
+	}
+
 	r.currBatchTokens = r.transferTokenBatches[0]
 	r.transferTokenBatches = r.transferTokenBatches[1:]
 
@@ -369,6 +418,45 @@ func (r *Rebalancer) publishTransferTokenBatch() {
 
 }
 
+//
+// publishTransferTokensLOCKED publishes pending transfer tokens such that
+// at most movers tokens are in progress for each destination node.  It is
+// called again whenever a token is done.
+//
+func (r *Rebalancer) publishTransferTokensLOCKED(movers int) {
+
+	inProgress := make(map[string]int)
+	var published []string
+	for _, ttid := range r.currBatchTokens {
+		if tt := r.transferTokens[ttid]; tt.State != c.TransferTokenDeleted {
+			inProgress[tt.DestId]++
+			published = append(published, ttid)
+		}
+	}
+
+	var pending []string
+	for _, batch := range r.transferTokenBatches {
+		for _, ttid := range batch {
+			tt := r.transferTokens[ttid]
+			if inProgress[tt.DestId] >= movers {
+				pending = append(pending, ttid)
+				continue
+			}
+
+			inProgress[tt.DestId]++
+			published = append(published, ttid)
+			setTransferTokenInMetakv(ttid, tt)
+			l.Infof("Rebalancer::publishTransferTokens Registered Transfer Token In Metakv %v", ttid)
+		}
+	}
+
+	r.currBatchTokens = published
+	r.transferTokenBatches = r.transferTokenBatches[:0]
+	if len(pending) != 0 {
+		r.transferTokenBatches = append(r.transferTokenBatches, pending)
+	}
+}
+
 func (r *Rebalancer) observeRebalance() {
 
 	l.Infof("Rebalancer::observeRebalance %v master:%v", r.rebalToken, r.master)
@@ -882,6 +970,8 @@ func (r *Rebalancer) buildAcceptedIndexes() {
 	defer r.wg.Done()
 
 	var idList client.IndexIdList
+	var instIds []c.IndexInstId
+	var peerTokens []c.TransferToken
 	var errStr string
 	r.mu.Lock()
 	for _, tt := range r.acceptedTokens {
@@ -889,15 +979,31 @@ func (r *Rebalancer) buildAcceptedIndexes() {
 			tt.State != c.TransferTokenCommit &&
 			tt.State != c.TransferTokenMerge {
 			idList.DefnIds = append(idList.DefnIds, uint64(tt.IndexInst.Defn.DefnId))
+			instIds = append(instIds, tt.InstId)
+			if tt.BuildSource == c.TokenBuildSourcePeer {
+				peerTokens = append(peerTokens, tt.Clone())
+			}
 		}
 	}
 	r.mu.Unlock()
 
+	// throttle only the builds of rebalance
+	gRebalanceThrottle.addInsts(instIds)
+
 	if len(idList.DefnIds) == 0 {
 		l.Infof("Rebalancer::buildAcceptedIndexes Nothing to build")
 		return
 	}
 
+	// The build catches up from the copied snapshots only if all the
+	// indexes have one, otherwise the indexes are built from scratch.
+	for _, tt := range peerTokens {
+		if err := r.copySnapshot(&tt); err != nil {
+			l.Warnf("Rebalancer::buildAcceptedIndexes Error copying snapshot of %v from %v. "+
+				"Index is built from scratch. %v", tt.InstId, tt.SourceId, err)
+		}
+	}
+
 	response := new(manager.IndexResponse)
 	url := "/buildIndex"
 
@@ -937,6 +1043,46 @@ cleanup:
 
 }
 
+//
+// copySnapshot copies the latest disk snapshot of every partition of the
+// index moved by the token from the source node, and loads it into the new
+// instance, which the build then catches up from.
+//
+func (r *Rebalancer) copySnapshot(tt *c.TransferToken) error {
+
+	srcInstId := tt.InstId
+	if tt.RealInstId != 0 {
+		srcInstId = tt.RealInstId
+	}
+
+	for _, partnId := range tt.IndexInst.Defn.Partitions {
+
+		params := url.Values{}
+		params.Set("instId", fmt.Sprintf("%v", tt.InstId))
+		params.Set("partnId", fmt.Sprintf("%v", partnId))
+		params.Set("peer", tt.SourceId)
+		params.Set("peerInstId", fmt.Sprintf("%v", srcInstId))
+		params.Set("load", "true")
+
+		resp, err := postWithAuth(r.localaddr+"/importSnapshot", "application/x-www-form-urlencoded",
+			strings.NewReader(params.Encode()))
+		if err != nil {
+			return err
+		}
+
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("Partn %v: %v %s", partnId, resp.Status, msg)
+		}
+
+		l.Infof("Rebalancer::copySnapshot Loaded snapshot of Inst %v Partn %v from %v Inst %v",
+			tt.InstId, partnId, tt.SourceId, srcInstId)
+	}
+
+	return nil
+}
+
 func (r *Rebalancer) waitForIndexBuild() {
 
 	allTokensReady := true
@@ -1214,7 +1360,7 @@ func (r *Rebalancer) processTokenAsMaster(ttid string, tt *c.TransferToken) bool
 			r.cancelMetakv()
 			go r.finish(nil)
 		} else {
-			if r.checkCurrBatchDone() {
+			if r.checkCurrBatchDone() || r.maxConcurrentMovers() > 0 {
 				r.publishTransferTokenBatch()
 			}
 		}
@@ -1376,6 +1522,11 @@ func (r *Rebalancer) checkCurrBatchDone() bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	return r.checkCurrBatchDoneLOCKED()
+}
+
+func (r *Rebalancer) checkCurrBatchDoneLOCKED() bool {
+
 	for _, ttid := range r.currBatchTokens {
 		tt := r.transferTokens[ttid]
 		if tt.State != c.TransferTokenDeleted {
@@ -1446,7 +1597,9 @@ func (r *Rebalancer) getBuildProgressFromStatus(status *manager.IndexStatusRespo
 				// The index may have not be in REAL_PENDING state but the token has not yet moved to COMMITTED/DELETED state.
 				// So we need to return progress even if it is not replicating.
 				if idx.Status == "Replicating" || idx.NodeUUID == destId {
+					r.progressMu.Lock()
 					progress, ok := r.lastKnownProgress[id]
+					r.progressMu.Unlock()
 					if !ok || idx.Progress > 0 {
 						progress = idx.Progress
 					}
@@ -1474,8 +1627,14 @@ func (r *Rebalancer) getBuildProgressFromStatus(status *manager.IndexStatusRespo
 		updateProgress(realInstId)
 	}
 
+	r.progressMu.Lock()
+	defer r.progressMu.Unlock()
+
 	if count > 0 {
 		r.lastKnownProgress[instId] = realInstProgress / float64(count)
+		if _, ok := r.progressStart[instId]; !ok {
+			r.progressStart[instId] = progressSample{at: time.Now(), progress: r.lastKnownProgress[instId]}
+		}
 	}
 
 	if p, ok := r.lastKnownProgress[instId]; ok {
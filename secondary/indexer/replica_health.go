@@ -0,0 +1,140 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/manager/client"
+	"github.com/couchbase/indexing/secondary/planner"
+)
+
+//
+// ReplicaHealth reports the replica placement of an index.  NumReplica is
+// the replica count of the index, and ActualReplica is the number of
+// replicas hosted by the indexers.  Violations lists the replicas placed on
+// the same node, or in the same server group while another server group has
+// no replica.  RepairNodes are the nodes which would be used to rebuild the
+// lost replicas.
+//
+type ReplicaHealth struct {
+	DefnId         common.IndexDefnId `json:"defnId"`
+	Bucket         string             `json:"bucket"`
+	Scope          string             `json:"scope"`
+	Collection     string             `json:"collection"`
+	Name           string             `json:"name"`
+	NumReplica     int                `json:"numReplica"`
+	ActualReplica  int                `json:"actualReplica"`
+	ReplicaCountOk bool               `json:"replicaCountOk"`
+	ServerGroupOk  bool               `json:"serverGroupOk"`
+	Violations     []string           `json:"violations,omitempty"`
+	RepairNodes    []string           `json:"repairNodes,omitempty"`
+	Error          string             `json:"error,omitempty"`
+}
+
+//
+// handleReplicaHealth reports the replica placement of all the indexes,
+// i.e. if an index has as many replicas as its replica count, if its
+// replicas honor the server groups, and the nodes that replica repair would
+// use for the lost replicas.
+//
+func (m *DDLServiceMgr) handleReplicaHealth(w http.ResponseWriter, r *http.Request) {
+
+	if !m.validateAuth(w, r) {
+		logging.Errorf("DDLServiceMgr::handleReplicaHealth Validation Failure for Request %v", logging.TagUD(r))
+		return
+	}
+
+	if r.Method != "GET" {
+		send(http.StatusBadRequest, w, "Unsupported Method")
+		return
+	}
+
+	provider, _, err := newMetadataProvider(m.clusterAddr, nil, m.settings, "DDLServiceMgr")
+	if err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+	defer provider.Close()
+
+	// the index layout is read once for all the indexes
+	plan, err := planner.RetrievePlanFromCluster(m.clusterAddr, nil)
+	if err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+	violations := planner.FindReplicaViolations(plan)
+
+	// the lost replicas of all the indexes are planned once, on first use
+	var repairNodes map[common.IndexDefnId][]string
+	var repairErr error
+	findRepairNodes := func(defnId common.IndexDefnId) ([]string, error) {
+		if repairNodes == nil && repairErr == nil {
+			repairNodes, repairErr = planner.FindReplicaRepairNodes(plan)
+		}
+		return repairNodes[defnId], repairErr
+	}
+
+	indexes, _ := provider.ListIndex()
+
+	result := make([]*ReplicaHealth, 0, len(indexes))
+	for _, meta := range indexes {
+		if meta.Definition == nil {
+			continue
+		}
+
+		defn := meta.Definition
+		health := &ReplicaHealth{
+			DefnId:        defn.DefnId,
+			Bucket:        defn.Bucket,
+			Scope:         defn.Scope,
+			Collection:    defn.Collection,
+			Name:          defn.Name,
+			NumReplica:    defn.GetNumReplica(),
+			ActualReplica: numHostedReplicas(meta) - 1,
+			Violations:    violations[defn.DefnId],
+		}
+		health.ReplicaCountOk = health.ActualReplica == health.NumReplica
+		health.ServerGroupOk = len(health.Violations) == 0
+
+		// Replica repair does not rebuild the replicas of partitioned index
+		if health.ActualReplica < health.NumReplica && !common.IsPartitioned(defn.PartitionScheme) {
+			health.RepairNodes, err = findRepairNodes(defn.DefnId)
+			if err != nil {
+				health.Error = err.Error()
+			}
+		}
+
+		result = append(result, health)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DefnId < result[j].DefnId
+	})
+
+	send(http.StatusOK, w, result)
+}
+
+// numHostedReplicas returns the number of replicas, including the
+// original copy, which have an instance on the indexers
+func numHostedReplicas(meta *client.IndexMetadata) int {
+
+	replicas := make(map[uint64]bool)
+	for _, inst := range meta.Instances {
+		if inst.State != common.INDEX_STATE_NIL && inst.State != common.INDEX_STATE_DELETED {
+			replicas[inst.ReplicaId] = true
+		}
+	}
+
+	return len(replicas)
+}
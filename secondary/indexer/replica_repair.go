@@ -0,0 +1,497 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/manager/client"
+)
+
+var REPLICA_REPAIR_CHECK_INTERVAL = 10 // Seconds
+
+// lost replicas waiting for the replica repair window, by the time they
+// are first found.  It is only kept on the replica repair node.
+var gRepairQueue = make(map[common.IndexDefnId]time.Time)
+var gRepairQueueLck sync.Mutex
+
+//
+// LostReplica is an index which has lost some of its replicas, e.g.
+// after an indexer node is failed over.
+//
+type LostReplica struct {
+	DefnId     common.IndexDefnId `json:"defnId"`
+	Bucket     string             `json:"bucket"`
+	Scope      string             `json:"scope"`
+	Collection string             `json:"collection"`
+	Name       string             `json:"name"`
+	NumReplica int                `json:"numReplica"`
+	Lost       int                `json:"lost"`
+	Error      string             `json:"error,omitempty"`
+}
+
+//
+// ReplicaRepairQueue is the response of /replicaRepairQueue.  Queued has
+// the lost replicas waiting for the next replica repair window.
+//
+type ReplicaRepairQueue struct {
+	Window     string           `json:"window"`
+	InWindow   bool             `json:"inWindow"`
+	NextWindow *time.Time       `json:"nextWindow,omitempty"`
+	Queued     []*QueuedReplica `json:"queued"`
+}
+
+type QueuedReplica struct {
+	*LostReplica
+	QueuedAt *time.Time `json:"queuedAt,omitempty"`
+}
+
+//
+// repairWindow is a daily maintenance window, from start to end since the
+// midnight in the local time.  A window ending before its start spans the
+// midnight.
+//
+type repairWindow struct {
+	start time.Duration
+	end   time.Duration
+}
+
+//
+// processReplicaRepair periodically looks for the replicas lost by the
+// indexes, and rebuilds them on the other indexer nodes, so that the
+// indexes keep the replica count they are created with.  It is run by a
+// single indexer node in the cluster, the maintenance node.  If
+// settings.replica_repair.require_confirmation is set, the lost replicas
+// are only reported, and they are rebuilt once the repair is confirmed
+// with /repairLostReplicas.  If
+// settings.replica_repair.window is set, the lost replicas are queued, and
+// they are only rebuilt inside the maintenance windows.
+//
+func (m *DDLServiceMgr) processReplicaRepair() {
+
+	ticker := time.NewTicker(time.Duration(REPLICA_REPAIR_CHECK_INTERVAL) * time.Second)
+	defer ticker.Stop()
+
+	var lastCheck time.Time
+
+	for {
+		select {
+		case <-ticker.C:
+			config := m.config.Load()
+			if !config["settings.replica_repair.enable"].Bool() {
+				continue
+			}
+
+			interval := time.Duration(config["settings.replica_repair.interval"].Int()) * time.Second
+			if time.Since(lastCheck) < interval {
+				continue
+			}
+			lastCheck = time.Now()
+
+			if !m.canProcessDDL() {
+				logging.Debugf("DDLServiceMgr: cannot repair replica during rebalancing")
+				continue
+			}
+
+			if !m.isMaintenanceNode() {
+				continue
+			}
+
+			windows, err := parseRepairWindows(config["settings.replica_repair.window"].String())
+			if err != nil {
+				logging.Errorf("DDLServiceMgr: Invalid replica repair window.  Error = %v", err)
+				continue
+			}
+
+			m.handleReplicaRepair(config["settings.replica_repair.require_confirmation"].Bool(),
+				inRepairWindow(windows, time.Now()))
+
+		case <-m.killch:
+			logging.Infof("DDLServiceMgr: Stop replica repair")
+			return
+		}
+	}
+}
+
+//
+// isMaintenanceNode returns true if this node runs the cluster wide
+// maintenance tasks, i.e. replica repair and idle index check.  It is the
+// active indexer node with the lowest node uuid.
+//
+func (m *DDLServiceMgr) isMaintenanceNode() bool {
+
+	cinfo, err := common.FetchNewClusterInfoCache(m.clusterAddr, common.DEFAULT_POOL, "DDLServiceMgr")
+	if err != nil {
+		logging.Errorf("DDLServiceMgr: Failed to fetch cluster info for replica repair.  Error = %v", err)
+		return false
+	}
+
+	repairNode := ""
+	for _, node := range cinfo.GetActiveIndexerNodes() {
+		if repairNode == "" || node.NodeUUID < repairNode {
+			repairNode = node.NodeUUID
+		}
+	}
+
+	return repairNode == string(m.nodeID)
+}
+
+func (m *DDLServiceMgr) handleReplicaRepair(requireConfirm bool, inWindow bool) {
+
+	provider, _, err := newMetadataProvider(m.clusterAddr, nil, m.settings, "DDLServiceMgr")
+	if err != nil {
+		logging.Errorf("DDLServiceMgr: Failed to start metadata provider for replica repair.  Internal Error = %v", err)
+		return
+	}
+	defer provider.Close()
+
+	lostReplicas := findLostReplicas(provider)
+	repaired := make([]*LostReplica, 0, len(lostReplicas))
+
+	gRepairQueueLck.Lock()
+
+	queue := make(map[common.IndexDefnId]time.Time)
+	for _, lost := range lostReplicas {
+
+		if requireConfirm {
+			logging.Warnf("DDLServiceMgr: Index (%v, %v, %v, %v) has lost %v replica.  Waiting for confirmation to repair.",
+				lost.Bucket, lost.Scope, lost.Collection, lost.Name, lost.Lost)
+			continue
+		}
+
+		if !inWindow {
+			queuedAt, ok := gRepairQueue[lost.DefnId]
+			if !ok {
+				queuedAt = time.Now()
+				logging.Infof("DDLServiceMgr: Index (%v, %v, %v, %v) has lost %v replica.  Queued for replica repair window.",
+					lost.Bucket, lost.Scope, lost.Collection, lost.Name, lost.Lost)
+			}
+			queue[lost.DefnId] = queuedAt
+			continue
+		}
+
+		repaired = append(repaired, lost)
+	}
+
+	gRepairQueue = queue
+	gRepairQueueLck.Unlock()
+
+	for _, lost := range repaired {
+		repairLostReplica(provider, lost)
+	}
+}
+
+//
+// parseRepairWindows parses a comma separated list of daily maintenance
+// windows, e.g. "01:00-05:00,22:30-23:30", in the local time of the node.
+// There is no window if spec is empty.
+//
+func parseRepairWindows(spec string) ([]repairWindow, error) {
+
+	parseTime := func(str string) (time.Duration, error) {
+		t, err := time.Parse("15:04", strings.TrimSpace(str))
+		if err != nil {
+			return 0, fmt.Errorf("Invalid time %q in replica repair window", str)
+		}
+		return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+	}
+
+	var windows []repairWindow
+	for _, str := range strings.Split(spec, ",") {
+		if strings.TrimSpace(str) == "" {
+			continue
+		}
+
+		times := strings.Split(str, "-")
+		if len(times) != 2 {
+			return nil, fmt.Errorf("Invalid replica repair window %q", str)
+		}
+
+		start, err := parseTime(times[0])
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := parseTime(times[1])
+		if err != nil {
+			return nil, err
+		}
+
+		windows = append(windows, repairWindow{start: start, end: end})
+	}
+
+	return windows, nil
+}
+
+// inRepairWindow returns true if now is in one of the windows, or if there is no window
+func inRepairWindow(windows []repairWindow, now time.Time) bool {
+
+	if len(windows) == 0 {
+		return true
+	}
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	since := now.Sub(midnight)
+
+	for _, window := range windows {
+		if window.start <= window.end {
+			if since >= window.start && since < window.end {
+				return true
+			}
+		} else if since >= window.start || since < window.end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nextRepairWindow returns the start of the next window after now
+func nextRepairWindow(windows []repairWindow, now time.Time) *time.Time {
+
+	var next *time.Time
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for _, window := range windows {
+		start := midnight.Add(window.start)
+		if !start.After(now) {
+			start = start.AddDate(0, 0, 1)
+		}
+
+		if next == nil || start.Before(*next) {
+			next = &start
+		}
+	}
+
+	return next
+}
+
+func findLostReplicas(provider *client.MetadataProvider) []*LostReplica {
+
+	result := make([]*LostReplica, 0)
+	for defnId, lost := range provider.FindLostReplicas() {
+
+		meta := provider.FindIndexIgnoreStatus(defnId)
+		if meta == nil || meta.Definition == nil {
+			continue
+		}
+
+		defn := meta.Definition
+		result = append(result, &LostReplica{
+			DefnId:     defnId,
+			Bucket:     defn.Bucket,
+			Scope:      defn.Scope,
+			Collection: defn.Collection,
+			Name:       defn.Name,
+			NumReplica: defn.GetNumReplica(),
+			Lost:       lost,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DefnId < result[j].DefnId
+	})
+
+	return result
+}
+
+func repairLostReplica(provider *client.MetadataProvider, lost *LostReplica) {
+
+	logging.Infof("DDLServiceMgr: Repair %v lost replica for index (%v, %v, %v, %v)",
+		lost.Lost, lost.Bucket, lost.Scope, lost.Collection, lost.Name)
+
+	count, err := provider.RepairLostReplicas(lost.DefnId)
+	if err != nil {
+		logging.Errorf("DDLServiceMgr: Failed to repair replica for index (%v, %v, %v, %v).  Error = %v",
+			lost.Bucket, lost.Scope, lost.Collection, lost.Name, err)
+		lost.Error = err.Error()
+		return
+	}
+
+	logging.Infof("DDLServiceMgr: Rebuilding %v replica for index (%v, %v, %v, %v)",
+		count, lost.Bucket, lost.Scope, lost.Collection, lost.Name)
+}
+
+//
+// handleListLostReplicas lists the indexes which have lost some of
+// their replicas.
+//
+func (m *DDLServiceMgr) handleListLostReplicas(w http.ResponseWriter, r *http.Request) {
+
+	if !m.validateAuth(w, r) {
+		logging.Errorf("DDLServiceMgr::handleListLostReplicas Validation Failure for Request %v", logging.TagUD(r))
+		return
+	}
+
+	if r.Method != "GET" {
+		send(http.StatusBadRequest, w, "Unsupported Method")
+		return
+	}
+
+	provider, _, err := newMetadataProvider(m.clusterAddr, nil, m.settings, "DDLServiceMgr")
+	if err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+	defer provider.Close()
+
+	buf, err := json.Marshal(findLostReplicas(provider))
+	if err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf)
+}
+
+//
+// handleReplicaRepairQueue lists the lost replicas waiting for the replica
+// repair window.  The time a lost replica is queued is only known by the
+// replica repair node.
+//
+func (m *DDLServiceMgr) handleReplicaRepairQueue(w http.ResponseWriter, r *http.Request) {
+
+	if !m.validateAuth(w, r) {
+		logging.Errorf("DDLServiceMgr::handleReplicaRepairQueue Validation Failure for Request %v", logging.TagUD(r))
+		return
+	}
+
+	if r.Method != "GET" {
+		send(http.StatusBadRequest, w, "Unsupported Method")
+		return
+	}
+
+	config := m.config.Load()
+	spec := config["settings.replica_repair.window"].String()
+	windows, err := parseRepairWindows(spec)
+	if err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+
+	now := time.Now()
+	queue := &ReplicaRepairQueue{
+		Window:   spec,
+		InWindow: inRepairWindow(windows, now),
+		Queued:   make([]*QueuedReplica, 0),
+	}
+	if !queue.InWindow {
+		queue.NextWindow = nextRepairWindow(windows, now)
+	}
+
+	provider, _, err := newMetadataProvider(m.clusterAddr, nil, m.settings, "DDLServiceMgr")
+	if err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+	defer provider.Close()
+
+	lostReplicas := findLostReplicas(provider)
+
+	gRepairQueueLck.Lock()
+	defer gRepairQueueLck.Unlock()
+
+	for _, lost := range lostReplicas {
+		queued := &QueuedReplica{LostReplica: lost}
+		if queuedAt, ok := gRepairQueue[lost.DefnId]; ok {
+			queued.QueuedAt = &queuedAt
+		}
+		queue.Queued = append(queue.Queued, queued)
+	}
+
+	send(http.StatusOK, w, queue)
+}
+
+//
+// handleRepairLostReplicas rebuilds the lost replicas of the index given
+// by the defnId parameter, or of all the indexes if defnId is not given.
+// It is used to confirm the repair when replica repair requires
+// confirmation, or to repair the replicas when replica repair is not
+// enabled.  Repairing a single index requires the permission to create
+// indexes on its collection, and repairing all of them requires the
+// permission to write cluster settings.
+//
+func (m *DDLServiceMgr) handleRepairLostReplicas(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := m.validateAuthCreds(w, r)
+	if !ok {
+		logging.Errorf("DDLServiceMgr::handleRepairLostReplicas Validation Failure for Request %v", logging.TagUD(r))
+		return
+	}
+
+	if r.Method != "POST" {
+		send(http.StatusBadRequest, w, "Unsupported Method")
+		return
+	}
+
+	var defnId common.IndexDefnId
+	if r.FormValue("defnId") != "" {
+		id, err := strconv.ParseUint(r.FormValue("defnId"), 10, 64)
+		if err != nil {
+			send(http.StatusBadRequest, w, fmt.Sprintf("Invalid defnId %q", r.FormValue("defnId")))
+			return
+		}
+		defnId = common.IndexDefnId(id)
+	}
+
+	if !m.canProcessDDL() {
+		send(http.StatusServiceUnavailable, w, "Cannot repair replica during rebalancing")
+		return
+	}
+
+	provider, _, err := newMetadataProvider(m.clusterAddr, nil, m.settings, "DDLServiceMgr")
+	if err != nil {
+		send(http.StatusInternalServerError, w, err.Error())
+		return
+	}
+	defer provider.Close()
+
+	permission, repaired := repairPermission(defnId, findLostReplicas(provider))
+	if !common.IsAllowed(creds, []string{permission}, w) {
+		return
+	}
+
+	for _, lost := range repaired {
+		repairLostReplica(provider, lost)
+	}
+
+	send(http.StatusOK, w, repaired)
+}
+
+//
+// repairPermission returns the permission required to repair the lost
+// replicas of the index defnId, or of all the indexes if defnId is 0,
+// and the lost replicas to repair.
+//
+func repairPermission(defnId common.IndexDefnId, lost []*LostReplica) (string, []*LostReplica) {
+
+	if defnId == 0 {
+		return "cluster.settings!write", lost
+	}
+
+	for _, l := range lost {
+		if l.DefnId == defnId {
+			return fmt.Sprintf("cluster.collection[%s:%s:%s].n1ql.index!create",
+				l.Bucket, l.Scope, l.Collection), []*LostReplica{l}
+		}
+	}
+
+	return "cluster.settings!write", make([]*LostReplica, 0)
+}
@@ -0,0 +1,134 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestRepairPermission(t *testing.T) {
+	lost := []*LostReplica{
+		{DefnId: 1, Bucket: "b1", Scope: "s1", Collection: "c1", Name: "idx1"},
+		{DefnId: 2, Bucket: "b2", Scope: "_default", Collection: "_default", Name: "idx2"},
+	}
+
+	permission, repaired := repairPermission(0, lost)
+	if permission != "cluster.settings!write" || len(repaired) != 2 {
+		t.Fatalf("all: unexpected permission %v repaired %v", permission, repaired)
+	}
+
+	permission, repaired = repairPermission(2, lost)
+	if permission != "cluster.collection[b2:_default:_default].n1ql.index!create" {
+		t.Fatalf("unexpected permission %v", permission)
+	}
+	if len(repaired) != 1 || repaired[0].DefnId != 2 {
+		t.Fatalf("unexpected repaired %v", repaired)
+	}
+
+	// unknown index needs the cluster permission, and repairs nothing
+	permission, repaired = repairPermission(common.IndexDefnId(3), lost)
+	if permission != "cluster.settings!write" || repaired == nil || len(repaired) != 0 {
+		t.Fatalf("unknown: unexpected permission %v repaired %v", permission, repaired)
+	}
+}
+
+func TestParseRepairWindows(t *testing.T) {
+
+	windows, err := parseRepairWindows(" 01:00-05:00, 22:30 - 23:30,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []repairWindow{
+		{start: time.Hour, end: 5 * time.Hour},
+		{start: 22*time.Hour + 30*time.Minute, end: 23*time.Hour + 30*time.Minute},
+	}
+	if len(windows) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, windows)
+	}
+	for i := range expected {
+		if windows[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, windows)
+		}
+	}
+
+	if windows, err := parseRepairWindows(""); err != nil || len(windows) != 0 {
+		t.Fatalf("empty: unexpected windows %v err %v", windows, err)
+	}
+
+	for _, bad := range []string{"01:00", "01:00-02:00-03:00", "1am-2am", "25:00-01:00", "01:00-01:60"} {
+		if windows, err := parseRepairWindows(bad); err == nil {
+			t.Fatalf("%q: expected error, got %v", bad, windows)
+		}
+	}
+}
+
+func TestInRepairWindow(t *testing.T) {
+
+	at := func(hour, min int) time.Time {
+		return time.Date(2021, 3, 10, hour, min, 0, 0, time.UTC)
+	}
+
+	if !inRepairWindow(nil, at(12, 0)) {
+		t.Fatal("expected to be in window without windows")
+	}
+
+	windows, err := parseRepairWindows("01:00-05:00,23:00-02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		now      time.Time
+		inWindow bool
+	}{
+		{at(0, 30), true},
+		{at(1, 0), true},
+		{at(4, 59), true},
+		{at(5, 0), false},
+		{at(12, 0), false},
+		{at(22, 59), false},
+		{at(23, 0), true},
+		{at(23, 59), true},
+	}
+
+	for _, test := range tests {
+		if inWindow := inRepairWindow(windows, test.now); inWindow != test.inWindow {
+			t.Fatalf("%v: expected %v, got %v", test.now, test.inWindow, inWindow)
+		}
+	}
+}
+
+func TestNextRepairWindow(t *testing.T) {
+
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2021, 3, day, hour, min, 0, 0, time.UTC)
+	}
+
+	if next := nextRepairWindow(nil, at(10, 12, 0)); next != nil {
+		t.Fatalf("unexpected window %v", next)
+	}
+
+	windows, err := parseRepairWindows("01:00-05:00,22:30-23:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		now, next time.Time
+	}{
+		{at(10, 0, 0), at(10, 1, 0)},
+		{at(10, 1, 0), at(10, 22, 30)},
+		{at(10, 12, 0), at(10, 22, 30)},
+		{at(10, 22, 30), at(11, 1, 0)},
+		{at(10, 23, 45), at(11, 1, 0)},
+	}
+
+	for _, test := range tests {
+		next := nextRepairWindow(windows, test.now)
+		if next == nil || !next.Equal(test.next) {
+			t.Fatalf("%v: expected %v, got %v", test.now, test.next, next)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
+)
+
+//number of the most recent vbucket rollbacks which are kept
+const maxRollbackEvents = 1024
+
+//actions of the indexer on a rollback
+const (
+	ROLLBACK_ACTION_PENDING  = "pending"
+	ROLLBACK_ACTION_SNAPSHOT = "rollback to snapshot"
+	ROLLBACK_ACTION_ZERO     = "rollback to zero"
+	ROLLBACK_ACTION_REBUILD  = "reset indexes for rebuild"
+)
+
+//gRollbackEvents keeps the vbucket rollbacks requested by KV
+var gRollbackEvents = newRollbackEvents(maxRollbackEvents)
+
+//
+// RollbackEvent is a rollback of a vbucket requested by KV, when the
+// indexer asked for its stream from RequestedSeqno.  Action is what the
+// indexer did about it, and RestartSeqno the seqno from which the vbucket
+// has been restarted after a rollback to snapshot.
+//
+type RollbackEvent struct {
+	Time           time.Time `json:"time"`
+	StreamId       string    `json:"streamId"`
+	KeyspaceId     string    `json:"keyspaceId"`
+	Vbucket        uint32    `json:"vbucket"`
+	RequestedSeqno uint64    `json:"requestedSeqno"`
+	RollbackSeqno  uint64    `json:"rollbackSeqno"`
+	Action         string    `json:"action"`
+	RestartSeqno   uint64    `json:"restartSeqno,omitempty"`
+
+	streamId common.StreamId
+}
+
+type rollbackEvents struct {
+	mutex  sync.Mutex
+	events []*RollbackEvent
+	next   int
+
+	numVbRollbacks       int64
+	numVbRollbacksToZero int64
+	numIndexResets       int64
+}
+
+func newRollbackEvents(size int) *rollbackEvents {
+	return &rollbackEvents{
+		events: make([]*RollbackEvent, 0, size),
+	}
+}
+
+func (r *rollbackEvents) addNoLock(e *RollbackEvent) {
+	if len(r.events) < cap(r.events) {
+		r.events = append(r.events, e)
+	} else {
+		r.events[r.next] = e
+	}
+	r.next = (r.next + 1) % cap(r.events)
+}
+
+//
+// record adds an event for every vbucket of rollbackTs, which is the
+// response of KV to a stream request from requestTs.
+//
+func (r *rollbackEvents) record(streamId common.StreamId, keyspaceId string,
+	requestTs *protobuf.TsVbuuid, rollbackTs *protobuf.TsVbuuid) {
+
+	if rollbackTs == nil {
+		return
+	}
+
+	requested := make(map[uint32]uint64)
+	if requestTs != nil {
+		seqnos := requestTs.GetSeqnos()
+		for i, vbno := range requestTs.GetVbnos() {
+			requested[vbno] = seqnos[i]
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	seqnos := rollbackTs.GetSeqnos()
+	for i, vbno := range rollbackTs.GetVbnos() {
+		r.addNoLock(&RollbackEvent{
+			Time:           now,
+			StreamId:       streamId.String(),
+			KeyspaceId:     keyspaceId,
+			Vbucket:        vbno,
+			RequestedSeqno: requested[vbno],
+			RollbackSeqno:  seqnos[i],
+			Action:         ROLLBACK_ACTION_PENDING,
+			streamId:       streamId,
+		})
+
+		r.numVbRollbacks++
+		if seqnos[i] == 0 {
+			r.numVbRollbacksToZero++
+		}
+	}
+}
+
+//
+// resolve sets the action of the indexer on the pending rollbacks of the
+// keyspace of the stream.  restartTs is the timestamp from which the stream
+// is restarted, nil for a rollback to zero.
+//
+func (r *rollbackEvents) resolve(streamId common.StreamId, keyspaceId string,
+	action string, restartTs *common.TsVbuuid) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, e := range r.events {
+		if e.streamId != streamId || e.KeyspaceId != keyspaceId ||
+			e.Action != ROLLBACK_ACTION_PENDING {
+			continue
+		}
+
+		e.Action = action
+		if restartTs != nil && int(e.Vbucket) < len(restartTs.Seqnos) {
+			e.RestartSeqno = restartTs.Seqnos[e.Vbucket]
+		}
+	}
+
+	if action == ROLLBACK_ACTION_REBUILD {
+		r.numIndexResets++
+	}
+}
+
+//
+// getEvents returns the recent rollbacks, the most recent first, of the
+// keyspace if not empty.
+//
+func (r *rollbackEvents) getEvents(keyspaceId string) []RollbackEvent {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	events := make([]RollbackEvent, 0)
+	for i := 1; i <= len(r.events); i++ {
+		e := r.events[(r.next-i+len(r.events))%len(r.events)]
+		if keyspaceId == "" || e.KeyspaceId == keyspaceId {
+			events = append(events, *e)
+		}
+	}
+	return events
+}
+
+func (r *rollbackEvents) getCounts() (int64, int64, int64) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.numVbRollbacks, r.numVbRollbacksToZero, r.numIndexResets
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"sync"
+	"time"
+)
+
+// Number of rows returned by a scan between two rows/sec throttling checks
+const SCAN_THROTTLE_BATCHSIZE = 100
+
+//
+// scanAdmission enforces per-bucket limits on the number of concurrent scans
+// and on the number of rows returned per second, so that the scans of one
+// bucket cannot starve the scans of other buckets.  A scan over the
+// concurrency limit is queued until a running scan of the bucket finishes,
+// and rejected if it is not admitted within the queue timeout.  The limits
+// are read from settings.scan_admission.* and 0 means unlimited.
+//
+type scanAdmission struct {
+	mu      sync.Mutex
+	buckets map[string]*bucketAdmission
+}
+
+type bucketAdmission struct {
+	active  int
+	waiters []chan bool
+
+	// time until which the rows/sec budget of the bucket is used up
+	rowsUntil time.Time
+}
+
+func newScanAdmission() *scanAdmission {
+	return &scanAdmission{buckets: make(map[string]*bucketAdmission)}
+}
+
+func (a *scanAdmission) getBucket(bucket string) *bucketAdmission {
+	b, ok := a.buckets[bucket]
+	if !ok {
+		b = &bucketAdmission{}
+		a.buckets[bucket] = b
+	}
+	return b
+}
+
+//
+// admit blocks until a scan of the bucket can run.  It returns true if the
+// scan had to be queued, and ErrScanRejected if it could not be admitted
+// within the timeout.
+//
+func (a *scanAdmission) admit(bucket string, limit int, timeout time.Duration,
+	cancelCh <-chan bool) (bool, error) {
+
+	a.mu.Lock()
+	b := a.getBucket(bucket)
+	if limit <= 0 || b.active < limit {
+		b.active++
+		a.mu.Unlock()
+		return false, nil
+	}
+
+	if timeout <= 0 {
+		a.mu.Unlock()
+		return false, ErrScanRejected
+	}
+
+	ch := make(chan bool, 1)
+	b.waiters = append(b.waiters, ch)
+	a.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ch:
+		return true, nil
+	case <-timer.C:
+	case <-cancelCh:
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i, w := range b.waiters {
+		if w == ch {
+			b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+			return true, ErrScanRejected
+		}
+	}
+
+	// slot has been handed over while timing out
+	return true, nil
+}
+
+//
+// release hands over the slot of a finished scan to the first queued scan
+// of the bucket.
+//
+func (a *scanAdmission) release(bucket string, limit int) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	b := a.getBucket(bucket)
+	if len(b.waiters) != 0 && (limit <= 0 || b.active <= limit) {
+		ch := b.waiters[0]
+		b.waiters = b.waiters[1:]
+		ch <- true
+		return
+	}
+
+	if b.active > 0 {
+		b.active--
+	}
+}
+
+//
+// throttleRows accounts rows returned by a scan of the bucket, and sleeps
+// as long as the bucket is over its rows/sec limit.  Unused budget is kept
+// for at most a second, to allow for short bursts.  It returns the time
+// spent sleeping.
+//
+func (a *scanAdmission) throttleRows(bucket string, rows int, rowsPerSec int) time.Duration {
+
+	if rowsPerSec <= 0 || rows <= 0 {
+		return 0
+	}
+
+	a.mu.Lock()
+	b := a.getBucket(bucket)
+	now := time.Now()
+	if b.rowsUntil.Before(now.Add(-time.Second)) {
+		b.rowsUntil = now.Add(-time.Second)
+	}
+	b.rowsUntil = b.rowsUntil.Add(time.Duration(rows) * time.Second / time.Duration(rowsPerSec))
+	wait := b.rowsUntil.Sub(now)
+	a.mu.Unlock()
+
+	if wait <= 0 {
+		return 0
+	}
+
+	time.Sleep(wait)
+	return wait
+}
@@ -36,6 +36,12 @@ var (
 	ErrUnsupportedRequest = errors.New("Unsupported query request")
 	ErrVbuuidMismatch     = errors.New("Mismatch in session vbuuids")
 	ErrNotMyPartition     = errors.New("Not my partition")
+
+	ErrScanRejected            = errors.New("Scan rejected by admission control of the bucket")
+	ErrResumeKeyNotSupported   = errors.New("Resume key is not supported for distinct, reverse, unsorted or group/aggregate scan")
+	ErrReverseScanNotSupported = errors.New("Reverse scan is not supported by the index storage")
+	ErrNotVectorIndex          = errors.New("Vector scan is supported only by vector index")
+	ErrHashIndexRangeScan      = errors.New("Range scan is not supported by hash index")
 )
 
 const DECODE_ERR_THRESHOLD = 100
@@ -55,6 +61,7 @@ type scanCoordinator struct {
 	rollbackInProgress unsafe.Pointer
 
 	serv      *queryport.Server
+	grpcServ  *grpcScanServer
 	logPrefix string
 
 	mu            sync.RWMutex
@@ -69,6 +76,17 @@ type scanCoordinator struct {
 	indexerState atomic.Value
 
 	numDecodeErrors uint32 // Number of errors in collatejson decode.
+
+	// KV seqnos last read for bounded staleness scans, by bucket:collection
+	seqnosMu    sync.Mutex
+	seqnosCache map[string]*cachedSeqnos
+
+	admission *scanAdmission
+}
+
+type cachedSeqnos struct {
+	seqnos []uint64
+	readAt time.Time
 }
 
 // NewScanCoordinator returns an instance of scanCoordinator or err message
@@ -88,6 +106,8 @@ func NewScanCoordinator(supvCmdch MsgChannel, supvMsgch MsgChannel,
 		snapshotNotifych: snapshotNotifych,
 		logPrefix:        "ScanCoordinator",
 		reqCounter:       0,
+		seqnosCache:      make(map[string]*cachedSeqnos),
+		admission:        newScanAdmission(),
 	}
 
 	s.config.Store(config)
@@ -107,12 +127,26 @@ func NewScanCoordinator(supvCmdch MsgChannel, supvMsgch MsgChannel,
 		return nil, errMsg
 	}
 
+	if addr := grpcScanAddr(config); addr != "" {
+		if s.grpcServ, err = newGrpcScanServer(s, addr); err != nil {
+			s.serv.Close()
+			errMsg := &MsgError{err: Error{code: ERROR_SCAN_COORD_QUERYPORT_FAIL,
+				severity: FATAL,
+				category: SCAN_COORD,
+				cause:    err,
+			},
+			}
+			return nil, errMsg
+		}
+	}
+
 	s.setIndexerState(common.INDEXER_BOOTSTRAP)
 	s.stats.Set(stats)
 
 	// main loop
 	go s.run()
 	go s.listenSnapshot()
+	go s.runScrubber()
 
 	return s, &MsgSuccess{}
 
@@ -127,6 +161,9 @@ loop:
 				if cmd.GetMsgType() == SCAN_COORD_SHUTDOWN {
 					logging.Infof("ScanCoordinator: Shutting Down")
 					s.serv.Close()
+					if s.grpcServ != nil {
+						s.grpcServ.stop()
+					}
 					s.supvCmdch <- &MsgSuccess{}
 					break loop
 				}
@@ -217,11 +254,21 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, ctx interface{},
 		return
 	}
 
+	s.serveRequest(protoReq, ctx, cancelCh, func(t ScanReqType) ScanResponseWriter {
+		return NewProtoWriter(t, conn)
+	})
+}
+
+// serveRequest processes a request received over queryport or gRPC. The
+// response writer is created by newWriter once the request type is known.
+func (s *scanCoordinator) serveRequest(protoReq interface{}, ctx interface{},
+	cancelCh <-chan bool, newWriter func(ScanReqType) ScanResponseWriter) {
+
 	ttime := time.Now()
 
 	req, err := NewScanRequest(protoReq, ctx, cancelCh, s)
 	atime := time.Now()
-	w := NewProtoWriter(req.ScanType, conn)
+	w := newWriter(req.ScanType)
 	defer func() {
 		s.handleError(req.LogPrefix, w.Done())
 		req.Done()
@@ -261,6 +308,13 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, ctx interface{},
 		return
 	}
 
+	if err := s.admitScan(req); err != nil {
+		s.tryRespondWithError(w, req, err)
+		return
+	}
+	defer s.admission.release(req.Bucket,
+		s.config.Load()["settings.scan_admission.max_concurrent_scans"].Int())
+
 	if req.Stats != nil {
 		req.Stats.scanReqInitDuration.Add(time.Now().Sub(ttime).Nanoseconds())
 
@@ -285,7 +339,7 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, ctx interface{},
 	t0 := time.Now()
 	is, err := s.getRequestedIndexSnapshot(req)
 	if err == common.ErrScanTimedOut && req.Stats != nil {
-		req.Stats.numScanTimeouts.Add(1)
+		req.countTimeout()
 	}
 	if s.tryRespondWithError(w, req, err) {
 		return
@@ -408,6 +462,10 @@ func (s *scanCoordinator) handleScanRequest(req *ScanRequest, w ScanResponseWrit
 	err := scanPipeline.Execute()
 	scanTime := time.Now().Sub(t0)
 
+	if err == nil {
+		w.ResumeKey(scanPipeline.ResumeKey())
+	}
+
 	if req.Stats != nil {
 		req.Stats.numRowsReturned.Add(int64(scanPipeline.RowsReturned()))
 		req.Stats.scanBytesRead.Add(int64(scanPipeline.BytesRead()))
@@ -816,6 +874,41 @@ func isSnapTsConsistentOrAhead(snapTs, reqTs *common.TsVbuuid, strict_chk_thresh
 	return true, isSnapAhead
 }
 
+func (s *scanCoordinator) admitScan(req *ScanRequest) error {
+	cfg := s.config.Load()
+	limit := cfg["settings.scan_admission.max_concurrent_scans"].Int()
+	timeout := time.Duration(cfg["settings.scan_admission.queue_timeout"].Int()) * time.Millisecond
+
+	queued, err := s.admission.admit(req.Bucket, limit, timeout, req.CancelCh)
+	if bs := s.getBucketStats(req.Bucket); bs != nil {
+		if queued {
+			bs.numScansQueued.Add(1)
+		}
+		if err != nil {
+			bs.numScansRejected.Add(1)
+		}
+	}
+
+	return err
+}
+
+// throttleRows is called by scan pipeline for every batch of rows returned
+func (s *scanCoordinator) throttleRows(req *ScanRequest, rows int) {
+	rowsPerSec := s.config.Load()["settings.scan_admission.max_rows_per_sec"].Int()
+	if wait := s.admission.throttleRows(req.Bucket, rows, rowsPerSec); wait > 0 {
+		if bs := s.getBucketStats(req.Bucket); bs != nil {
+			bs.scanThrottleDuration.Add(int64(wait))
+		}
+	}
+}
+
+func (s *scanCoordinator) getBucketStats(bucket string) *BucketStats {
+	if stats := s.stats.Get(); stats != nil {
+		return stats.buckets[bucket]
+	}
+	return nil
+}
+
 func (s *scanCoordinator) isScanAllowed(c common.Consistency, scan *ScanRequest) error {
 	if s.getIndexerState() == common.INDEXER_PAUSED {
 		cfg := s.config.Load()
@@ -923,7 +1016,7 @@ func (s *scanCoordinator) updateErrStats(req *ScanRequest, err error) {
 		case common.ErrClientCancel:
 			req.Stats.clientCancelError.Add(1)
 		case common.ErrScanTimedOut:
-			req.Stats.numScanTimeouts.Add(1)
+			req.countTimeout()
 		case common.ErrIndexNotReady:
 			req.Stats.notReadyError.Add(1)
 		default:
@@ -1062,6 +1155,9 @@ func (s *scanCoordinator) handleIndexerRollback(cmd Message) {
 func (s *scanCoordinator) handleSecurityChange(cmd Message) {
 
 	err := s.serv.ResetConnections()
+	if err == nil && s.grpcServ != nil {
+		err = s.grpcServ.reset()
+	}
 	if err != nil {
 		idxErr := Error{
 			code:     ERROR_INDEXER_INTERNAL_ERROR,
@@ -1331,6 +1427,58 @@ func (s *scanCoordinator) isBootstrapMode() bool {
 	return s.getIndexerState() == common.INDEXER_BOOTSTRAP
 }
 
+//
+// getBoundedStalenessTs returns the timestamp a bounded staleness scan has
+// to be consistent with. KV seqnos read within the last maxMs milliseconds
+// are reused, so that the scan misses at most the mutations of that period.
+// The seqno of each vbucket is further lowered by maxSeqnos.
+//
+func (s *scanCoordinator) getBoundedStalenessTs(r *ScanRequest,
+	maxMs, maxSeqnos uint64) (*common.TsVbuuid, error) {
+
+	cfg := s.config.Load()
+	key := r.Bucket + ":" + r.CollectionId
+
+	s.seqnosMu.Lock()
+	cached := s.seqnosCache[key]
+	s.seqnosMu.Unlock()
+
+	var seqnos []uint64
+	if cached != nil && time.Since(cached.readAt) <= time.Duration(maxMs)*time.Millisecond {
+		seqnos = cached.seqnos
+	} else {
+		t0 := time.Now()
+		var err error
+		seqnos, err = bucketSeqsWithRetry(cfg["settings.scan_getseqnos_retries"].Int(),
+			r.LogPrefix, cfg["clusterAddr"].String(), r.Bucket, cfg["numVbuckets"].Int(), r.CollectionId)
+		if err != nil {
+			return nil, err
+		}
+		if r.Stats != nil {
+			r.Stats.Timings.dcpSeqs.Put(time.Since(t0))
+		}
+
+		s.seqnosMu.Lock()
+		// prune the seqnos too old to be reused, e.g. of dropped collections
+		for k, c := range s.seqnosCache {
+			if time.Since(c.readAt) > time.Duration(maxMs)*time.Millisecond {
+				delete(s.seqnosCache, k)
+			}
+		}
+		s.seqnosCache[key] = &cachedSeqnos{seqnos: seqnos, readAt: t0}
+		s.seqnosMu.Unlock()
+	}
+
+	ts := &common.TsVbuuid{Bucket: r.Bucket, Seqnos: make([]uint64, len(seqnos))}
+	for i, seqno := range seqnos {
+		if seqno > maxSeqnos {
+			ts.Seqnos[i] = seqno - maxSeqnos
+		}
+	}
+
+	return ts, nil
+}
+
 func bucketSeqsWithRetry(retries int, logPrefix, cluster, bucket string, numVbs int, cid string) (seqnos []uint64, err error) {
 	fn := func(r int, err error) error {
 		if r > 0 {
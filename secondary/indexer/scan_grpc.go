@@ -0,0 +1,277 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/couchbase/indexing/secondary/security"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Max size of the index entries sent in one ResponseStream message
+const GRPC_SCAN_BATCH_SIZE = 64 * 1024
+
+//
+// grpcScanServer serves the IndexScan gRPC service (see query.proto) on
+// grpcScanPort, as an alternative to the queryport protocol for clients
+// that are not written in Go.  Requests and responses are the same
+// protobuf messages as in queryport.  Scan results are streamed in
+// batches, flow control is left to gRPC, and the deadline or cancellation
+// of the call cancels the scan.
+//
+type grpcScanServer struct {
+	sco *scanCoordinator
+
+	mu   sync.Mutex
+	addr string
+	serv *grpc.Server
+}
+
+func newGrpcScanServer(sco *scanCoordinator, addr string) (*grpcScanServer, error) {
+	g := &grpcScanServer{sco: sco, addr: addr}
+	if err := g.start(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *grpcScanServer) start() error {
+	lis, err := security.MakeListener(g.addr)
+	if err != nil {
+		logging.Errorf("ScanCoordinator: gRPC scan server failed to listen on %v: %v", g.addr, err)
+		return err
+	}
+
+	serv := grpc.NewServer()
+	protobuf.RegisterIndexScanServer(serv, g)
+
+	g.mu.Lock()
+	g.serv = serv
+	g.mu.Unlock()
+
+	go func() {
+		if err := serv.Serve(lis); err != nil {
+			logging.Errorf("ScanCoordinator: gRPC scan server on %v stopped: %v", g.addr, err)
+		}
+	}()
+
+	logging.Infof("ScanCoordinator: gRPC scan server started on %v", g.addr)
+	return nil
+}
+
+func (g *grpcScanServer) stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.serv != nil {
+		g.serv.Stop()
+		g.serv = nil
+	}
+}
+
+// reset closes all the connections and listens again, so that new
+// connections use the current security settings.
+func (g *grpcScanServer) reset() error {
+	g.stop()
+	return g.start()
+}
+
+func (g *grpcScanServer) Scan(req *protobuf.ScanRequest, stream protobuf.IndexScan_ScanServer) error {
+	return g.serve(stream.Context(), req, stream.SendMsg)
+}
+
+func (g *grpcScanServer) ScanAll(req *protobuf.ScanAllRequest, stream protobuf.IndexScan_ScanAllServer) error {
+	return g.serve(stream.Context(), req, stream.SendMsg)
+}
+
+func (g *grpcScanServer) Count(ctx context.Context, req *protobuf.CountRequest) (*protobuf.CountResponse, error) {
+
+	var res interface{}
+	save := func(msg interface{}) error {
+		res = msg
+		return nil
+	}
+
+	if err := g.serve(ctx, req, save); err != nil {
+		return nil, err
+	}
+
+	if cres, ok := res.(*protobuf.CountResponse); ok {
+		return cres, nil
+	}
+	return nil, status.Error(codes.Internal, ErrInternal.Error())
+}
+
+func (g *grpcScanServer) serve(ctx context.Context, req interface{},
+	send func(interface{}) error) error {
+
+	cancelCh := make(chan bool)
+	donech := make(chan bool)
+	defer close(donech)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(cancelCh)
+		case <-donech:
+		}
+	}()
+
+	var w *grpcResponseWriter
+	g.sco.serveRequest(req, nil, cancelCh, func(t ScanReqType) ScanResponseWriter {
+		w = &grpcResponseWriter{scanType: t, send: send}
+		return w
+	})
+
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	if w.err != nil {
+		return status.Error(codes.Unavailable, w.err.Error())
+	}
+	return nil
+}
+
+//
+// grpcResponseWriter is the ScanResponseWriter of gRPC requests. Errors
+// of the scan are sent to the client in the response messages, the same
+// way as in queryport.
+//
+type grpcResponseWriter struct {
+	scanType   ScanReqType
+	send       func(interface{}) error
+	rowEntries []*protobuf.IndexEntry
+	rowSize    int
+	resumeKey  []byte
+
+	// error sending to the client
+	err error
+}
+
+func (w *grpcResponseWriter) sendMsg(msg interface{}) error {
+	if w.err == nil {
+		w.err = w.send(msg)
+	}
+	return w.err
+}
+
+func (w *grpcResponseWriter) Error(err error) error {
+	var res interface{}
+	protoErr := &protobuf.Error{Error: proto.String(err.Error())}
+
+	// Drop all collected rows
+	w.rowEntries = nil
+	w.rowSize = 0
+
+	switch w.scanType {
+	case StatsReq:
+		res = &protobuf.StatisticsResponse{
+			Err: protoErr,
+		}
+	case CountReq, MultiScanCountReq:
+		res = &protobuf.CountResponse{
+			Count: proto.Int64(0), Err: protoErr,
+		}
+	default:
+		res = &protobuf.ResponseStream{
+			Err: protoErr,
+		}
+	}
+
+	return w.sendMsg(res)
+}
+
+func (w *grpcResponseWriter) Stats(rows, unique uint64, min, max []byte) error {
+	res := &protobuf.StatisticsResponse{
+		Stats: &protobuf.IndexStatistics{
+			KeysCount:       proto.Uint64(rows),
+			UniqueKeysCount: proto.Uint64(unique),
+			KeyMin:          min,
+			KeyMax:          max,
+		},
+	}
+
+	return w.sendMsg(res)
+}
+
+func (w *grpcResponseWriter) Helo() error {
+	res := &protobuf.HeloResponse{
+		Version: proto.Uint32(common.INDEXER_CUR_VERSION),
+	}
+
+	return w.sendMsg(res)
+}
+
+func (w *grpcResponseWriter) Count(c uint64) error {
+	res := &protobuf.CountResponse{
+		Count: proto.Int64(int64(c)),
+	}
+
+	return w.sendMsg(res)
+}
+
+func (w *grpcResponseWriter) RawBytes(b []byte) error {
+	return ErrUnsupportedRequest
+}
+
+func (w *grpcResponseWriter) Row(pk, sk []byte) error {
+
+	if w.rowSize != 0 && w.rowSize+len(pk)+len(sk) > GRPC_SCAN_BATCH_SIZE {
+		res := &protobuf.ResponseStream{IndexEntries: w.rowEntries}
+		if err := w.sendMsg(res); err != nil {
+			return err
+		}
+
+		w.rowSize = 0
+		w.rowEntries = nil
+	}
+
+	// Message is sent after this call returns, so the row is copied
+	row := &protobuf.IndexEntry{
+		EntryKey:   append([]byte(nil), sk...),
+		PrimaryKey: append([]byte(nil), pk...),
+	}
+
+	w.rowSize += len(sk) + len(pk)
+	w.rowEntries = append(w.rowEntries, row)
+	return nil
+}
+
+// ResumeKey sets the resume key sent with the last rows of the scan
+func (w *grpcResponseWriter) ResumeKey(key []byte) {
+	w.resumeKey = key
+}
+
+func (w *grpcResponseWriter) Done() error {
+	if (w.scanType == ScanReq || w.scanType == ScanAllReq || w.scanType == FastCountReq) &&
+		(w.rowSize > 0 || w.resumeKey != nil) {
+		res := &protobuf.ResponseStream{IndexEntries: w.rowEntries, ResumeKey: w.resumeKey}
+		return w.sendMsg(res)
+	}
+
+	return nil
+}
+
+func grpcScanAddr(config common.Config) string {
+	port := config["grpcScanPort"].String()
+	if port == "" || port == "0" {
+		return ""
+	}
+	return net.JoinHostPort("", port)
+}
@@ -15,6 +15,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/couchbase/indexing/secondary/collatejson"
@@ -41,6 +42,7 @@ type ScanPipeline struct {
 	stopAggregation bool
 
 	rowsReturned  uint64
+	resumeKey     []byte
 	bytesRead     uint64
 	rowsScanned   uint64
 	cacheHitRatio int
@@ -60,6 +62,12 @@ func (p ScanPipeline) RowsReturned() uint64 {
 	return p.rowsReturned
 }
 
+// ResumeKey returns the index entry to resume the scan after, if the scan
+// stopped at its limit
+func (p ScanPipeline) ResumeKey() []byte {
+	return p.resumeKey
+}
+
 func (p ScanPipeline) BytesRead() uint64 {
 	return p.bytesRead
 }
@@ -197,6 +205,12 @@ func (s *IndexScanSource) Routine() error {
 		iterCount++
 		s.p.rowsScanned++
 
+		//skip the entries returned by the previous scan
+		if len(r.ResumeKey) != 0 && bytes.Compare(entry, r.ResumeKey) <= 0 {
+			return nil
+		}
+		rawEntry := entry
+
 		skipRow := false
 		var ck [][]byte
 		var dk value.Values
@@ -308,6 +322,11 @@ func (s *IndexScanSource) Routine() error {
 					return wrErr
 				}
 				if s.p.rowsReturned == uint64(r.Limit) || s.p.stopAggregation {
+					//scan can resume after this entry, unless some of its
+					//rows are not returned yet
+					if r.canResume() && i == count-1 {
+						s.p.resumeKey = append([]byte(nil), rawEntry...)
+					}
 					return ErrLimitReached
 				}
 			} else {
@@ -335,17 +354,47 @@ func (s *IndexScanSource) Routine() error {
 		}
 	}
 
-loop:
-	for _, scan := range r.Scans {
-		currentScan = scan
-		err = scatter(r, scan, sliceSnapshots, fn, s.p.config)
+	scans := r.Scans
+	if len(r.ResumeKey) != 0 {
+		scans = resumeScans(scans, r.ResumeKey, r.isPrimary)
+	}
+
+	if canAggregatePartitions(r, sliceSnapshots, s.p.config) {
+		err = s.aggregatePartitions(scans, sliceSnapshots)
 		switch err {
-		case nil:
-		case p.ErrSupervisorKill, ErrLimitReached:
-			break loop
+		case nil, p.ErrSupervisorKill, ErrLimitReached:
 		default:
 			s.CloseWithError(err)
-			break loop
+		}
+	} else if r.VectorQuery != nil {
+		currentScan = scans[0]
+		err = s.vectorScan(currentScan, sliceSnapshots, fn)
+		switch err {
+		case nil, p.ErrSupervisorKill, ErrLimitReached:
+		default:
+			s.CloseWithError(err)
+		}
+	} else {
+		if r.Reverse {
+			reversed := make([]Scan, len(scans))
+			for i, scan := range scans {
+				reversed[len(scans)-1-i] = scan
+			}
+			scans = reversed
+		}
+
+	loop:
+		for _, scan := range scans {
+			currentScan = scan
+			err = scatter(r, scan, sliceSnapshots, fn, s.p.config)
+			switch err {
+			case nil:
+			case p.ErrSupervisorKill, ErrLimitReached:
+				break loop
+			default:
+				s.CloseWithError(err)
+				break loop
+			}
 		}
 	}
 
@@ -419,6 +468,271 @@ loop:
 	return nil
 }
 
+//
+// canAggregatePartitions returns true if the aggregates of a scan over
+// multiple partitions can be computed within each partition, instead of
+// gathering all the entries in a single routine. Without GROUP BY, the
+// partial aggregates of the partitions are merged into a single row. With
+// GROUP BY, the partial groups of each partition are returned as they are,
+// which is only allowed if the query accepts partial aggregates.
+// DISTINCT aggregates and expressions depending on the document are not
+// supported.
+//
+func canAggregatePartitions(r *ScanRequest, snapshots []SliceSnapshot, config c.Config) bool {
+
+	groupAggr := r.GroupAggr
+	if groupAggr == nil || len(snapshots) <= 1 || !config["scan.enable_partition_aggr"].Bool() {
+		return false
+	}
+
+	if groupAggr.HasExpr || groupAggr.DependsOnPrimaryKey || groupAggr.FirstValidAggrOnly {
+		return false
+	}
+
+	if len(groupAggr.Group) != 0 && (!groupAggr.AllowPartialAggr || r.Offset != 0) {
+		return false
+	}
+
+	for _, ak := range groupAggr.Aggrs {
+		if ak.Distinct {
+			return false
+		}
+	}
+
+	return true
+}
+
+//
+// aggregatePartitions computes the aggregates of each partition
+// concurrently. Partial groups are written out as soon as a partition
+// flushes them, while aggregates without GROUP BY are merged into the
+// pipeline's aggregate result.
+//
+func (s *IndexScanSource) aggregatePartitions(scans []Scan, snapshots []SliceSnapshot) (err error) {
+
+	var wg sync.WaitGroup
+	var rowch chan []byte
+
+	r := s.p.req
+	errch := make(chan error, len(snapshots))
+	stopch := make(chan bool)
+	partials := make([]*ScanPipeline, len(snapshots))
+
+	if len(r.GroupAggr.Group) != 0 {
+		rowch = make(chan []byte, len(snapshots)*s.p.config["scan.partial_group_buffer_size"].Int())
+	}
+
+	for i, snap := range snapshots {
+		wg.Add(1)
+		go func(i int, snap SliceSnapshot) {
+			defer wg.Done()
+			partials[i] = s.aggregatePartition(scans, snap, i, rowch, stopch, errch)
+		}(i, snap)
+	}
+
+	if rowch != nil {
+		go func() {
+			wg.Wait()
+			close(rowch)
+		}()
+
+		for entry := range rowch {
+			if err != nil {
+				continue //drain until all partitions are stopped
+			}
+
+			s.p.rowsReturned++
+			if err = s.WriteItem(entry); err == nil && s.p.rowsReturned == uint64(r.Limit) {
+				err = ErrLimitReached
+			}
+			if err != nil {
+				close(stopch)
+			}
+		}
+	} else {
+		wg.Wait()
+	}
+
+	for _, partial := range partials {
+		s.p.rowsScanned += partial.rowsScanned
+		s.p.exprEvalDur += partial.exprEvalDur
+		s.p.exprEvalNum += partial.exprEvalNum
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(errch) != 0 {
+		return <-errch
+	}
+
+	for _, partial := range partials {
+		mergeAggrResult(s.p.aggrRes, partial.aggrRes)
+	}
+
+	return nil
+}
+
+//
+// mergeAggrResult merges the partial aggregates of a partition, computed
+// without GROUP BY, into res.
+//
+func mergeAggrResult(res, partial *aggrResult) {
+
+	for _, row := range partial.rows {
+		if len(res.rows) == 0 {
+			res.rows = append(res.rows, row)
+		} else {
+			res.rows[0].MergeAggregate(row)
+		}
+	}
+}
+
+//
+// aggregatePartition computes the aggregates of a single partition. If
+// rowch is not nil, the flushed groups are projected and sent to rowch,
+// otherwise the aggregate result is returned to the caller. Each partition
+// has its own pipeline state, which holds its result and stats, as the
+// partitions are aggregated concurrently.
+//
+func (s *IndexScanSource) aggregatePartition(scans []Scan, snap SliceSnapshot, pos int,
+	rowch chan []byte, stopch chan bool, errch chan error) *ScanPipeline {
+
+	r := s.p.req
+	partitionId := getPartitionId(r, pos)
+
+	res := &aggrResult{}
+	partial := &ScanPipeline{req: r, config: s.p.config, aggrRes: res}
+	if r.GroupAggr.IsLeadingGroup {
+		res.SetMaxRows(1)
+	} else {
+		res.SetMaxRows(s.p.config["scan.partial_group_buffer_size"].Int())
+	}
+
+	//each partition needs its own copy of the temporary group/aggr values
+	groupAggr := *r.GroupAggr
+	groupAggr.groups = make([]*groupKey, len(groupAggr.Group))
+	for i, _ := range groupAggr.Group {
+		groupAggr.groups[i] = new(groupKey)
+	}
+	groupAggr.aggrs = make([]*aggrVal, len(groupAggr.Aggrs))
+	for i, _ := range groupAggr.Aggrs {
+		groupAggr.aggrs[i] = new(aggrVal)
+	}
+
+	var currentScan Scan
+	var cachedEntry entryCache
+	var cktmp [][]byte
+	var dktmp value.Values
+	var revbuf *[]byte
+
+	buf := secKeyBufPool.Get()
+	defer secKeyBufPool.Put(buf)
+
+	cktmp = make([][]byte, len(r.IndexInst.Defn.SecExprs))
+	if groupAggr.NeedDecode {
+		dktmp = make(value.Values, len(r.IndexInst.Defn.SecExprs))
+	}
+
+	hasDesc := r.IndexInst.Defn.HasDescending()
+	if hasDesc {
+		revbuf = secKeyBufPool.Get()
+		defer secKeyBufPool.Put(revbuf)
+	}
+
+	sendGroups := func() error {
+		for {
+			entry, err := projectGroupAggr((*buf)[:0], r.Indexprojection, res, r.isPrimary)
+			if entry == nil || err != nil {
+				return err
+			}
+
+			select {
+			case rowch <- append([]byte(nil), entry...):
+			case <-stopch:
+				return ErrFinishCallback
+			}
+		}
+	}
+
+	fn := func(entry []byte) error {
+		if partial.rowsScanned%SCAN_ROLLBACK_ERROR_BATCHSIZE == 0 {
+			if r.hasRollback != nil && r.hasRollback.Load() == true {
+				return ErrIndexRollback
+			}
+			select {
+			case <-stopch:
+				return ErrFinishCallback
+			default:
+			}
+		}
+		partial.rowsScanned++
+
+		var err error
+		var skipRow bool
+		var ck [][]byte
+		var dk value.Values
+
+		if hasDesc {
+			revbuf := (*revbuf)[:0]
+			revbuf = append(revbuf, entry...)
+			_, err = jsonEncoder.ReverseCollate(revbuf, r.IndexInst.Defn.Desc)
+			if err != nil {
+				return err
+			}
+			entry = revbuf
+		}
+
+		if len(entry) > cap(*buf) {
+			*buf = make([]byte, 0, len(entry)+1024)
+		}
+
+		if currentScan.ScanType == FilterRangeReq {
+			skipRow, ck, dk, err = filterScanRow2(entry, currentScan,
+				(*buf)[:0], cktmp, dktmp, r, &cachedEntry)
+			if err != nil {
+				return err
+			}
+			if skipRow {
+				return nil
+			}
+		}
+
+		count := 1
+		if !r.isPrimary && !groupAggr.OnePerPrimaryKey {
+			count = secondaryIndexEntry(entry).Count()
+		}
+
+		err = computeGroupAggr(ck, dk, count, nil, entry, (*buf)[:0], res, &groupAggr,
+			cktmp, dktmp, &cachedEntry, partial)
+		if err != nil || rowch == nil {
+			return err
+		}
+
+		return sendGroups()
+	}
+
+	for _, scan := range scans {
+		currentScan = scan
+		scanSingleSlice(r, scan, r.Ctxs[pos], snap, partitionId, nil, nil, errch, fn)
+		if len(errch) != 0 {
+			return partial
+		}
+	}
+
+	if rowch != nil {
+		for _, row := range res.rows {
+			row.SetFlush(true)
+		}
+		if err := sendGroups(); err != nil && err != ErrFinishCallback {
+			errch <- err
+		}
+	}
+
+	return partial
+}
+
 func (d *IndexScanDecoder) Routine() error {
 	defer d.CloseWrite()
 	defer d.CloseRead()
@@ -509,6 +823,7 @@ loop:
 func (d *IndexScanWriter) Routine() error {
 	var err error
 	var sk, pk []byte
+	var rows int
 
 	defer func() {
 		// Send error to the client if not client requested cancel.
@@ -539,6 +854,11 @@ loop:
 			return err
 		}
 
+		rows++
+		if rows%SCAN_THROTTLE_BATCHSIZE == 0 && d.p.req.sco != nil {
+			d.p.req.sco.throttleRows(d.p.req, SCAN_THROTTLE_BATCHSIZE)
+		}
+
 		/*
 		   TODO(sarath): Use block chunk send protocol
 		   Instead of collecting rows and encoding into protobuf,
@@ -612,7 +932,7 @@ func filterScanRow(key []byte, scan Scan, buf []byte) (bool, [][]byte, error) {
 			err = errors.New("There are more ranges than number of composite elements in the index")
 			return false, nil, err
 		}
-		filtermatch = applyFilter(compositekeys, filtercollection.CompositeFilters)
+		filtermatch = applyFilters(compositekeys, &filtercollection)
 		if filtermatch {
 			return false, compositekeys, nil
 		}
@@ -667,7 +987,7 @@ func filterScanRow2(key []byte, scan Scan, buf []byte, cktmp [][]byte,
 			err = errors.New("There are more ranges than number of composite elements in the index")
 			return false, nil, nil, err
 		}
-		filtermatch = applyFilter(compositekeys, filtercollection.CompositeFilters)
+		filtermatch = applyFilters(compositekeys, &filtercollection)
 		if filtermatch {
 			return false, compositekeys, decodedkeys, nil
 		}
@@ -676,6 +996,36 @@ func filterScanRow2(key []byte, scan Scan, buf []byte, cktmp [][]byte,
 	return true, compositekeys, decodedkeys, nil
 }
 
+// Return true if filter matches the composite keys, including
+// the fields of the array key element if there are array filters
+func applyFilters(compositekeys [][]byte, filter *Filter) bool {
+
+	if !applyFilter(compositekeys, filter.CompositeFilters) {
+		return false
+	}
+
+	if len(filter.ArrayFilters) == 0 {
+		return true
+	}
+
+	if filter.ArrayKeyPos < 0 || filter.ArrayKeyPos >= len(compositekeys) {
+		return false
+	}
+
+	// Element which is not an array or has fewer fields does not match
+	elem := compositekeys[filter.ArrayKeyPos]
+	if len(elem) == 0 || elem[0] != collatejson.TypeArray {
+		return false
+	}
+
+	fields, err := jsonEncoder.ExplodeArray(elem, make([]byte, 0, len(elem)*3))
+	if err != nil || len(fields) < len(filter.ArrayFilters) {
+		return false
+	}
+
+	return applyFilter(fields, filter.ArrayFilters)
+}
+
 // Return true if filter matches the composite keys
 func applyFilter(compositekeys [][]byte, compositefilters []CompositeElementFilter) bool {
 
@@ -1164,6 +1514,21 @@ func (ar *aggrRow) AddAggregate(aggrs []*aggrVal) error {
 	return nil
 }
 
+//
+// MergeAggregate merges the partial aggregates of another row of the same
+// group into this row.
+//
+func (ar *aggrRow) MergeAggregate(other *aggrRow) {
+
+	for i, agg := range other.aggrs {
+		if ar.aggrs[i] == nil {
+			ar.aggrs[i] = agg
+		} else if agg != nil {
+			ar.aggrs[i].fn.Merge(agg.fn)
+		}
+	}
+}
+
 func (ar *aggrRow) SetFlush(f bool) {
 	ar.flush = f
 	return
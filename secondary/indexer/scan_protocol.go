@@ -26,6 +26,7 @@ type ScanResponseWriter interface {
 	Row(pk, sk []byte) error
 	Done() error
 	Helo() error
+	ResumeKey(key []byte)
 }
 
 type protoResponseWriter struct {
@@ -35,6 +36,7 @@ type protoResponseWriter struct {
 	rowBuf     *[]byte
 	rowEntries []*protobuf.IndexEntry
 	rowSize    int
+	resumeKey  []byte
 }
 
 func NewProtoWriter(t ScanReqType, conn net.Conn) *protoResponseWriter {
@@ -153,12 +155,19 @@ func (w *protoResponseWriter) Row(pk, sk []byte) error {
 	return nil
 }
 
+// ResumeKey sets the resume key sent with the last rows of the scan
+func (w *protoResponseWriter) ResumeKey(key []byte) {
+	w.resumeKey = key
+}
+
 func (w *protoResponseWriter) Done() error {
 	defer p.PutBlock(w.encBuf)
 	defer p.PutBlock(w.rowBuf)
 
-	if (w.scanType == ScanReq || w.scanType == ScanAllReq || w.scanType == FastCountReq) && w.rowSize > 0 {
-		res := &protobuf.ResponseStream{IndexEntries: w.rowEntries}
+	// resume key is sent even if the rows are all sent already
+	if (w.scanType == ScanReq || w.scanType == ScanAllReq || w.scanType == FastCountReq) &&
+		(w.rowSize > 0 || w.resumeKey != nil) {
+		res := &protobuf.ResponseStream{IndexEntries: w.rowEntries, ResumeKey: w.resumeKey}
 		err := protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
 		if err != nil {
 			return err
@@ -21,6 +21,7 @@ import (
 
 	"github.com/couchbase/indexing/secondary/collatejson"
 	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/common/queryutil"
 	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
 
 	"github.com/couchbase/indexing/secondary/logging"
@@ -75,6 +76,12 @@ type ScanRequest struct {
 	Offset            int64
 	projectPrimaryKey bool
 
+	// Scan continues after this index entry, returned by the previous scan
+	ResumeKey []byte
+
+	// Query vector of a nearest neighbor scan of a vector index
+	VectorQuery []float32
+
 	//groupby/aggregate
 
 	GroupAggr *GroupAggr
@@ -86,6 +93,10 @@ type ScanRequest struct {
 	decodePositions  []bool
 	explodeUpto      int
 
+	//number of leading keys a distinct scan is deduplicated
+	//on within each partition, 0 if not possible
+	distinctKeys int
+
 	// New parameters for partitioned index
 	Sorted bool
 
@@ -97,6 +108,9 @@ type ScanRequest struct {
 	Timeout     *time.Timer
 	CancelCh    <-chan bool
 
+	// Timeout is set by the deadline of the client
+	clientDeadline bool
+
 	RequestId string
 	LogPrefix string
 
@@ -144,6 +158,11 @@ type Filter struct {
 	High             IndexKey
 	Inclusion        Inclusion
 	ScanType         ScanFilterType
+
+	// Filters on the fields of the element at ArrayKeyPos, for
+	// array indexes with flattened array keys
+	ArrayFilters []CompositeElementFilter
+	ArrayKeyPos  int
 }
 
 type ScanFilterType string
@@ -331,6 +350,7 @@ func NewScanRequest(protoReq interface{}, ctx interface{},
 		r.RequestId = req.GetRequestId()
 		r.rollbackTime = req.GetRollbackTime()
 		r.PartitionIds = makePartitionIds(req.GetPartitionIds())
+		r.setDeadline(req.GetTimeout())
 		cons := common.Consistency(req.GetCons())
 		vector := req.GetVector()
 		r.ScanType = CountReq
@@ -368,6 +388,7 @@ func NewScanRequest(protoReq interface{}, ctx interface{},
 		r.RequestId = req.GetRequestId()
 		r.rollbackTime = req.GetRollbackTime()
 		r.PartitionIds = makePartitionIds(req.GetPartitionIds())
+		r.setDeadline(req.GetTimeout())
 		cons := common.Consistency(req.GetCons())
 		vector := req.GetVector()
 		r.ScanType = ScanReq
@@ -381,6 +402,7 @@ func NewScanRequest(protoReq interface{}, ctx interface{},
 			r.Distinct = req.GetDistinct()
 		}
 		r.Offset = req.GetOffset()
+		r.ResumeKey = req.GetResumeKey()
 
 		if err = r.setIndexParams(); err != nil {
 			return
@@ -421,12 +443,23 @@ func NewScanRequest(protoReq interface{}, ctx interface{},
 			return
 		}
 		r.setExplodePositions()
+		r.setDistinctKeys()
+
+		if err = r.fillVectorScan(req.GetVectorScan()); err != nil {
+			return
+		}
+
+		if len(r.ResumeKey) != 0 && !r.canResume() {
+			err = ErrResumeKeyNotSupported
+			return
+		}
 
 	case *protobuf.ScanAllRequest:
 		r.DefnID = req.GetDefnID()
 		r.RequestId = req.GetRequestId()
 		r.rollbackTime = req.GetRollbackTime()
 		r.PartitionIds = makePartitionIds(req.GetPartitionIds())
+		r.setDeadline(req.GetTimeout())
 		cons := common.Consistency(req.GetCons())
 		vector := req.GetVector()
 		r.ScanType = ScanAllReq
@@ -450,6 +483,34 @@ func NewScanRequest(protoReq interface{}, ctx interface{},
 	return
 }
 
+// setDeadline shortens the scan timeout to the time left until the
+// deadline of the client, so that the scan stops once the client has
+// given up on it.
+func (r *ScanRequest) setDeadline(timeout int64) {
+	if timeout <= 0 {
+		return
+	}
+
+	expiredTime := time.Now().Add(time.Duration(timeout))
+	if r.Timeout != nil {
+		if !expiredTime.Before(r.ExpiredTime) {
+			return
+		}
+		r.Timeout.Stop()
+	}
+
+	r.ExpiredTime = expiredTime
+	r.Timeout = time.NewTimer(time.Duration(timeout))
+	r.clientDeadline = true
+}
+
+func (r *ScanRequest) countTimeout() {
+	r.Stats.numScanTimeouts.Add(1)
+	if r.clientDeadline {
+		r.Stats.numScanDeadlineTimeouts.Add(1)
+	}
+}
+
 func (r *ScanRequest) getTimeoutCh() <-chan time.Time {
 	if r.Timeout != nil {
 		return r.Timeout.C
@@ -810,6 +871,11 @@ func (r *ScanRequest) composeScans(points []IndexPoint, filters []Filter) []Scan
 		}
 	}
 	for i, _ := range scans {
+		// Filters on array key elements are applied only by FilterRangeReq
+		if len(scans[i].Filters) == 1 && len(scans[i].Filters[0].ArrayFilters) != 0 {
+			continue
+		}
+
 		if len(scans[i].Filters) == 1 && scans[i].Filters[0].ScanType == LookupReq {
 			scans[i].Equals = scans[i].Low
 			scans[i].ScanType = LookupReq
@@ -1016,6 +1082,9 @@ func (r *ScanRequest) fillScans(protoScans []*protobuf.Scan) (localErr error) {
 				if localErr = r.fillFilterEquals(protoScan, &filter); localErr != nil {
 					return
 				}
+				if localErr = r.fillArrayFilters(protoScan, &filter); localErr != nil {
+					return
+				}
 				filters = append(filters, filter)
 
 				p1 := IndexPoint{Value: filter.Low, FilterId: len(filters) - 1, Type: "low"}
@@ -1025,20 +1094,28 @@ func (r *ScanRequest) fillScans(protoScans []*protobuf.Scan) (localErr error) {
 			}
 
 			// If there are no filters in scan, it is ScanAll
-			if len(protoScan.Filters) == 0 {
+			if len(protoScan.Filters) == 0 && len(protoScan.ArrayFilters) == 0 {
 				r.Scans = make([]Scan, 1)
 				r.Scans[0] = getScanAll()
 				return
 			}
 
 			// if all scan filters are (nil, nil), it is ScanAll
-			if r.areFiltersNil(protoScan) {
+			if r.areFiltersNil(protoScan) && len(protoScan.ArrayFilters) == 0 {
 				r.Scans = make([]Scan, 1)
 				r.Scans[0] = getScanAll()
 				return
 			}
 
 			var compFilters []CompositeElementFilter
+			if len(protoScan.Filters) == 0 {
+				// Full range, filtered only on the array key elements
+				compFilters = append(compFilters, CompositeElementFilter{
+					Low:       MinIndexKey,
+					High:      MaxIndexKey,
+					Inclusion: Both,
+				})
+			}
 			// Encode Filters
 			for _, fl := range protoScan.Filters {
 				if l, localErr = r.newLowKey(fl.Low); localErr != nil {
@@ -1077,6 +1154,10 @@ func (r *ScanRequest) fillScans(protoScans []*protobuf.Scan) (localErr error) {
 				return
 			}
 
+			if localErr = r.fillArrayFilters(protoScan, &filter); localErr != nil {
+				return
+			}
+
 			filters = append(filters, filter)
 
 			p1 := IndexPoint{Value: filter.Low, FilterId: len(filters) - 1, Type: "low"}
@@ -1094,6 +1175,125 @@ func (r *ScanRequest) fillScans(protoScans []*protobuf.Scan) (localErr error) {
 	return
 }
 
+//
+// fillArrayFilters encodes the filters on the fields of the array key
+// element of the scan.  They are for array indexes with flattened array
+// keys, where each element indexed is an array of keys, e.g.
+// ARRAY [v.a, v.b] FOR v IN arr END, so that predicates on several fields
+// of the same element are evaluated by the indexer.
+//
+func (r *ScanRequest) fillArrayFilters(protoScan *protobuf.Scan, filter *Filter) error {
+
+	if len(protoScan.ArrayFilters) == 0 {
+		return nil
+	}
+
+	if !r.IndexInst.Defn.IsArrayIndex {
+		return errors.New("Array filters are supported only for array index")
+	}
+
+	_, _, pos, err := queryutil.GetArrayExpressionPosition(r.IndexInst.Defn.SecExprs)
+	if err != nil {
+		return err
+	}
+
+	for _, fl := range protoScan.ArrayFilters {
+		l, err := r.newLowKey(fl.Low)
+		if err != nil {
+			return fmt.Errorf("Invalid low key %s (%s)", logging.TagStrUD(fl.Low), err)
+		}
+
+		h, err := r.newHighKey(fl.High)
+		if err != nil {
+			return fmt.Errorf("Invalid high key %s (%s)", logging.TagStrUD(fl.High), err)
+		}
+
+		filter.ArrayFilters = append(filter.ArrayFilters, CompositeElementFilter{
+			Low:       l,
+			High:      h,
+			Inclusion: Inclusion(fl.GetInclusion()),
+		})
+	}
+
+	filter.ArrayKeyPos = pos
+	return nil
+}
+
+//
+// fillVectorScan validates a nearest neighbor scan of a vector index.  All
+// entries of the index are compared with the query vector, so the spans of
+// the request are ignored, and distinct, reverse, group/aggregate and
+// resume key are not supported.
+//
+func (r *ScanRequest) fillVectorScan(vs *protobuf.VectorScan) error {
+
+	if vs == nil {
+		return nil
+	}
+
+	defn := &r.IndexInst.Defn
+	if !defn.IsVectorIndex() {
+		return ErrNotVectorIndex
+	}
+
+	if len(vs.GetQueryVector()) != defn.VectorDimension {
+		return fmt.Errorf("Query vector has dimension %v, index has dimension %v",
+			len(vs.GetQueryVector()), defn.VectorDimension)
+	}
+
+	if r.GroupAggr != nil || r.Distinct || r.Reverse || len(r.ResumeKey) != 0 {
+		return ErrUnsupportedRequest
+	}
+
+	maxLimit := int64(r.sco.config.Load()["scan.vector_max_limit"].Int())
+	if r.Limit <= 0 || r.Offset < 0 || r.Limit > maxLimit || r.Offset > maxLimit-r.Limit {
+		return fmt.Errorf("Limit and offset of a vector scan must be at most %v", maxLimit)
+	}
+
+	r.VectorQuery = vs.GetQueryVector()
+	r.Scans = []Scan{getScanAll()}
+	return nil
+}
+
+// canResume returns true if the scan returns its rows in index order, one
+// row per index entry, so that it can be resumed after the last entry
+// returned.  Rows of partitions scanned unsorted are interleaved.
+func (r *ScanRequest) canResume() bool {
+	return r.GroupAggr == nil && !r.Distinct && !r.Reverse && r.VectorQuery == nil &&
+		(r.Sorted || len(r.PartitionIds) <= 1)
+}
+
+// setDistinctKeys enables deduplication of a distinct scan within each
+// partition, if the projected keys are a prefix of the index keys.
+func (r *ScanRequest) setDistinctKeys() {
+
+	r.distinctKeys = 0
+	if !r.Distinct || r.isPrimary || r.GroupAggr != nil {
+		return
+	}
+
+	if r.Indexprojection == nil || !r.Indexprojection.projectSecKeys {
+		r.distinctKeys = len(r.IndexInst.Defn.SecExprs)
+		return
+	}
+
+	numKeys := 0
+	for _, project := range r.Indexprojection.projectionKeys {
+		if !project {
+			break
+		}
+		numKeys++
+	}
+
+	for _, project := range r.Indexprojection.projectionKeys[numKeys:] {
+		if project {
+			return
+		}
+	}
+
+	r.distinctKeys = numKeys
+}
+
 // Populate list of positions of keys which need to be
 // exploded for composite filtering and index projection
 func (r *ScanRequest) setExplodePositions() {
@@ -1110,6 +1310,9 @@ func (r *ScanRequest) setExplodePositions() {
 
 		for _, fl := range sc.Filters {
 			num := len(fl.CompositeFilters)
+			if len(fl.ArrayFilters) != 0 && fl.ArrayKeyPos >= num {
+				num = fl.ArrayKeyPos + 1
+			}
 			if num > maxCompositeFilters {
 				maxCompositeFilters = num
 			}
@@ -1163,6 +1366,13 @@ func (r *ScanRequest) setConsistency(cons common.Consistency, vector *protobuf.T
 		}
 		r.Ts.Crc64 = 0
 		r.Ts.Bucket = r.Bucket
+	} else if cons == common.BoundedStalenessConsistency {
+		r.Ts, localErr = r.sco.getBoundedStalenessTs(r,
+			vector.GetMaxStalenessMs(), vector.GetMaxStalenessSeqnos())
+		// Scan is served like a session consistent scan, with the
+		// timestamp lowered by the staleness bound
+		sessionCons := common.SessionConsistency
+		r.Consistency = &sessionCons
 	}
 	return
 }
@@ -1784,6 +1994,35 @@ func getReverseCollatedIndexKey(input []byte, desc []bool) (IndexKey, error) {
 	return &key, nil
 }
 
+// resumeScans returns the scans restricted to the index entries after
+// resumeKey.  Scans that end before resumeKey are removed.  Entries with the
+// same secondary key as resumeKey are still to be skipped by the caller.
+func resumeScans(scans []Scan, resumeKey []byte, isPrimary bool) []Scan {
+
+	var key IndexKey
+	if isPrimary {
+		k := primaryKey(resumeKey)
+		key = &k
+	} else {
+		k := secondaryKey(secondaryIndexEntry(resumeKey).ReadSecKeyCJson())
+		key = &k
+	}
+
+	resumed := make([]Scan, 0, len(scans))
+	for _, scan := range scans {
+		if scan.High != nil && key.CompareIndexKey(scan.High) > 0 {
+			continue
+		}
+		if scan.Low == nil || key.CompareIndexKey(scan.Low) > 0 {
+			scan.Low = key
+			scan.Incl = scan.Incl | Low
+		}
+		resumed = append(resumed, scan)
+	}
+
+	return resumed
+}
+
 func flipInclusion(incl Inclusion, desc []bool) Inclusion {
 	if len(desc) != 0 && desc[0] {
 		if incl == Low {
@@ -0,0 +1,61 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestScanRequestCanResume(t *testing.T) {
+	partns := []common.PartitionId{1, 2}
+
+	tests := []struct {
+		name string
+		r    ScanRequest
+		ok   bool
+	}{
+		{"ordered", ScanRequest{Sorted: true, PartitionIds: partns}, true},
+		{"single partition", ScanRequest{PartitionIds: partns[:1]}, true},
+		{"unsorted partitions", ScanRequest{PartitionIds: partns}, false},
+		{"distinct", ScanRequest{Sorted: true, Distinct: true}, false},
+		{"reverse", ScanRequest{Sorted: true, Reverse: true}, false},
+		{"group aggr", ScanRequest{Sorted: true, GroupAggr: &GroupAggr{}}, false},
+	}
+
+	for _, test := range tests {
+		if ok := test.r.canResume(); ok != test.ok {
+			t.Fatalf("%v: expected canResume %v, got %v", test.name, test.ok, ok)
+		}
+	}
+}
+
+func TestResumeScans(t *testing.T) {
+	key := func(s string) IndexKey {
+		k, _ := NewPrimaryKey([]byte(s))
+		return k
+	}
+
+	scans := []Scan{
+		{Low: key("a"), High: key("c"), Incl: Both},
+		{Low: key("d"), High: key("f"), Incl: High},
+		{Low: key("g"), High: key("k"), Incl: Neither},
+		{Low: nil, High: nil, Incl: Neither},
+	}
+
+	resumed := resumeScans(scans, []byte("e"), true)
+	if len(resumed) != 3 {
+		t.Fatalf("expected 3 scans, got %v", len(resumed))
+	}
+	if l := string(resumed[0].Low.Bytes()); l != "e" || resumed[0].Incl != Both {
+		t.Fatalf("expected scan to resume from e inclusive, got %v %v", l, resumed[0].Incl)
+	}
+	if l := string(resumed[1].Low.Bytes()); l != "g" || resumed[1].Incl != Neither {
+		t.Fatalf("expected scan after resume key unchanged, got %v %v", l, resumed[1].Incl)
+	}
+	if l := string(resumed[2].Low.Bytes()); l != "e" || resumed[2].Incl != Low {
+		t.Fatalf("expected unbounded scan to resume from e, got %v %v", l, resumed[2].Incl)
+	}
+	if scans[1].Low.Bytes()[0] != 'd' {
+		t.Fatal("resumeScans modified the original scans")
+	}
+}
@@ -75,11 +75,17 @@ func scanMultiple(request *ScanRequest, scan Scan, snapshots []SliceSnapshot, cb
 		partitionId := getPartitionId(request, i)
 
 		var m *allocator
-		if v := request.connCtx.Get(fmt.Sprintf("%v%v", ScanQueue, partitionId)); v == nil {
+		if v := request.connCtx.Get(fmt.Sprintf("%v%v", ScanQueue, partitionId)); v != nil {
+			m = v.(*allocator)
+		}
+
+		// scan.queue_size can change while the connection is open
+		if m == nil || m.size != int64(size) {
+			if m != nil {
+				m.Free()
+			}
 			bufPool := request.connCtx.GetBufPool(partitionId)
 			m = newAllocator(int64(size), bufPool)
-		} else {
-			m = v.(*allocator)
 		}
 
 		queues[i] = NewQueue(int64(size), int64(limit), notifych, m)
@@ -88,6 +94,7 @@ func scanMultiple(request *ScanRequest, scan Scan, snapshots []SliceSnapshot, cb
 		for i, queue := range queues {
 			queue.Close()
 			queue.Free()
+			recordScanQueueUsage(queue.EnqueueCount(), queue.FullCount())
 
 			partitionId := getPartitionId(request, i)
 			if m := queue.GetAllocator(); m != nil {
@@ -173,6 +180,11 @@ func scanSingleSlice(request *ScanRequest, scan Scan, ctx IndexReaderContext, sn
 		})
 	}()
 
+	var distinct *distinctFilter
+	if queue != nil && request.distinctKeys > 0 {
+		distinct = newDistinctFilter(request)
+	}
+
 	handler := func(entry []byte) error {
 		// Do not call enqueue when there is error.
 		if len(errch) != 0 {
@@ -182,6 +194,9 @@ func scanSingleSlice(request *ScanRequest, scan Scan, ctx IndexReaderContext, sn
 		count++
 
 		if queue != nil {
+			if distinct != nil && distinct.skip(entry, scan) {
+				return nil
+			}
 
 			var r Row
 			if !request.isPrimary {
@@ -198,7 +213,9 @@ func scanSingleSlice(request *ScanRequest, scan Scan, ctx IndexReaderContext, sn
 	}
 
 	var err error
-	if scan.ScanType == AllReq {
+	if request.Reverse {
+		err = reverseScanSingleSlice(scan, ctx, snap, handler)
+	} else if scan.ScanType == AllReq {
 		err = snap.Snapshot().All(ctx, handler)
 	} else if scan.ScanType == LookupReq {
 		err = snap.Snapshot().Range(ctx, scan.Equals, scan.Equals, Both, handler)
@@ -224,6 +241,120 @@ func scanSingleSlice(request *ScanRequest, scan Scan, ctx IndexReaderContext, sn
 	return
 }
 
+//--------------------------
+// per partition distinct
+//--------------------------
+
+// distinctFilter drops the entries of a partition having the same distinct
+// keys as the previous entry, before they are merged with other partitions.
+// Entries are compared only once they pass the composite filters of the
+// scan, so that an entry filtered out does not hide a duplicate that is
+// not. Scan pipeline removes the remaining duplicates across partitions.
+type distinctFilter struct {
+	request    *ScanRequest
+	numKeys    int
+	allKeys    bool
+	explodePos []bool
+	cktmp      [][]byte
+	buf        []byte
+	prev       []byte
+
+	// composite filter evaluation
+	hasDesc     bool
+	revbuf      []byte
+	filterbuf   []byte
+	filtertmp   [][]byte
+	cachedEntry entryCache
+}
+
+func newDistinctFilter(request *ScanRequest) *distinctFilter {
+	n := len(request.IndexInst.Defn.SecExprs)
+	f := &distinctFilter{
+		request: request,
+		numKeys: request.distinctKeys,
+		allKeys: request.distinctKeys >= n,
+		hasDesc: request.IndexInst.Defn.HasDescending(),
+	}
+
+	if !f.allKeys {
+		f.explodePos = make([]bool, n)
+		for i := 0; i < f.numKeys; i++ {
+			f.explodePos[i] = true
+		}
+		f.cktmp = make([][]byte, n)
+	}
+
+	return f
+}
+
+// filtered returns true if the entry does not match the composite filters
+// of the scan. Errors are left to the scan pipeline.
+func (f *distinctFilter) filtered(entry []byte, scan Scan) bool {
+
+	if scan.ScanType != FilterRangeReq {
+		return false
+	}
+
+	if f.hasDesc {
+		f.revbuf = append(f.revbuf[:0], entry...)
+		if _, err := jsonEncoder.ReverseCollate(f.revbuf, f.request.IndexInst.Defn.Desc); err != nil {
+			return false
+		}
+		entry = f.revbuf
+	}
+
+	if cap(f.filterbuf) < len(entry)+1024 {
+		f.filterbuf = make([]byte, 0, len(entry)+1024)
+	}
+	if f.filtertmp == nil {
+		f.filtertmp = make([][]byte, len(f.request.IndexInst.Defn.SecExprs))
+	}
+
+	skipRow, _, _, err := filterScanRow2(entry, scan, f.filterbuf[:0], f.filtertmp,
+		nil, f.request, &f.cachedEntry)
+	return err == nil && skipRow
+}
+
+func (f *distinctFilter) skip(entry []byte, scan Scan) bool {
+
+	if f.filtered(entry, scan) {
+		// dropped by scan pipeline anyway
+		return true
+	}
+
+	e := secondaryIndexEntry(entry)
+	key := entry[:e.lenKey()]
+
+	if !f.allKeys {
+		if cap(f.buf) < len(key)*3 {
+			f.buf = make([]byte, 0, len(key)*3)
+		}
+		for i := range f.cktmp {
+			f.cktmp[i] = nil
+		}
+
+		_, _, err := jsonEncoder.ExplodeArray3(key, f.buf[:0], f.cktmp, nil,
+			f.explodePos, nil, f.numKeys-1)
+		last := f.cktmp[f.numKeys-1]
+		if err != nil || last == nil {
+			// leave it to scan pipeline
+			f.prev = f.prev[:0]
+			return false
+		}
+
+		// keys are sub-slices of the entry, so the prefix ends
+		// where the last distinct key ends
+		key = key[:cap(key)-cap(last)+len(last)]
+	}
+
+	if len(f.prev) != 0 && bytes.Equal(key, f.prev) {
+		return true
+	}
+
+	f.prev = append(f.prev[:0], key...)
+	return false
+}
+
 //--------------------------
 // scatter count
 //--------------------------
@@ -676,8 +807,32 @@ func forward(request *ScanRequest, queues []*Queue, donech chan bool, notifych c
 	}
 }
 
+// Scan the slice in descending key order, if supported by the storage
+func reverseScanSingleSlice(scan Scan, ctx IndexReaderContext, snap SliceSnapshot,
+	handler EntryCallback) error {
+
+	reader, ok := snap.Snapshot().(ReverseRanger)
+	if !ok {
+		return ErrReverseScanNotSupported
+	}
+
+	if scan.ScanType == AllReq {
+		return reader.ReverseRange(ctx, MinIndexKey, MaxIndexKey, Both, handler)
+	} else if scan.ScanType == LookupReq {
+		return reader.ReverseRange(ctx, scan.Equals, scan.Equals, Both, handler)
+	} else if scan.ScanType == RangeReq || scan.ScanType == FilterRangeReq {
+		return reader.ReverseRange(ctx, scan.Low, scan.High, scan.Incl, handler)
+	}
+
+	return nil
+}
+
 func compareKey(request *ScanRequest, k1 *Row, k2 *Row) int {
 
+	if request.Reverse {
+		k1, k2 = k2, k1
+	}
+
 	if request.isPrimary {
 		return comparePrimaryKey(k1, k2)
 	}
@@ -700,6 +855,11 @@ func queueSize(partition int, sorted bool, cfg common.Config) (int, int) {
 	size := cfg["scan.queue_size"].Int()
 	limit := cfg["scan.notify_count"].Int()
 
+	// the memory controller only scales the queue up from scan.queue_size
+	if scale := getScanQueueScale(); scale > 1 {
+		size = int(float64(size) * scale)
+	}
+
 	numCpu := runtime.GOMAXPROCS(0)
 
 	if numCpu >= partition || !sorted {
@@ -0,0 +1,213 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/couchbase/indexing/secondary/collatejson"
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/query/value"
+)
+
+type vectorEntry struct {
+	dist  float64
+	entry []byte
+}
+
+// vectorHeap is a max heap of the nearest entries found so far, so that
+// the farthest of them is replaced by a nearer entry.
+type vectorHeap []vectorEntry
+
+func (h vectorHeap) Len() int            { return len(h) }
+func (h vectorHeap) Less(i, j int) bool  { return h[i].dist > h[j].dist }
+func (h vectorHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *vectorHeap) Push(x interface{}) { *h = append(*h, x.(vectorEntry)) }
+func (h *vectorHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+//
+// vectorScan returns the entries of a vector index nearest to the query
+// vector, in increasing order of distance.  Every partition is searched
+// concurrently for its nearest Offset+Limit entries, by comparing the
+// query vector with each of its entries.  The results are merged and
+// passed to fn, which applies offset, limit and projection as for any
+// other scan.  Entries whose leading key is not a vector of the index
+// dimension are not returned.
+//
+func (s *IndexScanSource) vectorScan(scan Scan, snapshots []SliceSnapshot, fn EntryCallback) error {
+
+	var wg sync.WaitGroup
+
+	r := s.p.req
+	k := int(r.Offset + r.Limit)
+	errch := make(chan error, len(snapshots))
+	results := make([]vectorHeap, len(snapshots))
+	rowsScanned := make([]uint64, len(snapshots))
+
+	for i, snap := range snapshots {
+		wg.Add(1)
+		go func(i int, snap SliceSnapshot) {
+			defer wg.Done()
+			results[i], rowsScanned[i] = s.vectorScanPartition(scan, snap, i, k, errch)
+		}(i, snap)
+	}
+	wg.Wait()
+
+	if len(errch) != 0 {
+		return <-errch
+	}
+
+	var nearest vectorHeap
+	for i, res := range results {
+		nearest = append(nearest, res...)
+		s.p.rowsScanned += rowsScanned[i]
+	}
+
+	sort.Slice(nearest, func(i, j int) bool {
+		return nearest[i].dist < nearest[j].dist
+	})
+
+	//fn counts the rows passed to it as scanned
+	s.p.rowsScanned -= uint64(len(nearest))
+
+	for _, e := range nearest {
+		if err := fn(e.entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *IndexScanSource) vectorScanPartition(scan Scan, snap SliceSnapshot, pos, k int,
+	errch chan error) (vectorHeap, uint64) {
+
+	var rowsScanned uint64
+
+	r := s.p.req
+	nearest := make(vectorHeap, 0, k)
+	vec := make([]float64, len(r.VectorQuery))
+	tmp := make([]byte, 0, 1024)
+	cktmp := make([][]byte, 1)
+	dktmp := make(value.Values, 1)
+	keyPos := []bool{true}
+
+	fn := func(entry []byte) error {
+		if rowsScanned%SCAN_ROLLBACK_ERROR_BATCHSIZE == 0 && r.hasRollback != nil && r.hasRollback.Load() == true {
+			return ErrIndexRollback
+		}
+		rowsScanned++
+
+		//decode only the leading key of the entry
+		e := secondaryIndexEntry(entry)
+		key := entry[:e.lenKey()]
+		if 3*len(key) > cap(tmp) {
+			tmp = make([]byte, 0, 3*len(key))
+		}
+		_, dk, err := jsonEncoder.ExplodeArray3(key, tmp, cktmp, dktmp, keyPos, keyPos, 0)
+		if err != nil {
+			if err == collatejson.ErrorOutputLen {
+				return err
+			}
+			return nil
+		}
+
+		if !decodeVector(dk[0], vec) {
+			return nil
+		}
+
+		dist := vectorDistance(r.IndexInst.Defn.VectorSimilarity, r.VectorQuery, vec)
+		if len(nearest) < k {
+			heap.Push(&nearest, vectorEntry{dist: dist, entry: append([]byte(nil), entry...)})
+		} else if dist < nearest[0].dist {
+			nearest[0].dist = dist
+			nearest[0].entry = append(nearest[0].entry[:0], entry...)
+			heap.Fix(&nearest, 0)
+		}
+
+		return nil
+	}
+
+	scanSingleSlice(r, scan, r.Ctxs[pos], snap, getPartitionId(r, pos), nil, nil, errch, fn)
+	return nearest, rowsScanned
+}
+
+// decodeVector returns false if val is not an array of numbers of len(vec)
+func decodeVector(val value.Value, vec []float64) bool {
+
+	if val == nil || val.Type() != value.ARRAY {
+		return false
+	}
+
+	elems, ok := val.Actual().([]interface{})
+	if !ok || len(elems) != len(vec) {
+		return false
+	}
+
+	for i := range elems {
+		elem, ok := val.Index(i)
+		if !ok {
+			return false
+		}
+
+		switch v := elem.ActualForIndex().(type) {
+		case float64:
+			vec[i] = v
+		case int64:
+			vec[i] = float64(v)
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// vectorDistance returns the distance between vectors of the same
+// dimension, smaller for vectors more similar.
+func vectorDistance(similarity string, query []float32, vec []float64) float64 {
+
+	switch similarity {
+	case common.VectorDot:
+		var dot float64
+		for i, q := range query {
+			dot += float64(q) * vec[i]
+		}
+		return -dot
+
+	case common.VectorCosine:
+		var dot, qnorm, vnorm float64
+		for i, q := range query {
+			dot += float64(q) * vec[i]
+			qnorm += float64(q) * float64(q)
+			vnorm += vec[i] * vec[i]
+		}
+		if qnorm == 0 || vnorm == 0 {
+			return 1
+		}
+		return 1 - dot/math.Sqrt(qnorm*vnorm)
+
+	default:
+		var dist float64
+		for i, q := range query {
+			d := float64(q) - vec[i]
+			dist += d * d
+		}
+		return dist
+	}
+}
@@ -11,6 +11,7 @@ package indexer
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 
@@ -19,21 +20,28 @@ import (
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/pipeline"
+	"github.com/couchbase/indexing/secondary/security"
 	"github.com/couchbase/indexing/secondary/stubs/nitro/mm"
 	"github.com/couchbase/indexing/secondary/stubs/nitro/plasma"
 
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
 	"runtime"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	indexCompactonMetaPath = common.IndexingMetaDir + "triggerCompaction"
-	compactionDaysSetting  = "indexer.settings.compaction.days_of_week"
+	indexCompactonMetaPath  = common.IndexingMetaDir + "triggerCompaction"
+	compactionDaysSetting   = "indexer.settings.compaction.days_of_week"
+	snapshotTransferDirName = "snapshot_transfer"
 )
 
 // Implements dynamic settings management for indexer
@@ -68,6 +76,14 @@ func NewSettingsManager(supvCmdch MsgChannel,
 	}
 
 	initGlobalSettings(nil, config)
+	s.config = config
+
+	// keyspace settings must be in place before slices are created
+	if ks, err := getKeyspaceSettings(); err == nil {
+		common.SetKeyspaceSettings(ks)
+	} else {
+		logging.Errorf("SettingsMgr:: Fail to get keyspace settings.  Error = %v", err)
+	}
 
 	go func() {
 		fn := func(r int, err error) error {
@@ -87,18 +103,33 @@ func NewSettingsManager(supvCmdch MsgChannel,
 
 	go s.run()
 
+	common.RegisterKeyspaceSettingsCallback(s.handleKeyspaceSettingsChange)
+	common.RegisterSettingsValidator(func(value []byte, current common.Config) error {
+		return validateSettings(value, current, false)
+	})
+
 	indexerConfig := config.SectionConfig("indexer.", true)
 	return s, indexerConfig, &MsgSuccess{}
 }
 
 func (s *settingsManager) RegisterRestEndpoints() {
 	mux := GetHTTPMux()
-	mux.HandleFunc("/settings", s.handleSettingsReq)
-	mux.HandleFunc("/internal/settings", s.handleInternalSettingsReq)
+	mux.HandleFunc("/settings", common.NetworkAllowed(s.handleSettingsReq))
+	mux.HandleFunc("/internal/settings", common.NetworkAllowed(s.handleInternalSettingsReq))
 	mux.HandleFunc("/triggerCompaction", s.handleCompactionTrigger)
-	mux.HandleFunc("/settings/runtime/freeMemory", s.handleFreeMemoryReq)
-	mux.HandleFunc("/settings/runtime/forceGC", s.handleForceGCReq)
+	mux.HandleFunc("/settings/runtime/freeMemory", common.NetworkAllowed(s.handleFreeMemoryReq))
+	mux.HandleFunc("/settings/runtime/forceGC", common.NetworkAllowed(s.handleForceGCReq))
+	mux.HandleFunc("/settings/runtime/logging", common.NetworkAllowed(s.handleLoggingReq))
+	mux.HandleFunc("/settings/profiles", common.NetworkAllowed(s.handleProfilesReq))
+	mux.HandleFunc("/settings/effective", common.NetworkAllowed(s.handleEffectiveSettingsReq))
 	mux.HandleFunc("/plasmaDiag", s.handlePlasmaDiag)
+	mux.HandleFunc("/pauseBuild", common.NetworkAllowed(s.handlePauseBuildReq))
+	mux.HandleFunc("/resumeBuild", common.NetworkAllowed(s.handleResumeBuildReq))
+	mux.HandleFunc("/exportSnapshot", s.handleExportSnapshotReq)
+	mux.HandleFunc("/importSnapshot", common.NetworkAllowed(s.handleImportSnapshotReq))
+	mux.HandleFunc("/defragment", common.NetworkAllowed(s.handleDefragmentReq))
+	mux.HandleFunc("/snapshotArchive", s.handleSnapshotArchiveReq)
+	mux.HandleFunc("/reloadCertificate", s.handleReloadCertificateReq)
 }
 
 func (s *settingsManager) writeOk(w http.ResponseWriter) {
@@ -111,6 +142,25 @@ func (s *settingsManager) writeError(w http.ResponseWriter, err error) {
 	w.Write([]byte(err.Error() + "\n"))
 }
 
+//
+// writeSettingError sends the key, value and allowed values of an invalid
+// setting in JSON.  Other errors are sent as text.
+//
+func (s *settingsManager) writeSettingError(w http.ResponseWriter, err error) {
+	serr, ok := err.(*common.SettingError)
+	if !ok {
+		s.writeError(w, err)
+		return
+	}
+
+	buf, _ := json.Marshal(serr)
+	header := w.Header()
+	header["Content-Type"] = []string{"application/json"}
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(buf)
+	w.Write([]byte("\n"))
+}
+
 func (s *settingsManager) writeJson(w http.ResponseWriter, json []byte) {
 	header := w.Header()
 	header["Content-Type"] = []string{"application/json"}
@@ -151,6 +201,8 @@ func (s *settingsManager) handleSettings(w http.ResponseWriter, r *http.Request,
 	if r.Method == "POST" {
 		bytes, _ := ioutil.ReadAll(r.Body)
 
+		var result settingsChange
+		var prevConfig common.Config
 		config := s.config.FilterConfig(".settings.")
 		current, rev, err := metakv.Get(common.IndexingSettingsMetaPath)
 		if err == nil {
@@ -161,11 +213,18 @@ func (s *settingsManager) handleSettings(w http.ResponseWriter, r *http.Request,
 			err = validateSettings(bytes, config, internal)
 			if err != nil {
 				logging.Errorf("Fail to change setting.  Error: %v", err)
-				s.writeError(w, err)
+				s.writeSettingError(w, err)
 				return
 			}
 
-			err = config.Update(bytes)
+			prevConfig = config.Clone()
+			if profile, ok := getConfigProfile(bytes); ok {
+				err = common.ApplyConfigProfile(config, profile)
+			}
+			if err == nil {
+				err = config.Update(bytes)
+			}
+			result = classifySettingsChange(prevConfig, config)
 		}
 
 		if err != nil {
@@ -175,11 +234,18 @@ func (s *settingsManager) handleSettings(w http.ResponseWriter, r *http.Request,
 
 		//settingsConfig := config.FilterConfig(".settings.")
 		newSettingsBytes := config.Json()
+		common.SetSettingsAuthor(common.IndexingSettingsMetaPath, newSettingsBytes, creds)
 		if err = metakv.Set(common.IndexingSettingsMetaPath, newSettingsBytes, rev); err != nil {
 			s.writeError(w, err)
 			return
 		}
-		s.writeOk(w)
+
+		if len(result.RestartRequired) != 0 {
+			logging.Warnf("Settings %v take effect after indexer restart", result.RestartRequired)
+		}
+
+		resp, _ := json.Marshal(result)
+		s.writeJson(w, resp)
 
 	} else if r.Method == "GET" {
 		settingsConfig, err := common.GetSettingsConfig(s.config)
@@ -203,6 +269,246 @@ func (s *settingsManager) handleSettings(w http.ResponseWriter, r *http.Request,
 	}
 }
 
+//
+// getConfigProfile returns the configuration profile selected by a settings
+// request, if any.
+//
+func getConfigProfile(value []byte) (string, bool) {
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(value, &values); err != nil {
+		return "", false
+	}
+
+	profile, ok := values["indexer.settings.config_profile"].(string)
+	return profile, ok
+}
+
+func (s *settingsManager) handleProfilesReq(w http.ResponseWriter, r *http.Request) {
+	creds, ok := s.validateAuth(w, r)
+	if !ok {
+		return
+	}
+
+	if !common.IsAllowed(creds, []string{"cluster.settings!read"}, w) {
+		return
+	}
+
+	if r.Method != "GET" {
+		s.writeError(w, errors.New("Unsupported method"))
+		return
+	}
+
+	resp := struct {
+		Current  string                            `json:"current"`
+		Profiles map[string]map[string]interface{} `json:"profiles"`
+	}{
+		Current:  s.config["indexer.settings.config_profile"].String(),
+		Profiles: common.ConfigProfiles,
+	}
+
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJson(w, buf)
+}
+
+//
+// Source of the value of a setting in /settings/effective.
+//
+const (
+	sourceDefault  = "default"  // default of the setting
+	sourceStartup  = "startup"  // set when the process starts
+	sourceCluster  = "cluster"  // cluster settings in metakv
+	sourceKeyspace = "keyspace" // keyspace override of the local indexer
+	sourceLocal    = "local"    // local metadata of the index manager
+)
+
+type effectiveSetting struct {
+	Value   interface{} `json:"value"`
+	Default interface{} `json:"default,omitempty"`
+	Source  string      `json:"source"`
+}
+
+//
+// handleEffectiveSettingsReq returns the settings the node is running with,
+// and where each value comes from.  Use ?key=<prefix> to filter settings.
+//
+func (s *settingsManager) handleEffectiveSettingsReq(w http.ResponseWriter, r *http.Request) {
+	creds, ok := s.validateAuth(w, r)
+	if !ok {
+		return
+	}
+
+	if !common.IsAllowed(creds, []string{"cluster.settings!read"}, w) {
+		return
+	}
+
+	if r.Method != "GET" {
+		s.writeError(w, errors.New("Unsupported method"))
+		return
+	}
+
+	current, _, err := metakv.Get(common.IndexingSettingsMetaPath)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	clusterSettings := make(map[string]interface{})
+	if len(current) > 0 {
+		if err := json.Unmarshal(current, &clusterSettings); err != nil {
+			s.writeError(w, err)
+			return
+		}
+	}
+
+	prefix := r.FormValue("key")
+
+	settings := make(map[string]effectiveSetting)
+	for key, cv := range s.config {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		source := sourceDefault
+		if !reflect.DeepEqual(cv.Value, cv.DefaultVal) {
+			if _, ok := clusterSettings[key]; ok {
+				source = sourceCluster
+			} else {
+				source = sourceStartup
+			}
+		}
+		settings[key] = effectiveSetting{Value: cv.Value, Default: cv.DefaultVal, Source: source}
+	}
+
+	keyspaceSettings := make(map[string]map[string]effectiveSetting)
+	for keyspace, overrides := range common.GetKeyspaceSettings() {
+		for name, value := range overrides {
+			if !strings.HasPrefix("indexer."+name, prefix) {
+				continue
+			}
+			if _, ok := keyspaceSettings[keyspace]; !ok {
+				keyspaceSettings[keyspace] = make(map[string]effectiveSetting)
+			}
+			keyspaceSettings[keyspace][name] = effectiveSetting{Value: value, Source: sourceKeyspace}
+		}
+	}
+
+	localSettings := make(map[string]effectiveSetting)
+	for name, value := range common.GetLocalSettings() {
+		if strings.HasPrefix(name, prefix) {
+			localSettings[name] = effectiveSetting{Value: value, Source: sourceLocal}
+		}
+	}
+
+	resp := struct {
+		Settings         map[string]effectiveSetting            `json:"settings"`
+		KeyspaceSettings map[string]map[string]effectiveSetting `json:"keyspaceSettings"`
+		Local            map[string]effectiveSetting            `json:"local"`
+	}{
+		Settings:         settings,
+		KeyspaceSettings: keyspaceSettings,
+		Local:            localSettings,
+	}
+
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJson(w, buf)
+}
+
+//
+// Settings which are read only when the indexer starts, in addition to the
+// immutable settings.  Any other setting takes effect when it changes.
+//
+var restartRequiredSettings = map[string]bool{
+	"indexer.settings.storage_mode":             true,
+	"indexer.settings.compaction.plasma.manual": true,
+	"indexer.settings.io_mode.plasma":           true,
+	"indexer.settings.io_mode.forestdb":         true,
+	ioModeNodeOverridesSetting:                  true,
+
+	// slice buffers are allocated when the slice is created
+	"indexer.settings.sliceBufSize": true,
+}
+
+// settingsChange is the response of a settings request.
+type settingsChange struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restartRequired"`
+}
+
+//
+// classifySettingsChange returns the changed settings, grouped by whether
+// they take effect immediately or after indexer restart.
+//
+func classifySettingsChange(oldCfg, newCfg common.Config) settingsChange {
+
+	result := settingsChange{
+		Applied:         make([]string, 0),
+		RestartRequired: make([]string, 0),
+	}
+
+	for key, cv := range newCfg {
+		if old, ok := oldCfg[key]; ok && reflect.DeepEqual(old.Value, cv.Value) {
+			continue
+		}
+
+		if requiresRestart(key, cv) {
+			result.RestartRequired = append(result.RestartRequired, key)
+		} else {
+			result.Applied = append(result.Applied, key)
+		}
+	}
+
+	sort.Strings(result.Applied)
+	sort.Strings(result.RestartRequired)
+	return result
+}
+
+//
+// history returns the changes for the settings history.
+//
+func (c settingsChange) history(oldCfg, newCfg common.Config) []common.SettingsChange {
+
+	keys := append(append([]string(nil), c.Applied...), c.RestartRequired...)
+	sort.Strings(keys)
+
+	changes := make([]common.SettingsChange, 0, len(keys))
+	for _, key := range keys {
+		change := common.SettingsChange{Key: key, New: newCfg[key].Value}
+		if old, ok := oldCfg[key]; ok {
+			change.Old = old.Value
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func requiresRestart(key string, cv common.ConfigValue) bool {
+
+	if cv.Immutable || restartRequiredSettings[key] {
+		return true
+	}
+
+	// forestdb cache size is set when the indexer starts
+	if key == "indexer.settings.memory_quota" {
+		mode := common.GetStorageMode()
+		return mode == common.FORESTDB || mode == common.NOT_SET
+	}
+
+	// only plasma slices change the number of writers of an open slice
+	if key == "indexer.numSliceWriters" {
+		return common.GetStorageMode() != common.PLASMA
+	}
+
+	return false
+}
+
 func (s *settingsManager) handleCompactionTrigger(w http.ResponseWriter, r *http.Request) {
 	creds, ok := s.validateAuth(w, r)
 	if !ok {
@@ -287,6 +593,8 @@ func (s *settingsManager) metaKVCallback(path string, value []byte, rev interfac
 		if err != nil {
 			return err
 		}
+	} else if path == common.IndexingKeyspaceSettingsMetaPath {
+		s.applyKeyspaceSettings(value)
 	} else if path == indexCompactonMetaPath {
 		currentToken := s.compactionToken
 		s.compactionToken = value
@@ -322,6 +630,54 @@ func (s *settingsManager) metaKVCallback(path string, value []byte, rev interfac
 	return nil
 }
 
+func getKeyspaceSettings() (common.KeyspaceSettings, error) {
+
+	value, _, err := metakv.Get(common.IndexingKeyspaceSettingsMetaPath)
+	if err != nil {
+		return nil, err
+	}
+	return common.ParseKeyspaceSettings(value)
+}
+
+//
+// applyKeyspaceSettings sets the keyspace settings stored in metakv, and
+// records the changes in the settings history of this node.
+//
+func (s *settingsManager) applyKeyspaceSettings(value []byte) {
+
+	ks, err := common.ParseKeyspaceSettings(value)
+	if err != nil {
+		logging.Errorf("SettingsMgr:: Fail to parse keyspace settings %s.  Error = %v", value, err)
+		return
+	}
+
+	prev := common.GetKeyspaceSettings()
+	if reflect.DeepEqual(ks, prev) {
+		return
+	}
+
+	logging.Infof("SettingsMgr:: New keyspace settings %v", ks)
+	common.SetKeyspaceSettings(ks)
+
+	author := common.TakeSettingsAuthor(common.IndexingKeyspaceSettingsMetaPath, value)
+	common.RecordSettingsChanges(author, common.KeyspaceSettingsChanges(prev, ks))
+}
+
+//
+// Keyspace settings are applied by the indexer components on config update.
+//
+func (s *settingsManager) handleKeyspaceSettingsChange() {
+
+	if !s.indexerReady {
+		return
+	}
+
+	logging.Infof("SettingsMgr:: Keyspace settings changed.  Apply to indexer.")
+	s.supvMsgch <- &MsgConfigUpdate{
+		cfg: s.config.SectionConfig("indexer.", true),
+	}
+}
+
 func (s *settingsManager) applySettings(path string, value []byte, rev interface{}) error {
 
 	logging.Infof("New settings received: \n%s", string(value))
@@ -338,7 +694,13 @@ func (s *settingsManager) applySettings(path string, value []byte, rev interface
 	config := s.config.Clone()
 	config.Update(value)
 	initGlobalSettings(s.config, config)
+
+	author := common.TakeSettingsAuthor(path, value)
+	changes := classifySettingsChange(s.config, config)
+	common.RecordSettingsChanges(author, changes.history(s.config, config))
+
 	s.config = config
+	common.NotifyConfigChange(config)
 
 	indexerConfig := s.config.SectionConfig("indexer.", true)
 	s.supvMsgch <- &MsgConfigUpdate{
@@ -379,106 +741,835 @@ func (s *settingsManager) handleForceGCReq(w http.ResponseWriter, r *http.Reques
 	s.writeOk(w)
 }
 
-func (s *settingsManager) handleIndexerReady() {
+// Runtime logging settings of this node.  The settings are not persisted,
+// and revert to the previous settings when the duration expires, or on
+// DELETE.
+type loggingSettings struct {
+	Redaction       string            `json:"redaction"`
+	ModuleLogLevels map[string]string `json:"moduleLogLevels"`
+	Duration        int64             `json:"duration,omitempty"`
+	RevertAt        string            `json:"revertAt,omitempty"`
+}
 
-	s.supvCmdch <- &MsgSuccess{}
+const defaultLoggingDuration = int64(3600)
 
-	s.indexerReady = true
+var loggingMutex sync.Mutex
+var loggingRevertTimer *time.Timer
+var loggingRevertAt time.Time
+var loggingPrevRedaction logging.RedactionLevel
+var loggingPrevLevels map[string]logging.LogLevel
 
-	if s.notifyPending {
-		logging.Infof("SettingsMgr::handleIndexerReady apply pending setting changes")
-		s.notifyPending = false
-		config, rev, err := metakv.Get(common.IndexingSettingsMetaPath)
-		if err != nil {
-			logging.Errorf("SettingsMgr::handleIndexerReady Err Metakv Get for Settings %v", err)
+func (s *settingsManager) handleLoggingReq(w http.ResponseWriter, r *http.Request) {
+	creds, ok := s.validateAuth(w, r)
+	if !ok {
+		return
+	}
+
+	if !common.IsAllowed(creds, []string{"cluster.settings!write"}, w) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+
+	case "POST":
+		bytes, _ := ioutil.ReadAll(r.Body)
+
+		var settings loggingSettings
+		if err := json.Unmarshal(bytes, &settings); err != nil {
+			s.writeError(w, err)
 			return
 		}
-		if err = s.applySettings(common.IndexingSettingsMetaPath, config, rev); err != nil {
-			logging.Errorf("SettingsMgr::handleIndexerReady Err Applying Settings %v", err)
+
+		redaction := logging.GetRedactionLevel()
+		if len(settings.Redaction) != 0 {
+			var err error
+			if redaction, err = logging.Redaction(settings.Redaction); err != nil {
+				s.writeSettingError(w, common.NewSettingError("redaction", settings.Redaction,
+					"invalid redaction level", "partial, full, none"))
+				return
+			}
+		}
+
+		levels := logging.GetModuleLogLevels()
+		if settings.ModuleLogLevels != nil {
+			levels = make(map[string]logging.LogLevel)
+			for module, level := range settings.ModuleLogLevels {
+				if !isValidLogLevel(level) {
+					s.writeSettingError(w, common.NewSettingError("moduleLogLevels."+module, level,
+						"invalid log level", "Silent, Fatal, Error, Warn, Info, Verbose, Timing, Debug, Trace"))
+					return
+				}
+				levels[module] = logging.Level(level)
+			}
+		}
+
+		if settings.Duration < 0 {
+			s.writeSettingError(w, common.NewSettingError("duration", settings.Duration,
+				"invalid duration", "0 or greater, in seconds"))
 			return
 		}
+		if settings.Duration == 0 {
+			settings.Duration = defaultLoggingDuration
+		}
+
+		logging.Infof("Received logging settings request.  Redaction %v, module log levels %v, duration %vs",
+			redaction, levels, settings.Duration)
+		setRuntimeLogging(redaction, levels, time.Duration(settings.Duration)*time.Second)
+
+	case "DELETE":
+		logging.Infof("Received logging settings request.  Revert to previous settings")
+		revertRuntimeLogging()
+
+	default:
+		s.writeError(w, errors.New("Unsupported method"))
+		return
 	}
 
+	s.writeJson(w, getRuntimeLogging())
 }
 
-func setLogger(config common.Config) {
-	logLevel := config["indexer.settings.log_level"].String()
-	level := logging.Level(logLevel)
-	logging.Infof("Setting log level to %v", level)
-	logging.SetLogLevel(level)
-}
+//
+// setRuntimeLogging applies the redaction and module log levels, and schedules
+// a revert to the settings before the first unreverted change after duration.
+//
+func setRuntimeLogging(redaction logging.RedactionLevel,
+	levels map[string]logging.LogLevel, duration time.Duration) {
 
-func setBlockPoolSize(o, n common.Config) {
-	var oldSz, newSz int
-	if o != nil {
-		oldSz = o["indexer.settings.bufferPoolBlockSize"].Int()
+	loggingMutex.Lock()
+	defer loggingMutex.Unlock()
+
+	if loggingRevertTimer == nil {
+		loggingPrevRedaction = logging.GetRedactionLevel()
+		loggingPrevLevels = logging.GetModuleLogLevels()
+	} else {
+		loggingRevertTimer.Stop()
 	}
 
-	newSz = n["indexer.settings.bufferPoolBlockSize"].Int()
+	logging.SetRedactionLevel(redaction)
+	logging.SetModuleLogLevels(levels)
 
-	if oldSz < newSz {
-		pipeline.SetupBlockPool(newSz)
-		logging.Infof("Setting buffer block size to %d bytes", newSz)
-	} else if oldSz > newSz {
-		logging.Errorf("Setting buffer block size from %d to %d failed "+
-			" - Only sizes higher than current size is allowed during runtime",
-			oldSz, newSz)
-	}
+	loggingRevertAt = time.Now().Add(duration)
+	loggingRevertTimer = time.AfterFunc(duration, revertRuntimeLogging)
 }
 
-func initGlobalSettings(oldCfg, newCfg common.Config) {
-	setBlockPoolSize(oldCfg, newCfg)
-
-	ncpu := common.SetNumCPUs(newCfg["indexer.settings.max_cpu_percent"].Int())
-	logging.Infof("Setting maxcpus = %d", ncpu)
+func revertRuntimeLogging() {
 
-	setLogger(newCfg)
-	useMutationSyncPool = newCfg["indexer.useMutationSyncPool"].Bool()
+	loggingMutex.Lock()
+	defer loggingMutex.Unlock()
 
-	newEncodeCompatMode := EncodeCompatMode(newCfg["indexer.encoding.encode_compat_mode"].Int())
-	if gEncodeCompatMode != newEncodeCompatMode {
-		gEncodeCompatMode = newEncodeCompatMode
-		logging.Infof("Set EncodeCompatMode %v", gEncodeCompatMode)
+	if loggingRevertTimer == nil {
+		return
 	}
+
+	loggingRevertTimer.Stop()
+	loggingRevertTimer = nil
+
+	logging.SetRedactionLevel(loggingPrevRedaction)
+	logging.SetModuleLogLevels(loggingPrevLevels)
+	logging.Infof("Revert logging settings.  Redaction %v, module log levels %v",
+		loggingPrevRedaction, loggingPrevLevels)
 }
 
-func validateSettings(value []byte, current common.Config, internal bool) error {
-	newConfig, err := common.NewConfig(value)
-	if err != nil {
-		return err
+func getRuntimeLogging() []byte {
+
+	loggingMutex.Lock()
+	defer loggingMutex.Unlock()
+
+	settings := loggingSettings{
+		Redaction:       logging.GetRedactionLevel().String(),
+		ModuleLogLevels: make(map[string]string),
 	}
-	if val, ok := newConfig[compactionDaysSetting]; ok {
-		for _, day := range val.Strings() {
-			if !isValidDay(day) {
-				msg := "Index circular compaction days_of_week is case-sensitive " +
-					"and must have zero or more comma-separated values of " +
-					"Sunday,Monday,Tuesday,Wednesday,Thursday,Friday,Saturday"
-				return errors.New(msg)
-			}
-		}
+	for module, level := range logging.GetModuleLogLevels() {
+		settings.ModuleLogLevels[module] = level.String()
 	}
+	if loggingRevertTimer != nil {
+		settings.RevertAt = loggingRevertAt.Format(time.RFC3339)
+	}
+
+	bytes, _ := json.Marshal(&settings)
+	return bytes
+}
 
-	if val, ok := newConfig["indexer.settings.max_seckey_size"]; ok {
-		if val.Int() <= 0 {
-			return errors.New("Setting should be an integer greater than 0")
+func isValidLogLevel(level string) bool {
+	for _, l := range []logging.LogLevel{logging.Silent, logging.Fatal, logging.Error,
+		logging.Warn, logging.Info, logging.Verbose, logging.Timing, logging.Debug, logging.Trace} {
+		if strings.ToLower(l.String()) == strings.ToLower(level) {
+			return true
 		}
 	}
+	return false
+}
 
-	if val, ok := newConfig["indexer.settings.max_array_seckey_size"]; ok {
-		if val.Int() <= 0 {
-			return errors.New("Setting should be an integer greater than 0")
-		}
+// handleReloadCertificateReq reloads the ssl certificate and key files,
+// so that a rotated certificate is used without restarting the indexer.
+func (s *settingsManager) handleReloadCertificateReq(w http.ResponseWriter, r *http.Request) {
+	creds, ok := s.validateAuth(w, r)
+	if !ok {
+		return
+	}
+
+	if !common.IsAllowed(creds, []string{"cluster.settings!write"}, w) {
+		return
+	}
+
+	if r.Method != "POST" {
+		s.writeError(w, errors.New("Unsupported method"))
+		return
+	}
+
+	logging.Infof("Received reload certificate request")
+	if err := security.ReloadCertificate(); err != nil {
+		logging.Errorf("SettingsMgr::handleReloadCertificateReq %v", err)
+		s.writeError(w, err)
+		return
+	}
+	s.writeOk(w)
+}
+
+func (s *settingsManager) handlePauseBuildReq(w http.ResponseWriter, r *http.Request) {
+	s.handleBuildControl(w, r, INDEXER_PAUSE_BUILD)
+}
+
+func (s *settingsManager) handleResumeBuildReq(w http.ResponseWriter, r *http.Request) {
+	s.handleBuildControl(w, r, INDEXER_RESUME_BUILD)
+}
+
+// handleBuildControl pauses or resumes the initial build of the index
+// instances given by the instId query parameters. All the indexes being
+// built in the same keyspace must be given, as the build of a single index
+// cannot be paused.  Such a request is rejected with 409 Conflict and the
+// list of the missing indexes.  A paused build stays paused across indexer
+// restart.
+func (s *settingsManager) handleBuildControl(w http.ResponseWriter,
+	r *http.Request, mType MsgType) {
+
+	creds, ok := s.validateAuth(w, r)
+	if !ok {
+		return
+	}
+
+	if !common.IsAllowed(creds, []string{"cluster.settings!write"}, w) {
+		return
+	}
+
+	if r.Method != "POST" {
+		s.writeError(w, errors.New("Unsupported method"))
+		return
+	}
+
+	r.ParseForm()
+	if len(r.Form["instId"]) == 0 {
+		s.writeError(w, errors.New("Missing instId"))
+		return
+	}
+
+	var instIds []common.IndexInstId
+	for _, value := range r.Form["instId"] {
+		instId, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			s.writeError(w, fmt.Errorf("Invalid instId %q", value))
+			return
+		}
+		instIds = append(instIds, common.IndexInstId(instId))
+	}
+
+	logging.Infof("SettingsMgr::handleBuildControl %v Insts %v", mType, instIds)
+
+	respCh := make(MsgChannel)
+	s.supvMsgch <- &MsgBuildControl{
+		mType:   mType,
+		instIds: instIds,
+		respCh:  respCh,
+	}
+
+	if resp := <-respCh; resp.GetMsgType() == MSG_ERROR {
+		err := resp.(*MsgError).GetError()
+		w.WriteHeader(buildControlStatus(err.code))
+		w.Write([]byte(err.cause.Error() + "\n"))
+		return
+	}
+	s.writeOk(w)
+}
+
+// buildControlStatus returns the HTTP status for a build control error.
+func buildControlStatus(code errCode) int {
+	switch code {
+	case ERROR_INDEXER_UNKNOWN_INDEX:
+		return http.StatusNotFound
+	case ERROR_INDEX_BUILD_IN_PROGRESS:
+		return http.StatusConflict
+	case ERROR_INDEXER_NOT_ACTIVE, ERROR_INDEXER_IN_RECOVERY,
+		ERROR_INDEXER_REBALANCE_IN_PROGRESS:
+		return http.StatusServiceUnavailable
+	case ERROR_INDEXER_INTERNAL_ERROR:
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+func (s *settingsManager) handleExportSnapshotReq(w http.ResponseWriter, r *http.Request) {
+	s.handleSnapshotTransfer(w, r, STORAGE_INDEX_EXPORT_SNAPSHOT)
+}
+
+func (s *settingsManager) handleImportSnapshotReq(w http.ResponseWriter, r *http.Request) {
+	s.handleSnapshotTransfer(w, r, STORAGE_INDEX_IMPORT_SNAPSHOT)
+}
+
+// handleSnapshotTransfer exports the latest disk snapshot of the index
+// partition given by the instId and partnId query parameters to dir, or
+// imports a snapshot exported to dir earlier.  For import, the snapshot
+// can instead be copied from the indexer node given by peer (its node
+// UUID), where it is taken from the same partition of the instance given
+// by peerInstId, which defaults to instId.  If load is true, the imported
+// snapshot is loaded into the index, which must not be built yet, instead
+// of on the next restart.  dir is relative to the snapshot_transfer
+// directory of the storage dir.
+func (s *settingsManager) handleSnapshotTransfer(w http.ResponseWriter,
+	r *http.Request, mType MsgType) {
+
+	creds, ok := s.validateAuth(w, r)
+	if !ok {
+		return
+	}
+
+	if !common.IsAllowed(creds, []string{"cluster.settings!write"}, w) {
+		return
+	}
+
+	if r.Method != "POST" {
+		s.writeError(w, errors.New("Unsupported method"))
+		return
+	}
+
+	instId, partnId, err := parseSnapshotPartition(r, "instId", "partnId")
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	load := false
+	if v := r.FormValue("load"); v != "" && mType == STORAGE_INDEX_IMPORT_SNAPSHOT {
+		if load, err = strconv.ParseBool(v); err != nil {
+			s.writeError(w, fmt.Errorf("Invalid load %q", v))
+			return
+		}
+	}
+
+	peer := r.FormValue("peer")
+	if peer != "" && mType == STORAGE_INDEX_IMPORT_SNAPSHOT {
+		if err := s.importPeerSnapshot(r, peer, instId, partnId, load); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeOk(w)
+		return
+	}
+
+	dir, err := snapshotTransferDir(s.config["indexer.storage_dir"].String(), r.FormValue("dir"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	logging.Infof("SettingsMgr::handleSnapshotTransfer %v Inst %v Partn %v Dir %v Load %v",
+		mType, instId, partnId, dir, load)
+
+	if err := s.transferSnapshot(mType, instId, partnId, 0, dir, load); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeOk(w)
+}
+
+// importPeerSnapshot copies the latest disk snapshot of a partition from
+// the indexer node peer, and imports it to the partition partnId of instId.
+func (s *settingsManager) importPeerSnapshot(r *http.Request, peer string,
+	instId common.IndexInstId, partnId common.PartitionId, load bool) error {
+
+	peerInstId := instId
+	if v := r.FormValue("peerInstId"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid peerInstId %q", v)
+		}
+		peerInstId = common.IndexInstId(id)
+	}
+	peerPartnId := partnId
+
+	addr, err := resolvePeerIndexer(s.config["indexer.clusterAddr"].String(), peer)
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir(s.config["indexer.storage_dir"].String(), "snapshot_import_")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	logging.Infof("SettingsMgr::importPeerSnapshot Inst %v Partn %v from Peer %v (%v) Inst %v Partn %v",
+		instId, partnId, peer, addr, peerInstId, peerPartnId)
+
+	start := time.Now()
+	timeout := time.Duration(s.config["indexer.settings.snapshot_transfer.timeout"].Int()) * time.Second
+	if err := fetchSnapshotArchive(addr, peerInstId, peerPartnId, dir, timeout); err != nil {
+		logging.Errorf("SettingsMgr::importPeerSnapshot Error fetching snapshot from %v: %v", addr, err)
+		return err
+	}
+
+	logging.Infof("SettingsMgr::importPeerSnapshot Fetched snapshot of Inst %v Partn %v from %v in %v",
+		peerInstId, peerPartnId, addr, time.Since(start))
+
+	return s.transferSnapshot(STORAGE_INDEX_IMPORT_SNAPSHOT, instId, partnId, peerInstId, dir, load)
+}
+
+// handleSnapshotArchiveReq exports the latest disk snapshot of the index
+// partition given by the instId and partnId query parameters, and sends
+// it as a tar archive.  It is used by peer indexers to import the snapshot.
+func (s *settingsManager) handleSnapshotArchiveReq(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := s.validateAuth(w, r)
+	if !ok {
+		return
+	}
+
+	if !common.IsAllowed(creds, []string{"cluster.settings!write"}, w) {
+		return
+	}
+
+	if r.Method != "GET" {
+		s.writeError(w, errors.New("Unsupported method"))
+		return
+	}
+
+	instId, partnId, err := parseSnapshotPartition(r, "instId", "partnId")
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	dir, err := ioutil.TempDir(s.config["indexer.storage_dir"].String(), "snapshot_export_")
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	logging.Infof("SettingsMgr::handleSnapshotArchiveReq Inst %v Partn %v", instId, partnId)
+
+	if err := s.transferSnapshot(STORAGE_INDEX_EXPORT_SNAPSHOT, instId, partnId, 0, dir, false); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.WriteHeader(200)
+	if err := writeSnapshotArchive(w, dir); err != nil {
+		// the response is already started, so the peer sees a truncated archive
+		logging.Errorf("SettingsMgr::handleSnapshotArchiveReq Error sending snapshot of Inst %v Partn %v: %v",
+			instId, partnId, err)
+	}
+}
+
+func parseSnapshotPartition(r *http.Request, instKey, partnKey string) (
+	common.IndexInstId, common.PartitionId, error) {
+
+	instId, err := strconv.ParseUint(r.FormValue(instKey), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid %v %q", instKey, r.FormValue(instKey))
+	}
+
+	partnId, err := strconv.ParseUint(r.FormValue(partnKey), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid %v %q", partnKey, r.FormValue(partnKey))
+	}
+
+	return common.IndexInstId(instId), common.PartitionId(partnId), nil
+}
+
+// snapshotTransferDir returns the directory a snapshot is exported to, or
+// imported from.  It must be under the snapshot_transfer directory of the
+// storage dir, and relative paths are taken from there, so that requests
+// cannot read or overwrite files elsewhere, including the index files.
+func snapshotTransferDir(storageDir, dir string) (string, error) {
+
+	if dir == "" {
+		return "", errors.New("Missing dir")
+	}
+
+	root, err := filepath.Abs(filepath.Join(storageDir, snapshotTransferDirName))
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+	dir = filepath.Clean(dir)
+
+	if !strings.HasPrefix(dir, root+string(os.PathSeparator)) {
+		return "", fmt.Errorf("Invalid dir %v. It must be under %v", dir, root)
+	}
+
+	return dir, nil
+}
+
+// transferSnapshot asks the storage manager to export or import the
+// snapshot of a partition, and waits for it to be done.  srcInstId is
+// the instance an imported snapshot is exported from, instId if 0.
+func (s *settingsManager) transferSnapshot(mType MsgType, instId common.IndexInstId,
+	partnId common.PartitionId, srcInstId common.IndexInstId, dir string, load bool) error {
+
+	respch := make(chan error)
+	s.supvMsgch <- &MsgIndexSnapshotTransfer{
+		mType:     mType,
+		instId:    instId,
+		partnId:   partnId,
+		srcInstId: srcInstId,
+		dir:       dir,
+		load:      load,
+		respch:    respch,
+	}
+
+	return <-respch
+}
+
+//
+// handleDefragmentReq compacts the partition partnId of the index instance
+// instId now, or all its partitions if partnId is not given.  Only the
+// files with at least minFrag percent fragmentation are compacted (0 by
+// default).  The response is sent once compaction is done if wait is true,
+// or immediately otherwise.
+//
+func (s *settingsManager) handleDefragmentReq(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := s.validateAuth(w, r)
+	if !ok {
+		return
+	}
+
+	if !common.IsAllowed(creds, []string{"cluster.settings!write"}, w) {
+		return
+	}
+
+	if r.Method != "POST" {
+		s.writeError(w, errors.New("Unsupported method"))
+		return
+	}
+
+	instId, err := strconv.ParseUint(r.FormValue("instId"), 10, 64)
+	if err != nil {
+		s.writeError(w, fmt.Errorf("Invalid instId %q", r.FormValue("instId")))
+		return
+	}
+
+	var minFrag int
+	if str := r.FormValue("minFrag"); str != "" {
+		if minFrag, err = strconv.Atoi(str); err != nil || minFrag < 0 || minFrag > 100 {
+			s.writeError(w, fmt.Errorf("Invalid minFrag %q", str))
+			return
+		}
+	}
+
+	var wait bool
+	if str := r.FormValue("wait"); str != "" {
+		if wait, err = strconv.ParseBool(str); err != nil {
+			s.writeError(w, fmt.Errorf("Invalid wait %q", str))
+			return
+		}
+	}
+
+	partnIds, err := s.getDefragmentPartitions(common.IndexInstId(instId), r.FormValue("partnId"))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	if err := gOnDemandCompactor.reserve(common.IndexInstId(instId), partnIds); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	logging.Infof("SettingsMgr::handleDefragmentReq Inst %v Partitions %v MinFrag %v",
+		instId, partnIds, minFrag)
+
+	maxConcurrent := s.config["indexer.settings.compaction.on_demand.max_concurrent"].Int()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(partnIds))
+	for i, partnId := range partnIds {
+		wg.Add(1)
+		go func(i int, partnId common.PartitionId) {
+			defer wg.Done()
+			errs[i] = gOnDemandCompactor.compact(s.supvMsgch, common.IndexInstId(instId), partnId,
+				minFrag, maxConcurrent)
+		}(i, partnId)
+	}
+
+	if !wait {
+		s.writeOk(w)
+		return
+	}
+
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+	}
+	s.writeOk(w)
+}
+
+//
+// getDefragmentPartitions returns the partitions to compact, which are
+// all the partitions of the index instance if partnId is empty.
+//
+func (s *settingsManager) getDefragmentPartitions(instId common.IndexInstId,
+	partnId string) ([]common.PartitionId, error) {
+
+	replych := make(chan *NodeDiskUsage)
+	s.supvMsgch <- &MsgIndexDiskUsage{respch: replych, instId: instId}
+	usage := <-replych
+
+	if instId == 0 || len(usage.Indexes) == 0 {
+		return nil, fmt.Errorf("Unknown index instance %v", instId)
+	}
+
+	var partnIds []common.PartitionId
+	for _, partn := range usage.Indexes[0].Partitions {
+		partnIds = append(partnIds, partn.PartnId)
+	}
+
+	if partnId == "" {
+		return partnIds, nil
+	}
+
+	id, err := strconv.ParseUint(partnId, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid partnId %q", partnId)
+	}
+
+	for _, pid := range partnIds {
+		if pid == common.PartitionId(id) {
+			return []common.PartitionId{pid}, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown partition %v of index instance %v", id, instId)
+}
+
+func (s *settingsManager) handleIndexerReady() {
+
+	s.supvCmdch <- &MsgSuccess{}
+
+	s.indexerReady = true
+
+	if s.notifyPending {
+		logging.Infof("SettingsMgr::handleIndexerReady apply pending setting changes")
+		s.notifyPending = false
+		config, rev, err := metakv.Get(common.IndexingSettingsMetaPath)
+		if err != nil {
+			logging.Errorf("SettingsMgr::handleIndexerReady Err Metakv Get for Settings %v", err)
+			return
+		}
+		if err = s.applySettings(common.IndexingSettingsMetaPath, config, rev); err != nil {
+			logging.Errorf("SettingsMgr::handleIndexerReady Err Applying Settings %v", err)
+			return
+		}
+	}
+
+}
+
+func setLogger(config common.Config) {
+	logLevel := config["indexer.settings.log_level"].String()
+	level := logging.Level(logLevel)
+	logging.Infof("Setting log level to %v", level)
+	logging.SetLogLevel(level)
+}
+
+func setNetworkAllowlist(config common.Config) {
+	allowlist := config["indexer.settings.network_allowlist"].String()
+	if err := common.SetNetworkAllowlist(allowlist); err != nil {
+		logging.Errorf("Setting network allowlist %v failed: %v", allowlist, err)
+		return
+	}
+	logging.Infof("Setting network allowlist to %v", allowlist)
+}
+
+func setTokenAuth(config common.Config) {
+	enable := config["indexer.settings.enable_token_auth"].Bool()
+	common.SetTokenAuth(enable, config["indexer.clusterAddr"].String())
+	logging.Infof("Setting token auth to %v", enable)
+}
+
+func setBlockPoolSize(o, n common.Config) {
+	var oldSz, newSz int
+	if o != nil {
+		oldSz = o["indexer.settings.bufferPoolBlockSize"].Int()
+	}
+
+	newSz = n["indexer.settings.bufferPoolBlockSize"].Int()
+
+	if oldSz < newSz {
+		pipeline.SetupBlockPool(newSz)
+		logging.Infof("Setting buffer block size to %d bytes", newSz)
+	} else if oldSz > newSz {
+		logging.Errorf("Setting buffer block size from %d to %d failed "+
+			" - Only sizes higher than current size is allowed during runtime",
+			oldSz, newSz)
+	}
+}
+
+func initGlobalSettings(oldCfg, newCfg common.Config) {
+	setBlockPoolSize(oldCfg, newCfg)
+
+	ncpu := common.SetNumCPUs(newCfg["indexer.settings.max_cpu_percent"].Int())
+	logging.Infof("Setting maxcpus = %d", ncpu)
+
+	setLogger(newCfg)
+	setNetworkAllowlist(newCfg)
+	setTokenAuth(newCfg)
+	useMutationSyncPool = newCfg["indexer.useMutationSyncPool"].Bool()
+
+	newEncodeCompatMode := EncodeCompatMode(newCfg["indexer.encoding.encode_compat_mode"].Int())
+	if gEncodeCompatMode != newEncodeCompatMode {
+		gEncodeCompatMode = newEncodeCompatMode
+		logging.Infof("Set EncodeCompatMode %v", gEncodeCompatMode)
+	}
+}
+
+//
+// validateDcpIdleTimeout checks that the DCP connections of the projector
+// are not closed while idle, between two noops.
+//
+func validateDcpIdleTimeout(newConfig common.Config, current common.Config) error {
+
+	const noopSetting = "projector.settings.dcp.noop_interval"
+	const idleSetting = "projector.settings.dcp.idle_timeout"
+
+	noopVal, ok1 := newConfig[noopSetting]
+	idleVal, ok2 := newConfig[idleSetting]
+	if !ok1 && !ok2 {
+		return nil
+	}
+	if !ok1 {
+		noopVal = current[noopSetting]
+	}
+	if !ok2 {
+		idleVal = current[idleSetting]
+	}
+
+	if idle := idleVal.Int(); idle != 0 && idle <= 2*noopVal.Int() {
+		return common.NewSettingError(idleSetting, idleVal.Value,
+			fmt.Sprintf("DCP idle timeout must be more than twice the noop interval %v",
+				noopVal.Int()), "0 or more than twice noop_interval")
+	}
+	return nil
+}
+
+//
+// validateColdTierSettings checks that the cold tier is only enabled with
+// memory optimized storage, whose slices can offload their disk snapshots,
+// and that offloaded snapshots are refreshed.
+//
+func validateColdTierSettings(newConfig common.Config, current common.Config) error {
+
+	const enableSetting = "indexer.settings.cold_tier.enable"
+	const refreshSetting = "indexer.settings.cold_tier.refresh_period"
+	const storageModeSetting = "indexer.settings.storage_mode"
+
+	if val, ok := newConfig[refreshSetting]; ok && val.Uint64() == 0 {
+		return common.NewSettingError(refreshSetting, val.Value,
+			"Offloaded index partitions must be refreshed", "1 or greater")
+	}
+
+	enableVal, ok := newConfig[enableSetting]
+	if !ok {
+		enableVal, ok = current[enableSetting]
+	}
+	if !ok || !enableVal.Bool() {
+		return nil
+	}
+
+	modeVal, ok := newConfig[storageModeSetting]
+	if !ok {
+		modeVal, ok = current[storageModeSetting]
+	}
+	if !ok {
+		return nil
+	}
+
+	if mode := strings.ToLower(modeVal.String()); mode != common.MemoryOptimized && mode != common.MemDB {
+		return common.NewSettingError(enableSetting, enableVal.Value,
+			fmt.Sprintf("Cold tier is not supported by storage mode %v", modeVal.String()),
+			common.MemoryOptimized)
+	}
+	return nil
+}
+
+//
+// validateSettings validates the type and range of each setting, and the
+// values of settings with specific formats.  It returns *common.SettingError
+// for an invalid setting.
+//
+func validateSettings(value []byte, current common.Config, internal bool) error {
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(value, &values); err != nil {
+		return err
+	}
+
+	for key, val := range values {
+		if err := common.ValidateSetting(key, val); err != nil {
+			return err
+		}
+	}
+
+	newConfig, err := common.NewConfig(values)
+	if err != nil {
+		return err
+	}
+	if val, ok := newConfig[compactionDaysSetting]; ok {
+		for _, day := range val.Strings() {
+			if !isValidDay(day) {
+				msg := "Index circular compaction days_of_week is case-sensitive " +
+					"and must have zero or more comma-separated values"
+				return common.NewSettingError(compactionDaysSetting, val.Value, msg,
+					"Sunday,Monday,Tuesday,Wednesday,Thursday,Friday,Saturday")
+			}
+		}
+	}
+
+	if val, ok := newConfig["indexer.settings.config_profile"]; ok {
+		if err := common.ValidateConfigProfile(val.String()); err != nil {
+			return err
+		}
+	}
+
+	if err := validateIOModeSettings(newConfig); err != nil {
+		return err
+	}
+
+	if err := validateDcpIdleTimeout(newConfig, current); err != nil {
+		return err
+	}
+
+	if err := validateColdTierSettings(newConfig, current); err != nil {
+		return err
 	}
 
-	if val, ok := newConfig["indexer.statsPersistenceInterval"]; ok {
-		if val.Uint64() < 0 {
-			return errors.New("statsPersistenceInterval should be an integer 0 or greater")
+	if val, ok := newConfig["projector.dcp.topicConnections"]; ok {
+		if _, err := common.ParseTopicConnections(val.String()); err != nil {
+			return common.NewSettingError("projector.dcp.topicConnections", val.Value,
+				err.Error(), fmt.Sprintf("comma separated <topic-prefix>=<1 to %v>",
+					common.MaxDcpConnections))
 		}
 	}
 
-	if val, ok := newConfig["indexer.statsPersistenceChunkSize"]; ok {
-		if val.Int() <= 0 {
-			return errors.New("statsPersistenceChunkSize should be an integer greater than 0")
+	if val, ok := newConfig["indexer.settings.network_allowlist"]; ok {
+		if _, err := common.ParseNetworkAllowlist(val.String()); err != nil {
+			return common.NewSettingError("indexer.settings.network_allowlist", val.Value,
+				err.Error(), "comma separated list of CIDRs")
 		}
 	}
 
@@ -491,21 +1582,26 @@ func validateSettings(value []byte, current common.Config, internal bool) error
 						if currentVal.String() == val.String() {
 							return nil
 						}
-						return fmt.Errorf("Storage mode is already set to %v", currentVal)
+						return common.NewSettingError("indexer.settings.storage_mode", val.Value,
+							"Storage mode is already set", currentVal.String())
 					}
 				}
 
 				storageMode := strings.ToLower(val.String())
 				if common.GetBuildMode() == common.ENTERPRISE {
 					if storageMode == common.ForestDB {
-						return errors.New("ForestDB storage mode is not supported for enterprise version")
+						return common.NewSettingError("indexer.settings.storage_mode", val.Value,
+							"ForestDB storage mode is not supported for enterprise version",
+							common.PlasmaDB+", "+common.MemoryOptimized)
 					}
 				} else {
 					if storageMode == common.PlasmaDB {
-						return errors.New("Plasma storage mode is not supported for community version")
+						return common.NewSettingError("indexer.settings.storage_mode", val.Value,
+							"Plasma storage mode is not supported for community version", common.ForestDB)
 					}
 					if storageMode == common.MemoryOptimized || storageMode == common.MemDB {
-						return errors.New("Memory optimized storage mode is not supported for community version")
+						return common.NewSettingError("indexer.settings.storage_mode", val.Value,
+							"Memory optimized storage mode is not supported for community version", common.ForestDB)
 					}
 				}
 			}
@@ -0,0 +1,80 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestValidateColdTierSettings(t *testing.T) {
+
+	current := common.SystemConfig.Clone()
+	current.SetValue("indexer.settings.storage_mode", common.PlasmaDB)
+
+	tests := []struct {
+		values map[string]interface{}
+		ok     bool
+	}{
+		{map[string]interface{}{"indexer.settings.cold_tier.enable": false}, true},
+		{map[string]interface{}{"indexer.settings.cold_tier.enable": true}, false},
+		{map[string]interface{}{
+			"indexer.settings.cold_tier.enable": true,
+			"indexer.settings.storage_mode":     common.MemoryOptimized,
+		}, true},
+		{map[string]interface{}{"indexer.settings.cold_tier.refresh_period": float64(3600)}, true},
+		{map[string]interface{}{"indexer.settings.cold_tier.refresh_period": float64(0)}, false},
+	}
+
+	for _, test := range tests {
+		newConfig, err := common.NewConfig(test.values)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = validateColdTierSettings(newConfig, current)
+		if (err == nil) != test.ok {
+			t.Fatalf("%v: expected ok %v, got %v", test.values, test.ok, err)
+		}
+	}
+
+	// a change of other settings is valid once the cold tier is enabled
+	current.SetValue("indexer.settings.storage_mode", common.MemoryOptimized)
+	current.SetValue("indexer.settings.cold_tier.enable", true)
+
+	newConfig, _ := common.NewConfig(map[string]interface{}{"indexer.settings.cold_tier.idle_period": float64(60)})
+	if err := validateColdTierSettings(newConfig, current); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateDcpConnectionSettings(t *testing.T) {
+
+	current := common.SystemConfig.Clone()
+
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{`{"projector.dcp.topicConnections": ""}`, true},
+		{`{"projector.dcp.topicConnections": "MAINT_STREAM_TOPIC=8,INIT_STREAM_TOPIC=2"}`, true},
+		{`{"projector.dcp.topicConnections": "MAINT_STREAM_TOPIC=10000"}`, false},
+		{`{"projector.dcp.topicConnections": "MAINT_STREAM_TOPIC=0"}`, false},
+		{`{"projector.dcp.topicConnections": "MAINT_STREAM_TOPIC"}`, false},
+		{`{"projector.dcp.numConnections": 16}`, true},
+		{`{"projector.dcp.numConnections": 0}`, false},
+		{`{"projector.dcp.numConnections": 10000}`, false},
+	}
+
+	for _, test := range tests {
+		err := validateSettings([]byte(test.value), current, true)
+		if (err == nil) != test.ok {
+			t.Fatalf("%v: expected ok %v, got %v", test.value, test.ok, err)
+		}
+
+		if err != nil {
+			if _, ok := err.(*common.SettingError); !ok {
+				t.Fatalf("%v: unexpected error %#v", test.value, err)
+			}
+		}
+	}
+}
@@ -10,6 +10,8 @@
 package indexer
 
 import (
+	"time"
+
 	"github.com/couchbase/indexing/secondary/common"
 )
 
@@ -47,6 +49,68 @@ type Slice interface {
 	RecoveryDone()
 }
 
+// ResidentLimiter is implemented by slices that can limit the amount of
+// index data kept in memory, when the index instance is over its memory quota.
+type ResidentLimiter interface {
+	SetResidentLimited(bool)
+}
+
+// SnapshotExporter is implemented by slices that can copy their latest
+// disk snapshot out to a directory, and add a disk snapshot copied that
+// way back as the latest disk snapshot of the slice.  LoadSnapshot loads
+// the latest disk snapshot into a slice which has no data yet.
+type SnapshotExporter interface {
+	ExportSnapshot(dir string) (SnapshotInfo, error)
+	ImportSnapshot(dir string) error
+	LoadSnapshot() (SnapshotInfo, error)
+}
+
+// ColdTierSlice is implemented by slices whose disk snapshots can be moved
+// to the cold tier.  While offloaded, the slice removes its disk snapshots
+// and does not write new ones.  It is recovered from the snapshot hydrated
+// from the cold tier with RestoreSnapshot.
+type ColdTierSlice interface {
+	SnapshotExporter
+	SetOffloaded(bool) error
+	RestoreSnapshot(dir string) error
+}
+
+// InitialBuildSlice is implemented by slices which limit their writers to
+// build_writer_threads of the index during the initial build.
+// InitialBuildDone is called once the index is active.
+type InitialBuildSlice interface {
+	InitialBuildDone()
+}
+
+// SnapshotRetentionSlice is implemented by slices which keep several disk
+// snapshots for rollback.  EnforceSnapshotRetention removes the disk
+// snapshots which are not retained by settings.snapshot_retention.
+type SnapshotRetentionSlice interface {
+	EnforceSnapshotRetention()
+}
+
+//
+// getSnapshotRetention returns the number of disk snapshots retained by a
+// slice, the max number of disk snapshots and the max age of a disk
+// snapshot (0 if disabled).  snapshot_retention.count overrides the
+// max_rollbacks setting of the storage mode.
+//
+func getSnapshotRetention(cfg common.Config, maxRollbacksKey string) (int, int, time.Duration) {
+
+	maxRollbacks := cfg[maxRollbacksKey].Int()
+	if count := cfg["settings.snapshot_retention.count"].Int(); count > 0 {
+		maxRollbacks = count
+	}
+
+	maxDiskSnaps := cfg["recovery.max_disksnaps"].Int()
+	if maxDiskSnaps < maxRollbacks {
+		maxDiskSnaps = maxRollbacks
+	}
+
+	maxAge := time.Duration(cfg["settings.snapshot_retention.max_age"].Uint64()) * time.Second
+	return maxRollbacks, maxDiskSnaps, maxAge
+}
+
 // cursorCtx implements IndexReaderContext and is used
 // for tracking previous cursor key for multiple scans
 // for distinct rows
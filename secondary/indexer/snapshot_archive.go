@@ -0,0 +1,179 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/security"
+)
+
+//
+// An exported partition snapshot is shipped between indexer nodes as a
+// tar archive of the export directory, so that an index partition can be
+// relocated by copying its storage files instead of rebuilding it from
+// the projector.  The destination imports the snapshot into its own
+// partition, and the mutations after the snapshot are caught up from DCP
+// when the index is recovered from it.
+//
+
+// writeSnapshotArchive writes the files under dir to w as a tar archive
+func writeSnapshotArchive(w io.Writer, dir string) error {
+
+	tw := tar.NewWriter(w)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// readSnapshotArchive extracts the tar archive read from r to dir
+func readSnapshotArchive(r io.Reader, dir string) error {
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("Invalid file %v in snapshot archive", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("Unsupported file %v in snapshot archive", hdr.Name)
+		}
+	}
+}
+
+//
+// resolvePeerIndexer returns the http address of the indexer node with the
+// given node UUID.  Only the indexer nodes of the cluster are accepted, so
+// that the credentials of the request are never sent elsewhere.
+//
+func resolvePeerIndexer(clusterAddr string, nodeUUID string) (string, error) {
+
+	cinfo, err := common.FetchNewClusterInfoCache(clusterAddr, common.DEFAULT_POOL, "resolvePeerIndexer")
+	if err != nil {
+		return "", fmt.Errorf("Error Fetching Cluster Information %v", err)
+	}
+
+	nid, found := cinfo.GetNodeIdByUUID(nodeUUID)
+	if !found {
+		return "", fmt.Errorf("Node %v not found in the cluster", nodeUUID)
+	}
+
+	for _, indexerId := range cinfo.GetNodesByServiceType(common.INDEX_HTTP_SERVICE) {
+		if indexerId == nid {
+			return cinfo.GetServiceAddress(nid, common.INDEX_HTTP_SERVICE)
+		}
+	}
+
+	return "", fmt.Errorf("Node %v is not an indexer node", nodeUUID)
+}
+
+//
+// fetchSnapshotArchive downloads the latest disk snapshot of the partition
+// of the index instance on the indexer at peer (its http address, as given
+// by resolvePeerIndexer), and extracts it to dir.
+//
+func fetchSnapshotArchive(peer string, instId common.IndexInstId,
+	partnId common.PartitionId, dir string, timeout time.Duration) error {
+
+	params := url.Values{}
+	params.Set("instId", fmt.Sprintf("%v", instId))
+	params.Set("partnId", fmt.Sprintf("%v", partnId))
+
+	resp, err := security.GetWithAuth(peer+"/snapshotArchive?"+params.Encode(),
+		&security.RequestParams{Timeout: timeout})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Fail to fetch snapshot from %v: %v %s", peer, resp.Status, msg)
+	}
+
+	return readSnapshotArchive(resp.Body, dir)
+}
@@ -0,0 +1,236 @@
+package indexer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestSnapshotTransferDir(t *testing.T) {
+	storageDir, err := ioutil.TempDir("", "snapshot_transfer_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(storageDir)
+
+	root, _ := filepath.Abs(filepath.Join(storageDir, snapshotTransferDirName))
+
+	dir, err := snapshotTransferDir(storageDir, "backup/idx1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != filepath.Join(root, "backup", "idx1") {
+		t.Fatalf("unexpected dir %v", dir)
+	}
+
+	if dir, err := snapshotTransferDir(storageDir, filepath.Join(root, "idx2")); err != nil || dir != filepath.Join(root, "idx2") {
+		t.Fatalf("unexpected dir %v err %v", dir, err)
+	}
+
+	for _, bad := range []string{
+		"",
+		".",
+		"../",
+		"../@2i",
+		"a/../../b",
+		"/etc",
+		storageDir,
+		filepath.Join(storageDir, "@2i"),
+		root,
+	} {
+		if dir, err := snapshotTransferDir(storageDir, bad); err == nil {
+			t.Fatalf("expected error for %q, got %v", bad, dir)
+		}
+	}
+}
+
+func TestValidateSnapshotExportManifest(t *testing.T) {
+	expected := snapshotExportManifest{
+		InstId:      100,
+		PartnId:     2,
+		Bucket:      "b",
+		Scope:       "s",
+		Collection:  "c",
+		Name:        "idx",
+		StorageMode: common.StorageMode(common.MOI).String(),
+	}
+
+	exported := expected
+	if err := validateSnapshotExportManifest(&exported, &expected); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, modify := range map[string]func(m *snapshotExportManifest){
+		"instId":      func(m *snapshotExportManifest) { m.InstId = 101 },
+		"partnId":     func(m *snapshotExportManifest) { m.PartnId = 3 },
+		"bucket":      func(m *snapshotExportManifest) { m.Bucket = "b1" },
+		"scope":       func(m *snapshotExportManifest) { m.Scope = "s1" },
+		"collection":  func(m *snapshotExportManifest) { m.Collection = "c1" },
+		"name":        func(m *snapshotExportManifest) { m.Name = "idx1" },
+		"storageMode": func(m *snapshotExportManifest) { m.StorageMode = common.StorageMode(common.PLASMA).String() },
+		"empty":       func(m *snapshotExportManifest) { *m = snapshotExportManifest{} },
+	} {
+		exported := expected
+		modify(&exported)
+		if err := validateSnapshotExportManifest(&exported, &expected); err == nil {
+			t.Fatalf("%v: expected error", name)
+		}
+	}
+}
+
+func TestSnapshotExportManifestReadWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot_manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := snapshotExportManifest{InstId: 1, PartnId: 2, Name: "idx", Seqnos: []uint64{1, 2}}
+	if err := writeSnapshotExportManifest(dir, &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	var read snapshotExportManifest
+	if err := readSnapshotExportManifest(dir, &read); err != nil {
+		t.Fatal(err)
+	}
+	if read.InstId != 1 || read.PartnId != 2 || read.Name != "idx" || len(read.Seqnos) != 2 {
+		t.Fatalf("unexpected manifest %+v", read)
+	}
+}
+
+func TestMemDBImportSnapshot(t *testing.T) {
+	base, err := ioutil.TempDir("", "memdb_import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	src := filepath.Join(base, "export")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	mdb := &memdbSlice{path: filepath.Join(base, "slice")}
+	if err := os.MkdirAll(mdb.path, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// no manifest
+	if err := mdb.ImportSnapshot(src); err == nil {
+		t.Fatal("expected error for missing manifest")
+	}
+	if atomic.LoadInt32(&mdb.imported) != 0 {
+		t.Fatal("slice marked imported after failed import")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(src, "manifest.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// persistor is active
+	atomic.StoreInt32(&mdb.isPersistorActive, 1)
+	if err := mdb.ImportSnapshot(src); err == nil {
+		t.Fatal("expected error while persistor is active")
+	}
+	atomic.StoreInt32(&mdb.isPersistorActive, 0)
+
+	if err := mdb.ImportSnapshot(src); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&mdb.imported) != 1 {
+		t.Fatal("slice not marked imported")
+	}
+	if manifests := mdb.getSnapshotManifests(); len(manifests) != 1 {
+		t.Fatalf("expected 1 snapshot, got %v", manifests)
+	}
+
+	// retention does not remove the imported snapshot
+	mdb.maxRollbacks = 0
+	mdb.EnforceSnapshotRetention()
+	if manifests := mdb.getSnapshotManifests(); len(manifests) != 1 {
+		t.Fatalf("imported snapshot removed, got %v", manifests)
+	}
+}
+
+func TestMemDBLoadSnapshot(t *testing.T) {
+	base, err := ioutil.TempDir("", "memdb_load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	mdb := &memdbSlice{path: filepath.Join(base, "slice")}
+	if err := os.MkdirAll(mdb.path, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// no snapshot
+	if _, err := mdb.LoadSnapshot(); err == nil {
+		t.Fatal("expected error without snapshot")
+	}
+
+	src := filepath.Join(base, "export")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "manifest.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := mdb.ImportSnapshot(src); err != nil {
+		t.Fatal(err)
+	}
+
+	// persistor is active
+	atomic.StoreInt32(&mdb.isPersistorActive, 1)
+	if _, err := mdb.LoadSnapshot(); err == nil {
+		t.Fatal("expected error while persistor is active")
+	}
+	atomic.StoreInt32(&mdb.isPersistorActive, 0)
+
+	// slice has data
+	atomic.StoreUint64(&mdb.committedCount, 1)
+	if _, err := mdb.LoadSnapshot(); err == nil {
+		t.Fatal("expected error for slice with data")
+	}
+	if atomic.LoadInt32(&mdb.imported) != 1 {
+		t.Fatal("imported snapshot dropped by failed load")
+	}
+}
+
+func TestSetTokenBuildSource(t *testing.T) {
+	newToken := func(source string, mode common.TokenTransferMode, using common.IndexType) *common.TransferToken {
+		tt := &common.TransferToken{SourceId: source, TransferMode: mode}
+		tt.IndexInst.Defn.Using = using
+		return tt
+	}
+
+	tokens := map[string]*common.TransferToken{
+		"moi":     newToken("n1", common.TokenTransferModeMove, common.MemoryOptimized),
+		"plasma":  newToken("n1", common.TokenTransferModeMove, common.PlasmaDB),
+		"copy":    newToken("n1", common.TokenTransferModeCopy, common.MemoryOptimized),
+		"created": newToken("", common.TokenTransferModeMove, common.MemoryOptimized),
+	}
+
+	setTokenBuildSource(tokens, false)
+	for name, tt := range tokens {
+		if tt.BuildSource != common.TokenBuildSourceDcp {
+			t.Fatalf("%v: unexpected build source %v with copy disabled", name, tt.BuildSource)
+		}
+	}
+
+	setTokenBuildSource(tokens, true)
+	for name, tt := range tokens {
+		expected := common.TokenBuildSourceDcp
+		if name == "moi" {
+			expected = common.TokenBuildSourcePeer
+		}
+		if tt.BuildSource != expected {
+			t.Fatalf("%v: expected build source %v, got %v", name, expected, tt.BuildSource)
+		}
+	}
+}
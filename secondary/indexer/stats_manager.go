@@ -62,6 +62,10 @@ type BucketStats struct {
 
 	tsQueueSize   stats.Int64Val
 	numNonAlignTS stats.Int64Val
+
+	numScansQueued       stats.Int64Val
+	numScansRejected     stats.Int64Val
+	scanThrottleDuration stats.Int64Val
 }
 
 func (s *BucketStats) Init() {
@@ -70,6 +74,9 @@ func (s *BucketStats) Init() {
 	s.numMutationsQueued.Init()
 	s.tsQueueSize.Init()
 	s.numNonAlignTS.Init()
+	s.numScansQueued.Init()
+	s.numScansRejected.Init()
+	s.scanThrottleDuration.Init()
 }
 
 func (s *BucketStats) addBucketStatsToMap(statMap *StatsMap) {
@@ -78,6 +85,9 @@ func (s *BucketStats) addBucketStatsToMap(statMap *StatsMap) {
 	statMap.AddStatValueFiltered("num_mutations_queued", &s.numMutationsQueued)
 	statMap.AddStatValueFiltered("ts_queue_size", &s.tsQueueSize)
 	statMap.AddStatValueFiltered("num_nonalign_ts", &s.numNonAlignTS)
+	statMap.AddStatValueFiltered("num_scans_queued", &s.numScansQueued)
+	statMap.AddStatValueFiltered("num_scans_rejected", &s.numScansRejected)
+	statMap.AddStatValueFiltered("scan_throttle_duration", &s.scanThrottleDuration)
 
 	if st := common.BucketSeqsTiming(s.bucket); st != nil {
 		statMap.AddStatValueFiltered("timings/dcp_getseqs", st)
@@ -162,6 +172,9 @@ type IndexStats struct {
 	memUsed                   stats.Int64Val
 	buildProgress             stats.Int64Val
 	completionProgress        stats.Int64Val
+	buildEta                  stats.Int64Val
+	avgBuildRate              stats.Int64Val
+	lastBuildStatTime         stats.Int64Val
 	numDocsQueued             stats.Int64Val
 	deleteBytes               stats.Int64Val
 	dataSize                  stats.Int64Val
@@ -177,6 +190,12 @@ type IndexStats struct {
 	numSnapshots              stats.Int64Val
 	numOpenSnapshots          stats.Int64Val
 	numCompactions            stats.Int64Val
+	numCompactionsDeferred    stats.Int64Val
+	numScrubErrors            stats.Int64Val
+	bloomFilterHits           stats.Int64Val
+	bloomFilterMisses         stats.Int64Val
+	bloomFilterFalsePositives stats.Int64Val
+	bloomFilterSize           stats.Int64Val
 	numItemsFlushed           stats.Int64Val
 	avgTsInterval             stats.Int64Val
 	avgTsItemsCount           stats.Int64Val
@@ -193,6 +212,7 @@ type IndexStats struct {
 	notReadyError             stats.Int64Val
 	clientCancelError         stats.Int64Val
 	numScanTimeouts           stats.Int64Val
+	numScanDeadlineTimeouts   stats.Int64Val
 	numScanErrors             stats.Int64Val
 	avgScanRate               stats.Int64Val
 	avgMutationRate           stats.Int64Val
@@ -346,6 +366,9 @@ func (s *IndexStats) Init() {
 	s.memUsed.Init()
 	s.buildProgress.Init()
 	s.completionProgress.Init()
+	s.buildEta.Init()
+	s.avgBuildRate.Init()
+	s.lastBuildStatTime.Init()
 	s.numDocsQueued.Init()
 	s.deleteBytes.Init()
 	s.dataSize.Init()
@@ -366,6 +389,12 @@ func (s *IndexStats) Init() {
 	s.numSnapshots.Init()
 	s.numOpenSnapshots.Init()
 	s.numCompactions.Init()
+	s.numCompactionsDeferred.Init()
+	s.numScrubErrors.Init()
+	s.bloomFilterHits.Init()
+	s.bloomFilterMisses.Init()
+	s.bloomFilterFalsePositives.Init()
+	s.bloomFilterSize.Init()
 	s.numItemsFlushed.Init()
 	s.numDocsFlushQueued.Init()
 	s.sinceLastSnapshot.Init()
@@ -377,6 +406,7 @@ func (s *IndexStats) Init() {
 	s.notReadyError.Init()
 	s.clientCancelError.Init()
 	s.numScanTimeouts.Init()
+	s.numScanDeadlineTimeouts.Init()
 	s.numScanErrors.Init()
 	s.avgScanRate.Init()
 	s.avgMutationRate.Init()
@@ -455,6 +485,7 @@ func (s *IndexStats) SetRebalancerFilters() {
 func (s *IndexStats) SetIndexStatusFilters() {
 	s.buildProgress.AddFilter(stats.IndexStatusFilter)
 	s.completionProgress.AddFilter(stats.IndexStatusFilter)
+	s.buildEta.AddFilter(stats.IndexStatusFilter)
 	s.lastScanTime.AddFilter(stats.IndexStatusFilter)
 }
 
@@ -464,6 +495,9 @@ func (s *IndexStats) SetGSIClientFilters() {
 	s.lastRollbackTime.AddFilter(stats.GSIClientFilter)
 	s.progressStatTime.AddFilter(stats.GSIClientFilter)
 	s.indexState.AddFilter(stats.GSIClientFilter)
+	s.numRequests.AddFilter(stats.GSIClientFilter)
+	s.numCompletedRequests.AddFilter(stats.GSIClientFilter)
+	s.avgScanLatency.AddFilter(stats.GSIClientFilter)
 }
 
 func (s *IndexStats) SetPlannerFilters() {
@@ -625,6 +659,36 @@ type IndexerStats struct {
 	pauseTotalNs   stats.Uint64Val
 
 	indexerStateHolder stats.StringVal
+
+	rebalanceTransferBytes    stats.Int64Val
+	rebalanceThrottleDuration stats.Int64Val
+
+	streamPriorityWaitDuration stats.Int64Val
+
+	streamRepairAttempts  stats.Int64Val
+	numUnrecoveredStreams stats.Int64Val
+
+	numVbucketRollbacks       stats.Int64Val
+	numVbucketRollbacksToZero stats.Int64Val
+	numRollbackIndexResets    stats.Int64Val
+
+	memoryAllocMutationQueue    stats.Int64Val
+	memoryAllocBlockCache       stats.Int64Val
+	memoryAllocScanBuffers      stats.Int64Val
+	memoryControllerAdjustments stats.Int64Val
+
+	coldTierOffloadedPartitions stats.Int64Val
+	coldTierOffloadedBytes      stats.Int64Val
+	coldTierOffloads            stats.Int64Val
+	coldTierHydrations          stats.Int64Val
+	coldTierFailures            stats.Int64Val
+
+	maintenancePending   stats.Int64Val
+	maintenanceRunning   stats.Int64Val
+	maintenanceCompleted stats.Int64Val
+	maintenanceCoalesced stats.Int64Val
+	maintenanceDeferrals stats.Int64Val
+	maintenanceForced    stats.Int64Val
 }
 
 func (s *IndexerStats) Init() {
@@ -656,6 +720,29 @@ func (s *IndexerStats) Init() {
 	s.memoryTotal.Init()
 	s.indexerStateHolder.Init()
 	s.pauseTotalNs.Init()
+	s.rebalanceTransferBytes.Init()
+	s.rebalanceThrottleDuration.Init()
+	s.streamPriorityWaitDuration.Init()
+	s.streamRepairAttempts.Init()
+	s.numUnrecoveredStreams.Init()
+	s.numVbucketRollbacks.Init()
+	s.numVbucketRollbacksToZero.Init()
+	s.numRollbackIndexResets.Init()
+	s.memoryAllocMutationQueue.Init()
+	s.memoryAllocBlockCache.Init()
+	s.memoryAllocScanBuffers.Init()
+	s.memoryControllerAdjustments.Init()
+	s.coldTierOffloadedPartitions.Init()
+	s.coldTierOffloadedBytes.Init()
+	s.coldTierOffloads.Init()
+	s.coldTierHydrations.Init()
+	s.coldTierFailures.Init()
+	s.maintenancePending.Init()
+	s.maintenanceRunning.Init()
+	s.maintenanceCompleted.Init()
+	s.maintenanceCoalesced.Init()
+	s.maintenanceDeferrals.Init()
+	s.maintenanceForced.Init()
 
 	s.SetPlannerFilters()
 	s.SetRebalanceFilters()
@@ -822,6 +909,25 @@ func (is IndexerStats) PopulateIndexerStats(statMap *StatsMap) {
 	statMap.AddStatValueFiltered("memory_used_queue", &is.memoryUsedQueue)
 	statMap.AddStatValueFiltered("needs_restart", &is.needsRestart)
 	statMap.AddStatValueFiltered("num_cpu_core", &is.numCPU)
+	statMap.AddStatValueFiltered("rebalance_transfer_bytes", &is.rebalanceTransferBytes)
+	statMap.AddStatValueFiltered("rebalance_throttle_duration", &is.rebalanceThrottleDuration)
+	statMap.AddStatValueFiltered("stream_priority_wait_duration", &is.streamPriorityWaitDuration)
+	statMap.AddStatValueFiltered("stream_repair_attempts", &is.streamRepairAttempts)
+	statMap.AddStatValueFiltered("memory_alloc_mutation_queue", &is.memoryAllocMutationQueue)
+	statMap.AddStatValueFiltered("memory_alloc_block_cache", &is.memoryAllocBlockCache)
+	statMap.AddStatValueFiltered("memory_alloc_scan_buffers", &is.memoryAllocScanBuffers)
+	statMap.AddStatValueFiltered("memory_controller_adjustments", &is.memoryControllerAdjustments)
+	statMap.AddStatValueFiltered("cold_tier_offloaded_partitions", &is.coldTierOffloadedPartitions)
+	statMap.AddStatValueFiltered("cold_tier_offloaded_bytes", &is.coldTierOffloadedBytes)
+	statMap.AddStatValueFiltered("cold_tier_offloads", &is.coldTierOffloads)
+	statMap.AddStatValueFiltered("cold_tier_hydrations", &is.coldTierHydrations)
+	statMap.AddStatValueFiltered("cold_tier_failures", &is.coldTierFailures)
+	statMap.AddStatValueFiltered("maintenance_pending", &is.maintenancePending)
+	statMap.AddStatValueFiltered("maintenance_running", &is.maintenanceRunning)
+	statMap.AddStatValueFiltered("maintenance_completed", &is.maintenanceCompleted)
+	statMap.AddStatValueFiltered("maintenance_coalesced", &is.maintenanceCoalesced)
+	statMap.AddStatValueFiltered("maintenance_deferrals", &is.maintenanceDeferrals)
+	statMap.AddStatValueFiltered("maintenance_forced", &is.maintenanceForced)
 
 	strts := fmt.Sprintf("%v", time.Now().UnixNano())
 	is.timestamp.Set(&strts)
@@ -847,6 +953,17 @@ func (is IndexerStats) PopulateIndexerStats(statMap *StatsMap) {
 	is.memoryTotal.Set(getMemTotal())
 	statMap.AddStatValueFiltered("memory_total", &is.memoryTotal)
 
+	is.numUnrecoveredStreams.Set(gFeedHealth.numUnrecovered())
+	statMap.AddStatValueFiltered("num_unrecovered_streams", &is.numUnrecoveredStreams)
+
+	numVbRollbacks, numVbRollbacksToZero, numIndexResets := gRollbackEvents.getCounts()
+	is.numVbucketRollbacks.Set(numVbRollbacks)
+	statMap.AddStatValueFiltered("num_vbucket_rollbacks", &is.numVbucketRollbacks)
+	is.numVbucketRollbacksToZero.Set(numVbRollbacksToZero)
+	statMap.AddStatValueFiltered("num_vbucket_rollbacks_to_zero", &is.numVbucketRollbacksToZero)
+	is.numRollbackIndexResets.Set(numIndexResets)
+	statMap.AddStatValueFiltered("num_rollback_index_resets", &is.numRollbackIndexResets)
+
 	indexerState := common.IndexerState(is.indexerState.Value())
 	if indexerState == common.INDEXER_PREPARE_UNPAUSE {
 		indexerState = common.INDEXER_PAUSED
@@ -1192,6 +1309,10 @@ func (s *IndexStats) constructIndexStats(skipEmpty bool, version string) common.
 		s.int64Stats(func(ss *IndexStats) int64 {
 			return ss.numScanTimeouts.Value()
 		}))
+	addStat("num_scan_deadline_timeouts",
+		s.int64Stats(func(ss *IndexStats) int64 {
+			return ss.numScanDeadlineTimeouts.Value()
+		}))
 	addStat("num_scan_errors",
 		s.int64Stats(func(ss *IndexStats) int64 {
 			return ss.numScanErrors.Value()
@@ -1330,6 +1451,42 @@ func (s *IndexStats) addIndexStatsToMap(statMap *StatsMap, spec *statsSpec) {
 		},
 		&s.numCompactions, s.int64Stats)
 
+	statMap.AddAggrStatFiltered("num_compactions_deferred",
+		func(ss *IndexStats) int64 {
+			return ss.numCompactionsDeferred.Value()
+		},
+		&s.numCompactionsDeferred, s.int64Stats)
+
+	statMap.AddAggrStatFiltered("num_scrub_errors",
+		func(ss *IndexStats) int64 {
+			return ss.numScrubErrors.Value()
+		},
+		&s.numScrubErrors, s.int64Stats)
+
+	statMap.AddAggrStatFiltered("bloom_filter_hits",
+		func(ss *IndexStats) int64 {
+			return ss.bloomFilterHits.Value()
+		},
+		&s.bloomFilterHits, s.partnInt64Stats)
+
+	statMap.AddAggrStatFiltered("bloom_filter_misses",
+		func(ss *IndexStats) int64 {
+			return ss.bloomFilterMisses.Value()
+		},
+		&s.bloomFilterMisses, s.partnInt64Stats)
+
+	statMap.AddAggrStatFiltered("bloom_filter_false_positives",
+		func(ss *IndexStats) int64 {
+			return ss.bloomFilterFalsePositives.Value()
+		},
+		&s.bloomFilterFalsePositives, s.partnInt64Stats)
+
+	statMap.AddAggrStatFiltered("bloom_filter_size",
+		func(ss *IndexStats) int64 {
+			return ss.bloomFilterSize.Value()
+		},
+		&s.bloomFilterSize, s.partnInt64Stats)
+
 	// TODO: Does it need to be int64Stat?
 	statMap.AddAggrStatFiltered("since_last_snapshot",
 		func(ss *IndexStats) int64 {
@@ -1367,6 +1524,12 @@ func (s *IndexStats) addIndexStatsToMap(statMap *StatsMap, spec *statsSpec) {
 		},
 		&s.numScanTimeouts, s.int64Stats)
 
+	statMap.AddAggrStatFiltered("num_scan_deadline_timeouts",
+		func(ss *IndexStats) int64 {
+			return ss.numScanDeadlineTimeouts.Value()
+		},
+		&s.numScanDeadlineTimeouts, s.int64Stats)
+
 	statMap.AddAggrStatFiltered("num_scan_errors",
 		func(ss *IndexStats) int64 {
 			return ss.numScanErrors.Value()
@@ -1794,6 +1957,12 @@ func (s *IndexStats) addIndexStatsToMap(statMap *StatsMap, spec *statsSpec) {
 				return ss.completionProgress.Value()
 			},
 			&s.completionProgress, s.int64Stats)
+
+		statMap.AddStatByInstIdFiltered("build_eta",
+			func(ss *IndexStats) int64 {
+				return ss.buildEta.Value()
+			},
+			&s.buildEta, s.int64Stats)
 	}
 }
 
@@ -2323,6 +2492,10 @@ func (s *statsManager) RegisterRestEndpoints() {
 	mux.HandleFunc("/stats/mem", s.handleMemStatsReq)
 	mux.HandleFunc("/stats/storage/mm", s.handleStorageMMStatsReq)
 	mux.HandleFunc("/stats/storage", s.handleStorageStatsReq)
+	mux.HandleFunc("/stats/storage/snapshots", s.handleStorageSnapshotsReq)
+	mux.HandleFunc("/stats/storage/diskUsage", s.handleStorageDiskUsageReq)
+	mux.HandleFunc("/stats/feedHealth", s.handleFeedHealthReq)
+	mux.HandleFunc("/stats/rollbacks", s.handleRollbacksReq)
 	mux.HandleFunc("/stats/reset", s.handleStatsResetReq)
 	mux.HandleFunc("/_prometheusMetrics", s.handleMetrics)
 	mux.HandleFunc("/_prometheusMetricsHigh", s.handleMetricsHigh)
@@ -2628,6 +2801,175 @@ func (s *statsManager) handleStorageStatsReq(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+func (s *statsManager) handleStorageSnapshotsReq(w http.ResponseWriter, r *http.Request) {
+	_, valid, _ := common.IsAuthValid(r)
+	if !valid {
+		w.WriteHeader(401)
+		w.Write([]byte("401 Unauthorized"))
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(400)
+		w.Write([]byte("Unsupported method"))
+		return
+	}
+
+	var instId uint64
+	if str := r.URL.Query().Get("instId"); str != "" {
+		var err error
+		if instId, err = strconv.ParseUint(str, 10, 64); err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(fmt.Sprintf("Invalid instId %q", str)))
+			return
+		}
+	}
+
+	stats := s.stats.Get()
+	if common.IndexerState(stats.indexerState.Value()) == common.INDEXER_BOOTSTRAP {
+		w.WriteHeader(200)
+		w.Write([]byte("Indexer In Warmup. Please try again later."))
+		return
+	}
+
+	replych := make(chan []PartitionSnapshotList)
+	s.supvMsgch <- &MsgIndexListSnapshots{respch: replych, instId: common.IndexInstId(instId)}
+	res := <-replych
+
+	buf, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(buf)
+}
+
+//
+// handleStorageDiskUsageReq reports the disk usage of each slice, and the
+// totals of each partition, index and node.  instId restricts the report
+// to an index instance.
+//
+func (s *statsManager) handleStorageDiskUsageReq(w http.ResponseWriter, r *http.Request) {
+	_, valid, _ := common.IsAuthValid(r)
+	if !valid {
+		w.WriteHeader(401)
+		w.Write([]byte("401 Unauthorized"))
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(400)
+		w.Write([]byte("Unsupported method"))
+		return
+	}
+
+	var instId uint64
+	if str := r.URL.Query().Get("instId"); str != "" {
+		var err error
+		if instId, err = strconv.ParseUint(str, 10, 64); err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(fmt.Sprintf("Invalid instId %q", str)))
+			return
+		}
+	}
+
+	stats := s.stats.Get()
+	if common.IndexerState(stats.indexerState.Value()) == common.INDEXER_BOOTSTRAP {
+		w.WriteHeader(200)
+		w.Write([]byte("Indexer In Warmup. Please try again later."))
+		return
+	}
+
+	replych := make(chan *NodeDiskUsage)
+	s.supvMsgch <- &MsgIndexDiskUsage{respch: replych, instId: common.IndexInstId(instId)}
+	res := <-replych
+
+	buf, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(buf)
+}
+
+//
+// handleFeedHealthReq returns the streams under repair, with the number of
+// repair attempts and the last error of their feeds.
+//
+func (s *statsManager) handleFeedHealthReq(w http.ResponseWriter, r *http.Request) {
+	_, valid, _ := common.IsAuthValid(r)
+	if !valid {
+		w.WriteHeader(401)
+		w.Write([]byte("401 Unauthorized"))
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(400)
+		w.Write([]byte("Unsupported method"))
+		return
+	}
+
+	res := map[string]interface{}{
+		"numUnrecovered": gFeedHealth.numUnrecovered(),
+		"repairs":        gFeedHealth.getRepairs(),
+	}
+
+	buf, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(buf)
+}
+
+//
+// handleRollbacksReq returns the counts of vbucket rollbacks and the most
+// recent ones, optionally of keyspaceId only, with the resulting action of
+// the indexer.
+//
+func (s *statsManager) handleRollbacksReq(w http.ResponseWriter, r *http.Request) {
+	_, valid, _ := common.IsAuthValid(r)
+	if !valid {
+		w.WriteHeader(401)
+		w.Write([]byte("401 Unauthorized"))
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(400)
+		w.Write([]byte("Unsupported method"))
+		return
+	}
+
+	numVbRollbacks, numVbRollbacksToZero, numIndexResets := gRollbackEvents.getCounts()
+	res := map[string]interface{}{
+		"numVbucketRollbacks":       numVbRollbacks,
+		"numVbucketRollbacksToZero": numVbRollbacksToZero,
+		"numIndexResets":            numIndexResets,
+		"events":                    gRollbackEvents.getEvents(r.URL.Query().Get("keyspaceId")),
+	}
+
+	buf, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write(buf)
+}
+
 func (s *statsManager) handleStorageMMStatsReq(w http.ResponseWriter, r *http.Request) {
 	_, valid, _ := common.IsAuthValid(r)
 	if !valid {
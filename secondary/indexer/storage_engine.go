@@ -0,0 +1,211 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+//
+// SliceConfig holds the parameters of a new slice of an index partition.
+//
+type SliceConfig struct {
+	StorageDir    string
+	LogDir        string
+	Path          string
+	SliceId       SliceId
+	Defn          common.IndexDefn
+	InstId        common.IndexInstId
+	PartitionId   common.PartitionId
+	NumPartitions int
+	Ephemeral     bool
+	IsNew         bool
+	Config        common.Config
+	IdxStats      *IndexStats
+	IndexerStats  *IndexerStats
+}
+
+//
+// StorageEngine creates and manages the slices of the indexes of a
+// storage mode.  Engines are registered with RegisterStorageEngine, and
+// selected by IndexDefn.Using, or by the storage mode for the operations
+// on the slice files.
+//
+type StorageEngine interface {
+	//Create or open the slice of an index partition
+	NewSlice(cfg *SliceConfig) (Slice, error)
+
+	//Create the container of the slices of an index partition
+	NewSliceContainer() SliceContainer
+
+	//Remove the files of the slice at path
+	DestroySlice(storageDir string, path string) error
+
+	//List the paths of all slices in storageDir
+	ListSlices(storageDir string) ([]string, error)
+
+	//Move the files of a slice from sourceDir to the backup directory
+	//targetDir.  rename returns the backup path of a path, and clean
+	//deletes the old backups of a path.
+	BackupSlice(indexInst *common.IndexInst, partnId common.PartitionId, sliceId SliceId,
+		storageDir string, sourceDir string, targetDir string,
+		rename func(string) (string, error), clean func(string)) error
+}
+
+var storageEngineLock sync.RWMutex
+var storageEngines = make(map[string]StorageEngine)
+var storageEngineModes = make(map[common.StorageMode]StorageEngine)
+
+//
+// RegisterStorageEngine registers engine for storage mode, and the index
+// types which use it.  It must be called during initialization.
+//
+func RegisterStorageEngine(mode common.StorageMode, engine StorageEngine, types ...common.IndexType) {
+
+	storageEngineLock.Lock()
+	defer storageEngineLock.Unlock()
+
+	storageEngineModes[mode] = engine
+	for _, t := range types {
+		storageEngines[strings.ToLower(string(t))] = engine
+		common.RegisterIndexType(t, mode)
+	}
+}
+
+func GetStorageEngine(using common.IndexType) (StorageEngine, bool) {
+
+	storageEngineLock.RLock()
+	defer storageEngineLock.RUnlock()
+
+	engine, ok := storageEngines[strings.ToLower(string(using))]
+	return engine, ok
+}
+
+func GetStorageEngineForMode(mode common.StorageMode) (StorageEngine, bool) {
+
+	storageEngineLock.RLock()
+	defer storageEngineLock.RUnlock()
+
+	engine, ok := storageEngineModes[mode]
+	return engine, ok
+}
+
+func init() {
+	RegisterStorageEngine(common.NOT_SET, fileStorageEngine{})
+	// hash slices use the file layout of memdb slices.  hash is registered
+	// first, so that memdb remains the engine of the MOI storage mode.
+	RegisterStorageEngine(common.MOI, hashStorageEngine{}, common.HashIndex)
+	RegisterStorageEngine(common.MOI, memdbStorageEngine{},
+		common.MemDB, common.MemoryOptimized, common.VectorIndex)
+	RegisterStorageEngine(common.FORESTDB, forestdbStorageEngine{}, common.ForestDB)
+	RegisterStorageEngine(common.PLASMA, plasmaStorageEngine{}, common.PlasmaDB)
+}
+
+//
+// fileStorageEngine implements the operations on the files of engines
+// which store a slice in its own directory.  It cannot create slices.
+//
+type fileStorageEngine struct{}
+
+func (e fileStorageEngine) NewSlice(cfg *SliceConfig) (Slice, error) {
+	return nil, ErrUnknownStorageEngine
+}
+
+func (e fileStorageEngine) NewSliceContainer() SliceContainer {
+	return NewHashedSliceContainer()
+}
+
+func (e fileStorageEngine) DestroySlice(storageDir string, path string) error {
+	return os.RemoveAll(path)
+}
+
+func (e fileStorageEngine) ListSlices(storageDir string) ([]string, error) {
+	pattern := GetIndexPathPattern()
+	return filepath.Glob(filepath.Join(storageDir, pattern))
+}
+
+func (e fileStorageEngine) BackupSlice(indexInst *common.IndexInst, partnId common.PartitionId, sliceId SliceId,
+	storageDir string, sourceDir string, targetDir string,
+	rename func(string) (string, error), clean func(string)) error {
+	return moveIndexFile(indexInst, partnId, sliceId, sourceDir, targetDir)
+}
+
+type memdbStorageEngine struct {
+	fileStorageEngine
+}
+
+func (e memdbStorageEngine) NewSlice(cfg *SliceConfig) (Slice, error) {
+
+	slice, err := NewMemDBSlice(cfg.Path, cfg.SliceId, cfg.Defn, cfg.InstId, cfg.PartitionId, cfg.Defn.IsPrimary,
+		!cfg.Ephemeral, cfg.NumPartitions, cfg.Config, cfg.IdxStats)
+	if err != nil {
+		return nil, err
+	}
+	return slice, nil
+}
+
+type hashStorageEngine struct {
+	fileStorageEngine
+}
+
+func (e hashStorageEngine) NewSlice(cfg *SliceConfig) (Slice, error) {
+
+	slice, err := NewHashSlice(cfg.Path, cfg.SliceId, cfg.Defn, cfg.InstId, cfg.PartitionId, cfg.Defn.IsPrimary,
+		!cfg.Ephemeral, cfg.Config, cfg.IdxStats)
+	if err != nil {
+		return nil, err
+	}
+	return slice, nil
+}
+
+type forestdbStorageEngine struct {
+	fileStorageEngine
+}
+
+func (e forestdbStorageEngine) NewSlice(cfg *SliceConfig) (Slice, error) {
+
+	slice, err := NewForestDBSlice(cfg.Path, cfg.SliceId, cfg.Defn, cfg.InstId, cfg.PartitionId, cfg.Defn.IsPrimary,
+		cfg.NumPartitions, cfg.Config, cfg.IdxStats)
+	if err != nil {
+		return nil, err
+	}
+	return slice, nil
+}
+
+type plasmaStorageEngine struct {
+	fileStorageEngine
+}
+
+func (e plasmaStorageEngine) NewSlice(cfg *SliceConfig) (Slice, error) {
+
+	slice, err := NewPlasmaSlice(cfg.StorageDir, cfg.LogDir, cfg.Path, cfg.SliceId, cfg.Defn, cfg.InstId, cfg.PartitionId,
+		cfg.Defn.IsPrimary, cfg.NumPartitions, cfg.Config, cfg.IdxStats, cfg.IndexerStats, cfg.IsNew)
+	if err != nil {
+		return nil, err
+	}
+	return slice, nil
+}
+
+func (e plasmaStorageEngine) DestroySlice(storageDir string, path string) error {
+	return DestroyPlasmaSlice(storageDir, path)
+}
+
+func (e plasmaStorageEngine) BackupSlice(indexInst *common.IndexInst, partnId common.PartitionId, sliceId SliceId,
+	storageDir string, sourceDir string, targetDir string,
+	rename func(string) (string, error), clean func(string)) error {
+
+	srcPath := filepath.Join(sourceDir, IndexPath(indexInst, partnId, sliceId))
+	return BackupCorruptedPlasmaSlice(storageDir, srcPath, rename, clean)
+}
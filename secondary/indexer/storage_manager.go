@@ -12,10 +12,12 @@ package indexer
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
-	"os"
+	"path/filepath"
 	"sort"
 	"sync"
 	"time"
@@ -62,6 +64,8 @@ type storageMgr struct {
 
 	muSnap sync.Mutex //lock to protect snapMap and waitersMap
 
+	coldTier *coldTier
+
 	lastFlushDone int64
 }
 
@@ -115,6 +119,7 @@ func NewStorageManager(supvCmdch MsgChannel, supvRespch MsgChannel,
 		indexSnapMap:     make(map[common.IndexInstId]IndexSnapshot),
 		waitersMap:       make(map[common.IndexInstId][]*snapshotWaiter),
 		config:           config,
+		coldTier:         newColdTier(config),
 	}
 
 	//if manager is not enabled, create meta file
@@ -144,11 +149,28 @@ func NewStorageManager(supvCmdch MsgChannel, supvRespch MsgChannel,
 //from its supervisor(indexer)
 func (s *storageMgr) run() {
 
+	coldTierTimer := time.NewTimer(s.coldTier.interval())
+	defer coldTierTimer.Stop()
+
+	retentionInterval := time.Duration(s.config["snapshot_retention.interval"].Uint64()) * time.Second
+	if retentionInterval <= 0 {
+		retentionInterval = 300 * time.Second
+	}
+	retentionTicker := time.NewTicker(retentionInterval)
+	defer retentionTicker.Stop()
+
 	//main Storage Manager loop
 loop:
 	for {
 		select {
 
+		case <-coldTierTimer.C:
+			s.handleColdTier()
+			coldTierTimer.Reset(s.coldTier.interval())
+
+		case <-retentionTicker.C:
+			s.handleSnapshotRetention()
+
 		case cmd, ok := <-s.supvCmdch:
 			if ok {
 				if cmd.GetMsgType() == STORAGE_MGR_SHUTDOWN {
@@ -189,6 +211,16 @@ func (s *storageMgr) handleSupvervisorCommands(cmd Message) {
 	case STORAGE_INDEX_STORAGE_STATS:
 		s.handleGetIndexStorageStats(cmd)
 
+	case STORAGE_INDEX_LIST_SNAPSHOTS:
+		s.handleListIndexSnapshots(cmd)
+
+	case STORAGE_INDEX_DISK_USAGE:
+		s.handleGetIndexDiskUsage(cmd)
+
+	case STORAGE_INDEX_EXPORT_SNAPSHOT,
+		STORAGE_INDEX_IMPORT_SNAPSHOT:
+		s.handleIndexSnapshotTransfer(cmd)
+
 	case STORAGE_INDEX_COMPACT:
 		s.handleIndexCompaction(cmd)
 
@@ -732,6 +764,10 @@ func (sm *storageMgr) rollbackIndex(streamId common.StreamId, keyspaceId string,
 		partnId := partnInst.Defn.GetPartitionId()
 		sc := partnInst.Sc
 
+		// an offloaded partition is rolled back to its snapshot in the
+		// cold tier
+		sm.coldTier.hydrateOnDemand(idxInstId, partnId, partnInst)
+
 		for _, slice := range sc.GetAllSlices() {
 			snapInfo := sm.findRollbackSnapshot(slice, rollbackTs)
 
@@ -999,6 +1035,8 @@ func (s *storageMgr) handleUpdateIndexInstMap(cmd Message) {
 		s.addNilSnapshot(idxInstId, inst.Defn.Bucket)
 	}
 
+	s.setInitialBuildDone()
+
 	//if manager is not enable, store the updated InstMap in
 	//meta file
 	if s.config["enableManager"].Bool() == false {
@@ -1037,10 +1075,33 @@ func (s *storageMgr) handleUpdateIndexPartnMap(cmd Message) {
 	logging.Tracef("StorageMgr::handleUpdateIndexPartnMap %v", cmd)
 	indexPartnMap := cmd.(*MsgUpdatePartnMap).GetIndexPartnMap()
 	s.indexPartnMap = CopyIndexPartnMap(indexPartnMap)
+	s.setInitialBuildDone()
 
 	s.supvCmdch <- &MsgSuccess{}
 }
 
+//
+// setInitialBuildDone lifts the writer limit of the initial build
+// (build_writer_threads) from the slices of the active indexes.
+//
+func (s *storageMgr) setInitialBuildDone() {
+
+	for idxInstId, partnMap := range s.indexPartnMap {
+		inst, ok := s.indexInstMap[idxInstId]
+		if !ok || inst.State != common.INDEX_STATE_ACTIVE {
+			continue
+		}
+
+		for _, partnInst := range partnMap {
+			for _, slice := range partnInst.Sc.GetAllSlices() {
+				if bs, ok := slice.(InitialBuildSlice); ok {
+					bs.InitialBuildDone()
+				}
+			}
+		}
+	}
+}
+
 // Process req for providing an index snapshot for index scan.
 // The request contains atleast-timestamp and the storage
 // manager will reply with a index snapshot soon after a
@@ -1097,6 +1158,393 @@ func (s *storageMgr) handleGetIndexStorageStats(cmd Message) {
 	replych <- stats
 }
 
+func (s *storageMgr) handleListIndexSnapshots(cmd Message) {
+	s.supvCmdch <- &MsgSuccess{}
+	req := cmd.(*MsgIndexListSnapshots)
+	replych := req.GetReplyChannel()
+	replych <- s.listIndexSnapshots(req.GetInstId())
+}
+
+// listIndexSnapshots returns the persisted snapshots of each partition slice,
+// along with the in-memory snapshot currently used for scans.
+func (s *storageMgr) listIndexSnapshots(instId common.IndexInstId) []PartitionSnapshotList {
+
+	var result []PartitionSnapshotList
+
+	for idxInstId, partnMap := range s.indexPartnMap {
+
+		if instId != 0 && instId != idxInstId {
+			continue
+		}
+
+		inst, ok := s.indexInstMap[idxInstId]
+		//skip deleted indexes
+		if !ok || inst.State == common.INDEX_STATE_DELETED {
+			continue
+		}
+
+		var memSnap IndexSnapshot
+		if is, ok := s.indexSnapMap[idxInstId]; ok && is != nil {
+			memSnap = is
+		}
+
+		for partnId, partnInst := range partnMap {
+
+			list := PartitionSnapshotList{
+				InstId:     idxInstId,
+				PartnId:    partnId,
+				Name:       inst.Defn.Name,
+				Bucket:     inst.Defn.Bucket,
+				Scope:      inst.Defn.Scope,
+				Collection: inst.Defn.Collection,
+			}
+
+			if memSnap != nil && memSnap.Timestamp() != nil {
+				entry := newSnapshotListEntry("memory", true, memSnap.Timestamp())
+				if ps, ok := memSnap.Partitions()[partnId]; ok {
+					for _, ss := range ps.Slices() {
+						if count, err := ss.Snapshot().StatCountTotal(); err == nil {
+							entry.Items += count
+						}
+					}
+				}
+				list.Snapshots = append(list.Snapshots, entry)
+			}
+
+			for _, slice := range partnInst.Sc.GetAllSlices() {
+				infos, err := slice.GetSnapshots()
+				if err != nil {
+					logging.Errorf("StorageMgr::listIndexSnapshots Error listing snapshots for "+
+						"Inst %v Partition %v Slice %v. Err %v", idxInstId, partnId, slice.Id(), err)
+					continue
+				}
+
+				for _, info := range infos {
+					entry := newSnapshotListEntry("disk", info.IsCommitted(), info.Timestamp())
+					if stats := info.Stats(); stats != nil {
+						entry.Size = safeGetInt64(stats[SNAP_STATS_RAW_DATA_SIZE])
+					}
+					list.Snapshots = append(list.Snapshots, entry)
+				}
+			}
+
+			result = append(result, list)
+		}
+	}
+
+	return result
+}
+
+func (s *storageMgr) handleGetIndexDiskUsage(cmd Message) {
+	s.supvCmdch <- &MsgSuccess{}
+	req := cmd.(*MsgIndexDiskUsage)
+	replych := req.GetReplyChannel()
+	replych <- s.getIndexDiskUsage(req.GetInstId())
+}
+
+//
+// getIndexDiskUsage returns the disk usage of each slice, aggregated per
+// partition, index and node.  The disk snapshots of memory optimized
+// indexes are written whole, so they have no compaction debt.
+//
+func (s *storageMgr) getIndexDiskUsage(instId common.IndexInstId) *NodeDiskUsage {
+
+	result := &NodeDiskUsage{}
+	doPrepare := true
+
+	for idxInstId, partnMap := range s.indexPartnMap {
+
+		if instId != 0 && instId != idxInstId {
+			continue
+		}
+
+		inst, ok := s.indexInstMap[idxInstId]
+		//skip deleted indexes
+		if !ok || inst.State == common.INDEX_STATE_DELETED {
+			continue
+		}
+
+		isMOI := common.IndexTypeToStorageMode(inst.Defn.Using) == common.MOI
+
+		index := IndexDiskUsage{
+			InstId:     idxInstId,
+			Name:       inst.Defn.Name,
+			Bucket:     inst.Defn.Bucket,
+			Scope:      inst.Defn.Scope,
+			Collection: inst.Defn.Collection,
+		}
+
+		for partnId, partnInst := range partnMap {
+
+			partn := PartitionDiskUsage{PartnId: partnId}
+
+			for _, slice := range partnInst.Sc.GetAllSlices() {
+
+				// Prepare stats once
+				if doPrepare {
+					slice.PrepareStats()
+					doPrepare = false
+				}
+
+				sts, err := slice.Statistics(0)
+				if err != nil {
+					logging.Errorf("StorageMgr::getIndexDiskUsage Error getting statistics for "+
+						"Inst %v Partition %v Slice %v. Err %v", idxInstId, partnId, slice.Id(), err)
+					continue
+				}
+
+				usage := SliceDiskUsage{
+					SliceId: slice.Id(),
+					Path:    slice.Path(),
+					Files:   getSliceFileSizes(slice.Path()),
+				}
+				usage.DiskSize = sts.DiskSize
+				usage.DataSize = sts.DataSize
+				if !isMOI && sts.DataSize != 0 && sts.DiskSize > sts.DataSize {
+					usage.CompactionDebt = sts.DiskSize - sts.DataSize
+				}
+				usage.computeFragmentation()
+
+				partn.Slices = append(partn.Slices, usage)
+				partn.add(usage.DiskUsage)
+			}
+
+			index.Partitions = append(index.Partitions, partn)
+			index.add(partn.DiskUsage)
+		}
+
+		result.Indexes = append(result.Indexes, index)
+		result.add(index.DiskUsage)
+	}
+
+	return result
+}
+
+//
+// getSliceFileSizes returns the size of each file or directory in the
+// directory of a slice.
+//
+func getSliceFileSizes(path string) map[string]int64 {
+
+	sizes := make(map[string]int64)
+
+	fis, err := ioutil.ReadDir(path)
+	if err != nil {
+		return sizes
+	}
+
+	for _, fi := range fis {
+		if fi.IsDir() {
+			sz, _ := common.DiskUsage(filepath.Join(path, fi.Name()))
+			sizes[fi.Name()] = sz
+		} else {
+			sizes[fi.Name()] = fi.Size()
+		}
+	}
+
+	return sizes
+}
+
+//
+// handleIndexSnapshotTransfer exports the latest disk snapshot of an index
+// partition to a directory, or imports a disk snapshot exported earlier.
+// Each slice of the partition is copied to its own sub-directory, and the
+// export is described by a manifest in the directory.  Copying runs in the
+// background, and the result is sent on the response channel.
+//
+// Only memory optimized indexes support it.  An imported snapshot is only
+// loaded on the next indexer restart, until then the index does not write
+// any disk snapshot, so that the imported one is not overwritten.  For an
+// index which is not built yet, the snapshot is instead loaded right away,
+// and a rebalance build of the index catches up from it.
+//
+func (s *storageMgr) handleIndexSnapshotTransfer(cmd Message) {
+	s.supvCmdch <- &MsgSuccess{}
+
+	req := cmd.(*MsgIndexSnapshotTransfer)
+	respch := req.GetResponseChannel()
+	instId := req.GetInstId()
+	partnId := req.GetPartitionId()
+	dir := req.GetDir()
+
+	inst, ok := s.indexInstMap[instId]
+	if !ok || inst.State == common.INDEX_STATE_DELETED {
+		respch <- fmt.Errorf("Unknown index instance %v", instId)
+		return
+	}
+
+	partnInst, ok := s.indexPartnMap[instId][partnId]
+	if !ok {
+		respch <- fmt.Errorf("Unknown partition %v for index instance %v", partnId, instId)
+		return
+	}
+
+	export := req.GetMsgType() == STORAGE_INDEX_EXPORT_SNAPSHOT
+	load := req.GetLoad()
+	if !export {
+		unbuilt := inst.State == common.INDEX_STATE_CREATED || inst.State == common.INDEX_STATE_READY
+		if load && !unbuilt {
+			respch <- fmt.Errorf("Cannot load snapshot into index instance %v in %v state", instId, inst.State)
+			return
+		} else if !load && unbuilt {
+			respch <- fmt.Errorf("Index instance %v is not built, its snapshot can only be loaded", instId)
+			return
+		}
+	}
+
+	slices := partnInst.Sc.GetAllSlices()
+	defn := inst.Defn
+	mode := common.IndexTypeToStorageMode(defn.Using)
+	srcInstId := req.GetSourceInstId()
+
+	// check every slice upfront, so that a partition is not partially imported.
+	exporters := make([]SnapshotExporter, 0, len(slices))
+	for _, slice := range slices {
+		exporter, ok := slice.(SnapshotExporter)
+		if !ok {
+			respch <- fmt.Errorf("Snapshot export is not supported for %v storage mode", mode)
+			return
+		}
+		exporters = append(exporters, exporter)
+	}
+
+	go func() {
+
+		manifest := snapshotExportManifest{
+			InstId:      instId,
+			PartnId:     partnId,
+			Bucket:      defn.Bucket,
+			Scope:       defn.Scope,
+			Collection:  defn.Collection,
+			Name:        defn.Name,
+			StorageMode: mode.String(),
+		}
+
+		if !export {
+			var exported snapshotExportManifest
+			if err := readSnapshotExportManifest(dir, &exported); err != nil {
+				respch <- err
+				return
+			}
+			expected := manifest
+			expected.InstId = srcInstId
+			if err := validateSnapshotExportManifest(&exported, &expected); err != nil {
+				respch <- err
+				return
+			}
+		}
+
+		for i, slice := range slices {
+
+			exporter := exporters[i]
+			sliceDir := filepath.Join(dir, fmt.Sprintf("slice_%v", slice.Id()))
+
+			if export {
+				info, err := exporter.ExportSnapshot(sliceDir)
+				if err != nil {
+					respch <- err
+					return
+				}
+				if ts := info.Timestamp(); ts != nil {
+					manifest.Seqnos = ts.Seqnos
+					manifest.Vbuuids = ts.Vbuuids
+				}
+			} else if err := exporter.ImportSnapshot(sliceDir); err != nil {
+				respch <- err
+				return
+			}
+		}
+
+		if export {
+			respch <- writeSnapshotExportManifest(dir, &manifest)
+			return
+		}
+
+		if load {
+			for i, slice := range slices {
+				if _, err := exporters[i].LoadSnapshot(); err != nil {
+					logging.Errorf("StorageMgr::handleIndexSnapshotTransfer Error loading snapshot of "+
+						"Inst %v Partn %v Slice %v: %v", instId, partnId, slice.Id(), err)
+					respch <- err
+					return
+				}
+			}
+
+			logging.Infof("StorageMgr::handleIndexSnapshotTransfer Loaded snapshot of Inst %v Partn %v "+
+				"from Inst %v", instId, partnId, srcInstId)
+			respch <- nil
+			return
+		}
+
+		logging.Infof("StorageMgr::handleIndexSnapshotTransfer Imported snapshot of Inst %v Partn %v "+
+			"from Inst %v.  Indexer needs restart to load it.", instId, partnId, srcInstId)
+		if stats := s.stats.Get(); stats != nil {
+			stats.needsRestart.Set(true)
+		}
+
+		respch <- nil
+	}()
+}
+
+const snapshotExportManifestFile = "export.json"
+
+//
+// validateSnapshotExportManifest checks that a snapshot is exported from the
+// expected partition of the same index, in the same storage mode.
+//
+func validateSnapshotExportManifest(exported, expected *snapshotExportManifest) error {
+
+	if exported.StorageMode != expected.StorageMode {
+		return fmt.Errorf("Snapshot is exported from %v storage mode", exported.StorageMode)
+	}
+
+	if exported.InstId != expected.InstId || exported.PartnId != expected.PartnId {
+		return fmt.Errorf("Snapshot is exported from index instance %v partition %v, expected instance %v partition %v",
+			exported.InstId, exported.PartnId, expected.InstId, expected.PartnId)
+	}
+
+	if exported.Bucket != expected.Bucket || exported.Scope != expected.Scope ||
+		exported.Collection != expected.Collection || exported.Name != expected.Name {
+		return fmt.Errorf("Snapshot is exported from index %v:%v:%v:%v, expected %v:%v:%v:%v",
+			exported.Bucket, exported.Scope, exported.Collection, exported.Name,
+			expected.Bucket, expected.Scope, expected.Collection, expected.Name)
+	}
+
+	return nil
+}
+
+func readSnapshotExportManifest(dir string, manifest *snapshotExportManifest) error {
+	bs, err := ioutil.ReadFile(filepath.Join(dir, snapshotExportManifestFile))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, manifest)
+}
+
+func writeSnapshotExportManifest(dir string, manifest *snapshotExportManifest) error {
+	bs, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, snapshotExportManifestFile), bs, 0644)
+}
+
+func newSnapshotListEntry(typ string, committed bool, ts *common.TsVbuuid) SnapshotListEntry {
+
+	entry := SnapshotListEntry{
+		Type:      typ,
+		Committed: committed,
+	}
+
+	if ts != nil {
+		entry.SnapType = ts.GetSnapType().String()
+		entry.Seqnos = ts.Seqnos
+		entry.Vbuuids = ts.Vbuuids
+	}
+
+	return entry
+}
+
 func (s *storageMgr) handleStats(cmd Message) {
 	s.supvCmdch <- &MsgSuccess{}
 
@@ -1120,8 +1568,8 @@ func (s *storageMgr) handleStats(cmd Message) {
 			idxStats.logSpaceOnDisk.Set(st.Stats.LogSpace)
 			idxStats.diskSize.Set(st.Stats.DiskSize)
 			idxStats.memUsed.Set(st.Stats.MemUsed)
-			if common.GetStorageMode() != common.MOI {
-				if common.GetStorageMode() == common.PLASMA {
+			if mode := common.IndexTypeToStorageMode(inst.Defn.Using); mode != common.MOI {
+				if mode == common.PLASMA {
 					idxStats.fragPercent.Set(int64(st.getPlasmaFragmentation()))
 				} else {
 					idxStats.fragPercent.Set(int64(st.GetFragmentation()))
@@ -1159,9 +1607,51 @@ func (s *storageMgr) handleStats(cmd Message) {
 		}
 	}
 
+	s.enforceIndexMemQuota(storageStats, stats)
+
 	replych <- true
 }
 
+//
+// enforceIndexMemQuota limits the memory of an index instance when
+// 1) its memory used is over the memory quota of the index, or
+// 2) the index has evict priority, and the node is under memory pressure.
+// The limit is lifted once neither applies.
+//
+func (s *storageMgr) enforceIndexMemQuota(storageStats []IndexStorageStats, stats *IndexerStats) {
+
+	memUsed := make(map[common.IndexInstId]int64)
+	for _, st := range storageStats {
+		memUsed[st.InstId] += st.Stats.MemUsed
+	}
+
+	var underPressure bool
+	if stats != nil {
+		quota := float64(stats.memoryQuota.Value())
+		underPressure = quota > 0 &&
+			float64(stats.memoryUsedStorage.Value()) > s.config["evict_priority_mem_mark"].Float64()*quota
+	}
+
+	for instId, partnMap := range s.indexPartnMap {
+
+		inst, ok := s.indexInstMap[instId]
+		if !ok || inst.State == common.INDEX_STATE_DELETED {
+			continue
+		}
+
+		overQuota := inst.Defn.MemQuota != 0 && uint64(memUsed[instId]) > inst.Defn.MemQuota
+		limited := overQuota || (underPressure && inst.Defn.EvictPriority > 0)
+
+		for _, partnInst := range partnMap {
+			for _, slice := range partnInst.Sc.GetAllSlices() {
+				if limiter, ok := slice.(ResidentLimiter); ok {
+					limiter.SetResidentLimited(limited)
+				}
+			}
+		}
+	}
+}
+
 func (s *storageMgr) getIndexStorageStats(spec *statsSpec) []IndexStorageStats {
 	var stats []IndexStorageStats
 	var err error
@@ -1266,6 +1756,54 @@ func (s *storageMgr) getIndexStorageStats(spec *statsSpec) []IndexStorageStats {
 	return stats
 }
 
+//
+// handleColdTier runs the cold tier in the background, with a copy of the
+// index maps.
+//
+func (s *storageMgr) handleColdTier() {
+
+	if !s.coldTier.getConfig()["settings.cold_tier.enable"].Bool() {
+		return
+	}
+
+	stats := s.stats.Get()
+	if stats == nil {
+		return
+	}
+
+	s.muSnap.Lock()
+	indexInstMap := common.CopyIndexInstMap(s.indexInstMap)
+	indexPartnMap := CopyIndexPartnMap(s.indexPartnMap)
+	s.muSnap.Unlock()
+
+	go s.coldTier.run(indexInstMap, indexPartnMap, stats)
+}
+
+//
+// handleSnapshotRetention removes the disk snapshots of all slices which
+// are not retained by settings.snapshot_retention.  The slices remove the
+// snapshots over the retained count when they write a new snapshot, but
+// snapshots can expire while no snapshot is written.
+//
+func (s *storageMgr) handleSnapshotRetention() {
+
+	s.muSnap.Lock()
+	indexPartnMap := CopyIndexPartnMap(s.indexPartnMap)
+	s.muSnap.Unlock()
+
+	go func() {
+		for _, partnMap := range indexPartnMap {
+			for _, partnInst := range partnMap {
+				for _, slice := range partnInst.Sc.GetAllSlices() {
+					if rs, ok := slice.(SnapshotRetentionSlice); ok {
+						gMaintenance.submit(MAINT_SNAPSHOT_CLEANUP, slice.Path(), rs.EnforceSnapshotRetention)
+					}
+				}
+			}
+		}
+	}()
+}
+
 func (s *storageMgr) handleRecoveryDone() {
 	s.supvCmdch <- &MsgSuccess{}
 
@@ -1641,7 +2179,7 @@ func (s *storageMgr) updateIndexSnapMapForIndex(idxInstId common.IndexInstId, id
 	logging.Infof("StorageMgr::updateIndexSnapMapForIndex IndexInst %v Partitions %v",
 		idxInstId, partitionIDs)
 
-	needRestart := false
+	var corruptPartns []common.PartitionId
 	//if keyspace and stream have been provided
 	if keyspaceId != "" && streamId != common.ALL_STREAMS {
 		//skip the index if either keyspaceId or stream don't match
@@ -1666,7 +2204,7 @@ func (s *storageMgr) updateIndexSnapMapForIndex(idxInstId common.IndexInstId, id
 		partnSnapMap, tsVbuuid, err = s.openSnapshot(idxInstId, partnInst, partnSnapMap)
 		if err != nil {
 			if err == errStorageCorrupted {
-				needRestart = true
+				corruptPartns = append(corruptPartns, partnInst.Defn.GetPartitionId())
 			} else {
 				panic("Unable to open snapshot -" + err.Error())
 			}
@@ -1695,6 +2233,27 @@ func (s *storageMgr) updateIndexSnapMapForIndex(idxInstId common.IndexInstId, id
 		}
 	}
 
+	// Index with corrupted partitions is quarantined, instead of serving
+	// scans from the remaining partitions.
+	if len(corruptPartns) != 0 {
+		DestroyIndexSnapshot(&indexSnapshot{
+			instId: idxInstId,
+			ts:     tsVbuuid,
+			partns: partnSnapMap,
+		})
+		partnSnapMap = nil
+
+		for _, partnId := range corruptPartns {
+			msg := &MsgQuarantineIndex{
+				instId:  idxInstId,
+				partnId: partnId,
+				reason:  errStorageCorrupted.Error(),
+			}
+			// indexer may be waiting on storage manager. Notify asynchronously.
+			go func() { s.supvRespch <- msg }()
+		}
+	}
+
 	bucket, _, _ := SplitKeyspaceId(keyspaceId)
 	if len(partnSnapMap) != 0 {
 		is := &indexSnapshot{
@@ -1709,10 +2268,6 @@ func (s *storageMgr) updateIndexSnapMapForIndex(idxInstId common.IndexInstId, id
 			idxInstId)
 		s.addNilSnapshot(idxInstId, bucket)
 	}
-
-	if needRestart {
-		os.Exit(1)
-	}
 }
 
 func (s *storageMgr) handleUpdateIndexSnapMapForIndex(cmd Message) {
@@ -0,0 +1,298 @@
+// @copyright 2021 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	l "github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/manager"
+	"github.com/couchbase/indexing/secondary/manager/client"
+	mc "github.com/couchbase/indexing/secondary/manager/common"
+)
+
+//
+// storageMigrator moves individual indexes to the storage mode they are
+// marked for (see handleIndexStorageModeRequest). For each such index, a
+// new instance is created in the target storage mode as a rebalance pending
+// instance, and built in the background. Once the new instance has caught
+// up, it is made active and the old instance is dropped, the same way an
+// index is swapped at the end of rebalance.
+//
+// Instances quarantined due to storage corruption (see handleQuarantineIndex)
+// are replaced the same way, by a new instance in the same storage mode.
+//
+type storageMigrator struct {
+	mgr *ServiceMgr
+}
+
+func newStorageMigrator(mgr *ServiceMgr) *storageMigrator {
+	return &storageMigrator{mgr: mgr}
+}
+
+func (s *storageMigrator) run() {
+
+	l.Infof("StorageMigrator::run Started")
+
+	for {
+		cfg := s.mgr.config.Load()
+		interval := cfg["storageMigration.checkInterval"].Int()
+		if interval <= 0 {
+			interval = 30
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+
+		if s.isRebalanceRunning() {
+			continue
+		}
+
+		if err := s.migrate(cfg["nodeuuid"].String()); err != nil {
+			l.Errorf("StorageMigrator::run Error during storage migration %v", err)
+		}
+	}
+}
+
+func (s *storageMigrator) isRebalanceRunning() bool {
+
+	s.mgr.mu.RLock()
+	defer s.mgr.mu.RUnlock()
+
+	return s.mgr.rebalanceRunning || s.mgr.rebalanceToken != nil
+}
+
+func (s *storageMigrator) migrate(nodeUUID string) error {
+
+	modes, err := mc.GetIndexStorageModes(nodeUUID)
+	if err != nil {
+		return err
+	}
+
+	localMeta, err := getLocalMeta(s.mgr.localhttp)
+	if err != nil {
+		return err
+	}
+
+	defns := make(map[c.IndexDefnId]c.IndexDefn)
+	for _, defn := range localMeta.IndexDefinitions {
+		defns[defn.DefnId] = defn
+	}
+
+	s.repair(localMeta, defns)
+
+	for defnId, mode := range modes {
+
+		defn, ok := defns[defnId]
+		if !ok {
+			// index has been dropped.  Nothing more to migrate.
+			l.Infof("StorageMigrator::migrate Index %v no longer exists.  Remove storage mode %v", defnId, mode)
+			if err := mc.PostIndexStorageMode(nodeUUID, defnId, ""); err != nil {
+				l.Errorf("StorageMigrator::migrate Error removing storage mode for index %v %v", defnId, err)
+			}
+			continue
+		}
+
+		topology := findTopologyByCollection(localMeta.IndexTopologies, defn.Bucket, defn.Scope, defn.Collection)
+		if topology == nil {
+			continue
+		}
+
+		defnRef := topology.FindIndexDefinitionById(defnId)
+		if defnRef == nil {
+			continue
+		}
+
+		if err := s.migrateIndex(defn, defnRef.Instances, mode); err != nil {
+			l.Errorf("StorageMigrator::migrateIndex Error migrating index %v:%v:%v:%v to %v. %v",
+				defn.Bucket, defn.Scope, defn.Collection, defn.Name, mode, err)
+		}
+	}
+
+	return nil
+}
+
+//
+// repair moves each quarantined instance one step towards its replacement.
+//
+func (s *storageMigrator) repair(localMeta *manager.LocalIndexMetadata, defns map[c.IndexDefnId]c.IndexDefn) {
+
+	for _, topology := range localMeta.IndexTopologies {
+		for _, defnRef := range topology.Definitions {
+
+			defn, ok := defns[c.IndexDefnId(defnRef.DefnId)]
+			if !ok {
+				continue
+			}
+
+			for _, inst := range defnRef.Instances {
+
+				if c.IndexState(inst.State) != c.INDEX_STATE_ERROR ||
+					!strings.HasPrefix(inst.Error, QUARANTINE_ERR_PREFIX) {
+					continue
+				}
+
+				mode := c.IndexTypeToStorageMode(c.IndexType(inst.StorageMode))
+				if mode == c.NOT_SET {
+					mode = c.IndexTypeToStorageMode(defn.Using)
+				}
+
+				if err := s.replaceInstance(defn, defnRef.Instances, inst, mode); err != nil {
+					l.Errorf("StorageMigrator::repair Error repairing index %v:%v:%v:%v instance %v. %v",
+						defn.Bucket, defn.Scope, defn.Collection, defn.Name, inst.InstId, err)
+				}
+			}
+		}
+	}
+}
+
+//
+// migrateIndex moves each instance of the index one step towards the target
+// storage mode.
+//
+func (s *storageMigrator) migrateIndex(defn c.IndexDefn, insts []manager.IndexInstDistribution, mode c.StorageMode) error {
+
+	for _, inst := range insts {
+
+		if c.IndexState(inst.State) == c.INDEX_STATE_DELETED ||
+			c.IndexState(inst.State) == c.INDEX_STATE_ERROR ||
+			c.RebalanceState(inst.RState) != c.REBAL_ACTIVE ||
+			c.IndexTypeToStorageMode(c.IndexType(inst.StorageMode)) == mode {
+			continue
+		}
+
+		if err := s.replaceInstance(defn, insts, inst, mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//
+// replaceInstance moves inst one step towards its replacement by a new
+// instance in the given storage mode.
+//
+func (s *storageMigrator) replaceInstance(defn c.IndexDefn, insts []manager.IndexInstDistribution,
+	inst manager.IndexInstDistribution, mode c.StorageMode) error {
+
+	var clone *manager.IndexInstDistribution
+	for i, other := range insts {
+		if other.InstId != inst.InstId &&
+			other.ReplicaId == inst.ReplicaId &&
+			c.IndexState(other.State) != c.INDEX_STATE_DELETED &&
+			c.IndexState(other.State) != c.INDEX_STATE_ERROR &&
+			c.IndexTypeToStorageMode(c.IndexType(other.StorageMode)) == mode {
+			clone = &insts[i]
+			break
+		}
+	}
+
+	switch {
+	case clone == nil:
+		return s.createClone(defn, inst, mode)
+
+	case c.IndexState(clone.State) == c.INDEX_STATE_READY:
+		return s.buildClone(defn, clone)
+
+	case c.IndexState(clone.State) == c.INDEX_STATE_ACTIVE:
+		return s.swapClone(defn, inst, clone)
+	}
+
+	return nil
+}
+
+func (s *storageMigrator) createClone(defn c.IndexDefn, inst manager.IndexInstDistribution, mode c.StorageMode) error {
+
+	instId, err := c.NewIndexInstId()
+	if err != nil {
+		return err
+	}
+
+	defn.SetCollectionDefaults()
+	defn.Using = c.StorageModeToIndexType(mode)
+	defn.Nodes = nil
+	defn.Deferred = true
+	defn.InstId = instId
+	defn.RealInstId = 0
+	defn.ReplicaId = int(inst.ReplicaId)
+	defn.InstVersion = int(inst.Version) + 1
+
+	defn.Partitions = nil
+	defn.Versions = nil
+	for _, partn := range inst.Partitions {
+		defn.Partitions = append(defn.Partitions, c.PartitionId(partn.PartId))
+		defn.Versions = append(defn.Versions, int(partn.Version))
+	}
+
+	l.Infof("StorageMigrator::createClone Create instance %v in %v for index %v:%v:%v:%v (instance %v)",
+		instId, mode, defn.Bucket, defn.Scope, defn.Collection, defn.Name, inst.InstId)
+
+	return s.post("/createIndexRebalance", manager.IndexRequest{Index: defn})
+}
+
+func (s *storageMigrator) buildClone(defn c.IndexDefn, clone *manager.IndexInstDistribution) error {
+
+	l.Infof("StorageMigrator::buildClone Build instance %v for index %v:%v:%v:%v",
+		clone.InstId, defn.Bucket, defn.Scope, defn.Collection, defn.Name)
+
+	return s.post("/buildIndex", manager.IndexRequest{IndexIds: client.IndexIdList{DefnIds: []uint64{uint64(defn.DefnId)}}})
+}
+
+func (s *storageMigrator) swapClone(defn c.IndexDefn, inst manager.IndexInstDistribution,
+	clone *manager.IndexInstDistribution) error {
+
+	l.Infof("StorageMigrator::swapClone Swap instance %v with %v for index %v:%v:%v:%v",
+		inst.InstId, clone.InstId, defn.Bucket, defn.Scope, defn.Collection, defn.Name)
+
+	respch := make(chan error)
+	s.mgr.supvMsgch <- &MsgUpdateIndexRState{
+		instId: c.IndexInstId(clone.InstId),
+		rstate: c.REBAL_ACTIVE,
+		respch: respch}
+	if err := <-respch; err != nil {
+		return err
+	}
+
+	defn.InstId = c.IndexInstId(inst.InstId)
+	defn.RealInstId = c.IndexInstId(inst.RealInstId)
+
+	return s.post("/dropIndex", manager.IndexRequest{Index: defn})
+}
+
+func (s *storageMigrator) post(url string, req manager.IndexRequest) error {
+
+	body, err := json.Marshal(&req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := postWithAuth(s.mgr.localhttp+url, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	response := new(manager.IndexResponse)
+	if err := convertResponse(resp, response); err != nil {
+		return err
+	}
+	if response.Code == manager.RESP_ERROR {
+		return fmt.Errorf("%v: %v", url, response.Error)
+	}
+
+	return nil
+}
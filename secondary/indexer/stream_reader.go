@@ -24,6 +24,18 @@ import (
 	Stats "github.com/couchbase/indexing/secondary/stats"
 )
 
+//Bytes received by a stream worker between two stream priority checks
+const STREAM_PRIORITY_BATCHSIZE = 64 * 1024
+
+//gStreamPriority gives MAINT_STREAM priority over INIT_STREAM in the stream
+//workers, as set by settings.stream_priority
+var gStreamPriority = common.NewStreamPriority()
+
+func updateStreamPriority(config common.Config) {
+	gStreamPriority.SetWeights(config["settings.stream_priority.maint_weight"].Int(),
+		config["settings.stream_priority.init_weight"].Int())
+}
+
 //MutationStreamReader reads a Dataport and stores the incoming mutations
 //in mutation queue. This is the only component writing to a mutation queue.
 type MutationStreamReader interface {
@@ -596,6 +608,11 @@ type streamWorker struct {
 	keyspaceIdFirstSnap map[string]firstSnapFlag
 
 	vbMap *VbMapHolder
+
+	// bytes received for rebalance since the last throttling check
+	rebalBytes int
+	// bytes received since the last stream priority check
+	priorityBytes int
 }
 
 func newStreamWorker(streamId common.StreamId, numWorkers int, workerId int, config common.Config,
@@ -653,6 +670,14 @@ func (w *streamWorker) start() {
 func (w *streamWorker) handleKeyVersions(keyspaceId string, vbucket Vbucket, vbuuid Vbuuid,
 	opaque uint64, kvs []*protobuf.KeyVersions, projVer common.ProjectorVersion) {
 
+	if w.streamId == common.INIT_STREAM && gRebalanceThrottle.isActive() {
+		w.throttleRebalance(kvs)
+	}
+
+	if w.streamId == common.MAINT_STREAM || w.streamId == common.INIT_STREAM {
+		w.applyStreamPriority(kvs)
+	}
+
 	for _, kv := range kvs {
 		w.handleSingleKeyVersion(keyspaceId, vbucket, vbuuid, opaque, kv, projVer)
 
@@ -666,6 +691,66 @@ func (w *streamWorker) handleKeyVersions(keyspaceId string, vbucket Vbucket, vbu
 
 }
 
+//applyStreamPriority accounts the data received by MAINT_STREAM and INIT_STREAM,
+//and blocks an INIT_STREAM worker as long as INIT_STREAM is over its share while
+//MAINT_STREAM is backlogged
+func (w *streamWorker) applyStreamPriority(kvs []*protobuf.KeyVersions) {
+
+	if w.streamId == common.MAINT_STREAM && len(w.workerch) >= cap(w.workerch)/2 {
+		gStreamPriority.MaintBacklog()
+	}
+
+	for _, kv := range kvs {
+		w.priorityBytes += len(kv.GetDocid())
+		for _, key := range kv.GetKeys() {
+			w.priorityBytes += len(key)
+		}
+	}
+
+	if w.priorityBytes < STREAM_PRIORITY_BATCHSIZE {
+		return
+	}
+
+	if w.streamId == common.MAINT_STREAM {
+		gStreamPriority.AddMaint(w.priorityBytes)
+	} else if wait := gStreamPriority.WaitInit(w.priorityBytes, w.workerStopCh); wait > 0 {
+		w.reader.stats.Get().streamPriorityWaitDuration.Add(int64(wait))
+	}
+	w.priorityBytes = 0
+}
+
+//throttleRebalance accounts the data received to build indexes during rebalance,
+//and blocks the worker as long as the node is over the rebalance transfer rate.
+//Keys of the indexes not built by rebalance are not accounted.
+func (w *streamWorker) throttleRebalance(kvs []*protobuf.KeyVersions) {
+
+	var bytes int
+	for _, kv := range kvs {
+		uuids := kv.GetUuids()
+		for i, key := range kv.GetKeys() {
+			if i < len(uuids) && gRebalanceThrottle.isThrottled(common.IndexInstId(uuids[i])) {
+				bytes += len(kv.GetDocid()) + len(key)
+			}
+		}
+	}
+	if bytes == 0 {
+		return
+	}
+
+	stats := w.reader.stats.Get()
+	stats.rebalanceTransferBytes.Add(int64(bytes))
+
+	w.rebalBytes += bytes
+	if w.rebalBytes < REBALANCE_THROTTLE_BATCHSIZE {
+		return
+	}
+
+	if wait := gRebalanceThrottle.throttle(w.rebalBytes); wait > 0 {
+		stats.rebalanceThrottleDuration.Add(int64(wait))
+	}
+	w.rebalBytes = 0
+}
+
 //handleSingleKeyVersion processes a single mutation based on the command type
 //A mutation is put in a worker queue and control message is sent to supervisor
 func (w *streamWorker) handleSingleKeyVersion(keyspaceId string, vbucket Vbucket, vbuuid Vbuuid,
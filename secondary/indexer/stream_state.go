@@ -398,6 +398,7 @@ func (ss *StreamState) cleanupKeyspaceIdFromStream(streamId common.StreamId,
 	delete(ss.streamKeyspaceIdRestartVbTsMap[streamId], keyspaceId)
 	delete(ss.streamKeyspaceIdIndexCountMap[streamId], keyspaceId)
 	delete(ss.streamKeyspaceIdRepairStopCh[streamId], keyspaceId)
+	gFeedHealth.repairDone(streamId, keyspaceId, "keyspace removed from stream")
 	delete(ss.streamKeyspaceIdTimerStopCh[streamId], keyspaceId)
 	delete(ss.streamKeyspaceIdLastPersistTime[streamId], keyspaceId)
 	delete(ss.streamKeyspaceIdRestartTsMap[streamId], keyspaceId)
@@ -1340,7 +1341,7 @@ func (ss *StreamState) checkNewTSDue(streamId common.StreamId, keyspaceId string
 
 func (ss *StreamState) checkCommitOverdue(streamId common.StreamId, keyspaceId string) bool {
 
-	snapPersistInterval := ss.getPersistInterval()
+	snapPersistInterval := ss.getPersistInterval(keyspaceId)
 	persistDuration := time.Duration(snapPersistInterval) * time.Millisecond
 
 	lastPersistTime := ss.streamKeyspaceIdLastPersistTime[streamId][keyspaceId]
@@ -1617,12 +1618,15 @@ func updateTsSeqNumToSnapshot(ts *common.TsVbuuid) {
 	}
 
 }
-func (ss *StreamState) getPersistInterval() uint64 {
+func (ss *StreamState) getPersistInterval(keyspaceId string) uint64 {
+
+	bucket, scope, collection := SplitKeyspaceId(keyspaceId)
+	ks := common.GetKeyspaceSettings()
 
 	if common.GetStorageMode() == common.FORESTDB {
-		return ss.config["settings.persisted_snapshot.interval"].Uint64()
+		return ks.ConfigValue(ss.config, "settings.persisted_snapshot.interval", bucket, scope, collection).Uint64()
 	} else {
-		return ss.config["settings.persisted_snapshot.moi.interval"].Uint64()
+		return ks.ConfigValue(ss.config, "settings.persisted_snapshot.moi.interval", bucket, scope, collection).Uint64()
 	}
 
 }
@@ -0,0 +1,152 @@
+package indexer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestUseOSOForBuild(t *testing.T) {
+
+	on, off := true, false
+	newIndexList := func(buildOSO ...*bool) []common.IndexInst {
+		var indexList []common.IndexInst
+		for _, b := range buildOSO {
+			indexList = append(indexList, common.IndexInst{Defn: common.IndexDefn{BuildOSO: b}})
+		}
+		return indexList
+	}
+
+	tests := []struct {
+		indexList  []common.IndexInst
+		enableOSO  bool
+		streamId   common.StreamId
+		clusterVer uint64
+		allowOSO   bool
+		useOSO     bool
+	}{
+		{newIndexList(nil), true, common.INIT_STREAM, common.INDEXER_70_VERSION, true, true},
+		{newIndexList(nil), false, common.INIT_STREAM, common.INDEXER_70_VERSION, true, false},
+
+		// an index can override build.enableOSO
+		{newIndexList(nil, &on), false, common.INIT_STREAM, common.INDEXER_70_VERSION, true, true},
+		{newIndexList(nil, &off), true, common.INIT_STREAM, common.INDEXER_70_VERSION, true, false},
+		{newIndexList(&on, &off), true, common.INIT_STREAM, common.INDEXER_70_VERSION, true, false},
+
+		// OSO is only used for a collection stream which starts from zero
+		{newIndexList(&on), true, common.MAINT_STREAM, common.INDEXER_70_VERSION, true, false},
+		{newIndexList(&on), true, common.INIT_STREAM, common.INDEXER_65_VERSION, true, false},
+		{newIndexList(&on), true, common.INIT_STREAM, common.INDEXER_70_VERSION, false, false},
+	}
+
+	for i, test := range tests {
+		useOSO := useOSOForBuild(test.indexList, test.enableOSO, test.streamId,
+			test.clusterVer, test.allowOSO, 0, nil)
+		if useOSO != test.useOSO {
+			t.Fatalf("test %v: expected OSO %v, got %v", i, test.useOSO, useOSO)
+		}
+	}
+
+	// OSO is only used for collections with at least minItems items
+	itemCount := func(count uint64, err error) func() (uint64, error) {
+		return func() (uint64, error) {
+			return count, err
+		}
+	}
+
+	sizeTests := []struct {
+		indexList []common.IndexInst
+		itemCount func() (uint64, error)
+		useOSO    bool
+	}{
+		{newIndexList(nil), itemCount(1000, nil), true},
+		{newIndexList(nil), itemCount(999, nil), false},
+		{newIndexList(nil), itemCount(0, errors.New("no stats")), true},
+
+		// an index which sets build_oso does not check the size
+		{newIndexList(nil, &on), itemCount(10, nil), true},
+		{newIndexList(nil, &off), itemCount(1000, nil), false},
+	}
+
+	for i, test := range sizeTests {
+		useOSO := useOSOForBuild(test.indexList, true, common.INIT_STREAM,
+			common.INDEXER_70_VERSION, true, 1000, test.itemCount)
+		if useOSO != test.useOSO {
+			t.Fatalf("size test %v: expected OSO %v, got %v", i, test.useOSO, useOSO)
+		}
+	}
+}
+
+func TestStreamStateOSO(t *testing.T) {
+
+	config := common.SystemConfig.SectionConfig("indexer.", true)
+	config.SetValue("numVbuckets", 4)
+
+	streamId := common.INIT_STREAM
+	keyspaceId := "default:s1:c1"
+
+	ss := InitStreamState(config)
+	ss.initNewStream(streamId)
+	ss.initKeyspaceIdInStream(streamId, keyspaceId)
+	ss.streamKeyspaceIdEnableOSO[streamId][keyspaceId] = true
+
+	// mutations of an OSO snapshot of vbucket 0 are counted.  The seqno of
+	// the OSO hwt is the highest seqno received, and the vbuuid the count.
+	hwt := common.NewTsVbuuid(keyspaceId, 4)
+	prevSnap := common.NewTsVbuuid(keyspaceId, 4)
+	hwtOSO := common.NewTsVbuuid(keyspaceId, 4)
+	hwtOSO.Seqnos[0] = 100
+	hwtOSO.Vbuuids[0] = 10
+
+	ss.updateHWT(streamId, keyspaceId, hwt, hwtOSO, prevSnap)
+	if !ss.checkNewTSDue(streamId, keyspaceId) {
+		t.Fatal("expected new TS to be due")
+	}
+
+	tsElem := ss.getNextStabilityTS(streamId, keyspaceId)
+	ts := tsElem.ts
+	if ts.Seqnos[0] != 100 || ts.Snapshots[0][0] != 0 || ts.Snapshots[0][1] != 0 ||
+		tsElem.osoCount[0] != 10 || !ts.HasOpenOSOSnap() {
+		t.Fatalf("unexpected open OSO TS %v count %v", ts, tsElem.osoCount)
+	}
+
+	// an open OSO snapshot is flushed by count
+	changeVec, noChange, countVec := ss.computeTsChangeVec(streamId, keyspaceId, tsElem)
+	if noChange || !changeVec[0] || changeVec[1] || countVec[0] != 10 || ts.Seqnos[0] != 10 {
+		t.Fatalf("unexpected change %v %v count %v seqno %v", noChange, changeVec, countVec, ts.Seqnos[0])
+	}
+	ss.streamKeyspaceIdLastFlushedTsMap[streamId][keyspaceId] = ts
+
+	// at the end of the OSO snapshot, the rest of the mutations are flushed
+	// and the TS is reconciled to the high seqno of the snapshot
+	hwtOSO = common.NewTsVbuuid(keyspaceId, 4)
+	hwtOSO.Seqnos[0] = 200
+	hwtOSO.Vbuuids[0] = 25
+	hwtOSO.Snapshots[0][1] = 1
+
+	ss.updateHWT(streamId, keyspaceId, hwt, hwtOSO, prevSnap)
+	tsElem = ss.getNextStabilityTS(streamId, keyspaceId)
+	ts = tsElem.ts
+	if ts.HasOpenOSOSnap() || tsElem.osoCount[0] != 25 {
+		t.Fatalf("unexpected OSO TS %v count %v", ts, tsElem.osoCount)
+	}
+
+	changeVec, noChange, countVec = ss.computeTsChangeVec(streamId, keyspaceId, tsElem)
+	if noChange || !changeVec[0] || countVec[0] != 15 {
+		t.Fatalf("unexpected change %v %v count %v", noChange, changeVec, countVec)
+	}
+	if ts.Seqnos[0] != 200 || ts.Snapshots[0][0] != 200 || ts.Snapshots[0][1] != 200 {
+		t.Fatalf("expected TS reconciled to seqno 200, got %v %v", ts.Seqnos[0], ts.Snapshots[0])
+	}
+	ss.streamKeyspaceIdLastFlushedTsMap[streamId][keyspaceId] = ts
+
+	// once flushed to the end of the OSO snapshot, the vbucket is snapshot
+	// aligned at the high seqno
+	tsElem = ss.getNextStabilityTS(streamId, keyspaceId)
+	_, _, countVec = ss.computeTsChangeVec(streamId, keyspaceId, tsElem)
+	ts = tsElem.ts
+	if countVec[0] != 0 || ts.Seqnos[0] != 200 || ts.Snapshots[0][0] != 200 || ts.Snapshots[0][1] != 200 {
+		t.Fatalf("unexpected TS after OSO %v count %v", ts, countVec)
+	}
+}
@@ -95,6 +95,8 @@ func NewTimekeeper(supvCmdch MsgChannel, supvRespch MsgChannel,
 		clusterInfoClient: c,
 	}
 
+	gFeedHealth.updateConfig(config)
+
 	//start timekeeper loop which listens to commands from its supervisor
 	go tk.run()
 
@@ -2078,6 +2080,7 @@ func (tk *timekeeper) handleConfigUpdate(cmd Message) {
 	cfgUpdate := cmd.(*MsgConfigUpdate)
 	tk.config = cfgUpdate.GetConfig()
 	tk.ss.UpdateConfig(tk.config)
+	gFeedHealth.updateConfig(tk.config)
 
 	tk.supvCmdch <- &MsgSuccess{}
 }
@@ -2813,7 +2816,7 @@ func (tk *timekeeper) setSnapshotType(streamId common.StreamId, keyspaceId strin
 			}
 
 			// if storage type is MOI, then also generate snapshot during initial build.
-			if common.GetStorageMode() == common.MOI {
+			if tk.hasMOIIndex(streamId, keyspaceId) {
 				flushTs.SetSnapType(common.INMEM_SNAP)
 			}
 
@@ -2823,10 +2826,10 @@ func (tk *timekeeper) setSnapshotType(streamId common.StreamId, keyspaceId strin
 			var snapPersistInterval uint64
 			var persistDuration time.Duration
 			if flushTs.GetSnapType() == common.INMEM_SNAP && isMergeCandidate {
-				snapPersistInterval = tk.getPersistInterval()
+				snapPersistInterval = tk.getPersistInterval(keyspaceId)
 				persistDuration = time.Duration(snapPersistInterval) * time.Millisecond
 			} else {
-				snapPersistInterval = tk.getPersistIntervalInitBuild()
+				snapPersistInterval = tk.getPersistIntervalInitBuild(keyspaceId)
 				persistDuration = time.Duration(snapPersistInterval) * time.Millisecond
 			}
 
@@ -2837,11 +2840,11 @@ func (tk *timekeeper) setSnapshotType(streamId common.StreamId, keyspaceId strin
 			}
 		} else if flushTs.GetSnapType() == common.NO_SNAP_OSO {
 			// if storage type is MOI, generate snapshot during initial build.
-			if common.GetStorageMode() == common.MOI {
+			if tk.hasMOIIndex(streamId, keyspaceId) {
 				flushTs.SetSnapType(common.INMEM_SNAP_OSO)
 			}
 
-			snapPersistInterval := tk.getPersistIntervalInitBuild()
+			snapPersistInterval := tk.getPersistIntervalInitBuild(keyspaceId)
 			persistDuration := time.Duration(snapPersistInterval) * time.Millisecond
 			//create disk snapshot based on wall clock time
 			if time.Since(lastPersistTime) > persistDuration {
@@ -2852,7 +2855,7 @@ func (tk *timekeeper) setSnapshotType(streamId common.StreamId, keyspaceId strin
 	} else if flushTs.IsSnapAligned() {
 		//for incremental build, snapshot only if ts is snap aligned
 		//set either in-mem or persist snapshot based on wall clock time
-		snapPersistInterval := tk.getPersistInterval()
+		snapPersistInterval := tk.getPersistInterval(keyspaceId)
 		persistDuration := time.Duration(snapPersistInterval) * time.Millisecond
 
 		if time.Since(lastPersistTime) > persistDuration {
@@ -3275,9 +3278,14 @@ func (tk *timekeeper) handleStreamCleanup(cmd Message) {
 func (tk *timekeeper) repairStream(streamId common.StreamId,
 	keyspaceId string) {
 
-	//wait for REPAIR_BATCH_TIMEOUT to batch more error msgs
-	//and send request to KV for a batch
-	time.Sleep(REPAIR_BATCH_TIMEOUT * time.Millisecond)
+	//wait for the repair backoff to batch more error msgs
+	//and send request to KV for a batch. The backoff grows
+	//with every retry of the repair.
+	time.Sleep(gFeedHealth.nextAttempt(streamId, keyspaceId))
+
+	if stats := tk.stats.Get(); stats != nil {
+		stats.streamRepairAttempts.Add(1)
+	}
 
 	tk.lock.Lock()
 	defer tk.lock.Unlock()
@@ -3286,6 +3294,7 @@ func (tk *timekeeper) repairStream(streamId common.StreamId,
 
 		logging.Infof("Timekeeper::repairStream Found Stream %v KeyspaceId %v In "+
 			"State %v. Skipping Repair.", streamId, keyspaceId, status)
+		gFeedHealth.repairDone(streamId, keyspaceId, "stream not active")
 		return
 	}
 
@@ -3307,6 +3316,7 @@ func (tk *timekeeper) repairStream(streamId common.StreamId,
 		}
 
 		delete(tk.ss.streamKeyspaceIdRepairStopCh[streamId], keyspaceId)
+		gFeedHealth.repairDone(streamId, keyspaceId, "rollback")
 		return
 	}
 
@@ -3353,6 +3363,7 @@ func (tk *timekeeper) repairStream(streamId common.StreamId,
 
 	} else {
 		delete(tk.ss.streamKeyspaceIdRepairStopCh[streamId], keyspaceId)
+		gFeedHealth.repairDone(streamId, keyspaceId, "recovered")
 		logging.Infof("Timekeeper::repairStream Nothing to repair for "+
 			"Stream %v and KeyspaceId %v", streamId, keyspaceId)
 
@@ -3380,6 +3391,7 @@ func (tk *timekeeper) sendRestartMsg(restartMsg Message) {
 	if tk.checkIndexerState(common.INDEXER_PREPARE_UNPAUSE) {
 		tk.lock.Lock()
 		delete(tk.ss.streamKeyspaceIdRepairStopCh[streamId], keyspaceId)
+		gFeedHealth.repairDone(streamId, keyspaceId, "indexer unpause")
 		tk.lock.Unlock()
 		return
 	}
@@ -3394,6 +3406,7 @@ func (tk *timekeeper) sendRestartMsg(restartMsg Message) {
 		if status != STREAM_ACTIVE {
 			logging.Infof("Timekeeper::sendRestartMsg Found Stream %v KeyspaceId %v In "+
 				"State %v. Skipping %v.", streamId, keyspaceId, status, logMsg)
+			gFeedHealth.repairDone(streamId, keyspaceId, "stream not active")
 			return false
 		}
 
@@ -3518,10 +3531,12 @@ func (tk *timekeeper) sendRestartMsg(restartMsg Message) {
 						sessionId:  currSessionId,
 					}
 					delete(tk.ss.streamKeyspaceIdRepairStopCh[streamId], keyspaceId)
+					gFeedHealth.repairDone(streamId, keyspaceId, "rollback")
 					return
 				}
 				// update repair state even if there is rollback
 				tk.ss.updateRepairState(streamId, keyspaceId, repairVbs, shutdownVbs)
+				gFeedHealth.repairFailed(streamId, keyspaceId, fmt.Sprintf("rollback %v", rollbackTs))
 				contRepair = true
 
 			} else {
@@ -3538,6 +3553,7 @@ func (tk *timekeeper) sendRestartMsg(restartMsg Message) {
 				}
 
 				delete(tk.ss.streamKeyspaceIdRepairStopCh[streamId], keyspaceId)
+				gFeedHealth.repairDone(streamId, keyspaceId, "rollback")
 			}
 		}()
 
@@ -3578,6 +3594,7 @@ func (tk *timekeeper) sendRestartMsg(restartMsg Message) {
 			}
 
 			delete(tk.ss.streamKeyspaceIdRepairStopCh[streamId], keyspaceId)
+			gFeedHealth.repairDone(streamId, keyspaceId, "rollback")
 			return
 		}
 
@@ -3629,6 +3646,7 @@ func (tk *timekeeper) sendRestartMsg(restartMsg Message) {
 
 			currSessionId := tk.ss.getSessionId(streamId, keyspaceId)
 			delete(tk.ss.streamKeyspaceIdRepairStopCh[streamId], keyspaceId)
+			gFeedHealth.repairDone(streamId, keyspaceId, "keyspace not found")
 			tk.ss.streamKeyspaceIdStatus[streamId][keyspaceId] = STREAM_INACTIVE
 
 			tk.supvRespch <- &MsgRecovery{mType: INDEXER_KEYSPACE_NOT_FOUND,
@@ -3638,6 +3656,7 @@ func (tk *timekeeper) sendRestartMsg(restartMsg Message) {
 		} else {
 			logging.Errorf("Timekeeper::sendRestartMsg Error Response "+
 				"from KV %v For Request %v. Retrying RestartVbucket.", kvresp, restartMsg)
+			gFeedHealth.repairFailed(streamId, keyspaceId, fmt.Sprintf("%v", kvresp))
 
 			tk.repairStream(streamId, keyspaceId)
 		}
@@ -3663,6 +3682,7 @@ func (tk *timekeeper) repairStreamWithMTR(streamId common.StreamId, keyspaceId s
 
 	// stop repair
 	delete(tk.ss.streamKeyspaceIdRepairStopCh[streamId], keyspaceId)
+	gFeedHealth.repairDone(streamId, keyspaceId, "stream repair")
 
 	// Update repair state of each vb now, even though MTR has not completed yet, since
 	// repairStream will terminate after this function.
@@ -3803,6 +3823,7 @@ func (tk *timekeeper) handleStats(cmd Message) {
 				}
 			}
 
+			eta := int64(0)
 			switch inst.State {
 			default:
 				v = 0.00
@@ -3816,6 +3837,9 @@ func (tk *timekeeper) handleStats(cmd Message) {
 
 				if totalToBeflushed > flushedCount {
 					v = float64(flushedCount) * 100.00 / float64(totalToBeflushed)
+					if idxStats != nil {
+						eta = tk.estimateBuildEta(idxStats, flushedCount, totalToBeflushed-flushedCount, progressStatTime)
+					}
 				} else {
 					v = 100.00
 				}
@@ -3828,6 +3852,7 @@ func (tk *timekeeper) handleStats(cmd Message) {
 				idxStats.numDocsPending.Set(int64(pending))
 				idxStats.buildProgress.Set(int64(v))
 				idxStats.completionProgress.Set(int64(math.Float64bits(v)))
+				idxStats.buildEta.Set(eta)
 				idxStats.lastRollbackTime.Set(tk.ss.keyspaceIdRollbackTime[keyspaceId])
 				idxStats.progressStatTime.Set(progressStatTime)
 			}
@@ -3837,6 +3862,35 @@ func (tk *timekeeper) handleStats(cmd Message) {
 	}()
 }
 
+//
+// estimateBuildEta returns the estimated time (in seconds) for an index
+// build to catch up with the remaining seqnos, based on the average
+// rate of flushed mutations since the last stats update.  It returns
+// -1 if the rate is not known yet.
+//
+func (tk *timekeeper) estimateBuildEta(idxStats *IndexStats, flushedCount uint64,
+	remaining uint64, now int64) int64 {
+
+	lastCount := idxStats.numDocsProcessed.Value()
+	lastTime := idxStats.lastBuildStatTime.Value()
+	idxStats.lastBuildStatTime.Set(now)
+
+	if lastTime != 0 && now > lastTime && int64(flushedCount) >= lastCount {
+		rate := float64(int64(flushedCount)-lastCount) / (float64(now-lastTime) / float64(time.Second))
+		if avg := idxStats.avgBuildRate.Value(); avg != 0 {
+			rate = (rate + float64(avg)) / 2
+		}
+		idxStats.avgBuildRate.Set(int64(rate))
+	}
+
+	rate := idxStats.avgBuildRate.Value()
+	if rate <= 0 {
+		return -1
+	}
+
+	return int64(remaining) / rate
+}
+
 func (tk *timekeeper) updateTimestampStats() {
 
 	tk.lock.Lock()
@@ -3931,7 +3985,7 @@ func (tk *timekeeper) startTimer(streamId common.StreamId,
 
 	logging.Infof("Timekeeper::startTimer %v %v", streamId, keyspaceId)
 
-	snapInterval := tk.getInMemSnapInterval()
+	snapInterval := tk.getInMemSnapInterval(keyspaceId)
 	ticker := time.NewTicker(time.Millisecond * time.Duration(snapInterval))
 	stopCh := tk.ss.streamKeyspaceIdTimerStopCh[streamId][keyspaceId]
 
@@ -4026,6 +4080,25 @@ func (tk *timekeeper) hasInitStateIndex(streamId common.StreamId,
 	return false
 }
 
+//returns true if storage mode of the indexer, or of any index
+//of the keyspace in the stream, is MOI
+func (tk *timekeeper) hasMOIIndex(streamId common.StreamId,
+	keyspaceId string) bool {
+
+	if common.GetStorageMode() == common.MOI {
+		return true
+	}
+
+	for _, inst := range tk.indexInstMap {
+		if inst.Defn.KeyspaceId(inst.Stream) == keyspaceId &&
+			inst.Stream == streamId &&
+			common.IndexTypeToStorageMode(inst.Defn.Using) == common.MOI {
+			return true
+		}
+	}
+	return false
+}
+
 //calc skip factor for in-mem snapshots based on the
 //number of pending TS to be flushed
 func (tk *timekeeper) calcSkipFactorForFastFlush(streamId common.StreamId,
@@ -4150,30 +4223,37 @@ func (tk *timekeeper) checkIndexerState(state common.IndexerState) bool {
 
 }
 
-func (tk *timekeeper) getPersistInterval() uint64 {
+//keyspaceConfigValue returns the setting overridden for the keyspace
+func (tk *timekeeper) keyspaceConfigValue(name string, keyspaceId string) common.ConfigValue {
+
+	bucket, scope, collection := SplitKeyspaceId(keyspaceId)
+	return common.GetKeyspaceSettings().ConfigValue(tk.config, name, bucket, scope, collection)
+}
+
+func (tk *timekeeper) getPersistInterval(keyspaceId string) uint64 {
 
 	if common.GetStorageMode() == common.FORESTDB {
-		return tk.config["settings.persisted_snapshot.fdb.interval"].Uint64()
+		return tk.keyspaceConfigValue("settings.persisted_snapshot.fdb.interval", keyspaceId).Uint64()
 	} else {
-		return tk.config["settings.persisted_snapshot.moi.interval"].Uint64()
+		return tk.keyspaceConfigValue("settings.persisted_snapshot.moi.interval", keyspaceId).Uint64()
 	}
 
 }
-func (tk *timekeeper) getPersistIntervalInitBuild() uint64 {
+func (tk *timekeeper) getPersistIntervalInitBuild(keyspaceId string) uint64 {
 
 	if common.GetStorageMode() == common.FORESTDB {
-		return tk.config["settings.persisted_snapshot_init_build.fdb.interval"].Uint64()
+		return tk.keyspaceConfigValue("settings.persisted_snapshot_init_build.fdb.interval", keyspaceId).Uint64()
 	} else {
-		return tk.config["settings.persisted_snapshot_init_build.moi.interval"].Uint64()
+		return tk.keyspaceConfigValue("settings.persisted_snapshot_init_build.moi.interval", keyspaceId).Uint64()
 	}
 
 }
-func (tk *timekeeper) getInMemSnapInterval() uint64 {
+func (tk *timekeeper) getInMemSnapInterval(keyspaceId string) uint64 {
 
 	if common.GetStorageMode() == common.FORESTDB {
-		return tk.config["settings.inmemory_snapshot.fdb.interval"].Uint64()
+		return tk.keyspaceConfigValue("settings.inmemory_snapshot.fdb.interval", keyspaceId).Uint64()
 	} else {
-		return tk.config["settings.inmemory_snapshot.moi.interval"].Uint64()
+		return tk.keyspaceConfigValue("settings.inmemory_snapshot.moi.interval", keyspaceId).Uint64()
 	}
 
 }
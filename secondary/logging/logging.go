@@ -11,6 +11,9 @@ import "io/ioutil"
 import "runtime/debug"
 import l "log"
 import "runtime"
+import "reflect"
+import "sync/atomic"
+import "unsafe"
 
 // Log levels
 type LogLevel int16
@@ -30,6 +33,18 @@ const (
 const udtag_begin = "<ud>"
 const udtag_end = "</ud>"
 
+// Redaction levels of user data tagged by TagUD and TagStrUD
+type RedactionLevel int32
+
+const (
+	// user data is tagged, to be redacted when logs are collected
+	RedactPartial RedactionLevel = iota
+	// user data is not logged
+	RedactFull
+	// user data is logged without tags
+	RedactNone
+)
+
 // Logger interface
 type Logger interface {
 	// Warnings, logged by default.
@@ -119,6 +134,30 @@ func Level(s string) LogLevel {
 	}
 }
 
+func (r RedactionLevel) String() string {
+	switch r {
+	case RedactFull:
+		return "full"
+	case RedactNone:
+		return "none"
+	default:
+		return "partial"
+	}
+}
+
+func Redaction(s string) (RedactionLevel, error) {
+	switch strings.ToLower(s) {
+	case "partial":
+		return RedactPartial, nil
+	case "full":
+		return RedactFull, nil
+	case "none":
+		return RedactNone, nil
+	default:
+		return RedactPartial, fmt.Errorf("invalid redaction level %v", s)
+	}
+}
+
 type destination struct {
 	baselevel LogLevel
 	target    *l.Logger
@@ -234,18 +273,61 @@ func (log *destination) LazyTrace(fn func() string) {
 	}
 }
 
-// Check if enabled
+// Check if enabled, for the base log level or any module log level
 func (log *destination) IsEnabled(at LogLevel) bool {
+	return log.baselevel >= at || getModuleLevels().max >= at
+}
+
+// Check if enabled for the module of the caller
+func (log *destination) isEnabledFor(at LogLevel) bool {
+	modules := getModuleLevels()
+	if len(modules.levels) == 0 || modules.max < at {
+		return log.baselevel >= at
+	}
+
+	if level, ok := modules.levels[callerModule()]; ok {
+		return level >= at
+	}
 	return log.baselevel >= at
 }
 
 func (log *destination) printf(at LogLevel, format string, v ...interface{}) {
-	if log.IsEnabled(at) {
+	if log.isEnabledFor(at) {
 		ts := time.Now().Format("2006-01-02T15:04:05.000-07:00")
 		log.target.Printf(ts+" ["+at.String()+"] "+format, v...)
 	}
 }
 
+// callerModule returns the package name of the first caller outside this
+// package.  The logger is called through package functions, destination
+// methods and Lazy helpers, so the depth of the caller is not fixed.
+func callerModule() string {
+	var pcs [16]uintptr
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var name string
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, loggingPkg) {
+			name = frame.Function
+			break
+		}
+		if !more {
+			return ""
+		}
+	}
+
+	// github.com/couchbase/indexing/secondary/indexer.(*indexer).run
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
 func (log *destination) getStackTrace(skip int, stack []byte) string {
 	var buf bytes.Buffer
 	lines := strings.Split(string(stack), "\n")
@@ -258,6 +340,21 @@ func (log *destination) getStackTrace(skip int, stack []byte) string {
 // The default logger
 var SystemLogger destination
 
+type moduleLevels struct {
+	levels map[string]LogLevel
+	max    LogLevel
+}
+
+// Prefix of the functions of this package, as reported by runtime
+var loggingPkg = reflect.TypeOf(destination{}).PkgPath() + "."
+
+var pModuleLevels unsafe.Pointer = unsafe.Pointer(&moduleLevels{})
+var pRedaction int32
+
+func getModuleLevels() *moduleLevels {
+	return (*moduleLevels)(atomic.LoadPointer(&pModuleLevels))
+}
+
 func init() {
 	dest := l.New(os.Stdout, "", 0)
 	SystemLogger = destination{baselevel: Info, target: dest}
@@ -327,6 +424,40 @@ func IsEnabled(lvl LogLevel) bool {
 	return SystemLogger.IsEnabled(lvl)
 }
 
+// Set the log levels of modules, which override the base log level for
+// messages logged by the module.  A module is the name of the go package
+// that calls the logger, such as indexer or queryport.  Libraries that log
+// through SystemLogger, such as plasma, are modules of their own.
+func SetModuleLogLevels(levels map[string]LogLevel) {
+	modules := &moduleLevels{levels: make(map[string]LogLevel)}
+	for module, level := range levels {
+		modules.levels[module] = level
+		if level > modules.max {
+			modules.max = level
+		}
+	}
+	atomic.StorePointer(&pModuleLevels, unsafe.Pointer(modules))
+}
+
+// Get the log levels of modules
+func GetModuleLogLevels() map[string]LogLevel {
+	levels := make(map[string]LogLevel)
+	for module, level := range getModuleLevels().levels {
+		levels[module] = level
+	}
+	return levels
+}
+
+// Set the redaction level of user data
+func SetRedactionLevel(r RedactionLevel) {
+	atomic.StoreInt32(&pRedaction, int32(r))
+}
+
+// Get the redaction level of user data
+func GetRedactionLevel() RedactionLevel {
+	return RedactionLevel(atomic.LoadInt32(&pRedaction))
+}
+
 // Run function only if output will be logged at verbose level
 func LazyVerbose(fn func() string) {
 	if SystemLogger.IsEnabled(Verbose) {
@@ -386,10 +517,22 @@ func LazyTracef(fmt string, fns ...func() string) {
 
 // Tag user data in default format
 func TagUD(arg interface{}) interface{} {
+	switch GetRedactionLevel() {
+	case RedactFull:
+		return udtag_begin + "(redacted)" + udtag_end
+	case RedactNone:
+		return fmt.Sprintf("%v", arg)
+	}
 	return fmt.Sprintf("%s(%v)%s", udtag_begin, arg, udtag_end)
 }
 
 // Tag user data in string format
 func TagStrUD(arg interface{}) interface{} {
+	switch GetRedactionLevel() {
+	case RedactFull:
+		return udtag_begin + "(redacted)" + udtag_end
+	case RedactNone:
+		return fmt.Sprintf("%s", arg)
+	}
 	return fmt.Sprintf("%s(%s)%s", udtag_begin, arg, udtag_end)
 }
@@ -0,0 +1,41 @@
+package logging_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+func TestModuleLogLevel(t *testing.T) {
+	buffer := bytes.NewBuffer([]byte{})
+	logging.SetLogWriter(buffer)
+	defer logging.SetLogWriter(os.Stdout)
+
+	logging.SetLogLevel(logging.Info)
+	defer logging.SetModuleLogLevels(nil)
+
+	// the caller module is the same however the logger is called
+	logging.SetModuleLogLevels(map[string]logging.LogLevel{"logging_test": logging.Debug})
+	logging.Debugf("function")
+	logging.SystemLogger.Debugf("method")
+	logging.SystemLogger.LazyDebug(func() string { return "lazy" })
+	logging.LazyDebug(func() string { return "lazy function" })
+
+	s := buffer.String()
+	for _, msg := range []string{"function", "method", "lazy", "lazy function"} {
+		if !strings.Contains(s, "] "+msg+"\n") {
+			t.Fatalf("missing %q in %v", msg, s)
+		}
+	}
+
+	buffer.Reset()
+	logging.SetModuleLogLevels(map[string]logging.LogLevel{"logging": logging.Debug})
+	logging.Debugf("function")
+	logging.SystemLogger.Debugf("method")
+	if s := buffer.String(); s != "" {
+		t.Fatalf("unexpected log %v", s)
+	}
+}
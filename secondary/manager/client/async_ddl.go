@@ -0,0 +1,381 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	mc "github.com/couchbase/indexing/secondary/manager/common"
+)
+
+var ddlJobId uint64
+
+// interval at which pending DDL jobs are polled when there is no
+// metadata change
+var ddlJobPollInterval = time.Duration(5) * time.Second
+
+var ErrDDLJobClosed = errors.New("Metadata provider is closed.  The DDL request may still complete in the background.")
+
+//
+// DDLJob is the handle of a DDL request made with one of the *Async
+// methods of MetadataProvider.  The request is submitted to the indexers
+// as a command token, which is processed in the background.  The job
+// polls the metadata for its completion.  The channel returned by Done is
+// closed when the request completes.
+//
+type DDLJob struct {
+	id      uint64
+	op      string
+	defnIds []c.IndexDefnId
+	donech  chan struct{}
+
+	// check returns true if the request has completed, or an error if
+	// the request has failed
+	check func() (bool, error)
+
+	mutex sync.Mutex
+	done  bool
+	err   error
+}
+
+func newDDLJob(op string, defnIds []c.IndexDefnId, check func() (bool, error)) *DDLJob {
+	return &DDLJob{
+		id:      atomic.AddUint64(&ddlJobId, 1),
+		op:      op,
+		defnIds: defnIds,
+		check:   check,
+		donech:  make(chan struct{}),
+	}
+}
+
+// Id returns the id of the job, unique within the process
+func (j *DDLJob) Id() uint64 {
+	return j.id
+}
+
+// DefnId returns the index of the request.  For BuildIndexesAsync, it is
+// the first index of the request.
+func (j *DDLJob) DefnId() c.IndexDefnId {
+	if len(j.defnIds) == 0 {
+		return c.IndexDefnId(0)
+	}
+	return j.defnIds[0]
+}
+
+// Done returns a channel that is closed when the request completes
+func (j *DDLJob) Done() <-chan struct{} {
+	return j.donech
+}
+
+// Wait blocks until the request completes and returns its error
+func (j *DDLJob) Wait() error {
+	<-j.donech
+	return j.Err()
+}
+
+// Err returns the error of a completed request
+func (j *DDLJob) Err() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.err
+}
+
+//
+// Poll checks whether the request has completed, and returns true if it
+// has.  The job is polled by the metadata provider, but callers can also
+// poll it, e.g. when they do not want to wait for the next metadata change.
+//
+func (j *DDLJob) Poll() (bool, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.done {
+		return true, j.err
+	}
+
+	done, err := j.check()
+	if !done && err == nil {
+		return false, nil
+	}
+
+	j.finish(err)
+	return true, err
+}
+
+func (j *DDLJob) fail(err error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if !j.done {
+		j.finish(err)
+	}
+}
+
+// finish is called with the mutex held
+func (j *DDLJob) finish(err error) {
+	j.done = true
+	j.err = err
+	close(j.donech)
+
+	if err != nil {
+		logging.Errorf("DDLJob::finish job %v: %v of index %v failed: %v", j.id, j.op, j.defnIds, err)
+	} else {
+		logging.Infof("DDLJob::finish job %v: %v of index %v completed", j.id, j.op, j.defnIds)
+	}
+}
+
+//
+// ddlJobMonitor polls the pending DDL jobs of a metadata provider.  A
+// single goroutine polls all jobs on every metadata change, and at
+// ddlJobPollInterval otherwise.  It exits when there is no pending job.
+//
+type ddlJobMonitor struct {
+	mutex   sync.Mutex
+	jobs    map[uint64]*DDLJob
+	running bool
+	closed  bool
+	closech chan struct{}
+}
+
+func (m *ddlJobMonitor) add(o *MetadataProvider, job *DDLJob) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		job.fail(ErrDDLJobClosed)
+		return
+	}
+
+	if m.jobs == nil {
+		m.jobs = make(map[uint64]*DDLJob)
+		m.closech = make(chan struct{})
+	}
+	m.jobs[job.id] = job
+
+	if !m.running {
+		m.running = true
+		go m.run(o)
+	}
+}
+
+// pending returns the pending jobs, and stops the monitor if there is none
+func (m *ddlJobMonitor) pending() []*DDLJob {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	jobs := make([]*DDLJob, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+
+	if len(jobs) == 0 || m.closed {
+		m.running = false
+	}
+	return jobs
+}
+
+func (m *ddlJobMonitor) remove(job *DDLJob) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.jobs, job.id)
+}
+
+func (m *ddlJobMonitor) run(o *MetadataProvider) {
+
+	subId, notifych := o.SubscribeMetadataChange()
+	defer o.UnsubscribeMetadataChange(subId)
+
+	ticker := time.NewTicker(ddlJobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		jobs := m.pending()
+		if len(jobs) == 0 {
+			return
+		}
+
+		for _, job := range jobs {
+			if done, _ := job.Poll(); done {
+				m.remove(job)
+			}
+		}
+
+		select {
+		case <-notifych:
+		case <-ticker.C:
+		case <-m.closech:
+		}
+	}
+}
+
+// close fails all pending jobs
+func (m *ddlJobMonitor) close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return
+	}
+	m.closed = true
+
+	for _, job := range m.jobs {
+		job.fail(ErrDDLJobClosed)
+	}
+	m.jobs = nil
+
+	if m.closech != nil {
+		close(m.closech)
+	}
+}
+
+//
+// CreateIndexAsync is the non-blocking variant of CreateIndexWithPlan.  The
+// index is scheduled for background creation and the returned job
+// completes when the index is created.  An error is returned if the
+// request cannot be submitted.
+//
+func (o *MetadataProvider) CreateIndexAsync(
+	name, bucket, scope, collection, using, exprType, whereExpr string,
+	secExprs []string, desc []bool, isPrimary bool,
+	scheme c.PartitionScheme, partitionKeys []string,
+	plan map[string]interface{}) (*DDLJob, error, bool) {
+
+	if o.GetClusterVersion() < c.INDEXER_70_VERSION {
+		return nil, errors.New("Fails to create index.  Asynchronous index creation is enabled only " +
+			"after cluster is fully upgraded and there is no failed node."), false
+	}
+
+	// FindIndexByName will only return valid index
+	if o.findIndexByName(name, bucket, scope, collection) != nil {
+		return nil, errors.New(fmt.Sprintf("Index %s already exists.", name)), false
+	}
+
+	idxDefn, err, retry := o.PrepareIndexDefn(name, bucket, scope, collection,
+		using, exprType, whereExpr, secExprs, desc, isPrimary, scheme,
+		partitionKeys, plan)
+	if err != nil {
+		return nil, err, retry
+	}
+
+	if err := o.scheduleIndexCreation(idxDefn, plan, false); err != nil {
+		return nil, err, false
+	}
+
+	defnId := idxDefn.DefnId
+	job := newDDLJob("create", []c.IndexDefnId{defnId}, func() (bool, error) {
+		if o.findIndex(defnId) != nil {
+			return true, nil
+		}
+
+		// the scheduled index creator posts a stop schedule create token
+		// if it fails to create the index
+		token, err := mc.GetStopScheduleCreateToken(defnId)
+		if err != nil {
+			logging.Warnf("DDLJob::check error %v in GetStopScheduleCreateToken for index %v", err, defnId)
+			return false, nil
+		}
+		if token != nil {
+			return false, fmt.Errorf("Fail to create index %v in the background.  Reason: %v", name, token.Reason)
+		}
+
+		return false, nil
+	})
+
+	o.ddlJobs.add(o, job)
+	return job, nil, false
+}
+
+//
+// DropIndexAsync is the non-blocking variant of DropIndex.  The index is
+// dropped in the background through the delete command token, and the
+// returned job completes when the index is removed from the metadata.
+//
+func (o *MetadataProvider) DropIndexAsync(defnID c.IndexDefnId) (*DDLJob, error) {
+
+	if err := mc.PostDeleteCommandToken(defnID); err != nil {
+		return nil, errors.New(fmt.Sprintf("Fail to Drop Index due to internal errors.  Error=%v.", err))
+	}
+
+	schedToken, _, tokenErr := o.deleteScheduleTokens(defnID)
+	if tokenErr != nil {
+		return nil, errors.New(fmt.Sprintf("Fail to Drop Index due to internal errors. "+
+			"Cleanup may happen in the background.  Error=%v.", tokenErr))
+	}
+
+	// an index that is only scheduled for creation is dropped with its tokens
+	if o.FindIndexIgnoreStatus(defnID) == nil && !schedToken {
+		return nil, errors.New("Index does not exist.")
+	}
+
+	job := newDDLJob("drop", []c.IndexDefnId{defnID}, func() (bool, error) {
+		return o.FindIndexIgnoreStatus(defnID) == nil, nil
+	})
+
+	o.ddlJobs.add(o, job)
+	return job, nil
+}
+
+//
+// BuildIndexesAsync is the non-blocking variant of BuildIndexes.  The
+// indexes are built in the background through build command tokens, and
+// the returned job completes when no instance of the indexes is waiting
+// to be built.
+//
+func (o *MetadataProvider) BuildIndexesAsync(defnIDs []c.IndexDefnId) (*DDLJob, error) {
+
+	for _, defnID := range defnIDs {
+		if o.FindIndexIgnoreStatus(defnID) == nil {
+			return nil, errors.New(fmt.Sprintf("Index %v not found.", defnID))
+		}
+	}
+
+	for _, defnID := range defnIDs {
+		if err := mc.PostBuildCommandToken(defnID); err != nil {
+			return nil, errors.New(fmt.Sprintf("Fail to Build Index due to internal errors.  Error=%v.", err))
+		}
+	}
+
+	job := newDDLJob("build", defnIDs, func() (bool, error) {
+		for _, defnID := range defnIDs {
+			meta := o.FindIndexIgnoreStatus(defnID)
+			if meta == nil {
+				return false, errors.New(fmt.Sprintf("Index %v is dropped while building.", defnID))
+			}
+			if isIndexPendingBuild(meta) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+
+	o.ddlJobs.add(o, job)
+	return job, nil
+}
+
+// isIndexPendingBuild returns true if any instance is yet to be built
+func isIndexPendingBuild(meta *IndexMetadata) bool {
+
+	for _, insts := range [][]*InstanceDefn{meta.Instances, meta.InstsInRebalance} {
+		for _, inst := range insts {
+			if inst.State == c.INDEX_STATE_CREATED || inst.State == c.INDEX_STATE_READY {
+				return true
+			}
+		}
+	}
+	return false
+}
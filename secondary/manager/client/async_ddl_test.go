@@ -0,0 +1,84 @@
+package client
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+)
+
+func TestDDLJobPoll(t *testing.T) {
+
+	var completed int32
+	job := newDDLJob("build", []c.IndexDefnId{1, 2}, func() (bool, error) {
+		return atomic.LoadInt32(&completed) == 1, nil
+	})
+
+	if job.DefnId() != c.IndexDefnId(1) {
+		t.Fatalf("expected index 1, got %v", job.DefnId())
+	}
+	if done, err := job.Poll(); done || err != nil {
+		t.Fatalf("unexpected completion %v %v", done, err)
+	}
+
+	atomic.StoreInt32(&completed, 1)
+	if done, err := job.Poll(); !done || err != nil {
+		t.Fatalf("expected completion, got %v %v", done, err)
+	}
+	if err := job.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := errors.New("failed")
+	job = newDDLJob("create", nil, func() (bool, error) {
+		return false, failed
+	})
+	if done, err := job.Poll(); !done || err != failed {
+		t.Fatalf("expected failure, got %v %v", done, err)
+	}
+	job.fail(ErrDDLJobClosed)
+	if err := job.Err(); err != failed {
+		t.Fatalf("expected %v, got %v", failed, err)
+	}
+}
+
+func TestDDLJobMonitor(t *testing.T) {
+
+	o := &MetadataProvider{subscribers: make(map[uint64]chan uint64)}
+
+	var completed int32
+	job := newDDLJob("drop", []c.IndexDefnId{1}, func() (bool, error) {
+		return atomic.LoadInt32(&completed) == 1, nil
+	})
+	o.ddlJobs.add(o, job)
+
+	// the monitor polls the job on metadata change
+	atomic.StoreInt32(&completed, 1)
+	o.notifyMetadataChange(1)
+
+	select {
+	case <-job.Done():
+	case <-time.After(ddlJobPollInterval * 2):
+		t.Fatal("job is not completed")
+	}
+
+	// pending jobs fail when the provider is closed
+	pending := newDDLJob("drop", []c.IndexDefnId{2}, func() (bool, error) {
+		return false, nil
+	})
+	o.ddlJobs.add(o, pending)
+	o.ddlJobs.close()
+	if err := pending.Wait(); err != ErrDDLJobClosed {
+		t.Fatalf("expected %v, got %v", ErrDDLJobClosed, err)
+	}
+
+	closed := newDDLJob("drop", []c.IndexDefnId{3}, func() (bool, error) {
+		return true, nil
+	})
+	o.ddlJobs.add(o, closed)
+	if err := closed.Wait(); err != ErrDDLJobClosed {
+		t.Fatalf("expected %v, got %v", ErrDDLJobClosed, err)
+	}
+}
@@ -186,8 +186,11 @@ type DedupedIndexStats struct {
 }
 
 type PerIndexStats struct {
-	// Nothing for now. With CBO, num_docs_indexed,
-	// resident_percent and other stats will come here
+	// Scan load of the index on the indexer node. Used by
+	// the client to prefer the least loaded replica. With CBO,
+	// num_docs_indexed, resident_percent and other stats will come here
+	NumScansPending float64 `json:"num_scans_pending,omitempty"`
+	AvgScanLatency  float64 `json:"avg_scan_latency,omitempty"`
 }
 
 type IndexStats2Holder struct {
@@ -207,8 +210,21 @@ func (p *IndexStats2Holder) Set(s *IndexStats2) {
 }
 
 func (p *PerIndexStats) Clone() *PerIndexStats {
-	// TODO: Update when adding stats to PerIndexStats
-	return nil
+	if p == nil {
+		return nil
+	}
+	clone := &PerIndexStats{}
+	clone.NumScansPending = p.NumScansPending
+	clone.AvgScanLatency = p.AvgScanLatency
+	return clone
+}
+
+func (p *PerIndexStats) Equal(other *PerIndexStats) bool {
+	if p == nil || other == nil {
+		return p == other
+	}
+	return p.NumScansPending == other.NumScansPending &&
+		p.AvgScanLatency == other.AvgScanLatency
 }
 
 func (d *DedupedIndexStats) Clone() *DedupedIndexStats {
@@ -79,6 +79,14 @@ type MetadataProvider struct {
 	indexerVersion     uint64
 	clusterVersion     uint64
 	statsNotifyCh      chan map[c.IndexInstId]map[c.PartitionId]c.Statistics
+
+	// subscribers to metadata version changes
+	subscribers map[uint64]chan uint64
+	subId       uint64
+	subMutex    sync.Mutex
+
+	// pending DDL jobs
+	ddlJobs ddlJobMonitor
 }
 
 //
@@ -180,12 +188,31 @@ type IndexerStatus struct {
 	Connected bool
 }
 
+// BuildIndexStatus is the outcome of the build request of an index
+type BuildIndexStatus string
+
+const (
+	BuildIndexStarted      BuildIndexStatus = "started"
+	BuildIndexInProgress   BuildIndexStatus = "in progress"
+	BuildIndexAlreadyBuilt BuildIndexStatus = "already built"
+	BuildIndexNotFound     BuildIndexStatus = "not found"
+	BuildIndexFailed       BuildIndexStatus = "failed"
+)
+
+type BuildIndexResult struct {
+	DefnId c.IndexDefnId
+	Status BuildIndexStatus
+	Err    error
+}
+
 type watcherCallback func(string, c.IndexerId, c.IndexerId)
 
 var REQUEST_CHANNEL_COUNT = 1000
 
 var VALID_PARAM_NAMES = []string{"nodes", "defer_build", "retain_deleted_xattr",
-	"num_partition", "num_replica", "docKeySize", "secKeySize", "arrSize", "numDoc", "residentRatio"}
+	"num_partition", "num_replica", "docKeySize", "secKeySize", "arrSize", "numDoc", "residentRatio",
+	"mem_quota", "evict_priority", "dimension", "similarity",
+	"build_writer_threads", "build_batch_size", "build_oso", "compression", "bloom_filter"}
 
 var ErrWaitScheduleTimeout = fmt.Errorf("Timeout in checking for schedule create token.")
 
@@ -205,6 +232,7 @@ func NewMetadataProvider(cluster string, providerId string, changeCh chan bool,
 	s.metaNotifyCh = changeCh
 	s.statsNotifyCh = statsCh
 	s.settings = settings
+	s.subscribers = make(map[uint64]chan uint64)
 
 	s.providerId = providerId
 	if err != nil {
@@ -262,6 +290,45 @@ func (o *MetadataProvider) IncrementMetadataVersion() {
 	o.repo.incrementVersion()
 }
 
+//
+// SubscribeMetadataChange returns a channel that receives the new metadata
+// version whenever the metadata is changed, e.g. by DDL or rebalance.
+// Notifications are coalesced if the subscriber is slow, so the subscriber
+// should always read the latest metadata.  The subscription is identified
+// by the returned id.
+//
+func (o *MetadataProvider) SubscribeMetadataChange() (uint64, <-chan uint64) {
+
+	o.subMutex.Lock()
+	defer o.subMutex.Unlock()
+
+	o.subId++
+	ch := make(chan uint64, 1)
+	o.subscribers[o.subId] = ch
+	return o.subId, ch
+}
+
+func (o *MetadataProvider) UnsubscribeMetadataChange(id uint64) {
+
+	o.subMutex.Lock()
+	defer o.subMutex.Unlock()
+
+	delete(o.subscribers, id)
+}
+
+func (o *MetadataProvider) notifyMetadataChange(version uint64) {
+
+	o.subMutex.Lock()
+	defer o.subMutex.Unlock()
+
+	for _, ch := range o.subscribers {
+		select {
+		case ch <- version:
+		default:
+		}
+	}
+}
+
 func (o *MetadataProvider) WatchMetadata(indexAdminPort string, callback watcherCallback, numExpectedWatcher int) c.IndexerId {
 
 	o.mutex.Lock()
@@ -744,8 +811,14 @@ func (o *MetadataProvider) verifyDuplicateScheduleToken(idxDefn *c.IndexDefn) er
 	return nil
 }
 
+//
+// scheduleIndexCreation posts a schedule create token for the index through
+// one of the indexers.  The index is created in the background by the
+// scheduled index creator.  If wait is set, it waits for the token to be
+// visible in metakv.
+//
 func (o *MetadataProvider) scheduleIndexCreation(idxDefn *c.IndexDefn,
-	plan map[string]interface{}) error {
+	plan map[string]interface{}, wait bool) error {
 
 	err := o.verifyDuplicateScheduleToken(idxDefn)
 	if err != nil {
@@ -812,11 +885,11 @@ func (o *MetadataProvider) scheduleIndexCreation(idxDefn *c.IndexDefn,
 		return fmt.Errorf("No candidate indexer node found for posting schedule create token.")
 	}
 
-	return o.makeScheduleCreateRequest(idxDefn, plan, indexer)
+	return o.makeScheduleCreateRequest(idxDefn, plan, indexer, wait)
 }
 
 func (o *MetadataProvider) makeScheduleCreateRequest(idxDefn *c.IndexDefn,
-	plan map[string]interface{}, indexer *watcher) error {
+	plan map[string]interface{}, indexer *watcher, wait bool) error {
 
 	addr := indexer.getHttpAddr()
 	url := addr + "/postScheduleCreateRequest"
@@ -833,7 +906,7 @@ func (o *MetadataProvider) makeScheduleCreateRequest(idxDefn *c.IndexDefn,
 	}
 
 	bytesBuf := bytes.NewBuffer(buf)
-	params := &security.RequestParams{Timeout: time.Duration(10) * time.Second}
+	params := &security.RequestParams{Timeout: time.Duration(10) * time.Second, EnforceEncryption: true}
 
 	var resp *http.Response
 	resp, err = security.PostWithAuth(url, "application/json", bytesBuf, params)
@@ -864,6 +937,13 @@ func (o *MetadataProvider) makeScheduleCreateRequest(idxDefn *c.IndexDefn,
 		return fmt.Errorf("Error in posting schedule create request %v", msg)
 	}
 
+	if !wait {
+		logging.Infof("Indexer %v is posting schedule create token for index (%v, %v, %v, %v, %v)",
+			indexer.getIndexerId(), idxDefn.Bucket, idxDefn.Scope, idxDefn.Collection, idxDefn.Name,
+			idxDefn.DefnId)
+		return nil
+	}
+
 	err = o.waitForScheduleCreateToken(idxDefn.DefnId)
 	if err != nil {
 		return err
@@ -954,7 +1034,7 @@ func (o *MetadataProvider) recoverableCreateIndex(idxDefn *c.IndexDefn,
 		}
 
 		if sched {
-			scheduleErr := o.scheduleIndexCreation(idxDefn, plan)
+			scheduleErr := o.scheduleIndexCreation(idxDefn, plan, true)
 			if scheduleErr == nil {
 				message := "The index is scheduled for background creation. " + msg
 				if rebalRunning {
@@ -1399,6 +1479,15 @@ func (o *MetadataProvider) PrepareIndexDefn(
 	var docKeySize uint64 = 0
 	var arrSize uint64 = 0
 	var residentRatio float64 = 0
+	var memQuota uint64 = 0
+	var evictPriority int = 0
+	var vectorDimension int = 0
+	var vectorSimilarity string = ""
+	var buildWriterThreads int = 0
+	var buildBatchSize int = 0
+	var buildOSO *bool = nil
+	var compression string = ""
+	var bloomFilter bool = false
 
 	version := o.GetIndexerVersion()
 	clusterVersion := o.GetClusterVersion()
@@ -1528,6 +1617,38 @@ func (o *MetadataProvider) PrepareIndexDefn(
 		if err != nil {
 			return nil, err, retry
 		}
+
+		memQuota, err, retry = o.getMemQuotaParam(plan)
+		if err != nil {
+			return nil, err, retry
+		}
+
+		evictPriority, err, retry = o.getEvictPriorityParam(plan)
+		if err != nil {
+			return nil, err, retry
+		}
+
+		buildWriterThreads, buildBatchSize, buildOSO, err, retry = o.getBuildParams(plan)
+		if err != nil {
+			return nil, err, retry
+		}
+
+		compression, err, retry = o.getCompressionParam(plan)
+		if err != nil {
+			return nil, err, retry
+		}
+
+		bloomFilter, err, retry = o.getBloomFilterParam(plan)
+		if err != nil {
+			return nil, err, retry
+		}
+
+		if strings.ToLower(using) == c.VectorIndex {
+			vectorDimension, vectorSimilarity, err, retry = o.getVectorParams(plan)
+			if err != nil {
+				return nil, err, retry
+			}
+		}
 	}
 
 	logging.Debugf("MetadataProvider:CreateIndex(): deferred_build %v nodes %v", deferred, nodes)
@@ -1566,6 +1687,42 @@ func (o *MetadataProvider) PrepareIndexDefn(
 		return nil, errors.New("Fail to create index.  Collation order is required for all expressions in the index."), false
 	}
 
+	//
+	// Vector index
+	//
+
+	if strings.ToLower(using) == c.VectorIndex {
+		if isPrimary || isArrayIndex {
+			return nil, errors.New("Fails to create index.  Vector index cannot be a primary or array index."), false
+		}
+
+		if c.IsPartitioned(partitionScheme) {
+			return nil, errors.New("Fails to create index.  Vector index cannot be partitioned."), false
+		}
+
+		if len(desc) != 0 && desc[0] {
+			return nil, errors.New("Fails to create index.  Vector key of a vector index cannot be descending."), false
+		}
+
+		if vectorDimension <= 0 {
+			return nil, errors.New("Fails to create index.  Parameter dimension is required for a vector index."), false
+		}
+	}
+
+	//
+	// Hash index
+	//
+
+	if strings.ToLower(using) == c.HashIndex {
+		if isArrayIndex {
+			return nil, errors.New("Fails to create index.  Hash index cannot be an array index."), false
+		}
+
+		if o.isDecending(desc) {
+			return nil, errors.New("Fails to create index.  Hash index cannot have descending keys."), false
+		}
+	}
+
 	//
 	// Create Index Definition
 	//
@@ -1602,6 +1759,15 @@ func (o *MetadataProvider) PrepareIndexDefn(
 		DocKeySize:         docKeySize,
 		ArrSize:            arrSize,
 		ResidentRatio:      residentRatio,
+		MemQuota:           memQuota,
+		EvictPriority:      evictPriority,
+		VectorDimension:    vectorDimension,
+		VectorSimilarity:   vectorSimilarity,
+		BuildWriterThreads: buildWriterThreads,
+		BuildBatchSize:     buildBatchSize,
+		BuildOSO:           buildOSO,
+		Compression:        compression,
+		BloomFilter:        bloomFilter,
 		Scope:              scope,
 		Collection:         collection,
 	}
@@ -2415,6 +2581,201 @@ func (o *MetadataProvider) getResidentRatioParam(plan map[string]interface{}) (f
 	return residentRatio, nil, false
 }
 
+func (o *MetadataProvider) getMemQuotaParam(plan map[string]interface{}) (uint64, error, bool) {
+
+	memQuota := int64(0)
+
+	memQuota2, ok := plan["mem_quota"].(float64)
+	if !ok {
+		memQuota_str, ok := plan["mem_quota"].(string)
+		if ok {
+			var err error
+			memQuota, err = strconv.ParseInt(memQuota_str, 10, 64)
+			if err != nil {
+				return 0, errors.New("Fails to create index.  Parameter mem_quota must be a integer value."), false
+			}
+
+		} else if _, ok := plan["mem_quota"]; ok {
+			return 0, errors.New("Fails to create index.  Parameter mem_quota must be a integer value."), false
+		}
+	} else {
+		memQuota = int64(memQuota2)
+	}
+
+	if memQuota < 0 {
+		return 0, errors.New("Fails to create index.  Parameter mem_quota must be a positive value."), false
+	}
+
+	return uint64(memQuota), nil, false
+}
+
+func (o *MetadataProvider) getVectorParams(plan map[string]interface{}) (int, string, error, bool) {
+
+	dimension := int64(0)
+
+	dimension2, ok := plan["dimension"].(float64)
+	if !ok {
+		dimension_str, ok := plan["dimension"].(string)
+		if ok {
+			var err error
+			dimension, err = strconv.ParseInt(dimension_str, 10, 64)
+			if err != nil {
+				return 0, "", errors.New("Fails to create index.  Parameter dimension must be a integer value."), false
+			}
+
+		} else if _, ok := plan["dimension"]; ok {
+			return 0, "", errors.New("Fails to create index.  Parameter dimension must be a integer value."), false
+		}
+	} else {
+		dimension = int64(dimension2)
+	}
+
+	if dimension < 0 {
+		return 0, "", errors.New("Fails to create index.  Parameter dimension must be a positive value."), false
+	}
+
+	similarity := c.VectorL2
+	if _, ok := plan["similarity"]; ok {
+		similarity_str, ok := plan["similarity"].(string)
+		if !ok || !c.IsValidVectorSimilarity(strings.ToLower(similarity_str)) {
+			return 0, "", errors.New("Fails to create index.  Parameter similarity must be one of l2, cosine or dot."), false
+		}
+		similarity = strings.ToLower(similarity_str)
+	}
+
+	return int(dimension), similarity, nil, false
+}
+
+func (o *MetadataProvider) getEvictPriorityParam(plan map[string]interface{}) (int, error, bool) {
+
+	evictPriority := int64(0)
+
+	evictPriority2, ok := plan["evict_priority"].(float64)
+	if !ok {
+		evictPriority_str, ok := plan["evict_priority"].(string)
+		if ok {
+			var err error
+			evictPriority, err = strconv.ParseInt(evictPriority_str, 10, 64)
+			if err != nil {
+				return 0, errors.New("Fails to create index.  Parameter evict_priority must be a integer value."), false
+			}
+
+		} else if _, ok := plan["evict_priority"]; ok {
+			return 0, errors.New("Fails to create index.  Parameter evict_priority must be a integer value."), false
+		}
+	} else {
+		evictPriority = int64(evictPriority2)
+	}
+
+	if evictPriority < 0 {
+		return 0, errors.New("Fails to create index.  Parameter evict_priority must be a positive value."), false
+	}
+
+	return int(evictPriority), nil, false
+}
+
+//
+// getBuildParams returns build_writer_threads, build_batch_size and
+// build_oso, which tune the initial build of the index.
+//
+func (o *MetadataProvider) getBuildParams(plan map[string]interface{}) (int, int, *bool, error, bool) {
+
+	getInt := func(param string) (int, error) {
+		value := int64(0)
+
+		value2, ok := plan[param].(float64)
+		if !ok {
+			value_str, ok := plan[param].(string)
+			if ok {
+				var err error
+				value, err = strconv.ParseInt(value_str, 10, 64)
+				if err != nil {
+					return 0, fmt.Errorf("Fails to create index.  Parameter %v must be a integer value.", param)
+				}
+
+			} else if _, ok := plan[param]; ok {
+				return 0, fmt.Errorf("Fails to create index.  Parameter %v must be a integer value.", param)
+			}
+		} else {
+			value = int64(value2)
+		}
+
+		if value < 0 {
+			return 0, fmt.Errorf("Fails to create index.  Parameter %v must be a positive value.", param)
+		}
+
+		return int(value), nil
+	}
+
+	writerThreads, err := getInt("build_writer_threads")
+	if err != nil {
+		return 0, 0, nil, err, false
+	}
+
+	batchSize, err := getInt("build_batch_size")
+	if err != nil {
+		return 0, 0, nil, err, false
+	}
+
+	var oso *bool
+	if value, ok := plan["build_oso"]; ok {
+		oso2, ok := value.(bool)
+		if !ok {
+			oso_str, ok := value.(string)
+			if !ok {
+				return 0, 0, nil, errors.New("Fails to create index.  Parameter build_oso must be a boolean value of (true or false)."), false
+			}
+
+			var err error
+			oso2, err = strconv.ParseBool(oso_str)
+			if err != nil {
+				return 0, 0, nil, errors.New("Fails to create index.  Parameter build_oso must be a boolean value of (true or false)."), false
+			}
+		}
+		oso = &oso2
+	}
+
+	return writerThreads, batchSize, oso, nil, false
+}
+
+func (o *MetadataProvider) getCompressionParam(plan map[string]interface{}) (string, error, bool) {
+
+	if _, ok := plan["compression"]; !ok {
+		return "", nil, false
+	}
+
+	compression, ok := plan["compression"].(string)
+	if !ok || !c.IsValidCompression(strings.ToLower(compression)) {
+		return "", errors.New("Fails to create index.  Parameter compression must be one of snappy, zstd or none."), false
+	}
+
+	return strings.ToLower(compression), nil, false
+}
+
+func (o *MetadataProvider) getBloomFilterParam(plan map[string]interface{}) (bool, error, bool) {
+
+	value, ok := plan["bloom_filter"]
+	if !ok {
+		return false, nil, false
+	}
+
+	bloomFilter, ok := value.(bool)
+	if !ok {
+		bloomFilter_str, ok := value.(string)
+		if !ok {
+			return false, errors.New("Fails to create index.  Parameter bloom_filter must be a boolean value of (true or false)."), false
+		}
+
+		var err error
+		bloomFilter, err = strconv.ParseBool(bloomFilter_str)
+		if err != nil {
+			return false, errors.New("Fails to create index.  Parameter bloom_filter must be a boolean value of (true or false)."), false
+		}
+	}
+
+	return bloomFilter, nil, false
+}
+
 func (o *MetadataProvider) findWatchersWithRetry(nodes []string, numReplica int, partitioned bool, legacy bool) ([]*watcher, error, bool) {
 
 	var watchers []*watcher
@@ -2599,29 +2960,70 @@ func (o *MetadataProvider) DropIndex(defnID c.IndexDefnId) error {
 
 func (o *MetadataProvider) BuildIndexes(defnIDs []c.IndexDefnId) error {
 
+	results, err := o.BuildIndexesWithResults(defnIDs)
+	if err != nil {
+		return err
+	}
+
+	errMap := make(map[string]bool)
+	for _, result := range results {
+		if result.Status == BuildIndexFailed {
+			errMap[result.Err.Error()] = true
+		}
+	}
+
+	if len(errMap) != 0 {
+		errStr := ""
+		for msg, _ := range errMap {
+			errStr += msg + "\n"
+		}
+		return errors.New(errStr)
+	}
+
+	return nil
+}
+
+//
+// BuildIndexesWithResults builds a deferred set of indexes like BuildIndexes,
+// but returns the outcome of the request for each index instead of failing
+// as a unit.  An error is returned only if the request could not be made.
+//
+func (o *MetadataProvider) BuildIndexesWithResults(defnIDs []c.IndexDefnId) (map[c.IndexDefnId]*BuildIndexResult, error) {
+
 	watcherIndexMap := make(map[c.IndexerId][]c.IndexDefnId)
 	watcherNodeMap := make(map[c.IndexerId]string)
 	defnList := ([]c.IndexDefnId)(nil)
+	results := make(map[c.IndexDefnId]*BuildIndexResult)
+
+	setStatus := func(id c.IndexDefnId, status BuildIndexStatus, err error) {
+		results[id] = &BuildIndexResult{DefnId: id, Status: status, Err: err}
+	}
 
 	for _, id := range defnIDs {
 
 		// Has the index been deleted?
 		found, err := mc.DeleteCommandTokenExist(id)
 		if err != nil {
-			return errors.New(fmt.Sprintf("Fail to Build Index due to internal errors.  Error=%v.", err))
+			return nil, errors.New(fmt.Sprintf("Fail to Build Index due to internal errors.  Error=%v.", err))
 		}
 		if found {
 			logging.Warnf("Index %v have been deleted. Skip build index.", id)
+			setStatus(id, BuildIndexNotFound, nil)
 			continue
 		}
 
 		// Has the index been built?
 		found, err = mc.BuildCommandTokenExist(id)
 		if err != nil {
-			return errors.New(fmt.Sprintf("Fail to Build Index due to internal errors.  Error=%v.", err))
+			return nil, errors.New(fmt.Sprintf("Fail to Build Index due to internal errors.  Error=%v.", err))
 		}
 		if found {
 			logging.Warnf("Index %v has already built. Skip build index.", id)
+			if meta := o.findIndex(id); meta != nil && meta.State != c.INDEX_STATE_ACTIVE {
+				setStatus(id, BuildIndexInProgress, nil)
+			} else {
+				setStatus(id, BuildIndexAlreadyBuilt, nil)
+			}
 			continue
 		}
 
@@ -2637,10 +3039,13 @@ func (o *MetadataProvider) BuildIndexes(defnIDs []c.IndexDefnId) error {
 				if state != c.INDEX_STATE_READY && state != c.INDEX_STATE_CREATED {
 					if state == c.INDEX_STATE_INITIAL || state == c.INDEX_STATE_CATCHUP {
 						logging.Warnf("Index %v is being built .", meta.Definition.Name)
+						setStatus(id, BuildIndexInProgress, nil)
 					} else if state == c.INDEX_STATE_ACTIVE {
 						logging.Warnf("Index %v has already built .", meta.Definition.Name)
+						setStatus(id, BuildIndexAlreadyBuilt, nil)
 					} else {
 						logging.Warnf("Index %v have been deleted.", meta.Definition.Name)
+						setStatus(id, BuildIndexNotFound, nil)
 					}
 					return false
 				}
@@ -2658,11 +3063,12 @@ func (o *MetadataProvider) BuildIndexes(defnIDs []c.IndexDefnId) error {
 		// asynchronously (some parallel go-routine unwatchMetadata).
 		watchers, err := o.findWatchersByDefnIdIgnoreStatus(id)
 		if err != nil {
-			return errors.New(fmt.Sprintf("Fail to Build Index due to internal errors.  Error=%v.", err))
+			return nil, errors.New(fmt.Sprintf("Fail to Build Index due to internal errors.  Error=%v.", err))
 		}
 
 		// There is at least one watcher (one indexer node)
 		defnList = append(defnList, id)
+		setStatus(id, BuildIndexStarted, nil)
 
 		for _, watcher := range watchers {
 			indexerId := watcher.getIndexerId()
@@ -2684,27 +3090,22 @@ func (o *MetadataProvider) BuildIndexes(defnIDs []c.IndexDefnId) error {
 	// place token for recovery.
 	for _, id := range defnList {
 		if err := mc.PostBuildCommandToken(id); err != nil {
-			return errors.New(fmt.Sprintf("Fail to Build Index due to internal errors.  Error=%v.", err))
+			return nil, errors.New(fmt.Sprintf("Fail to Build Index due to internal errors.  Error=%v.", err))
 		}
 	}
 
 	// send request
-	errMap := make(map[string]bool)
 	for indexerId, idList := range watcherIndexMap {
 		if err := o.SendBuildIndexRequest(indexerId, idList, watcherNodeMap[indexerId]); err != nil {
-			errMap[err.Error()] = true
-		}
-	}
-
-	if len(errMap) != 0 {
-		errStr := ""
-		for msg, _ := range errMap {
-			errStr += msg + "\n"
+			for _, id := range idList {
+				if results[id].Status != BuildIndexFailed {
+					setStatus(id, BuildIndexFailed, err)
+				}
+			}
 		}
-		return errors.New(errStr)
 	}
 
-	return nil
+	return results, nil
 }
 
 func (o *MetadataProvider) SendBuildIndexRequest(indexerId c.IndexerId, idList []c.IndexDefnId, addr string) error {
@@ -2923,6 +3324,26 @@ func (o *MetadataProvider) getNodesInHealthyCluster() ([]string, error) {
 	return nodes, nil
 }
 
+//
+// Get the list of nodes from a cluster where all the active nodes are healthy.  Unlike
+// getNodesInHealthyCluster, failed over nodes are allowed, and they are not in the list.
+//
+func (o *MetadataProvider) getNodesInActiveCluster() ([]string, error) {
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if _, err := o.checkClusterHealth(); err != nil {
+		return nil, err
+	}
+
+	if atomic.LoadInt32(&o.numUnhealthyNode) != 0 || !o.AllWatchersAliveNoLock() {
+		return nil, errors.New("Cluster has unhealthy nodes, undergo network partition, or unable to determine indexer node status.")
+	}
+
+	return o.getAllWatcherNodeAddrNoLock(), nil
+}
+
 //
 // The caller must acquire locks on indexer before calling this method. This ensures that there is
 // no concurrent create/alter index running in parallel.
@@ -2966,6 +3387,11 @@ func (o *MetadataProvider) getNumReplica(defnId c.IndexDefnId, name, bucket, sco
 // AlterReplicaCount, all the nodes - including the new nodes and the nodes
 // hosting the exising replicas - should be specified in the input plan.
 // Move index replica also has the same expectation.
+//
+// Action drop_replica drops the given replica and lowers the replica count.
+// Action drop_replica_instance drops the given replica but keeps the replica
+// count, e.g. to shed load from a node.  The dropped replica is a lost replica,
+// which can be rebuilt by replica repair or rebalance.
 func (o *MetadataProvider) AlterReplicaCount(action string, defnId c.IndexDefnId, plan map[string]interface{}) error {
 
 	// Support for 6.5 and onwards
@@ -3002,7 +3428,7 @@ func (o *MetadataProvider) AlterReplicaCount(action string, defnId c.IndexDefnId
 		}
 	}
 
-	if action == "drop_replica" {
+	if action == "drop_replica" || action == "drop_replica_instance" {
 		var err error
 		dropReplicaId, err, _ = o.getReplicaIdParam(plan, clusterVersion)
 		if err != nil {
@@ -3060,7 +3486,22 @@ func (o *MetadataProvider) AlterReplicaCount(action string, defnId c.IndexDefnId
 
 	// drop replica
 	if dropReplicaId != -1 {
-		if err := o.removeReplica(&defn, watcherMap, *numReplica, 1, numPartition, dropReplicaId, (map[string]interface{})(nil)); err != nil {
+		decrement := 1
+		if action == "drop_replica_instance" {
+			// The replica count does not change.  Make sure the index keeps another replica.
+			if idxMeta = o.findIndex(defnId); idxMeta == nil {
+				o.cancelPrepareIndexRequest(defn.DefnId, watcherMap)
+				return fmt.Errorf("Index %s does not exist.", defnId)
+			}
+
+			if int(curCount)+1-numLostReplicas(idxMeta, int(curCount)) <= 1 {
+				o.cancelPrepareIndexRequest(defn.DefnId, watcherMap)
+				return fmt.Errorf("Fail to alter index: Cannot drop the only replica of index %v.", defn.Name)
+			}
+			decrement = 0
+		}
+
+		if err := o.removeReplica(&defn, watcherMap, *numReplica, decrement, numPartition, dropReplicaId, (map[string]interface{})(nil)); err != nil {
 			return fmt.Errorf("Fail to alter index: %v", err)
 		}
 		return nil
@@ -3088,6 +3529,126 @@ func (o *MetadataProvider) AlterReplicaCount(action string, defnId c.IndexDefnId
 	return nil
 }
 
+//
+// Find the indexes which have lost some of their replicas, e.g. after an
+// indexer node is failed over.  It returns the number of lost replicas for
+// each index, based on the replica count of the index and the replicas
+// hosted by the indexers.  Partitioned indexes are not considered, since
+// a partition lost by a replica is repaired by rebalance.
+//
+func (o *MetadataProvider) FindLostReplicas() map[c.IndexDefnId]int {
+
+	result := make(map[c.IndexDefnId]int)
+
+	indices, _ := o.ListIndex()
+	for _, meta := range indices {
+		if c.IsPartitioned(meta.Definition.PartitionScheme) {
+			continue
+		}
+
+		if lost := numLostReplicas(meta, meta.Definition.GetNumReplica()); lost > 0 {
+			result[meta.Definition.DefnId] = lost
+		}
+	}
+
+	return result
+}
+
+func numLostReplicas(meta *IndexMetadata, numReplica int) int {
+
+	replicas := make(map[uint64]bool)
+	for _, inst := range meta.Instances {
+		if inst.State != c.INDEX_STATE_NIL && inst.State != c.INDEX_STATE_DELETED {
+			replicas[inst.ReplicaId] = true
+		}
+	}
+
+	return numReplica + 1 - len(replicas)
+}
+
+//
+// Rebuild the replicas lost by an index, so that the index has as many
+// replicas as its replica count.   The planner places the new replicas on
+// the active indexer nodes, honoring server groups.   Unlike alter index,
+// failed over nodes are allowed in the cluster, since the replicas they
+// hosted are the ones to rebuild.   It returns the number of replicas
+// being rebuilt.
+//
+func (o *MetadataProvider) RepairLostReplicas(defnId c.IndexDefnId) (int, error) {
+
+	clusterVersion := o.GetClusterVersion()
+	if clusterVersion < c.INDEXER_65_VERSION {
+		return 0, errors.New("Replica repair requires version 6.5 or higher")
+	}
+
+	nodeList, err := o.getNodesInActiveCluster()
+	if err != nil {
+		return 0, fmt.Errorf("Fail to repair replica: %v", err)
+	}
+
+	idxMeta := o.findIndex(defnId)
+	if idxMeta == nil {
+		return 0, fmt.Errorf("Index %s does not exist.", defnId)
+	}
+
+	if c.IsPartitioned(idxMeta.Definition.PartitionScheme) {
+		return 0, fmt.Errorf("Replica repair is not supported for partitioned index")
+	}
+
+	//
+	// Prepare phase.  Acquire locks from all the indexers, so that there is no concurrent
+	// create/alter index request (see AlterReplicaCount).
+	//
+	defn := *idxMeta.Definition
+	watcherMap, err, _, _ := o.makePrepareIndexRequest(defn.DefnId, defn.Name, defn.Bucket,
+		defn.Scope, defn.Collection, nil, defn.PartitionScheme, -1, false, 0)
+
+	if err != nil {
+		o.cancelPrepareIndexRequest(defn.DefnId, watcherMap)
+		return 0, fmt.Errorf("Fail to repair replica: %v", err)
+	}
+
+	valid, err := o.verifyNodeList(nodeList, watcherMap)
+	if err != nil {
+		o.cancelPrepareIndexRequest(defn.DefnId, watcherMap)
+		return 0, fmt.Errorf("Fail to repair replica: %v", err)
+	}
+	if !valid {
+		o.cancelPrepareIndexRequest(defn.DefnId, watcherMap)
+		return 0, fmt.Errorf("Cluster has unhealthy nodes, undergo network partition, or unable to determine indexer node status.")
+	}
+
+	numReplica, err := o.getNumReplica(defn.DefnId, defn.Name, defn.Bucket, defn.Scope, defn.Collection, watcherMap)
+	if err != nil {
+		o.cancelPrepareIndexRequest(defn.DefnId, watcherMap)
+		return 0, fmt.Errorf("Fail to repair replica: %v", err)
+	}
+	curCount, _ := numReplica.Value()
+
+	// Count the replicas again while holding the locks, since the replicas may be
+	// repaired by another request.
+	idxMeta = o.findIndex(defnId)
+	if idxMeta == nil {
+		o.cancelPrepareIndexRequest(defn.DefnId, watcherMap)
+		return 0, fmt.Errorf("Index %s does not exist.", defnId)
+	}
+
+	lost := numLostReplicas(idxMeta, int(curCount))
+	if lost <= 0 {
+		o.cancelPrepareIndexRequest(defn.DefnId, watcherMap)
+		return 0, nil
+	}
+
+	logging.Infof("repair replica.  Index %v num replica %v lost replica %v", defn.DefnId, curCount, lost)
+
+	// The replica count does not change.  The planner adds the replicas missing from the replica count.
+	if err := o.addReplica(&defn, watcherMap, *numReplica, 0, (map[string]interface{})(nil)); err != nil {
+		return 0, fmt.Errorf("Fail to repair replica: %v", err)
+	}
+
+	return lost, nil
+}
+
 //
 // This function adds replica count of an index.
 //
@@ -3211,6 +3772,8 @@ func (o *MetadataProvider) Close() {
 	defer o.mutex.Unlock()
 	logging.Infof("MetadataProvider is terminated. Cleaning up ...")
 
+	o.ddlJobs.close()
+
 	for _, watcher := range o.watchers {
 		watcher.close()
 	}
@@ -4505,7 +5068,10 @@ func (r *metadataRepo) updateTopology(topology *mc.IndexTopology, indexerId c.In
 
 func (r *metadataRepo) incrementVersion() {
 
-	atomic.AddUint64(&r.version, 1)
+	version := atomic.AddUint64(&r.version, 1)
+	if r.provider != nil {
+		r.provider.notifyMetadataChange(version)
+	}
 }
 
 func (r *metadataRepo) getVersion() uint64 {
@@ -4817,7 +5383,7 @@ func (r *metadataRepo) resolveIndexStats2(indexerId c.IndexerId, stats map[strin
 			if dedupedIndexStats, ok := stats[meta.Definition.Bucket]; !ok {
 				return result
 			} else {
-				if _, exists := dedupedIndexStats.Indexes[prefix]; exists {
+				if perIndexStats, exists := dedupedIndexStats.Indexes[prefix]; exists {
 					for partitionId, indexerId2 := range inst.IndexerId {
 						if indexerId == indexerId2 {
 							if _, ok := result[inst.InstId]; !ok {
@@ -4830,6 +5396,10 @@ func (r *metadataRepo) resolveIndexStats2(indexerId c.IndexerId, stats map[strin
 							result[inst.InstId][partitionId].Set("num_docs_queued", interface{}(dedupedIndexStats.NumDocsQueued))
 							result[inst.InstId][partitionId].Set("last_rollback_time", interface{}(dedupedIndexStats.LastRollbackTime))
 							result[inst.InstId][partitionId].Set("progress_stat_time", interface{}(dedupedIndexStats.ProgressStatTime))
+							if perIndexStats != nil {
+								result[inst.InstId][partitionId].Set("num_scans_pending", interface{}(perIndexStats.NumScansPending))
+								result[inst.InstId][partitionId].Set("avg_scan_latency", interface{}(perIndexStats.AvgScanLatency))
+							}
 						}
 					}
 				}
@@ -5192,9 +5762,15 @@ func (w *watcher) updateIndexStats2NoLock(indexerId c.IndexerId, indexStats2 *In
 	}
 
 	if useCached {
-		// Update the Indexes list from cached version
+		// Update the Indexes list from cached version.  Indexer sends
+		// the Indexes list of a bucket if the per index stats have changed.
 		for bucket, dedupedIndexStats := range indexStats2.Stats {
-			dedupedIndexStats.Indexes = clientStats.Stats[bucket].Indexes
+			if len(dedupedIndexStats.Indexes) != 0 {
+				continue
+			}
+			if cached, ok := clientStats.Stats[bucket]; ok {
+				dedupedIndexStats.Indexes = cached.Indexes
+			}
 		}
 	}
 
@@ -5206,9 +5782,7 @@ func (w *watcher) updateIndexStats2NoLock(indexerId c.IndexerId, indexStats2 *In
 		}
 	}
 
-	if useCached == false {
-		w.clientStats.Set(indexStats2.Clone())
-	}
+	w.clientStats.Set(indexStats2.Clone())
 
 	return stats
 }
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"testing"
+
+	c "github.com/couchbase/indexing/secondary/common"
+)
+
+func TestGetCompressionParam(t *testing.T) {
+
+	o := &MetadataProvider{}
+
+	if compression, err, _ := o.getCompressionParam(map[string]interface{}{}); err != nil || compression != "" {
+		t.Fatalf("expected no compression, got %q %v", compression, err)
+	}
+
+	valid := map[string]string{
+		"snappy": c.CompressionSnappy,
+		"ZSTD":   c.CompressionZstd,
+		"None":   c.CompressionNone,
+	}
+	for param, expected := range valid {
+		compression, err, _ := o.getCompressionParam(map[string]interface{}{"compression": param})
+		if err != nil || compression != expected {
+			t.Fatalf("%v: expected %v, got %q %v", param, expected, compression, err)
+		}
+	}
+
+	for _, param := range []interface{}{"lz4", "", "zstd:3", 1, true} {
+		if _, err, _ := o.getCompressionParam(map[string]interface{}{"compression": param}); err == nil {
+			t.Fatalf("%v: expected error for invalid compression", param)
+		}
+	}
+}
@@ -114,6 +114,7 @@ type IndexerStorageModeToken struct {
 	NodeUUID         string
 	Override         string
 	LocalStorageMode string
+	IndexStorageMode map[string]string // index defnId -> index type
 }
 
 // TODO: Check if we can directly set UUIDs in the Defn itself.
@@ -867,6 +868,81 @@ func GetIndexerLocalStorageMode(nodeUUID string) (c.StorageMode, error) {
 	return c.NOT_SET, nil
 }
 
+//
+// Set the storage mode of a single index on the node.  The indexer migrates the
+// index to the storage mode in the background.  An empty indexType removes the
+// per-index storage mode.
+//
+func PostIndexStorageMode(nodeUUID string, defnId c.IndexDefnId, indexType string) error {
+
+	if len(nodeUUID) == 0 {
+		return errors.New("NodeUUId is not specified. Fail to set index storage mode.")
+	}
+
+	token, err := GetIndexerStorageModeToken(nodeUUID)
+	if err != nil {
+		logging.Errorf("Fail to read indexer storage mode to metakv for node %v.  Internal Error = %v", nodeUUID, err)
+		return err
+	}
+
+	if token == nil {
+		token = &IndexerStorageModeToken{
+			NodeUUID: nodeUUID,
+		}
+	}
+
+	key := strconv.FormatUint(uint64(defnId), 10)
+	if len(indexType) == 0 {
+		delete(token.IndexStorageMode, key)
+	} else {
+		if token.IndexStorageMode == nil {
+			token.IndexStorageMode = make(map[string]string)
+		}
+		token.IndexStorageMode[key] = indexType
+	}
+
+	if err := c.MetakvSet(IndexerStorageModeTokenPath+nodeUUID, token); err != nil {
+		logging.Errorf("Fail to post index storage mode to metakv for node %v.  Internal Error = %v", nodeUUID, err)
+		return err
+	}
+
+	return nil
+}
+
+//
+// Get the per-index storage mode of the node, keyed by index definition.
+//
+func GetIndexStorageModes(nodeUUID string) (map[c.IndexDefnId]c.StorageMode, error) {
+
+	if len(nodeUUID) == 0 {
+		return nil, errors.New("NodeUUId is not specified. Fail to get index storage mode.")
+	}
+
+	token, err := GetIndexerStorageModeToken(nodeUUID)
+	if err != nil {
+		logging.Errorf("Fail to read indexer storage mode to metakv for node %v.  Internal Error = %v", nodeUUID, err)
+		return nil, err
+	}
+
+	result := make(map[c.IndexDefnId]c.StorageMode)
+	if token == nil {
+		return result, nil
+	}
+
+	for key, indexType := range token.IndexStorageMode {
+		defnId, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			logging.Warnf("Invalid index definition %v in indexer storage mode token for node %v.  Skipped.", key, nodeUUID)
+			continue
+		}
+		if mode := c.IndexTypeToStorageMode(c.IndexType(indexType)); mode != c.NOT_SET {
+			result[c.IndexDefnId(defnId)] = mode
+		}
+	}
+
+	return result, nil
+}
+
 //
 //
 // Unmarshall
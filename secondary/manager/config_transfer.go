@@ -0,0 +1,392 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/cbauth/metakv"
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+const configDocumentVersion = 1
+
+var plannerSettingNames = []string{"excludeNode", "minimizeMovement"}
+
+//
+// ConfigDocument is the effective configuration of the index service, as
+// exported by /settings/export.  Settings and KeyspaceSettings are the
+// settings of the cluster.  Planner is the planner settings of the node
+// serving the request, and is imported to that node only.
+//
+type ConfigDocument struct {
+	Version          int                     `json:"version"`
+	Settings         map[string]interface{}  `json:"settings"`
+	KeyspaceSettings common.KeyspaceSettings `json:"keyspaceSettings"`
+	Planner          map[string]string       `json:"planner"`
+}
+
+//
+// ConfigDiff lists the settings which differ between an imported document
+// and the current configuration.
+//
+type ConfigDiff struct {
+	Settings         []string `json:"settings"`
+	KeyspaceSettings []string `json:"keyspaceSettings"`
+	Planner          []string `json:"planner"`
+	Skipped          []string `json:"skipped,omitempty"`
+	Applied          bool     `json:"applied"`
+}
+
+func (d *ConfigDiff) empty() bool {
+	return len(d.Settings) == 0 && len(d.KeyspaceSettings) == 0 && len(d.Planner) == 0
+}
+
+func (m *requestHandlerContext) handleConfigExportRequest(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := doAuth(r, w)
+	if !ok {
+		return
+	}
+
+	if !isAllowed(creds, []string{"cluster.settings!read"}, w) {
+		return
+	}
+
+	if r.Method != "GET" {
+		sendHttpError(w, "Unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	doc, _, err := m.getConfigDocument()
+	if err != nil {
+		logging.Errorf("RequestHandler::handleConfigExportRequest: Fail to get configuration.  Error = %v", err)
+		sendHttpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	send(http.StatusOK, w, doc)
+}
+
+//
+// handleConfigImportRequest applies an exported document to this cluster.
+// The planner settings are applied to the node serving the request only.
+// With ?dryRun=true, it only reports the settings which differ from the
+// document, to detect drift between clusters.
+//
+func (m *requestHandlerContext) handleConfigImportRequest(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := doAuth(r, w)
+	if !ok {
+		return
+	}
+
+	if r.Method != "POST" {
+		sendHttpError(w, "Unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dryRun := r.FormValue("dryRun") == "true"
+	permission := "cluster.settings!write"
+	if dryRun {
+		permission = "cluster.settings!read"
+	}
+
+	if !isAllowed(creds, []string{permission}, w) {
+		return
+	}
+
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		sendHttpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	doc := &ConfigDocument{}
+	if err := json.Unmarshal(buf, doc); err != nil {
+		sendHttpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateConfigDocument(doc); err != nil {
+		if serr, ok := err.(*common.SettingError); ok {
+			send(http.StatusBadRequest, w, serr)
+		} else {
+			sendHttpError(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	current, rev, err := m.getConfigDocument()
+	if err != nil {
+		sendHttpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	diff := diffConfigDocument(current, doc)
+
+	// validate the changes as the settings endpoint does
+	if err := validateConfigChange(current, doc, diff); err != nil {
+		if serr, ok := err.(*common.SettingError); ok {
+			send(http.StatusBadRequest, w, serr)
+		} else {
+			sendHttpError(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if dryRun || diff.empty() {
+		send(http.StatusOK, w, diff)
+		return
+	}
+
+	if err := m.applyConfigDocument(creds, current, doc, diff, rev); err != nil {
+		logging.Errorf("RequestHandler::handleConfigImportRequest: Fail to import configuration.  Error = %v", err)
+		sendHttpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logging.Infof("RequestHandler::handleConfigImportRequest: Imported settings %v, keyspace settings %v, planner settings %v",
+		diff.Settings, diff.KeyspaceSettings, diff.Planner)
+
+	// settings in metakv are recorded by each node when they are applied
+	common.RecordSettingsChanges(creds, plannerSettingsHistory(current, doc, diff))
+
+	diff.Applied = true
+	send(http.StatusOK, w, diff)
+}
+
+//
+// getConfigDocument returns the current configuration, and the metakv
+// revision of the global settings.
+//
+func (m *requestHandlerContext) getConfigDocument() (*ConfigDocument, interface{}, error) {
+
+	value, rev, err := metakv.Get(common.IndexingSettingsMetaPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := common.SystemConfig.FilterConfig(".settings.")
+	if len(value) != 0 {
+		if err := config.Update(value); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ks, _, err := m.mgr.GetKeyspaceSettings()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc := &ConfigDocument{
+		Version:          configDocumentVersion,
+		Settings:         make(map[string]interface{}),
+		KeyspaceSettings: ks,
+		Planner:          m.mgr.getPlannerSettings(),
+	}
+
+	for key, cv := range config {
+		doc.Settings[key] = cv.Value
+	}
+
+	return doc, rev, nil
+}
+
+func validateConfigDocument(doc *ConfigDocument) error {
+
+	if doc.Version > configDocumentVersion {
+		return fmt.Errorf("Unsupported configuration version %v", doc.Version)
+	}
+
+	for key, value := range doc.Settings {
+		if _, ok := common.SystemConfig[key]; !ok || !strings.Contains(key, ".settings.") {
+			return common.NewSettingError(key, value, "unknown setting", "")
+		}
+
+		if err := common.ValidateSetting(key, value); err != nil {
+			return err
+		}
+	}
+
+	if profile, ok := doc.Settings["indexer.settings.config_profile"].(string); ok {
+		if err := common.ValidateConfigProfile(strings.ToLower(profile)); err != nil {
+			return err
+		}
+	}
+
+	if doc.KeyspaceSettings != nil {
+		if err := doc.KeyspaceSettings.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for name, value := range doc.Planner {
+		switch name {
+		case "minimizeMovement":
+			if value != "true" && value != "false" {
+				return common.NewSettingError(name, value, "minimizeMovement must be true or false", "true, false")
+			}
+		case "excludeNode":
+			if value != "in" && value != "out" && value != "inout" && len(value) != 0 {
+				return common.NewSettingError(name, value, "value must be in, out or inout", "in, out, inout")
+			}
+		default:
+			return common.NewSettingError(name, value, "unknown planner setting", strings.Join(plannerSettingNames, ", "))
+		}
+	}
+
+	return nil
+}
+
+//
+// validateConfigChange validates the settings changed by doc against the
+// current settings.
+//
+func validateConfigChange(current, doc *ConfigDocument, diff *ConfigDiff) error {
+
+	if len(diff.Settings) == 0 {
+		return nil
+	}
+
+	config := common.SystemConfig.FilterConfig(".settings.")
+	config.Update(current.Settings)
+
+	values := make(map[string]interface{})
+	for _, key := range diff.Settings {
+		values[key] = doc.Settings[key]
+	}
+
+	return common.ValidateSettings(values, config)
+}
+
+//
+// diffConfigDocument compares doc with the current configuration.  The
+// storage mode is skipped if it is already set, as it cannot be changed.
+//
+func diffConfigDocument(current, doc *ConfigDocument) *ConfigDiff {
+
+	diff := &ConfigDiff{
+		Settings:         make([]string, 0),
+		KeyspaceSettings: make([]string, 0),
+		Planner:          make([]string, 0),
+	}
+
+	config := common.SystemConfig.FilterConfig(".settings.")
+	config.Update(current.Settings)
+	imported := config.Clone()
+	imported.Update(doc.Settings)
+
+	for key := range doc.Settings {
+		if reflect.DeepEqual(config[key].Value, imported[key].Value) {
+			continue
+		}
+
+		if key == "indexer.settings.storage_mode" && len(config[key].String()) != 0 {
+			diff.Skipped = append(diff.Skipped, key)
+			continue
+		}
+
+		diff.Settings = append(diff.Settings, key)
+	}
+
+	if doc.KeyspaceSettings != nil {
+		for keyspace, settings := range doc.KeyspaceSettings {
+			if !reflect.DeepEqual(current.KeyspaceSettings[keyspace], settings) {
+				diff.KeyspaceSettings = append(diff.KeyspaceSettings, keyspace)
+			}
+		}
+		for keyspace := range current.KeyspaceSettings {
+			if _, ok := doc.KeyspaceSettings[keyspace]; !ok {
+				diff.KeyspaceSettings = append(diff.KeyspaceSettings, keyspace)
+			}
+		}
+	}
+
+	for name, value := range doc.Planner {
+		if current.Planner[name] != value {
+			diff.Planner = append(diff.Planner, name)
+		}
+	}
+
+	sort.Strings(diff.Settings)
+	sort.Strings(diff.KeyspaceSettings)
+	sort.Strings(diff.Planner)
+	sort.Strings(diff.Skipped)
+	return diff
+}
+
+//
+// plannerSettingsHistory returns the changes of planner settings of an
+// import for the settings history of this node.
+//
+func plannerSettingsHistory(current, doc *ConfigDocument, diff *ConfigDiff) []common.SettingsChange {
+
+	var changes []common.SettingsChange
+	for _, name := range diff.Planner {
+		changes = append(changes, common.SettingsChange{Key: name, Old: current.Planner[name], New: doc.Planner[name]})
+	}
+
+	return changes
+}
+
+//
+// applyConfigDocument applies the differences of doc.  The global settings
+// are set with the revision read for the diff, so that a concurrent change
+// is not overwritten.  Keyspace settings are replaced by the document.
+//
+func (m *requestHandlerContext) applyConfigDocument(creds cbauth.Creds, current, doc *ConfigDocument, diff *ConfigDiff, rev interface{}) error {
+
+	if len(diff.Settings) != 0 {
+		config := common.SystemConfig.FilterConfig(".settings.")
+		config.Update(current.Settings)
+
+		for _, key := range diff.Settings {
+			if err := config.SetValue(key, doc.Settings[key]); err != nil {
+				return err
+			}
+		}
+
+		value := config.Json()
+		common.SetSettingsAuthor(common.IndexingSettingsMetaPath, value, creds)
+		if err := metakv.Set(common.IndexingSettingsMetaPath, value, rev); err != nil {
+			return err
+		}
+	}
+
+	if len(diff.KeyspaceSettings) != 0 {
+		keyspaceSettingsLock.Lock()
+		defer keyspaceSettingsLock.Unlock()
+
+		_, ksRev, err := m.mgr.GetKeyspaceSettings()
+		if err != nil {
+			return err
+		}
+		if err := m.mgr.SetKeyspaceSettings(doc.KeyspaceSettings, ksRev, creds); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range diff.Planner {
+		if err := m.mgr.SetLocalValue(name, doc.Planner[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
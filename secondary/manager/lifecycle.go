@@ -24,6 +24,7 @@ import (
 	c "github.com/couchbase/gometa/common"
 	"github.com/couchbase/gometa/message"
 	"github.com/couchbase/gometa/protocol"
+	"github.com/couchbase/indexing/secondary/audit"
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/common/collections"
 	fdb "github.com/couchbase/indexing/secondary/fdb"
@@ -60,6 +61,7 @@ type LifecycleMgr struct {
 	collAwareCluster uint32 // 0: false, 1: true
 
 	clientStatsRefreshInterval uint64
+	numSliceWriters            int32 // numSliceWriters of the indexer
 
 	lastSendClientStats *client.IndexStats2
 	clientStatsMutex    sync.Mutex
@@ -123,6 +125,9 @@ type builder struct {
 	batchSize int32
 	disable   int32
 
+	// max number of collections with initial build in progress
+	maxConcurrent int32
+
 	commandListener *mc.CommandListener
 	listenerDonech  chan bool
 }
@@ -169,6 +174,7 @@ func NewLifecycleMgr(notifier MetadataNotifier, clusterURL string) (*LifecycleMg
 		indexerReady:               false,
 		lastSendClientStats:        &client.IndexStats2{},
 		clientStatsRefreshInterval: 5000,
+		numSliceWriters:            int32(common.SystemConfig["indexer.numSliceWriters"].Int()),
 		acceptedNames:              make(map[string]*indexNameRequest),
 	}
 
@@ -381,6 +387,12 @@ func (m *LifecycleMgr) dispatchRequest(request *requestHolder, factory *message.
 		}
 	}()
 
+	// the index definition is gone once the index is dropped
+	var dropped *common.IndexDefn
+	if op == client.OPCODE_DROP_INDEX && fid != "internal" {
+		dropped = m.getAuditIndexDefn(key)
+	}
+
 	switch op {
 	case client.OPCODE_CREATE_INDEX:
 		err = m.handleCreateIndexScheduledBuild(key, content, common.NewUserRequestContext())
@@ -450,6 +462,8 @@ func (m *LifecycleMgr) dispatchRequest(request *requestHolder, factory *message.
 		return
 	}
 
+	m.auditRequest(op, key, content, result, dropped, err)
+
 	if err == nil {
 		msg := factory.CreateResponse(fid, reqId, "", result)
 		m.outgoings <- msg
@@ -460,6 +474,114 @@ func (m *LifecycleMgr) dispatchRequest(request *requestHolder, factory *message.
 
 }
 
+//
+// auditRequest logs an audit event for a DDL request from a client, i.e. a
+// request from N1QL through the metadata provider.  The requests made by the
+// indexer itself, such as by rebalance, are internal and not audited.  The
+// user is not known to the indexer, as the request is authorized by N1QL.
+//
+func (m *LifecycleMgr) auditRequest(op c.OpCode, key string, content []byte, result []byte,
+	dropped *common.IndexDefn, err error) {
+
+	logIndex := func(id uint32, defn *common.IndexDefn, params map[string]interface{}) {
+		audit.LogIndexRequest(id, nil, nil, defn.Bucket, defn.Scope, defn.Collection, defn.Name, params, err)
+	}
+
+	createParams := func(defn *common.IndexDefn) map[string]interface{} {
+		return map[string]interface{}{
+			"defnId":        defn.DefnId,
+			"secExprs":      defn.SecExprs,
+			"where":         defn.WhereExpr,
+			"isPrimary":     defn.IsPrimary,
+			"deferred":      defn.Deferred,
+			"numReplica":    defn.NumReplica,
+			"numPartitions": defn.NumPartitions,
+		}
+	}
+
+	switch op {
+
+	case client.OPCODE_CREATE_INDEX, client.OPCODE_CREATE_INDEX_DEFER_BUILD:
+		defn, err1 := common.UnmarshallIndexDefn(content)
+		if err1 != nil {
+			return
+		}
+		logIndex(audit.CREATE_INDEX, defn, createParams(defn))
+
+	case client.OPCODE_COMMIT_CREATE_INDEX:
+		commit, err1 := client.UnmarshallCommitCreateRequest(content)
+		if err1 != nil {
+			return
+		}
+
+		if err == nil {
+			if response, err1 := client.UnmarshallCommitCreateResponse(result); err1 == nil && !response.Accept {
+				err = errors.New("Commit is rejected")
+			}
+		}
+
+		nodes := make([]common.IndexerId, 0, len(commit.Definitions))
+		var defn *common.IndexDefn
+		for indexerId, definitions := range commit.Definitions {
+			nodes = append(nodes, indexerId)
+			if defn == nil && len(definitions) != 0 {
+				defn = &definitions[0]
+			}
+		}
+		if defn == nil {
+			return
+		}
+
+		switch commit.Op {
+		case client.NEW_INDEX:
+			params := createParams(defn)
+			params["indexers"] = nodes
+			logIndex(audit.CREATE_INDEX, defn, params)
+
+		case client.ADD_REPLICA, client.DROP_REPLICA:
+			params := map[string]interface{}{
+				"defnId":     defn.DefnId,
+				"action":     commit.Op,
+				"numReplica": defn.NumReplica,
+				"indexers":   nodes,
+			}
+			logIndex(audit.ALTER_INDEX, defn, params)
+		}
+
+	case client.OPCODE_DROP_INDEX:
+		if dropped != nil {
+			logIndex(audit.DROP_INDEX, dropped, map[string]interface{}{"defnId": dropped.DefnId})
+		}
+
+	case client.OPCODE_BUILD_INDEX:
+		list, err1 := client.UnmarshallIndexIdList(content)
+		if err1 != nil {
+			return
+		}
+
+		for _, id := range list.DefnIds {
+			if defn, err1 := m.repo.GetIndexDefnById(common.IndexDefnId(id)); err1 == nil && defn != nil {
+				logIndex(audit.BUILD_INDEX, defn, map[string]interface{}{"defnId": defn.DefnId})
+			}
+		}
+	}
+}
+
+// getAuditIndexDefn returns the definition of the index given by key, if it exists
+func (m *LifecycleMgr) getAuditIndexDefn(key string) *common.IndexDefn {
+
+	id, err := indexDefnId(key)
+	if err != nil {
+		return nil
+	}
+
+	defn, err := m.repo.GetIndexDefnById(id)
+	if err != nil {
+		return nil
+	}
+	return defn
+}
+
 //////////////////////////////////////////////////////////////
 // Lifecycle Mgr - handler functions
 //////////////////////////////////////////////////////////////
@@ -1260,8 +1382,13 @@ func (m *LifecycleMgr) CreateIndexOrInstance(defn *common.IndexDefn, scheduled b
 		}
 	}
 
+	// A storage migration, or the repair of a quarantined instance, adds a new
+	// instance along side the existing instance of the index, even for
+	// non-partitioned index.
+	isMigration := m.isInstanceReplacement(defn, reqCtx)
+
 	existDefn, err := m.verifyDuplicateDefn(defn, reqCtx)
-	if err != nil {
+	if err != nil && !(isMigration && existDefn != nil) {
 		return err
 	}
 
@@ -1272,7 +1399,7 @@ func (m *LifecycleMgr) CreateIndexOrInstance(defn *common.IndexDefn, scheduled b
 	hasIndex := existDefn != nil && (defn.DefnId == existDefn.DefnId)
 	isPartitioned := common.IsPartitioned(defn.PartitionScheme)
 
-	if isPartitioned && hasIndex {
+	if (isPartitioned || isMigration) && hasIndex {
 		return m.CreateIndexInstance(defn, scheduled, reqCtx, asyncCreate)
 	}
 
@@ -1298,6 +1425,11 @@ func (m *LifecycleMgr) CreateIndex(defn *common.IndexDefn, scheduled bool,
 		return err
 	}
 
+	if err := m.verifyBuildParams(defn); err != nil {
+		logging.Errorf("LifecycleMgr.CreateIndex() : createIndex fails. Reason = %v", err)
+		return err
+	}
+
 	if err := m.setImmutable(defn); err != nil {
 		return err
 	}
@@ -1523,7 +1655,8 @@ func (m *LifecycleMgr) setStorageMode(defn *common.IndexDefn) error {
 	}
 
 	if common.IsPartitioned(defn.PartitionScheme) {
-		if defn.Using != common.PlasmaDB && defn.Using != common.MemDB && defn.Using != common.MemoryOptimized {
+		if defn.Using != common.PlasmaDB && defn.Using != common.MemDB && defn.Using != common.MemoryOptimized &&
+			defn.Using != common.HashIndex {
 			err := fmt.Sprintf("Create Index fails. Reason = Cannot create partitioned index using %v", string(defn.Using))
 			logging.Errorf("LifecycleMgr.setStorageType: " + err)
 			return errors.New(err)
@@ -1533,6 +1666,48 @@ func (m *LifecycleMgr) setStorageMode(defn *common.IndexDefn) error {
 	return nil
 }
 
+//
+// verifyBuildParams checks the build tuning, compression and bloom filter
+// parameters of the WITH clause.  Writer threads cannot exceed the writers
+// of a slice (numSliceWriters of the indexer).  Compression and bloom
+// filters are only supported by plasma.  A bloom filter needs an ascending
+// leading key.
+//
+func (m *LifecycleMgr) verifyBuildParams(defn *common.IndexDefn) error {
+
+	maxWriters := int(atomic.LoadInt32(&m.numSliceWriters))
+	if defn.BuildWriterThreads < 0 || defn.BuildWriterThreads > maxWriters {
+		return fmt.Errorf("Create Index fails. Reason = build_writer_threads must be between 0 and %v", maxWriters)
+	}
+
+	if defn.BuildBatchSize < 0 {
+		return fmt.Errorf("Create Index fails. Reason = build_batch_size must be a positive value")
+	}
+
+	if len(defn.Compression) != 0 {
+		if !common.IsValidCompression(defn.Compression) {
+			return fmt.Errorf("Create Index fails. Reason = Invalid compression %v", defn.Compression)
+		}
+		if defn.Using != common.PlasmaDB {
+			return fmt.Errorf("Create Index fails. Reason = compression is not supported using %v", defn.Using)
+		}
+	}
+
+	if defn.BloomFilter {
+		if defn.Using != common.PlasmaDB {
+			return fmt.Errorf("Create Index fails. Reason = bloom_filter is not supported using %v", defn.Using)
+		}
+		if defn.IsPrimary {
+			return fmt.Errorf("Create Index fails. Reason = bloom_filter is not supported for primary index")
+		}
+		if len(defn.Desc) != 0 && defn.Desc[0] {
+			return fmt.Errorf("Create Index fails. Reason = bloom_filter is not supported for descending leading key")
+		}
+	}
+
+	return nil
+}
+
 func (m *LifecycleMgr) setImmutable(defn *common.IndexDefn) error {
 
 	// If it is a partitioned index, immutable is set to true by default.
@@ -1608,6 +1783,45 @@ func (m *LifecycleMgr) setPartition(defn *common.IndexDefn) ([]common.PartitionI
 	return partitions, versions, numPartitions
 }
 
+//
+// isInstanceReplacement returns true if defn is a new instance of an existing index on this node,
+// created to migrate the index to a different storage mode, or to replace an instance in error.
+//
+func (m *LifecycleMgr) isInstanceReplacement(defn *common.IndexDefn, reqCtx *common.MetadataRequestContext) bool {
+
+	if reqCtx == nil || reqCtx.ReqSource != common.DDLRequestSourceRebalance || defn.RealInstId != 0 {
+		return false
+	}
+
+	mode := common.IndexTypeToStorageMode(defn.Using)
+	if mode == common.NOT_SET {
+		return false
+	}
+
+	topology, err := m.repo.GetTopologyByCollection(defn.Bucket, defn.Scope, defn.Collection)
+	if err != nil || topology == nil {
+		return false
+	}
+
+	for _, inst := range topology.GetIndexInstancesByDefn(defn.DefnId) {
+		if common.IndexInstId(inst.InstId) == defn.InstId ||
+			common.IndexState(inst.State) == common.INDEX_STATE_DELETED {
+			continue
+		}
+
+		if common.IndexState(inst.State) == common.INDEX_STATE_ERROR {
+			return true
+		}
+
+		instMode := common.IndexTypeToStorageMode(common.IndexType(inst.StorageMode))
+		if instMode != common.NOT_SET && instMode != mode {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (m *LifecycleMgr) verifyDuplicateInstance(defn *common.IndexDefn, reqCtx *common.MetadataRequestContext) error {
 
 	existDefn, err := m.repo.GetIndexDefnByName(defn.Bucket, defn.Scope, defn.Collection, defn.Name)
@@ -1885,6 +2099,10 @@ func (m *LifecycleMgr) BuildIndexes(ids []common.IndexDefnId,
 		}
 	}
 
+	if reqCtx != nil && reqCtx.ReqSource == common.DDLRequestSourceUser {
+		instIdList = m.queueBuildsOverLimit(instIdList, inst2DefnMap)
+	}
+
 	if m.notifier != nil && len(instIdList) != 0 {
 
 		if errMap := m.notifier.OnIndexBuild(instIdList, buckets, reqCtx); len(errMap) != 0 {
@@ -1947,6 +2165,82 @@ func (m *LifecycleMgr) BuildIndexes(ids []common.IndexDefnId,
 	return retryErrList, skipList, errList
 }
 
+//
+// queueBuildsOverLimit hands over the index instances of collections that cannot
+// start building, without exceeding the max number of concurrent builds, to the
+// builder.   Those index instances stay in the scheduled state, until the builder
+// starts building them.  It returns the index instances to build now.
+//
+func (m *LifecycleMgr) queueBuildsOverLimit(instIdList []common.IndexInstId,
+	inst2DefnMap map[common.IndexInstId]common.IndexDefnId) []common.IndexInstId {
+
+	maxConcurrent := m.builder.getMaxConcurrent()
+	if maxConcurrent <= 0 {
+		return instIdList
+	}
+
+	building := m.getBuildingCollections()
+	started := make(map[string]bool)
+	queued := make(map[common.IndexDefnId]*common.IndexDefn)
+
+	result := ([]common.IndexInstId)(nil)
+	for _, instId := range instIdList {
+
+		defn, err := m.repo.GetIndexDefnById(inst2DefnMap[instId])
+		if err != nil || defn == nil {
+			// let indexer report the error
+			result = append(result, instId)
+			continue
+		}
+
+		key := getPendingKey(defn.Bucket, defn.Scope, defn.Collection)
+		if building[key] || started[key] || len(building)+len(started) < int(maxConcurrent) {
+			started[key] = true
+			result = append(result, instId)
+			continue
+		}
+
+		queued[defn.DefnId] = defn
+	}
+
+	for _, defn := range queued {
+		logging.Infof("LifecycleMgr.handleBuildIndexes() : Max concurrent build (%v) reached. Queue index (%v, %v, %v, %v) for build.",
+			maxConcurrent, defn.Bucket, defn.Scope, defn.Collection, defn.Name)
+		m.builder.notifych <- defn
+	}
+
+	return result
+}
+
+//
+// getBuildingCollections returns the collections that have initial index build in progress.
+//
+func (m *LifecycleMgr) getBuildingCollections() map[string]bool {
+
+	result := make(map[string]bool)
+
+	metaIter, err := m.repo.NewIterator()
+	if err != nil {
+		logging.Warnf("LifecycleMgr.getBuildingCollections():  Unable to read from metadata repository. Error = %v", err)
+		return result
+	}
+	defer metaIter.Close()
+
+	for _, defn, err := metaIter.Next(); err == nil; _, defn, err = metaIter.Next() {
+
+		key := getPendingKey(defn.Bucket, defn.Scope, defn.Collection)
+		if result[key] {
+			continue
+		}
+
+		if !m.canBuildIndex(defn.Bucket, defn.Scope, defn.Collection) {
+			result[key] = true
+		}
+	}
+
+	return result
+}
+
 //-----------------------------------------------------------
 // Delete Index
 //-----------------------------------------------------------
@@ -2525,7 +2819,8 @@ func (m *LifecycleMgr) broadcastStats() {
 // The IndexStats2 data structure must be modified to contain deleted indexes list
 // and current indexes map with storage stats
 // Currently, this method broadcasts full set of stats if there is any change in buckets
-// or indexes per bucket
+// or indexes per bucket.  Per index stats of a bucket are broadcasted only if they have
+// changed since last broadcast.
 func (m *LifecycleMgr) GetDiffFromLastSent(currStats *client.IndexStats2) *client.IndexStats2 {
 	m.clientStatsMutex.Lock()
 	defer m.clientStatsMutex.Unlock()
@@ -2538,15 +2833,18 @@ func (m *LifecycleMgr) GetDiffFromLastSent(currStats *client.IndexStats2) *clien
 	statsToBroadCast.Stats = make(map[string]*client.DedupedIndexStats)
 
 	for bucket, lastSentDeduped := range m.lastSendClientStats.Stats {
+		indexesChanged := false
 		if currDeduped, ok := currStats.Stats[bucket]; !ok {
 			return currStats
 		} else {
 			if len(currDeduped.Indexes) != len(lastSentDeduped.Indexes) {
 				return currStats
 			}
-			for indexName, _ := range lastSentDeduped.Indexes {
-				if _, ok := currDeduped.Indexes[indexName]; !ok {
+			for indexName, lastSentIndex := range lastSentDeduped.Indexes {
+				if currIndex, ok := currDeduped.Indexes[indexName]; !ok {
 					return currStats
+				} else if !currIndex.Equal(lastSentIndex) {
+					indexesChanged = true
 				}
 			}
 		}
@@ -2556,6 +2854,9 @@ func (m *LifecycleMgr) GetDiffFromLastSent(currStats *client.IndexStats2) *clien
 		statsToBroadCast.Stats[bucket].LastRollbackTime = currStats.Stats[bucket].LastRollbackTime
 		statsToBroadCast.Stats[bucket].ProgressStatTime = currStats.Stats[bucket].ProgressStatTime
 		statsToBroadCast.Stats[bucket].Indexes = nil
+		if indexesChanged {
+			statsToBroadCast.Stats[bucket].Indexes = currStats.Stats[bucket].Indexes
+		}
 	}
 
 	return statsToBroadCast
@@ -2577,6 +2878,26 @@ func convertToIndexStats2(stats common.Statistics) *client.IndexStats2 {
 		delete(stats, indexName+":last_rollback_time")
 		delete(stats, indexName+":progress_stat_time")
 		delete(stats, indexName+":index_state")
+		delete(stats, indexName+":num_requests")
+		delete(stats, indexName+":num_completed_requests")
+		delete(stats, indexName+":avg_scan_latency")
+	}
+
+	// Returns the scan load of the index.  Returns nil if the indexer
+	// does not send scan stats (e.g. during upgrade)
+	getPerIndexStats := func(indexName string) *client.PerIndexStats {
+		numRequests, ok1 := stats[indexName+":num_requests"].(float64)
+		numCompleted, ok2 := stats[indexName+":num_completed_requests"].(float64)
+		avgScanLatency, ok3 := stats[indexName+":avg_scan_latency"].(float64)
+		if !ok1 || !ok2 || !ok3 {
+			return nil
+		}
+
+		perIndexStats := &client.PerIndexStats{AvgScanLatency: avgScanLatency}
+		if numRequests > numCompleted {
+			perIndexStats.NumScansPending = numRequests - numCompleted
+		}
+		return perIndexStats
 	}
 
 	indexStats2 := &client.IndexStats2{}
@@ -2598,7 +2919,7 @@ func convertToIndexStats2(stats common.Statistics) *client.IndexStats2 {
 				indexStats2.Stats[bucketName].NumDocsQueued = stats[indexName+":num_docs_queued"].(float64)
 				indexStats2.Stats[bucketName].LastRollbackTime = stats[indexName+":last_rollback_time"].(string)
 				indexStats2.Stats[bucketName].ProgressStatTime = stats[indexName+":progress_stat_time"].(string)
-				indexStats2.Stats[bucketName].Indexes[indexName] = nil
+				indexStats2.Stats[bucketName].Indexes[indexName] = getPerIndexStats(indexName)
 
 				clearIndexFromStats(indexName)
 			}
@@ -2780,6 +3101,14 @@ func (m *LifecycleMgr) handleConfigUpdate(content []byte) error {
 		atomic.StoreUint64(&m.clientStatsRefreshInterval, uint64(val.Float64()))
 	}
 
+	if val, ok := (*config)["settings.rbac_cache_ttl"]; ok {
+		getPermissionsCache().setTTL(time.Duration(val.Int()) * time.Second)
+	}
+
+	if val, ok := (*config)["numSliceWriters"]; ok {
+		atomic.StoreInt32(&m.numSliceWriters, int32(val.Int()))
+	}
+
 	return nil
 }
 
@@ -2933,6 +3262,11 @@ func (m *LifecycleMgr) CreateIndexInstance(defn *common.IndexDefn, scheduled boo
 
 func (m *LifecycleMgr) verifyOverlapPartition(defn *common.IndexDefn, reqCtx *common.MetadataRequestContext) error {
 
+	// Instance created for storage migration or repair has all the partitions of the existing instance.
+	if m.isInstanceReplacement(defn, reqCtx) {
+		return nil
+	}
+
 	isRebalance := reqCtx.ReqSource == common.DDLRequestSourceRebalance
 	isRebalancePartition := isRebalance && common.IsPartitioned(defn.PartitionScheme)
 
@@ -4333,6 +4667,17 @@ func (s *builder) getBuildList() ([]string, int32) {
 		}
 	}
 
+	// do not start building more collections than allowed to build concurrently
+	if maxConcurrent := int(s.getMaxConcurrent()); maxConcurrent > 0 {
+		allowed := maxConcurrent - len(skipList)
+		if allowed < 0 {
+			allowed = 0
+		}
+		if len(buildList) > allowed {
+			buildList = buildList[:allowed]
+		}
+	}
+
 	return buildList, quota
 }
 
@@ -4353,6 +4698,14 @@ func (s *builder) tryBuildIndex(pendingKey string, quota int32) int32 {
 	bucket, scope, collection := getCollectionFromKey(pendingKey)
 	newQuota := quota
 
+	// batch size overridden for the keyspace limits the indexes built for the collection
+	collectionQuota := newQuota
+	if value, ok := common.GetKeyspaceSettings().Lookup("settings.build.batch_size", bucket, scope, collection); ok {
+		if batchSize := int32(value.(int)); batchSize >= 0 && (collectionQuota < 0 || batchSize < collectionQuota) {
+			collectionQuota = batchSize
+		}
+	}
+
 	defnIds := s.pendings[pendingKey]
 	if len(defnIds) != 0 {
 		// This is a pre-cautionary check if there is any index being
@@ -4362,12 +4715,19 @@ func (s *builder) tryBuildIndex(pendingKey string, quota int32) int32 {
 			buildList := ([]uint64)(nil)
 			buildMap := make(map[uint64]bool)
 
+			// smallest build_batch_size of the indexes in buildList
+			batchLimit := -1
+
 			pendingList := make([]uint64, len(defnIds))
 			copy(pendingList, defnIds)
 
 			for _, defnId := range defnIds {
 
-				if newQuota == 0 {
+				if newQuota == 0 || collectionQuota == 0 {
+					break
+				}
+
+				if batchLimit >= 0 && len(buildList) >= batchLimit {
 					break
 				}
 
@@ -4385,9 +4745,22 @@ func (s *builder) tryBuildIndex(pendingKey string, quota int32) int32 {
 					continue
 				}
 
+				// An index with build_batch_size is built with at most
+				// build_batch_size indexes.  Retry in next iteration if
+				// the batch is already full.
+				if defn.BuildBatchSize > 0 {
+					if len(buildList) >= defn.BuildBatchSize {
+						pendingList = append(pendingList, defnId)
+						continue
+					}
+					if batchLimit < 0 || defn.BuildBatchSize < batchLimit {
+						batchLimit = defn.BuildBatchSize
+					}
+				}
+
 				for _, inst := range insts {
 
-					if newQuota == 0 {
+					if newQuota == 0 || collectionQuota == 0 {
 						break
 					}
 
@@ -4401,6 +4774,7 @@ func (s *builder) tryBuildIndex(pendingKey string, quota int32) int32 {
 								buildMap[defnId] = true
 							}
 							newQuota = newQuota - 1
+							collectionQuota = collectionQuota - 1
 						} else {
 							// put it back to the pending list if index build is disable
 							pendingList = append(pendingList, defnId)
@@ -4580,6 +4954,9 @@ func (s *builder) configUpdate(config *common.Config) {
 	newBatchSize := int32((*config)["settings.build.batch_size"].Int())
 	atomic.StoreInt32(&s.batchSize, newBatchSize)
 
+	newMaxConcurrent := int32((*config)["settings.build.max_concurrent"].Int())
+	atomic.StoreInt32(&s.maxConcurrent, newMaxConcurrent)
+
 	disable := (*config)["build.background.disable"].Bool()
 	if disable {
 		atomic.StoreInt32(&s.disable, int32(1))
@@ -4588,6 +4965,10 @@ func (s *builder) configUpdate(config *common.Config) {
 	}
 }
 
+func (s *builder) getMaxConcurrent() int32 {
+	return atomic.LoadInt32(&s.maxConcurrent)
+}
+
 func (s *builder) disableBuild() bool {
 
 	if atomic.LoadInt32(&s.disable) == 1 {
@@ -4606,6 +4987,7 @@ func newBuilder(mgr *LifecycleMgr) *builder {
 		pendings:        make(map[string][]uint64),
 		notifych:        make(chan *common.IndexDefn, 10000),
 		batchSize:       int32(common.SystemConfig["indexer.settings.build.batch_size"].Int()),
+		maxConcurrent:   int32(common.SystemConfig["indexer.settings.build.max_concurrent"].Int()),
 		commandListener: mc.NewCommandListener(donech, false, true, false, false, false, false),
 		listenerDonech:  donech,
 	}
@@ -0,0 +1,29 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestVerifyBuildParamsCompression(t *testing.T) {
+
+	m := &LifecycleMgr{numSliceWriters: 8}
+
+	for _, compression := range []string{"", common.CompressionSnappy, common.CompressionZstd, common.CompressionNone} {
+		defn := &common.IndexDefn{Using: common.PlasmaDB, Compression: compression}
+		if err := m.verifyBuildParams(defn); err != nil {
+			t.Fatalf("compression %q: unexpected error %v", compression, err)
+		}
+	}
+
+	defn := &common.IndexDefn{Using: common.PlasmaDB, Compression: "lz4"}
+	if err := m.verifyBuildParams(defn); err == nil {
+		t.Fatal("expected error for invalid compression")
+	}
+
+	defn = &common.IndexDefn{Using: common.MemoryOptimized, Compression: common.CompressionZstd}
+	if err := m.verifyBuildParams(defn); err == nil {
+		t.Fatal("expected error for compression of memory optimized index")
+	}
+}
@@ -18,8 +18,11 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/cbauth/metakv"
 	gometaC "github.com/couchbase/gometa/common"
 	gometaL "github.com/couchbase/gometa/log"
 	"github.com/couchbase/indexing/secondary/common"
@@ -52,6 +55,8 @@ type IndexManager struct {
 
 	mutex    sync.Mutex
 	isClosed bool
+
+	settingsHistoryLock sync.Mutex
 }
 
 //
@@ -171,6 +176,9 @@ func NewIndexManagerInternal(config common.Config, storageMode common.StorageMod
 		return nil, err
 	}
 	mgr.lifecycleMgr = lifecycleMgr
+	if val, ok := config["numSliceWriters"]; ok {
+		atomic.StoreInt32(&lifecycleMgr.numSliceWriters, int32(val.Int()))
+	}
 
 	// Initialize MetadataRepo.  This a blocking call until the
 	// the metadataRepo (including watcher) is operational (e.g.
@@ -205,6 +213,9 @@ func NewIndexManagerInternal(config common.Config, storageMode common.StorageMod
 	// start lifecycle manager
 	mgr.lifecycleMgr.Run(mgr.repo, mgr.requestServer)
 
+	common.RegisterLocalSettings(mgr.getPlannerSettings)
+	common.RegisterSettingsRecorder(mgr.recordSettingsChanges)
+
 	// coordinator
 	mgr.coordinator = nil
 
@@ -344,6 +355,120 @@ func (m *IndexManager) GetLocalValue(key string) (string, error) {
 	return m.repo.GetLocalValue(key)
 }
 
+///////////////////////////////////////////////////////
+// public function - Keyspace Settings
+///////////////////////////////////////////////////////
+
+//
+// GetKeyspaceSettings returns the keyspace settings of the cluster, and
+// their metakv revision for SetKeyspaceSettings.
+//
+func (m *IndexManager) GetKeyspaceSettings() (common.KeyspaceSettings, interface{}, error) {
+
+	value, rev, err := metakv.Get(common.IndexingKeyspaceSettingsMetaPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ks, err := common.ParseKeyspaceSettings(value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ks, rev, nil
+}
+
+//
+// getPlannerSettings returns the planner settings of the local indexer.
+//
+func (m *IndexManager) getPlannerSettings() map[string]string {
+
+	settings := make(map[string]string)
+	for _, name := range plannerSettingNames {
+		if value, err := m.repo.GetLocalValue(name); err == nil {
+			settings[name] = value
+		}
+	}
+	return settings
+}
+
+//
+// SetKeyspaceSettings stores the keyspace settings of the cluster, changed
+// by creds, in metakv unless they are changed since rev.  Every indexer
+// node, including this one, applies them when it is notified by metakv.
+//
+func (m *IndexManager) SetKeyspaceSettings(ks common.KeyspaceSettings, rev interface{}, creds cbauth.Creds) error {
+
+	value, err := json.Marshal(ks)
+	if err != nil {
+		return err
+	}
+
+	common.SetSettingsAuthor(common.IndexingKeyspaceSettingsMetaPath, value, creds)
+	if err := metakv.Set(common.IndexingKeyspaceSettingsMetaPath, value, rev); err != nil {
+		return err
+	}
+
+	logging.Infof("IndexManager.SetKeyspaceSettings(): keyspace settings %v", ks)
+	return nil
+}
+
+///////////////////////////////////////////////////////
+// public function - Settings History
+///////////////////////////////////////////////////////
+
+const settingsHistoryKey = "SettingsHistory"
+
+// Maximum number of entries in the settings history.  Older entries are
+// dropped.
+var SETTINGS_HISTORY_MAX_ENTRIES = 1000
+
+//
+// GetSettingsHistory returns the settings changes made on the local
+// indexer, oldest first.
+//
+func (m *IndexManager) GetSettingsHistory() ([]common.SettingsChange, error) {
+
+	value, err := m.repo.GetLocalValue(settingsHistoryKey)
+	if err != nil || len(value) == 0 {
+		// no history
+		return nil, nil
+	}
+
+	var history []common.SettingsChange
+	if err := json.Unmarshal([]byte(value), &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (m *IndexManager) recordSettingsChanges(changes []common.SettingsChange) {
+
+	m.settingsHistoryLock.Lock()
+	defer m.settingsHistoryLock.Unlock()
+
+	history, err := m.GetSettingsHistory()
+	if err != nil {
+		logging.Errorf("IndexManager.recordSettingsChanges(): Fail to read settings history.  Reset history.  Error = %v", err)
+		history = nil
+	}
+
+	history = append(history, changes...)
+	if len(history) > SETTINGS_HISTORY_MAX_ENTRIES {
+		history = history[len(history)-SETTINGS_HISTORY_MAX_ENTRIES:]
+	}
+
+	value, err := json.Marshal(history)
+	if err != nil {
+		logging.Errorf("IndexManager.recordSettingsChanges(): Fail to marshal settings history.  Error = %v", err)
+		return
+	}
+
+	if err := m.repo.SetLocalValue(settingsHistoryKey, string(value)); err != nil {
+		logging.Errorf("IndexManager.recordSettingsChanges(): Fail to save settings history.  Error = %v", err)
+	}
+}
+
 //
 // Get an index definiton by id
 //
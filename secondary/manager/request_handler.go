@@ -17,6 +17,7 @@ import (
 	"io/ioutil"
 	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -24,9 +25,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/couchbase/cbauth"
+	"github.com/couchbase/indexing/secondary/audit"
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/common/collections"
 	"github.com/couchbase/indexing/secondary/logging"
@@ -128,6 +131,7 @@ type IndexStatus struct {
 	Error        string             `json:"error,omitempty"`
 	Completion   int                `json:"completion"`
 	Progress     float64            `json:"progress"`
+	Eta          int64              `json:"eta,omitempty"`
 	Scheduled    bool               `json:"scheduled"`
 	Partitioned  bool               `json:"partitioned"`
 	NumPartition int                `json:"numPartition"`
@@ -148,8 +152,27 @@ type IndexStatus struct {
 
 type indexStatusSorter []IndexStatus
 
+//
+// permissionsCache caches the RBAC decisions of all requests, by user and
+// permission.  A decision expires after ttl, so that a change of the user
+// roles takes effect within ttl.
+//
 type permissionsCache struct {
-	permissions map[string]bool
+	mutex       sync.RWMutex
+	permissions map[string]permissionEntry
+	ttl         int64 // nanoseconds, accessed atomically
+}
+
+type permissionEntry struct {
+	allowed bool
+	expiry  time.Time
+}
+
+const permissionsCacheMaxEntries = 100000
+
+var gPermissionsCache = &permissionsCache{
+	permissions: make(map[string]permissionEntry),
+	ttl:         int64(10 * time.Second),
 }
 
 //
@@ -217,19 +240,25 @@ func registerRequestHandler(mgr *IndexManager, clusterUrl string, mux *http.Serv
 
 		mux.HandleFunc("/createIndex", handlerContext.createIndexRequest)
 		mux.HandleFunc("/createIndexRebalance", handlerContext.createIndexRequestRebalance)
-		mux.HandleFunc("/dropIndex", handlerContext.dropIndexRequest)
+		mux.HandleFunc("/dropIndex", common.NetworkAllowed(handlerContext.dropIndexRequest))
 		mux.HandleFunc("/buildIndex", handlerContext.buildIndexRequest)
 		mux.HandleFunc("/getLocalIndexMetadata", handlerContext.handleLocalIndexMetadataRequest)
 		mux.HandleFunc("/getIndexMetadata", handlerContext.handleIndexMetadataRequest)
-		mux.HandleFunc("/restoreIndexMetadata", handlerContext.handleRestoreIndexMetadataRequest)
+		mux.HandleFunc("/restoreIndexMetadata", common.NetworkAllowed(handlerContext.handleRestoreIndexMetadataRequest))
 		mux.HandleFunc("/getIndexStatus", handlerContext.handleIndexStatusRequest)
 		mux.HandleFunc("/getIndexStatement", handlerContext.handleIndexStatementRequest)
 		mux.HandleFunc("/planIndex", handlerContext.handleIndexPlanRequest)
-		mux.HandleFunc("/settings/storageMode", handlerContext.handleIndexStorageModeRequest)
-		mux.HandleFunc("/settings/planner", handlerContext.handlePlannerRequest)
+		mux.HandleFunc("/settings/storageMode", common.NetworkAllowed(handlerContext.handleIndexStorageModeRequest))
+		mux.HandleFunc("/settings/planner", common.NetworkAllowed(handlerContext.handlePlannerRequest))
+		mux.HandleFunc("/settings/keyspace", common.NetworkAllowed(handlerContext.handleKeyspaceSettingsRequest))
+		mux.HandleFunc("/settings/export", common.NetworkAllowed(handlerContext.handleConfigExportRequest))
+		mux.HandleFunc("/settings/import", common.NetworkAllowed(handlerContext.handleConfigImportRequest))
+		mux.HandleFunc("/settings/history", common.NetworkAllowed(handlerContext.handleSettingsHistoryRequest))
 		mux.HandleFunc("/listReplicaCount", handlerContext.handleListLocalReplicaCountRequest)
 		mux.HandleFunc("/getCachedLocalIndexMetadata", handlerContext.handleCachedLocalIndexMetadataRequest)
 		mux.HandleFunc("/getCachedStats", handlerContext.handleCachedStats)
+		mux.HandleFunc("/getCachedLocalIndexMetadataBatch", handlerContext.handleCachedLocalIndexMetadataBatchRequest)
+		mux.HandleFunc("/getCachedStatsBatch", handlerContext.handleCachedStatsBatch)
 		mux.HandleFunc("/postScheduleCreateRequest", handlerContext.handleScheduleCreateRequest)
 
 		cacheDir := path.Join(config["storage_dir"].String(), "cache")
@@ -248,6 +277,8 @@ func registerRequestHandler(mgr *IndexManager, clusterUrl string, mux *http.Serv
 
 		handlerContext.schedTokenMon = newSchedTokenMonitor(mgr)
 
+		getPermissionsCache().setTTL(time.Duration(config["settings.rbac_cache_ttl"].Int()) * time.Second)
+
 		go handlerContext.runPersistor()
 	})
 
@@ -310,7 +341,8 @@ func (m *requestHandlerContext) doCreateIndex(w http.ResponseWriter, r *http.Req
 	}
 
 	if len(indexDefn.Using) != 0 && strings.ToLower(string(indexDefn.Using)) != "gsi" {
-		if common.IndexTypeToStorageMode(indexDefn.Using) != common.GetStorageMode() {
+		if common.IndexTypeToStorageMode(indexDefn.Using) != common.GetStorageMode() &&
+			!(isRebalReq && m.isIndexStorageMigration(&indexDefn)) {
 			sendIndexResponseWithError(http.StatusInternalServerError, w, fmt.Sprintf("Storage Mode Mismatch %v", indexDefn.Using))
 			return
 		}
@@ -330,6 +362,24 @@ func (m *requestHandlerContext) doCreateIndex(w http.ResponseWriter, r *http.Req
 
 }
 
+// isIndexStorageMigration returns true if defn is an index being migrated to the
+// storage mode in defn.Using.
+func (m *requestHandlerContext) isIndexStorageMigration(defn *common.IndexDefn) bool {
+
+	nodeUUID, err := m.mgr.getMetadataRepo().GetLocalNodeUUID()
+	if err != nil {
+		return false
+	}
+
+	modes, err := mc.GetIndexStorageModes(string(nodeUUID))
+	if err != nil {
+		return false
+	}
+
+	mode, ok := modes[defn.DefnId]
+	return ok && mode == common.IndexTypeToStorageMode(defn.Using)
+}
+
 func (m *requestHandlerContext) dropIndexRequest(w http.ResponseWriter, r *http.Request) {
 
 	creds, ok := doAuth(r, w)
@@ -503,6 +553,7 @@ func (m *requestHandlerContext) getIndexStatus(creds cbauth.Creds, t *target, ge
 
 	// find all nodes that has a index http service
 	nids := cinfo.GetNodesByServiceType(common.INDEX_HTTP_SERVICE)
+	peers := m.newPeerCacheFetcher(cinfo, nids)
 
 	numReplicas := make(map[common.IndexDefnId]common.Counter)
 	defns := make(map[common.IndexDefnId]common.IndexDefn)
@@ -513,7 +564,7 @@ func (m *requestHandlerContext) getIndexStatus(creds cbauth.Creds, t *target, ge
 
 	defnToHostMap := make(map[common.IndexDefnId][]string)
 	isInstanceDeferred := make(map[common.IndexInstId]bool)
-	permissionCache := initPermissionsCache()
+	permissionCache := getPermissionsCache()
 
 	mergeCounter := func(defnId common.IndexDefnId, counter common.Counter) {
 		if current, ok := numReplicas[defnId]; ok {
@@ -584,7 +635,7 @@ func (m *requestHandlerContext) getIndexStatus(creds cbauth.Creds, t *target, ge
 			metaToCache[u.Host] = nil
 			// TODO: It is not required to fetch metadata for entire node when target is for a specific
 			// bucket or collection
-			localMeta, latest, err := m.getLocalMetadataForNode(addr, u.Host, cinfo)
+			localMeta, latest, err := m.getLocalMetadataForNode(addr, u.Host, cinfo, peers)
 			if localMeta == nil || err != nil {
 				logging.Debugf("RequestHandler::getIndexStatus: Error while retrieving %v with auth %v", addr+"/getLocalIndexMetadata", err)
 				failedNodes = append(failedNodes, mgmtAddr)
@@ -599,7 +650,7 @@ func (m *requestHandlerContext) getIndexStatus(creds cbauth.Creds, t *target, ge
 			}
 
 			statsToCache[u.Host] = nil
-			stats, latest, err := m.getStatsForNode(addr, u.Host, cinfo)
+			stats, latest, err := m.getStatsForNode(addr, u.Host, cinfo, peers)
 			if stats == nil || err != nil {
 				logging.Debugf("RequestHandler::getIndexStatus: Error while retrieving %v with auth %v", addr+"/stats?async=true", err)
 				failedNodes = append(failedNodes, mgmtAddr)
@@ -677,6 +728,10 @@ func (m *requestHandlerContext) getIndexStatus(creds cbauth.Creds, t *target, ge
 										stateStr = "Created (Downgrading)"
 									}
 								}
+
+								if instance.Scheduled && len(instance.OldStorageMode) == 0 {
+									stateStr = "Queued for build"
+								}
 							}
 
 							if indexerState, ok := stats.ToMap()["indexer_state"]; ok {
@@ -707,6 +762,13 @@ func (m *requestHandlerContext) getIndexStatus(creds cbauth.Creds, t *target, ge
 								progress = math.Float64frombits(uint64(stat.(float64)))
 							}
 
+							// estimated time (in seconds) to complete index build
+							eta := int64(0)
+							key = fmt.Sprintf("%v:build_eta", instance.InstId)
+							if stat, ok := stats.ToMap()[key]; ok {
+								eta = int64(stat.(float64))
+							}
+
 							lastScanTime := "NA"
 							key = common.GetIndexStatKey(prefix, "last_known_scan_time")
 							if scanTime, ok := stats.ToMap()[key]; ok {
@@ -742,6 +804,7 @@ func (m *requestHandlerContext) getIndexStatus(creds cbauth.Creds, t *target, ge
 								Definition:   common.IndexStatement(defn, int(instance.NumPartitions), -1, true),
 								Completion:   completion,
 								Progress:     progress,
+								Eta:          eta,
 								Scheduled:    instance.Scheduled,
 								Partitioned:  common.IsPartitioned(defn.PartitionScheme),
 								NumPartition: len(instance.Partitions),
@@ -837,6 +900,11 @@ func (m *requestHandlerContext) consolideIndexStatus(statuses []IndexStatus) []I
 			s2.Hosts = append(s2.Hosts, status.Hosts...)
 			s2.Completion = (s2.Completion + status.Completion) / 2
 			s2.Progress = (s2.Progress + status.Progress) / 2.0
+			if status.Eta < 0 || s2.Eta < 0 {
+				s2.Eta = -1
+			} else if status.Eta > s2.Eta {
+				s2.Eta = status.Eta
+			}
 			s2.NumPartition += status.NumPartition
 			s2.NodeUUID = ""
 			if len(status.Error) != 0 {
@@ -884,6 +952,10 @@ func (m *requestHandlerContext) consolideStateStr(str1 string, str2 string) stri
 		return "Building"
 	}
 
+	if str1 == "Queued for build" || str2 == "Queued for build" {
+		return "Queued for build"
+	}
+
 	if str1 == "Replicating" || str2 == "Replicating" {
 		return "Replicating"
 	}
@@ -996,7 +1068,7 @@ func (m *requestHandlerContext) getIndexMetadata(creds cbauth.Creds, t *target)
 		return nil, err
 	}
 
-	permissionsCache := initPermissionsCache()
+	permissionsCache := getPermissionsCache()
 
 	// find all nodes that has a index http service
 	nids := cinfo.GetNodesByServiceType(common.INDEX_HTTP_SERVICE)
@@ -1372,7 +1444,7 @@ func (m *requestHandlerContext) getLocalIndexMetadata(creds cbauth.Creds,
 	bucket string, filters map[string]bool, filterType string) (meta *LocalIndexMetadata, err error) {
 
 	repo := m.mgr.getMetadataRepo()
-	permissionsCache := initPermissionsCache()
+	permissionsCache := getPermissionsCache()
 
 	meta = &LocalIndexMetadata{IndexTopologies: nil, IndexDefinitions: nil}
 	indexerId, err := repo.GetLocalIndexerId()
@@ -1396,6 +1468,10 @@ func (m *requestHandlerContext) getLocalIndexMetadata(creds cbauth.Creds,
 		meta.LocalSettings["excludeNode"] = exclude
 	}
 
+	if minimize, err := m.mgr.GetLocalValue("minimizeMovement"); err == nil {
+		meta.LocalSettings["minimizeMovement"] = minimize
+	}
+
 	iter, err := repo.NewIterator()
 	if err != nil {
 		return nil, err
@@ -1452,44 +1528,85 @@ func shouldProcess(t *target, defnBucket, defnScope, defnColl, defnName string)
 	return false
 }
 
-func initPermissionsCache() *permissionsCache {
-	p := &permissionsCache{}
-	p.permissions = make(map[string]bool)
-	return p
+func getPermissionsCache() *permissionsCache {
+	return gPermissionsCache
+}
+
+//
+// setTTL sets the expiry of the cached decisions.  Zero disables the cache.
+//
+func (p *permissionsCache) setTTL(ttl time.Duration) {
+	if time.Duration(atomic.SwapInt64(&p.ttl, int64(ttl))) != ttl {
+		logging.Infof("RequestHandler::permissionsCache: set ttl to %v", ttl)
+		p.invalidate()
+	}
+}
+
+func (p *permissionsCache) invalidate() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.permissions = make(map[string]permissionEntry)
+}
+
+func (p *permissionsCache) checkPermission(creds cbauth.Creds, permission string) bool {
+
+	ttl := time.Duration(atomic.LoadInt64(&p.ttl))
+	if ttl <= 0 {
+		return isAllowed(creds, []string{permission}, nil)
+	}
+
+	key := fmt.Sprintf("%s:%s:%s", creds.Domain(), creds.Name(), permission)
+	now := time.Now()
+
+	p.mutex.RLock()
+	entry, ok := p.permissions[key]
+	p.mutex.RUnlock()
+
+	if ok && now.Before(entry.expiry) {
+		return entry.allowed
+	}
+
+	// A failure to check the permission is not a decision, do not cache it
+	allowed, err := creds.IsAllowed(permission)
+	if err != nil {
+		logging.Warnf("RequestHandler::permissionsCache: fail to check permission %v: %v", permission, err)
+		return false
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.permissions) >= permissionsCacheMaxEntries {
+		for k, e := range p.permissions {
+			if now.After(e.expiry) {
+				delete(p.permissions, k)
+			}
+		}
+		if len(p.permissions) >= permissionsCacheMaxEntries {
+			p.permissions = make(map[string]permissionEntry)
+		}
+	}
+	p.permissions[key] = permissionEntry{allowed: allowed, expiry: now.Add(ttl)}
+
+	return allowed
 }
 
 func (p *permissionsCache) isAllowed(creds cbauth.Creds, bucket, scope, collection, op string) bool {
 
 	checkAndAddBucketLevelPermission := func(bucket string) bool {
-		if bucketLevelPermission, ok := p.permissions[bucket]; ok {
-			return bucketLevelPermission
-		} else {
-			permission := fmt.Sprintf("cluster.bucket[%s].n1ql.index!%s", bucket, op)
-			p.permissions[bucket] = isAllowed(creds, []string{permission}, nil)
-			return p.permissions[bucket]
-		}
+		permission := fmt.Sprintf("cluster.bucket[%s].n1ql.index!%s", bucket, op)
+		return p.checkPermission(creds, permission)
 	}
 
 	checkAndAddScopeLevelPermission := func(bucket, scope string) bool {
-		scopeLevel := fmt.Sprintf("%s:%s", bucket, scope)
-		if scopeLevelPermission, ok := p.permissions[scopeLevel]; ok {
-			return scopeLevelPermission
-		} else {
-			permission := fmt.Sprintf("cluster.scope[%s].n1ql.index!%s", scopeLevel, op)
-			p.permissions[scopeLevel] = isAllowed(creds, []string{permission}, nil)
-			return p.permissions[scopeLevel]
-		}
+		permission := fmt.Sprintf("cluster.scope[%s:%s].n1ql.index!%s", bucket, scope, op)
+		return p.checkPermission(creds, permission)
 	}
 
 	checkAndAddCollectionLevelPermission := func(bucket, scope, collection string) bool {
-		collectionLevel := fmt.Sprintf("%s:%s:%s", bucket, scope, collection)
-		if collectionLevelPermission, ok := p.permissions[collectionLevel]; ok {
-			return collectionLevelPermission
-		} else {
-			permission := fmt.Sprintf("cluster.collection[%s].n1ql.index!%s", collectionLevel, op)
-			p.permissions[collectionLevel] = isAllowed(creds, []string{permission}, nil)
-			return p.permissions[collectionLevel]
-		}
+		permission := fmt.Sprintf("cluster.collection[%s:%s:%s].n1ql.index!%s", bucket, scope, collection, op)
+		return p.checkPermission(creds, permission)
 	}
 
 	if checkAndAddBucketLevelPermission(bucket) {
@@ -1513,34 +1630,77 @@ func (m *requestHandlerContext) handleCachedLocalIndexMetadataRequest(w http.Res
 		return
 	}
 
-	permissionsCache := initPermissionsCache()
+	permissionsCache := getPermissionsCache()
 	host := r.FormValue("host")
 	host = strings.Trim(host, "\"")
 
 	meta, err := m.getLocalMetadataFromDisk(host)
 	if meta != nil && err == nil {
-		newMeta := *meta
-		newMeta.IndexDefinitions = make([]common.IndexDefn, 0, len(meta.IndexDefinitions))
-		newMeta.IndexTopologies = make([]IndexTopology, 0, len(meta.IndexTopologies))
+		send(http.StatusOK, w, filterLocalMetadata(meta, creds, permissionsCache))
 
-		for _, defn := range meta.IndexDefinitions {
-			if permissionsCache.isAllowed(creds, defn.Bucket, defn.Scope, defn.Collection, "list") {
-				newMeta.IndexDefinitions = append(newMeta.IndexDefinitions, defn)
-			}
-		}
+	} else {
+		logging.Debugf("RequestHandler::handleCachedLocalIndexMetadataRequest: err %v", err)
+		sendHttpError(w, " Unable to retrieve index metadata", http.StatusInternalServerError)
+	}
+}
 
-		for _, topology := range meta.IndexTopologies {
-			if permissionsCache.isAllowed(creds, topology.Bucket, topology.Scope, topology.Collection, "list") {
-				newMeta.IndexTopologies = append(newMeta.IndexTopologies, topology)
-			}
+//
+// handleCachedLocalIndexMetadataBatchRequest returns the cached local metadata
+// of every requested host (one or more "host" parameters) as a map keyed by
+// host.  Hosts without a cached copy are omitted from the response.
+//
+func (m *requestHandlerContext) handleCachedLocalIndexMetadataBatchRequest(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := doAuth(r, w)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		sendHttpError(w, " Unable to parse request", http.StatusBadRequest)
+		return
+	}
+
+	permissionsCache := getPermissionsCache()
+	result := make(map[string]*LocalIndexMetadata)
+	for _, host := range r.Form["host"] {
+		host = strings.Trim(host, "\"")
+
+		meta, err := m.getLocalMetadataFromDisk(host)
+		if meta == nil || err != nil {
+			logging.Debugf("RequestHandler::handleCachedLocalIndexMetadataBatchRequest: host %v err %v", host, err)
+			continue
 		}
 
-		send(http.StatusOK, w, newMeta)
+		result[host] = filterLocalMetadata(meta, creds, permissionsCache)
+	}
 
-	} else {
-		logging.Debugf("RequestHandler::handleCachedLocalIndexMetadataRequest: err %v", err)
-		sendHttpError(w, " Unable to retrieve index metadata", http.StatusInternalServerError)
+	send(http.StatusOK, w, result)
+}
+
+//
+// filterLocalMetadata returns a copy of meta with only the definitions and
+// topologies that the caller is allowed to list.
+//
+func filterLocalMetadata(meta *LocalIndexMetadata, creds cbauth.Creds, permissionsCache *permissionsCache) *LocalIndexMetadata {
+
+	newMeta := *meta
+	newMeta.IndexDefinitions = make([]common.IndexDefn, 0, len(meta.IndexDefinitions))
+	newMeta.IndexTopologies = make([]IndexTopology, 0, len(meta.IndexTopologies))
+
+	for _, defn := range meta.IndexDefinitions {
+		if permissionsCache.isAllowed(creds, defn.Bucket, defn.Scope, defn.Collection, "list") {
+			newMeta.IndexDefinitions = append(newMeta.IndexDefinitions, defn)
+		}
 	}
+
+	for _, topology := range meta.IndexTopologies {
+		if permissionsCache.isAllowed(creds, topology.Bucket, topology.Scope, topology.Collection, "list") {
+			newMeta.IndexTopologies = append(newMeta.IndexTopologies, topology)
+		}
+	}
+
+	return &newMeta
 }
 
 func (m *requestHandlerContext) handleCachedStats(w http.ResponseWriter, r *http.Request) {
@@ -1562,6 +1722,39 @@ func (m *requestHandlerContext) handleCachedStats(w http.ResponseWriter, r *http
 	}
 }
 
+//
+// handleCachedStatsBatch returns the cached stats of every requested host
+// (one or more "host" parameters) as a map keyed by host.  Hosts without a
+// cached copy are omitted from the response.
+//
+func (m *requestHandlerContext) handleCachedStatsBatch(w http.ResponseWriter, r *http.Request) {
+
+	_, ok := doAuth(r, w)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		sendHttpError(w, " Unable to parse request", http.StatusBadRequest)
+		return
+	}
+
+	result := make(map[string]*common.Statistics)
+	for _, host := range r.Form["host"] {
+		host = strings.Trim(host, "\"")
+
+		stats, err := m.getIndexStatsFromDisk(host)
+		if stats == nil || err != nil {
+			logging.Debugf("RequestHandler::handleCachedStatsBatch: host %v err %v", host, err)
+			continue
+		}
+
+		result[host] = stats
+	}
+
+	send(http.StatusOK, w, result)
+}
+
 ///////////////////////////////////////////////////////
 // Restore
 ///////////////////////////////////////////////////////
@@ -1583,7 +1776,7 @@ func (m *requestHandlerContext) handleRestoreIndexMetadataRequest(w http.Respons
 		return
 	}
 
-	permissionsCache := initPermissionsCache()
+	permissionsCache := getPermissionsCache()
 	// convert backup image into runtime data structure
 	image := m.convertIndexMetadataRequest(r)
 	if image == nil {
@@ -1612,12 +1805,17 @@ func (m *requestHandlerContext) handleRestoreIndexMetadataRequest(w http.Respons
 	context := createRestoreContext(image, m.clusterUrl, bucket, nil, "", nil)
 	hostIndexMap, err := context.computeIndexLayout()
 	if err != nil {
+		audit.LogIndexRequest(audit.RESTORE_INDEX, r, creds, bucket, "", "", "", nil, err)
 		send(http.StatusInternalServerError, w, &RestoreResponse{Code: RESP_ERROR, Error: fmt.Sprintf("Unable to restore metadata.  Error=%v", err)})
+		return
 	}
 
 	if m.restoreIndexMetadataToNodes(hostIndexMap) {
+		audit.LogIndexRequest(audit.RESTORE_INDEX, r, creds, bucket, "", "", "", nil, nil)
 		send(http.StatusOK, w, &RestoreResponse{Code: RESP_SUCCESS})
 	} else {
+		audit.LogIndexRequest(audit.RESTORE_INDEX, r, creds, bucket, "", "", "", nil,
+			errors.New("Unable to restore metadata."))
 		send(http.StatusInternalServerError, w, &RestoreResponse{Code: RESP_ERROR, Error: "Unable to restore metadata."})
 	}
 }
@@ -1749,6 +1947,160 @@ func (m *requestHandlerContext) convertIndexPlanRequest(r *http.Request) ([]*pla
 	return specs, nil
 }
 
+//////////////////////////////////////////////////////
+// Keyspace Settings
+///////////////////////////////////////////////////////
+
+// keyspaceSettingsLock serializes the changes of keyspace settings on this
+// node.  Concurrent changes on other nodes fail the metakv revision check.
+var keyspaceSettingsLock sync.Mutex
+
+//
+// Keyspace settings override the indexer settings for a bucket, scope or
+// collection on all indexer nodes.  POST replaces the settings of the
+// keyspaces in the request, and DELETE removes the settings of a keyspace.
+//
+func (m *requestHandlerContext) handleKeyspaceSettingsRequest(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := doAuth(r, w)
+	if !ok {
+		return
+	}
+
+	if r.Method == "GET" {
+		if !isAllowed(creds, []string{"cluster.settings!read"}, w) {
+			return
+		}
+		send(http.StatusOK, w, common.GetKeyspaceSettings())
+		return
+	}
+
+	if !isAllowed(creds, []string{"cluster.settings!write"}, w) {
+		return
+	}
+
+	keyspaceSettingsLock.Lock()
+	defer keyspaceSettingsLock.Unlock()
+
+	prev, rev, err := m.mgr.GetKeyspaceSettings()
+	if err != nil {
+		logging.Errorf("RequestHandler::handleKeyspaceSettingsRequest: Fail to get keyspace settings.  Error = %v", err)
+		sendHttpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ks := make(common.KeyspaceSettings)
+	for keyspace, settings := range prev {
+		ks[keyspace] = settings
+	}
+
+	switch r.Method {
+	case "POST":
+		bytes, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			sendHttpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		update, err := common.ParseKeyspaceSettings(bytes)
+		if err != nil {
+			if serr, ok := err.(*common.SettingError); ok {
+				send(http.StatusBadRequest, w, serr)
+			} else {
+				sendHttpError(w, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+
+		for keyspace, settings := range update {
+			if len(settings) == 0 {
+				delete(ks, keyspace)
+			} else {
+				ks[keyspace] = settings
+			}
+		}
+
+	case "DELETE":
+		keyspace := r.FormValue("keyspace")
+		if _, ok := ks[keyspace]; !ok {
+			sendHttpError(w, fmt.Sprintf("No settings for keyspace %v", keyspace), http.StatusNotFound)
+			return
+		}
+		delete(ks, keyspace)
+
+	default:
+		sendHttpError(w, "Unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := m.mgr.SetKeyspaceSettings(ks, rev, creds); err != nil {
+		logging.Errorf("RequestHandler::handleKeyspaceSettingsRequest: Fail to set keyspace settings.  Error = %v", err)
+		sendHttpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	send(http.StatusOK, w, ks)
+}
+
+//////////////////////////////////////////////////////
+// Settings History
+///////////////////////////////////////////////////////
+
+//
+// handleSettingsHistoryRequest returns the settings changes applied on this
+// node, oldest first.  Each node keeps its own history.  The user of a
+// change is known on the node which served the request.  Use ?key=<prefix>
+// to filter changes, and ?limit=<n> for the latest n changes.
+//
+func (m *requestHandlerContext) handleSettingsHistoryRequest(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := doAuth(r, w)
+	if !ok {
+		return
+	}
+
+	if !isAllowed(creds, []string{"cluster.settings!read"}, w) {
+		return
+	}
+
+	if r.Method != "GET" {
+		sendHttpError(w, "Unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 0
+	if value := r.FormValue("limit"); len(value) != 0 {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			send(http.StatusBadRequest, w, common.NewSettingError("limit", value,
+				"limit must be a non-negative integer", "0 or greater"))
+			return
+		}
+		limit = n
+	}
+
+	history, err := m.mgr.GetSettingsHistory()
+	if err != nil {
+		logging.Errorf("RequestHandler::handleSettingsHistoryRequest: Fail to read settings history.  Error = %v", err)
+		sendHttpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	prefix := r.FormValue("key")
+	result := make([]common.SettingsChange, 0, len(history))
+	for _, change := range history {
+		if strings.HasPrefix(change.Key, prefix) {
+			result = append(result, change)
+		}
+	}
+
+	if limit != 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+
+	send(http.StatusOK, w, result)
+}
+
 //////////////////////////////////////////////////////
 // Storage Mode
 ///////////////////////////////////////////////////////
@@ -1764,6 +2116,14 @@ func (m *requestHandlerContext) handleIndexStorageModeRequest(w http.ResponseWri
 		return
 	}
 
+	// Migrate a single index to a different storage mode.  The indexer builds an index instance
+	// in the new storage mode in the background, and swaps it with the existing instance once it
+	// has caught up.
+	if defnIdStr := r.FormValue("defnId"); len(defnIdStr) != 0 {
+		m.handleIndexStorageMigration(w, defnIdStr, r.FormValue("storageMode"))
+		return
+	}
+
 	// Override the storage mode for the local indexer.  Override will not take into effect until
 	// indexer has restarted manually by administrator.   During indexer bootstrap, it will upgrade/downgrade
 	// individual index to the override storage mode.
@@ -1808,6 +2168,66 @@ func (m *requestHandlerContext) handleIndexStorageModeRequest(w http.ResponseWri
 	}
 }
 
+func (m *requestHandlerContext) handleIndexStorageMigration(w http.ResponseWriter, defnIdStr string, indexType string) {
+
+	id, err := strconv.ParseUint(defnIdStr, 10, 64)
+	if err != nil {
+		sendHttpError(w, fmt.Sprintf("invalid defnId %v", defnIdStr), http.StatusBadRequest)
+		return
+	}
+	defnId := common.IndexDefnId(id)
+
+	if common.GetBuildMode() != common.ENTERPRISE {
+		sendHttpError(w, "storage migration is not supported", http.StatusBadRequest)
+		return
+	}
+
+	defn, err := m.mgr.getMetadataRepo().GetIndexDefnById(defnId)
+	if err != nil {
+		sendHttpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if defn == nil {
+		sendHttpError(w, fmt.Sprintf("index %v does not exist on this node", defnId), http.StatusBadRequest)
+		return
+	}
+
+	// An empty storage mode cancels any pending migration
+	if len(indexType) != 0 {
+		mode := common.IndexTypeToStorageMode(common.IndexType(indexType))
+		if mode == common.NOT_SET {
+			sendHttpError(w, fmt.Sprintf("invalid storageMode %v", indexType), http.StatusBadRequest)
+			return
+		}
+
+		if common.IsPartitioned(defn.PartitionScheme) && mode == common.FORESTDB {
+			sendHttpError(w, "cannot migrate partitioned index to forestdb", http.StatusBadRequest)
+			return
+		}
+		indexType = string(common.StorageModeToIndexType(mode))
+	}
+
+	nodeUUID, err := m.mgr.getMetadataRepo().GetLocalNodeUUID()
+	if err != nil {
+		logging.Infof("RequestHandler::handleIndexStorageMigration: unable to identify nodeUUID.  Cannot migrate index.")
+		send(http.StatusOK, w, "Unable to identify nodeUUID.  Cannot migrate index.")
+		return
+	}
+
+	if err := mc.PostIndexStorageMode(string(nodeUUID), defnId, indexType); err != nil {
+		sendHttpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(indexType) == 0 {
+		logging.Infof("RequestHandler::handleIndexStorageMigration: unset storage mode for index %v", defnId)
+		send(http.StatusOK, w, "index storage mode migration is disabled")
+	} else {
+		logging.Infof("RequestHandler::handleIndexStorageMigration: migrate index %v to storage mode %v", defnId, indexType)
+		send(http.StatusOK, w, fmt.Sprintf("migrate index storage mode to %v in background.", indexType))
+	}
+}
+
 //////////////////////////////////////////////////////
 // Planner
 ///////////////////////////////////////////////////////
@@ -1823,12 +2243,42 @@ func (m *requestHandlerContext) handlePlannerRequest(w http.ResponseWriter, r *h
 		return
 	}
 
+	r.ParseForm()
+	if _, ok := r.Form["minimizeMovement"]; ok {
+		value := r.FormValue("minimizeMovement")
+		if value != "true" && value != "false" {
+			send(http.StatusBadRequest, w, common.NewSettingError("minimizeMovement", value,
+				"minimizeMovement must be true or false", "true, false"))
+			return
+		}
+
+		m.setPlannerSetting(creds, "minimizeMovement", value)
+		if _, ok := r.Form["excludeNode"]; !ok {
+			send(http.StatusOK, w, "OK")
+			return
+		}
+	}
+
 	value := r.FormValue("excludeNode")
 	if value == "in" || value == "out" || value == "inout" || len(value) == 0 {
-		m.mgr.SetLocalValue("excludeNode", value)
+		m.setPlannerSetting(creds, "excludeNode", value)
 		send(http.StatusOK, w, "OK")
 	} else {
-		sendHttpError(w, "value must be in, out or inout", http.StatusBadRequest)
+		send(http.StatusBadRequest, w, common.NewSettingError("excludeNode", value,
+			"value must be in, out or inout", "in, out, inout"))
+	}
+}
+
+func (m *requestHandlerContext) setPlannerSetting(creds cbauth.Creds, name, value string) {
+
+	old, _ := m.mgr.GetLocalValue(name)
+	if err := m.mgr.SetLocalValue(name, value); err != nil {
+		logging.Errorf("RequestHandler::setPlannerSetting: Fail to set %v.  Error = %v", name, err)
+		return
+	}
+
+	if old != value {
+		common.RecordSettingsChanges(creds, []common.SettingsChange{{Key: name, Old: old, New: value}})
 	}
 }
 
@@ -1864,7 +2314,7 @@ func (m *requestHandlerContext) getLocalReplicaCount(creds cbauth.Creds) (map[co
 	defer iter.Close()
 
 	var defn *common.IndexDefn
-	permissionsCache := initPermissionsCache()
+	permissionsCache := getPermissionsCache()
 
 	_, defn, err = iter.Next()
 	for err == nil {
@@ -1983,12 +2433,12 @@ func isAllowed(creds cbauth.Creds, permissions []string, w http.ResponseWriter)
 }
 
 func getWithAuth(url string) (*http.Response, error) {
-	params := &security.RequestParams{Timeout: time.Duration(10) * time.Second}
+	params := &security.RequestParams{Timeout: time.Duration(10) * time.Second, EnforceEncryption: true}
 	return security.GetWithAuth(url, params)
 }
 
 func postWithAuth(url string, bodyType string, body io.Reader) (*http.Response, error) {
-	params := &security.RequestParams{Timeout: time.Duration(10) * time.Second}
+	params := &security.RequestParams{Timeout: time.Duration(10) * time.Second, EnforceEncryption: true}
 	return security.PostWithAuth(url, bodyType, body, params)
 }
 
@@ -2047,11 +2497,101 @@ func (s indexStatusSorter) Less(i, j int) bool {
 	return s[i].Bucket < s[j].Bucket
 }
 
+///////////////////////////////////////////////////////
+// retrieve cached metadata / stats from peers
+///////////////////////////////////////////////////////
+
+//
+// peerCacheFetcher retrieves the cached local metadata and stats kept by
+// peer indexer nodes.  The cached copies of all indexer hosts are fetched
+// from a peer with a single batch request, at most once per peer, so that
+// looking up the freshest copy of N unreachable hosts does not cost
+// N requests to every peer.  Peers which do not support the batch
+// endpoints are queried one host at a time.
+//
+type peerCacheFetcher struct {
+	m     *requestHandlerContext
+	hosts []string
+
+	meta     map[string]map[string]*LocalIndexMetadata // peer addr -> host -> metadata
+	stats    map[string]map[string]*common.Statistics  // peer addr -> host -> stats
+	metaErr  map[string]error
+	statsErr map[string]error
+}
+
+func (m *requestHandlerContext) newPeerCacheFetcher(cinfo *common.ClusterInfoCache, nids []common.NodeId) *peerCacheFetcher {
+
+	hosts := make([]string, 0, len(nids))
+	for _, nid := range nids {
+		addr, err := cinfo.GetServiceAddress(nid, common.INDEX_HTTP_SERVICE)
+		if err != nil {
+			continue
+		}
+
+		u, err := security.GetURL(addr)
+		if err != nil {
+			continue
+		}
+
+		hosts = append(hosts, u.Host)
+	}
+
+	return &peerCacheFetcher{
+		m:        m,
+		hosts:    hosts,
+		meta:     make(map[string]map[string]*LocalIndexMetadata),
+		stats:    make(map[string]map[string]*common.Statistics),
+		metaErr:  make(map[string]error),
+		statsErr: make(map[string]error),
+	}
+}
+
+func (p *peerCacheFetcher) getLocalMetadata(addr string, host string) (*LocalIndexMetadata, error) {
+
+	if _, ok := p.metaErr[addr]; !ok {
+		p.meta[addr], p.metaErr[addr] = p.m.getCachedLocalMetadataBatchFromREST(addr, p.hosts)
+		if p.metaErr[addr] != nil {
+			logging.Debugf("peerCacheFetcher: batch metadata request to %v failed. Error %v", addr, p.metaErr[addr])
+		}
+	}
+
+	if p.metaErr[addr] != nil {
+		return p.m.getCachedLocalMetadataFromREST(addr, host)
+	}
+
+	if meta, ok := p.meta[addr][host]; ok && meta != nil {
+		return meta, nil
+	}
+
+	return nil, fmt.Errorf("No cached metadata for %v at %v", host, addr)
+}
+
+func (p *peerCacheFetcher) getStats(addr string, host string) (*common.Statistics, error) {
+
+	if _, ok := p.statsErr[addr]; !ok {
+		p.stats[addr], p.statsErr[addr] = p.m.getCachedStatsBatchFromREST(addr, p.hosts)
+		if p.statsErr[addr] != nil {
+			logging.Debugf("peerCacheFetcher: batch stats request to %v failed. Error %v", addr, p.statsErr[addr])
+		}
+	}
+
+	if p.statsErr[addr] != nil {
+		return p.m.getCachedStatsFromREST(addr, host)
+	}
+
+	if stats, ok := p.stats[addr][host]; ok && stats != nil {
+		return stats, nil
+	}
+
+	return nil, fmt.Errorf("No cached stats for %v at %v", host, addr)
+}
+
 ///////////////////////////////////////////////////////
 // retrieve / persist cached local index metadata
 ///////////////////////////////////////////////////////
 
-func (m *requestHandlerContext) getLocalMetadataForNode(addr string, host string, cinfo *common.ClusterInfoCache) (*LocalIndexMetadata, bool, error) {
+func (m *requestHandlerContext) getLocalMetadataForNode(addr string, host string, cinfo *common.ClusterInfoCache,
+	peers *peerCacheFetcher) (*LocalIndexMetadata, bool, error) {
 
 	meta, err := m.getLocalMetadataFromREST(addr, host)
 	if err == nil {
@@ -2064,7 +2604,7 @@ func (m *requestHandlerContext) getLocalMetadataForNode(addr string, host string
 		for _, nid := range nids {
 			addr, err1 := cinfo.GetServiceAddress(nid, common.INDEX_HTTP_SERVICE)
 			if err1 == nil {
-				cached, err1 := m.getCachedLocalMetadataFromREST(addr, host)
+				cached, err1 := peers.getLocalMetadata(addr, host)
 				if cached != nil && err1 == nil {
 					if latest == nil || cached.Timestamp > latest.Timestamp {
 						latest = cached
@@ -2132,6 +2672,40 @@ func (m *requestHandlerContext) getCachedLocalMetadataFromREST(addr string, host
 	return nil, err
 }
 
+func (m *requestHandlerContext) getCachedLocalMetadataBatchFromREST(addr string, hosts []string) (map[string]*LocalIndexMetadata, error) {
+
+	resp, err := getWithAuth(fmt.Sprintf("%v/getCachedLocalIndexMetadataBatch?%v", addr, hostsQuery(hosts)))
+	defer func() {
+		if resp != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+	}()
+
+	if err == nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Unexpected response status %v from %v", resp.StatusCode, addr)
+		}
+
+		metas := make(map[string]*LocalIndexMetadata)
+		if status := convertResponse(resp, &metas); status == RESP_SUCCESS {
+			return metas, nil
+		}
+
+		err = fmt.Errorf("Fail to unmarshal response from %v", addr)
+	}
+
+	return nil, err
+}
+
+func hostsQuery(hosts []string) string {
+
+	values := url.Values{}
+	for _, host := range hosts {
+		values.Add("host", fmt.Sprintf("\"%v\"", host))
+	}
+	return values.Encode()
+}
+
 func (m *requestHandlerContext) getLocalMetadataFromDisk(hostname string) (*LocalIndexMetadata, error) {
 
 	filename := host2file(hostname)
@@ -2240,7 +2814,8 @@ func (m *requestHandlerContext) cleanupLocalMetadataOnDisk(hostnames []string) {
 // retrieve / persist cached index stats
 ///////////////////////////////////////////////////////
 
-func (m *requestHandlerContext) getStatsForNode(addr string, host string, cinfo *common.ClusterInfoCache) (*common.Statistics, bool, error) {
+func (m *requestHandlerContext) getStatsForNode(addr string, host string, cinfo *common.ClusterInfoCache,
+	peers *peerCacheFetcher) (*common.Statistics, bool, error) {
 
 	stats, err := m.getStatsFromREST(addr, host)
 	if err == nil {
@@ -2253,7 +2828,7 @@ func (m *requestHandlerContext) getStatsForNode(addr string, host string, cinfo
 		for _, nid := range nids {
 			addr, err1 := cinfo.GetServiceAddress(nid, common.INDEX_HTTP_SERVICE)
 			if err1 == nil {
-				cached, err1 := m.getCachedStatsFromREST(addr, host)
+				cached, err1 := peers.getStats(addr, host)
 				if cached != nil && err1 == nil {
 					if latest == nil {
 						latest = cached
@@ -2342,6 +2917,31 @@ func (m *requestHandlerContext) getCachedStatsFromREST(addr string, host string)
 	return nil, err
 }
 
+func (m *requestHandlerContext) getCachedStatsBatchFromREST(addr string, hosts []string) (map[string]*common.Statistics, error) {
+
+	resp, err := getWithAuth(fmt.Sprintf("%v/getCachedStatsBatch?%v", addr, hostsQuery(hosts)))
+	defer func() {
+		if resp != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+	}()
+
+	if err == nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Unexpected response status %v from %v", resp.StatusCode, addr)
+		}
+
+		stats := make(map[string]*common.Statistics)
+		if status := convertResponse(resp, &stats); status == RESP_SUCCESS {
+			return stats, nil
+		}
+
+		err = fmt.Errorf("Fail to unmarshal response from %v", addr)
+	}
+
+	return nil, err
+}
+
 func (m *requestHandlerContext) getIndexStatsFromDisk(hostname string) (*common.Statistics, error) {
 
 	filename := host2file(hostname)
@@ -2605,6 +3205,11 @@ func (m *requestHandlerContext) validateScheduleCreateRequst(req *client.Schedul
 		return "", "", "", err
 	}
 
+	err = m.mgr.lifecycleMgr.verifyBuildParams(&defn)
+	if err != nil {
+		return "", "", "", err
+	}
+
 	// TODO: Check indexer state to be active
 
 	var ephimeral bool
@@ -2613,7 +3218,7 @@ func (m *requestHandlerContext) validateScheduleCreateRequst(req *client.Schedul
 		return "", "", "", err
 	}
 
-	if ephimeral && common.GetStorageMode() != common.MOI {
+	if ephimeral && common.IndexTypeToStorageMode(defn.Using) != common.MOI {
 		return "", "", "", fmt.Errorf("Bucket %v is Ephemeral but GSI storage is not MOI", defn.Bucket)
 	}
 
@@ -2655,7 +3260,8 @@ func (m *requestHandlerContext) validateStorageMode(defn *common.IndexDefn) erro
 	}
 
 	if common.IsPartitioned(defn.PartitionScheme) {
-		if defn.Using != common.PlasmaDB && defn.Using != common.MemDB && defn.Using != common.MemoryOptimized {
+		if defn.Using != common.PlasmaDB && defn.Using != common.MemDB && defn.Using != common.MemoryOptimized &&
+			defn.Using != common.HashIndex {
 			err := fmt.Sprintf("Create Index fails. Reason = Cannot create partitioned index using %v", string(defn.Using))
 			return errors.New(err)
 		}
@@ -2933,13 +3539,18 @@ func getSchedCreateTokens(bucket string, filters map[string]bool, filterType str
 }
 
 func (m *requestHandlerContext) authorizeBucketRequest(w http.ResponseWriter,
-	r *http.Request, creds cbauth.Creds, bucket, include, exclude string) bool {
+	r *http.Request, creds cbauth.Creds, bucket, include, exclude string) (map[string]bool, bool) {
 
 	// Basic RBAC.
 	// 1. If include filter is specified, verify user has permissions to access
 	//    indexes created on all component scopes and collections.
 	// 2. If include filter is not specified, verify user has permissions to
 	//    access the indexes for the bucket.
+	// 3. For backup without include filter, if user does not have permissions
+	//    for the bucket, verify user has permissions to access the indexes of
+	//    at least one scope of the bucket.  The accessible scopes are returned,
+	//    and the backup is filtered to these scopes.  A nil map is returned if
+	//    the backup need not be filtered.
 	//
 	// During backup, Local index metadata call can peform RBAC based filtering.
 	// So, in case of unauthorized access to a specific scope / collection,
@@ -2955,15 +3566,27 @@ func (m *requestHandlerContext) authorizeBucketRequest(w http.ResponseWriter,
 
 	default:
 		send(http.StatusBadRequest, w, fmt.Sprintf("Unsupported method %v", r.Method))
-		return false
+		return nil, false
 	}
 
 	if len(include) == 0 {
 		switch r.Method {
 		case "GET":
 			permission := fmt.Sprintf("cluster.bucket[%s].n1ql.index!%s", bucket, op)
-			if !isAllowed(creds, []string{permission}, w) {
-				return false
+			if !isAllowed(creds, []string{permission}, nil) {
+				scopes, err := m.getAuthorizedScopes(creds, bucket, op)
+				if err != nil {
+					logging.Errorf("RequestHandler::authorizeBucketRequest: Fail to get scopes of bucket %v. err %v", bucket, err)
+					send(http.StatusInternalServerError, w, err.Error())
+					return nil, false
+				}
+
+				if len(scopes) == 0 {
+					isAllowed(creds, []string{permission}, w)
+					return nil, false
+				}
+
+				return scopes, true
 			}
 
 		case "POST":
@@ -2975,12 +3598,12 @@ func (m *requestHandlerContext) authorizeBucketRequest(w http.ResponseWriter,
 				// include filter (or without any filter) and restore is being
 				// performed by a another user (with less privileges) using an exclude
 				// filter. This scenario seems unlikely.
-				return false
+				return nil, false
 			}
 
 		default:
 			send(http.StatusBadRequest, w, fmt.Sprintf("Unsupported method %v", r.Method))
-			return false
+			return nil, false
 		}
 	} else {
 		incls := strings.Split(include, ",")
@@ -2990,22 +3613,93 @@ func (m *requestHandlerContext) authorizeBucketRequest(w http.ResponseWriter,
 				scope := fmt.Sprintf("%s:%s", bucket, inc[0])
 				permission := fmt.Sprintf("cluster.scope[%s].n1ql.index!%s", scope, op)
 				if !isAllowed(creds, []string{permission}, w) {
-					return false
+					return nil, false
 				}
 			} else if len(inc) == 2 {
 				collection := fmt.Sprintf("%s:%s:%s", bucket, inc[0], inc[1])
 				permission := fmt.Sprintf("cluster.collection[%s].n1ql.index!%s", collection, op)
 				if !isAllowed(creds, []string{permission}, w) {
-					return false
+					return nil, false
 				}
 			} else {
 				send(http.StatusBadRequest, w, fmt.Sprintf("Malformed url %v, include %v", r.URL.Path, include))
-				return false
+				return nil, false
 			}
 		}
 	}
 
-	return true
+	return nil, true
+}
+
+//
+// Get the scopes of the bucket, from the collection manifest, for which
+// the user has permissions to perform op on the indexes.
+//
+func (m *requestHandlerContext) getAuthorizedScopes(creds cbauth.Creds,
+	bucket, op string) (map[string]bool, error) {
+
+	cinfo, err := m.mgr.FetchNewClusterInfoCache()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cinfo.FetchManifestInfo(bucket); err != nil {
+		return nil, err
+	}
+
+	cinfo.RLock()
+	scopes := cinfo.GetScopes(bucket)
+	cinfo.RUnlock()
+
+	authorized := make(map[string]bool)
+	for _, scope := range scopes {
+		permission := fmt.Sprintf("cluster.scope[%s:%s].n1ql.index!%s", bucket, scope, op)
+		if isAllowed(creds, []string{permission}, nil) {
+			authorized[scope] = true
+		}
+	}
+
+	return authorized, nil
+}
+
+//
+// Remove the index metadata and schedule create tokens of the scopes
+// not in scopes from the backup.
+//
+func filterBackupByScopes(clusterMeta *ClusterIndexMetadata, scopes map[string]bool) {
+
+	inScopes := func(scope string) bool {
+		if len(scope) == 0 {
+			scope = common.DEFAULT_SCOPE
+		}
+		return scopes[scope]
+	}
+
+	for i, localMeta := range clusterMeta.Metadata {
+
+		var topologies []IndexTopology
+		for _, topology := range localMeta.IndexTopologies {
+			if inScopes(topology.Scope) {
+				topologies = append(topologies, topology)
+			}
+		}
+
+		var defns []common.IndexDefn
+		for _, defn := range localMeta.IndexDefinitions {
+			if inScopes(defn.Scope) {
+				defns = append(defns, defn)
+			}
+		}
+
+		clusterMeta.Metadata[i].IndexTopologies = topologies
+		clusterMeta.Metadata[i].IndexDefinitions = defns
+	}
+
+	for defnId, token := range clusterMeta.SchedTokens {
+		if !inScopes(token.Definition.Scope) {
+			delete(clusterMeta.SchedTokens, defnId)
+		}
+	}
 }
 
 func (m *requestHandlerContext) bucketReqHandler(w http.ResponseWriter, r *http.Request, creds cbauth.Creds) {
@@ -3046,7 +3740,8 @@ func (m *requestHandlerContext) bucketReqHandler(w http.ResponseWriter, r *http.
 
 		logging.Debugf("bucketReqHandler:backup url %v, include %v, exclude %v", url, include, exclude)
 
-		if !m.authorizeBucketRequest(w, r, creds, bucket, include, exclude) {
+		scopes, ok := m.authorizeBucketRequest(w, r, creds, bucket, include, exclude)
+		if !ok {
 			return
 		}
 
@@ -3056,6 +3751,9 @@ func (m *requestHandlerContext) bucketReqHandler(w http.ResponseWriter, r *http.
 			// Backup
 			clusterMeta, err := m.bucketBackupHandler(bucket, include, exclude, r)
 			if err == nil {
+				if scopes != nil {
+					filterBackupByScopes(clusterMeta, scopes)
+				}
 				resp := &BackupResponse{Code: RESP_SUCCESS, Result: *clusterMeta}
 				send(http.StatusOK, w, resp)
 			} else {
@@ -3065,7 +3763,19 @@ func (m *requestHandlerContext) bucketReqHandler(w http.ResponseWriter, r *http.
 			}
 
 		case "POST":
+			if !common.IsNetworkAllowed(r, w) {
+				return
+			}
+
 			status, errStr := m.bucketRestoreHandler(bucket, include, exclude, r)
+
+			var err error
+			if status != http.StatusOK {
+				err = errors.New(errStr)
+			}
+			params := map[string]interface{}{"include": include, "exclude": exclude}
+			audit.LogIndexRequest(audit.RESTORE_INDEX, r, creds, bucket, "", "", "", params, err)
+
 			if status == http.StatusOK {
 				send(http.StatusOK, w, &RestoreResponse{Code: RESP_SUCCESS})
 			} else {
@@ -3166,6 +3876,11 @@ func (s *schedTokenMonitor) makeIndexStatus(token *mc.ScheduleCreateToken) *Inde
 	numPartitons := defn.NumPartitions
 	stmt := common.IndexStatement(*defn, int(numPartitons), -1, true)
 
+	indexType := common.IndexTypeToStorageMode(defn.Using)
+	if indexType == common.NOT_SET {
+		indexType = common.GetStorageMode()
+	}
+
 	// TODO: Scheduled: Should we rename it to ScheduledBuild ?
 
 	// Use DefnId for InstId as a placeholder value because InstId cannot zero.
@@ -3179,7 +3894,7 @@ func (s *schedTokenMonitor) makeIndexStatus(token *mc.ScheduleCreateToken) *Inde
 		IsPrimary:    defn.IsPrimary,
 		SecExprs:     defn.SecExprs,
 		WhereExpr:    defn.WhereExpr,
-		IndexType:    common.GetStorageMode().String(),
+		IndexType:    indexType.String(),
 		Status:       "Scheduled for Creation",
 		Definition:   stmt,
 		Completion:   0,
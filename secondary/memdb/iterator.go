@@ -38,6 +38,38 @@ func (it *Iterator) Seek(bs []byte) {
 	it.skipUnwanted()
 }
 
+func (it *Iterator) skipUnwantedPrev() {
+loop:
+	if !it.iter.Valid() {
+		return
+	}
+	itm := (*Item)(it.iter.Get())
+	if itm.bornSn > it.snap.sn || (itm.deadSn > 0 && itm.deadSn <= it.snap.sn) {
+		it.iter.PrevWithCmp(it.snap.db.insCmp)
+		goto loop
+	}
+}
+
+// SeekLast moves the iterator to the last item of the snapshot
+func (it *Iterator) SeekLast() {
+	it.iter.SeekLast()
+	it.skipUnwantedPrev()
+}
+
+// SeekPrev moves the iterator to the last item smaller than bs
+func (it *Iterator) SeekPrev(bs []byte) {
+	itm := it.snap.db.newItem(bs, false)
+	it.iter.SeekPrev(unsafe.Pointer(itm))
+	it.skipUnwantedPrev()
+}
+
+// Prev moves the iterator to the previous item of the snapshot. Versions
+// of an item are ordered by insert compare, so that none is skipped.
+func (it *Iterator) Prev() {
+	it.iter.PrevWithCmp(it.snap.db.insCmp)
+	it.skipUnwantedPrev()
+}
+
 func (it *Iterator) Valid() bool {
 	return it.iter.Valid()
 }
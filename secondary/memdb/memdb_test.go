@@ -84,6 +84,59 @@ func doInsert(db *MemDB, wg *sync.WaitGroup, n int, isRand bool, shouldSnap bool
 	}
 }
 
+func TestReverseIterator(t *testing.T) {
+	db := NewWithConfig(testConf)
+	defer db.Close()
+
+	w := db.NewWriter()
+	for i := 0; i < 2000; i++ {
+		w.Put([]byte(fmt.Sprintf("%010d", i)))
+	}
+
+	for i := 1750; i < 2000; i++ {
+		w.Delete([]byte(fmt.Sprintf("%010d", i)))
+	}
+	snap, _ := w.NewSnapshot()
+	defer snap.Close()
+
+	// Versions not visible in snap
+	for i := 1000; i < 5000; i++ {
+		w.Delete([]byte(fmt.Sprintf("%010d", i)))
+		w.Put([]byte(fmt.Sprintf("%010d", i)))
+	}
+
+	itr := db.NewIterator(snap)
+	defer itr.Close()
+
+	count := 0
+	for itr.SeekLast(); itr.Valid(); itr.Prev() {
+		expected := fmt.Sprintf("%010d", 1749-count)
+		got := string(itr.Get())
+		count++
+		if got != expected {
+			t.Errorf("Expected %s, got %v", expected, got)
+		}
+	}
+
+	if count != 1750 {
+		t.Errorf("Expected count = 1750, got %v", count)
+	}
+
+	count = 0
+	for itr.SeekPrev([]byte(fmt.Sprintf("%010d", 500))); itr.Valid(); itr.Prev() {
+		expected := fmt.Sprintf("%010d", 499-count)
+		got := string(itr.Get())
+		count++
+		if got != expected {
+			t.Errorf("Expected %s, got %v", expected, got)
+		}
+	}
+
+	if count != 500 {
+		t.Errorf("Expected count = 500, got %v", count)
+	}
+}
+
 func TestInsertPerf(t *testing.T) {
 	var wg sync.WaitGroup
 	db := NewWithConfig(testConf)
@@ -53,8 +53,24 @@ func (it *Iterator) Seek(itm unsafe.Pointer) bool {
 	return found
 }
 
+// SeekLast moves the iterator to the last item
+func (it *Iterator) SeekLast() {
+	it.valid = true
+	it.s.findPath(nil, it.cmp, it.buf, &it.s.Stats)
+	it.prev = nil
+	it.curr = it.buf.preds[0]
+}
+
+// SeekPrev moves the iterator to the last item smaller than itm
+func (it *Iterator) SeekPrev(itm unsafe.Pointer) {
+	it.valid = true
+	it.s.findPath(itm, it.cmp, it.buf, &it.s.Stats)
+	it.prev = nil
+	it.curr = it.buf.preds[0]
+}
+
 func (it *Iterator) Valid() bool {
-	if it.valid && it.curr == it.s.tail {
+	if it.valid && (it.curr == it.s.tail || it.curr == it.s.head) {
 		it.valid = false
 	}
 
@@ -108,6 +124,21 @@ retry:
 	}
 }
 
+// Prev moves the iterator to the previous item. Nodes are not linked
+// backwards, so every step searches the path from the top level.
+func (it *Iterator) Prev() {
+	it.PrevWithCmp(it.cmp)
+}
+
+// PrevWithCmp is Prev with a compare function ordering all the items.
+// Items comparing equal to the current item are skipped.
+func (it *Iterator) PrevWithCmp(cmp CompareFn) {
+	it.valid = true
+	it.s.findPath(it.curr.Item(), cmp, it.buf, &it.s.Stats)
+	it.prev = nil
+	it.curr = it.buf.preds[0]
+}
+
 func (it *Iterator) Close() {
 	it.s.barrier.Release(it.bs)
 }
@@ -17,6 +17,7 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"sort"
 	"strconv"
 	"time"
 
@@ -57,6 +58,7 @@ type RunConfig struct {
 	Runtime        *time.Time
 	Threshold      float64
 	CpuProfile     bool
+	MinimizeMove   bool
 }
 
 type RunStats struct {
@@ -91,6 +93,32 @@ type Plan struct {
 	IsLive    bool           `json:"isLive,omitempty"`
 
 	UsedReplicaIdMap map[common.IndexDefnId]map[int]bool
+
+	// revert the index movements not needed for balance during rebalance
+	MinimizeMovement bool `json:"minimizeMovement,omitempty"`
+}
+
+//
+// IndexMovement is an index movement planned by rebalance, as reported
+// by a rebalance dry run.  The sizes are the estimated total of the
+// partitions moved.  SourceId is empty if the index replica is rebuilt
+// on the destination node.
+//
+type IndexMovement struct {
+	DefnId     common.IndexDefnId   `json:"defnId"`
+	Bucket     string               `json:"bucket"`
+	Scope      string               `json:"scope"`
+	Collection string               `json:"collection"`
+	Name       string               `json:"name"`
+	ReplicaId  int                  `json:"replicaId"`
+	Partitions []common.PartitionId `json:"partitions"`
+	SourceId   string               `json:"sourceId,omitempty"`
+	SourceNode string               `json:"sourceNode,omitempty"`
+	DestId     string               `json:"destId"`
+	DestNode   string               `json:"destNode"`
+	DataSize   uint64               `json:"dataSize"`
+	DiskSize   uint64               `json:"diskSize"`
+	MemUsage   uint64               `json:"memUsage"`
 }
 
 type IndexSpec struct {
@@ -142,9 +170,40 @@ func ExecuteRebalanceInternal(clusterUrl string,
 	topologyChange service.TopologyChange, masterId string, addNode bool, detail bool, ejectOnly bool,
 	disableReplicaRepair bool, timeout int, threshold float64, cpuProfile bool, runtime *time.Time) (map[string]*common.TransferToken, error) {
 
+	p, deleteNodes, err := executeRebalance(clusterUrl, topologyChange, addNode, detail, ejectOnly,
+		disableReplicaRepair, timeout, threshold, cpuProfile, runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	return genTransferToken(p.Result, masterId, topologyChange, deleteNodes)
+}
+
+//
+// ExecuteRebalanceDryRun plans the rebalance for the topology change in the
+// same way as ExecuteRebalance, and returns the index movements of the plan
+// without generating transfer tokens.
+//
+func ExecuteRebalanceDryRun(clusterUrl string, topologyChange service.TopologyChange, ejectOnly bool,
+	disableReplicaRepair bool, threshold float64, timeout int, cpuProfile bool) ([]*IndexMovement, error) {
+
+	runtime := time.Now()
+	p, _, err := executeRebalance(clusterUrl, topologyChange, false, false, ejectOnly,
+		disableReplicaRepair, timeout, threshold, cpuProfile, &runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	return genIndexMovements(p.Result), nil
+}
+
+func executeRebalance(clusterUrl string, topologyChange service.TopologyChange, addNode bool, detail bool,
+	ejectOnly bool, disableReplicaRepair bool, timeout int, threshold float64, cpuProfile bool,
+	runtime *time.Time) (*SAPlanner, []string, error) {
+
 	plan, err := RetrievePlanFromCluster(clusterUrl, nil)
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Unable to read index layout from cluster %v. err = %s", clusterUrl, err))
+		return nil, nil, errors.New(fmt.Sprintf("Unable to read index layout from cluster %v. err = %s", clusterUrl, err))
 	}
 
 	nodes := make(map[string]string)
@@ -155,7 +214,7 @@ func ExecuteRebalanceInternal(clusterUrl string,
 	deleteNodes := make([]string, len(topologyChange.EjectNodes))
 	for i, node := range topologyChange.EjectNodes {
 		if _, ok := nodes[string(node.NodeID)]; !ok {
-			return nil, errors.New(fmt.Sprintf("Unable to find indexer node with node UUID %v", node.NodeID))
+			return nil, nil, errors.New(fmt.Sprintf("Unable to find indexer node with node UUID %v", node.NodeID))
 		}
 		deleteNodes[i] = nodes[string(node.NodeID)]
 	}
@@ -163,7 +222,7 @@ func ExecuteRebalanceInternal(clusterUrl string,
 	// make sure we have all the keep nodes
 	for _, node := range topologyChange.KeepNodes {
 		if _, ok := nodes[string(node.NodeInfo.NodeID)]; !ok {
-			return nil, errors.New(fmt.Sprintf("Unable to find indexer node with node UUID %v", node.NodeInfo.NodeID))
+			return nil, nil, errors.New(fmt.Sprintf("Unable to find indexer node with node UUID %v", node.NodeInfo.NodeID))
 		}
 	}
 
@@ -191,10 +250,10 @@ func ExecuteRebalanceInternal(clusterUrl string,
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return genTransferToken(p.Result, masterId, topologyChange, deleteNodes)
+	return p, deleteNodes, nil
 }
 
 func genTransferToken(solution *Solution, masterId string, topologyChange service.TopologyChange,
@@ -330,6 +389,59 @@ func genTransferToken(solution *Solution, masterId string, topologyChange servic
 	return result, nil
 }
 
+//
+// genIndexMovements lists the index movements in the solution, with one
+// movement for every index replica between a specific source and
+// destination, as the transfer tokens are generated by genTransferToken.
+//
+func genIndexMovements(solution *Solution) []*IndexMovement {
+
+	useLive := solution.UseLiveData()
+	movements := make(map[string]*IndexMovement)
+	result := make([]*IndexMovement, 0)
+
+	for _, indexer := range solution.Placement {
+		for _, index := range indexer.Indexes {
+
+			var sourceId, sourceNode string
+			if index.initialNode != nil && !index.pendingCreate {
+				if index.initialNode.NodeId == indexer.NodeId {
+					continue
+				}
+				sourceId = index.initialNode.NodeUUID
+				sourceNode = index.initialNode.NodeId
+			}
+
+			key := fmt.Sprintf("%v %v %v %v", index.DefnId, index.Instance.ReplicaId, sourceId, indexer.NodeUUID)
+
+			movement, ok := movements[key]
+			if !ok {
+				movement = &IndexMovement{
+					DefnId:     index.DefnId,
+					Bucket:     index.Bucket,
+					Scope:      index.Scope,
+					Collection: index.Collection,
+					Name:       index.Name,
+					ReplicaId:  index.Instance.ReplicaId,
+					SourceId:   sourceId,
+					SourceNode: sourceNode,
+					DestId:     indexer.NodeUUID,
+					DestNode:   indexer.NodeId,
+				}
+				movements[key] = movement
+				result = append(result, movement)
+			}
+
+			movement.Partitions = append(movement.Partitions, index.PartnId)
+			movement.DataSize += index.GetDataSize(useLive)
+			movement.DiskSize += index.GetDiskUsage(useLive)
+			movement.MemUsage += index.GetMemUsage(useLive)
+		}
+	}
+
+	return result
+}
+
 //////////////////////////////////////////////////////////////
 // Integration with Metadata Provider
 /////////////////////////////////////////////////////////////
@@ -447,6 +559,196 @@ func ExecuteReplicaRepair(clusterUrl string, defnId common.IndexDefnId, incremen
 	return p.Result, nil
 }
 
+//
+// FindReplicaRepairNodes returns the indexer nodes that the planner would use
+// to rebuild the replicas lost by the indexes in the plan, by index
+// definition.  The lost replicas of all the indexes are planned at once.
+// The index layout is not changed, but the plan is used for planning, so it
+// cannot be planned again.
+//
+func FindReplicaRepairNodes(plan *Plan) (map[common.IndexDefnId][]string, error) {
+
+	config := DefaultRunConfig()
+	config.Resize = false
+
+	p, err := replicaRepair(config, plan, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	repairNodes := make(map[common.IndexDefnId][]string)
+	for _, indexer := range p.Result.Placement {
+		found := make(map[common.IndexDefnId]bool)
+		for _, index := range indexer.Indexes {
+			// the rebuilt replicas are not on any node before planning
+			if index.initialNode == nil && !found[index.DefnId] {
+				repairNodes[index.DefnId] = append(repairNodes[index.DefnId], indexer.NodeId)
+				found[index.DefnId] = true
+			}
+		}
+	}
+
+	return repairNodes, nil
+}
+
+//
+// FindReplicaViolations checks the placement of the index replicas in the
+// plan, and returns the violations by index definition.  The replicas of a
+// partition violate the placement constraint if they are on the same indexer
+// node, or if they are in the same server group while there is a server
+// group that has no replica of the partition.
+//
+func FindReplicaViolations(plan *Plan) map[common.IndexDefnId][]string {
+
+	serverGroups := make(map[string]bool)
+	replicaMap := make(map[common.IndexDefnId]map[common.PartitionId]map[int]*IndexerNode)
+	for _, indexer := range plan.Placement {
+		serverGroups[indexer.ServerGroup] = true
+
+		for _, index := range indexer.Indexes {
+			if index.Instance == nil {
+				continue
+			}
+			if _, ok := replicaMap[index.DefnId]; !ok {
+				replicaMap[index.DefnId] = make(map[common.PartitionId]map[int]*IndexerNode)
+			}
+			if _, ok := replicaMap[index.DefnId][index.PartnId]; !ok {
+				replicaMap[index.DefnId][index.PartnId] = make(map[int]*IndexerNode)
+			}
+			replicaMap[index.DefnId][index.PartnId][index.Instance.ReplicaId] = indexer
+		}
+	}
+
+	violations := make(map[common.IndexDefnId][]string)
+	for defnId, partitions := range replicaMap {
+		for partnId, replicas := range partitions {
+
+			replicaIds := make([]int, 0, len(replicas))
+			for replicaId, _ := range replicas {
+				replicaIds = append(replicaIds, replicaId)
+			}
+			sort.Ints(replicaIds)
+
+			byNode := make(map[string][]int)
+			byServerGroup := make(map[string][]int)
+			for _, replicaId := range replicaIds {
+				indexer := replicas[replicaId]
+				byNode[indexer.NodeId] = append(byNode[indexer.NodeId], replicaId)
+				byServerGroup[indexer.ServerGroup] = append(byServerGroup[indexer.ServerGroup], replicaId)
+			}
+
+			for nodeId, ids := range byNode {
+				if len(ids) > 1 {
+					violations[defnId] = append(violations[defnId],
+						fmt.Sprintf("Replica %v of partition %v are on the same node %v", ids, partnId, nodeId))
+				}
+			}
+
+			if len(byServerGroup) < len(serverGroups) {
+				for serverGroup, ids := range byServerGroup {
+					if len(ids) > 1 {
+						violations[defnId] = append(violations[defnId],
+							fmt.Sprintf("Replica %v of partition %v are in the same server group %v", ids, partnId, serverGroup))
+					}
+				}
+			}
+		}
+	}
+
+	for _, msgs := range violations {
+		sort.Strings(msgs)
+	}
+
+	return violations
+}
+
+//
+// ValidateMoveIndex checks if the replicas of the index can be moved to the
+// given nodes without violating the HA constraints.  moves maps the
+// replicaId of a replica to the node uuid of its destination.
+//
+func ValidateMoveIndex(clusterUrl string, defnId common.IndexDefnId, moves map[int]string) error {
+
+	plan, err := RetrievePlanFromCluster(clusterUrl, nil)
+	if err != nil {
+		return fmt.Errorf("Unable to read index layout from cluster %v. err = %s", clusterUrl, err)
+	}
+
+	return validateMoveIndex(plan, defnId, moves)
+}
+
+func validateMoveIndex(plan *Plan, defnId common.IndexDefnId, moves map[int]string) error {
+
+	config := DefaultRunConfig()
+	config.Resize = false
+
+	sizing := newGeneralSizingMethod()
+	solution, constraint, _, _, _ := solutionFromPlan(CommandRebalance, config, sizing, plan)
+
+	// The layout is validated as it is, so that a manual move is only
+	// checked against the HA constraints of the moved replicas.  The
+	// resource constraints are not enforced.
+	solution.command = CommandPlan
+
+	moved := make(map[*IndexUsage]bool)
+	for replicaId, nodeUUID := range moves {
+
+		var target *IndexerNode
+		for _, indexer := range solution.Placement {
+			if indexer.NodeUUID == nodeUUID {
+				target = indexer
+				break
+			}
+		}
+
+		if target == nil {
+			return fmt.Errorf("Unable to find indexer node with node UUID %v", nodeUUID)
+		}
+
+		if target.isDelete {
+			return fmt.Errorf("Indexer node %v is being removed", target.NodeId)
+		}
+
+		if target.ExcludeIn(solution) {
+			return fmt.Errorf("Indexer node %v does not take in new index", target.NodeId)
+		}
+
+		found := false
+		for _, source := range solution.Placement {
+
+			// moveIndex changes the index list of the indexer
+			indexes := make([]*IndexUsage, len(source.Indexes))
+			copy(indexes, source.Indexes)
+
+			for _, index := range indexes {
+				if index.DefnId == defnId && index.Instance != nil && index.Instance.ReplicaId == replicaId {
+					if source != target {
+						solution.moveIndex(source, index, target, false)
+					}
+					moved[index] = true
+					found = true
+				}
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("Unable to find replica %v of index %v", replicaId, defnId)
+		}
+	}
+
+	for _, indexer := range solution.Placement {
+		for _, index := range indexer.Indexes {
+			if moved[index] && !constraint.SatisfyIndexHAConstraint(solution, indexer, index, moved) {
+				return fmt.Errorf("Replica %v of index %v cannot be placed on indexer node %v "+
+					"with another replica or in the same server group as another replica",
+					index.Instance.ReplicaId, defnId, indexer.NodeId)
+			}
+		}
+	}
+
+	return nil
+}
+
 func ExecuteReplicaDrop(clusterUrl string, defnId common.IndexDefnId, nodes []string, numPartition int, decrement int, dropReplicaId int) (*Solution, []int, error) {
 
 	plan, err := RetrievePlanFromCluster(clusterUrl, nodes)
@@ -769,6 +1071,7 @@ func rebalance(command CommandType, config *RunConfig, plan *Plan, indexes []*In
 	planner.SetRuntime(config.Runtime)
 	planner.SetVariationThreshold(config.Threshold)
 	planner.SetCpuProfile(config.CpuProfile)
+	planner.SetMinimizeMovement(config.MinimizeMove || (plan != nil && plan.MinimizeMovement))
 	if config.Detail {
 		logging.Infof("************ Index Layout Before Rebalance *************")
 		solution.PrintLayout()
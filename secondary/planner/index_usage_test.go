@@ -0,0 +1,39 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package planner
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestIndexUsageIsMOI(t *testing.T) {
+
+	tests := map[string]bool{
+		common.MemoryOptimized: true,
+		common.MemDB:           true,
+		common.VectorIndex:     true,
+		"VECTOR":               true,
+		common.PlasmaDB:        false,
+		common.ForestDB:        false,
+		"":                     false,
+	}
+
+	for storageMode, moi := range tests {
+		index := &IndexUsage{StorageMode: storageMode}
+		if index.IsMOI() != moi {
+			t.Fatalf("storage mode %q: expected IsMOI %v", storageMode, moi)
+		}
+		if index.IsMOI() && index.IsPlasma() {
+			t.Fatalf("storage mode %q: index cannot be both MOI and plasma", storageMode)
+		}
+	}
+}
@@ -49,6 +49,14 @@ const (
 	MinNumPositiveMove int64   = 1
 )
 
+// constant - minimize movement.  Maximum increase of the cost of the
+// solution when reverting the index movements not needed for balance.
+const MinMovementCostTolerance float64 = 0.01
+
+// constant - swap rebalance.  Maximum relative difference of memory between
+// a node being removed and the node replacing it.
+const SwapMemTotalTolerance float64 = 0.05
+
 // constant - index sizing - MOI
 const (
 	MOIMutationRatePerCore uint64 = 25000
@@ -184,6 +192,10 @@ type IndexerNode struct {
 	ActualScanRate    uint64  `json:"actualScanRate"`
 	ActualMemMin      uint64  `json:"actualMemMin"`
 
+	// input: capacity of the node (from live cluster)
+	ActualCpuCore  uint64 `json:"actualCpuCore,omitempty"`
+	ActualMemTotal uint64 `json:"actualMemTotal,omitempty"`
+
 	// input: index residing on the node
 	Indexes []*IndexUsage `json:"indexes"`
 
@@ -192,6 +204,9 @@ type IndexerNode struct {
 	isNew    bool
 	exclude  string
 
+	// input: planner setting of the node
+	minimizeMovement bool
+
 	// intput/output: planning
 	meetConstraint bool
 	numEmptyIndex  int
@@ -358,10 +373,11 @@ type SAPlanner struct {
 	sizing     SizingMethod
 
 	// config
-	timeout    int
-	runtime    *time.Time
-	threshold  float64
-	cpuProfile bool
+	timeout          int
+	runtime          *time.Time
+	threshold        float64
+	cpuProfile       bool
+	minimizeMovement bool
 
 	// result
 	Result          *Solution `json:"result,omitempty"`
@@ -561,9 +577,18 @@ func (p *SAPlanner) Plan(command CommandType, solution *Solution) (*Solution, er
 
 		err = p.Validate(solution)
 		if err == nil {
+			if command == CommandRebalance && i == 0 {
+				if swapped := p.swapRebalance(solution); swapped != nil {
+					return swapped, nil
+				}
+			}
+
 			result, err, violations = p.planSingleRun(command, solution)
 
 			if violations == nil {
+				if p.minimizeMovement && command == CommandRebalance && result != nil {
+					p.revertUnneededMovement(result)
+				}
 				return result, err
 			}
 
@@ -882,6 +907,155 @@ func (p *SAPlanner) planSingleRun(command CommandType, solution *Solution) (*Sol
 	return current, nil, nil
 }
 
+//
+// swapRebalance handles the swap rebalance, where every node being removed
+// is replaced by a new node of the same capacity in the same server group.
+// The indexes on the removed nodes are moved wholesale to their replacement,
+// instead of being redistributed across the cluster.  The lost replicas and
+// partitions being rebuilt are then placed where they cost the least.  It
+// returns nil if it is not a swap rebalance, or if the swap does not satisfy
+// the cluster constraint.
+//
+func (p *SAPlanner) swapRebalance(s *Solution) *Solution {
+
+	if s.numDeletedNode == 0 || s.numDeletedNode != s.numNewNode {
+		return nil
+	}
+
+	current := s.clone()
+
+	var newNodes []*IndexerNode
+	for _, indexer := range current.Placement {
+		if !indexer.isDelete && indexer.isNew && !indexer.ExcludeIn(current) {
+			newNodes = append(newNodes, indexer)
+		}
+	}
+
+	deleted := current.getDeleteNodes()
+	if len(newNodes) != len(deleted) {
+		return nil
+	}
+
+	swaps := make(map[*IndexerNode]*IndexerNode)
+	used := make(map[*IndexerNode]bool)
+	for _, source := range deleted {
+		for _, target := range newNodes {
+			if !used[target] && target.ServerGroup == source.ServerGroup && target.StorageMode == source.StorageMode &&
+				sameCapacity(source, target) {
+				swaps[source] = target
+				used[target] = true
+				break
+			}
+		}
+
+		if _, ok := swaps[source]; !ok {
+			return nil
+		}
+	}
+
+	for source, target := range swaps {
+
+		// moveIndex changes the index list of the indexer
+		indexes := make([]*IndexUsage, len(source.Indexes))
+		copy(indexes, source.Indexes)
+
+		for _, index := range indexes {
+			current.moveIndex(source, index, target, false)
+		}
+
+		logging.Infof("Planner::swapRebalance Move %v indexes from %v to %v", len(indexes), source.NodeId, target.NodeId)
+	}
+
+	p.placeNewIndexes(current)
+
+	if !p.constraint.SatisfyClusterConstraint(current, p.placement.GetEligibleIndexes()) {
+		logging.Infof("Planner::swapRebalance Swap does not satisfy cluster constraint.  Redistribute indexes across the cluster.")
+		return nil
+	}
+
+	p.Result = current
+	p.Score = p.cost.Cost(current)
+	current.updateCost()
+
+	return current
+}
+
+//
+// sameCapacity returns whether two indexer nodes have the same number of
+// cpu cores, and the same memory within SwapMemTotalTolerance.  Nodes
+// without capacity stats, e.g. in simulation, have the same capacity.
+//
+func sameCapacity(source, target *IndexerNode) bool {
+
+	if source.ActualCpuCore != target.ActualCpuCore {
+		return false
+	}
+
+	if source.ActualMemTotal == 0 || target.ActualMemTotal == 0 {
+		return source.ActualMemTotal == target.ActualMemTotal
+	}
+
+	diff := math.Abs(float64(source.ActualMemTotal) - float64(target.ActualMemTotal))
+	return diff <= float64(source.ActualMemTotal)*SwapMemTotalTolerance
+}
+
+//
+// placeNewIndexes moves each index without an initial node, i.e. a lost
+// replica or partition being rebuilt, or an index pending create, to the
+// node where the solution has the lowest cost and satisfies the cluster
+// constraint.
+//
+func (p *SAPlanner) placeNewIndexes(s *Solution) {
+
+	eligibles := p.placement.GetEligibleIndexes()
+
+	var targets []*IndexerNode
+	for _, indexer := range s.Placement {
+		if !indexer.isDelete && !indexer.ExcludeIn(s) {
+			targets = append(targets, indexer)
+		}
+	}
+
+	for _, indexer := range s.Placement {
+
+		// moveIndex changes the index list of the indexer
+		indexes := make([]*IndexUsage, len(indexer.Indexes))
+		copy(indexes, indexer.Indexes)
+
+		for _, index := range indexes {
+			if index.initialNode != nil && !index.pendingCreate {
+				continue
+			}
+
+			best, bestCost := indexer, math.MaxFloat64
+			if !indexer.isDelete && p.constraint.SatisfyClusterConstraint(s, eligibles) {
+				bestCost = p.cost.Cost(s)
+			}
+
+			for _, target := range targets {
+				if target == indexer {
+					continue
+				}
+
+				s.moveIndex(indexer, index, target, false)
+				if p.constraint.SatisfyClusterConstraint(s, eligibles) {
+					if cost := p.cost.Cost(s); cost < bestCost {
+						best, bestCost = target, cost
+					}
+				}
+				s.moveIndex(target, index, indexer, false)
+			}
+
+			if best != indexer {
+				s.moveIndex(indexer, index, best, false)
+				logging.Infof("Planner::placeNewIndexes Place index (%v,%v,%v,%v) inst %v partn %v on %v",
+					index.Bucket, index.Scope, index.Collection, index.Name,
+					index.InstId, index.PartnId, best.NodeId)
+			}
+		}
+	}
+}
+
 func (p *SAPlanner) SetTimeout(timeout int) {
 	p.timeout = timeout
 }
@@ -898,6 +1072,58 @@ func (p *SAPlanner) SetCpuProfile(cpuProfile bool) {
 	p.cpuProfile = cpuProfile
 }
 
+func (p *SAPlanner) SetMinimizeMovement(minimizeMovement bool) {
+	p.minimizeMovement = minimizeMovement
+}
+
+//
+// Revert the index movements which are not needed to balance the cluster.
+// The planner searches for a balanced layout over all the indexes, so it
+// can move indexes that are already well placed, e.g. when a node is added.
+// Each moved index is moved back to its initial node as long as the cost of
+// the solution does not increase by more than MinMovementCostTolerance, and
+// the constraints are still satisfied.  Indexes moved out of deleted or
+// excluded nodes stay where they are.
+//
+func (p *SAPlanner) revertUnneededMovement(s *Solution) {
+
+	eligibles := p.placement.GetEligibleIndexes()
+	maxCost := p.cost.Cost(s) + MinMovementCostTolerance
+
+	reverted := 0
+	for _, indexer := range s.Placement {
+
+		// moveIndex changes the index list of the indexer
+		indexes := make([]*IndexUsage, len(indexer.Indexes))
+		copy(indexes, indexer.Indexes)
+
+		for _, index := range indexes {
+			if index.initialNode == nil || index.initialNode.NodeId == indexer.NodeId || index.pendingCreate {
+				continue
+			}
+
+			initial := s.findMatchingIndexer(index.initialNode.NodeId)
+			if initial == nil || initial.isDelete || initial.ExcludeAny(s) {
+				continue
+			}
+
+			s.moveIndex(indexer, index, initial, false)
+
+			if p.cost.Cost(s) <= maxCost && p.constraint.SatisfyClusterConstraint(s, eligibles) {
+				reverted++
+				continue
+			}
+
+			s.moveIndex(initial, index, indexer, false)
+		}
+	}
+
+	p.Score = p.cost.Cost(s)
+	s.updateCost()
+
+	logging.Infof("Planner::revertUnneededMovement Reverted %v index movements. Score %v", reverted, p.Score)
+}
+
 //
 // Validate the solution
 //
@@ -3862,6 +4088,8 @@ func (o *IndexerNode) clone() *IndexerNode {
 	r.ActualDiskUsage = o.ActualDiskUsage
 	r.ActualDrainRate = o.ActualDrainRate
 	r.ActualScanRate = o.ActualScanRate
+	r.ActualCpuCore = o.ActualCpuCore
+	r.ActualMemTotal = o.ActualMemTotal
 	r.meetConstraint = o.meetConstraint
 	r.numEmptyIndex = o.numEmptyIndex
 	r.hasEligible = o.hasEligible
@@ -4705,7 +4933,8 @@ func (o *IndexUsage) IsEquivalentIndex(other *IndexUsage, checkSuppress bool) bo
 
 func (o *IndexUsage) IsMOI() bool {
 
-	return o.StorageMode == common.MemoryOptimized || o.StorageMode == common.MemDB
+	// vector and hash indexes are memory optimized as well
+	return common.IndexTypeToStorageMode(common.IndexType(o.StorageMode)) == common.MOI
 }
 
 func (o *IndexUsage) IsPlasma() bool {
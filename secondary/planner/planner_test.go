@@ -0,0 +1,253 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package planner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+//
+// newTestSolution creates a solution with a node for each entry of layout,
+// holding indexes of the given memory and data size.  All the indexes are
+// on their initial node.
+//
+func newTestSolution(layout [][]uint64) (*SAPlanner, *Solution) {
+
+	sizing := newGeneralSizingMethod()
+
+	var nodes []*IndexerNode
+	var indexes []*IndexUsage
+	for i, sizes := range layout {
+		node := newIndexerNode(fmt.Sprintf("n%v", i), sizing)
+		for _, size := range sizes {
+			id := len(indexes) + 1
+			index := newIndexUsage(common.IndexDefnId(id), common.IndexInstId(id), 0,
+				fmt.Sprintf("idx%v", id), "bucket", "_default", "_default")
+			index.StorageMode = common.MemoryOptimized
+			index.MemUsage = size
+			index.DataSize = size
+			node.Indexes = append(node.Indexes, index)
+			indexes = append(indexes, index)
+		}
+		sizing.ComputeIndexerSize(node)
+		nodes = append(nodes, node)
+	}
+
+	constraint := newIndexerConstraint(1<<40, 1<<10, false, len(nodes), -1, -1)
+	s := newSolution(constraint, sizing, nodes, false, false, true)
+	for _, indexer := range s.Placement {
+		for _, index := range indexer.Indexes {
+			index.initialNode = indexer
+		}
+	}
+
+	cost := newUsageBasedCostMethod(constraint, 1, 1, 1)
+	placement := newRandomPlacement(indexes, false, false)
+	return newSAPlanner(cost, constraint, placement, sizing), s
+}
+
+func findTestIndex(s *Solution, name string) (*IndexerNode, *IndexUsage) {
+	for _, indexer := range s.Placement {
+		for _, index := range indexer.Indexes {
+			if index.Name == name {
+				return indexer, index
+			}
+		}
+	}
+	return nil, nil
+}
+
+func moveTestIndex(t *testing.T, s *Solution, name string, target int) {
+	indexer, index := findTestIndex(s, name)
+	if index == nil {
+		t.Fatalf("index %v not found", name)
+	}
+	s.moveIndex(indexer, index, s.Placement[target], false)
+}
+
+func checkTestIndex(t *testing.T, s *Solution, name string, expected int) {
+	indexer, _ := findTestIndex(s, name)
+	if indexer == nil || indexer.NodeId != fmt.Sprintf("n%v", expected) {
+		t.Fatalf("index %v: expected on n%v, found on %v", name, expected, indexer)
+	}
+}
+
+func TestRevertUnneededMovement(t *testing.T) {
+
+	// n0 {idx1, idx2}, n1 {idx3, idx4}, n2 is added
+	p, s := newTestSolution([][]uint64{{100, 100}, {100, 100}, {}})
+
+	// idx1 moves to the new node, which balances the cluster, but
+	// idx3 also moves to n0 without making it more balanced.
+	moveTestIndex(t, s, "idx1", 2)
+	moveTestIndex(t, s, "idx3", 0)
+
+	p.revertUnneededMovement(s)
+
+	checkTestIndex(t, s, "idx1", 2)
+	checkTestIndex(t, s, "idx2", 0)
+	checkTestIndex(t, s, "idx3", 1)
+	checkTestIndex(t, s, "idx4", 1)
+
+	if p.Score != p.cost.Cost(s) {
+		t.Fatalf("score %v is not the cost of the solution %v", p.Score, p.cost.Cost(s))
+	}
+}
+
+func TestRevertUnneededMovementDeletedNode(t *testing.T) {
+
+	// n0 {idx1} is removed, n1 {idx2}
+	p, s := newTestSolution([][]uint64{{100}, {100}})
+	s.Placement[0].isDelete = true
+
+	moveTestIndex(t, s, "idx1", 1)
+
+	p.revertUnneededMovement(s)
+
+	checkTestIndex(t, s, "idx1", 1)
+	checkTestIndex(t, s, "idx2", 1)
+}
+
+func TestRevertUnneededMovementNoop(t *testing.T) {
+
+	p, s := newTestSolution([][]uint64{{100, 200}, {300}})
+
+	p.revertUnneededMovement(s)
+
+	checkTestIndex(t, s, "idx1", 0)
+	checkTestIndex(t, s, "idx2", 0)
+	checkTestIndex(t, s, "idx3", 1)
+}
+
+func TestSwapRebalance(t *testing.T) {
+
+	// n0 {idx1, idx2} is replaced by n2
+	p, s := newTestSolution([][]uint64{{100, 100}, {100}, {}})
+	s.Placement[0].isDelete = true
+	s = p.adjustInitialSolutionIfNecessary(s)
+
+	swapped := p.swapRebalance(s)
+	if swapped == nil {
+		t.Fatal("expected swap rebalance")
+	}
+
+	checkTestIndex(t, swapped, "idx1", 2)
+	checkTestIndex(t, swapped, "idx2", 2)
+	checkTestIndex(t, swapped, "idx3", 1)
+}
+
+func TestSwapRebalanceCapacity(t *testing.T) {
+
+	p, s := newTestSolution([][]uint64{{100}, {100}, {}})
+	s.Placement[0].isDelete = true
+	s.Placement[0].ActualCpuCore = 16
+	s.Placement[2].ActualCpuCore = 8
+	s = p.adjustInitialSolutionIfNecessary(s)
+
+	if swapped := p.swapRebalance(s); swapped != nil {
+		t.Fatal("unexpected swap rebalance to a node with less cpu")
+	}
+}
+
+func TestSwapRebalanceLostReplica(t *testing.T) {
+
+	// n0 {idx1} is replaced by n2, and idx3 is being rebuilt on n1
+	p, s := newTestSolution([][]uint64{{100}, {100, 50}, {}, {50}})
+	s.Placement[0].isDelete = true
+	_, rebuilt := findTestIndex(s, "idx3")
+	rebuilt.initialNode = nil
+	s = p.adjustInitialSolutionIfNecessary(s)
+
+	swapped := p.swapRebalance(s)
+	if swapped == nil {
+		t.Fatal("expected swap rebalance")
+	}
+
+	checkTestIndex(t, swapped, "idx1", 2)
+	checkTestIndex(t, swapped, "idx2", 1)
+	checkTestIndex(t, swapped, "idx3", 3)
+	checkTestIndex(t, swapped, "idx4", 3)
+}
+
+func TestSameCapacity(t *testing.T) {
+
+	node := func(cores, mem uint64) *IndexerNode {
+		return &IndexerNode{ActualCpuCore: cores, ActualMemTotal: mem}
+	}
+
+	tests := []struct {
+		source, target *IndexerNode
+		same           bool
+	}{
+		{node(0, 0), node(0, 0), true},
+		{node(8, 64<<30), node(8, 64<<30), true},
+		{node(8, 64<<30), node(8, 63<<30), true},
+		{node(8, 64<<30), node(8, 32<<30), false},
+		{node(8, 64<<30), node(16, 64<<30), false},
+		{node(8, 64<<30), node(8, 0), false},
+	}
+
+	for i, test := range tests {
+		if same := sameCapacity(test.source, test.target); same != test.same {
+			t.Fatalf("test %v: expected %v, got %v", i, test.same, same)
+		}
+	}
+}
+
+func TestValidateMoveIndex(t *testing.T) {
+
+	// replica 0 and 1 of index 1 on n0 and n1, and n2 over the quota
+	newPlan := func() *Plan {
+		_, s := newTestSolution([][]uint64{{100}, {100}, {1 << 50}, {}})
+		for i := 0; i < 2; i++ {
+			index := s.Placement[i].Indexes[0]
+			index.DefnId = 1
+			index.Instance = &common.IndexInst{InstId: index.InstId, ReplicaId: i}
+		}
+		return &Plan{Placement: s.Placement, MemQuota: 1 << 30, CpuQuota: 8}
+	}
+
+	// move replica 1 to an empty node
+	if err := validateMoveIndex(newPlan(), 1, map[int]string{1: "tempNodeUUID_n3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// move replica 1 to the node with replica 0
+	if err := validateMoveIndex(newPlan(), 1, map[int]string{1: "tempNodeUUID_n0"}); err == nil {
+		t.Fatal("expected error for replicas on the same node")
+	}
+
+	// swap the replicas
+	if err := validateMoveIndex(newPlan(), 1, map[int]string{0: "tempNodeUUID_n1", 1: "tempNodeUUID_n0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// resource constraints are not enforced
+	if err := validateMoveIndex(newPlan(), 1, map[int]string{1: "tempNodeUUID_n2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := newPlan()
+	plan.Placement[3].isDelete = true
+	if err := validateMoveIndex(plan, 1, map[int]string{1: "tempNodeUUID_n3"}); err == nil {
+		t.Fatal("expected error for node being removed")
+	}
+
+	if err := validateMoveIndex(newPlan(), 1, map[int]string{2: "tempNodeUUID_n3"}); err == nil {
+		t.Fatal("expected error for unknown replica")
+	}
+
+	if err := validateMoveIndex(newPlan(), 1, map[int]string{1: "unknown"}); err == nil {
+		t.Fatal("expected error for unknown node")
+	}
+}
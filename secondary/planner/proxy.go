@@ -119,6 +119,13 @@ func RetrievePlanFromCluster(clusterUrl string, hosts []string) (*Plan, error) {
 		UsedReplicaIdMap: replicaMap,
 	}
 
+	// The planner setting is applied to the plan if it is set on any indexer node
+	for _, indexer := range indexers {
+		if indexer.minimizeMovement {
+			plan.MinimizeMovement = true
+		}
+	}
+
 	err = getIndexStats(plan, config)
 	if err != nil {
 		return nil, err
@@ -206,6 +213,7 @@ func getIndexLayout(config common.Config, hosts []string) ([]*IndexerNode, error
 		node.IndexerId = localMeta.IndexerId
 		node.StorageMode = localMeta.StorageMode
 		node.exclude = localMeta.LocalSettings["excludeNode"]
+		node.minimizeMovement = localMeta.LocalSettings["minimizeMovement"] == "true"
 
 		// convert from LocalIndexMetadata to IndexUsage
 		indexes, err := ConvertToIndexUsages(config, localMeta, node)
@@ -460,12 +468,14 @@ func getIndexStats(plan *Plan, config common.Config) error {
 		}
 
 		// cpu core in host.   This is the actual num of cpu core, not cpu quota.
-		/*
-			var actualCpuCore uint64
-			if cpuCore, ok := statsMap["num_cpu_core"]; ok {
-				actualCpuCore = uint64(cpuCore.(float64))
-			}
-		*/
+		if cpuCore, ok := statsMap["num_cpu_core"]; ok {
+			indexer.ActualCpuCore = uint64(cpuCore.(float64))
+		}
+
+		// memory_total is the memory of the host.
+		if memTotal, ok := statsMap["memory_total"]; ok {
+			indexer.ActualMemTotal = uint64(memTotal.(float64))
+		}
 
 		// cpu utilization for the indexer process
 		var actualCpuUtil float64
@@ -675,7 +685,7 @@ func getIndexStats(plan *Plan, config common.Config) error {
 			// 3) For MOI, min memory is the same as actual memory usage
 
 			minRatio := config["indexer.planner.minResidentRatio"].Float64()
-			if index.StorageMode == common.MemDB || index.StorageMode == common.MemoryOptimized {
+			if index.IsMOI() {
 				minRatio = 1.0
 			}
 
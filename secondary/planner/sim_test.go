@@ -52,6 +52,7 @@ var gDataCostWeight float64
 var gCpuCostWeight float64
 var gMemCostWeight float64
 var gGenStmt string
+var gMinimizeMove bool
 
 //////////////////////////////////////////////////////////////
 // Manual Simulation Test
@@ -90,6 +91,7 @@ func init() {
 	// rebalance
 	flag.IntVar(&gShuffle, "shuffle", 0, "percentage of index to shuffle in the initial index layout. Use with arugment 'plan'.")
 	flag.BoolVar(&gAllowSwap, "allowSwap", true, "flag to tell if planner can swap index between nodes during planning.")
+	flag.BoolVar(&gMinimizeMove, "minimizeMovement", false, "flag to tell if planner should revert index movement not needed for balance.")
 
 	// placement
 	flag.BoolVar(&gAllowMove, "allowMove", false, "flag to tell if planner can move existing index (on initial layout) when placing new index.")
@@ -181,6 +183,7 @@ func TestSimulation(t *testing.T) {
 		CpuCostWeight:  gCpuCostWeight,
 		MemCostWeight:  gMemCostWeight,
 		AllowUnpin:     gAllowUnpin,
+		MinimizeMove:   gMinimizeMove,
 	}
 
 	if err := s.RunSimulation(gIteration, config, CommandType(gCommand), spec, plan, indexSpecs); err != nil {
@@ -40,6 +40,10 @@ func (p *Projector) mainAdminPort(reqch chan ap.Request) {
 	p.admind.Register(reqStats)
 	p.admind.RegisterHTTPHandler("/stats", p.handleStats)
 	p.admind.RegisterHTTPHandler("/settings", p.handleSettings)
+	p.admind.RegisterHTTPHandler("/vbseqnos", p.handleVbSeqnos)
+	p.admind.RegisterHTTPHandler("/feed/pause", p.handleFeedControl)
+	p.admind.RegisterHTTPHandler("/feed/resume", p.handleFeedControl)
+	p.admind.RegisterHTTPHandler("/feed/drain", p.handleFeedControl)
 
 	// debug pprof hanlders.
 	p.admind.RegisterHTTPHandler("/debug/pprof", c.PProfHandler)
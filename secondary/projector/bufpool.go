@@ -0,0 +1,152 @@
+package projector
+
+import (
+	"sync/atomic"
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/stats"
+)
+
+// bufferPool accounts for, and pools, collatejson encode buffers of all
+// vbucket workers in the projector.
+//
+// Every worker holds one buffer of at least baseSize bytes. Buffers grow
+// while encoding large documents, the grown buffer is retained by the
+// worker only if it does not exceed maxSize and both the projector-wide
+// quota and the quota of the worker's topic allow it, otherwise it is left
+// for the garbage collector. Retained
+// buffers are shrunk back to baseSize once every shrinkInterval.
+type bufferPool struct {
+	baseSize       int64 // atomic
+	maxSize        int64 // atomic
+	quota          int64 // atomic, 0 disables quota
+	shrinkInterval int64 // atomic, in nanoseconds
+
+	free chan []byte // idle buffers of baseSize
+
+	used   stats.Int64Val  // bytes held by workers and the free list
+	capped stats.Uint64Val // grown buffers not retained
+	shrunk stats.Uint64Val // retained buffers shrunk back to baseSize
+}
+
+func newBufferPool(config c.Config) *bufferPool {
+	p := &bufferPool{
+		free: make(chan []byte, config["projector.encodeBufPoolSize"].Int()),
+	}
+	p.used.Init()
+	p.capped.Init()
+	p.shrunk.Init()
+	p.ResetConfig(config)
+	return p
+}
+
+// ResetConfig accepts a full-set or subset of global configuration.
+func (p *bufferPool) ResetConfig(config c.Config) {
+	if cv, ok := config["projector.encodeBufSize"]; ok {
+		atomic.StoreInt64(&p.baseSize, int64(cv.Int()))
+	}
+	if cv, ok := config["projector.encodeBufMaxSize"]; ok {
+		atomic.StoreInt64(&p.maxSize, int64(cv.Int()))
+	}
+	if cv, ok := config["projector.encodeBufQuota"]; ok {
+		atomic.StoreInt64(&p.quota, int64(cv.Int()))
+	}
+	if cv, ok := config["projector.encodeBufShrinkInterval"]; ok {
+		interval := time.Duration(cv.Int()) * time.Millisecond
+		atomic.StoreInt64(&p.shrinkInterval, int64(interval))
+	}
+}
+
+// Get an encode buffer of baseSize for a worker of topic `mem`. A worker
+// always gets a buffer, even if that exceeds the quota.
+func (p *bufferPool) Get(mem *topicMemory) []byte {
+	baseSize := atomic.LoadInt64(&p.baseSize)
+	mem.AddBuf(baseSize)
+	for {
+		select {
+		case buf := <-p.free:
+			if int64(cap(buf)) == baseSize {
+				return buf[:0]
+			}
+			p.used.Add(-int64(cap(buf))) // baseSize was reconfigured
+		default:
+			p.used.Add(baseSize)
+			return make([]byte, 0, baseSize)
+		}
+	}
+}
+
+// Put back a buffer obtained from Get(), once the worker is done with it.
+func (p *bufferPool) Put(buf []byte, mem *topicMemory) {
+	mem.AddBuf(-int64(cap(buf)))
+	if int64(cap(buf)) == atomic.LoadInt64(&p.baseSize) {
+		select {
+		case p.free <- buf[:0]:
+			return
+		default:
+		}
+	}
+	p.used.Add(-int64(cap(buf)))
+}
+
+// Retain returns the buffer a worker should hold on to after encoding
+// grew `buf` into `grown`.
+func (p *bufferPool) Retain(buf, grown []byte, mem *topicMemory) []byte {
+	if cap(grown) <= cap(buf) {
+		return buf
+	}
+	if int64(cap(grown)) > atomic.LoadInt64(&p.maxSize) {
+		p.capped.Add(1)
+		return buf
+	}
+	delta := int64(cap(grown) - cap(buf))
+	if !mem.ReserveBuf(delta) {
+		p.capped.Add(1)
+		return buf
+	}
+	for {
+		used, quota := p.used.Value(), atomic.LoadInt64(&p.quota)
+		if quota > 0 && used+delta > quota {
+			mem.AddBuf(-delta)
+			p.capped.Add(1)
+			return buf
+		}
+		if p.used.CAS(used, used+delta) {
+			return grown[:0]
+		}
+	}
+}
+
+// Shrink a retained buffer back to baseSize, if `lastShrink` is older
+// than shrinkInterval. Returns the buffer to use and the time of the
+// last shrink.
+func (p *bufferPool) Shrink(
+	buf []byte, lastShrink time.Time, mem *topicMemory) ([]byte, time.Time) {
+
+	interval := time.Duration(atomic.LoadInt64(&p.shrinkInterval))
+	if interval <= 0 || time.Since(lastShrink) < interval {
+		return buf, lastShrink
+	}
+	baseSize := atomic.LoadInt64(&p.baseSize)
+	if int64(cap(buf)) <= baseSize {
+		return buf, time.Now()
+	}
+	p.used.Add(baseSize - int64(cap(buf)))
+	mem.AddBuf(baseSize - int64(cap(buf)))
+	p.shrunk.Add(1)
+	return make([]byte, 0, baseSize), time.Now()
+}
+
+// Map returns buffer pool statistics.
+func (p *bufferPool) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"baseSize": float64(atomic.LoadInt64(&p.baseSize)),
+		"maxSize":  float64(atomic.LoadInt64(&p.maxSize)),
+		"quota":    float64(atomic.LoadInt64(&p.quota)),
+		"used":     float64(p.used.Value()),
+		"free":     float64(len(p.free)),
+		"capped":   float64(p.capped.Value()),
+		"shrunk":   float64(p.shrunk.Value()),
+	}
+}
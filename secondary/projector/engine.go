@@ -100,10 +100,11 @@ func (engine *Engine) StreamEndData(
 func (engine *Engine) TransformRoute(
 	vbuuid uint64, m *mc.DcpEvent, data map[string]interface{}, encodeBuf []byte,
 	docval qvalue.AnnotatedValue, context qexpr.Context,
-	numIndexes int, opaque2 uint64) ([]byte, error) {
+	numIndexes int, opaque2 uint64, evalCache *c.EvalCache) ([]byte, error) {
 
 	return engine.evaluator.TransformRoute(
 		vbuuid, m, data, encodeBuf, docval, context, numIndexes, opaque2,
+		evalCache,
 	)
 }
 
@@ -2,6 +2,7 @@ package projector
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"time"
 
@@ -75,6 +76,9 @@ type Feed struct {
 	// Collections
 	collectionsAware bool
 	osoSnapshot      map[string]bool //keyspaceId -> osoSnapshot
+	// DCP collection filter applied on keyspace wide streams,
+	// keyspaceId -> collectionId -> true
+	collFilters map[string]map[string]bool
 
 	// config params
 	reqTimeout time.Duration
@@ -82,6 +86,12 @@ type Feed struct {
 	epFactory  c.RouterEndpointFactory
 	config     c.Config
 	logPrefix  string
+
+	throttle *throttler   // egress bandwidth limit for this topic
+	memory   *topicMemory // memory quota for this topic
+
+	// paused or drained feeds do not pull mutations from upstream.
+	paused bool
 }
 
 // NewFeed creates a new topic feed.
@@ -111,6 +121,7 @@ func NewFeed(
 		async:     async,
 
 		osoSnapshot: make(map[string]bool),
+		collFilters: make(map[string]map[string]bool),
 
 		// upstream
 		reqTss:  make(map[string]*protobuf.TsVbuuid),
@@ -133,6 +144,20 @@ func NewFeed(
 	}
 	feed.logPrefix = fmt.Sprintf("FEED[<=>%v(%v)]", topic, feed.cluster)
 
+	rate, err := topicBandwidth(config, topic)
+	if err != nil {
+		fmsg := "%v ##%x topicBandwidth: %v, throttling disabled\n"
+		logging.Errorf(fmsg, feed.logPrefix, opaque, err)
+	}
+	feed.throttle = newThrottler(rate)
+
+	mutQuota, bufQuota, err := topicMemoryQuotas(config, topic)
+	if err != nil {
+		fmsg := "%v ##%x topicMemoryQuotas: %v, memory quota disabled\n"
+		logging.Errorf(fmsg, feed.logPrefix, opaque, err)
+	}
+	feed.memory = newTopicMemory(mutQuota, bufQuota)
+
 	go feed.genServer()
 	logging.Infof("%v ##%x feed started ...\n", feed.logPrefix, opaque)
 	return feed, nil
@@ -160,6 +185,10 @@ const (
 	fCmdResetConfig
 	fCmdDeleteEndpoint
 	fCmdPing
+	fCmdGetVbSeqnos
+	fCmdPause
+	fCmdResume
+	fCmdDrain
 )
 
 // ResetConfig for this feed.
@@ -380,6 +409,50 @@ func (feed *Feed) Ping() error {
 	return err
 }
 
+// GetVbucketSeqnos returns the progress of vbuckets for `keyspaceId`, or
+// for all keyspaces of this feed if `keyspaceId` is empty.
+// Synchronous call.
+func (feed *Feed) GetVbucketSeqnos(
+	keyspaceId string) (map[string][]*VbucketSeqnos, error) {
+
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{fCmdGetVbSeqnos, keyspaceId, respch}
+	resp, err := c.FailsafeOp(feed.reqch, respch, cmd, feed.finch)
+	if err = c.OpError(err, resp, 1); err != nil {
+		return nil, err
+	}
+	return resp[0].(map[string][]*VbucketSeqnos), nil
+}
+
+// Pause pulling mutations from DCP for all keyspaces of this feed, while
+// retaining vbucket streams and downstream connections.
+// Synchronous call.
+func (feed *Feed) Pause() error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{fCmdPause, respch}
+	resp, err := c.FailsafeOp(feed.reqch, respch, cmd, feed.finch)
+	return c.OpError(err, resp, 0)
+}
+
+// Resume a paused or drained feed.
+// Synchronous call.
+func (feed *Feed) Resume() error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{fCmdResume, respch}
+	resp, err := c.FailsafeOp(feed.reqch, respch, cmd, feed.finch)
+	return c.OpError(err, resp, 0)
+}
+
+// Drain pauses the feed and flushes all mutations pulled so far to
+// endpoints, after which the feed stays quiesced until resumed.
+// Synchronous call.
+func (feed *Feed) Drain() error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{fCmdDrain, respch}
+	resp, err := c.FailsafeOp(feed.reqch, respch, cmd, feed.finch)
+	return c.OpError(err, resp, 0)
+}
+
 type controlStreamRequest struct {
 	keyspaceId string
 	opaque     uint16
@@ -862,6 +935,24 @@ func (feed *Feed) handleCommand(msg []interface{}) (status string) {
 	case fCmdPing:
 		respch := msg[1].(chan []interface{})
 		respch <- []interface{}{true}
+
+	case fCmdGetVbSeqnos:
+		keyspaceId := msg[1].(string)
+		respch := msg[2].(chan []interface{})
+		seqnos, err := feed.getVbucketSeqnos(keyspaceId)
+		respch <- []interface{}{seqnos, err}
+
+	case fCmdPause:
+		respch := msg[1].(chan []interface{})
+		respch <- []interface{}{feed.pause(true)}
+
+	case fCmdResume:
+		respch := msg[1].(chan []interface{})
+		respch <- []interface{}{feed.pause(false)}
+
+	case fCmdDrain:
+		respch := msg[1].(chan []interface{})
+		respch <- []interface{}{feed.drain()}
 	}
 	return status
 }
@@ -945,7 +1036,8 @@ func (feed *Feed) start(
 		kvdata.AddEngines(opaque, engines, feed.endpoints)
 		feed.kvdata[keyspaceId] = kvdata // :SideEffect:
 		// start upstream, after filtering out vbuckets.
-		e = feed.bucketFeed(opaque, false, true, ts, feeder)
+		filterTs := feed.withCollectionFilter(keyspaceId, ts)
+		e = feed.bucketFeed(opaque, false, true, filterTs, feeder)
 		if e != nil { // all feed errors are fatal, skip this bucket.
 			err = e
 			feed.cleanupKeyspace(keyspaceId, false)
@@ -1069,7 +1161,8 @@ func (feed *Feed) restartVbuckets(
 
 		feed.kvdata[keyspaceId] = kvdata // :SideEffect:
 		// (re)start the upstream, after filtering out remote vbuckets.
-		e = feed.bucketFeed(opaque, false, true, ts, feeder)
+		filterTs := feed.withCollectionFilter(keyspaceId, ts)
+		e = feed.bucketFeed(opaque, false, true, filterTs, feeder)
 		if e != nil { // all feed errors are fatal, skip this bucket.
 			err = e
 			feed.cleanupKeyspace(keyspaceId, false)
@@ -1268,7 +1361,8 @@ func (feed *Feed) addBuckets(
 		kvdata.AddEngines(opaque, engines, feed.endpoints)
 		feed.kvdata[keyspaceId] = kvdata // :SideEffect:
 		// start upstream
-		e = feed.bucketFeed(opaque, false, true, ts, feeder)
+		filterTs := feed.withCollectionFilter(keyspaceId, ts)
+		e = feed.bucketFeed(opaque, false, true, filterTs, feeder)
 		if e != nil { // all feed errors are fatal, skip this bucket.
 			err = e
 			feed.cleanupKeyspace(keyspaceId, false)
@@ -1361,6 +1455,7 @@ func (feed *Feed) addInstances(
 			}
 			tsResp = tsResp.AddCurrentTimestamp(feed.pooln, bucketn, curSeqnos)
 			tsResp.AddKeyspaceId(keyspaceId)
+			feed.refreshCollectionFilter(opaque, keyspaceId)
 
 		} else {
 			fmsg := "%v ##%x addInstances() invalid-keyspace %q\n"
@@ -1501,9 +1596,104 @@ func (feed *Feed) getStatistics() c.Statistics {
 		endStats.Set(raddr, endpoint.GetStatistics())
 	}
 	stats.Set("endpoints", endStats)
+	stats.Set("throttle", feed.throttle.Map())
+	stats.Set("memory", feed.memory.Map())
+	stats.Set("paused", feed.paused)
 	return stats
 }
 
+// pause or resume pulling mutations for all keyspaces.
+func (feed *Feed) pause(paused bool) (err error) {
+	for keyspaceId, kvdata := range feed.kvdata {
+		if paused {
+			err = kvdata.Pause()
+		} else {
+			err = kvdata.Resume()
+		}
+		if err != nil {
+			fmsg := "%v ##%x pause(%v) keyspace %v: %v\n"
+			logging.Errorf(fmsg, feed.logPrefix, feed.opaque, paused, keyspaceId, err)
+			return err
+		}
+	}
+	feed.paused = paused
+	logging.Infof("%v ##%x paused: %v\n", feed.logPrefix, feed.opaque, paused)
+	return nil
+}
+
+// drain all keyspaces and flush endpoints.
+func (feed *Feed) drain() error {
+	feed.paused = true
+	for keyspaceId, kvdata := range feed.kvdata {
+		if err := kvdata.Drain(); err != nil {
+			fmsg := "%v ##%x drain keyspace %v: %v\n"
+			logging.Errorf(fmsg, feed.logPrefix, feed.opaque, keyspaceId, err)
+			return err
+		}
+	}
+	for raddr, endpoint := range feed.endpoints {
+		if err := endpoint.Flush(); err != nil {
+			fmsg := "%v ##%x flush endpoint %q: %v\n"
+			logging.Errorf(fmsg, feed.logPrefix, feed.opaque, raddr, err)
+			return err
+		}
+	}
+	logging.Infof("%v ##%x drained\n", feed.logPrefix, feed.opaque)
+	return nil
+}
+
+func (feed *Feed) getVbucketSeqnos(
+	keyspaceId string) (map[string][]*VbucketSeqnos, error) {
+
+	seqnos := make(map[string][]*VbucketSeqnos)
+	for kid, kvdata := range feed.kvdata {
+		if keyspaceId != "" && kid != keyspaceId {
+			continue
+		}
+		vbseqnos, err := kvdata.GetVbucketSeqnos()
+		if err != nil {
+			fmsg := "%v ##%x GetVbucketSeqnos(%v): %v\n"
+			logging.Errorf(fmsg, feed.logPrefix, feed.opaque, kid, err)
+			return nil, err
+		}
+		seqnos[kid] = vbseqnos
+	}
+	return seqnos, nil
+}
+
+// numDcpConnections returns the number of DCP connections per KV node for
+// the keyspaces of this topic, from dcp.topicConnections if the topic has
+// an entry, else dcp.numConnections.
+func (feed *Feed) numDcpConnections() int {
+	conns, err := topicConnections(feed.config, feed.topic)
+	if err != nil {
+		fmsg := "%v topicConnections: %v, using dcp.numConnections\n"
+		logging.Errorf(fmsg, feed.logPrefix, err)
+	} else if conns > 0 {
+		return conns
+	}
+	return feed.config["dcp.numConnections"].Int()
+}
+
+// topicConnections returns the number of DCP connections per KV node
+// configured for topic, picking the entry with the longest matching prefix,
+// or 0 if none matches.
+func topicConnections(config c.Config, topic string) (int, error) {
+	cv, ok := config["dcp.topicConnections"]
+	if !ok {
+		return 0, nil
+	}
+	conns, err := c.ParseTopicConnections(cv.String())
+	if err != nil {
+		return 0, err
+	}
+	values := make(map[string]int64, len(conns))
+	for prefix, n := range conns {
+		values[prefix] = int64(n)
+	}
+	return int(longestPrefixValue(values, topic)), nil
+}
+
 func (feed *Feed) resetConfig(config c.Config) {
 	if cv, ok := config["feedWaitStreamReqTimeout"]; ok {
 		feed.reqTimeout = time.Duration(cv.Int())
@@ -1511,6 +1701,32 @@ func (feed *Feed) resetConfig(config c.Config) {
 	if cv, ok := config["feedWaitStreamEndTimeout"]; ok {
 		feed.endTimeout = time.Duration(cv.Int())
 	}
+	if _, ok := config["throttle.topicBandwidth"]; ok {
+		if rate, err := topicBandwidth(config, feed.topic); err != nil {
+			fmsg := "%v topicBandwidth: %v, retaining %v bytes/sec\n"
+			logging.Errorf(fmsg, feed.logPrefix, err, feed.throttle.Rate())
+		} else {
+			feed.throttle.SetRate(rate)
+			fmsg := "%v egress bandwidth set to %v bytes/sec\n"
+			logging.Infof(fmsg, feed.logPrefix, rate)
+		}
+	}
+	_, ok1 := config["memory.topicMutationQuota"]
+	_, ok2 := config["memory.topicEncodeBufQuota"]
+	if ok1 || ok2 {
+		mutQuota, bufQuota, err := topicMemoryQuotas(config, feed.topic)
+		if err != nil {
+			mutQuota, bufQuota = feed.memory.Quotas()
+			fmsg := "%v topicMemoryQuotas: %v, retaining %v mutation bytes, " +
+				"%v encode buffer bytes\n"
+			logging.Errorf(fmsg, feed.logPrefix, err, mutQuota, bufQuota)
+		} else {
+			feed.memory.SetQuotas(mutQuota, bufQuota)
+			fmsg := "%v memory quota set to %v mutation bytes, " +
+				"%v encode buffer bytes\n"
+			logging.Infof(fmsg, feed.logPrefix, mutQuota, bufQuota)
+		}
+	}
 	// pass the configuration to active kvdata
 	for _, kvdata := range feed.kvdata {
 		kvdata.ResetConfig(config)
@@ -1563,9 +1779,10 @@ func (feed *Feed) cleanupKeyspace(keyspaceId string, enginesOk bool) {
 	if enginesOk {
 		delete(feed.engines, keyspaceId) // :SideEffect:
 	}
-	delete(feed.reqTss, keyspaceId)  // :SideEffect:
-	delete(feed.actTss, keyspaceId)  // :SideEffect:
-	delete(feed.rollTss, keyspaceId) // :SideEffect:
+	delete(feed.reqTss, keyspaceId)      // :SideEffect:
+	delete(feed.actTss, keyspaceId)      // :SideEffect:
+	delete(feed.rollTss, keyspaceId)     // :SideEffect:
+	delete(feed.collFilters, keyspaceId) // :SideEffect:
 	// close upstream
 	feeder, ok := feed.feeders[keyspaceId]
 	if ok {
@@ -1622,7 +1839,11 @@ func (feed *Feed) openFeeder(
 	dcpConfig := map[string]interface{}{
 		"genChanSize":      feed.config["dcp.genChanSize"].Int(),
 		"dataChanSize":     feed.config["dcp.dataChanSize"].Int(),
-		"numConnections":   feed.config["dcp.numConnections"].Int(),
+		"numConnections":   feed.numDcpConnections(),
+		"vbucketSharding":  feed.config["dcp.vbucketSharding"].String(),
+		"minBufferSize":    feed.config["dcp.minBufferSize"].Int(),
+		"maxBufferSize":    feed.config["dcp.maxBufferSize"].Int(),
+		"bufferSizeTick":   feed.config["dcp.bufferSizeTick"].Int(),
 		"latencyTick":      feed.config["dcp.latencyTick"].Int(),
 		"activeVbOnly":     feed.config["dcp.activeVbOnly"].Bool(),
 		"collectionsAware": feed.collectionsAware,
@@ -1814,6 +2035,9 @@ func (feed *Feed) startDataPath(
 		kvdata, err = NewKVData(
 			feed, bucketn, keyspaceId, collectionId, opaque, ts, engs, ends, mutch,
 			feed.kvaddr, feed.config, feed.async, opaque2)
+		if err == nil && feed.paused {
+			err = kvdata.Pause()
+		}
 	}
 	return kvdata, err
 }
@@ -2181,6 +2405,91 @@ func (feed *Feed) connectBucket(
 	return bucket, nil
 }
 
+// withCollectionFilter returns reqTs with a DCP collection filter for the
+// collections that have engines on this keyspace, so that workers receive
+// mutations only for indexed collections. Streams that already carry a
+// scope or collection filter, feeds that are not collection aware, and
+// keyspaces with engines on non-collection indexes are left unfiltered.
+func (feed *Feed) withCollectionFilter(
+	keyspaceId string, reqTs *protobuf.TsVbuuid) *protobuf.TsVbuuid {
+
+	cv, ok := feed.config["dcp.collectionFilter"]
+	if !ok || !cv.Bool() || !feed.collectionsAware {
+		return reqTs
+	} else if reqTs.GetScopeID() != "" || len(reqTs.GetCollectionIDs()) > 0 {
+		return reqTs
+	}
+
+	cids := feed.engineCollectionIds(keyspaceId)
+	if len(cids) == 0 {
+		delete(feed.collFilters, keyspaceId)
+		return reqTs
+	}
+
+	filter := make(map[string]bool)
+	for _, cid := range cids {
+		filter[cid] = true
+	}
+	feed.collFilters[keyspaceId] = filter
+
+	filterTs := reqTs.Clone()
+	filterTs.CollectionIDs = cids
+	fmsg := "%v ##%x keyspace %v streams filtered by collections %v\n"
+	logging.Infof(fmsg, feed.logPrefix, feed.opaque, keyspaceId, cids)
+	return filterTs
+}
+
+// engineCollectionIds returns the sorted list of collections that have
+// engines on this keyspace, nil if any of the engines does not belong to
+// a collection.
+func (feed *Feed) engineCollectionIds(keyspaceId string) []string {
+	seen := make(map[string]bool)
+	for _, engine := range feed.engines[keyspaceId] {
+		cid := engine.GetCollectionID()
+		if cid == "" {
+			return nil
+		}
+		seen[cid] = true
+	}
+	cids := make([]string, 0, len(seen))
+	for cid := range seen {
+		cids = append(cids, cid)
+	}
+	sort.Strings(cids)
+	return cids
+}
+
+// refreshCollectionFilter ends the active streams of keyspace if its
+// collection filter does not cover all engines. Downstream will restart
+// the vbuckets, and the restarted streams pick up the widened filter.
+func (feed *Feed) refreshCollectionFilter(opaque uint16, keyspaceId string) {
+	filter, ok := feed.collFilters[keyspaceId]
+	if !ok {
+		return
+	}
+	stale := false
+	for _, engine := range feed.engines[keyspaceId] {
+		if !filter[engine.GetCollectionID()] {
+			stale = true
+			break
+		}
+	}
+	actTs, ok := feed.actTss[keyspaceId]
+	feeder, ok1 := feed.feeders[keyspaceId]
+	if !stale || !ok || !ok1 || actTs.IsEmpty() {
+		return
+	}
+
+	fmsg := "%v ##%x collection filter for %v does not cover new " +
+		"instances, ending streams for restart\n"
+	logging.Infof(fmsg, feed.logPrefix, opaque, keyspaceId)
+	delete(feed.collFilters, keyspaceId)
+	if err := feeder.EndVbStreams(opaque, actTs); err != nil {
+		fmsg := "%v ##%x EndVbStreams(%q): %v"
+		logging.Errorf(fmsg, feed.logPrefix, opaque, keyspaceId, err)
+	}
+}
+
 func getCollectionIdFromReqTs(reqTs *protobuf.TsVbuuid) string {
 	cids := reqTs.GetCollectionIDs()
 	if len(cids) == 0 {
@@ -2220,18 +2529,37 @@ func FeedConfigParams() []string {
 		"encodeBufSize",
 		"routerEndpointFactory",
 		"syncTimeout",
+		"syncAdaptive",
+		"syncMinTimeout",
+		"syncMaxTimeout",
+		"syncBusyRate",
+		"backpressure.maxPause",
+		"updateSeqnoInterval",
+		// throttling
+		"throttle.topicBandwidth",
+		"throttle.keyspaceBandwidth",
+		// memory isolation
+		"memory.topicMutationQuota",
+		"memory.topicEncodeBufQuota",
 		// dcp configuration
 		"dcp.dataChanSize",
 		"dcp.genChanSize",
 		"dcp.numConnections",
+		"dcp.topicConnections",
+		"dcp.vbucketSharding",
+		"dcp.minBufferSize",
+		"dcp.maxBufferSize",
+		"dcp.bufferSizeTick",
 		"dcp.latencyTick",
 		"dcp.activeVbOnly",
+		"dcp.collectionFilter",
 		// dataport
 		"dataport.remoteBlock",
 		"dataport.keyChanSize",
 		"dataport.bufferSize",
 		"dataport.bufferTimeout",
 		"dataport.harakiriTimeout",
-		"dataport.maxPayload"}
+		"dataport.maxPayload",
+		"dataport.compression"}
 	return paramNames
 }
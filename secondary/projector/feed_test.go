@@ -0,0 +1,65 @@
+package projector
+
+import (
+	"testing"
+
+	c "github.com/couchbase/indexing/secondary/common"
+)
+
+func TestTopicConnections(t *testing.T) {
+
+	config := c.SystemConfig.SectionConfig("projector.", true)
+
+	// no entries, dcp.numConnections is used
+	if conns, err := topicConnections(config, "MAINT_STREAM_TOPIC_abc"); err != nil || conns != 0 {
+		t.Fatalf("expected no connections, got %v %v", conns, err)
+	}
+
+	config.SetValue("dcp.topicConnections", "MAINT_STREAM_TOPIC=8, MAINT_STREAM_TOPIC_big=16, INIT=2")
+
+	tests := []struct {
+		topic string
+		conns int
+	}{
+		{"MAINT_STREAM_TOPIC_abc", 8},
+		{"MAINT_STREAM_TOPIC_big_abc", 16},
+		{"INIT_STREAM_TOPIC_abc", 2},
+		{"CATCHUP_STREAM_TOPIC_abc", 0},
+	}
+
+	for _, test := range tests {
+		conns, err := topicConnections(config, test.topic)
+		if err != nil || conns != test.conns {
+			t.Fatalf("%v: expected %v connections, got %v %v", test.topic, test.conns, conns, err)
+		}
+	}
+
+	config.SetValue("dcp.topicConnections", "MAINT_STREAM_TOPIC=10000")
+	if _, err := topicConnections(config, "MAINT_STREAM_TOPIC_abc"); err == nil {
+		t.Fatal("expected error for too many connections")
+	}
+}
+
+func TestNumDcpConnections(t *testing.T) {
+
+	config := c.SystemConfig.SectionConfig("projector.", true)
+	config.SetValue("dcp.numConnections", 4)
+	config.SetValue("dcp.topicConnections", "MAINT_STREAM_TOPIC=8")
+
+	feed := &Feed{topic: "MAINT_STREAM_TOPIC_abc", config: config}
+	if n := feed.numDcpConnections(); n != 8 {
+		t.Fatalf("expected 8 connections, got %v", n)
+	}
+
+	feed.topic = "INIT_STREAM_TOPIC_abc"
+	if n := feed.numDcpConnections(); n != 4 {
+		t.Fatalf("expected 4 connections, got %v", n)
+	}
+
+	// an invalid entry falls back to dcp.numConnections
+	config.SetValue("dcp.topicConnections", "MAINT_STREAM_TOPIC=10000")
+	feed.topic = "MAINT_STREAM_TOPIC_abc"
+	if n := feed.numDcpConnections(); n != 4 {
+		t.Fatalf("expected 4 connections, got %v", n)
+	}
+}
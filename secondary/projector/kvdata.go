@@ -19,6 +19,7 @@ package projector
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -56,8 +57,8 @@ type KVData struct {
 	sbch  chan []interface{}
 	finch chan bool
 	// misc.
-	syncTimeout time.Duration // in milliseconds
-	logPrefix   string
+	sync      *syncPulse // interval between sync pulses
+	logPrefix string
 	// statistics
 	stats     *KvdataStats
 	wrkrStats []interface{}
@@ -65,6 +66,11 @@ type KVData struct {
 	uuid      uint64 // immutable
 	kvaddr    string
 	opaque2   uint64 //client opaque
+
+	throttle *throttler // egress bandwidth limit for this keyspace
+
+	// when paused, mutations are not pulled from upstream.
+	paused bool
 }
 
 type KvdataStats struct {
@@ -247,8 +253,13 @@ func NewKVData(
 
 	fmsg := "KVDT[<-%v<-%v #%v]"
 	kvdata.logPrefix = fmt.Sprintf(fmsg, keyspaceId, feed.cluster, feed.topic)
-	kvdata.syncTimeout = time.Duration(config["syncTimeout"].Int())
-	kvdata.syncTimeout *= time.Millisecond
+	kvdata.sync = newSyncPulse(config)
+	rate, err := keyspaceBandwidth(config, keyspaceId)
+	if err != nil {
+		fmsg := "%v ##%x keyspaceBandwidth: %v, throttling disabled\n"
+		logging.Errorf(fmsg, kvdata.logPrefix, opaque, err)
+	}
+	kvdata.throttle = newThrottler(rate)
 	for uuid, engine := range engines {
 		kvdata.engines[uuid] = engine
 	}
@@ -274,6 +285,10 @@ const (
 	kvCmdGetStats
 	kvCmdResetConfig
 	kvCmdReloadHeartBeat
+	kvCmdGetVbSeqnos
+	kvCmdPause
+	kvCmdResume
+	kvCmdDrain
 	kvCmdClose
 )
 
@@ -322,6 +337,44 @@ func (kvdata *KVData) GetStatistics() map[string]interface{} {
 	return resp[0].(map[string]interface{})
 }
 
+// GetVbucketSeqnos returns the progress of all vbuckets streamed for
+// this keyspace, sorted by vbucket number, synchronous call.
+func (kvdata *KVData) GetVbucketSeqnos() ([]*VbucketSeqnos, error) {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{kvCmdGetVbSeqnos, respch}
+	resp, err := c.FailsafeOp(kvdata.sbch, respch, cmd, kvdata.finch)
+	if err = c.OpError(err, resp, 1); err != nil {
+		return nil, err
+	}
+	return resp[0].([]*VbucketSeqnos), nil
+}
+
+// Pause pulling mutations from upstream, vbucket state and downstream
+// connections are retained, synchronous call.
+func (kvdata *KVData) Pause() error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{kvCmdPause, respch}
+	_, err := c.FailsafeOp(kvdata.sbch, respch, cmd, kvdata.finch)
+	return err
+}
+
+// Resume pulling mutations from upstream, synchronous call.
+func (kvdata *KVData) Resume() error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{kvCmdResume, respch}
+	_, err := c.FailsafeOp(kvdata.sbch, respch, cmd, kvdata.finch)
+	return err
+}
+
+// Drain pauses kvdata and returns after all mutations pulled so far are
+// handed over to endpoints, synchronous call.
+func (kvdata *KVData) Drain() error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{kvCmdDrain, respch}
+	resp, err := c.FailsafeOp(kvdata.sbch, respch, cmd, kvdata.finch)
+	return c.OpError(err, resp, 0)
+}
+
 // ResetConfig for kvdata.
 func (kvdata *KVData) ResetConfig(config c.Config) error {
 	respch := make(chan []interface{}, 1)
@@ -399,9 +452,9 @@ func (kvdata *KVData) runScatter(
 		logging.Infof("%v ##%x ... stopped\n", kvdata.logPrefix, kvdata.opaque)
 	}()
 
-	kvdata.heartBeat = time.After(kvdata.syncTimeout)
+	kvdata.heartBeat = time.After(kvdata.sync.interval)
 	fmsg := "%v ##%x heartbeat (%v) loaded ...\n"
-	logging.Infof(fmsg, kvdata.logPrefix, kvdata.opaque, kvdata.syncTimeout)
+	logging.Infof(fmsg, kvdata.logPrefix, kvdata.opaque, kvdata.sync.interval)
 
 loop:
 	for {
@@ -414,8 +467,13 @@ loop:
 		default:
 		}
 
+		inch := mutch
+		if kvdata.paused {
+			inch = nil // stop pulling, upstream will apply back-pressure.
+		}
+
 		select {
-		case m, ok := <-mutch:
+		case m, ok := <-inch:
 			if ok == false { // upstream has closed
 				break loop
 			}
@@ -522,43 +580,103 @@ func (kvdata *KVData) handleCommand(msg []interface{}, ts *protobuf.TsVbuuid) bo
 		stats.Set("delInsts", float64(kvdata.stats.dinstCount.Value()))
 		stats.Set("tsCount", float64(kvdata.stats.tsCount.Value()))
 		statVbuckets := make(map[string]interface{})
+		statCollections := make(map[string]interface{})
 		for _, worker := range kvdata.workers {
 			if stats, err := worker.GetStatistics(); err != nil {
 				panic(err)
 			} else {
 				for vbno_s, stat := range stats {
+					if vbno_s == "collections" {
+						addCollectionStats(statCollections, stat.(map[string]interface{}))
+						continue
+					}
 					statVbuckets[vbno_s] = stat
 				}
 			}
 		}
 		stats.Set("vbuckets", statVbuckets)
+		stats.Set("collections", statCollections)
+		stats.Set("workers", kvdata.workerStatistics())
+		stats.Set("throttle", kvdata.throttle.Map())
+		stats.Set("sync", kvdata.sync.Map())
+		stats.Set("paused", kvdata.paused)
 		respch <- []interface{}{map[string]interface{}(stats)}
 
 	case kvCmdResetConfig:
 		config, respch := msg[1].(c.Config), msg[2].(chan []interface{})
-		if cv, ok := config["syncTimeout"]; ok {
-			kvdata.syncTimeout = time.Duration(cv.Int())
-			kvdata.syncTimeout *= time.Millisecond
-			logging.Infof(
-				"%v ##%x heart-beat settings reloaded: %v\n",
-				kvdata.logPrefix, kvdata.opaque, kvdata.syncTimeout)
-		}
+		kvdata.sync.resetConfig(config)
+		logging.Infof(
+			"%v ##%x heart-beat settings reloaded: %v\n",
+			kvdata.logPrefix, kvdata.opaque, kvdata.sync.Map())
 		if kvdata.heartBeat != nil {
-			kvdata.heartBeat = time.After(kvdata.syncTimeout)
+			kvdata.heartBeat = time.After(kvdata.sync.interval)
 		}
-		for _, worker := range kvdata.workers {
-			if err := worker.ResetConfig(config); err != nil {
-				panic(err)
+		if _, ok := config["throttle.keyspaceBandwidth"]; ok {
+			rate, err := keyspaceBandwidth(config, kvdata.keyspaceId)
+			if err != nil {
+				fmsg := "%v ##%x keyspaceBandwidth: %v, retaining %v bytes/sec\n"
+				logging.Errorf(fmsg, kvdata.logPrefix, kvdata.opaque, err, kvdata.throttle.Rate())
+			} else {
+				kvdata.throttle.SetRate(rate)
+				fmsg := "%v ##%x egress bandwidth set to %v bytes/sec\n"
+				logging.Infof(fmsg, kvdata.logPrefix, kvdata.opaque, rate)
 			}
 		}
+		resize := kvdata.workerConfigChanged(config)
 		kvdata.config = kvdata.config.Override(config)
+		if resize {
+			kvdata.resizeWorkers()
+		}
 		respch <- []interface{}{nil}
 
 	case kvCmdReloadHeartBeat:
 		respch := msg[1].(chan []interface{})
-		kvdata.heartBeat = time.After(kvdata.syncTimeout)
+		interval := kvdata.sync.next(kvdata.stats.eventCount.Value())
+		kvdata.heartBeat = time.After(interval)
+		respch <- []interface{}{nil}
+
+	case kvCmdGetVbSeqnos:
+		respch := msg[1].(chan []interface{})
+		seqnos := make([]*VbucketSeqnos, 0)
+		for _, worker := range kvdata.workers {
+			vbseqnos, err := worker.GetVbucketSeqnos()
+			if err != nil {
+				respch <- []interface{}{nil, err}
+				return false
+			}
+			seqnos = append(seqnos, vbseqnos...)
+		}
+		for _, vbs := range seqnos {
+			vbs.Received = kvdata.stats.vbseqnos[vbs.Vbno].Value()
+			if vbs.Received > vbs.Forwarded {
+				vbs.Lag = vbs.Received - vbs.Forwarded
+			}
+		}
+		sort.Slice(seqnos, func(i, j int) bool {
+			return seqnos[i].Vbno < seqnos[j].Vbno
+		})
+		respch <- []interface{}{seqnos, nil}
+
+	case kvCmdPause, kvCmdResume:
+		kvdata.paused = cmd == kvCmdPause
+		fmsg := "%v ##%x paused: %v\n"
+		logging.Infof(fmsg, kvdata.logPrefix, kvdata.opaque, kvdata.paused)
+		respch := msg[1].(chan []interface{})
 		respch <- []interface{}{nil}
 
+	case kvCmdDrain:
+		kvdata.paused = true
+		respch := msg[1].(chan []interface{})
+		var err error
+		for _, worker := range kvdata.workers {
+			if err = worker.Drain(); err != nil {
+				break
+			}
+		}
+		fmsg := "%v ##%x drained: %v\n"
+		logging.Infof(fmsg, kvdata.logPrefix, kvdata.opaque, err)
+		respch <- []interface{}{err}
+
 	case kvCmdClose:
 		for _, worker := range kvdata.workers {
 			worker.Close()
@@ -708,11 +826,74 @@ func (kvdata *KVData) spawnWorkers(
 	nworkers := config["vbucketWorkers"].Int()
 	workers := make([]*VbucketWorker, nworkers)
 	for i := 0; i < nworkers; i++ {
-		workers[i] = NewVbucketWorker(i, feed, bucket, keyspaceId, opaque, config, opaque2)
+		workers[i] = NewVbucketWorker(
+			i, feed, bucket, keyspaceId, opaque, config, opaque2, kvdata.throttle)
 	}
 	return workers
 }
 
+// workerConfigChanged returns true if config changes the number of
+// workers or their channel size.
+func (kvdata *KVData) workerConfigChanged(config c.Config) bool {
+	for _, key := range []string{"vbucketWorkers", "mutationChanSize"} {
+		if cv, ok := config[key]; ok && cv.Int() != kvdata.config[key].Int() {
+			return true
+		}
+	}
+	return false
+}
+
+// resizeWorkers replaces the current set of workers with a new set, as
+// per "vbucketWorkers" and "mutationChanSize" settings, and rebalances
+// the active vbuckets across them without restarting the streams. Must
+// be called from runScatter() so that no mutations are scattered while
+// vbuckets are in transit.
+func (kvdata *KVData) resizeWorkers() {
+	nworkers := kvdata.config["vbucketWorkers"].Int()
+	if nworkers <= 0 {
+		fmsg := "%v ##%x invalid vbucketWorkers %v, skip resizing\n"
+		logging.Errorf(fmsg, kvdata.logPrefix, kvdata.opaque, nworkers)
+		return
+	}
+
+	// collect vbuckets from old workers, after they drain their queues.
+	vbuckets := make([]*Vbucket, 0)
+	for _, worker := range kvdata.workers {
+		vbs, err := worker.HandoffVbuckets()
+		if err != nil {
+			panic(err)
+		}
+		vbuckets = append(vbuckets, vbs...)
+	}
+
+	workers := kvdata.spawnWorkers(kvdata.feed, kvdata.bucket,
+		kvdata.keyspaceId, kvdata.config, kvdata.opaque, kvdata.opaque2)
+	for _, worker := range workers {
+		if _, err := worker.AddEngines(kvdata.opaque, kvdata.engines, kvdata.endpoints); err != nil {
+			panic(err)
+		}
+	}
+	perWorker := make([][]*Vbucket, len(workers))
+	for _, v := range vbuckets {
+		i := int(v.vbno) % len(workers)
+		perWorker[i] = append(perWorker[i], v)
+	}
+	for i, worker := range workers {
+		if err := worker.AdoptVbuckets(perWorker[i]); err != nil {
+			panic(err)
+		}
+	}
+
+	for _, worker := range kvdata.workers {
+		worker.Close()
+	}
+	fmsg := "%v ##%x resized workers from %v to %v, rebalanced %v vbuckets\n"
+	logging.Infof(fmsg, kvdata.logPrefix, kvdata.opaque,
+		len(kvdata.workers), len(workers), len(vbuckets))
+	kvdata.workers = workers
+	kvdata.updateWorkerStats()
+}
+
 func (kvdata *KVData) publishStreamEnd() {
 	for _, worker := range kvdata.workers {
 		vbuckets, err := worker.GetVbuckets()
@@ -748,11 +929,71 @@ func (kvdata *KVData) newStats() c.Statistics {
 		"delInsts": float64(0),   // no. of delInsts received
 		"tsCount":  float64(0),   // no. of updateTs received
 		"vbuckets": statVbuckets, // per vbucket statistics
+		"workers":  nil,          // per worker and aggregate statistics
+		"throttle": nil,          // egress throttling statistics
+		"sync":     nil,          // effective sync pulse interval
+		"paused":   false,        // not pulling mutations from upstream
 	}
 	stats, _ := c.NewStatistics(m)
 	return stats
 }
 
+// workerStatistics aggregates statistics from all workers of this
+// kvdata, along with the per-worker break up.
+func (kvdata *KVData) workerStatistics() map[string]interface{} {
+	var outgoingMut, updateSeqno, updateSeqnoCoalesced, datachLen, datachCap float64
+	var pauseCount, pauseDuration float64
+	var evalCacheHits, evalCacheMisses float64
+	var maxSaturation float64
+	perWorker := make(map[string]interface{})
+	for _, worker := range kvdata.workers {
+		wstats := worker.stats.Map()
+		perWorker[strconv.Itoa(worker.id)] = wstats
+		outgoingMut += wstats["outgoingMut"].(float64)
+		updateSeqno += wstats["updateSeqno"].(float64)
+		updateSeqnoCoalesced += wstats["updateSeqnoCoalesced"].(float64)
+		datachLen += wstats["datachLen"].(float64)
+		datachCap += wstats["datachCap"].(float64)
+		pauseCount += wstats["pauseCount"].(float64)
+		pauseDuration += wstats["pauseDuration"].(float64)
+		evalCacheHits += wstats["evalCacheHits"].(float64)
+		evalCacheMisses += wstats["evalCacheMisses"].(float64)
+		if sat := wstats["datachSaturation"].(float64); sat > maxSaturation {
+			maxSaturation = sat
+		}
+	}
+	return map[string]interface{}{
+		"outgoingMut":          outgoingMut,
+		"updateSeqno":          updateSeqno,
+		"updateSeqnoCoalesced": updateSeqnoCoalesced,
+		"datachLen":            datachLen,
+		"datachCap":            datachCap,
+		"datachSaturation":     chanSaturation(int(datachLen), int(datachCap)),
+		"maxDatachSaturation":  maxSaturation,
+		"pauseCount":           pauseCount,
+		"pauseDuration":        pauseDuration,
+		"evalCacheHits":        evalCacheHits,
+		"evalCacheMisses":      evalCacheMisses,
+		"perWorker":            perWorker,
+	}
+}
+
+// addCollectionStats sums the per collection statistics of a worker,
+// `wstats`, into `collections`.
+func addCollectionStats(collections, wstats map[string]interface{}) {
+	for cid, stat := range wstats {
+		cstats, ok := collections[cid].(map[string]interface{})
+		if !ok {
+			cstats = make(map[string]interface{})
+			collections[cid] = cstats
+		}
+		for key, val := range stat.(map[string]interface{}) {
+			sum, _ := cstats[key].(float64)
+			cstats[key] = sum + val.(float64)
+		}
+	}
+}
+
 // This method will not block for more than 5 seconds. As stats_manager
 // logger thread calls this routine periodically, it is important that
 // this routine does not block forever.
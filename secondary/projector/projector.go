@@ -58,9 +58,13 @@ type Projector struct {
 	//Statistics
 	stats       *ProjectorStats
 	statsMgr    *statsManager
+	encodeBufs  *bufferPool // shared by vbucket workers of all feeds
 	statsCmdCh  chan []interface{}
 	statsStopCh chan bool
 	statsMutex  sync.RWMutex
+
+	// MAINT_STREAM priority over INIT_STREAM, shared by vbucket workers of all feeds
+	streamPriority *c.StreamPriority
 }
 
 // NewProjector creates a news projector instance and
@@ -99,6 +103,8 @@ func NewProjector(maxvbs int, config c.Config, certFile string, keyFile string)
 	p.statsMgr = NewStatsManager(p.statsCmdCh, p.statsStopCh, config)
 	p.UpdateStatsMgr(p.stats.Clone())
 
+	p.encodeBufs = newBufferPool(config)
+	p.streamPriority = c.NewStreamPriority()
 	p.config = config
 	p.ResetConfig(config)
 
@@ -206,7 +212,12 @@ func (p *Projector) ResetConfig(config c.Config) {
 		value := cv.Int()
 		p.statsCmdCh <- []interface{}{EVAL_STAT_LOGGING_THRESHOLD, value}
 	}
+	p.encodeBufs.ResetConfig(config)
 	p.config = p.config.Override(config)
+	p.streamPriority.SetWeights(
+		p.config["indexer.settings.stream_priority.maint_weight"].Int(),
+		p.config["indexer.settings.stream_priority.init_weight"].Int())
+	c.NotifyConfigChange(config)
 
 	// CPU-profiling
 	cpuProfile, ok := config["projector.cpuProfile"]
@@ -248,6 +259,21 @@ func (p *Projector) ResetConfig(config c.Config) {
 		logging.Infof("%v memcachedTimeout set to %v\n", p.logPrefix, uint32(cv.Int()))
 	}
 
+	if cv, ok := config["projector.settings.dcp.noop_interval"]; ok {
+		mc.SetDcpNoopInterval(uint32(cv.Int()))
+		logging.Infof("%v dcp noop_interval set to %v\n", p.logPrefix, cv.Int())
+	}
+
+	if cv, ok := config["projector.settings.dcp.idle_timeout"]; ok {
+		mc.SetDcpMutationReadTimeout(uint32(cv.Int()))
+		logging.Infof("%v dcp idle_timeout set to %v\n", p.logPrefix, cv.Int())
+	}
+
+	if cv, ok := config["projector.dcp.memoryThreshold"]; ok {
+		mc.SetDcpMemoryThreshold(uint64(cv.Int()))
+		logging.Infof("%v dcp memoryThreshold set to %v\n", p.logPrefix, cv.Int())
+	}
+
 	logging.Infof("%v\n", c.LogRuntime())
 }
 
@@ -753,6 +779,8 @@ func (p *Projector) doStatistics() interface{} {
 		feeds.Set(topic, feed.GetStatistics())
 	}
 	stats.Set("feeds", feeds)
+	stats.Set("encodeBuffers", p.encodeBufs.Map())
+	stats.Set("streamPriority", p.streamPriority.Map())
 	return map[string]interface{}(stats)
 }
 
@@ -797,6 +825,112 @@ func (p *Projector) handleStats(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "%s", c.Statistics(stats).Lines())
 }
 
+// handle per vbucket seqnos, optionally filtered by `topic` and
+// `keyspace`, with `lagging=true` only vbuckets that are lagging behind
+// DCP are reported.
+func (p *Projector) handleVbSeqnos(w http.ResponseWriter, r *http.Request) {
+	valid := validateAuth(w, r)
+	if !valid {
+		return
+	}
+
+	logging.Infof("%s Request %q\n", p.logPrefix, r.URL.String())
+	if r.Method != "GET" {
+		http.Error(w, "only GET supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	topic, keyspaceId := query.Get("topic"), query.Get("keyspace")
+	lagging := query.Get("lagging") == "true"
+
+	feeds := p.GetFeeds()
+	if topic != "" {
+		feed, err := p.GetFeed(topic)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		feeds = []*Feed{feed}
+	}
+
+	result := make(map[string]map[string][]*VbucketSeqnos)
+	for _, feed := range feeds {
+		seqnos, err := feed.GetVbucketSeqnos(keyspaceId)
+		if err != nil {
+			fmsg := "%v handleVbSeqnos() feed(`%v`): %v\n"
+			logging.Errorf(fmsg, p.logPrefix, feed.topic, err)
+			continue
+		}
+		if lagging {
+			for kid, vbseqnos := range seqnos {
+				lagged := make([]*VbucketSeqnos, 0)
+				for _, vbs := range vbseqnos {
+					if vbs.Lag > 0 {
+						lagged = append(lagged, vbs)
+					}
+				}
+				seqnos[kid] = lagged
+			}
+		}
+		result[feed.topic] = seqnos
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		logging.Errorf("%v encoding vbseqnos: %v\n", p.logPrefix, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	header := w.Header()
+	header["Content-Type"] = []string{"application/json"}
+	fmt.Fprintf(w, "%s", string(data))
+}
+
+// handle pause, resume and drain of feed for `topic`.
+func (p *Projector) handleFeedControl(w http.ResponseWriter, r *http.Request) {
+	valid := validateAuth(w, r)
+	if !valid {
+		return
+	}
+
+	logging.Infof("%s Request %q %q\n", p.logPrefix, r.Method, r.URL.String())
+	if r.Method != "POST" {
+		http.Error(w, "only POST supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	topic := r.URL.Query().Get("topic")
+	if topic == "" {
+		http.Error(w, "missing topic", http.StatusBadRequest)
+		return
+	}
+	feed, err := p.GetFeed(topic)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/feed/pause":
+		err = feed.Pause()
+	case "/feed/resume":
+		err = feed.Resume()
+	case "/feed/drain":
+		err = feed.Drain()
+	default:
+		http.Error(w, "unknown request", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmsg := "%v handleFeedControl() %v feed(`%v`): %v\n"
+		logging.Errorf(fmsg, p.logPrefix, r.URL.Path, topic, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 // handle settings
 func (p *Projector) handleSettings(w http.ResponseWriter, r *http.Request) {
 	valid := validateAuth(w, r)
@@ -839,6 +973,8 @@ func (p *Projector) handleSettings(w http.ResponseWriter, r *http.Request) {
 				fmsg := "%v feed(`%v`).ResetConfig: %v"
 				logging.Errorf(fmsg, p.logPrefix, feed.topic, err)
 			}
+			// workers could have been resized, refresh stats pointers.
+			p.UpdateStats(feed.topic, feed)
 		}
 
 	default:
@@ -944,6 +1080,13 @@ func (p *Projector) initSecurityContext(encryptLocalHost bool) error {
 	}
 
 	fn := func(refreshCert bool, refreshEncrypt bool) error {
+		// adminport picks up the new certificate and TLS config on
+		// new connections.  It only needs to restart on encryption change.
+		if !refreshEncrypt {
+			logging.Infof("Receive certificate refresh.  No restart required")
+			return nil
+		}
+
 		select {
 		case <-p.enableSecurityChange:
 		default:
@@ -428,13 +428,20 @@ func (sm *statsManager) logger() {
 }
 
 func Accmulate(wrkr []interface{}) string {
-	var dataChLen, outgoingMut, updateSeqno uint64
+	var dataChLen, dataChCap, outgoingMut, updateSeqno uint64
+	var pauseCount, pauseDuration uint64
 	for _, stats := range wrkr {
 		wrkrStat := stats.(*WorkerStats)
 		dataChLen += (uint64)(len(wrkrStat.datach))
+		dataChCap += (uint64)(cap(wrkrStat.datach))
 		outgoingMut += wrkrStat.outgoingMut.Value()
 		updateSeqno += wrkrStat.updateSeqno.Value()
+		pauseCount += wrkrStat.pauseCount.Value()
+		pauseDuration += wrkrStat.pauseDuration.Value()
 	}
+	saturation := chanSaturation(int(dataChLen), int(dataChCap))
 	return fmt.Sprintf(
-		"{\"datachLen\":%v,\"outgoingMut\":%v,\"updateSeqno\":%v}", dataChLen, outgoingMut, updateSeqno)
+		"{\"datachLen\":%v,\"datachSaturation\":%.2f,\"outgoingMut\":%v,\"updateSeqno\":%v,"+
+			"\"pauseCount\":%v,\"pauseDuration\":%v}",
+		dataChLen, saturation, outgoingMut, updateSeqno, pauseCount, pauseDuration)
 }
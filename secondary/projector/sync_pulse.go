@@ -0,0 +1,97 @@
+package projector
+
+import (
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+)
+
+// syncPulse computes the interval between sync pulses of a keyspace.
+// When adaptive, the interval is stretched while the keyspace is idle and
+// tightened while it is busy, within [minTimeout, maxTimeout], and moves
+// back to the configured syncTimeout otherwise. Owned by kvdata routine.
+type syncPulse struct {
+	timeout    time.Duration // configured syncTimeout
+	adaptive   bool
+	minTimeout time.Duration
+	maxTimeout time.Duration
+	busyRate   float64 // mutations per second, to treat keyspace as busy
+
+	interval   time.Duration // effective interval
+	lastEvents uint64
+	lastTime   time.Time
+}
+
+func newSyncPulse(config c.Config) *syncPulse {
+	sp := &syncPulse{lastTime: time.Now()}
+	sp.resetConfig(config)
+	return sp
+}
+
+// resetConfig accepts a full-set or subset of feed configuration.
+func (sp *syncPulse) resetConfig(config c.Config) {
+	if cv, ok := config["syncTimeout"]; ok {
+		sp.timeout = time.Duration(cv.Int()) * time.Millisecond
+	}
+	if cv, ok := config["syncAdaptive"]; ok {
+		sp.adaptive = cv.Bool()
+	}
+	if cv, ok := config["syncMinTimeout"]; ok {
+		sp.minTimeout = time.Duration(cv.Int()) * time.Millisecond
+	}
+	if cv, ok := config["syncMaxTimeout"]; ok {
+		sp.maxTimeout = time.Duration(cv.Int()) * time.Millisecond
+	}
+	if cv, ok := config["syncBusyRate"]; ok {
+		sp.busyRate = float64(cv.Int())
+	}
+	sp.interval = sp.clamp(sp.timeout)
+}
+
+// next returns the interval to the next sync pulse, `events` is the
+// total number of mutations received by the keyspace so far.
+func (sp *syncPulse) next(events uint64) time.Duration {
+	now := time.Now()
+	elapsed := now.Sub(sp.lastTime)
+	delta := events - sp.lastEvents
+	sp.lastEvents, sp.lastTime = events, now
+
+	if !sp.adaptive {
+		sp.interval = sp.timeout
+		return sp.interval
+	}
+
+	switch {
+	case delta == 0: // idle
+		sp.interval = sp.clamp(sp.interval * 2)
+	case elapsed > 0 && float64(delta)/elapsed.Seconds() >= sp.busyRate:
+		sp.interval = sp.clamp(sp.interval / 2)
+	default:
+		sp.interval = sp.clamp(sp.timeout)
+	}
+	return sp.interval
+}
+
+func (sp *syncPulse) clamp(interval time.Duration) time.Duration {
+	if !sp.adaptive {
+		return interval
+	}
+	if sp.minTimeout > 0 && interval < sp.minTimeout {
+		interval = sp.minTimeout
+	}
+	if sp.maxTimeout > 0 && interval > sp.maxTimeout {
+		interval = sp.maxTimeout
+	}
+	return interval
+}
+
+// Map returns sync pulse statistics, intervals are in milliseconds.
+func (sp *syncPulse) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"adaptive":   sp.adaptive,
+		"timeout":    float64(sp.timeout / time.Millisecond),
+		"minTimeout": float64(sp.minTimeout / time.Millisecond),
+		"maxTimeout": float64(sp.maxTimeout / time.Millisecond),
+		"interval":   float64(sp.interval / time.Millisecond),
+	}
+}
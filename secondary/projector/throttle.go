@@ -0,0 +1,192 @@
+package projector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/stats"
+)
+
+// topic prefixes of the indexer streams.
+const (
+	maintTopicPrefix = "MAINT_STREAM_TOPIC"
+	initTopicPrefix  = "INIT_STREAM_TOPIC"
+)
+
+// bytes sent by a vbucket worker between two stream priority checks.
+const streamPriorityBatchSize = 64 * 1024
+
+// throttler is a token bucket limiting the egress bandwidth, in bytes
+// per second, of one or more vbucket workers. It can be shared across
+// go-routines and its rate can be changed while it is in use.
+type throttler struct {
+	mu     sync.Mutex
+	rate   int64   // bytes per second, 0 disables throttling.
+	tokens float64 // can go negative when bytes are borrowed.
+	last   time.Time
+
+	throttledCount stats.Uint64Val // number of times Wait() had to wait
+	throttledTime  stats.Uint64Val // total time, in nanoseconds, spent waiting
+}
+
+func newThrottler(rate int64) *throttler {
+	t := &throttler{last: time.Now()}
+	t.throttledCount.Init()
+	t.throttledTime.Init()
+	t.SetRate(rate)
+	return t
+}
+
+// SetRate to `rate` bytes per second, rate <= 0 disables throttling.
+func (t *throttler) SetRate(rate int64) {
+	if rate < 0 {
+		rate = 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rate != rate {
+		t.rate, t.tokens, t.last = rate, float64(rate), time.Now()
+	}
+}
+
+// Rate returns the current rate in bytes per second.
+func (t *throttler) Rate() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rate
+}
+
+// Wait until `n` bytes can be sent, or until finch is closed. A burst of
+// up to one second worth of bytes is allowed.
+func (t *throttler) Wait(n int, finch chan bool) {
+	if t == nil || n <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	if t.rate == 0 {
+		t.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * float64(t.rate)
+	if burst := float64(t.rate); t.tokens > burst {
+		t.tokens = burst
+	}
+	t.last = now
+	t.tokens -= float64(n)
+	var wait time.Duration
+	if t.tokens < 0 {
+		wait = time.Duration(-t.tokens / float64(t.rate) * float64(time.Second))
+	}
+	t.mu.Unlock()
+
+	if wait <= 0 {
+		return
+	}
+	t.throttledCount.Add(1)
+	t.throttledTime.Add(uint64(wait))
+	tm := time.NewTimer(wait)
+	defer tm.Stop()
+	select {
+	case <-tm.C:
+	case <-finch:
+	}
+}
+
+// Map returns throttling statistics.
+func (t *throttler) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"rate":           float64(t.Rate()),
+		"throttledCount": float64(t.throttledCount.Value()),
+		"throttledTime":  float64(t.throttledTime.Value()),
+	}
+}
+
+// parseBandwidthSpec parses comma separated <name>=<bytes> entries.
+func parseBandwidthSpec(spec string) (map[string]int64, error) {
+	rates := make(map[string]int64)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid bandwidth entry %q", entry)
+		}
+		name := strings.TrimSpace(entry[:i])
+		rate, err := strconv.ParseInt(strings.TrimSpace(entry[i+1:]), 10, 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid bandwidth for %q: %q", name, entry[i+1:])
+		}
+		rates[name] = rate
+	}
+	return rates, nil
+}
+
+// topicBandwidth returns the bandwidth configured for topic, picking the
+// entry with the longest matching prefix.
+func topicBandwidth(config c.Config, topic string) (int64, error) {
+	cv, ok := config["throttle.topicBandwidth"]
+	if !ok {
+		return 0, nil
+	}
+	rates, err := parseBandwidthSpec(cv.String())
+	if err != nil {
+		return 0, err
+	}
+	return longestPrefixValue(rates, topic), nil
+}
+
+// longestPrefixValue returns the value of the entry with the longest prefix
+// of topic, or 0 if none matches.
+func longestPrefixValue(values map[string]int64, topic string) int64 {
+	value, matched := int64(0), -1
+	for prefix, v := range values {
+		if strings.HasPrefix(topic, prefix) && len(prefix) > matched {
+			value, matched = v, len(prefix)
+		}
+	}
+	return value
+}
+
+// topicMemoryQuotas returns the quota for queued mutations and encode
+// buffers configured for topic, picking the entries with the longest
+// matching prefix.
+func topicMemoryQuotas(config c.Config, topic string) (int64, int64, error) {
+	quotas := make([]int64, 0, 2)
+	for _, key := range []string{"memory.topicMutationQuota", "memory.topicEncodeBufQuota"} {
+		var quota int64
+		if cv, ok := config[key]; ok {
+			values, err := parseBandwidthSpec(cv.String())
+			if err != nil {
+				return 0, 0, err
+			}
+			quota = longestPrefixValue(values, topic)
+		}
+		quotas = append(quotas, quota)
+	}
+	return quotas[0], quotas[1], nil
+}
+
+// keyspaceBandwidth returns the bandwidth configured for keyspaceId,
+// falling back to the `*` entry.
+func keyspaceBandwidth(config c.Config, keyspaceId string) (int64, error) {
+	cv, ok := config["throttle.keyspaceBandwidth"]
+	if !ok {
+		return 0, nil
+	}
+	rates, err := parseBandwidthSpec(cv.String())
+	if err != nil {
+		return 0, err
+	}
+	if rate, ok := rates[keyspaceId]; ok {
+		return rate, nil
+	}
+	return rates["*"], nil
+}
@@ -0,0 +1,178 @@
+package projector
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+	"github.com/couchbase/indexing/secondary/stats"
+)
+
+// topicMemory accounts for the memory held by a topic, shared by vbucket
+// workers of all its keyspaces, so that a single feed cannot run the
+// projector out of memory.
+//
+// Mutations queued on the workers' data channel are limited by mutQuota,
+// once it is used up the feed's upstream, and only that, blocks until
+// workers drain their queue. Encode buffers are limited by bufQuota, grown
+// buffers are not retained beyond it. A quota of 0 disables it.
+type topicMemory struct {
+	mu       sync.Mutex
+	mutQuota int64
+	mutUsed  int64
+	waiters  int
+	released chan bool // closed, and renewed, when waiters can retry
+
+	bufQuota int64 // atomic
+	bufUsed  stats.Int64Val
+
+	throttledCount stats.Uint64Val // number of times AcquireMut() had to wait
+	throttledTime  stats.Uint64Val // total time, in nanoseconds, spent waiting
+	bufCapped      stats.Uint64Val // grown buffers not retained due to bufQuota
+}
+
+func newTopicMemory(mutQuota, bufQuota int64) *topicMemory {
+	m := &topicMemory{released: make(chan bool)}
+	m.bufUsed.Init()
+	m.throttledCount.Init()
+	m.throttledTime.Init()
+	m.bufCapped.Init()
+	m.SetQuotas(mutQuota, bufQuota)
+	return m
+}
+
+// SetQuotas for queued mutations and encode buffers, quota <= 0
+// disables it.
+func (m *topicMemory) SetQuotas(mutQuota, bufQuota int64) {
+	if mutQuota < 0 {
+		mutQuota = 0
+	}
+	if bufQuota < 0 {
+		bufQuota = 0
+	}
+	atomic.StoreInt64(&m.bufQuota, bufQuota)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.mutQuota != mutQuota {
+		m.mutQuota = mutQuota
+		m.notifyNoLock()
+	}
+}
+
+// Quotas returns the quota for queued mutations and encode buffers.
+func (m *topicMemory) Quotas() (int64, int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mutQuota, atomic.LoadInt64(&m.bufQuota)
+}
+
+func (m *topicMemory) notifyNoLock() {
+	if m.waiters > 0 {
+		close(m.released)
+		m.released = make(chan bool)
+	}
+}
+
+// AcquireMut accounts `n` bytes of a mutation to be queued, waiting as
+// long as the topic is over its quota, or until finch is closed. A
+// mutation is always accepted when nothing is queued, so that mutations
+// larger than the quota make progress.
+func (m *topicMemory) AcquireMut(n int64, finch chan bool) {
+	if m == nil || n <= 0 {
+		return
+	}
+
+	var start time.Time
+	m.mu.Lock()
+loop:
+	for m.mutQuota > 0 && m.mutUsed > 0 && m.mutUsed+n > m.mutQuota {
+		if start.IsZero() {
+			start = time.Now()
+		}
+		released := m.released
+		m.waiters++
+		m.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-finch:
+		}
+
+		m.mu.Lock()
+		m.waiters--
+		select {
+		case <-finch:
+			break loop
+		default:
+		}
+	}
+	m.mutUsed += n
+	m.mu.Unlock()
+
+	if !start.IsZero() {
+		m.throttledCount.Add(1)
+		m.throttledTime.Add(uint64(time.Since(start)))
+	}
+}
+
+// ReleaseMut gives back `n` bytes accounted by AcquireMut.
+func (m *topicMemory) ReleaseMut(n int64) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mutUsed -= n
+	m.notifyNoLock()
+}
+
+// AddBuf accounts `n` bytes of encode buffers, which are always
+// accepted, or gives them back if `n` is negative.
+func (m *topicMemory) AddBuf(n int64) {
+	if m != nil {
+		m.bufUsed.Add(n)
+	}
+}
+
+// ReserveBuf accounts `n` bytes of a grown encode buffer, if bufQuota
+// allows it.
+func (m *topicMemory) ReserveBuf(n int64) bool {
+	if m == nil {
+		return true
+	}
+	for {
+		used, quota := m.bufUsed.Value(), atomic.LoadInt64(&m.bufQuota)
+		if quota > 0 && used+n > quota {
+			m.bufCapped.Add(1)
+			return false
+		}
+		if m.bufUsed.CAS(used, used+n) {
+			return true
+		}
+	}
+}
+
+// Map returns memory statistics of the topic.
+func (m *topicMemory) Map() map[string]interface{} {
+	m.mu.Lock()
+	mutQuota, mutUsed := m.mutQuota, m.mutUsed
+	m.mu.Unlock()
+
+	return map[string]interface{}{
+		"mutationQuota":   float64(mutQuota),
+		"mutationUsed":    float64(mutUsed),
+		"encodeBufQuota":  float64(atomic.LoadInt64(&m.bufQuota)),
+		"encodeBufUsed":   float64(m.bufUsed.Value()),
+		"encodeBufCapped": float64(m.bufCapped.Value()),
+		"throttledCount":  float64(m.throttledCount.Value()),
+		"throttledTime":   float64(m.throttledTime.Value()),
+	}
+}
+
+// eventSize returns the bytes of a DCP event accounted against the
+// mutation quota of its topic.
+func eventSize(m *mc.DcpEvent) int64 {
+	return int64(len(m.Key) + len(m.Value))
+}
@@ -2,6 +2,7 @@ package projector
 
 import (
 	"fmt"
+	"time"
 
 	c "github.com/couchbase/indexing/secondary/common"
 	mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
@@ -24,6 +25,37 @@ type Vbucket struct {
 	sshotCount    uint64
 	mutationCount uint64
 	syncCount     uint64
+	lastSeqno     uint64 // seqno of last event processed by worker
+	snapStart     uint64 // boundaries of the last snapshot marker
+	snapEnd       uint64
+	// UpdateSeqno held back by the worker, see VbucketWorker.updateSeqno
+	updateSeqnoPending bool
+	updateSeqnoCollId  uint32    // collection of the held back UpdateSeqno
+	updateSeqnoTime    time.Time // when the last UpdateSeqno was sent
+}
+
+// VbucketSeqnos is a point in time view of a vbucket's progress
+// through the feed.
+type VbucketSeqnos struct {
+	Vbno      uint16 `json:"vbno"`
+	Vbuuid    uint64 `json:"vbuuid"`
+	Received  uint64 `json:"received"`  // last seqno received from DCP
+	Forwarded uint64 `json:"forwarded"` // last seqno processed by worker
+	Mutation  uint64 `json:"mutation"`  // last mutation seqno published
+	Lag       uint64 `json:"lag"`       // received - forwarded
+	SnapStart uint64 `json:"snapStart"`
+	SnapEnd   uint64 `json:"snapEnd"`
+}
+
+func (v *Vbucket) seqnos() *VbucketSeqnos {
+	return &VbucketSeqnos{
+		Vbno:      v.vbno,
+		Vbuuid:    v.vbuuid,
+		Forwarded: v.lastSeqno,
+		Mutation:  v.seqno,
+		SnapStart: v.snapStart,
+		SnapEnd:   v.snapEnd,
+	}
 }
 
 // NewVbucket creates a new routine to handle this vbucket stream.
@@ -7,9 +7,13 @@
 //                                   |               *---> endpoint
 //             Event() --*           |               |
 //                       |--------> run -------------*---> endpoint
+//  HandoffVbuckets() --*
+//                       |
 //        AddEngines() --*
 //                       |
-//       ResetConfig() --*
+//    onConfigChange() --*
+//                       |
+//    AdoptVbuckets() --*
 //                       |
 //     DeleteEngines() --*
 //                       |
@@ -22,6 +26,10 @@ package projector
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	qexpr "github.com/couchbase/query/expression"
 	qvalue "github.com/couchbase/query/value"
@@ -55,13 +63,34 @@ type VbucketWorker struct {
 	sbch   chan []interface{}
 	datach chan []interface{}
 	finch  chan bool
+	// closed by Close(), so that a paused worker stops waiting.
+	stopch   chan bool
+	stopOnce sync.Once
 	// config params
 	logPrefix   string
 	mutChanSize int
 	opaque2     uint64 //client opaque
-
-	encodeBuf []byte
-	stats     *WorkerStats
+	maxPause    time.Duration
+	unwatch     func() // cancel watch of config changes
+	// least interval between two UpdateSeqno messages of a vbucket.
+	updateSeqnoInterval time.Duration
+
+	encodeBuf  []byte
+	bufPool    *bufferPool // projector-wide accounting of encodeBuf
+	lastShrink time.Time
+	stats      *WorkerStats
+	// per collection statistics, only accessed by the worker routine.
+	collStats map[uint32]*collectionStats
+	// bytes of mutations queued in datach, accounted against the topic.
+	queuedBytes int64 // atomic
+
+	// egress throttling, shared with other workers of this keyspace.
+	throttle *throttler
+	// stream priority, shared with workers of all feeds.
+	priority      *c.StreamPriority
+	maintStream   bool
+	initStream    bool
+	priorityBytes int // bytes sent since the last priority check
 }
 
 type WorkerStats struct {
@@ -69,26 +98,91 @@ type WorkerStats struct {
 	datach      chan []interface{}
 	outgoingMut stats.Uint64Val // Number of mutations consumed from this worker
 	updateSeqno stats.Uint64Val // Number of updateSeqno messages sent by this worker
+	// Number of updateSeqno messages replaced by a later one of the vbucket
+	updateSeqnoCoalesced stats.Uint64Val
+
+	// back-pressure from downstream endpoints
+	pauseCount    stats.Uint64Val // Number of times worker paused on a full endpoint
+	pauseDuration stats.Uint64Val // Cumulative pause duration, in nanoseconds
+	maxPause      stats.Uint64Val // Longest pause, in nanoseconds
+	paused        stats.BoolVal   // Worker is currently paused
+
+	// expressions evaluation shared across indexes
+	evalCacheHits   stats.Uint64Val
+	evalCacheMisses stats.Uint64Val
+}
 
+// collectionStats are the statistics of a collection on a worker.
+type collectionStats struct {
+	mutations            uint64 // mutations routed to the indexes of the collection
+	updateSeqno          uint64 // updateSeqno messages sent for the collection
+	updateSeqnoCoalesced uint64 // updateSeqno messages replaced by a later one
+	transformErrors      uint64 // errors evaluating the indexes of the collection
+}
+
+func (stats *collectionStats) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"mutations":            float64(stats.mutations),
+		"updateSeqno":          float64(stats.updateSeqno),
+		"updateSeqnoCoalesced": float64(stats.updateSeqnoCoalesced),
+		"transformErrors":      float64(stats.transformErrors),
+	}
 }
 
 func (stats *WorkerStats) Init() {
 	stats.closed.Init()
 	stats.outgoingMut.Init()
 	stats.updateSeqno.Init()
+	stats.updateSeqnoCoalesced.Init()
+	stats.pauseCount.Init()
+	stats.pauseDuration.Init()
+	stats.maxPause.Init()
+	stats.paused.Init()
+	stats.evalCacheHits.Init()
+	stats.evalCacheMisses.Init()
 }
 
 func (stats *WorkerStats) IsClosed() bool {
 	return stats.closed.Value()
 }
 
+// Map returns a snapshot of worker statistics, including the depth
+// and saturation of its data channel. Can be called from any go-routine.
+func (stats *WorkerStats) Map() map[string]interface{} {
+	datachLen, datachCap := len(stats.datach), cap(stats.datach)
+	return map[string]interface{}{
+		"outgoingMut":          float64(stats.outgoingMut.Value()),
+		"updateSeqno":          float64(stats.updateSeqno.Value()),
+		"updateSeqnoCoalesced": float64(stats.updateSeqnoCoalesced.Value()),
+		"datachLen":            float64(datachLen),
+		"datachCap":            float64(datachCap),
+		"datachSaturation":     chanSaturation(datachLen, datachCap),
+		"pauseCount":           float64(stats.pauseCount.Value()),
+		"pauseDuration":        float64(stats.pauseDuration.Value()),
+		"maxPause":             float64(stats.maxPause.Value()),
+		"paused":               stats.paused.Value(),
+		"evalCacheHits":        float64(stats.evalCacheHits.Value()),
+		"evalCacheMisses":      float64(stats.evalCacheMisses.Value()),
+	}
+}
+
+// chanSaturation returns the fraction, 0.0 to 1.0, of channel capacity
+// that is in use.
+func chanSaturation(length, capacity int) float64 {
+	if capacity <= 0 {
+		return 0
+	}
+	return float64(length) / float64(capacity)
+}
+
 // NewVbucketWorker creates a new routine to handle this vbucket stream.
 func NewVbucketWorker(
 	id int, feed *Feed, bucket, keyspaceId string,
-	opaque uint16, config c.Config, opaque2 uint64) *VbucketWorker {
+	opaque uint16, config c.Config, opaque2 uint64,
+	throttle *throttler) *VbucketWorker {
 
 	mutChanSize := config["mutationChanSize"].Int()
-	encodeBufSize := config["encodeBufSize"].Int()
+	bufPool := feed.projector.encodeBufs
 
 	worker := &VbucketWorker{
 		id:         id,
@@ -105,15 +199,29 @@ func NewVbucketWorker(
 		sbch:       make(chan []interface{}, mutChanSize),
 		datach:     make(chan []interface{}, mutChanSize),
 		finch:      make(chan bool),
-		encodeBuf:  make([]byte, 0, encodeBufSize),
+		stopch:     make(chan bool),
+		encodeBuf:  bufPool.Get(feed.memory),
+		bufPool:    bufPool,
+		lastShrink: time.Now(),
 		stats:      &WorkerStats{},
+		collStats:  make(map[uint32]*collectionStats),
 		opaque2:    opaque2,
+		throttle:   throttle,
+		priority:   feed.projector.streamPriority,
 	}
+	worker.maintStream = strings.HasPrefix(feed.topic, maintTopicPrefix)
+	worker.initStream = strings.HasPrefix(feed.topic, initTopicPrefix)
 	worker.stats.Init()
 	worker.stats.datach = worker.datach
 	fmsg := "WRKR[%v<-%v<-%v #%v]"
 	worker.logPrefix = fmt.Sprintf(fmsg, id, keyspaceId, feed.cluster, feed.topic)
 	worker.mutChanSize = mutChanSize
+	worker.maxPause = time.Duration(config["backpressure.maxPause"].Int())
+	worker.maxPause *= time.Millisecond
+	worker.updateSeqnoInterval = time.Duration(config["updateSeqnoInterval"].Int())
+	worker.updateSeqnoInterval *= time.Millisecond
+	watched := []string{"projector.backpressure.maxPause", "projector.updateSeqnoInterval"}
+	worker.unwatch = c.WatchConfig(watched, worker.onConfigChange)
 	go worker.run(worker.datach, worker.sbch)
 	return worker
 }
@@ -127,13 +235,34 @@ const (
 	vwCmdDelEngines
 	vwCmdGetStats
 	vwCmdResetConfig
+	vwCmdHandoffVbuckets
+	vwCmdAdoptVbuckets
+	vwCmdGetVbSeqnos
+	vwCmdDrain
 	vwCmdClose
 )
 
-// Event will post an DcpEvent, asychronous call.
+// Event will post an DcpEvent, asychronous call. Blocks as long as
+// mutations queued by workers of this topic exceed its memory quota.
 func (worker *VbucketWorker) Event(m *mc.DcpEvent) error {
+	if size := eventSize(m); size > 0 {
+		worker.feed.memory.AcquireMut(size, worker.finch)
+		atomic.AddInt64(&worker.queuedBytes, size)
+	}
 	cmd := []interface{}{vwCmdEvent, m}
-	return c.FailsafeOpAsync(worker.datach, cmd, worker.finch)
+	err := c.FailsafeOpAsync(worker.datach, cmd, worker.finch)
+	select {
+	case <-worker.finch: // events left in datach won't be handled.
+		worker.releaseQueued()
+	default:
+	}
+	return err
+}
+
+// releaseQueued gives back to the topic the bytes of mutations that are
+// queued in datach, once the worker has exited.
+func (worker *VbucketWorker) releaseQueued() {
+	worker.feed.memory.ReleaseMut(atomic.SwapInt64(&worker.queuedBytes, 0))
 }
 
 // SyncPulse will trigger worker to generate a sync pulse for all its
@@ -155,6 +284,29 @@ func (worker *VbucketWorker) GetVbuckets() ([]*Vbucket, error) {
 	return resp[0].([]*Vbucket), nil
 }
 
+// HandoffVbuckets removes all vbuckets from this worker and returns them,
+// after all events queued ahead of this call are processed. Once handed
+// off, worker will neither process events nor publish StreamEnd for
+// those vbuckets. Synchronous call.
+func (worker *VbucketWorker) HandoffVbuckets() ([]*Vbucket, error) {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{vwCmdHandoffVbuckets, respch}
+	resp, err := c.FailsafeOp(worker.datach, respch, cmd, worker.finch)
+	if err != nil {
+		return nil, err
+	}
+	return resp[0].([]*Vbucket), nil
+}
+
+// AdoptVbuckets makes this worker responsible for vbuckets handed off by
+// another worker, synchronous call.
+func (worker *VbucketWorker) AdoptVbuckets(vbuckets []*Vbucket) error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{vwCmdAdoptVbuckets, vbuckets, respch}
+	_, err := c.FailsafeOp(worker.sbch, respch, cmd, worker.finch)
+	return err
+}
+
 // AddEngines update active set of engines and endpoints, synchronous call.
 func (worker *VbucketWorker) AddEngines(
 	opaque uint16,
@@ -181,12 +333,11 @@ func (worker *VbucketWorker) DeleteEngines(
 	return err
 }
 
-// ResetConfig for worker-routine, synchronous call.
-func (worker *VbucketWorker) ResetConfig(config c.Config) error {
-	respch := make(chan []interface{}, 1)
-	cmd := []interface{}{vwCmdResetConfig, config, respch}
-	_, err := c.FailsafeOp(worker.sbch, respch, cmd, worker.finch)
-	return err
+// onConfigChange posts a change of a watched config key to the
+// worker-routine, asynchronous call.
+func (worker *VbucketWorker) onConfigChange(key string, _, cv c.ConfigValue) {
+	cmd := []interface{}{vwCmdResetConfig, key, cv}
+	c.FailsafeOpAsync(worker.sbch, cmd, worker.finch)
 }
 
 // GetStatistics for worker vbucket, synchronous call.
@@ -200,8 +351,30 @@ func (worker *VbucketWorker) GetStatistics() (map[string]interface{}, error) {
 	return resp[0].(map[string]interface{}), nil
 }
 
+// GetVbucketSeqnos returns the progress of vbuckets managed by this
+// worker, synchronous call.
+func (worker *VbucketWorker) GetVbucketSeqnos() ([]*VbucketSeqnos, error) {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{vwCmdGetVbSeqnos, respch}
+	resp, err := c.FailsafeOp(worker.sbch, respch, cmd, worker.finch)
+	if err != nil {
+		return nil, err
+	}
+	return resp[0].([]*VbucketSeqnos), nil
+}
+
+// Drain returns after all events queued ahead of this call are
+// processed and handed over to endpoints, synchronous call.
+func (worker *VbucketWorker) Drain() error {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{vwCmdDrain, respch}
+	_, err := c.FailsafeOp(worker.datach, respch, cmd, worker.finch)
+	return err
+}
+
 // Close worker-routine, synchronous call.
 func (worker *VbucketWorker) Close() error {
+	worker.stopOnce.Do(func() { close(worker.stopch) })
 	respch := make(chan []interface{}, 1)
 	cmd := []interface{}{vwCmdClose, respch}
 	_, err := c.FailsafeOp(worker.sbch, respch, cmd, worker.finch)
@@ -222,6 +395,7 @@ func (worker *VbucketWorker) run(datach, sbch chan []interface{}) {
 		}
 		// call out a STREAM-END for active vbuckets.
 		for _, v := range worker.vbuckets {
+			worker.flushUpdateSeqno(v)
 			if data := v.makeStreamEndData(worker.engines); data != nil {
 				worker.broadcast2Endpoints(data)
 			} else {
@@ -229,7 +403,11 @@ func (worker *VbucketWorker) run(datach, sbch chan []interface{}) {
 				logging.Errorf(fmsg, logPrefix, worker.opaque, v.vbno)
 			}
 		}
+		worker.unwatch()
 		close(worker.finch)
+		worker.releaseQueued()
+		worker.bufPool.Put(worker.encodeBuf, worker.feed.memory)
+		worker.encodeBuf = nil
 		worker.stats.closed.Set(true)
 		logging.Infof("%v ##%x ##%v ... stopped\n", logPrefix,
 			worker.opaque, worker.opaque2)
@@ -252,8 +430,15 @@ loop:
 			switch cmd {
 			case vwCmdEvent:
 				worker.stats.outgoingMut.Add(1)
+				if worker.maintStream && len(datach) >= cap(datach)/2 {
+					worker.priority.MaintBacklog()
+				}
 				m := msg[1].(*mc.DcpEvent)
 				v := worker.handleEvent(m)
+				if size := eventSize(m); size > 0 {
+					atomic.AddInt64(&worker.queuedBytes, -size)
+					worker.feed.memory.ReleaseMut(size)
+				}
 				if v == nil {
 					fmsg := "%v ##%x nil vbucket %v for %v"
 					logging.Errorf(fmsg, logPrefix, m.Opaque, m.VBucket, m.Opcode)
@@ -266,10 +451,14 @@ loop:
 					logging.Fatalf(fmsg, logPrefix, m.Opaque, v.vbno, v.opaque, m.Opcode)
 					//workaround for MB-30327. this state should never happen.
 					os.Exit(1)
+
+				} else if m.Seqno > v.lastSeqno {
+					v.lastSeqno = m.Seqno
 				}
 
 			case vwCmdSyncPulse:
 				for _, v := range worker.vbuckets {
+					worker.flushUpdateSeqno(v)
 					if data := v.makeSyncData(worker.engines); data != nil {
 						v.syncCount++
 						fmsg := "%v ##%x sync count %v\n"
@@ -281,6 +470,28 @@ loop:
 						logging.Errorf(fmsg, logPrefix, worker.opaque, v.vbno)
 					}
 				}
+				// give back encode buffer grown by large documents.
+				worker.encodeBuf, worker.lastShrink =
+					worker.bufPool.Shrink(worker.encodeBuf, worker.lastShrink, worker.feed.memory)
+
+			case vwCmdDrain:
+				for _, v := range worker.vbuckets {
+					worker.flushUpdateSeqno(v)
+				}
+				respch := msg[1].(chan []interface{})
+				respch <- []interface{}{nil}
+
+			case vwCmdHandoffVbuckets:
+				vbuckets := make([]*Vbucket, 0, len(worker.vbuckets))
+				for _, v := range worker.vbuckets {
+					worker.flushUpdateSeqno(v)
+					vbuckets = append(vbuckets, v)
+				}
+				worker.vbuckets = make(map[uint16]*Vbucket)
+				fmsg := "%v ##%x handed off %v vbuckets\n"
+				logging.Infof(fmsg, logPrefix, worker.opaque, len(vbuckets))
+				respch := msg[1].(chan []interface{})
+				respch <- []interface{}{vbuckets}
 			}
 		case msg := <-sbch:
 			if breakloop := worker.handleCommand(msg); breakloop {
@@ -364,11 +575,43 @@ func (worker *VbucketWorker) handleCommand(msg []interface{}) bool {
 				"mutations": float64(v.mutationCount),
 			}
 		}
+		collections := make(map[string]interface{})
+		for cid, cstats := range worker.collStats {
+			collections[strconv.FormatUint(uint64(cid), 16)] = cstats.Map()
+		}
+		stats["collections"] = collections
 		respch := msg[1].(chan []interface{})
 		respch <- []interface{}{stats}
 
+	case vwCmdGetVbSeqnos:
+		respch := msg[1].(chan []interface{})
+		seqnos := make([]*VbucketSeqnos, 0, len(worker.vbuckets))
+		for _, v := range worker.vbuckets {
+			seqnos = append(seqnos, v.seqnos())
+		}
+		respch <- []interface{}{seqnos}
+
 	case vwCmdResetConfig:
-		_, respch := msg[1].(c.Config), msg[2].(chan []interface{})
+		key, cv := msg[1].(string), msg[2].(c.ConfigValue)
+		switch key {
+		case "projector.backpressure.maxPause":
+			worker.maxPause = time.Duration(cv.Int()) * time.Millisecond
+			fmsg := "%v ##%x backpressure.maxPause set to %v\n"
+			logging.Infof(fmsg, worker.logPrefix, worker.opaque, worker.maxPause)
+		case "projector.updateSeqnoInterval":
+			worker.updateSeqnoInterval = time.Duration(cv.Int()) * time.Millisecond
+			fmsg := "%v ##%x updateSeqnoInterval set to %v\n"
+			logging.Infof(fmsg, worker.logPrefix, worker.opaque, worker.updateSeqnoInterval)
+		}
+
+	case vwCmdAdoptVbuckets:
+		vbuckets := msg[1].([]*Vbucket)
+		for _, v := range vbuckets {
+			worker.vbuckets[v.vbno] = v
+		}
+		fmsg := "%v ##%x adopted %v vbuckets\n"
+		logging.Infof(fmsg, worker.logPrefix, worker.opaque, len(vbuckets))
+		respch := msg[2].(chan []interface{})
 		respch <- []interface{}{nil}
 
 	case vwCmdClose:
@@ -422,6 +665,11 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 		return fmt.Sprintf(traceMutFormat, logPrefix, m.Opaque, m.Seqno, m.Opcode, logging.TagUD(m.Key))
 	})
 
+	// a held back UpdateSeqno goes before any other message of the vbucket.
+	if vbok && v.updateSeqnoPending && !worker.isUnindexedMutation(m) {
+		worker.flushUpdateSeqno(v)
+	}
+
 	switch m.Opcode {
 	case mcd.DCP_STREAMREQ: // broadcast StreamBegin
 
@@ -459,6 +707,7 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 			logging.Errorf(fmsg, logPrefix, m.Opaque, vbno)
 			return v
 		}
+		v.snapStart, v.snapEnd = m.SnapstartSeq, m.SnapendSeq
 		if data := v.makeSnapshotData(m, worker.engines); data != nil {
 			worker.broadcast2Endpoints(data)
 			v.sshotCount++
@@ -478,6 +727,8 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 		v.seqno = m.Seqno // sequence number gets updated only here
 
 		processMutation := func(engines map[uint64]*Engine) {
+			cstats := worker.getCollectionStats(m.CollectionID)
+			cstats.mutations++
 			// prepare a data for each endpoint.
 			dataForEndpoints := make(map[string]interface{})
 			// for each engine distribute transformations to endpoints.
@@ -491,6 +742,11 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 
 			context := qexpr.NewIndexContext()
 			docval := qvalue.NewAnnotatedValue(nvalue)
+			// share evaluation of common expressions across indexes.
+			var evalCache *c.EvalCache
+			if len(engines) > 1 {
+				evalCache = c.NewEvalCache(docval)
+			}
 			for _, engine := range engines {
 				// Slices in KeyVersions struct are updated for all the indexes
 				// belonging to this keyspace. Hence, pre-allocate the memory for
@@ -499,31 +755,25 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 				// therefore reduces the garbage generated.
 				newBuf, err := engine.TransformRoute(
 					v.vbuuid, m, dataForEndpoints, worker.encodeBuf, docval, context,
-					len(engines), worker.opaque2,
+					len(engines), worker.opaque2, evalCache,
 				)
 				if err != nil {
+					cstats.transformErrors++
 					fmsg := "%v ##%x TransformRoute: %v for index %v docid %s\n"
 					logging.Errorf(fmsg, logPrefix, m.Opaque, err, engine.GetIndexName(),
 						logging.TagStrUD(m.Key))
 				}
-				// TODO: Shrink the buffer periodically or as needed
-				if cap(newBuf) > cap(worker.encodeBuf) {
-					worker.encodeBuf = newBuf[:0]
-				}
+				worker.encodeBuf =
+					worker.bufPool.Retain(worker.encodeBuf, newBuf, worker.feed.memory)
 			}
+			hits, misses := evalCache.Stats()
+			worker.stats.evalCacheHits.Add(hits)
+			worker.stats.evalCacheMisses.Add(misses)
 			// send data to corresponding endpoint.
 			for raddr, data := range dataForEndpoints {
 				if endpoint, ok := worker.endpoints[raddr]; ok {
-					// FIXME: without the coordinator doing shared topic
-					// management, we will allow the feed to block.
-					// Otherwise, send might fail due to ErrorChannelFull
-					// or ErrorClosed
-					if err := endpoint.Send(data); err != nil {
-						fmsg := "%v ##%x endpoint(%q).Send() failed: %v"
-						logging.Debugf(fmsg, logPrefix, worker.opaque, raddr, err)
-						endpoint.Close()
-						delete(worker.endpoints, raddr)
-					}
+					worker.throttleEgress(data)
+					worker.send2Endpoint(raddr, endpoint, data)
 				}
 			}
 		}
@@ -536,13 +786,7 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 			processMutation(engines)
 		} else {
 			// Generate updateSeqno message and propagate it to indexer
-			worker.stats.updateSeqno.Add(1)
-			if data := v.makeUpdateSeqnoData(m, worker.engines); data != nil {
-				worker.broadcast2Endpoints(data)
-			} else {
-				fmsg := "%v ##%x SYSTEM_EVENT: %v NOT PUBLISHED for vbucket %v\n"
-				logging.Errorf(fmsg, logPrefix, m.Opaque, m, vbno)
-			}
+			worker.updateSeqno(v, m)
 		}
 
 	case mcd.DCP_SYSTEM_EVENT:
@@ -600,20 +844,184 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 	return v
 }
 
+// isUnindexedMutation returns true for a mutation of a collection which
+// has no index on this worker.
+func (worker *VbucketWorker) isUnindexedMutation(m *mc.DcpEvent) bool {
+	switch m.Opcode {
+	case mcd.DCP_MUTATION, mcd.DCP_DELETION, mcd.DCP_EXPIRATION:
+		_, ok := worker.engines[m.CollectionID]
+		return !ok
+	}
+	return false
+}
+
+// updateSeqno sends an UpdateSeqno message for a mutation of a collection
+// which has no index on this worker. Within updateSeqnoInterval of the last
+// UpdateSeqno of the vbucket, the message is held back and replaced by the
+// next one, so that only the latest seqno is sent. A held back message is
+// sent before any other message of the vbucket, or on the next sync pulse.
+func (worker *VbucketWorker) updateSeqno(v *Vbucket, m *mc.DcpEvent) {
+	now := time.Now()
+	if worker.updateSeqnoInterval > 0 &&
+		now.Sub(v.updateSeqnoTime) < worker.updateSeqnoInterval {
+
+		v.updateSeqnoPending = true
+		v.updateSeqnoCollId = m.CollectionID
+		worker.stats.updateSeqnoCoalesced.Add(1)
+		worker.getCollectionStats(m.CollectionID).updateSeqnoCoalesced++
+		return
+	}
+	worker.sendUpdateSeqno(v, m, now)
+}
+
+func (worker *VbucketWorker) sendUpdateSeqno(v *Vbucket, m *mc.DcpEvent, now time.Time) {
+	v.updateSeqnoPending = false
+	v.updateSeqnoTime = now
+	worker.stats.updateSeqno.Add(1)
+	worker.getCollectionStats(m.CollectionID).updateSeqno++
+	if data := v.makeUpdateSeqnoData(m, worker.engines); data != nil {
+		worker.broadcast2Endpoints(data)
+	} else {
+		fmsg := "%v ##%x SYSTEM_EVENT: %v NOT PUBLISHED for vbucket %v\n"
+		logging.Errorf(fmsg, worker.logPrefix, m.Opaque, m, v.vbno)
+	}
+}
+
+// flushUpdateSeqno sends the UpdateSeqno held back for vbucket `v`, if any.
+func (worker *VbucketWorker) flushUpdateSeqno(v *Vbucket) {
+	if !v.updateSeqnoPending {
+		return
+	}
+	m := &mc.DcpEvent{
+		Opcode:       mcd.DCP_MUTATION,
+		VBucket:      v.vbno,
+		Opaque:       v.opaque,
+		Seqno:        v.seqno,
+		CollectionID: v.updateSeqnoCollId,
+	}
+	worker.sendUpdateSeqno(v, m, time.Now())
+}
+
+// getCollectionStats returns the statistics of collection `cid`.
+func (worker *VbucketWorker) getCollectionStats(cid uint32) *collectionStats {
+	cstats, ok := worker.collStats[cid]
+	if !ok {
+		cstats = &collectionStats{}
+		worker.collStats[cid] = cstats
+	}
+	return cstats
+}
+
+// throttleEgress blocks until keyspace and topic bandwidth limits allow
+// `data` to be sent downstream. Only mutations are throttled, control
+// messages are always let through.
+func (worker *VbucketWorker) throttleEgress(data interface{}) {
+	if dkv, ok := data.(*c.DataportKeyVersions); ok && dkv.Kv != nil {
+		size := dkv.Kv.Size()
+		worker.throttle.Wait(size, worker.finch)
+		worker.feed.throttle.Wait(size, worker.finch)
+		worker.prioritizeEgress(size)
+	}
+}
+
+// prioritizeEgress accounts bytes sent by MAINT_STREAM and INIT_STREAM
+// workers, and blocks an INIT_STREAM worker as long as INIT_STREAM is over
+// its share while MAINT_STREAM is backlogged.
+func (worker *VbucketWorker) prioritizeEgress(size int) {
+	if !worker.maintStream && !worker.initStream {
+		return
+	}
+	worker.priorityBytes += size
+	if worker.priorityBytes < streamPriorityBatchSize {
+		return
+	}
+	if worker.maintStream {
+		worker.priority.AddMaint(worker.priorityBytes)
+	} else {
+		worker.priority.WaitInit(worker.priorityBytes, worker.finch)
+	}
+	worker.priorityBytes = 0
+}
+
 // send to all endpoints.
 func (worker *VbucketWorker) broadcast2Endpoints(data interface{}) {
 	for raddr, endpoint := range worker.endpoints {
-		// FIXME: without the coordinator doing shared topic
-		// management, we will allow the feed to block.
-		// Otherwise, send might fail due to ErrorChannelFull
-		// or ErrorClosed
-		if err := endpoint.Send(data); err != nil {
-			fmsg := "%v ##%x endpoint(%q).Send() failed: %v"
-			logging.Debugf(fmsg, worker.logPrefix, worker.opaque, raddr, err)
-			endpoint.Close()
-			delete(worker.endpoints, raddr)
+		worker.send2Endpoint(raddr, endpoint, data)
+	}
+}
+
+// send to a single endpoint. If the endpoint's queue is full, worker
+// pauses until the endpoint drains, which in turn stops this worker from
+// consuming its data channel and flow controls the upstream DCP
+// connection for its vbuckets. Endpoint is dropped if it is closed, if
+// it does not drain within `maxPause`, or right away if `maxPause` is 0.
+func (worker *VbucketWorker) send2Endpoint(
+	raddr string, endpoint c.RouterEndpoint, data interface{}) {
+
+	err := endpoint.Send(data)
+	if err == c.ErrorChannelFull {
+		err = worker.pauseOnEndpoint(raddr, endpoint, data)
+	}
+	if err != nil {
+		fmsg := "%v ##%x endpoint(%q).Send() failed: %v"
+		logging.Debugf(fmsg, worker.logPrefix, worker.opaque, raddr, err)
+		endpoint.Close()
+		delete(worker.endpoints, raddr)
+	}
+}
+
+func (worker *VbucketWorker) pauseOnEndpoint(
+	raddr string, endpoint c.RouterEndpoint, data interface{}) (err error) {
+
+	if worker.maxPause <= 0 {
+		return c.ErrorChannelFull
+	}
+
+	fmsg := "%v ##%x endpoint(%q) full, pausing vbuckets %v\n"
+	logging.Warnf(fmsg, worker.logPrefix, worker.opaque, raddr, worker.vbnos())
+
+	start := time.Now()
+	worker.stats.pauseCount.Add(1)
+	worker.stats.paused.Set(true)
+	defer func() {
+		elapsed := time.Since(start)
+		worker.stats.paused.Set(false)
+		worker.stats.pauseDuration.Add(uint64(elapsed))
+		if uint64(elapsed) > worker.stats.maxPause.Value() {
+			worker.stats.maxPause.Set(uint64(elapsed))
+		}
+		fmsg := "%v ##%x endpoint(%q) resumed after %v, err: %v\n"
+		logging.Infof(fmsg, worker.logPrefix, worker.opaque, raddr, elapsed, err)
+	}()
+
+	backoff := time.Millisecond
+	for err = c.ErrorChannelFull; err == c.ErrorChannelFull; {
+		if time.Since(start) > worker.maxPause {
+			return err
+		} else if !endpoint.Ping() {
+			return c.ErrorClosed
 		}
+		select {
+		case <-time.After(backoff):
+		case <-worker.stopch:
+			return c.ErrorClosed
+		case <-worker.finch:
+			return c.ErrorClosed
+		}
+		if backoff *= 2; backoff > 100*time.Millisecond {
+			backoff = 100 * time.Millisecond
+		}
+		err = endpoint.Send(data)
+	}
+	return err
+}
+
+func (worker *VbucketWorker) vbnos() []uint16 {
+	vbnos := make([]uint16, 0, len(worker.vbuckets))
+	for vbno := range worker.vbuckets {
+		vbnos = append(vbnos, vbno)
 	}
+	return vbnos
 }
 
 func (worker *VbucketWorker) printCtrl(v interface{}) {
@@ -106,6 +106,9 @@ type IndexEvaluator struct {
 	skExprs    []interface{} // compiled expression
 	pkExprs    []interface{} // compiled expression
 	whExpr     interface{}   // compiled expression
+	skKeys     []string      // expression text, to lookup EvalCache
+	pkKeys     []string      // expression text, to lookup EvalCache
+	whKeys     []string      // expression text, to lookup EvalCache
 	instance   *IndexInst
 	version    FeedVersion
 	xattrs     []string
@@ -140,6 +143,7 @@ func NewIndexEvaluator(
 		if err != nil {
 			return nil, err
 		}
+		ie.skKeys = exprs
 		// expression to evaluate partition key
 		exprs = defn.GetPartnExpressions()
 		xattrExprs = append(xattrExprs, exprs...)
@@ -148,7 +152,7 @@ func NewIndexEvaluator(
 			if err != nil {
 				return nil, err
 			} else if len(cExprs) > 0 {
-				ie.pkExprs = cExprs
+				ie.pkExprs, ie.pkKeys = cExprs, exprs
 			}
 		}
 		// expression to evaluate where clause
@@ -159,7 +163,7 @@ func NewIndexEvaluator(
 			if err != nil {
 				return nil, err
 			} else if len(cExprs) > 0 {
-				ie.whExpr = cExprs[0]
+				ie.whExpr, ie.whKeys = cExprs[0], []string{expr}
 			}
 		}
 		_, xattrNames, _ := qu.GetXATTRNames(xattrExprs)
@@ -280,7 +284,8 @@ func (ie *IndexEvaluator) StreamEndData(
 }
 
 func (ie *IndexEvaluator) processEvent(m *mc.DcpEvent, encodeBuf []byte,
-	docval qvalue.AnnotatedValue, context qexpr.Context) (npkey, opkey, nkey, okey, newBuf []byte,
+	docval qvalue.AnnotatedValue, context qexpr.Context,
+	evalCache *c.EvalCache) (npkey, opkey, nkey, okey, newBuf []byte,
 	where bool, opcode mcd.CommandCode, err error) {
 
 	defer func() { // panic safe
@@ -309,18 +314,18 @@ func (ie *IndexEvaluator) processEvent(m *mc.DcpEvent, encodeBuf []byte,
 	}
 
 	ie.dcpEvent2Meta(m, docval)
-	where, err = ie.wherePredicate(m, docval, context, encodeBuf)
+	where, err = ie.wherePredicate(m, docval, context, encodeBuf, evalCache)
 	if err != nil {
 		return npkey, opkey, nkey, okey, newBuf, where, opcode, err
 	}
 
-	npkey, err = ie.partitionKey(m, m.Key, docval, context, encodeBuf)
+	npkey, err = ie.partitionKey(m, m.Key, docval, context, encodeBuf, evalCache)
 	if err != nil {
 		return npkey, opkey, nkey, okey, newBuf, where, opcode, err
 	}
 
 	if where && (len(m.Value) > 0 || retainDelete) { // project new secondary key
-		nkey, newBuf, err = ie.evaluate(m, m.Key, docval, context, encodeBuf)
+		nkey, newBuf, err = ie.evaluate(m, m.Key, docval, context, encodeBuf, evalCache)
 		if err != nil {
 			return npkey, opkey, nkey, okey, newBuf, where, opcode, err
 		}
@@ -329,11 +334,11 @@ func (ie *IndexEvaluator) processEvent(m *mc.DcpEvent, encodeBuf []byte,
 		nvalue := qvalue.NewParsedValueWithOptions(m.OldValue, true, true)
 		oldval := qvalue.NewAnnotatedValue(nvalue)
 		oldval.ShareAnnotations(docval)
-		opkey, err = ie.partitionKey(m, m.Key, oldval, context, encodeBuf)
+		opkey, err = ie.partitionKey(m, m.Key, oldval, context, encodeBuf, nil)
 		if err != nil {
 			return npkey, opkey, nkey, okey, newBuf, where, opcode, err
 		}
-		okey, newBuf, err = ie.evaluate(m, m.Key, oldval, context, encodeBuf)
+		okey, newBuf, err = ie.evaluate(m, m.Key, oldval, context, encodeBuf, nil)
 		if err != nil {
 			return npkey, opkey, nkey, okey, newBuf, where, opcode, err
 		}
@@ -346,7 +351,7 @@ func (ie *IndexEvaluator) processEvent(m *mc.DcpEvent, encodeBuf []byte,
 func (ie *IndexEvaluator) TransformRoute(
 	vbuuid uint64, m *mc.DcpEvent, data map[string]interface{}, encodeBuf []byte,
 	docval qvalue.AnnotatedValue, context qexpr.Context,
-	numIndexes int, opaque2 uint64) ([]byte, error) {
+	numIndexes int, opaque2 uint64, evalCache *c.EvalCache) ([]byte, error) {
 
 	var err error
 	var npkey /*new-partition*/, opkey /*old-partition*/, nkey, okey []byte
@@ -356,7 +361,7 @@ func (ie *IndexEvaluator) TransformRoute(
 
 	forceUpsertDeletion := false
 	npkey, opkey, nkey, okey, newBuf, where, opcode, err = ie.processEvent(m,
-		encodeBuf, docval, context)
+		encodeBuf, docval, context, evalCache)
 	if err != nil {
 		forceUpsertDeletion = true
 	}
@@ -484,7 +489,8 @@ func (ie *IndexEvaluator) Stats() interface{} {
 
 func (ie *IndexEvaluator) evaluate(
 	m *mc.DcpEvent, docid []byte, docval qvalue.AnnotatedValue,
-	context qexpr.Context, encodeBuf []byte) ([]byte, []byte, error) {
+	context qexpr.Context, encodeBuf []byte,
+	evalCache *c.EvalCache) ([]byte, []byte, error) {
 
 	defn := ie.instance.GetDefinition()
 	if defn.GetIsPrimary() { // primary index supported !!
@@ -494,14 +500,17 @@ func (ie *IndexEvaluator) evaluate(
 	exprType := defn.GetExprType()
 	switch exprType {
 	case ExprType_N1QL:
-		return N1QLTransform(docid, docval, context, ie.skExprs, encodeBuf, ie.stats)
+		return n1qlTransform(
+			docid, docval, context, ie.skExprs, ie.skKeys, encodeBuf, ie.stats,
+			evalCache)
 	}
 	return nil, nil, nil
 }
 
 func (ie *IndexEvaluator) partitionKey(
 	m *mc.DcpEvent, docid []byte, docval qvalue.AnnotatedValue,
-	context qexpr.Context, encodeBuf []byte) ([]byte, error) {
+	context qexpr.Context, encodeBuf []byte,
+	evalCache *c.EvalCache) ([]byte, error) {
 
 	defn := ie.instance.GetDefinition()
 	if ie.pkExprs == nil { // no partition key
@@ -511,7 +520,9 @@ func (ie *IndexEvaluator) partitionKey(
 	exprType := defn.GetExprType()
 	switch exprType {
 	case ExprType_N1QL:
-		out, _, err := N1QLTransform(docid, docval, context, ie.pkExprs, nil, ie.stats)
+		out, _, err := n1qlTransform(
+			docid, docval, context, ie.pkExprs, ie.pkKeys, nil, ie.stats,
+			evalCache)
 		return out, err
 	}
 	return nil, nil
@@ -519,7 +530,8 @@ func (ie *IndexEvaluator) partitionKey(
 
 func (ie *IndexEvaluator) wherePredicate(
 	m *mc.DcpEvent, docval qvalue.AnnotatedValue,
-	context qexpr.Context, encodeBuf []byte) (bool, error) {
+	context qexpr.Context, encodeBuf []byte,
+	evalCache *c.EvalCache) (bool, error) {
 
 	// if where predicate is not supplied - always evaluate to `true`
 	if ie.whExpr == nil {
@@ -531,7 +543,9 @@ func (ie *IndexEvaluator) wherePredicate(
 	switch exprType {
 	case ExprType_N1QL:
 		// TODO: can be optimized by using a custom N1QL-evaluator.
-		out, _, err := N1QLTransform(nil, docval, context, []interface{}{ie.whExpr}, encodeBuf, ie.stats)
+		out, _, err := n1qlTransform(
+			nil, docval, context, []interface{}{ie.whExpr}, ie.whKeys,
+			encodeBuf, ie.stats, evalCache)
 		if out == nil { // missing is treated as false
 			return false, err
 		} else if err != nil { // errors are treated as false
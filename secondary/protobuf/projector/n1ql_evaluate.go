@@ -1,6 +1,7 @@
 package protoProjector
 
 import "time"
+import c "github.com/couchbase/indexing/secondary/common"
 import "github.com/couchbase/indexing/secondary/logging"
 import "github.com/couchbase/indexing/secondary/collatejson"
 import qexpr "github.com/couchbase/query/expression"
@@ -33,15 +34,35 @@ func N1QLTransform(
 	cExprs []interface{},
 	encodeBuf []byte, stats *IndexEvaluatorStats) ([]byte, []byte, error) {
 
+	return n1qlTransform(
+		docid, docval, context, cExprs, nil, encodeBuf, stats, nil)
+}
+
+// n1qlTransform is N1QLTransform, looking up and populating evalCache with
+// results of expressions, keyed by their text in exprKeys.
+func n1qlTransform(
+	docid []byte, docval qvalue.AnnotatedValue, context qexpr.Context,
+	cExprs []interface{}, exprKeys []string,
+	encodeBuf []byte, stats *IndexEvaluatorStats,
+	evalCache *c.EvalCache) ([]byte, []byte, error) {
+
 	arrValue := make([]interface{}, 0, len(cExprs))
 	isLeadingKey := true
-	for _, cExpr := range cExprs {
+	for i, cExpr := range cExprs {
 		expr := cExpr.(qexpr.Expression)
-		start := time.Now()
-		scalar, vector, err := expr.EvaluateForIndex(docval, context)
-		elapsed := time.Since(start)
-		if stats != nil {
-			stats.add(elapsed)
+		key := ""
+		if i < len(exprKeys) {
+			key = exprKeys[i]
+		}
+		scalar, vector, err, ok := evalCache.Get(docval, key)
+		if !ok {
+			start := time.Now()
+			scalar, vector, err = expr.EvaluateForIndex(docval, context)
+			elapsed := time.Since(start)
+			if stats != nil {
+				stats.add(elapsed)
+			}
+			evalCache.Put(docval, key, scalar, vector, err)
 		}
 		if err != nil {
 			exprstr := qexpr.NewStringer().Visit(expr)
@@ -185,6 +185,11 @@ func (b *cbqClient) BuildIndexes(defnID []uint64) error {
 	panic("cbqClient does not implement build-indexes")
 }
 
+// BuildIndexesWithResults implement BridgeAccessor{} interface.
+func (b *cbqClient) BuildIndexesWithResults(defnID []uint64) (map[uint64]*mclient.BuildIndexResult, error) {
+	panic("cbqClient does not implement build-indexes")
+}
+
 // MoveIndex implement BridgeAccessor{} interface.
 func (b *cbqClient) MoveIndex(defnID uint64, plan map[string]interface{}) error {
 	panic("cbqClient does not implement move index")
@@ -232,7 +237,7 @@ func (b *cbqClient) GetScanports() (queryports []string) {
 func (b *cbqClient) GetScanport(
 	defnID uint64,
 	excludes map[common.IndexDefnId]map[common.PartitionId]map[uint64]bool,
-	skips map[common.IndexDefnId]bool) (queryport []string,
+	skips map[common.IndexDefnId]bool, filter PartitionFilter) (queryport []string,
 	targetDefnID uint64, targetIndstID []uint64, rollbackTime []int64,
 	partition [][]common.PartitionId, numPartition uint32, ok bool) {
 
@@ -0,0 +1,129 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+//
+// circuitBreaker tracks the health of indexer nodes by queryport.  After
+// a number of consecutive failed scans, the circuit of a node is opened and
+// scans are routed to replicas on other nodes.  Once the cooldown is over,
+// the node is probed in the background, and the circuit is closed when
+// the probe succeeds.  Otherwise the circuit stays open for another
+// cooldown.
+//
+type circuitBreaker struct {
+	mutex sync.Mutex
+	nodes map[string]*nodeCircuit
+
+	// returns true if the node at queryport is healthy
+	probe func(queryport string) bool
+}
+
+type nodeCircuit struct {
+	failures  int
+	open      bool
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(probe func(queryport string) bool) *circuitBreaker {
+	return &circuitBreaker{
+		nodes: make(map[string]*nodeCircuit),
+		probe: probe,
+	}
+}
+
+func (cb *circuitBreaker) getNode(queryport string) *nodeCircuit {
+	node, ok := cb.nodes[queryport]
+	if !ok {
+		node = &nodeCircuit{}
+		cb.nodes[queryport] = node
+	}
+	return node
+}
+
+// isOpen returns true if scans should not be sent to the node at queryport.
+func (cb *circuitBreaker) isOpen(queryport string, cooldown time.Duration) bool {
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	node, ok := cb.nodes[queryport]
+	if !ok || !node.open {
+		return false
+	}
+
+	if !node.probing && time.Now().After(node.openUntil) {
+		node.probing = true
+		go cb.runProbe(queryport, cooldown)
+	}
+
+	return true
+}
+
+func (cb *circuitBreaker) runProbe(queryport string, cooldown time.Duration) {
+
+	healthy := cb.probe(queryport)
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	node := cb.getNode(queryport)
+	node.probing = false
+
+	if healthy {
+		logging.Infof("CircuitBreaker: indexer %v is healthy. Closing circuit.", queryport)
+		node.open = false
+		node.failures = 0
+		return
+	}
+
+	logging.Warnf("CircuitBreaker: indexer %v is still unhealthy. Keeping circuit open for %v.",
+		queryport, cooldown)
+	node.openUntil = time.Now().Add(cooldown)
+}
+
+// success records a successful scan on the node at queryport.
+func (cb *circuitBreaker) success(queryport string) {
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if node, ok := cb.nodes[queryport]; ok && !node.open {
+		node.failures = 0
+	}
+}
+
+// failure records a failed scan on the node at queryport, and opens the
+// circuit after threshold consecutive failures.
+func (cb *circuitBreaker) failure(queryport string, threshold int, cooldown time.Duration) {
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	node := cb.getNode(queryport)
+	if node.open {
+		return
+	}
+
+	node.failures++
+	if node.failures >= threshold {
+		logging.Warnf("CircuitBreaker: %v consecutive scans failed on indexer %v. Opening circuit for %v.",
+			node.failures, queryport, cooldown)
+		node.open = true
+		node.openUntil = time.Now().Add(cooldown)
+	}
+}
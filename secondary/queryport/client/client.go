@@ -56,6 +56,12 @@ type ResponseReader interface {
 	Error() error
 }
 
+// ResumeKeyReader is implemented by responses that carry the key to
+// resume an ordered scan from.
+type ResumeKeyReader interface {
+	GetResumeKey() []byte
+}
+
 // ResponseSender is responsible for forwarding result to the client
 // after streams from multiple servers/ResponseHandler have been merged.
 // mskey - marshalled sec key (as Value)
@@ -80,6 +86,10 @@ type BackfillWaiter func()
 // scanClientMaker fetches a scan client
 type scanClientMaker func(scanport string) *GsiScanClient
 
+// PartitionFilter returns the partitions of the index that a request
+// needs to be sent to, or nil if it needs to be sent to all partitions.
+type PartitionFilter func(defn *common.IndexDefn, numPartition uint32) map[common.PartitionId]bool
+
 // Remoteaddr string in the shape of "<host:port>"
 type Remoteaddr string
 
@@ -91,6 +101,11 @@ type Scans []*Scan
 type Scan struct {
 	Seek   common.SecondaryKey
 	Filter []*CompositeElementFilter
+
+	// Filters on the fields of the array key element of an index with
+	// flattened array keys, e.g. ARRAY [v.a, v.b] FOR v IN arr END. They
+	// are applied by the indexer to each element, i-th filter to i-th field.
+	ArrayFilter []*CompositeElementFilter
 }
 
 type CompositeElementFilter struct {
@@ -192,6 +207,10 @@ type BridgeAccessor interface {
 	// that indexes specified are already created.
 	BuildIndexes(defnIDs []uint64) error
 
+	// BuildIndexesWithResults to build a deferred set of indexes, and
+	// return the outcome of the build request of each index.
+	BuildIndexesWithResults(defnIDs []uint64) (map[uint64]*mclient.BuildIndexResult, error)
+
 	// MoveIndex to move a set of indexes to different node.
 	MoveIndex(defnID uint64, with map[string]interface{}) error
 
@@ -211,11 +230,12 @@ type BridgeAccessor interface {
 	// if `retry` is ZERO, pick the indexer under least
 	// load, else do a round-robin, based on the retry count,
 	// if more than one indexer is found hosing the index or an
-	// equivalent index.
+	// equivalent index.  If `filter` is not nil, only the partitions
+	// returned by filter for the picked index are looked up.
 	GetScanport(
 		defnID uint64,
 		excludes map[common.IndexDefnId]map[common.PartitionId]map[uint64]bool,
-		skips map[common.IndexDefnId]bool) (queryport []string, targetDefnID uint64, targetInstID []uint64,
+		skips map[common.IndexDefnId]bool, filter PartitionFilter) (queryport []string, targetDefnID uint64, targetInstID []uint64,
 		rollbackTime []int64, partition [][]common.PartitionId, numPartitions uint32, ok bool)
 
 	// GetIndexDefn will return the index-definition structure for defnID.
@@ -397,6 +417,7 @@ type GsiClient struct {
 	scanResponse int64
 	dataEncFmt   uint32
 	qcLock       sync.Mutex
+	breaker      *circuitBreaker
 }
 
 // NewGsiClient returns client to access GSI cluster.
@@ -593,6 +614,20 @@ func (c *GsiClient) BuildIndexes(defnIDs []uint64) error {
 	return err
 }
 
+// BuildIndexesWithResults implements BridgeAccessor{} interface.
+func (c *GsiClient) BuildIndexesWithResults(defnIDs []uint64) (map[uint64]*mclient.BuildIndexResult, error) {
+	if c.bridge == nil {
+		return nil, ErrorClientUninitialized
+	}
+
+	logging.Infof("BuildIndexesWithResults %v ...", defnIDs)
+	begin := time.Now()
+	results, err := c.bridge.BuildIndexesWithResults(defnIDs)
+	fmsg := "BuildIndexesWithResults %v - elapsed(%v), err(%v)"
+	logging.Infof(fmsg, defnIDs, time.Since(begin), err)
+	return results, err
+}
+
 // MoveIndex implements BridgeAccessor{} interface.
 func (c *GsiClient) MoveIndex(defnID uint64, with map[string]interface{}) error {
 	if c.bridge == nil {
@@ -884,14 +919,14 @@ func (c *GsiClient) MultiScanInternal(
 		if c.bridge.IsPrimary(uint64(index.DefnId)) {
 			return qc.MultiScanPrimary(
 				uint64(index.DefnId), requestId, scans, reverse, distinct,
-				projection, broker.GetOffset(), broker.GetLimit(), cons,
-				vector, handler, rollbackTime, partitions, dataEncFmt, broker.DoRetry())
+				projection, broker.GetOffset(), broker.GetLimit(), broker.GetResumeKey(),
+				cons, vector, handler, rollbackTime, partitions, dataEncFmt, broker.DoRetry())
 		}
 
 		return qc.MultiScan(
 			uint64(index.DefnId), requestId, scans, reverse, distinct,
-			projection, broker.GetOffset(), broker.GetLimit(), cons, vector,
-			handler, rollbackTime, partitions, dataEncFmt, broker.DoRetry())
+			projection, broker.GetOffset(), broker.GetLimit(), broker.GetResumeKey(),
+			cons, vector, handler, rollbackTime, partitions, dataEncFmt, broker.DoRetry())
 	}
 
 	broker.SetScanRequestHandler(handler)
@@ -1077,14 +1112,22 @@ func (c *GsiClient) MultiScanCountInternal(
 		if err != nil {
 			return 0, err, false
 		}
+
+		timeout, err := broker.GetTimeout()
+		if err != nil {
+			return 0, err, false
+		}
+
 		if c.bridge.IsPrimary(uint64(index.DefnId)) {
 			count, err = qc.MultiScanCountPrimary(
-				uint64(index.DefnId), requestId, scans, distinct, cons, vector, rollbackTime, partitions, broker.DoRetry())
+				uint64(index.DefnId), requestId, scans, distinct, cons, vector, rollbackTime, partitions, broker.DoRetry(),
+				timeout)
 			return count, err, false
 		}
 
 		count, err = qc.MultiScanCount(
-			uint64(index.DefnId), requestId, scans, distinct, cons, vector, rollbackTime, partitions, broker.DoRetry())
+			uint64(index.DefnId), requestId, scans, distinct, cons, vector, rollbackTime, partitions, broker.DoRetry(),
+			timeout)
 		return count, err, false
 	}
 
@@ -1139,19 +1182,24 @@ func (c *GsiClient) Scan3Internal(
 			return err, false
 		}
 
+		timeout, err := broker.GetTimeout()
+		if err != nil {
+			return err, false
+		}
+
 		if c.bridge.IsPrimary(uint64(index.DefnId)) {
 			return qc.Scan3Primary(
 				uint64(index.DefnId), requestId, scans, reverse, distinct,
 				projection, broker.GetOffset(), broker.GetLimit(), groupAggr,
 				broker.GetSorted(), cons, vector, handler, rollbackTime,
-				partitions, dataEncFmt, broker.DoRetry())
+				partitions, dataEncFmt, broker.DoRetry(), timeout)
 		}
 
 		return qc.Scan3(
 			uint64(index.DefnId), requestId, scans, reverse, distinct,
 			projection, broker.GetOffset(), broker.GetLimit(), groupAggr,
 			broker.GetSorted(), cons, vector, handler, rollbackTime,
-			partitions, dataEncFmt, broker.DoRetry())
+			partitions, dataEncFmt, broker.DoRetry(), timeout)
 	}
 
 	broker.SetScanRequestHandler(handler)
@@ -1174,6 +1222,64 @@ func (c *GsiClient) Scan3Internal(
 	return
 }
 
+// VectorScan returns the entries of a vector index nearest to queryVector,
+// in increasing order of distance. limit is required, and is at most
+// indexer.scan.vector_max_limit together with offset.
+func (c *GsiClient) VectorScan(
+	defnID uint64, requestId string, queryVector []float32,
+	projection *IndexProjection, offset, limit int64,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler) (err error) {
+
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+
+	// check whether the index is present and available.
+	if _, err = c.bridge.IndexState(defnID); err != nil {
+		return err
+	}
+
+	begin := time.Now()
+
+	dataEncFmt := c.GetDataEncodingFormat()
+	broker := makeDefaultRequestBroker(callb, dataEncFmt)
+
+	handler := func(qc *GsiScanClient, index *common.IndexDefn, rollbackTime int64, partitions []common.PartitionId,
+		handler ResponseHandler) (error, bool) {
+		var err error
+
+		vector, err = c.getConsistency(qc, cons, vector, index.Bucket)
+		if err != nil {
+			return err, false
+		}
+
+		timeout, err := broker.GetTimeout()
+		if err != nil {
+			return err, false
+		}
+
+		return qc.VectorScan(
+			uint64(index.DefnId), requestId, queryVector, projection,
+			broker.GetOffset(), broker.GetLimit(), cons, vector, handler,
+			rollbackTime, partitions, broker.GetDataEncodingFormat(), broker.DoRetry(), timeout)
+	}
+
+	broker.SetScanRequestHandler(handler)
+	broker.SetLimit(limit)
+	broker.SetOffset(offset)
+	broker.SetProjection(projection)
+
+	_, err = c.doScan(defnID, requestId, broker)
+	if err != nil { // callback with error
+		return err
+	}
+
+	fmsg := "VectorScan {%v,%v} - elapsed(%v) err(%v)"
+	logging.Verbosef(fmsg, defnID, requestId, time.Since(begin), err)
+	return
+}
+
 //-------------------------------------
 // StorageStatistics implementation
 //-------------------------------------
@@ -1219,7 +1325,7 @@ func (c *GsiClient) StorageStatistics(defnID uint64, requestId string) ([]map[st
 		return nil, nil
 	}
 
-	if queryports, _, targetInstIds, _, partitions, _, ok := c.bridge.GetScanport(defnID, excludes, skips); ok {
+	if queryports, _, targetInstIds, _, partitions, _, ok := c.bridge.GetScanport(defnID, excludes, skips, nil); ok {
 
 		// urls is list of Stats REST endpoints for all indexer nodes
 		// hosting the requested index
@@ -1355,6 +1461,17 @@ func (c *GsiClient) Settings() *ClientSettings {
 	return c.settings
 }
 
+// GetConnPoolStats returns the metrics of the connection pool to each
+// indexer, by queryport.
+func (c *GsiClient) GetConnPoolStats() map[string]ConnPoolStats {
+	stats := make(map[string]ConnPoolStats)
+	qcs := *((*map[string]*GsiScanClient)(atomic.LoadPointer(&c.queryClients)))
+	for queryport, qc := range qcs {
+		stats[queryport] = qc.ConnPoolStats()
+	}
+	return stats
+}
+
 // Close the client and all open connections with server.
 func (c *GsiClient) Close() {
 	if c == nil {
@@ -1582,12 +1699,26 @@ func (c *GsiClient) doScan(defnID uint64, requestId string, broker *RequestBroke
 	broker.SetResponseTimer(c.bridge.Timeit)
 	skips := make(map[common.IndexDefnId]bool)
 
+	// the indexer times out the scan after scan_timeout anyway
+	broker.setDefaultTimeout(c.settings.ScanTimeout())
+
+	broker.startProfile()
+	defer broker.finishProfile()
+
 	wait := c.config["retryIntervalScanport"].Int()
 	retry := c.config["retryScanPort"].Int()
 	for i := 0; true; {
 		foundScanport := false
 
-		queryports, targetDefnID, targetInstIds, rollbackTimes, partitions, numPartitions, ok := c.bridge.GetScanport(defnID, excludes, skips)
+		// do not retry once the caller has given up on the request
+		if _, err := broker.GetTimeout(); err != nil {
+			return 0, err
+		}
+
+		// Look up only the partitions needed by the scans, so that the scan
+		// does not depend on the availability of the other partitions.
+		queryports, targetDefnID, targetInstIds, rollbackTimes, partitions, numPartitions, ok :=
+			c.bridge.GetScanport(defnID, excludes, skips, broker.PartitionFilter)
 		var index *common.IndexDefn
 		if ok {
 			index = c.bridge.GetIndexDefn(targetDefnID)
@@ -1597,12 +1728,32 @@ func (c *GsiClient) doScan(defnID uint64, requestId string, broker *RequestBroke
 		}
 
 		if ok && index != nil {
+			// Route the scan away from unhealthy indexers if there is a replica
+			// on another indexer.
+			if healthyExcludes, found := c.excludeOpenCircuits(common.IndexDefnId(targetDefnID), excludes, queryports,
+				targetInstIds, partitions); found {
+
+				healthyports, healthyDefnID, healthyInstIds, healthyRollbacks, healthyPartitions, healthyNumPartitions, ok :=
+					c.bridge.GetScanport(defnID, healthyExcludes, skips, broker.PartitionFilter)
+				if ok {
+					if healthyIndex := c.bridge.GetIndexDefn(healthyDefnID); healthyIndex != nil {
+						queryports, targetDefnID, targetInstIds = healthyports, healthyDefnID, healthyInstIds
+						rollbackTimes, partitions, numPartitions = healthyRollbacks, healthyPartitions, healthyNumPartitions
+						index = healthyIndex
+					}
+				}
+			}
+
+			broker.SetHedgeTarget(c.getHedgeTarget(targetDefnID, queryports, targetInstIds, partitions, excludes,
+				broker.PartitionFilter))
+
 			start := time.Now()
 			count, scan_errs, partial, refresh := broker.scatter(c.makeScanClient, index, queryports, targetInstIds,
 				rollbackTimes, partitions, numPartitions, c.settings)
 
 			if !refresh {
 				foundScanport = true
+				c.updateCircuits(queryports, targetInstIds, partitions, scan_errs)
 
 				if c.isTimeit(scan_errs) {
 					c.updateScanResponse(time.Now().Sub(start).Nanoseconds())
@@ -1662,6 +1813,153 @@ func (c *GsiClient) doScan(defnID uint64, requestId string, broker *RequestBroke
 	return 0, ErrorNoHost
 }
 
+//
+// excludeOpenCircuits returns a copy of excludes that also excludes the
+// instances on indexers whose circuit is open.  It returns false if none of
+// the indexers has an open circuit.
+//
+func (c *GsiClient) excludeOpenCircuits(defnId common.IndexDefnId,
+	excludes map[common.IndexDefnId]map[common.PartitionId]map[uint64]bool,
+	queryports []string, targetInstIds []uint64, partitions [][]common.PartitionId) (
+	map[common.IndexDefnId]map[common.PartitionId]map[uint64]bool, bool) {
+
+	if c.settings == nil || c.settings.CircuitBreakerThreshold() == 0 ||
+		len(queryports) != len(targetInstIds) || len(queryports) != len(partitions) {
+		return nil, false
+	}
+
+	cooldown := c.settings.CircuitBreakerCooldown()
+
+	var newExcludes map[common.IndexDefnId]map[common.PartitionId]map[uint64]bool
+	for i, queryport := range queryports {
+		if !c.breaker.isOpen(queryport, cooldown) {
+			continue
+		}
+
+		if newExcludes == nil {
+			newExcludes = make(map[common.IndexDefnId]map[common.PartitionId]map[uint64]bool)
+			for id, partnExcludes := range excludes {
+				newExcludes[id] = make(map[common.PartitionId]map[uint64]bool)
+				for partnId, instExcludes := range partnExcludes {
+					newExcludes[id][partnId] = make(map[uint64]bool)
+					for instId := range instExcludes {
+						newExcludes[id][partnId][instId] = true
+					}
+				}
+			}
+			if _, ok := newExcludes[defnId]; !ok {
+				newExcludes[defnId] = make(map[common.PartitionId]map[uint64]bool)
+			}
+		}
+
+		for _, partnId := range partitions[i] {
+			if _, ok := newExcludes[defnId][partnId]; !ok {
+				newExcludes[defnId][partnId] = make(map[uint64]bool)
+			}
+			newExcludes[defnId][partnId][targetInstIds[i]] = true
+		}
+	}
+
+	return newExcludes, newExcludes != nil
+}
+
+//
+// updateCircuits records the outcome of a scan on each of the indexers
+// it was sent to.  Network errors and timeouts count as failures.
+//
+func (c *GsiClient) updateCircuits(queryports []string, targetInstIds []uint64,
+	partitions [][]common.PartitionId, errMap map[common.PartitionId]map[uint64]error) {
+
+	if c.settings == nil || len(queryports) != len(targetInstIds) || len(queryports) != len(partitions) {
+		return
+	}
+
+	threshold := c.settings.CircuitBreakerThreshold()
+	if threshold == 0 {
+		return
+	}
+	cooldown := c.settings.CircuitBreakerCooldown()
+
+	for i, queryport := range queryports {
+		var scan_err error
+		for _, partnId := range partitions[i] {
+			if err, ok := errMap[partnId][targetInstIds[i]]; ok {
+				scan_err = err
+				break
+			}
+		}
+
+		if scan_err == nil {
+			c.breaker.success(queryport)
+		} else if isgone(scan_err) || scan_err.Error() == common.ErrScanTimedOut.Error() {
+			c.breaker.failure(queryport, threshold, cooldown)
+		}
+	}
+}
+
+// probeScanport returns true if the indexer at queryport responds to a helo.
+func (c *GsiClient) probeScanport(queryport string) bool {
+
+	qc := c.makeScanClient(queryport)
+	if qc == nil {
+		return false
+	}
+
+	if _, err := qc.Helo(); err != nil {
+		logging.Warnf("GsiClient: probe of indexer %v failed: %v", queryport, err)
+		return false
+	}
+	return true
+}
+
+//
+// getHedgeTarget returns a replica, served by another indexer, that the
+// scan served by a single indexer can be hedged to.  It returns nil if
+// hedging is disabled or there is no such replica.
+//
+func (c *GsiClient) getHedgeTarget(defnID uint64, queryports []string, targetInstIds []uint64,
+	partitions [][]common.PartitionId, excludes map[common.IndexDefnId]map[common.PartitionId]map[uint64]bool,
+	filter PartitionFilter) *hedgeTarget {
+
+	threshold := c.settings.ScanHedgeThreshold()
+	if threshold <= 0 || len(queryports) != 1 || len(targetInstIds) != 1 || len(partitions) != 1 {
+		return nil
+	}
+
+	// exclude the instance serving the scan, in addition to the failed ones
+	defnId := common.IndexDefnId(defnID)
+	hedgeExcludes := make(map[common.IndexDefnId]map[common.PartitionId]map[uint64]bool)
+	hedgeExcludes[defnId] = make(map[common.PartitionId]map[uint64]bool)
+	for partnId, instIds := range excludes[defnId] {
+		hedgeExcludes[defnId][partnId] = make(map[uint64]bool)
+		for instId := range instIds {
+			hedgeExcludes[defnId][partnId][instId] = true
+		}
+	}
+	for _, partnId := range partitions[0] {
+		if _, ok := hedgeExcludes[defnId][partnId]; !ok {
+			hedgeExcludes[defnId][partnId] = make(map[uint64]bool)
+		}
+		hedgeExcludes[defnId][partnId][targetInstIds[0]] = true
+	}
+
+	hedgeports, hedgeDefnID, hedgeInstIds, hedgeRollbacks, hedgePartitions, _, ok :=
+		c.bridge.GetScanport(defnID, hedgeExcludes, make(map[common.IndexDefnId]bool), filter)
+	if !ok || hedgeDefnID != defnID || len(hedgeports) != 1 || hedgeports[0] == queryports[0] ||
+		len(hedgePartitions[0]) != len(partitions[0]) {
+		return nil
+	}
+
+	return &hedgeTarget{
+		clientMaker: c.makeScanClient,
+		queryport:   hedgeports[0],
+		instId:      hedgeInstIds[0],
+		rollback:    hedgeRollbacks[0],
+		partitions:  hedgePartitions[0],
+		threshold:   threshold,
+	}
+}
+
 func (c *GsiClient) isTimeit(errMap map[common.PartitionId]map[uint64]error) bool {
 	if len(errMap) == 0 {
 		return true
@@ -1752,6 +2050,7 @@ func makeWithCbq(cluster string, config common.Config, encryptLocalHost bool) (*
 		cluster: cluster,
 		config:  config,
 	}
+	c.breaker = newCircuitBreaker(c.probeScanport)
 
 	if err := c.initSecurityContext(encryptLocalHost); err != nil {
 		return nil, err
@@ -1782,6 +2081,7 @@ func makeWithMetaProvider(
 		settings:     NewClientSettings(needRefresh),
 		killch:       make(chan bool, 1),
 	}
+	c.breaker = newCircuitBreaker(c.probeScanport)
 
 	if err := c.initSecurityContext(encryptLocalHost); err != nil {
 		return nil, err
@@ -1862,6 +2162,10 @@ type TsConsistency struct {
 	Seqnos  []uint64
 	Vbuuids []uint64
 	Crc64   uint64
+
+	// Staleness bound for BoundedStalenessConsistency.
+	MaxStalenessMs     uint64
+	MaxStalenessSeqnos uint64
 }
 
 // NewTsConsistency returns a new consistency vector object.
@@ -1871,6 +2175,15 @@ func NewTsConsistency(
 	return &TsConsistency{Vbnos: vbnos, Seqnos: seqnos, Vbuuids: vbuuids}
 }
 
+// NewBoundedStaleness returns a consistency vector object for
+// BoundedStalenessConsistency. Scan results will miss at most the
+// mutations of the last `ms` milliseconds and at most `seqnos`
+// mutations of each vbucket. A zero bound is not applied.
+func NewBoundedStaleness(ms, seqnos uint64) *TsConsistency {
+
+	return &TsConsistency{MaxStalenessMs: ms, MaxStalenessSeqnos: seqnos}
+}
+
 // Override vbucket's {seqno, vbuuid} in the timestamp-vector,
 // if vbucket is not present in the vector, append them to vector.
 func (ts *TsConsistency) Override(
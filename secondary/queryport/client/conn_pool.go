@@ -43,6 +43,23 @@ type connectionPool struct {
 	relConnBatchSize int32
 	stopCh           chan bool
 	ewma             gometrics.EWMA
+	logStats         int32
+
+	// stats
+	numGets         int64
+	waitTime        int64 // nanoseconds
+	numDialFailures int64
+	numTimeouts     int64
+}
+
+// ConnPoolStats are the metrics of the connection pool to an indexer.
+type ConnPoolStats struct {
+	Active       int32         `json:"active"`       // connections in use
+	Idle         int32         `json:"idle"`         // connections in the pool, not in use
+	NumGets      int64         `json:"numGets"`      // connections requested
+	WaitTime     time.Duration `json:"waitTime"`     // total wait for connections not readily available
+	DialFailures int64         `json:"dialFailures"` // failures to open a new connection
+	Timeouts     int64         `json:"timeouts"`     // requests timed out waiting for a connection
 }
 
 type connection struct {
@@ -115,6 +132,10 @@ func (cp *connectionPool) GetWithTimeout(d time.Duration) (connectn *connection,
 
 	path, ok := "", false
 
+	defer func(start time.Time) {
+		cp.updateGetStats(path, start, err)
+	}(time.Now())
+
 	if ConnPoolCallback != nil {
 		defer func(path *string, start time.Time) {
 			ConnPoolCallback(cp.host, *path, start, err)
@@ -175,6 +196,7 @@ func (cp *connectionPool) GetWithTimeout(d time.Duration) (connectn *connection,
 			if err != nil {
 				// On error, release our create hold
 				<-cp.createsem
+				atomic.AddInt64(&cp.numDialFailures, 1)
 			} else {
 				atomic.AddInt32(&cp.curActConns, 1)
 			}
@@ -194,11 +216,45 @@ func (cp *connectionPool) Renew(conn *connection) (*connection, error) {
 		logging.Infof("%v closing unhealthy connection %q\n", cp.logPrefix, conn.conn.LocalAddr())
 		conn.conn.Close()
 		conn = newConn
+	} else {
+		atomic.AddInt64(&cp.numDialFailures, 1)
 	}
 
 	return conn, err
 }
 
+func (cp *connectionPool) updateGetStats(path string, start time.Time, err error) {
+	atomic.AddInt64(&cp.numGets, 1)
+	if path != "short-circuit" {
+		atomic.AddInt64(&cp.waitTime, int64(time.Since(start)))
+	}
+	if err == ErrorPoolTimeout {
+		atomic.AddInt64(&cp.numTimeouts, 1)
+	}
+}
+
+// Stats returns the current metrics of the pool.
+func (cp *connectionPool) Stats() ConnPoolStats {
+	return ConnPoolStats{
+		Active:       atomic.LoadInt32(&cp.curActConns),
+		Idle:         atomic.LoadInt32(&cp.freeConns),
+		NumGets:      atomic.LoadInt64(&cp.numGets),
+		WaitTime:     time.Duration(atomic.LoadInt64(&cp.waitTime)),
+		DialFailures: atomic.LoadInt64(&cp.numDialFailures),
+		Timeouts:     atomic.LoadInt64(&cp.numTimeouts),
+	}
+}
+
+// SetLogStats enables logging of all the metrics of the pool, instead
+// of only the connection counts, every CONN_COUNT_LOG_INTERVAL.
+func (cp *connectionPool) SetLogStats(enable bool) {
+	if enable {
+		atomic.StoreInt32(&cp.logStats, 1)
+	} else {
+		atomic.StoreInt32(&cp.logStats, 0)
+	}
+}
+
 func (cp *connectionPool) Get() (*connection, error) {
 	return cp.GetWithTimeout(cp.timeout * time.Millisecond)
 }
@@ -315,7 +371,13 @@ func (cp *connectionPool) releaseConnsRoutine() {
 			// Log active and free connection count history every minute.
 			fc := atomic.LoadInt32(&cp.freeConns)
 			if j == CONN_COUNT_LOG_INTERVAL-1 {
-				logging.Infof("%v active conns %v, free conns %v", cp.logPrefix, act, fc)
+				if atomic.LoadInt32(&cp.logStats) == 1 {
+					s := cp.Stats()
+					logging.Infof("%v active conns %v, free conns %v, gets %v, wait time %v, dial failures %v, timeouts %v",
+						cp.logPrefix, s.Active, s.Idle, s.NumGets, s.WaitTime, s.DialFailures, s.Timeouts)
+				} else {
+					logging.Infof("%v active conns %v, free conns %v", cp.logPrefix, act, fc)
+				}
 			}
 
 			i = (i + 1) % CONN_RELEASE_INTERVAL
@@ -553,3 +553,67 @@ func TestUpdateTickRate(t *testing.T) {
 	ts.ln.Close()
 	time.Sleep(1 * time.Second)
 }
+
+func TestConnPoolStats(t *testing.T) {
+	readDeadline := time.Duration(30)
+	writeDeadline := time.Duration(40)
+
+	ts := &testServer{}
+	tsStopCh := make(chan bool, 1)
+
+	host := "127.0.0.1:15151"
+	go ts.initServer(host, tsStopCh)
+	time.Sleep(1 * time.Second)
+
+	cp := newConnectionPool(host, 3, 6, 1024*1024, readDeadline, writeDeadline, 3, 1)
+	cp.mkConn = testMkConn
+
+	conns := make([]*connection, 0)
+	for i := 0; i < 5; i++ {
+		sc, err := cp.Get()
+		if err != nil {
+			t.Fatalf("Error getting connection from pool: %v", err)
+		}
+		conns = append(conns, sc)
+	}
+
+	stats := cp.Stats()
+	if stats.Active != 5 || stats.Idle != 0 || stats.NumGets != 5 {
+		t.Errorf("Unexpected stats %+v after getting 5 connections", stats)
+	}
+
+	for _, sc := range conns {
+		cp.Return(sc, true)
+	}
+
+	stats = cp.Stats()
+	if stats.Active != 0 || stats.Idle != 3 {
+		t.Errorf("Unexpected stats %+v after returning 5 connections", stats)
+	}
+
+	cp.mkConn = func(h string) (*connection, error) {
+		return nil, errors.New("dial failure")
+	}
+	conns = conns[:0]
+	for i := 0; i < 4; i++ {
+		if sc, err := cp.Get(); err == nil {
+			conns = append(conns, sc)
+		}
+	}
+
+	stats = cp.Stats()
+	if len(conns) != 3 || stats.DialFailures != 1 || stats.NumGets != 9 {
+		t.Errorf("Unexpected stats %+v after dial failure", stats)
+	}
+
+	for _, sc := range conns {
+		cp.Return(sc, true)
+	}
+
+	cp.Close()
+	time.Sleep(2 * time.Second)
+
+	tsStopCh <- true
+	ts.ln.Close()
+	time.Sleep(1 * time.Second)
+}
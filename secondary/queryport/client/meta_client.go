@@ -39,6 +39,7 @@ type metadataClient struct {
 	logtick                 time.Duration
 	randomWeight            float64 // value between [0, 1.0)
 	equivalenceFactor       float64 // value between [0, 1.0)
+	serverLoadFactor        float64 // value between [0, 1.0]
 
 	topoChangeLock sync.Mutex
 	metaCh         chan bool
@@ -96,6 +97,7 @@ func newMetaBridgeClient(
 	b.logtick = time.Duration(config["logtick"].Int()) * time.Millisecond
 	b.randomWeight = config["load.randomWeight"].Float64()
 	b.equivalenceFactor = config["load.equivalenceFactor"].Float64()
+	b.serverLoadFactor = config["load.serverLoadFactor"].Float64()
 	// initialize meta-data-provide.
 	uuid, err := common.NewUUID()
 	if err != nil {
@@ -114,6 +116,7 @@ func newMetaBridgeClient(
 	}
 
 	go b.watchClusterChanges() // will also update the indexer list
+	go b.watchMetadataChanges()
 	go b.logstats()
 	return b, nil
 }
@@ -357,6 +360,39 @@ func (b *metadataClient) BuildIndexes(defnIDs []uint64) error {
 	return b.mdClient.BuildIndexes(ids)
 }
 
+// BuildIndexesWithResults implements BridgeAccessor{} interface.
+func (b *metadataClient) BuildIndexesWithResults(defnIDs []uint64) (map[uint64]*mclient.BuildIndexResult, error) {
+	currmeta := (*indexTopology)(atomic.LoadPointer(&b.indexers))
+
+	results := make(map[uint64]*mclient.BuildIndexResult)
+	ids := make([]common.IndexDefnId, 0, len(defnIDs))
+	for _, defnId := range defnIDs {
+		if _, ok := currmeta.defns[common.IndexDefnId(defnId)]; !ok {
+			results[defnId] = &mclient.BuildIndexResult{
+				DefnId: common.IndexDefnId(defnId),
+				Status: mclient.BuildIndexNotFound,
+				Err:    ErrorIndexNotFound,
+			}
+			continue
+		}
+		ids = append(ids, common.IndexDefnId(defnId))
+	}
+
+	if len(ids) == 0 {
+		return results, nil
+	}
+
+	mresults, err := b.mdClient.BuildIndexesWithResults(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, result := range mresults {
+		results[uint64(id)] = result
+	}
+	return results, nil
+}
+
 // MoveIndex implements BridgeAccessor{} interface.
 func (b *metadataClient) MoveIndex(defnID uint64, planJSON map[string]interface{}) error {
 
@@ -436,7 +472,7 @@ func (b *metadataClient) GetScanports() (queryports []string) {
 
 // GetScanport implements BridgeAccessor{} interface.
 func (b *metadataClient) GetScanport(defnID uint64, excludes map[common.IndexDefnId]map[common.PartitionId]map[uint64]bool,
-	skips map[common.IndexDefnId]bool) (qp []string,
+	skips map[common.IndexDefnId]bool, filter PartitionFilter) (qp []string,
 	targetDefnID uint64, in []uint64, rt []int64, pid [][]common.PartitionId, numPartitions uint32, ok bool) {
 
 	var insts map[common.PartitionId]*mclient.InstanceDefn
@@ -456,7 +492,7 @@ func (b *metadataClient) GetScanport(defnID uint64, excludes map[common.IndexDef
 		n++
 	}
 
-	insts, rollbackTimes, ok = b.pickRandom(replicas[:n], defnID, excludes[common.IndexDefnId(defnID)])
+	insts, rollbackTimes, numPartitions, ok = b.pickRandom(replicas[:n], defnID, excludes[common.IndexDefnId(defnID)], filter)
 	if !ok {
 		if len(currmeta.equivalents[common.IndexDefnId(defnID)]) > 1 || len(currmeta.replicas[common.IndexDefnId(defnID)]) > 1 {
 			// skip this index definition for retry only if there is equivalent index or replica
@@ -466,7 +502,6 @@ func (b *metadataClient) GetScanport(defnID uint64, excludes map[common.IndexDef
 	}
 
 	targetDefnID = uint64(defnID)
-	numPartitions = uint32(len(insts))
 
 	qpm := make(map[common.IndexerId]map[common.IndexInstId][]common.PartitionId)
 
@@ -734,6 +769,8 @@ type loadStats struct {
 	rollbackTime  map[common.PartitionId]int64
 	statsTime     map[common.PartitionId]int64
 	staleCount    map[common.PartitionId]int64
+	scansPending  map[common.PartitionId]int64
+	scanLatency   map[common.PartitionId]int64
 	numPartitions int
 }
 
@@ -744,6 +781,8 @@ func newLoadStats(numPartitions int) *loadStats {
 		rollbackTime:  make(map[common.PartitionId]int64), // initialize to 0 -- always allow scan
 		statsTime:     make(map[common.PartitionId]int64), // time when stats is collected at indexer
 		staleCount:    make(map[common.PartitionId]int64),
+		scansPending:  make(map[common.PartitionId]int64), // scans pending at indexer
+		scanLatency:   make(map[common.PartitionId]int64), // avg scan latency at indexer
 		numPartitions: numPartitions,
 	}
 
@@ -871,6 +910,14 @@ func (b *loadHeuristics) copyStats() *loadStats {
 		newStats.staleCount[partnId] = staleCount
 	}
 
+	for partnId, scansPending := range stats.scansPending {
+		newStats.scansPending[partnId] = scansPending
+	}
+
+	for partnId, scanLatency := range stats.scanLatency {
+		newStats.scanLatency[partnId] = scanLatency
+	}
+
 	return newStats
 }
 
@@ -891,6 +938,9 @@ func (b *loadHeuristics) cloneRefresh(curInst *mclient.InstanceDefn, newInst *mc
 			cloneStats.updatePendingItem(partnId, stats.getPendingItem(partnId))
 			cloneStats.updateRollbackTime(partnId, stats.getRollbackTime(partnId))
 			cloneStats.updateStatsTime(partnId, stats.statsTime[partnId])
+			if pending, ok := stats.scansPending[partnId]; ok {
+				cloneStats.updateScanLoad(partnId, pending, stats.scanLatency[partnId])
+			}
 		}
 	}
 
@@ -937,6 +987,27 @@ func (b *loadStats) updateStatsTime(partitionId common.PartitionId, value int64)
 	}
 }
 
+func (b *loadStats) updateScanLoad(partitionId common.PartitionId, pending int64, latency int64) {
+
+	b.scansPending[partitionId] = pending
+	b.scanLatency[partitionId] = latency
+}
+
+//
+// Returns the expected time (ns) for the indexer to serve the scans
+// pending on this partition, including the new scan.
+//
+func (b *loadStats) getScanLoad(partitionId common.PartitionId) (float64, bool) {
+
+	pending, ok1 := b.scansPending[partitionId]
+	latency, ok2 := b.scanLatency[partitionId]
+	if !ok1 || !ok2 || !b.isStatsCurrent(partitionId) {
+		return 0, false
+	}
+
+	return float64(pending+1) * float64(latency), true
+}
+
 func (b *loadStats) isAllStatsCurrent() bool {
 
 	current := true
@@ -978,8 +1049,8 @@ func (b *metadataClient) pickEquivalent(defnID uint64, skips map[common.IndexDef
 // 1) a map of partition Id and index instance
 // 2) a map of partition Id and rollback timestamp
 //
-func (b *metadataClient) pickRandom(replicas []uint64, defnID uint64,
-	excludes map[common.PartitionId]map[uint64]bool) (map[common.PartitionId]*mclient.InstanceDefn, map[common.PartitionId]int64, bool) {
+func (b *metadataClient) pickRandom(replicas []uint64, defnID uint64, excludes map[common.PartitionId]map[uint64]bool,
+	filter PartitionFilter) (map[common.PartitionId]*mclient.InstanceDefn, map[common.PartitionId]int64, uint32, bool) {
 
 	//
 	// Determine number of partitions and its range
@@ -1024,6 +1095,24 @@ func (b *metadataClient) pickRandom(replicas []uint64, defnID uint64,
 	numPartn := numPartition(currmeta, replicas)
 	startPartnId, endPartnId := partitionRange(currmeta, defnID, int(numPartn))
 
+	//
+	// Find out the partitions needed by the request
+	//
+	var wanted map[common.PartitionId]bool
+	if defn, ok := currmeta.defns[common.IndexDefnId(defnID)]; ok && filter != nil && numPartn > 1 {
+		wanted = filter(defn.Definition, numPartn)
+	}
+
+	numWanted := int(numPartn)
+	if len(wanted) != 0 {
+		numWanted = 0
+		for partnId := startPartnId; partnId < endPartnId; partnId++ {
+			if wanted[common.PartitionId(partnId)] {
+				numWanted++
+			}
+		}
+	}
+
 	//
 	// Shuffle the replica list
 	//
@@ -1053,6 +1142,9 @@ func (b *metadataClient) pickRandom(replicas []uint64, defnID uint64,
 	// Filter based on timing of scan responses
 	b.filterByTiming(currmeta, replicas, rollbackTimesList, startPartnId, endPartnId)
 
+	// Filter based on scan load reported by indexer
+	b.filterByServerLoad(currmeta, replicas, rollbackTimesList, startPartnId, endPartnId)
+
 	//
 	// Randomly select an inst after filtering
 	//
@@ -1061,6 +1153,10 @@ func (b *metadataClient) pickRandom(replicas []uint64, defnID uint64,
 
 	for partnId := startPartnId; partnId < endPartnId; partnId++ {
 
+		if len(wanted) != 0 && !wanted[common.PartitionId(partnId)] {
+			continue
+		}
+
 		var ok bool
 		var inst *mclient.InstanceDefn
 		var rollbackTime int64
@@ -1101,9 +1197,9 @@ func (b *metadataClient) pickRandom(replicas []uint64, defnID uint64,
 		}
 	}
 
-	if len(chosenInst) != int(numPartn) {
+	if len(chosenInst) != numWanted {
 		logging.Errorf("PickRandom: Fail to find indexer for all index partitions. Num partition %v.  Partition with instances %v ",
-			numPartn, len(chosenInst))
+			numWanted, len(chosenInst))
 		for n, instId := range replicas {
 			for partnId := startPartnId; partnId < endPartnId; partnId++ {
 				ts, ok := rollbackTimesList[n][common.PartitionId(partnId)]
@@ -1111,10 +1207,10 @@ func (b *metadataClient) pickRandom(replicas []uint64, defnID uint64,
 					instId, partnId, ts, ok)
 			}
 		}
-		return nil, nil, false
+		return nil, nil, 0, false
 	}
 
-	return chosenInst, chosenTimestamp, true
+	return chosenInst, chosenTimestamp, numPartn, true
 }
 
 func (b *metadataClient) filterByTiming(currmeta *indexTopology, replicas []uint64, rollbackTimes []map[common.PartitionId]int64,
@@ -1173,6 +1269,64 @@ func (b *metadataClient) filterByTiming(currmeta *indexTopology, replicas []uint
 	}
 }
 
+//
+// This method prefers the replica with least scan load at the indexer.  Scan load is
+// the expected time to serve the scans pending at the indexer, based on the number of
+// pending scans and avg scan latency reported by the indexer.  Unlike filterByTiming,
+// this accounts for load on the indexer node from other clients.
+//
+// A replica partition is removed from the scan if its scan load, normalized by
+// serverLoadFactor, is higher than the least loaded replica.  Replica without current
+// stats is not pruned.
+//
+func (b *metadataClient) filterByServerLoad(currmeta *indexTopology, replicas []uint64, rollbackTimes []map[common.PartitionId]int64,
+	startPartnId uint64, endPartnId uint64) {
+
+	if b.serverLoadFactor <= 0 {
+		return
+	}
+
+	for partnId := startPartnId; partnId < endPartnId; partnId++ {
+
+		loadList := make([]float64, len(replicas))
+		numLoads := 0
+		leastLoad := math.MaxFloat64
+
+		for i, instId := range replicas {
+			loadList[i] = -1
+			if _, ok := rollbackTimes[i][common.PartitionId(partnId)]; !ok {
+				continue
+			}
+			if load, ok := currmeta.loads[common.IndexInstId(instId)]; ok {
+				if n, ok := load.getStats().getScanLoad(common.PartitionId(partnId)); ok {
+					loadList[i] = n
+					numLoads++
+					if n < leastLoad {
+						leastLoad = n
+					}
+				}
+			}
+		}
+
+		// Do not prune if there is no other replica to compare with
+		if numLoads <= 1 {
+			continue
+		}
+
+		for i, instId := range replicas {
+			if loadList[i] < 0 {
+				continue
+			}
+			eqivLoad := loadList[i] * b.serverLoadFactor
+			if eqivLoad > leastLoad {
+				logging.Verbosef("remove inst %v partition %v from scan due to indexer scan load (least %v load %v)",
+					instId, partnId, leastLoad, eqivLoad)
+				delete(rollbackTimes[i], common.PartitionId(partnId))
+			}
+		}
+	}
+}
+
 //
 // This method prune stale partitions from the given replica.  For each replica, it returns
 // the rollback time of up-to-date partition.  Staleness is based on the limit of how far
@@ -1917,6 +2071,12 @@ func (b *metadataClient) updateStats(stats map[common.IndexInstId]map[common.Par
 					logging.Errorf("Error in converting progress_stat_time %v, type %v", err)
 				}
 			}
+
+			if v := stats.Get("num_scans_pending"); v != nil {
+				if v2 := stats.Get("avg_scan_latency"); v2 != nil {
+					newStats.updateScanLoad(partitionId, int64(v.(float64)), int64(v2.(float64)))
+				}
+			}
 		}
 
 		load.updateStats(newStats)
@@ -2066,6 +2226,28 @@ func (b *metadataClient) watchClusterChanges() {
 	}
 }
 
+//
+// watchMetadataChanges updates the cached topology as soon as the metadata
+// provider sees a new version of the metadata, so that scans do not wait
+// for an error or for the next Refresh() to see DDL and rebalance changes.
+//
+func (b *metadataClient) watchMetadataChanges() {
+
+	id, ch := b.mdClient.SubscribeMetadataChange()
+	defer b.mdClient.UnsubscribeMetadataChange(id)
+
+	for {
+		select {
+		case version := <-ch:
+			logging.Debugf("watchMetadataChanges(): metadata version %v", version)
+			b.safeupdate(nil, false /*force*/)
+
+		case <-b.finch:
+			return
+		}
+	}
+}
+
 func postWithAuth(url string, bodyType string, body io.Reader, timeout time.Duration) (*http.Response, error) {
 	params := &security.RequestParams{Timeout: time.Duration(timeout) * time.Second}
 	return security.PostWithAuth(url, bodyType, body, params)
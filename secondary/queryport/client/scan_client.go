@@ -62,6 +62,7 @@ func NewGsiScanClient(queryport string, config common.Config) (*GsiScanClient, e
 	c.pool = newConnectionPool(
 		queryport, c.poolSize, c.poolOverflow, c.maxPayload, c.cpTimeout,
 		c.cpAvailWaitTimeout, c.minPoolSizeWM, c.relConnBatchSize)
+	c.pool.SetLogStats(config["settings.logConnPoolStats"].Bool())
 	logging.Infof("%v started ...\n", c.logPrefix)
 
 	if version, err := c.Helo(); err == nil || err == io.EOF {
@@ -200,8 +201,7 @@ func (c *GsiScanClient) Lookup(
 		DataEncFmt:   proto.Uint32(uint32(dataEncFmt)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
 	}
 
 	return c.doStreamingWithRetry(requestId, req, callb, "Lookup", retry)
@@ -313,8 +313,7 @@ func (c *GsiScanClient) Range(
 		DataEncFmt:   proto.Uint32(uint32(dataEncFmt)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
 	}
 
 	return c.doStreamingWithRetry(requestId, req, callb, "Range", retry)
@@ -350,8 +349,7 @@ func (c *GsiScanClient) RangePrimary(
 		DataEncFmt:   proto.Uint32(uint32(dataEncFmt)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
 	}
 
 	return c.doStreamingWithRetry(requestId, req, callb, "RangePrimary", retry)
@@ -379,8 +377,7 @@ func (c *GsiScanClient) ScanAll(
 		DataEncFmt:   proto.Uint32(uint32(dataEncFmt)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
 	}
 
 	return c.doStreamingWithRetry(requestId, req, callb, "ScanAll", retry)
@@ -389,7 +386,7 @@ func (c *GsiScanClient) ScanAll(
 func (c *GsiScanClient) MultiScan(
 	defnID uint64, requestId string, scans Scans,
 	reverse, distinct bool, projection *IndexProjection, offset, limit int64,
-	cons common.Consistency, vector *TsConsistency,
+	resumeKey []byte, cons common.Consistency, vector *TsConsistency,
 	callb ResponseHandler, rollbackTime int64, partitions []common.PartitionId,
 	dataEncFmt common.DataEncodingFormat, retry bool) (error, bool) {
 
@@ -438,9 +435,14 @@ func (c *GsiScanClient) MultiScan(
 					}
 				}
 			}
+			arrayFilters, err := protoArrayFilters(scan.ArrayFilter)
+			if err != nil {
+				return err, false
+			}
 			s := &protobuf.Scan{
-				Filters: filters,
-				Equals:  equals,
+				Filters:      filters,
+				Equals:       equals,
+				ArrayFilters: arrayFilters,
 			}
 			protoScans[i] = s
 		}
@@ -477,10 +479,10 @@ func (c *GsiScanClient) MultiScan(
 		PartitionIds:    partnIds,
 		Sorted:          proto.Bool(true),
 		DataEncFmt:      proto.Uint32(uint32(dataEncFmt)),
+		ResumeKey:       resumeKey,
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
 	}
 
 	return c.doStreamingWithRetry(requestId, req, callb, "MultiScan", retry)
@@ -489,7 +491,7 @@ func (c *GsiScanClient) MultiScan(
 func (c *GsiScanClient) MultiScanPrimary(
 	defnID uint64, requestId string, scans Scans,
 	reverse, distinct bool, projection *IndexProjection, offset, limit int64,
-	cons common.Consistency, vector *TsConsistency,
+	resumeKey []byte, cons common.Consistency, vector *TsConsistency,
 	callb ResponseHandler, rollbackTime int64, partitions []common.PartitionId,
 	dataEncFmt common.DataEncodingFormat, retry bool) (error, bool) {
 
@@ -582,10 +584,10 @@ func (c *GsiScanClient) MultiScanPrimary(
 		PartitionIds:    partnIds,
 		Sorted:          proto.Bool(true),
 		DataEncFmt:      proto.Uint32(uint32(dataEncFmt)),
+		ResumeKey:       resumeKey,
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
 	}
 
 	return c.doStreamingWithRetry(requestId, req, callb, "MultiScanPrimary", retry)
@@ -620,8 +622,7 @@ func (c *GsiScanClient) CountLookup(
 		PartitionIds: partnIds,
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
 	}
 	resp, err := c.doRequestResponse(req, requestId, retry)
 	if err != nil {
@@ -654,8 +655,7 @@ func (c *GsiScanClient) CountLookupPrimary(
 		PartitionIds: partnIds,
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
 	}
 	resp, err := c.doRequestResponse(req, requestId, retry)
 	if err != nil {
@@ -702,8 +702,7 @@ func (c *GsiScanClient) CountRange(
 		PartitionIds: partnIds,
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
 	}
 
 	resp, err := c.doRequestResponse(req, requestId, retry)
@@ -741,8 +740,7 @@ func (c *GsiScanClient) CountRangePrimary(
 		PartitionIds: partnIds,
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
 	}
 
 	resp, err := c.doRequestResponse(req, requestId, retry)
@@ -759,7 +757,8 @@ func (c *GsiScanClient) CountRangePrimary(
 
 func (c *GsiScanClient) MultiScanCount(
 	defnID uint64, requestId string, scans Scans, distinct bool,
-	cons common.Consistency, vector *TsConsistency, rollbackTime int64, partitions []common.PartitionId, retry bool) (int64, error) {
+	cons common.Consistency, vector *TsConsistency, rollbackTime int64, partitions []common.PartitionId, retry bool,
+	timeout time.Duration) (int64, error) {
 
 	// serialize scans
 	protoScans := make([]*protobuf.Scan, len(scans))
@@ -805,9 +804,14 @@ func (c *GsiScanClient) MultiScanCount(
 					}
 				}
 			}
+			arrayFilters, err := protoArrayFilters(scan.ArrayFilter)
+			if err != nil {
+				return 0, err
+			}
 			s := &protobuf.Scan{
-				Filters: filters,
-				Equals:  equals,
+				Filters:      filters,
+				Equals:       equals,
+				ArrayFilters: arrayFilters,
 			}
 			protoScans[i] = s
 		}
@@ -832,8 +836,10 @@ func (c *GsiScanClient) MultiScanCount(
 	}
 
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
+	}
+	if timeout > 0 {
+		req.Timeout = proto.Int64(int64(timeout))
 	}
 
 	resp, err := c.doRequestResponse(req, requestId, retry)
@@ -850,7 +856,8 @@ func (c *GsiScanClient) MultiScanCount(
 
 func (c *GsiScanClient) MultiScanCountPrimary(
 	defnID uint64, requestId string, scans Scans, distinct bool,
-	cons common.Consistency, vector *TsConsistency, rollbackTime int64, partitions []common.PartitionId, retry bool) (int64, error) {
+	cons common.Consistency, vector *TsConsistency, rollbackTime int64, partitions []common.PartitionId, retry bool,
+	timeout time.Duration) (int64, error) {
 
 	var what string
 	// serialize scans
@@ -930,8 +937,10 @@ func (c *GsiScanClient) MultiScanCountPrimary(
 	}
 
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
+	}
+	if timeout > 0 {
+		req.Timeout = proto.Int64(int64(timeout))
 	}
 
 	resp, err := c.doRequestResponse(req, requestId, retry)
@@ -952,7 +961,8 @@ func (c *GsiScanClient) Scan3(
 	groupAggr *GroupAggr, sorted bool,
 	cons common.Consistency, vector *TsConsistency,
 	callb ResponseHandler, rollbackTime int64, partitions []common.PartitionId,
-	dataEncFmt common.DataEncodingFormat, retry bool) (error, bool) {
+	dataEncFmt common.DataEncodingFormat, retry bool,
+	timeout time.Duration) (error, bool) {
 
 	// serialize scans
 	protoScans := make([]*protobuf.Scan, len(scans))
@@ -998,9 +1008,14 @@ func (c *GsiScanClient) Scan3(
 					}
 				}
 			}
+			arrayFilters, err := protoArrayFilters(scan.ArrayFilter)
+			if err != nil {
+				return err, false
+			}
 			s := &protobuf.Scan{
-				Filters: filters,
-				Equals:  equals,
+				Filters:      filters,
+				Equals:       equals,
+				ArrayFilters: arrayFilters,
 			}
 			protoScans[i] = s
 		}
@@ -1080,20 +1095,73 @@ func (c *GsiScanClient) Scan3(
 		DataEncFmt:      proto.Uint32(uint32(dataEncFmt)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
+	}
+	if timeout > 0 {
+		req.Timeout = proto.Int64(int64(timeout))
 	}
 
 	return c.doStreamingWithRetry(requestId, req, callb, "Scan3", retry)
 }
 
+func (c *GsiScanClient) VectorScan(
+	defnID uint64, requestId string, queryVector []float32,
+	projection *IndexProjection, offset, limit int64,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler, rollbackTime int64, partitions []common.PartitionId,
+	dataEncFmt common.DataEncodingFormat, retry bool,
+	timeout time.Duration) (error, bool) {
+
+	//IndexProjection
+	var protoProjection *protobuf.IndexProjection
+	if projection != nil {
+		protoProjection = &protobuf.IndexProjection{
+			EntryKeys:  projection.EntryKeys,
+			PrimaryKey: proto.Bool(projection.PrimaryKey),
+		}
+	}
+
+	partnIds := make([]uint64, len(partitions))
+	for i, partnId := range partitions {
+		partnIds[i] = uint64(partnId)
+	}
+
+	req := &protobuf.ScanRequest{
+		DefnID: proto.Uint64(defnID),
+		Span: &protobuf.Span{
+			Range: nil,
+		},
+		RequestId:       proto.String(requestId),
+		Distinct:        proto.Bool(false),
+		Limit:           proto.Int64(limit),
+		Cons:            proto.Uint32(uint32(cons)),
+		Indexprojection: protoProjection,
+		Offset:          proto.Int64(offset),
+		RollbackTime:    proto.Int64(rollbackTime),
+		PartitionIds:    partnIds,
+		DataEncFmt:      proto.Uint32(uint32(dataEncFmt)),
+		VectorScan: &protobuf.VectorScan{
+			QueryVector: queryVector,
+		},
+	}
+	if vector != nil {
+		req.Vector = protoTsConsistency(vector)
+	}
+	if timeout > 0 {
+		req.Timeout = proto.Int64(int64(timeout))
+	}
+
+	return c.doStreamingWithRetry(requestId, req, callb, "VectorScan", retry)
+}
+
 func (c *GsiScanClient) Scan3Primary(
 	defnID uint64, requestId string, scans Scans,
 	reverse, distinct bool, projection *IndexProjection, offset, limit int64,
 	groupAggr *GroupAggr, sorted bool,
 	cons common.Consistency, vector *TsConsistency,
 	callb ResponseHandler, rollbackTime int64, partitions []common.PartitionId,
-	dataEncFmt common.DataEncodingFormat, retry bool) (error, bool) {
+	dataEncFmt common.DataEncodingFormat, retry bool,
+	timeout time.Duration) (error, bool) {
 
 	var what string
 	// serialize scans
@@ -1225,8 +1293,10 @@ func (c *GsiScanClient) Scan3Primary(
 		DataEncFmt:      proto.Uint32(uint32(dataEncFmt)),
 	}
 	if vector != nil {
-		req.Vector = protobuf.NewTsConsistency(
-			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+		req.Vector = protoTsConsistency(vector)
+	}
+	if timeout > 0 {
+		req.Timeout = proto.Int64(int64(timeout))
 	}
 
 	return c.doStreamingWithRetry(requestId, req, callb, "Scan3Primary", retry)
@@ -1237,6 +1307,11 @@ func (c *GsiScanClient) Close() error {
 	return c.pool.Close()
 }
 
+// ConnPoolStats returns the metrics of the connection pool to the indexer.
+func (c *GsiScanClient) ConnPoolStats() ConnPoolStats {
+	return c.pool.Stats()
+}
+
 func (c *GsiScanClient) IsClosed() bool {
 	return atomic.LoadUint32(&c.closed) == uint32(1)
 }
@@ -1418,3 +1493,43 @@ func getEmptySpanForPrimary() *protobuf.Scan {
 	}
 	return &protobuf.Scan{Filters: []*protobuf.CompositeElementFilter{fl}}
 }
+
+func protoArrayFilters(arrayFilter []*CompositeElementFilter) (
+	[]*protobuf.CompositeElementFilter, error) {
+
+	var filters []*protobuf.CompositeElementFilter
+	for _, f := range arrayFilter {
+		var l, h []byte
+		var err error
+		if f.Low != common.MinUnbounded { // Do not encode if unbounded
+			l, err = json.Marshal(f.Low)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if f.High != common.MaxUnbounded { // Do not encode if unbounded
+			h, err = json.Marshal(f.High)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		fl := &protobuf.CompositeElementFilter{
+			Low: l, High: h, Inclusion: proto.Uint32(uint32(f.Inclusion)),
+		}
+		filters = append(filters, fl)
+	}
+	return filters, nil
+}
+
+func protoTsConsistency(vector *TsConsistency) *protobuf.TsConsistency {
+	ts := protobuf.NewTsConsistency(
+		vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+	if vector.MaxStalenessMs != 0 {
+		ts.MaxStalenessMs = proto.Uint64(vector.MaxStalenessMs)
+	}
+	if vector.MaxStalenessSeqnos != 0 {
+		ts.MaxStalenessSeqnos = proto.Uint64(vector.MaxStalenessSeqnos)
+	}
+	return ts
+}
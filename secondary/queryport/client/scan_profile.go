@@ -0,0 +1,195 @@
+// Copyright (c) 2021 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package client
+
+import (
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+//
+// ScanProfile is the breakdown of the time spent by the client on a scan.
+// It describes the last attempt of the scan, except for QueueTime and
+// Attempts which cover all the attempts.
+//
+type ScanProfile struct {
+	RequestId string `json:"requestId"`
+
+	// time from the start of the scan until the scan is done
+	TotalTime time.Duration `json:"totalTime"`
+
+	// time spent looking up indexers and retrying, before the last
+	// attempt is sent to the indexers
+	QueueTime time.Duration `json:"queueTime"`
+
+	// time from sending the scan to the indexers until all the
+	// indexers are done
+	NetworkTime time.Duration `json:"networkTime"`
+
+	// number of times the scan was sent to the indexers
+	Attempts int `json:"attempts"`
+
+	// rows received from the indexers, and rows decoded by the client
+	// to merge the results of multiple indexers
+	RowsReceived int64 `json:"rowsReceived"`
+	RowsDecoded  int64 `json:"rowsDecoded"`
+
+	// one entry per indexer the scan is sent to
+	Nodes []*NodeScanProfile `json:"nodes"`
+
+	start time.Time
+	sent  time.Time
+}
+
+//
+// NodeScanProfile is the part of a ScanProfile for one indexer.
+//
+type NodeScanProfile struct {
+	Queryport  string               `json:"queryport"`
+	InstId     uint64               `json:"instId"`
+	Partitions []common.PartitionId `json:"partitions"`
+
+	// time from sending the request until the first response, and
+	// until the request is done
+	FirstResponse time.Duration `json:"firstResponse"`
+	Latency       time.Duration `json:"latency"`
+
+	Rows        int64  `json:"rows"`
+	RowsDecoded int64  `json:"rowsDecoded"`
+	Err         string `json:"error,omitempty"`
+}
+
+//
+// ScanProfiler is notified of the profile of each scan once the scan is
+// done, e.g. to include it in the profile of the query.
+//
+type ScanProfiler interface {
+	ScanProfileDone(profile *ScanProfile)
+}
+
+//
+// Enable the profile of the scan.  The profile is available with
+// GetScanProfile once the scan is done, and passed to profiler if it is
+// not nil.
+//
+func (b *RequestBroker) EnableScanProfile(profiler ScanProfiler) {
+
+	b.profile = &ScanProfile{RequestId: b.requestId}
+	b.profiler = profiler
+}
+
+//
+// Get the profile of the scan, nil if it is not enabled
+//
+func (b *RequestBroker) GetScanProfile() *ScanProfile {
+
+	return b.profile
+}
+
+func (b *RequestBroker) startProfile() {
+
+	if b.profile != nil {
+		b.profile.start = time.Now()
+	}
+}
+
+func (b *RequestBroker) profileScatter(client []*GsiScanClient, instIds []uint64,
+	partitions [][]common.PartitionId) {
+
+	if b.profile == nil {
+		return
+	}
+
+	p := b.profile
+	p.sent = time.Now()
+	p.QueueTime = p.sent.Sub(p.start)
+	p.Attempts++
+	p.Nodes = make([]*NodeScanProfile, len(client))
+	for i := range client {
+		p.Nodes[i] = &NodeScanProfile{
+			Queryport:  client[i].queryport,
+			InstId:     instIds[i],
+			Partitions: partitions[i],
+		}
+	}
+}
+
+func (b *RequestBroker) profileScatterDone() {
+
+	if b.profile != nil {
+		b.profile.NetworkTime = time.Since(b.profile.sent)
+	}
+}
+
+func (b *RequestBroker) getNodeProfile(id ResponseHandlerId) *NodeScanProfile {
+
+	if b.profile == nil || int(id) >= len(b.profile.Nodes) {
+		return nil
+	}
+	return b.profile.Nodes[int(id)]
+}
+
+// profileHandler records the time of the first response of the indexer
+func (b *RequestBroker) profileHandler(id ResponseHandlerId, begin time.Time,
+	handler ResponseHandler) ResponseHandler {
+
+	node := b.getNodeProfile(id)
+	if node == nil {
+		return handler
+	}
+
+	return func(resp ResponseReader) bool {
+		if node.FirstResponse == 0 {
+			node.FirstResponse = time.Since(begin)
+		}
+		return handler(resp)
+	}
+}
+
+func (b *RequestBroker) profileNodeDone(id ResponseHandlerId, instId uint64, begin time.Time, err error) {
+
+	if node := b.getNodeProfile(id); node != nil {
+		// a hedged scan can be served by another replica
+		node.InstId = instId
+		node.Latency = time.Since(begin)
+		if err != nil {
+			node.Err = err.Error()
+		}
+	}
+}
+
+func (b *RequestBroker) profileRows(id ResponseHandlerId, rows, decoded int) {
+
+	if node := b.getNodeProfile(id); node != nil {
+		node.Rows += int64(rows)
+		node.RowsDecoded += int64(decoded)
+	}
+}
+
+func (b *RequestBroker) finishProfile() {
+
+	if b.profile == nil {
+		return
+	}
+
+	p := b.profile
+	p.TotalTime = time.Since(p.start)
+
+	p.RowsReceived, p.RowsDecoded = 0, 0
+	for _, node := range p.Nodes {
+		p.RowsReceived += node.Rows
+		p.RowsDecoded += node.RowsDecoded
+	}
+
+	if b.profiler != nil {
+		b.profiler.ScanProfileDone(p)
+	}
+}
@@ -118,6 +118,21 @@ type RequestBroker struct {
 	projDesc       []bool
 	distinct       bool
 
+	// replica to hedge the scan to
+	hedge *hedgeTarget
+
+	// time by which the request is abandoned by the caller
+	deadline time.Time
+
+	// resume key sent with the scan, and the one returned by the indexer
+	resumeKey     []byte
+	nextResumeKey []byte
+	resumable     bool
+
+	// profile of the scan, nil if not enabled
+	profile  *ScanProfile
+	profiler ScanProfiler
+
 	// Additional key positions (not in projection list) added due to
 	// IndexKeyOrder for sorting purpose. These additions keys need to be
 	// pruned from index entry row before sending to N1QL
@@ -139,6 +154,19 @@ type doneStatus struct {
 	partial bool
 }
 
+//
+// hedgeTarget is a replica, served by another indexer, that a scan can
+// be sent to when the indexer serving the scan is slow to respond.
+//
+type hedgeTarget struct {
+	clientMaker scanClientMaker
+	queryport   string
+	instId      uint64
+	rollback    int64
+	partitions  []common.PartitionId
+	threshold   time.Duration
+}
+
 const (
 	NoPick = -1
 	Done   = -2
@@ -308,6 +336,100 @@ func (b *RequestBroker) SetIndexOrder(indexOrder *IndexKeyOrder) {
 	b.indexOrder = indexOrder
 }
 
+//
+// Set the replica to hedge the scan to, nil to disable hedging
+//
+func (b *RequestBroker) SetHedgeTarget(hedge *hedgeTarget) {
+
+	b.hedge = hedge
+}
+
+//
+// Set the deadline of the request.  The time remaining until the deadline
+// is sent with each scan request, so that the indexer stops the scan once
+// the caller has given up on it.
+//
+func (b *RequestBroker) SetDeadline(deadline time.Time) {
+
+	b.deadline = deadline
+}
+
+//
+// Set the deadline of the request to timeout from now, unless the caller
+// has set a deadline already.  A timeout of 0 means no deadline.
+//
+func (b *RequestBroker) setDefaultTimeout(timeout time.Duration) {
+
+	if timeout > 0 && b.deadline.IsZero() {
+		b.deadline = time.Now().Add(timeout)
+	}
+}
+
+//
+// Get the time remaining until the deadline, 0 if there is no deadline.
+// It returns ErrScanTimedOut if the deadline has passed.
+//
+func (b *RequestBroker) GetTimeout() (time.Duration, error) {
+
+	if b.deadline.IsZero() {
+		return 0, nil
+	}
+
+	timeout := time.Until(b.deadline)
+	if timeout <= 0 {
+		return 0, common.ErrScanTimedOut
+	}
+	return timeout, nil
+}
+
+//
+// Set the resume key returned by a previous scan, the scan continues
+// after the last entry returned by it.  Only ordered scans served by a
+// single indexer can be resumed.
+//
+func (b *RequestBroker) SetResumeKey(key []byte) {
+
+	b.resumeKey = key
+}
+
+func (b *RequestBroker) GetResumeKey() []byte {
+
+	return b.resumeKey
+}
+
+//
+// Get the resume key returned by the indexer with the last rows of the
+// scan, nil if the scan cannot be resumed.
+//
+func (b *RequestBroker) NextResumeKey() []byte {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !b.resumable {
+		return nil
+	}
+	return b.nextResumeKey
+}
+
+//
+// resumeKeyHandler records the resume key of the responses before
+// passing them to handler.
+//
+func (b *RequestBroker) resumeKeyHandler(handler ResponseHandler) ResponseHandler {
+
+	return func(resp ResponseReader) bool {
+		if r, ok := resp.(ResumeKeyReader); ok {
+			if key := r.GetResumeKey(); len(key) != 0 {
+				b.mutex.Lock()
+				b.nextResumeKey = append([]byte(nil), key...)
+				b.mutex.Unlock()
+			}
+		}
+		return handler(resp)
+	}
+}
+
 //
 // Retry
 //
@@ -529,6 +651,10 @@ func (b *RequestBroker) reset() {
 	b.receiveCount = 0
 	b.numIndexers = 0
 
+	// resume
+	b.nextResumeKey = nil
+	b.resumable = false
+
 	// scans
 	b.defn = nil
 	b.pushdownLimit = b.limit
@@ -570,6 +696,14 @@ func (c *RequestBroker) scatter(clientMaker scanClientMaker, index *common.Index
 		return 0, nil, false, true
 	}
 
+	c.resumable = len(partition) == 1
+	if len(c.resumeKey) != 0 && !c.resumable {
+		return 0, c.makeErrorMap(targetInstId, partition, ErrorResumeKeyNotSupported), false, false
+	}
+
+	c.profileScatter(client, targetInstId, partition)
+	defer c.profileScatterDone()
+
 	c.analyzeOrderBy(partition, numPartition, index)
 	c.analyzeProjection(partition, numPartition, index)
 	c.changePushdownParams(partition, numPartition, index)
@@ -1241,7 +1375,16 @@ func (c *RequestBroker) scanSingleNode(id ResponseHandlerId, client *GsiScanClie
 	}
 
 	begin := time.Now()
-	err, partial := c.scan(client, index, rollback, partition, c.factory(id, instId, partition))
+	var err error
+	var partial bool
+	if c.canHedge(instId, partition) {
+		err, partial, instId = c.hedgedScan(client, index, instId, rollback, partition,
+			c.profileHandler(id, begin, c.resumeKeyHandler(c.factory(id, instId, partition))))
+	} else {
+		err, partial = c.scan(client, index, rollback, partition,
+			c.profileHandler(id, begin, c.resumeKeyHandler(c.factory(id, instId, partition))))
+	}
+	c.profileNodeDone(id, instId, begin, err)
 	if err != nil {
 		// If there is any error, then stop the broker.
 		// This will force other go-routine to terminate.
@@ -1262,6 +1405,94 @@ func (c *RequestBroker) scanSingleNode(id ResponseHandlerId, client *GsiScanClie
 	donech <- &doneStatus{err: err, partial: partial}
 }
 
+func (c *RequestBroker) canHedge(instId uint64, partition []common.PartitionId) bool {
+
+	return c.hedge != nil && c.NumIndexers() == 1 && c.hedge.instId != instId &&
+		len(c.hedge.partitions) == len(partition)
+}
+
+//
+// hedgedScan makes a scan request through a single connection.  If no
+// response is received within the hedge threshold, the same request is
+// sent to the hedge replica as well.  Only the responses of the replica
+// that responds first are passed to the handler.  The other request is
+// cancelled on its next response, so that no row is received twice.
+// It returns the instance of the replica that served the scan.
+//
+func (c *RequestBroker) hedgedScan(client *GsiScanClient, index *common.IndexDefn, instId uint64,
+	rollback int64, partition []common.PartitionId, handler ResponseHandler) (error, bool, uint64) {
+
+	type scanResult struct {
+		err     error
+		partial bool
+		id      int32
+	}
+
+	hedge := c.hedge
+	instIds := []uint64{instId, hedge.instId}
+
+	winner := int32(-1)
+	gate := func(id int32) ResponseHandler {
+		return func(resp ResponseReader) bool {
+			if atomic.CompareAndSwapInt32(&winner, -1, id) || atomic.LoadInt32(&winner) == id {
+				return handler(resp)
+			}
+			// The other replica has responded first. Stop this request.
+			return false
+		}
+	}
+
+	resch := make(chan scanResult, 2)
+	scan := func(id int32, client *GsiScanClient, rollback int64) {
+		err, partial := c.scan(client, index, rollback, partition, gate(id))
+		resch <- scanResult{err: err, partial: partial, id: id}
+	}
+
+	go scan(0, client, rollback)
+	pending := 1
+
+	timer := time.NewTimer(hedge.threshold)
+	defer timer.Stop()
+	hedgech := timer.C
+
+	var res scanResult
+	for pending > 0 {
+		select {
+		case <-hedgech:
+			hedgech = nil
+			if atomic.LoadInt32(&winner) != -1 || c.IsClose() {
+				continue
+			}
+
+			hedgeClient := hedge.clientMaker(hedge.queryport)
+			if hedgeClient == nil {
+				continue
+			}
+
+			logging.Debugf("scatter: requestId %v no response from %v within %v. Hedging scan to queryport %v inst %v",
+				c.requestId, client.queryport, hedge.threshold, hedge.queryport, hedge.instId)
+			go scan(1, hedgeClient, hedge.rollback)
+			pending++
+
+		case res = <-resch:
+			pending--
+
+			// A request that completes without passing any response to the
+			// handler has been answered first as well.
+			w := atomic.LoadInt32(&winner)
+			if w == res.id || (w == -1 && res.err == nil && atomic.CompareAndSwapInt32(&winner, -1, res.id)) {
+				if res.id == 1 {
+					logging.Debugf("scatter: requestId %v served by hedge queryport %v inst %v",
+						c.requestId, hedge.queryport, hedge.instId)
+				}
+				return res.err, res.partial, instIds[res.id]
+			}
+		}
+	}
+
+	return res.err, res.partial, instIds[res.id]
+}
+
 //
 // This function makes a count request through a single connection.
 //
@@ -1273,7 +1504,9 @@ func (c *RequestBroker) countSingleNode(id ResponseHandlerId, client *GsiScanCli
 		return
 	}
 
+	begin := time.Now()
 	cnt, err, partial := c.count(client, index, rollback, partition)
+	c.profileNodeDone(id, instId, begin, err)
 	if err != nil {
 		// If there is any error, then stop the broker.
 		// This will force other go-routine to terminate.
@@ -1314,10 +1547,12 @@ func (c *RequestBroker) SendEntries(id ResponseHandlerId, pkeys [][]byte,
 	var rb *[]byte
 	var cont bool
 	var skey common.ScanResultKey
+	var decoded int
 
 	tmpbuf := c.tmpbufs[int(id)]
 	defer func() {
 		c.tmpbufs[int(id)] = tmpbuf
+		c.profileRows(id, skeys.GetLength(), decoded)
 	}()
 
 	for i := 0; i < skeys.GetLength(); i++ {
@@ -1329,6 +1564,7 @@ func (c *RequestBroker) SendEntries(id ResponseHandlerId, pkeys [][]byte,
 					logging.Errorf("Error %v in RequestBroker::SendEntries Getkth", err)
 					return false, err
 				}
+				decoded++
 
 				if rb != nil {
 					tmpbuf = rb
@@ -1478,22 +1714,36 @@ func (c *RequestBroker) filterPartitions(index *common.IndexDefn, partitions [][
 		return partitions
 	}
 
+	filter := c.PartitionFilter(index, numPartition)
+	if len(filter) == 0 {
+		return partitions
+	}
+
+	return filterPartitionIds(partitions, filter)
+}
+
+//
+// PartitionFilter returns the partitions that the scans need to be sent to.
+// This is possible only if every scan has an equality filter on all the
+// partition keys.  Otherwise, it returns nil.
+//
+func (c *RequestBroker) PartitionFilter(index *common.IndexDefn, numPartition uint32) map[common.PartitionId]bool {
+
+	if numPartition == 1 {
+		return nil
+	}
+
 	partitionKeyPos := partitionKeyPos(index)
 	if len(partitionKeyPos) == 0 {
-		return partitions
+		return nil
 	}
 
 	partitionKeyValues := partitionKeyValues(c.requestId, partitionKeyPos, c.scans)
 	if len(partitionKeyValues) == 0 {
-		return partitions
-	}
-
-	filter := partitionKeyHash(partitionKeyValues, c.scans, numPartition, index.HashScheme)
-	if len(filter) == 0 {
-		return partitions
+		return nil
 	}
 
-	return filterPartitionIds(partitions, filter)
+	return partitionKeyHash(partitionKeyValues, c.scans, numPartition, index.HashScheme)
 }
 
 //
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+type resumeKeyResponse struct {
+	resumeKey []byte
+}
+
+func (r *resumeKeyResponse) GetEntries(dataEncFmt common.DataEncodingFormat) (*common.ScanResultEntries, [][]byte, error) {
+	return nil, nil, nil
+}
+
+func (r *resumeKeyResponse) Error() error {
+	return nil
+}
+
+func (r *resumeKeyResponse) GetResumeKey() []byte {
+	return r.resumeKey
+}
+
+func TestResumeKeyHandler(t *testing.T) {
+	b := NewRequestBroker("test", 10, 1)
+	b.reset()
+	b.resumable = true
+
+	calls := 0
+	handler := b.resumeKeyHandler(func(resp ResponseReader) bool {
+		calls++
+		return true
+	})
+
+	key := []byte("key1")
+	handler(&resumeKeyResponse{})
+	handler(&resumeKeyResponse{resumeKey: key})
+	handler(&resumeKeyResponse{})
+	if calls != 3 {
+		t.Fatalf("expected 3 calls to the handler, got %v", calls)
+	}
+
+	key[0] = 'x'
+	if next := b.NextResumeKey(); !bytes.Equal(next, []byte("key1")) {
+		t.Fatalf("expected resume key key1, got %s", next)
+	}
+
+	// scans spread over multiple indexers cannot be resumed
+	b.resumable = false
+	if next := b.NextResumeKey(); next != nil {
+		t.Fatalf("expected no resume key, got %s", next)
+	}
+
+	b.reset()
+	b.resumable = true
+	if next := b.NextResumeKey(); next != nil {
+		t.Fatalf("expected no resume key after reset, got %s", next)
+	}
+}
+
+func TestRequestBrokerTimeout(t *testing.T) {
+	b := NewRequestBroker("test", 10, 1)
+	if timeout, err := b.GetTimeout(); timeout != 0 || err != nil {
+		t.Fatalf("expected no timeout, got %v %v", timeout, err)
+	}
+
+	b.setDefaultTimeout(0)
+	if timeout, _ := b.GetTimeout(); timeout != 0 {
+		t.Fatalf("expected no timeout, got %v", timeout)
+	}
+
+	b.setDefaultTimeout(time.Minute)
+	if timeout, err := b.GetTimeout(); err != nil || timeout <= 0 || timeout > time.Minute {
+		t.Fatalf("expected timeout within a minute, got %v %v", timeout, err)
+	}
+
+	// deadline set by the caller is kept
+	b = NewRequestBroker("test", 10, 1)
+	b.SetDeadline(time.Now().Add(-time.Second))
+	b.setDefaultTimeout(time.Minute)
+	if _, err := b.GetTimeout(); err != common.ErrScanTimedOut {
+		t.Fatalf("expected %v, got %v", common.ErrScanTimedOut, err)
+	}
+}
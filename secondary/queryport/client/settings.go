@@ -28,6 +28,10 @@ type ClientSettings struct {
 	prune_replica  int32
 	queueSize      uint64
 	concurrency    uint32
+	hedgeThreshold uint64
+	scanTimeout    uint64
+	cbThreshold    uint32
+	cbCooldown     uint64
 	usePlanner     uint32
 	config         common.Config
 	cancelCh       chan struct{}
@@ -166,6 +170,34 @@ func (s *ClientSettings) handleSettings(config common.Config) {
 		logging.Errorf("ClientSettings: invalid setting value for max_concurrency=%v", concurrency)
 	}
 
+	scanTimeout := config["indexer.settings.scan_timeout"].Int()
+	if scanTimeout >= 0 {
+		atomic.StoreUint64(&s.scanTimeout, uint64(scanTimeout))
+	} else {
+		logging.Errorf("ClientSettings: invalid setting value for scan_timeout=%v", scanTimeout)
+	}
+
+	hedgeThreshold := config["queryport.client.scan.hedge_threshold"].Int()
+	if hedgeThreshold >= 0 {
+		atomic.StoreUint64(&s.hedgeThreshold, uint64(hedgeThreshold))
+	} else {
+		logging.Errorf("ClientSettings: invalid setting value for hedge_threshold=%v", hedgeThreshold)
+	}
+
+	cbThreshold := config["queryport.client.scan.circuit_breaker_threshold"].Int()
+	if cbThreshold >= 0 {
+		atomic.StoreUint32(&s.cbThreshold, uint32(cbThreshold))
+	} else {
+		logging.Errorf("ClientSettings: invalid setting value for circuit_breaker_threshold=%v", cbThreshold)
+	}
+
+	cbCooldown := config["queryport.client.scan.circuit_breaker_cooldown"].Int()
+	if cbCooldown > 0 {
+		atomic.StoreUint64(&s.cbCooldown, uint64(cbCooldown))
+	} else {
+		logging.Errorf("ClientSettings: invalid setting value for circuit_breaker_cooldown=%v", cbCooldown)
+	}
+
 	allowCJsonScanFormat, ok := config["queryport.client.allowCJsonScanFormat"]
 	if ok {
 		if allowCJsonScanFormat.Bool() {
@@ -301,6 +333,22 @@ func (s *ClientSettings) MaxConcurrency() uint32 {
 	return atomic.LoadUint32(&s.concurrency)
 }
 
+func (s *ClientSettings) ScanHedgeThreshold() time.Duration {
+	return time.Duration(atomic.LoadUint64(&s.hedgeThreshold)) * time.Millisecond
+}
+
+func (s *ClientSettings) ScanTimeout() time.Duration {
+	return time.Duration(atomic.LoadUint64(&s.scanTimeout)) * time.Millisecond
+}
+
+func (s *ClientSettings) CircuitBreakerThreshold() int {
+	return int(atomic.LoadUint32(&s.cbThreshold))
+}
+
+func (s *ClientSettings) CircuitBreakerCooldown() time.Duration {
+	return time.Duration(atomic.LoadUint64(&s.cbCooldown)) * time.Millisecond
+}
+
 func (s *ClientSettings) AllowCJsonScanFormat() bool {
 	return atomic.LoadUint32(&s.allowCJsonScanFormat) == 1
 }
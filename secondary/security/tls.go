@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/couchbase/cbauth"
@@ -45,6 +46,11 @@ func setupClientTLSConfig(host string) (*tls.Config, error) {
 		return nil, nil
 	}
 
+	return getClientTLSConfigFromSetting(setting, host)
+}
+
+func getClientTLSConfigFromSetting(setting *SecuritySetting, host string) (*tls.Config, error) {
+
 	// Get certificate and cbauth TLS setting
 	certInBytes := setting.certInBytes
 	if len(certInBytes) == 0 {
@@ -89,6 +95,15 @@ func makeTLSConn(conn net.Conn, hostname, port string) (net.Conn, error) {
 		return nil, err
 	}
 
+	return handshakeTLSConn(conn, tlsConfig, hostname, port)
+}
+
+//
+// Perform TLS handshake on conn with tlsConfig.  If tlsConfig is nil, conn
+// is returned as is.  This function does not close conn upon error.
+//
+func handshakeTLSConn(conn net.Conn, tlsConfig *tls.Config, hostname, port string) (net.Conn, error) {
+
 	// Setup TLS connection
 	if tlsConfig != nil {
 		tlsConn := tls.Client(conn, tlsConfig)
@@ -111,7 +126,7 @@ func makeTLSConn(conn net.Conn, hostname, port string) (net.Conn, error) {
 			}
 		}()
 
-		err = <-errChannel
+		err := <-errChannel
 		if err != nil {
 			return nil, fmt.Errorf("TLS handshake failed when connecting to %v, err=%v\n", hostname, err)
 		}
@@ -211,7 +226,57 @@ func setupServerTLSConfig() (*tls.Config, error) {
 		return nil, nil
 	}
 
-	return getTLSConfigFromSetting(setting)
+	return getReloadableTLSConfig(setting, getTLSConfigFromSetting)
+}
+
+//
+// Get a server TLSConfig that is reloaded on certificate change.  The
+// returned config is built from setting, and on each handshake, it is
+// rebuilt from the current security setting using build.  This allows
+// the listener to pick up the new certificate and TLS preference for new
+// connections without restarting.  Existing connections are not affected.
+//
+func getReloadableTLSConfig(setting *SecuritySetting,
+	build func(*SecuritySetting) (*tls.Config, error)) (*tls.Config, error) {
+
+	config, err := build(setting)
+	if err != nil || config == nil {
+		return config, err
+	}
+
+	var mutex sync.Mutex
+	lastSetting := setting
+	lastConfig := config
+
+	config = config.Clone()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+
+		current := GetSecuritySetting()
+		if current == nil {
+			return nil, nil
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// security setting is immutable once published
+		if current != lastSetting {
+			newConfig, err := build(current)
+			if err != nil {
+				return nil, err
+			}
+			if newConfig == nil {
+				return nil, nil
+			}
+
+			lastSetting = current
+			lastConfig = newConfig
+		}
+
+		return lastConfig, nil
+	}
+
+	return config, nil
 }
 
 func getTLSConfigFromSetting(setting *SecuritySetting) (*tls.Config, error) {
@@ -295,7 +360,7 @@ func MakeAndSecureTCPListener(addr string) (net.Listener, error) {
 		return nil, fmt.Errorf("Security setting required for TLS listener")
 	}
 
-	config, err := getTLSConfigFromSetting(setting)
+	config, err := getReloadableTLSConfig(setting, getTLSConfigFromSetting)
 	if err != nil {
 		return nil, err
 	}
@@ -376,6 +441,258 @@ func MakeListener(addr string) (net.Listener, error) {
 	return listener2, nil
 }
 
+/////////////////////////////////////////////
+// Mutual TLS
+/////////////////////////////////////////////
+
+//
+// MutualTLSConfig is the mutual TLS setting of a connection or listener.
+// When enabled, the client presents the node certificate, and the server
+// requires and verifies it against the cluster CA.  CipherSuites, if not
+// empty, overrides the cipher suites of the cluster TLS setting.  Mutual
+// TLS only applies when encryption is required for the connection.
+//
+type MutualTLSConfig struct {
+	Enabled      bool
+	CipherSuites []uint16
+}
+
+//
+// Parse a comma separated list of cipher suite names, such as
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.  Insecure cipher suites are not
+// accepted.  Cipher suites of TLS 1.3 are not configurable.
+//
+func ParseCipherSuites(names string) ([]uint16, error) {
+
+	suites := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		for _, version := range suite.SupportedVersions {
+			if version < tls.VersionTLS13 {
+				suites[suite.Name] = suite.ID
+				break
+			}
+		}
+	}
+
+	ids := make([]uint16, 0)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+
+		id, ok := suites[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown or insecure cipher suite %v", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+//
+// Verify the certificate chain of the peer against roots, without
+// checking the host name.  This is used for localhost, whose host name
+// is not in the node certificate.
+//
+func verifyPeerChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+
+		if len(rawCerts) == 0 {
+			return errors.New("No certificate has been presented by peer")
+		}
+
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs = append(certs, cert)
+		}
+
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
+
+//
+// Setup client TLSConfig for mutual TLS
+//
+func setupMutualClientTLSConfig(host string, mtls *MutualTLSConfig) (*tls.Config, error) {
+
+	setting := GetSecuritySetting()
+	if setting == nil {
+		return nil, fmt.Errorf("Security setting is nil")
+	}
+
+	if !setting.encryptionEnabled {
+		return nil, nil
+	}
+
+	tlsConfig, err := getClientTLSConfigFromSetting(setting, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if mtls == nil {
+		return tlsConfig, nil
+	}
+
+	if mtls.Enabled {
+		// present node certificate to server
+		cert := setting.certificate
+		if cert == nil {
+			return nil, fmt.Errorf("No certificate has been provided. Can't establish mutual ssl connection to %v", host)
+		}
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+
+		// still verify server certificate if it is localhost
+		if tlsConfig.InsecureSkipVerify {
+			tlsConfig.VerifyPeerCertificate = verifyPeerChain(tlsConfig.RootCAs)
+		}
+	}
+
+	if len(mtls.CipherSuites) != 0 {
+		tlsConfig.CipherSuites = mtls.CipherSuites
+	}
+
+	return tlsConfig, nil
+}
+
+//
+// Setup server TLSConfig for mutual TLS
+//
+func setupMutualServerTLSConfig(mtls *MutualTLSConfig) (*tls.Config, error) {
+
+	setting := GetSecuritySetting()
+	if setting == nil {
+		return nil, fmt.Errorf("Security setting is nil")
+	}
+
+	if !setting.encryptionEnabled {
+		return nil, nil
+	}
+
+	build := func(setting *SecuritySetting) (*tls.Config, error) {
+		return getMutualTLSConfigFromSetting(setting, mtls)
+	}
+	return getReloadableTLSConfig(setting, build)
+}
+
+func getMutualTLSConfigFromSetting(setting *SecuritySetting, mtls *MutualTLSConfig) (*tls.Config, error) {
+
+	config, err := getTLSConfigFromSetting(setting)
+	if err != nil {
+		return nil, err
+	}
+
+	if mtls == nil {
+		return config, nil
+	}
+
+	if mtls.Enabled {
+		// require and verify client certificate
+		certInBytes := setting.certInBytes
+		if len(certInBytes) == 0 {
+			return nil, fmt.Errorf("No certificate has been provided. Can't establish mutual ssl connection")
+		}
+
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM(certInBytes)
+		config.ClientCAs = caCertPool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if len(mtls.CipherSuites) != 0 {
+		config.CipherSuites = mtls.CipherSuites
+	}
+
+	return config, nil
+}
+
+//
+// Setup a TCP or TLS client connection depending whether encryption is used,
+// as MakeConn.  If encryption is used, the connection is set up with the
+// mutual TLS setting mtls.
+//
+func MakeMutualConn(addr string, mtls *MutualTLSConfig) (net.Conn, error) {
+
+	addr, hostname, port, err := EncryptPortFromAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := makeTCPConn(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !EncryptionRequired(hostname, port) {
+		return conn, nil
+	}
+
+	tlsConfig, err := setupMutualClientTLSConfig(hostname, mtls)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn2, err2 := handshakeTLSConn(conn, tlsConfig, hostname, port)
+	if err2 != nil {
+		conn.Close()
+		return nil, err2
+	}
+
+	return conn2, nil
+}
+
+//
+// Set up a TLS or TCP listener depending on whether encryption is used,
+// as MakeListener.  If encryption is used, the listener is set up with the
+// mutual TLS setting mtls.
+//
+func MakeMutualListener(addr string, mtls *MutualTLSConfig) (net.Listener, error) {
+
+	addr, _, _, err := EncryptPortFromAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := MakeProtocolAwareTCPListener(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !EncryptionEnabled() {
+		return listener, nil
+	}
+
+	config, err := setupMutualServerTLSConfig(mtls)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	if config != nil {
+		tlsListener := tls.NewListener(listener, config)
+		logging.Infof("Mutual TLS listener created for %v", tlsListener.Addr().String())
+		return tlsListener, nil
+	}
+
+	return listener, nil
+}
+
 /////////////////////////////////////////////
 // HTTP / HTTPS Client
 /////////////////////////////////////////////
@@ -494,6 +811,36 @@ func MakeClient(u string) (*http.Client, error) {
 type RequestParams struct {
 	Timeout   time.Duration
 	UserAgent string
+
+	// The request is between nodes, and must be made over HTTPS if
+	// node-to-node encryption is enabled.  It fails rather than falls back
+	// to HTTP.
+	EnforceEncryption bool
+}
+
+var ErrEncryptionRequired = errors.New("node-to-node encryption is enabled, but request cannot be encrypted")
+
+//
+// verifyEncryption fails the request if node-to-node encryption is enforced
+// for the request, and the url is not HTTPS.  This happens when the url port
+// has no known TLS port, regardless of the scheme given by the caller.
+//
+func verifyEncryption(url *url.URL, params *RequestParams) error {
+
+	if params == nil || !params.EnforceEncryption {
+		return nil
+	}
+
+	if !pSecurityContext.initialized() || !EncryptionEnabled() || url.Scheme == "https" {
+		return nil
+	}
+
+	if !encryptLocalHost() && IsLocal(url.Hostname()) {
+		return nil
+	}
+
+	logging.Errorf("verifyEncryption: fail request to %v.  Error = %v", url.Host, ErrEncryptionRequired)
+	return fmt.Errorf("%v: %v", ErrEncryptionRequired, url.Host)
 }
 
 //
@@ -508,6 +855,10 @@ func GetWithAuth(u string, params *RequestParams) (*http.Response, error) {
 		return nil, err
 	}
 
+	if err := verifyEncryption(url, params); err != nil {
+		return nil, err
+	}
+
 	start := time.Now()
 	defer func() {
 		logging.Verbosef("GetWithAuth: url %v elapsed %v", url.String(), time.Now().Sub(start))
@@ -551,6 +902,10 @@ func PostWithAuth(u string, bodyType string, body io.Reader, params *RequestPara
 		return nil, err
 	}
 
+	if err := verifyEncryption(url, params); err != nil {
+		return nil, err
+	}
+
 	start := time.Now()
 	defer func() {
 		logging.Verbosef("PostWithAuth: url %v elapsed %v", url.String(), time.Now().Sub(start))
@@ -684,7 +1039,7 @@ func SecureHTTPServer(server *http.Server) error {
 		return fmt.Errorf("Security setting required for https server")
 	}
 
-	config, err := getTLSConfigFromSetting(setting)
+	config, err := getReloadableTLSConfig(setting, getTLSConfigFromSetting)
 	if err != nil {
 		return err
 	}
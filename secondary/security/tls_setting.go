@@ -14,8 +14,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/couchbase/cbauth"
@@ -88,6 +90,9 @@ type SecurityContext struct {
 	// notifier
 	mutex     sync.RWMutex
 	notifiers map[string]SecurityChangeNotifier
+
+	// serializes the updates of the security setting
+	settingMutex sync.Mutex
 }
 
 var pSecurityContext *SecurityContext
@@ -182,7 +187,7 @@ func Refresh(tlsConfig cbauth.TLSConfig, encryptConfig cbauth.ClusterEncryptionC
 		return
 	}
 
-	if err := pSecurityContext.update(newSetting, true); err != nil {
+	if err := pSecurityContext.update(newSetting, true, true); err != nil {
 		logging.Errorf("Fail to update security setting %v", err)
 		return
 	}
@@ -270,6 +275,9 @@ func (p *SecurityContext) refresh(code uint64) error {
 
 	logging.Infof("Recieve security change notification. code %v", code)
 
+	p.settingMutex.Lock()
+	defer p.settingMutex.Unlock()
+
 	newSetting := &SecuritySetting{}
 
 	oldSetting := GetSecuritySetting()
@@ -294,17 +302,24 @@ func (p *SecurityContext) refresh(code uint64) error {
 		}
 	}
 
-	return p.update(newSetting, code&cbauth.CFG_CHANGE_CERTS_TLSCONFIG != 0)
+	return p.update(newSetting, code&cbauth.CFG_CHANGE_CERTS_TLSCONFIG != 0,
+		code&cbauth.CFG_CHANGE_CLUSTER_ENCRYPTION != 0)
 }
 
-func (p *SecurityContext) update(newSetting *SecuritySetting, refreshCert bool) error {
+//
+// Publish the new setting and notify the registered callbacks.  Listeners
+// reload the certificate and TLS config on new connections, so a
+// certificate change alone does not require the callbacks to restart
+// them.  refreshEncrypt is only set when the encryption config changes.
+//
+func (p *SecurityContext) update(newSetting *SecuritySetting, refreshCert bool, encryptChanged bool) error {
 
 	hasEnabled := false
 	oldSetting := GetSecuritySetting()
 	if oldSetting != nil {
 		hasEnabled = oldSetting.encryptionEnabled
 	}
-	refreshEncrypt := hasEnabled || hasEnabled != newSetting.encryptionEnabled
+	refreshEncrypt := encryptChanged && (hasEnabled || hasEnabled != newSetting.encryptionEnabled)
 
 	UpdateSecuritySetting(newSetting)
 
@@ -408,6 +423,103 @@ func (p *SecurityContext) refreshEncryption(setting *SecuritySetting) error {
 	return nil
 }
 
+//////////////////////////////////////////////////////
+// Certificate Reload
+//////////////////////////////////////////////////////
+
+//
+// ReloadCertificate reads the certificate and key files again, and notifies
+// the registered callbacks of the certificate change.  New connections,
+// including those of GetWithAuth/PostWithAuth and those accepted by the
+// listeners, use the new certificate.
+//
+func ReloadCertificate() error {
+
+	p := pSecurityContext
+	if len(p.certFile) == 0 || len(p.keyFile) == 0 {
+		return fmt.Errorf("Certificate location is missing.  Cannot reload certificate")
+	}
+
+	// do not race with a security change notification, which would
+	// publish a setting copied before the reload
+	p.settingMutex.Lock()
+	defer p.settingMutex.Unlock()
+
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return fmt.Errorf("Fail to load SSL certificate: %v", err)
+	}
+
+	certInBytes, err := ioutil.ReadFile(p.certFile)
+	if err != nil {
+		return fmt.Errorf("Fail to read SSL certificate from file: %v", err)
+	}
+
+	newSetting := &SecuritySetting{}
+	if oldSetting := GetSecuritySetting(); oldSetting != nil {
+		temp := *oldSetting
+		newSetting = &temp
+	}
+
+	newSetting.certificate = &cert
+	newSetting.certInBytes = certInBytes
+
+	logging.Infof("Certificate reloaded from %v", p.certFile)
+
+	return p.update(newSetting, true, false)
+}
+
+//
+// WatchCertificate reloads the certificate whenever the certificate or key
+// file is modified.  The files are checked every interval.
+//
+func WatchCertificate(interval time.Duration, stopch <-chan bool) {
+
+	p := pSecurityContext
+	if len(p.certFile) == 0 || len(p.keyFile) == 0 || interval <= 0 {
+		return
+	}
+
+	modTime := func() (time.Time, bool) {
+		var latest time.Time
+		for _, file := range []string{p.certFile, p.keyFile} {
+			fi, err := os.Stat(file)
+			if err != nil {
+				return latest, false
+			}
+			if fi.ModTime().After(latest) {
+				latest = fi.ModTime()
+			}
+		}
+		return latest, true
+	}
+
+	last, _ := modTime()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopch:
+			return
+		case <-ticker.C:
+		}
+
+		// the files can be in the middle of being replaced
+		curr, ok := modTime()
+		if !ok || !curr.After(last) {
+			continue
+		}
+
+		if err := ReloadCertificate(); err != nil {
+			logging.Errorf("WatchCertificate: %v", err)
+			continue
+		}
+		last = curr
+	}
+}
+
 //////////////////////////////////////////////////////
 // Security Change Notifier
 //////////////////////////////////////////////////////
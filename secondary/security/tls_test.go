@@ -0,0 +1,38 @@
+package security
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestParseCipherSuites(t *testing.T) {
+
+	ids, err := ParseCipherSuites(" TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, ,TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []uint16{
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	}
+	if len(ids) != len(expected) || ids[0] != expected[0] || ids[1] != expected[1] {
+		t.Fatalf("expected %v, got %v", expected, ids)
+	}
+
+	if ids, err := ParseCipherSuites(""); err != nil || len(ids) != 0 {
+		t.Fatalf("empty: unexpected suites %v err %v", ids, err)
+	}
+
+	for _, bad := range []string{
+		"TLS_UNKNOWN",
+		"TLS_RSA_WITH_RC4_128_SHA",              // insecure
+		"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256", // insecure
+		"TLS_AES_128_GCM_SHA256",                // TLS 1.3
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_UNKNOWN",
+	} {
+		if ids, err := ParseCipherSuites(bad); err == nil {
+			t.Fatalf("%q: expected error, got %v", bad, ids)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package transport
+
+import "encoding/binary"
+import "strings"
+import "net"
+import "time"
+
+import "github.com/golang/snappy"
+import "github.com/pierrec/lz4/v4"
+
+// lz4 block format does not record the uncompressed length, it is
+// prefixed to the compressed block as uint32.
+const lz4LenSize = 4
+
+// CompressionNames maps compression name, as used in configuration, to
+// its compression bits.
+var CompressionNames = map[string]byte{
+	"none":   CompressionNone,
+	"snappy": CompressionSnappy,
+	"lz4":    CompressionLZ4,
+}
+
+// CompressionName returns the configuration name for compression bits.
+func CompressionName(compression byte) string {
+	for name, typ := range CompressionNames {
+		if typ == compression {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// ParseCompression parses a comma separated list of compression names,
+// in order of preference, ignoring "none" and unknown names.
+func ParseCompression(spec string) []byte {
+	codecs := make([]byte, 0, len(CompressionNames))
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if typ, ok := CompressionNames[name]; ok && typ != CompressionNone {
+			codecs = append(codecs, typ)
+		}
+	}
+	return codecs
+}
+
+func compressSnappy(big []byte) []byte {
+	return snappy.Encode(nil, big)
+}
+
+// decompressSnappy refuses to decode more than `maxLen` bytes, so that a
+// bad length prefix does not make it allocate an arbitrary large buffer.
+func decompressSnappy(small []byte, maxLen int) ([]byte, error) {
+	n, err := snappy.DecodedLen(small)
+	if err != nil {
+		return nil, err
+	} else if n > maxLen {
+		return nil, ErrorPacketOverflow
+	}
+	return snappy.Decode(nil, small)
+}
+
+func compressLZ4(big []byte) ([]byte, error) {
+	small := make([]byte, lz4LenSize+lz4.CompressBlockBound(len(big)))
+	binary.BigEndian.PutUint32(small[:lz4LenSize], uint32(len(big)))
+	n, err := lz4.CompressBlock(big, small[lz4LenSize:], nil)
+	if err != nil {
+		return nil, err
+	} else if n == 0 { // incompressible, caller will send it as is.
+		return big, nil
+	}
+	return small[:lz4LenSize+n], nil
+}
+
+// decompressLZ4 refuses to decode more than `maxLen` bytes, so that a
+// bad length prefix does not make it allocate an arbitrary large buffer.
+func decompressLZ4(small []byte, maxLen int) ([]byte, error) {
+	if len(small) < lz4LenSize {
+		return nil, ErrorCompressionUnknown
+	}
+	size := binary.BigEndian.Uint32(small[:lz4LenSize])
+	if uint64(size) > uint64(maxLen) {
+		return nil, ErrorPacketOverflow
+	}
+	big := make([]byte, size)
+	n, err := lz4.UncompressBlock(small[lz4LenSize:], big)
+	if err != nil {
+		return nil, err
+	}
+	return big[:n], nil
+}
+
+// CompressionOffer is the list of compressions, in order of preference,
+// offered by the sending side of a connection.
+type CompressionOffer []byte
+
+// Pick the first compression in the offer that is also `accepted`,
+// CompressionNone if there is none.
+func (offer CompressionOffer) Pick(accepted []byte) byte {
+	for _, typ := range offer {
+		for _, acc := range accepted {
+			if typ == acc {
+				return typ
+			}
+		}
+	}
+	return CompressionNone
+}
+
+func decodeCompressionOffer(data []byte) (interface{}, error) {
+	offer := make(CompressionOffer, len(data))
+	copy(offer, data)
+	return offer, nil
+}
+
+// NegotiateCompression is called by the sending side right after dialing
+// `conn`. It offers `codecs`, in order of preference, and returns the
+// compression picked by the other end. Remotes that do not understand
+// the handshake close the connection, in which case an error is returned
+// and the caller should redial without compression.
+func NegotiateCompression(
+	conn net.Conn, codecs []byte, timeout time.Duration) (byte, error) {
+
+	buf := make([]byte, pktDataOffset+len(codecs))
+	flags := TransportFlag(0).SetNegotiate()
+	if err := Send(conn, buf, flags, codecs, true); err != nil {
+		return CompressionNone, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+	flags, data, err := Receive(conn, buf)
+	if err != nil {
+		return CompressionNone, err
+	} else if flags.GetEncoding() != EncodingNegotiate || len(data) != 1 {
+		return CompressionNone, ErrorNegotiate
+	}
+	for _, typ := range codecs {
+		if typ == data[0] {
+			return typ, nil
+		}
+	}
+	if data[0] != CompressionNone {
+		return CompressionNone, ErrorNegotiate
+	}
+	return CompressionNone, nil
+}
+
+// AcceptCompression is called by the receiving side on a CompressionOffer,
+// to reply with the `picked` compression.
+func AcceptCompression(conn transporter, picked byte) error {
+	buf := make([]byte, pktDataOffset)
+	flags := TransportFlag(0).SetNegotiate()
+	return Send(conn, buf, flags, []byte{picked}, true)
+}
@@ -0,0 +1,89 @@
+package transport
+
+import "bytes"
+import "encoding/binary"
+import "testing"
+
+func TestCompressionRoundTrip(t *testing.T) {
+	big := bytes.Repeat([]byte("secondary index mutation "), 1000)
+
+	small := compressSnappy(big)
+	if out, err := decompressSnappy(small, len(big)); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(out, big) {
+		t.Fatal("snappy: mismatch after decompression")
+	}
+
+	small, err := compressLZ4(big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := decompressLZ4(small, len(big)); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(out, big) {
+		t.Fatal("lz4: mismatch after decompression")
+	}
+}
+
+func TestDecompressOverflow(t *testing.T) {
+	big := bytes.Repeat([]byte("a"), 4096)
+
+	small := compressSnappy(big)
+	if _, err := decompressSnappy(small, len(big)-1); err != ErrorPacketOverflow {
+		t.Fatalf("snappy: expected %v, got %v", ErrorPacketOverflow, err)
+	}
+
+	small, err := compressLZ4(big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decompressLZ4(small, len(big)-1); err != ErrorPacketOverflow {
+		t.Fatalf("lz4: expected %v, got %v", ErrorPacketOverflow, err)
+	}
+
+	// a bogus length prefix must not be allocated.
+	bogus := make([]byte, lz4LenSize+8)
+	binary.BigEndian.PutUint32(bogus[:lz4LenSize], 0xFFFFFFFF)
+	if _, err := decompressLZ4(bogus, 1024); err != ErrorPacketOverflow {
+		t.Fatalf("lz4: expected %v, got %v", ErrorPacketOverflow, err)
+	}
+	if _, err := decompressLZ4(bogus[:2], 1024); err != ErrorCompressionUnknown {
+		t.Fatalf("lz4: expected %v, got %v", ErrorCompressionUnknown, err)
+	}
+
+	// snappy varint length prefix of ~4GB.
+	bogus = []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0x00}
+	if _, err := decompressSnappy(bogus, 1024); err != ErrorPacketOverflow {
+		t.Fatalf("snappy: expected %v, got %v", ErrorPacketOverflow, err)
+	}
+}
+
+func TestPacketDecompressLimit(t *testing.T) {
+	big := bytes.Repeat([]byte("b"), 64*1024)
+
+	flags := TransportFlag(0).SetCompression(CompressionSnappy)
+	pkt := NewTransportPacket(1024, flags)
+	if _, err := pkt.decompress(compressSnappy(big)); err != ErrorPacketOverflow {
+		t.Fatalf("expected %v, got %v", ErrorPacketOverflow, err)
+	}
+
+	pkt = NewTransportPacket(len(big), flags)
+	if out, err := pkt.decompress(compressSnappy(big)); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(out, big) {
+		t.Fatal("mismatch after decompression")
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	codecs := ParseCompression(" LZ4, none, bogus ,snappy")
+	if len(codecs) != 2 || codecs[0] != CompressionLZ4 || codecs[1] != CompressionSnappy {
+		t.Fatalf("unexpected codecs %v", codecs)
+	}
+	if picked := CompressionOffer(codecs).Pick([]byte{CompressionSnappy}); picked != CompressionSnappy {
+		t.Fatalf("expected snappy, got %v", picked)
+	}
+	if picked := CompressionOffer(codecs).Pick(nil); picked != CompressionNone {
+		t.Fatalf("expected none, got %v", picked)
+	}
+}
@@ -26,6 +26,12 @@ var ErrorEncoderUnknown = errors.New("transport.encoderUnknown")
 // ErrorDecoderUnknown for unknown decoder.
 var ErrorDecoderUnknown = errors.New("transport.decoderUnknown")
 
+// ErrorCompressionUnknown for unknown or unsupported compression.
+var ErrorCompressionUnknown = errors.New("transport.compressionUnknown")
+
+// ErrorNegotiate for failed connection handshake.
+var ErrorNegotiate = errors.New("transport.negotiate")
+
 //ErrorChecksumMismatch for mismatch in checksum
 var ErrorChecksumMismatch = errors.New("transport.checksumUnknown")
 
@@ -53,6 +59,11 @@ type TransportPacket struct {
 	buf      []byte
 	encoders map[byte]Encoder
 	decoders map[byte]Decoder
+
+	// size of the last packet sent or received, before compression and
+	// on the wire.
+	rawLen  int
+	wireLen int
 }
 
 // Encoder callback
@@ -78,6 +89,7 @@ func NewTransportPacket(maxlen int, flags TransportFlag) *TransportPacket {
 	}
 	pkt.encoders[EncodingNone] = nil
 	pkt.decoders[EncodingNone] = nil
+	pkt.decoders[EncodingNegotiate] = decodeCompressionOffer
 	return pkt
 }
 
@@ -95,18 +107,24 @@ func (pkt *TransportPacket) SetDecoder(typ byte, callb Decoder) *TransportPacket
 
 // Send payload to the other end using sufficient encoding and compression.
 func (pkt *TransportPacket) Send(conn transporter, payload interface{}) (err error) {
-	var data []byte
+	var data, small []byte
 
 	// encode
 	if data, err = pkt.encode(payload); err != nil {
 		return
 	}
-	// compress
-	if data, err = pkt.compress(data); err != nil {
+	// compress, fall back to an uncompressed packet if it does not help.
+	flags := pkt.flags
+	if small, err = pkt.compress(data); err != nil {
 		return
+	} else if len(small) < len(data) {
+		pkt.rawLen, pkt.wireLen, data = len(data), len(small), small
+	} else {
+		flags = flags.SetCompression(CompressionNone)
+		pkt.rawLen, pkt.wireLen = len(data), len(data)
 	}
 
-	err = Send(conn, pkt.buf, pkt.flags, data, true)
+	err = Send(conn, pkt.buf, flags, data, true)
 	return
 }
 
@@ -132,9 +150,11 @@ func (pkt *TransportPacket) Receive(conn transporter) (payload interface{}, err
 	logging.Tracef("read %v bytes on connection %v<-%v", len(data), laddr, raddr)
 
 	// de-compression
+	pkt.wireLen = len(data)
 	if data, err = pkt.decompress(data); err != nil {
 		return
 	}
+	pkt.rawLen = len(data)
 	// decoding
 	if payload, err = pkt.decode(data); err != nil {
 		return
@@ -164,20 +184,39 @@ func (pkt *TransportPacket) decode(data []byte) (payload interface{}, err error)
 	return nil, ErrorDecoderUnknown
 }
 
+// LastPacketSize returns the size of the last packet sent or received,
+// before compression and on the wire.
+func (pkt *TransportPacket) LastPacketSize() (raw, wire int) {
+	return pkt.rawLen, pkt.wireLen
+}
+
 // compress array of bytes.
 func (pkt *TransportPacket) compress(big []byte) (small []byte, err error) {
 	switch pkt.flags.GetCompression() {
 	case CompressionNone:
 		small = big
+	case CompressionSnappy:
+		small = compressSnappy(big)
+	case CompressionLZ4:
+		small, err = compressLZ4(big)
+	default:
+		err = ErrorCompressionUnknown
 	}
 	return
 }
 
-// decompress array of bytes.
+// decompress array of bytes, which cannot be larger than maxlen of the
+// packet.
 func (pkt *TransportPacket) decompress(small []byte) (big []byte, err error) {
 	switch pkt.flags.GetCompression() {
 	case CompressionNone:
 		big = small
+	case CompressionSnappy:
+		big, err = decompressSnappy(small, len(pkt.buf))
+	case CompressionLZ4:
+		big, err = decompressLZ4(small, len(pkt.buf))
+	default:
+		err = ErrorCompressionUnknown
 	}
 	return
 }
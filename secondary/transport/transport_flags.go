@@ -14,6 +14,8 @@ const ( // types of encoding over the wire.
 	EncodingNone byte = 0x00
 	// EncodingProtobuf uses protobuf as coding format.
 	EncodingProtobuf byte = 0x10
+	// EncodingNegotiate is used by connection handshake packets.
+	EncodingNegotiate byte = 0x20
 )
 
 const ( // types of compression over the wire.
@@ -25,6 +27,8 @@ const ( // types of compression over the wire.
 	CompressionGzip = 2
 	// CompressionBzip2 apply bzip2 compression on the payload.
 	CompressionBzip2 = 3
+	// CompressionLZ4 apply lz4 block compression on the payload.
+	CompressionLZ4 = 4
 )
 
 // TransportFlag tell packet encoding and compression formats.
@@ -50,6 +54,16 @@ func (flags TransportFlag) SetBzip2() TransportFlag {
 	return (flags & TransportFlag(0xFFF0)) | TransportFlag(CompressionBzip2)
 }
 
+// SetLZ4 will set packet compression to lz4
+func (flags TransportFlag) SetLZ4() TransportFlag {
+	return (flags & TransportFlag(0xFFF0)) | TransportFlag(CompressionLZ4)
+}
+
+// SetCompression will set packet compression to `compression`
+func (flags TransportFlag) SetCompression(compression byte) TransportFlag {
+	return (flags & TransportFlag(0xFFF0)) | TransportFlag(compression&0x0F)
+}
+
 // GetEncoding will get the encoding bits from flags
 func (flags TransportFlag) GetEncoding() byte {
 	return byte(flags & TransportFlag(0x00F0))
@@ -60,6 +74,11 @@ func (flags TransportFlag) SetProtobuf() TransportFlag {
 	return (flags & TransportFlag(0xFF0F)) | TransportFlag(EncodingProtobuf)
 }
 
+// SetNegotiate will set packet encoding to connection handshake
+func (flags TransportFlag) SetNegotiate() TransportFlag {
+	return (flags & TransportFlag(0xFF0F)) | TransportFlag(EncodingNegotiate)
+}
+
 // GetChecksum will get the checksum from flags
 func (flags TransportFlag) GetChecksum() byte {
 	return byte((flags & TransportFlag(0x7F00)) >> 8)
@@ -73,7 +92,7 @@ func (flags TransportFlag) SetChecksum(c byte) TransportFlag {
 func (flags TransportFlag) IsValidEncoding() bool {
 
 	enc := flags.GetEncoding()
-	if enc == EncodingProtobuf {
+	if enc == EncodingProtobuf || enc == EncodingNegotiate {
 		return true
 	}
 	return false